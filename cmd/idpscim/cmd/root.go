@@ -1,15 +1,22 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/hashicorp/go-retryablehttp"
@@ -17,13 +24,20 @@ import (
 	"github.com/slashdevops/idp-scim-sync/internal/config"
 	"github.com/slashdevops/idp-scim-sync/internal/core"
 	"github.com/slashdevops/idp-scim-sync/internal/idp"
+	"github.com/slashdevops/idp-scim-sync/internal/metrics"
 	"github.com/slashdevops/idp-scim-sync/internal/repository"
 	"github.com/slashdevops/idp-scim-sync/internal/scim"
+	"github.com/slashdevops/idp-scim-sync/internal/tracing"
 	"github.com/slashdevops/idp-scim-sync/internal/version"
 	"github.com/slashdevops/idp-scim-sync/pkg/aws"
 	"github.com/slashdevops/idp-scim-sync/pkg/google"
+	"github.com/slashdevops/idp-scim-sync/pkg/ldap"
+	"github.com/slashdevops/idp-scim-sync/pkg/msgraph"
+	"github.com/slashdevops/idp-scim-sync/pkg/okta"
+	scimv2 "github.com/slashdevops/idp-scim-sync/pkg/scim"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -31,6 +45,7 @@ var (
 	logHandler        slog.Handler
 	logHandlerOptions *slog.HandlerOptions
 	logger            *slog.Logger
+	syncMetrics       = metrics.New()
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -78,9 +93,28 @@ func init() {
 		"aws-scim-endpoint-secret-name", "n", config.DefaultAWSSCIMEndpointSecretName,
 		"AWS Secrets Manager secret name for AWS SSO SCIM API Endpoint",
 	)
+	rootCmd.PersistentFlags().IntVar(&cfg.AWSSCIMConcurrency, "aws-scim-concurrency", config.DefaultAWSSCIMConcurrency, "number of users or groups members written at the same time in the AWS SSO SCIM API")
+	rootCmd.PersistentFlags().Float64Var(&cfg.AWSSCIMRateLimit, "aws-scim-rate-limit", config.DefaultAWSSCIMRateLimit, "maximum write requests per second sent to the AWS SSO SCIM API, 0 means no limit")
+
+	rootCmd.PersistentFlags().StringVar(&cfg.SCIMTarget, "scim-target", config.DefaultSCIMTarget, "SCIM service provider to sync to [aws|generic]")
+	rootCmd.PersistentFlags().StringVar(&cfg.SCIMProfile, "scim-profile", config.DefaultSCIMProfile,
+		"quirks of the generic SCIM service provider ["+strings.Join(scimv2.ProfileNames(), "|")+"]",
+	)
+	rootCmd.PersistentFlags().StringVar(&cfg.SCIMEndpoint, "scim-endpoint", "", "generic SCIM 2.0 API endpoint, example: https://api.slack.com/scim/v2")
+	rootCmd.PersistentFlags().StringVar(&cfg.SCIMAccessToken, "scim-access-token", "", "generic SCIM 2.0 API bearer token")
+	rootCmd.PersistentFlags().StringVar(&cfg.SCIMAccessTokenSecretName,
+		"scim-access-token-secret-name", config.DefaultSCIMAccessTokenSecretName,
+		"AWS Secrets Manager secret name for generic SCIM 2.0 API bearer token",
+	)
 
 	rootCmd.PersistentFlags().StringVarP(&cfg.AWSS3BucketName, "aws-s3-bucket-name", "b", "", "AWS S3 Bucket name to store the state")
-	rootCmd.PersistentFlags().StringVarP(&cfg.AWSS3BucketKey, "aws-s3-bucket-key", "k", config.DefaultAWSS3BucketKey, "AWS S3 Bucket key to store the state")
+	rootCmd.PersistentFlags().StringVarP(&cfg.AWSS3BucketKey, "aws-s3-bucket-key", "k", config.DefaultAWSS3BucketKey, "AWS S3 Bucket key to store the state, it is the id of the state with the dynamodb state backend")
+	rootCmd.PersistentFlags().StringVar(&cfg.StateBackend, "state-backend", config.DefaultStateBackend, "where the state is stored [s3|dynamodb], dynamodb rejects the state of concurrent syncs")
+	rootCmd.PersistentFlags().IntVar(&cfg.StateHistory, "state-history", config.DefaultStateHistory, "number of snapshots of the state kept in the history of the state in the AWS S3 bucket, 0 disables the history")
+	rootCmd.PersistentFlags().StringVar(&cfg.AWSDynamoDBTableName, "aws-dynamodb-table-name", "", "AWS DynamoDB table name to store the state with the dynamodb state backend")
+	rootCmd.PersistentFlags().StringVar(&cfg.StateEncryption, "state-encryption", config.DefaultStateEncryption, "how the state is encrypted before it is stored [none|kms|file], the plaintext states are still read")
+	rootCmd.PersistentFlags().StringVar(&cfg.AWSKMSKeyID, "aws-kms-key-id", "", "AWS KMS key id, arn or alias that encrypts the data keys of the state with the kms state encryption")
+	rootCmd.PersistentFlags().StringVar(&cfg.StateEncryptionKeyFile, "state-encryption-key-file", "", "file with the base64 encoded 32 bytes key that encrypts the data keys of the state with the file state encryption, only for testing")
 
 	rootCmd.PersistentFlags().StringVarP(&cfg.GWSServiceAccountFile,
 		"gws-service-account-file", "s", config.DefaultGWSServiceAccountFile,
@@ -105,8 +139,142 @@ func init() {
 		"GWS Groups query parameter, example: --gws-groups-filter 'name:Admin* email:admin*' --gws-groups-filter 'name:Power* email:power*'",
 	)
 
-	rootCmd.PersistentFlags().StringVarP(&cfg.SyncMethod, "sync-method", "m", config.DefaultSyncMethod, "Sync method to use [groups]")
+	rootCmd.Flags().StringSliceVarP(
+		&cfg.GWSUsersFilter, "gws-users-filter", "r", []string{""},
+		"GWS Users query parameter, used by the 'users' sync method, example: --gws-users-filter 'name:John* email:admin*' --gws-users-filter 'name:Jane* email:power*'",
+	)
+
+	rootCmd.PersistentFlags().IntVar(&cfg.GWSConcurrency, "gws-concurrency", config.DefaultGWSConcurrency, "number of groups members or users fetched at the same time from Google Workspace")
+	rootCmd.PersistentFlags().IntVar(&cfg.GWSMaxRetries, "gws-max-retries", config.DefaultGWSMaxRetries, "retries with backoff of a Google Workspace request throttled by the Admin SDK quotas, 0 means no retries")
+	rootCmd.PersistentFlags().StringVar(&cfg.GWSUsersLookup, "gws-users-lookup", config.DefaultGWSUsersLookup,
+		"how the users of the groups members are read from Google Workspace, listing the directory or one by one [auto|list|get]",
+	)
+
+	rootCmd.PersistentFlags().StringVar(&cfg.IDPType, "idp-type", config.DefaultIDPType, "Identity provider to sync from [google|entra|okta|ldap|file]")
+
+	rootCmd.PersistentFlags().StringVar(&cfg.EntraTenantID, "entra-tenant-id", "", "Microsoft Entra ID tenant (directory) id")
+	rootCmd.PersistentFlags().StringVar(&cfg.EntraClientID, "entra-client-id", "", "Microsoft Entra ID application (client) id")
+	rootCmd.PersistentFlags().StringVar(&cfg.EntraClientSecret, "entra-client-secret", "", "Microsoft Entra ID application client secret")
+	rootCmd.PersistentFlags().StringVar(&cfg.EntraClientSecretSecretName,
+		"entra-client-secret-secret-name", config.DefaultEntraClientSecretSecretName,
+		"AWS Secrets Manager secret name for Microsoft Entra ID application client secret",
+	)
+
+	rootCmd.Flags().StringSliceVar(
+		&cfg.EntraGroupsFilter, "entra-groups-filter", []string{""},
+		"Microsoft Graph OData groups filter, example: --entra-groups-filter \"startswith(displayName,'AWS')\"",
+	)
+
+	rootCmd.Flags().StringSliceVar(
+		&cfg.EntraUsersFilter, "entra-users-filter", []string{""},
+		"Microsoft Graph OData users filter, used by the 'users' sync method, example: --entra-users-filter \"department eq 'Engineering'\"",
+	)
+
+	rootCmd.PersistentFlags().StringVar(&cfg.OktaOrgURL, "okta-org-url", "", "Okta org url, example: https://my-org.okta.com")
+	rootCmd.PersistentFlags().StringVar(&cfg.OktaAPIToken, "okta-api-token", "", "Okta API token")
+	rootCmd.PersistentFlags().StringVar(&cfg.OktaAPITokenSecretName,
+		"okta-api-token-secret-name", config.DefaultOktaAPITokenSecretName,
+		"AWS Secrets Manager secret name for Okta API token",
+	)
+
+	rootCmd.Flags().StringSliceVar(
+		&cfg.OktaGroupsFilter, "okta-groups-filter", []string{""},
+		"Okta groups search expression, example: --okta-groups-filter 'profile.name sw \"AWS\"'",
+	)
+
+	rootCmd.Flags().StringSliceVar(
+		&cfg.OktaUsersFilter, "okta-users-filter", []string{""},
+		"Okta users search expression, used by the 'users' sync method, example: --okta-users-filter 'profile.department eq \"Engineering\"'",
+	)
+
+	rootCmd.PersistentFlags().StringVar(&cfg.LDAPURL, "ldap-url", "", "LDAP server url, example: ldaps://dc1.example.com:636")
+	rootCmd.PersistentFlags().StringVar(&cfg.LDAPBindDN, "ldap-bind-dn", "", "LDAP bind DN, example: CN=idpscim,OU=Service Accounts,DC=example,DC=com")
+	rootCmd.PersistentFlags().StringVar(&cfg.LDAPBindPassword, "ldap-bind-password", "", "LDAP bind password")
+	rootCmd.PersistentFlags().StringVar(&cfg.LDAPBindPasswordSecretName,
+		"ldap-bind-password-secret-name", config.DefaultLDAPBindPasswordSecretName,
+		"AWS Secrets Manager secret name for LDAP bind password",
+	)
+	rootCmd.PersistentFlags().StringVar(&cfg.LDAPUsersBaseDN, "ldap-users-base-dn", "", "LDAP base DN of the users, example: OU=People,DC=example,DC=com")
+	rootCmd.PersistentFlags().StringVar(&cfg.LDAPGroupsBaseDN, "ldap-groups-base-dn", "", "LDAP base DN of the groups, example: OU=Groups,DC=example,DC=com")
+	rootCmd.PersistentFlags().StringVar(&cfg.LDAPUserObjectFilter, "ldap-user-object-filter", idp.DefaultLDAPUserObjectFilter, "LDAP filter that identifies the users entries")
+	rootCmd.PersistentFlags().StringVar(&cfg.LDAPGroupObjectFilter, "ldap-group-object-filter", idp.DefaultLDAPGroupObjectFilter, "LDAP filter that identifies the groups entries")
+	rootCmd.PersistentFlags().StringVar(&cfg.LDAPGroupMemberAttribute, "ldap-group-member-attribute", idp.DefaultLDAPGroupMemberAttribute, "LDAP group attribute containing the DN of its members")
+	rootCmd.PersistentFlags().StringVar(&cfg.LDAPUserMemberOfAttribute, "ldap-user-member-of-attribute", "", "LDAP user attribute containing the DN of its groups, example: memberOf, when set the members are searched using it")
+	rootCmd.PersistentFlags().BoolVar(&cfg.LDAPNestedGroups, "ldap-nested-groups", false, "expand the members of the nested groups as members of the parent groups")
+	rootCmd.PersistentFlags().StringToStringVar(&cfg.LDAPAttributeMapping, "ldap-attribute-mapping", nil,
+		"LDAP attributes used for the users and groups fields, example: --ldap-attribute-mapping email=userPrincipalName,cost_center=extensionAttribute1",
+	)
+
+	rootCmd.Flags().StringSliceVar(
+		&cfg.LDAPGroupsFilter, "ldap-groups-filter", []string{""},
+		"LDAP groups filter, example: --ldap-groups-filter '(cn=AWS*)'",
+	)
+
+	rootCmd.Flags().StringSliceVar(
+		&cfg.LDAPUsersFilter, "ldap-users-filter", []string{""},
+		"LDAP users filter, used by the 'users' sync method, example: --ldap-users-filter '(department=Engineering)'",
+	)
+
+	rootCmd.PersistentFlags().StringVar(&cfg.FilePath, "file-path", "",
+		"YAML, JSON or CSV file, or directory with these files, with users and groups, merged with the other identity providers unless --idp-type is file",
+	)
+
+	rootCmd.Flags().StringSliceVar(
+		&cfg.FileGroupsFilter, "file-groups-filter", []string{""},
+		"file groups name pattern, example: --file-groups-filter 'AWS-*'",
+	)
+
+	rootCmd.Flags().StringSliceVar(
+		&cfg.FileUsersFilter, "file-users-filter", []string{""},
+		"file users userName pattern, used by the 'users' sync method, example: --file-users-filter '*@example.com'",
+	)
+
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.IDPSourcesPrecedence, "idp-sources-precedence", nil,
+		"names of the identity provider sources from the highest to the lowest precedence, example: --idp-sources-precedence tenant-a,tenant-b",
+	)
+	rootCmd.PersistentFlags().StringVar(&cfg.IDPGroupsConflictPolicy, "idp-groups-conflict-policy", config.DefaultIDPConflictPolicy,
+		"policy for the groups with the same name in more than one identity provider source [precedence|merge|error]",
+	)
+	rootCmd.PersistentFlags().StringVar(&cfg.IDPUsersConflictPolicy, "idp-users-conflict-policy", config.DefaultIDPConflictPolicy,
+		"policy for the users with the same userName or email in more than one identity provider source [precedence|error]",
+	)
+
+	rootCmd.PersistentFlags().StringVarP(&cfg.SyncMethod, "sync-method", "m", config.DefaultSyncMethod, "Sync method to use [groups|users]")
 	rootCmd.PersistentFlags().BoolVarP(&cfg.UseSecretsManager, "use-secrets-manager", "g", config.DefaultUseSecretsManager, "use AWS Secrets Manager content or not (default false)")
+
+	rootCmd.PersistentFlags().BoolVar(&cfg.DryRun, "dry-run", config.DefaultDryRun, "compute the changes (plan) without applying them in the SCIM side and without storing the state")
+	rootCmd.PersistentFlags().StringVar(&cfg.DryRunOutputFile, "dry-run-output-file", "", "file to write the dry run plan, stdout when empty")
+	rootCmd.PersistentFlags().StringVar(&cfg.DryRunOutputFormat, "dry-run-output-format", config.DefaultDryRunOutputFormat, "dry run plan output format [json|yaml]")
+
+	rootCmd.PersistentFlags().IntVar(&cfg.MaxGroupsDeletion, "max-groups-deletion", 0, "maximum number of groups deleted in a single sync, 0 means no limit")
+	rootCmd.PersistentFlags().Float64Var(&cfg.MaxGroupsDeletionPercent, "max-groups-deletion-percent", 0, "maximum percentage of the existing groups deleted in a single sync, 0 means no limit")
+	rootCmd.PersistentFlags().IntVar(&cfg.MaxUsersDeletion, "max-users-deletion", 0, "maximum number of users deleted in a single sync, 0 means no limit")
+	rootCmd.PersistentFlags().Float64Var(&cfg.MaxUsersDeletionPercent, "max-users-deletion-percent", 0, "maximum percentage of the existing users deleted in a single sync, 0 means no limit")
+	rootCmd.PersistentFlags().IntVar(&cfg.MaxGroupsMembersDeletion, "max-groups-members-deletion", 0, "maximum number of groups memberships deleted in a single sync, 0 means no limit")
+	rootCmd.PersistentFlags().Float64Var(&cfg.MaxGroupsMembersDeletionPercent, "max-groups-members-deletion-percent", 0, "maximum percentage of the existing groups memberships deleted in a single sync, 0 means no limit")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Force, "force", config.DefaultForce, "apply the sync even when the deletion limits are exceeded")
+
+	rootCmd.PersistentFlags().BoolVar(&cfg.UsersSoftDelete, "users-soft-delete", config.DefaultUsersSoftDelete, "deactivate the users removed from the identity provider instead of deleting them")
+	rootCmd.PersistentFlags().IntVar(&cfg.UsersSoftDeleteGracePeriodDays, "users-soft-delete-grace-period-days", config.DefaultUsersSoftDeleteGracePeriodDays, "days a deactivated user is kept before being deleted, 0 means never deleted")
+
+	rootCmd.PersistentFlags().BoolVar(&cfg.PartialFailures, "partial-failures", config.DefaultPartialFailures, "continue the sync when some resources fail, the failed resources are retried in the next sync and the sync ends with an error")
+
+	rootCmd.PersistentFlags().BoolVar(&cfg.Checkpoints, "checkpoints", config.DefaultCheckpoints, "store checkpoints in the state during the first sync and resume a failed first sync from the last one")
+	rootCmd.PersistentFlags().IntVar(&cfg.CheckpointEvery, "checkpoint-every", config.DefaultCheckpointEvery, "store a checkpoint every number of users or groups memberships written, 0 means only after the groups and the users")
+
+	rootCmd.PersistentFlags().BoolVar(&cfg.RunLock, "run-lock", config.DefaultRunLock, "lock the state during the sync, a sync that starts while another one is running ends without syncing")
+	rootCmd.PersistentFlags().IntVar(&cfg.RunLockTTLSeconds, "run-lock-ttl-seconds", config.DefaultRunLockTTLSeconds, "seconds the lock of the state is held without being renewed, the sync renews it every third of them")
+
+	rootCmd.PersistentFlags().StringVar(&cfg.SyncResultOutput, "sync-result-output", config.DefaultSyncResultOutput, "where the json sync result is written [none|stdout|file|s3], s3 writes the result of every target next to its state file, only with the s3 state backend without encryption")
+	rootCmd.PersistentFlags().StringVar(&cfg.SyncResultFile, "sync-result-file", config.DefaultSyncResultFile, "file of the sync result, its name is used as the key with the s3 output")
+
+	rootCmd.PersistentFlags().StringVar(&cfg.MetricsListenAddress, "metrics-listen-address", "", "address of the prometheus /metrics endpoint served while the sync runs, like ':9090', empty disables it")
+	rootCmd.PersistentFlags().StringVar(&cfg.MetricsPushGatewayURL, "metrics-push-gateway-url", "", "prometheus push gateway url where the metrics are pushed after the sync, empty disables it")
+	rootCmd.PersistentFlags().StringVar(&cfg.MetricsPushGatewayJob, "metrics-push-gateway-job", config.DefaultMetricsPushGatewayJob, "job of the metrics pushed to the prometheus push gateway")
+	rootCmd.PersistentFlags().StringVar(&cfg.MetricsTextFile, "metrics-text-file", "", "file where the metrics are written after the sync for the node exporter textfile collector, empty disables it")
+
+	rootCmd.PersistentFlags().StringVar(&cfg.TracingExporter, "tracing-exporter", config.DefaultTracingExporter, "exporter of the opentelemetry spans of the sync [none|stdout|otlp]")
+	rootCmd.PersistentFlags().StringVar(&cfg.TracingOTLPEndpoint, "tracing-otlp-endpoint", "", "url of the OTLP/HTTP collector, example: http://localhost:4318, when empty the OTEL_EXPORTER_OTLP_* environment variables are used")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -115,12 +283,12 @@ func initConfig() {
 	logHandlerOptions = &slog.HandlerOptions{Level: slog.LevelInfo}
 	switch strings.ToLower(cfg.LogFormat) {
 	case "json":
-		logHandler = slog.NewJSONHandler(os.Stdout, logHandlerOptions)
+		logHandler = slog.NewJSONHandler(logOutput(), logHandlerOptions)
 	case "text":
-		logHandler = slog.NewTextHandler(os.Stdout, logHandlerOptions)
+		logHandler = slog.NewTextHandler(logOutput(), logHandlerOptions)
 	default:
 		slog.Warn("unknown log format, using text", "format", cfg.LogFormat)
-		logHandler = slog.NewTextHandler(os.Stdout, logHandlerOptions)
+		logHandler = slog.NewTextHandler(logOutput(), logHandlerOptions)
 	}
 
 	logger = slog.New(logHandler)
@@ -132,18 +300,92 @@ func initConfig() {
 		"log_level",
 		"log_format",
 		"sync_method",
+		"idp_type",
 		"aws_s3_bucket_name",
 		"aws_s3_bucket_key",
+		"state_backend",
+		"aws_dynamodb_table_name",
+		"state_history",
+		"state_encryption",
+		"aws_kms_key_id",
+		"state_encryption_key_file",
 		"gws_user_email",
 		"gws_user_email_secret_name",
 		"gws_service_account_file",
 		"gws_service_account_file_secret_name",
 		"gws_groups_filter",
+		"gws_users_filter",
+		"gws_concurrency",
+		"gws_max_retries",
+		"gws_users_lookup",
+		"entra_tenant_id",
+		"entra_client_id",
+		"entra_client_secret",
+		"entra_client_secret_secret_name",
+		"entra_groups_filter",
+		"entra_users_filter",
+		"okta_org_url",
+		"okta_api_token",
+		"okta_api_token_secret_name",
+		"okta_groups_filter",
+		"okta_users_filter",
+		"ldap_url",
+		"ldap_bind_dn",
+		"ldap_bind_password",
+		"ldap_bind_password_secret_name",
+		"ldap_users_base_dn",
+		"ldap_groups_base_dn",
+		"ldap_user_object_filter",
+		"ldap_group_object_filter",
+		"ldap_group_member_attribute",
+		"ldap_user_member_of_attribute",
+		"ldap_nested_groups",
+		"ldap_groups_filter",
+		"ldap_users_filter",
+		"ldap_attribute_mapping",
+		"file_path",
+		"file_groups_filter",
+		"file_users_filter",
+		"idp_sources_precedence",
+		"idp_groups_conflict_policy",
+		"idp_users_conflict_policy",
+		"scim_target",
+		"scim_profile",
+		"scim_endpoint",
+		"scim_access_token",
+		"scim_access_token_secret_name",
 		"aws_scim_access_token",
 		"aws_scim_access_token_secret_name",
 		"aws_scim_endpoint",
 		"aws_scim_endpoint_secret_name",
+		"aws_scim_concurrency",
+		"aws_scim_rate_limit",
 		"use_secrets_manager",
+		"dry_run",
+		"dry_run_output_file",
+		"dry_run_output_format",
+		"max_groups_deletion",
+		"max_groups_deletion_percent",
+		"max_users_deletion",
+		"max_users_deletion_percent",
+		"max_groups_members_deletion",
+		"max_groups_members_deletion_percent",
+		"force",
+		"users_soft_delete",
+		"users_soft_delete_grace_period_days",
+		"partial_failures",
+		"checkpoints",
+		"checkpoint_every",
+		"run_lock",
+		"run_lock_ttl_seconds",
+		"sync_result_output",
+		"sync_result_file",
+		"metrics_listen_address",
+		"metrics_push_gateway_url",
+		"metrics_push_gateway_job",
+		"metrics_text_file",
+		"tracing_exporter",
+		"tracing_otlp_endpoint",
 	}
 	for _, e := range envVars {
 		if err := viper.BindEnv(e); err != nil {
@@ -188,14 +430,18 @@ func initConfig() {
 
 	switch strings.ToLower(cfg.LogFormat) {
 	case "json":
-		logHandler = slog.NewJSONHandler(os.Stdout, logHandlerOptions)
+		logHandler = slog.NewJSONHandler(logOutput(), logHandlerOptions)
 	case "text":
-		logHandler = slog.NewTextHandler(os.Stdout, logHandlerOptions)
+		logHandler = slog.NewTextHandler(logOutput(), logHandlerOptions)
 	default:
 		slog.Warn("unknown log format, using text", "format", cfg.LogFormat)
-		logHandler = slog.NewTextHandler(os.Stdout, logHandlerOptions)
+		logHandler = slog.NewTextHandler(logOutput(), logHandlerOptions)
 	}
 
+	// the configuration file can change the output of the logs
+	logger = slog.New(logHandler)
+	slog.SetDefault(logger)
+
 	switch strings.ToLower(cfg.LogLevel) {
 	case "debug":
 		logHandlerOptions = &slog.HandlerOptions{Level: slog.LevelDebug, AddSource: true}
@@ -217,13 +463,88 @@ func initConfig() {
 		getSecrets()
 	}
 
-	// not implemented yet block
-	if cfg.SyncMethod != "groups" {
-		slog.Error("only 'sync-method=groups' are implemented")
+	if cfg.SyncMethod != config.SyncMethodGroups && cfg.SyncMethod != config.SyncMethodUsers {
+		slog.Error("only 'sync-method=groups' and 'sync-method=users' are implemented")
+		os.Exit(1)
+	}
+
+	if !validIDPType(cfg.IDPType) {
+		slog.Error("only 'idp-type=google', 'idp-type=entra', 'idp-type=okta', 'idp-type=ldap' and 'idp-type=file' are implemented")
+		os.Exit(1)
+	}
+
+	if !validSCIMTarget(cfg.SCIMTarget) {
+		slog.Error("only 'scim-target=aws' and 'scim-target=generic' are implemented")
 		os.Exit(1)
 	}
 }
 
+// logOutput returns where the logs are written, the standard error when the sync plan
+// or the sync result are written into the standard output, so they can be parsed
+func logOutput() io.Writer {
+	if (cfg.DryRun && cfg.DryRunOutputFile == "") || cfg.SyncResultOutput == config.SyncResultOutputStdout {
+		return os.Stderr
+	}
+
+	return os.Stdout
+}
+
+// validIDPType returns true when the identity provider type is implemented
+func validIDPType(idpType string) bool {
+	switch idpType {
+	case config.IDPTypeGoogle, config.IDPTypeEntra, config.IDPTypeOkta, config.IDPTypeLDAP, config.IDPTypeFile:
+		return true
+	default:
+		return false
+	}
+}
+
+// validSCIMTarget returns true when the SCIM target is implemented
+func validSCIMTarget(scimTarget string) bool {
+	switch scimTarget {
+	case config.SCIMTargetAWS, config.SCIMTargetGeneric:
+		return true
+	default:
+		return false
+	}
+}
+
+func validTracingExporter(exporter string) bool {
+	switch exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+		return true
+	default:
+		return false
+	}
+}
+
+func validStateBackend(backend string) bool {
+	switch backend {
+	case config.StateBackendS3, config.StateBackendDynamoDB:
+		return true
+	default:
+		return false
+	}
+}
+
+func validStateEncryption(encryption string) bool {
+	switch encryption {
+	case config.StateEncryptionNone, config.StateEncryptionKMS, config.StateEncryptionFile:
+		return true
+	default:
+		return false
+	}
+}
+
+func validSyncResultOutput(output string) bool {
+	switch output {
+	case config.SyncResultOutputNone, config.SyncResultOutputStdout, config.SyncResultOutputFile, config.SyncResultOutputS3:
+		return true
+	default:
+		return false
+	}
+}
+
 func getSecrets() {
 	slog.Info("reading secrets from AWS Secrets Manager")
 
@@ -241,91 +562,178 @@ func getSecrets() {
 		os.Exit(1)
 	}
 
-	slog.Debug("reading secret", "name", cfg.GWSUserEmailSecretName)
-	unwrap, err := secrets.GetSecretValue(context.Background(), cfg.GWSUserEmailSecretName)
-	if err != nil {
-		slog.Error("cannot get secretmanager value", "error", err)
-		os.Exit(1)
+	// the secrets of the identity provider sources are read when the sources are created
+	if len(cfg.IDPSources) == 0 {
+		if err := getIDPSecrets(context.Background(), secrets, &cfg); err != nil {
+			slog.Error("cannot get secretmanager value", "error", err)
+			os.Exit(1)
+		}
 	}
-	cfg.GWSUserEmail = unwrap
 
-	slog.Debug("reading secret", "name", cfg.GWSServiceAccountFileSecretName)
-	unwrap, err = secrets.GetSecretValue(context.Background(), cfg.GWSServiceAccountFileSecretName)
-	if err != nil {
-		slog.Error("cannot get secretmanager value", "error", err)
-		os.Exit(1)
+	// the secrets of the scim targets are read when the targets are created
+	if len(cfg.SCIMTargets) == 0 {
+		if err := getSCIMSecrets(context.Background(), secrets, &cfg); err != nil {
+			slog.Error("cannot get secretmanager value", "error", err)
+			os.Exit(1)
+		}
 	}
-	cfg.GWSServiceAccountFile = unwrap
+}
 
-	slog.Debug("reading secret", "name", cfg.AWSSCIMAccessTokenSecretName)
-	unwrap, err = secrets.GetSecretValue(context.Background(), cfg.AWSSCIMAccessTokenSecretName)
+// getSCIMSecrets reads the secrets of the SCIM target of the configuration from AWS Secrets Manager
+func getSCIMSecrets(ctx context.Context, secrets *aws.SecretsManagerService, c *config.Config) error {
+	if c.SCIMTarget == config.SCIMTargetGeneric {
+		slog.Debug("reading secret", "name", c.SCIMAccessTokenSecretName)
+		unwrap, err := secrets.GetSecretValue(ctx, c.SCIMAccessTokenSecretName)
+		if err != nil {
+			return err
+		}
+		c.SCIMAccessToken = unwrap
+
+		return nil
+	}
+
+	slog.Debug("reading secret", "name", c.AWSSCIMAccessTokenSecretName)
+	unwrap, err := secrets.GetSecretValue(ctx, c.AWSSCIMAccessTokenSecretName)
 	if err != nil {
-		slog.Error("cannot get secretmanager value", "error", err)
-		os.Exit(1)
+		return err
 	}
-	cfg.AWSSCIMAccessToken = unwrap
+	c.AWSSCIMAccessToken = unwrap
 
-	slog.Debug("reading secret", "name", cfg.AWSSCIMEndpointSecretName)
-	unwrap, err = secrets.GetSecretValue(context.Background(), cfg.AWSSCIMEndpointSecretName)
+	slog.Debug("reading secret", "name", c.AWSSCIMEndpointSecretName)
+	unwrap, err = secrets.GetSecretValue(ctx, c.AWSSCIMEndpointSecretName)
 	if err != nil {
-		slog.Error("cannot get secretmanager value", "error", err)
-		os.Exit(1)
+		return err
 	}
-	cfg.AWSSCIMEndpoint = unwrap
+	c.AWSSCIMEndpoint = unwrap
+
+	return nil
+}
+
+// getIDPSecrets reads the secrets of the identity provider type of the configuration
+func getIDPSecrets(ctx context.Context, secrets *aws.SecretsManagerService, c *config.Config) error {
+	switch c.IDPType {
+	case config.IDPTypeEntra:
+		slog.Debug("reading secret", "name", c.EntraClientSecretSecretName)
+		unwrap, err := secrets.GetSecretValue(ctx, c.EntraClientSecretSecretName)
+		if err != nil {
+			return err
+		}
+		c.EntraClientSecret = unwrap
+	case config.IDPTypeOkta:
+		slog.Debug("reading secret", "name", c.OktaAPITokenSecretName)
+		unwrap, err := secrets.GetSecretValue(ctx, c.OktaAPITokenSecretName)
+		if err != nil {
+			return err
+		}
+		c.OktaAPIToken = unwrap
+	case config.IDPTypeLDAP:
+		slog.Debug("reading secret", "name", c.LDAPBindPasswordSecretName)
+		unwrap, err := secrets.GetSecretValue(ctx, c.LDAPBindPasswordSecretName)
+		if err != nil {
+			return err
+		}
+		c.LDAPBindPassword = unwrap
+	case config.IDPTypeFile:
+		// the file identity provider doesn't use secrets
+	default:
+		slog.Debug("reading secret", "name", c.GWSUserEmailSecretName)
+		unwrap, err := secrets.GetSecretValue(ctx, c.GWSUserEmailSecretName)
+		if err != nil {
+			return err
+		}
+		c.GWSUserEmail = unwrap
+
+		slog.Debug("reading secret", "name", c.GWSServiceAccountFileSecretName)
+		unwrap, err = secrets.GetSecretValue(ctx, c.GWSServiceAccountFileSecretName)
+		if err != nil {
+			return err
+		}
+		c.GWSServiceAccountFile = unwrap
+	}
+
+	return nil
 }
 
 func sync() error {
 	slog.Debug("viper config", "config", viper.AllSettings())
 
-	if cfg.SyncMethod != "groups" {
-		slog.Error("only 'sync-method=groups' are implemented")
+	if cfg.SyncMethod != config.SyncMethodGroups && cfg.SyncMethod != config.SyncMethodUsers {
+		slog.Error("only 'sync-method=groups' and 'sync-method=users' are implemented")
 		return fmt.Errorf("unknown sync method: %s", cfg.SyncMethod)
 	}
 
-	return syncGroups()
-}
+	if !validIDPType(cfg.IDPType) {
+		slog.Error("only 'idp-type=google', 'idp-type=entra', 'idp-type=okta', 'idp-type=ldap' and 'idp-type=file' are implemented")
+		return fmt.Errorf("unknown identity provider type: %s", cfg.IDPType)
+	}
 
-func syncGroups() error {
-	slog.Info("starting sync groups", "codeVersion", version.Version)
-	timeStart := time.Now()
+	if !validSCIMTarget(cfg.SCIMTarget) {
+		slog.Error("only 'scim-target=aws' and 'scim-target=generic' are implemented")
+		return fmt.Errorf("unknown scim target: %s", cfg.SCIMTarget)
+	}
 
-	// cfg.GWSServiceAccountFile could be a file path or a content of the file
-	gwsServiceAccountContent := []byte(cfg.GWSServiceAccountFile)
+	if !validSyncResultOutput(cfg.SyncResultOutput) {
+		slog.Error("only 'sync-result-output=none', 'sync-result-output=stdout', 'sync-result-output=file' and 'sync-result-output=s3' are implemented")
+		return fmt.Errorf("unknown sync result output: %s", cfg.SyncResultOutput)
+	}
 
-	if !cfg.IsLambda {
-		gwsServiceAccount, err := os.ReadFile(cfg.GWSServiceAccountFile)
-		if err != nil {
-			slog.Error("cannot read service account file", "error", err)
+	if cfg.SyncResultOutput == config.SyncResultOutputS3 {
+		if _, err := syncResultS3Locations(); err != nil {
+			return err
 		}
-		gwsServiceAccountContent = gwsServiceAccount
 	}
 
-	gwsAPIScopes := []string{
-		"https://www.googleapis.com/auth/admin.directory.group.readonly",
-		"https://www.googleapis.com/auth/admin.directory.group.member.readonly",
-		"https://www.googleapis.com/auth/admin.directory.user.readonly",
+	if !validTracingExporter(cfg.TracingExporter) {
+		slog.Error("only 'tracing-exporter=none', 'tracing-exporter=stdout' and 'tracing-exporter=otlp' are implemented")
+		return fmt.Errorf("unknown tracing exporter: %s", cfg.TracingExporter)
 	}
 
+	if !validStateBackend(cfg.StateBackend) {
+		slog.Error("only 'state-backend=s3' and 'state-backend=dynamodb' are implemented")
+		return fmt.Errorf("unknown state backend: %s", cfg.StateBackend)
+	}
+
+	if !validStateEncryption(cfg.StateEncryption) {
+		slog.Error("only 'state-encryption=none', 'state-encryption=kms' and 'state-encryption=file' are implemented")
+		return fmt.Errorf("unknown state encryption: %s", cfg.StateEncryption)
+	}
+
+	return runSync()
+}
+
+func runSync() error {
+	slog.Info("starting sync", "method", cfg.SyncMethod, "idpType", cfg.IDPType, "codeVersion", version.Version)
+	timeStart := time.Now()
+
 	ctx := context.Background()
 
-	// Google Client Service
-	gwsService, err := google.NewService(ctx, cfg.GWSUserEmail, gwsServiceAccountContent, gwsAPIScopes...)
-	if err != nil {
-		return errors.Wrap(err, "cannot create google service")
+	if cfg.MetricsListenAddress != "" {
+		stop := serveMetrics(cfg.MetricsListenAddress)
+		defer stop()
 	}
 
-	// Google Directory Service
-	gwsDS, err := google.NewDirectoryService(gwsService)
+	// the spans of the stdout exporter are written into stderr, apart from the plan and the result
+	tracerProvider, shutdownTracing, err := tracing.NewTracerProvider(ctx, cfg.TracingExporter, cfg.TracingOTLPEndpoint, os.Stderr)
 	if err != nil {
-		return errors.Wrap(err, "cannot create google directory service")
+		return errors.Wrap(err, "cannot create tracer provider")
 	}
+	defer func() {
+		// the pending spans are exported before exiting
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("cannot export the pending spans", "error", err)
+		}
+	}()
 
 	// Identity Provider Service
-	idpService, err := idp.NewIdentityProvider(gwsDS)
+	idpService, groupsFilter, usersFilter, err := newIdentityProvider(ctx)
 	if err != nil {
 		return errors.Wrap(err, "cannot create identity provider service")
 	}
 
+	if closer, ok := idpService.(io.Closer); ok {
+		defer closer.Close()
+	}
+
 	// httpClient
 	retryClient := retryablehttp.NewClient()
 	retryClient.RetryMax = 10
@@ -340,43 +748,715 @@ func syncGroups() error {
 
 	httpClient := retryClient.StandardClient()
 
+	// the requests sent to the SCIM services are observed by the metrics
+	scimHTTPClient := syncMetrics.InstrumentSCIMHTTPClient(httpClient)
+
+	awsConf, err := aws.NewDefaultConf(context.Background())
+	if err != nil {
+		slog.Error("cannot load aws config", "error", err)
+		os.Exit(1)
+	}
+
+	s3Client := s3.NewFromConfig(awsConf)
+	dynamoDBClient := dynamodb.NewFromConfig(awsConf)
+
+	// the kms client is only used by the kms state encryption
+	kmsClient := kms.NewFromConfig(awsConf)
+
+	ssOpts := []core.SyncServiceOption{
+		core.WithIdentityProviderGroupsFilter(groupsFilter),
+		core.WithIdentityProviderUsersFilter(usersFilter),
+		core.WithGroupsDeletionThreshold(core.DeletionThreshold{Max: cfg.MaxGroupsDeletion, MaxPercent: cfg.MaxGroupsDeletionPercent}),
+		core.WithUsersDeletionThreshold(core.DeletionThreshold{Max: cfg.MaxUsersDeletion, MaxPercent: cfg.MaxUsersDeletionPercent}),
+		core.WithGroupsMembersDeletionThreshold(core.DeletionThreshold{Max: cfg.MaxGroupsMembersDeletion, MaxPercent: cfg.MaxGroupsMembersDeletionPercent}),
+		core.WithForce(cfg.Force),
+		core.WithTracerProvider(tracerProvider),
+	}
+
+	if cfg.UsersSoftDelete {
+		ssOpts = append(ssOpts, core.WithUsersSoftDelete(time.Duration(cfg.UsersSoftDeleteGracePeriodDays)*24*time.Hour))
+	}
+
+	if cfg.PartialFailures {
+		ssOpts = append(ssOpts, core.WithPartialFailures(cfg.AWSSCIMConcurrency))
+	}
+
+	if cfg.Checkpoints {
+		ssOpts = append(ssOpts, core.WithCheckpoints(cfg.CheckpointEvery))
+	}
+
+	if cfg.RunLock {
+		ssOpts = append(ssOpts, core.WithRunLock(time.Duration(cfg.RunLockTTLSeconds)*time.Second))
+	}
+
+	var ss *core.SyncService
+	if len(cfg.SCIMTargets) > 0 {
+		targets, err := newSyncTargets(ctx, scimHTTPClient, s3Client, dynamoDBClient, kmsClient)
+		if err != nil {
+			return err
+		}
+
+		ss, err = core.NewMultiTargetSyncService(idpService, targets, ssOpts...)
+		if err != nil {
+			return errors.Wrap(err, "cannot create sync service")
+		}
+	} else {
+		scimService, err := newSCIMService(ctx, scimHTTPClient, &cfg)
+		if err != nil {
+			return err
+		}
+
+		repo, _, err := newStateRepository(s3Client, dynamoDBClient, kmsClient, &cfg)
+		if err != nil {
+			slog.Error("cannot create state repository", "error", err)
+			os.Exit(1)
+		}
+
+		ss, err = core.NewSyncService(idpService, scimService, repo, ssOpts...)
+		if err != nil {
+			return errors.Wrap(err, "cannot create sync service")
+		}
+	}
+
+	syncFn, planFn := ss.SyncGroupsAndTheirMembers, ss.PlanGroupsAndTheirMembers
+	if cfg.SyncMethod == config.SyncMethodUsers {
+		syncFn, planFn = ss.SyncUsersAndGroups, ss.PlanUsersAndGroups
+	}
+
+	slog.Debug("app config", "config", cfg)
+
+	if cfg.DryRun {
+		slog.Warn("dry run mode, no changes will be applied in the SCIM side and the state will not be stored")
+
+		plans, err := planFn(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "cannot plan sync using method %s", cfg.SyncMethod)
+		}
+
+		if err := writePlan(plans); err != nil {
+			return errors.Wrap(err, "cannot write the sync plan")
+		}
+
+		changes := false
+		for _, plan := range plans {
+			changes = changes || plan.HasChanges()
+		}
+
+		slog.Info("plan completed", "method", cfg.SyncMethod, "changes", changes, "duration", time.Since(timeStart).String())
+
+		return nil
+	}
+
+	syncResult, err := syncFn(ctx)
+	if errors.Is(err, core.ErrSyncInProgress) {
+		// the sync running holds the state, so this one ends without failing and without writing its result
+		slog.Warn("skipping the sync", "method", cfg.SyncMethod, "reason", err.Error())
+		return nil
+	}
+
+	syncMetrics.ObserveSync(syncResult, err)
+	exportMetrics(ctx, httpClient)
+
+	if wErr := writeSyncResult(ctx, s3Client, syncResult); wErr != nil {
+		slog.Error("cannot write the sync result", "output", cfg.SyncResultOutput, "error", wErr)
+		if err == nil {
+			return errors.Wrap(wErr, "cannot write the sync result")
+		}
+	}
+
+	for _, result := range syncResult.Targets {
+		if result.Report.HasFailures() {
+			for _, failure := range result.Report.Failures {
+				slog.Error("resource sync failed",
+					"target", result.Target,
+					"resource", failure.Resource,
+					"operation", failure.Operation,
+					"name", failure.Name,
+					"error", failure.Err,
+				)
+			}
+			slog.Warn("target partially synced, the failed resources will be retried in the next sync",
+				"target", result.Target,
+				"failures", len(result.Report.Failures),
+				"groups", result.Groups,
+				"users", result.Users,
+				"groupsMembers", result.GroupsMembers,
+			)
+			continue
+		}
+		if result.Err != nil {
+			slog.Error("target sync failed", "target", result.Target, "error", result.Err)
+			continue
+		}
+		slog.Info("target synced", "target", result.Target, "groups", result.Groups, "users", result.Users, "groupsMembers", result.GroupsMembers)
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "cannot sync using method %s", cfg.SyncMethod)
+	}
+
+	slog.Info("sync completed", "method", cfg.SyncMethod, "duration", time.Since(timeStart).String())
+
+	return nil
+}
+
+// newSyncTargets returns the configured SCIM targets, every target with its own SCIM service,
+// state repository and groups filter
+func newSyncTargets(ctx context.Context, httpClient aws.HTTPClient, s3Client *s3.Client, dynamoDBClient *dynamodb.Client, kmsClient repository.KMSClientAPI) ([]core.SyncTarget, error) {
+	secrets, err := newSecretsManagerService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]string, len(cfg.SCIMTargets))
+	targets := make([]core.SyncTarget, 0, len(cfg.SCIMTargets))
+	for idx := range cfg.SCIMTargets {
+		name, groupsFilter, tgtCfg, err := cfg.SCIMTargetConfig(idx)
+		if err != nil {
+			return nil, err
+		}
+
+		if !validSCIMTarget(tgtCfg.SCIMTarget) {
+			return nil, fmt.Errorf("unknown scim target: %s, target: %s", tgtCfg.SCIMTarget, name)
+		}
+
+		repo, state, err := newStateRepository(s3Client, dynamoDBClient, kmsClient, &tgtCfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot create state repository, target: %s", name)
+		}
+
+		// the targets cannot share the same state
+		if other, ok := states[state]; ok {
+			return nil, fmt.Errorf("the targets %s and %s use the same state: %s", other, name, state)
+		}
+		states[state] = name
+
+		if secrets != nil {
+			if err := getSCIMSecrets(ctx, secrets, &tgtCfg); err != nil {
+				return nil, errors.Wrapf(err, "cannot get secretmanager value, target: %s", name)
+			}
+		}
+
+		scimService, err := newSCIMService(ctx, httpClient, &tgtCfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot create scim service, target: %s", name)
+		}
+
+		slog.Info("scim target", "name", name, "scimTarget", tgtCfg.SCIMTarget, "state", state, "groupsFilter", groupsFilter)
+		targets = append(targets, core.SyncTarget{Name: name, SCIM: scimService, Repo: repo, GroupsFilter: groupsFilter})
+	}
+
+	return targets, nil
+}
+
+// newStateRepository returns the state repository of the given configuration and the location of its state,
+// the dynamodb state backend uses the AWS S3 bucket key as the id of the state in the table
+func newStateRepository(s3Client repository.S3ClientAPI, dynamoDBClient repository.DynamoDBClientAPI, kmsClient repository.KMSClientAPI, c *config.Config) (core.StateRepository, string, error) {
+	envelope, err := repository.NewStateEnvelope(kmsClient, c)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "cannot create the state encryption")
+	}
+
+	if c.StateBackend == config.StateBackendDynamoDB {
+		if c.StateHistory > 0 {
+			slog.Warn("the history of the state is only kept with the s3 state backend")
+		}
+
+		repo, err := repository.NewDynamoDBRepository(dynamoDBClient,
+			repository.WithTable(c.AWSDynamoDBTableName),
+			repository.WithStateID(c.AWSS3BucketKey),
+			repository.WithDynamoDBEncryption(envelope),
+		)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return repo, "dynamodb://" + c.AWSDynamoDBTableName + "/" + c.AWSS3BucketKey, nil
+	}
+
+	repo, err := repository.NewS3Repository(s3Client,
+		repository.WithBucket(c.AWSS3BucketName),
+		repository.WithKey(c.AWSS3BucketKey),
+		repository.WithHistory(c.StateHistory),
+		repository.WithEncryption(envelope),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return repo, "s3://" + c.AWSS3BucketName + "/" + c.AWSS3BucketKey, nil
+}
+
+// newSecretsManagerService returns the AWS Secrets Manager service used to read the secrets
+// of the identity provider sources and SCIM targets, nil when the secrets are not used
+func newSecretsManagerService(ctx context.Context) (*aws.SecretsManagerService, error) {
+	if !cfg.IsLambda && !cfg.UseSecretsManager {
+		return nil, nil
+	}
+
+	awsConf, err := aws.NewDefaultConf(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot load aws config")
+	}
+
+	secrets, err := aws.NewSecretsManagerService(secretsmanager.NewFromConfig(awsConf))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create aws secrets manager service")
+	}
+
+	return secrets, nil
+}
+
+// newSCIMService returns the SCIM service of the target of the configuration
+func newSCIMService(ctx context.Context, httpClient aws.HTTPClient, c *config.Config) (core.SCIMService, error) {
+	if c.SCIMTarget == config.SCIMTargetGeneric {
+		profile, err := scimv2.GetProfile(c.SCIMProfile)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get scim profile")
+		}
+
+		genericSCIM, err := scimv2.NewService(httpClient, c.SCIMEndpoint, c.SCIMAccessToken, profile)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create generic scim service")
+		}
+		genericSCIM.UserAgent = "idp-scim-sync/" + version.Version
+
+		// the profile is used as it is when the service provider doesn't publish its configuration
+		if err := genericSCIM.Discover(ctx); err != nil {
+			slog.Warn("cannot read the scim service provider config, using the profile", "profile", profile.Name, "error", err)
+		}
+
+		scimService, err := scim.NewGenericProvider(genericSCIM)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create generic scim provider")
+		}
+
+		return scimService, nil
+	}
+
 	// AWS SCIM Service
-	awsSCIM, err := aws.NewSCIMService(httpClient, cfg.AWSSCIMEndpoint, cfg.AWSSCIMAccessToken)
+	awsSCIM, err := aws.NewSCIMService(httpClient, c.AWSSCIMEndpoint, c.AWSSCIMAccessToken)
 	if err != nil {
-		return errors.Wrap(err, "cannot create aws scim service")
+		return nil, errors.Wrap(err, "cannot create aws scim service")
 	}
 	awsSCIM.UserAgent = "idp-scim-sync/" + version.Version
 
-	scimService, err := scim.NewProvider(awsSCIM)
+	scimService, err := scim.NewProvider(awsSCIM,
+		scim.WithConcurrency(c.AWSSCIMConcurrency),
+		scim.WithRateLimit(c.AWSSCIMRateLimit),
+	)
 	if err != nil {
-		return errors.Wrap(err, "cannot create scim provider")
+		return nil, errors.Wrap(err, "cannot create scim provider")
 	}
 
-	awsConf, err := aws.NewDefaultConf(context.Background())
+	return scimService, nil
+}
+
+// newIdentityProvider returns the identity provider service of the configured type
+// and the groups and users filters to use with it, when identity provider sources or a file path
+// are configured the users and groups of all of them are merged
+func newIdentityProvider(ctx context.Context) (core.IdentityProviderService, []string, []string, error) {
+	if len(cfg.IDPSources) > 0 {
+		return newCompositeIdentityProvider(ctx)
+	}
+
+	idpService, groupsFilter, usersFilter, err := newIdentityProviderOfType(ctx, &cfg)
 	if err != nil {
-		slog.Error("cannot load aws config", "error", err)
-		os.Exit(1)
+		return nil, nil, nil, err
 	}
 
-	s3Client := s3.NewFromConfig(awsConf)
-	repo, err := repository.NewS3Repository(s3Client, repository.WithBucket(cfg.AWSS3BucketName), repository.WithKey(cfg.AWSS3BucketKey))
+	if cfg.FilePath == "" || cfg.IDPType == config.IDPTypeFile {
+		return idpService, groupsFilter, usersFilter, nil
+	}
+
+	fileIDP, err := idp.NewFileIdentityProvider(cfg.FilePath)
 	if err != nil {
-		slog.Error("cannot create s3 repository", "error", err)
-		os.Exit(1)
+		return nil, nil, nil, errors.Wrap(err, "cannot create file identity provider")
 	}
 
-	ss, err := core.NewSyncService(idpService, scimService, repo, core.WithIdentityProviderGroupsFilter(cfg.GWSGroupsFilter))
+	// every source uses its own filters
+	compositeIDP, err := idp.NewCompositeIdentityProvider(
+		[]idp.CompositeSource{
+			{Name: cfg.IDPType, Provider: idpService, GroupsFilter: groupsFilter, UsersFilter: usersFilter},
+			{Name: config.IDPTypeFile, Provider: fileIDP, GroupsFilter: cfg.FileGroupsFilter, UsersFilter: cfg.FileUsersFilter},
+		},
+		compositeIdentityProviderOptions()...,
+	)
 	if err != nil {
-		return errors.Wrap(err, "cannot create sync service")
+		return nil, nil, nil, err
 	}
 
-	slog.Debug("app config", "config", cfg)
+	return compositeIDP, nil, nil, nil
+}
+
+// newCompositeIdentityProvider returns the identity provider service that merges the configured identity provider sources,
+// every source uses its own filters so the returned filters are nil
+func newCompositeIdentityProvider(ctx context.Context) (core.IdentityProviderService, []string, []string, error) {
+	secrets, err := newSecretsManagerService(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	sources := make([]idp.CompositeSource, 0, len(cfg.IDPSources))
+	for idx := range cfg.IDPSources {
+		name, srcCfg, err := cfg.IDPSource(idx)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if !validIDPType(srcCfg.IDPType) {
+			return nil, nil, nil, fmt.Errorf("unknown identity provider type: %s, source: %s", srcCfg.IDPType, name)
+		}
+
+		if secrets != nil {
+			if err := getIDPSecrets(ctx, secrets, &srcCfg); err != nil {
+				return nil, nil, nil, errors.Wrapf(err, "cannot get secretmanager value, source: %s", name)
+			}
+		}
+
+		idpService, groupsFilter, usersFilter, err := newIdentityProviderOfType(ctx, &srcCfg)
+		if err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "cannot create identity provider, source: %s", name)
+		}
+
+		slog.Info("identity provider source", "name", name, "idpType", srcCfg.IDPType)
+		sources = append(sources, idp.CompositeSource{Name: name, Provider: idpService, GroupsFilter: groupsFilter, UsersFilter: usersFilter})
+	}
 
-	if err := ss.SyncGroupsAndTheirMembers(ctx); err != nil {
-		return errors.Wrap(err, "cannot sync groups and their members")
+	compositeIDP, err := idp.NewCompositeIdentityProvider(sources, compositeIdentityProviderOptions()...)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
-	slog.Info("sync groups completed", "duration", time.Since(timeStart).String())
+	return compositeIDP, nil, nil, nil
+}
+
+// compositeIdentityProviderOptions returns the configured precedence and conflict policies of the identity provider sources
+func compositeIdentityProviderOptions() []idp.CompositeIdentityProviderOption {
+	return []idp.CompositeIdentityProviderOption{
+		idp.WithCompositePrecedence(cfg.IDPSourcesPrecedence...),
+		idp.WithCompositeGroupsConflictPolicy(idp.CompositeConflictPolicy(cfg.IDPGroupsConflictPolicy)),
+		idp.WithCompositeUsersConflictPolicy(idp.CompositeConflictPolicy(cfg.IDPUsersConflictPolicy)),
+	}
+}
+
+// newIdentityProviderOfType returns the identity provider service of the type of the configuration
+// and the groups and users filters to use with it
+func newIdentityProviderOfType(ctx context.Context, c *config.Config) (core.IdentityProviderService, []string, []string, error) {
+	switch c.IDPType {
+	case config.IDPTypeEntra:
+		graphClient, err := msgraph.NewHTTPClient(ctx, c.EntraTenantID, c.EntraClientID, c.EntraClientSecret)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "cannot create microsoft graph http client")
+		}
+
+		graphService, err := msgraph.NewService(graphClient, msgraph.DefaultURL)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "cannot create microsoft graph service")
+		}
+		graphService.UserAgent = "idp-scim-sync/" + version.Version
+
+		entraIDP, err := idp.NewEntraIdentityProvider(graphService)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return entraIDP, c.EntraGroupsFilter, c.EntraUsersFilter, nil
+	case config.IDPTypeOkta:
+		oktaService, err := okta.NewService(&http.Client{Timeout: 60 * time.Second}, c.OktaOrgURL, c.OktaAPIToken)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "cannot create okta service")
+		}
+		oktaService.UserAgent = "idp-scim-sync/" + version.Version
+
+		oktaIDP, err := idp.NewOktaIdentityProvider(oktaService)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return oktaIDP, c.OktaGroupsFilter, c.OktaUsersFilter, nil
+	case config.IDPTypeLDAP:
+		mapping, err := idp.DefaultLDAPAttributeMapping().Override(c.LDAPAttributeMapping)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "cannot create ldap attribute mapping")
+		}
+
+		ldapService, err := ldap.NewService(c.LDAPURL, c.LDAPBindDN, c.LDAPBindPassword)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "cannot create ldap service")
+		}
+
+		ldapIDP, err := idp.NewLDAPIdentityProvider(ldapService,
+			idp.WithLDAPUsersBaseDN(c.LDAPUsersBaseDN),
+			idp.WithLDAPGroupsBaseDN(c.LDAPGroupsBaseDN),
+			idp.WithLDAPUserObjectFilter(c.LDAPUserObjectFilter),
+			idp.WithLDAPGroupObjectFilter(c.LDAPGroupObjectFilter),
+			idp.WithLDAPGroupMemberAttribute(c.LDAPGroupMemberAttribute),
+			idp.WithLDAPUserMemberOfAttribute(c.LDAPUserMemberOfAttribute),
+			idp.WithLDAPNestedGroups(c.LDAPNestedGroups),
+			idp.WithLDAPAttributeMapping(mapping),
+		)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return ldapIDP, c.LDAPGroupsFilter, c.LDAPUsersFilter, nil
+	case config.IDPTypeFile:
+		fileIDP, err := idp.NewFileIdentityProvider(c.FilePath)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "cannot create file identity provider")
+		}
+
+		return fileIDP, c.FileGroupsFilter, c.FileUsersFilter, nil
+	default:
+		// c.GWSServiceAccountFile could be a file path or a content of the file
+		gwsServiceAccountContent := []byte(c.GWSServiceAccountFile)
+
+		if !c.IsLambda {
+			gwsServiceAccount, err := os.ReadFile(c.GWSServiceAccountFile)
+			if err != nil {
+				slog.Error("cannot read service account file", "error", err)
+			}
+			gwsServiceAccountContent = gwsServiceAccount
+		}
+
+		gwsAPIScopes := []string{
+			"https://www.googleapis.com/auth/admin.directory.group.readonly",
+			"https://www.googleapis.com/auth/admin.directory.group.member.readonly",
+			"https://www.googleapis.com/auth/admin.directory.user.readonly",
+		}
+
+		// Google Client Service
+		gwsService, err := google.NewService(ctx, c.GWSUserEmail, gwsServiceAccountContent, gwsAPIScopes...)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "cannot create google service")
+		}
+
+		// Google Directory Service
+		gwsDS, err := google.NewDirectoryService(gwsService)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "cannot create google directory service")
+		}
+
+		gwsIDP, err := idp.NewIdentityProvider(gwsDS,
+			idp.WithGoogleConcurrency(c.GWSConcurrency),
+			idp.WithGoogleMaxRetries(c.GWSMaxRetries),
+			idp.WithGoogleUsersLookup(idp.GoogleUsersLookup(c.GWSUsersLookup)),
+			idp.WithGoogleAPICallObserver(syncMetrics),
+		)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return gwsIDP, c.GWSGroupsFilter, c.GWSUsersFilter, nil
+	}
+}
+
+// serveMetrics serves the prometheus /metrics endpoint in the given address until the returned function is called
+func serveMetrics(addr string) func() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(syncMetrics.Registry))
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		slog.Info("serving metrics", "address", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("cannot serve metrics", "address", addr, "error", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Error("cannot stop serving metrics", "error", err)
+		}
+	}
+}
+
+// exportMetrics pushes the metrics to the prometheus push gateway and writes them into the
+// textfile collector file when they are configured, the errors don't fail the sync
+func exportMetrics(ctx context.Context, httpClient *http.Client) {
+	if cfg.MetricsPushGatewayURL != "" {
+		if err := metrics.Push(ctx, httpClient, cfg.MetricsPushGatewayURL, cfg.MetricsPushGatewayJob, syncMetrics.Registry); err != nil {
+			slog.Error("cannot push the metrics", "url", cfg.MetricsPushGatewayURL, "error", err)
+		} else {
+			slog.Info("metrics pushed", "url", cfg.MetricsPushGatewayURL, "job", cfg.MetricsPushGatewayJob)
+		}
+	}
+
+	if cfg.MetricsTextFile != "" {
+		if err := metrics.WriteTextFile(cfg.MetricsTextFile, syncMetrics.Registry); err != nil {
+			slog.Error("cannot write the metrics text file", "file", cfg.MetricsTextFile, "error", err)
+		} else {
+			slog.Info("metrics written", "file", cfg.MetricsTextFile)
+		}
+	}
+}
+
+// writePlan writes the sync plans into the configured output file or stdout
+// using the configured output format, with only one target its plan is written alone
+func writePlan(plans []*core.SyncPlan) error {
+	var (
+		data []byte
+		err  error
+	)
+
+	var plan any = plans
+	if len(plans) == 1 {
+		plan = plans[0]
+	}
+
+	switch strings.ToLower(cfg.DryRunOutputFormat) {
+	case "json":
+		data, err = json.MarshalIndent(plan, "", "  ")
+	case "yaml":
+		data, err = yaml.Marshal(plan)
+	default:
+		return fmt.Errorf("unknown dry run output format: %s", cfg.DryRunOutputFormat)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot marshal the sync plan: %w", err)
+	}
+
+	if cfg.DryRunOutputFile == "" {
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if err := os.WriteFile(cfg.DryRunOutputFile, data, 0o600); err != nil {
+		return fmt.Errorf("cannot write the sync plan file: %w", err)
+	}
+
+	slog.Info("sync plan written", "file", cfg.DryRunOutputFile, "format", cfg.DryRunOutputFormat)
 
 	return nil
 }
+
+// writeSyncResult writes the sync result as json into the configured sync result output,
+// the s3 output writes the result of every target into the bucket of its state, with the name
+// of the sync result file as key in the same folder of the state file.
+func writeSyncResult(ctx context.Context, s3Client *s3.Client, result *core.SyncResult) error {
+	if cfg.SyncResultOutput == config.SyncResultOutputNone {
+		return nil
+	}
+
+	if cfg.SyncResultOutput == config.SyncResultOutputS3 {
+		return putSyncResult(ctx, s3Client, result)
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot marshal the sync result: %w", err)
+	}
+
+	switch cfg.SyncResultOutput {
+	case config.SyncResultOutputStdout:
+		fmt.Println(string(data))
+	case config.SyncResultOutputFile:
+		if err := os.WriteFile(cfg.SyncResultFile, data, 0o600); err != nil {
+			return fmt.Errorf("cannot write the sync result file: %w", err)
+		}
+
+		slog.Info("sync result written", "file", cfg.SyncResultFile)
+	default:
+		return fmt.Errorf("unknown sync result output: %s", cfg.SyncResultOutput)
+	}
+
+	return nil
+}
+
+// putSyncResult writes the result of every target, with the identity provider result,
+// into the AWS S3 bucket of the state of the target
+func putSyncResult(ctx context.Context, s3Client *s3.Client, result *core.SyncResult) error {
+	locations, err := syncResultS3Locations()
+	if err != nil {
+		return err
+	}
+
+	contentType := "application/json"
+	for _, target := range result.Targets {
+		loc, ok := locations[target.Target]
+		if !ok {
+			return fmt.Errorf("unknown target of the sync result: %s", target.Target)
+		}
+
+		targetResult := *result
+		targetResult.Targets = []*core.SyncTargetResult{target}
+
+		data, err := json.MarshalIndent(&targetResult, "", "  ")
+		if err != nil {
+			return fmt.Errorf("cannot marshal the sync result: %w", err)
+		}
+
+		_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      &loc.bucket,
+			Key:         &loc.key,
+			Body:        bytes.NewReader(data),
+			ContentType: &contentType,
+		})
+		if err != nil {
+			return fmt.Errorf("cannot put the sync result in the s3 bucket, target: %s: %w", target.Target, err)
+		}
+
+		slog.Info("sync result written", "target", target.Target, "bucket", loc.bucket, "key", loc.key)
+	}
+
+	return nil
+}
+
+// s3Location is an AWS S3 object
+type s3Location struct {
+	bucket string
+	key    string
+}
+
+// syncResultS3Locations returns the AWS S3 object of the sync result of every target by name.
+// The sync result contains the changed users and groups, so it is only written next to
+// not encrypted states stored in AWS S3.
+func syncResultS3Locations() (map[string]s3Location, error) {
+	location := func(name string, c *config.Config) (s3Location, error) {
+		if c.StateBackend != config.StateBackendS3 {
+			return s3Location{}, fmt.Errorf("the s3 sync result output requires the s3 state backend, target: %s", name)
+		}
+		if c.StateEncryption != config.StateEncryptionNone {
+			return s3Location{}, fmt.Errorf("the s3 sync result output cannot be used with the state encryption, the result would not be encrypted, target: %s", name)
+		}
+
+		return s3Location{
+			bucket: c.AWSS3BucketName,
+			key:    path.Join(path.Dir(c.AWSS3BucketKey), path.Base(cfg.SyncResultFile)),
+		}, nil
+	}
+
+	if len(cfg.SCIMTargets) == 0 {
+		loc, err := location(core.DefaultSyncTargetName, &cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]s3Location{core.DefaultSyncTargetName: loc}, nil
+	}
+
+	locations := make(map[string]s3Location, len(cfg.SCIMTargets))
+	for idx := range cfg.SCIMTargets {
+		name, _, tgtCfg, err := cfg.SCIMTargetConfig(idx)
+		if err != nil {
+			return nil, err
+		}
+
+		loc, err := location(name, &tgtCfg)
+		if err != nil {
+			return nil, err
+		}
+		locations[name] = loc
+	}
+
+	return locations, nil
+}
@@ -72,6 +72,13 @@ func initConfig() {
 		"gws_users_filter",
 		"aws_scim_access_token",
 		"aws_scim_endpoint",
+		"aws_s3_bucket_name",
+		"aws_s3_bucket_key",
+		"state_encryption",
+		"aws_kms_key_id",
+		"state_encryption_key_file",
+		"state_backend",
+		"aws_dynamodb_table_name",
 	}
 	for _, e := range envVars {
 		if err := viper.BindEnv(e); err != nil {
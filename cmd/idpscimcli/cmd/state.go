@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/slashdevops/idp-scim-sync/internal/config"
+	"github.com/slashdevops/idp-scim-sync/internal/core"
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"github.com/slashdevops/idp-scim-sync/internal/repository"
+	"github.com/slashdevops/idp-scim-sync/pkg/aws"
+	"github.com/spf13/cobra"
+)
+
+// stateLockTTL is the time the lock of the state is held while the state is changed
+const stateLockTTL = time.Minute
+
+// commands state
+var (
+	// base state command
+	stateCmd = &cobra.Command{
+		Use:   "state",
+		Short: "State commands",
+		Long:  `Available commands for the state stored in the AWS S3 bucket or the AWS DynamoDB table, its history and its schema version.`,
+	}
+
+	// state history command
+	stateHistoryCmd = &cobra.Command{
+		Use:     "history",
+		Aliases: []string{"h"},
+		Short:   "return the versions of the state",
+		Long:    `list the versions of the state in the history, the newest first.`,
+		Args:    cobra.NoArgs,
+		RunE:    runStateHistory,
+	}
+
+	// state show command
+	stateShowCmd = &cobra.Command{
+		Use:     "show <version>",
+		Aliases: []string{"s"},
+		Short:   "return a version of the state",
+		Long:    `return the given version of the state from the history.`,
+		Args:    cobra.ExactArgs(1),
+		RunE:    runStateShow,
+	}
+
+	// state rollback command
+	stateRollbackCmd = &cobra.Command{
+		Use:   "rollback <version>",
+		Short: "replace the state with a version of the state",
+		Long: `replace the state with the given version of the state from the history, the next sync reconciles
+the SCIM side against it. The state is locked while it is replaced, so it fails when a sync is running.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runStateRollback,
+	}
+
+	// state migrate command
+	stateMigrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "upgrade the state to the current schema version",
+		Long: `upgrade the state stored by an older version to the current schema version of the state, the syncs
+upgrade it when they read it, so it is only needed to upgrade the state before a sync. The state is locked while it is upgraded.
+The state of the dynamodb state backend is upgraded with the --state-backend dynamodb flag.`,
+		Args: cobra.NoArgs,
+		RunE: runStateMigrate,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(stateHistoryCmd)
+	stateCmd.AddCommand(stateShowCmd)
+	stateCmd.AddCommand(stateRollbackCmd)
+	stateCmd.AddCommand(stateMigrateCmd)
+
+	stateCmd.PersistentFlags().StringVarP(&cfg.AWSS3BucketName, "aws-s3-bucket-name", "b", "", "AWS S3 Bucket name of the state")
+	stateCmd.PersistentFlags().StringVarP(&cfg.AWSS3BucketKey, "aws-s3-bucket-key", "k", config.DefaultAWSS3BucketKey, "AWS S3 Bucket key of the state")
+	stateCmd.PersistentFlags().StringVar(&cfg.StateEncryption, "state-encryption", config.DefaultStateEncryption, "how the state is encrypted [none|kms|file]")
+	stateCmd.PersistentFlags().StringVar(&cfg.AWSKMSKeyID, "aws-kms-key-id", "", "AWS KMS key id, arn or alias of the kms state encryption")
+	stateCmd.PersistentFlags().StringVar(&cfg.StateEncryptionKeyFile, "state-encryption-key-file", "", "key file of the file state encryption")
+
+	stateMigrateCmd.Flags().StringVar(&cfg.StateBackend, "state-backend", config.DefaultStateBackend, "where the state is stored [s3|dynamodb]")
+	stateMigrateCmd.Flags().StringVar(&cfg.AWSDynamoDBTableName, "aws-dynamodb-table-name", "", "AWS DynamoDB table name of the state with the dynamodb state backend, the AWS S3 Bucket key is the id of the state")
+}
+
+// lockableStateRepository is a state repository that can lock its state
+type lockableStateRepository interface {
+	core.StateRepository
+	core.StateLocker
+}
+
+func runStateHistory(_ *cobra.Command, _ []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), reqTimeout)
+	defer cancel()
+
+	repo, err := newStateS3Repository(ctx)
+	if err != nil {
+		return err
+	}
+
+	versions, err := repo.ListStateVersions(ctx)
+	if err != nil {
+		slog.Error("error listing the versions of the state", "error", err.Error())
+		return err
+	}
+	slog.Info("versions found", "versions", len(versions))
+
+	show(outFormat, versions)
+
+	return nil
+}
+
+func runStateShow(_ *cobra.Command, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), reqTimeout)
+	defer cancel()
+
+	repo, err := newStateS3Repository(ctx)
+	if err != nil {
+		return err
+	}
+
+	state, err := repo.GetStateVersion(ctx, args[0])
+	if err != nil {
+		slog.Error("error getting the version of the state", "version", args[0], "error", err.Error())
+		return err
+	}
+
+	show(outFormat, state)
+
+	return nil
+}
+
+func runStateRollback(_ *cobra.Command, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), reqTimeout)
+	defer cancel()
+
+	repo, err := newStateS3Repository(ctx)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockState(ctx, repo)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, err := repo.RollbackState(ctx, args[0])
+	if err != nil {
+		slog.Error("error rolling back the state", "version", args[0], "error", err.Error())
+		return err
+	}
+	slog.Info("state rolled back", "version", args[0], "lastSync", state.LastSync, "hashCode", state.HashCode)
+
+	return nil
+}
+
+func runStateMigrate(_ *cobra.Command, _ []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), reqTimeout)
+	defer cancel()
+
+	repo, err := newStateRepository(ctx)
+	if err != nil {
+		return err
+	}
+
+	migrator, ok := repo.(core.StateMigrator)
+	if !ok {
+		slog.Error("the state backend cannot migrate the state", "stateBackend", cfg.StateBackend)
+		return fmt.Errorf("state backend %s cannot migrate the state", cfg.StateBackend)
+	}
+
+	unlock, err := lockState(ctx, repo)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	from, err := migrator.MigrateState(ctx)
+	if err != nil {
+		slog.Error("error migrating the state", "schemaVersion", from, "error", err.Error())
+		return err
+	}
+
+	if from == model.StateSchemaVersion {
+		slog.Info("state already at the current schema version", "schemaVersion", from)
+		return nil
+	}
+	slog.Info("state migrated", "from", from, "to", model.StateSchemaVersion)
+
+	return nil
+}
+
+// lockState locks the state so the syncs don't change it at the same time, it fails when a sync is running.
+// The returned function releases the lock.
+func lockState(ctx context.Context, repo core.StateLocker) (func(), error) {
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("idpscimcli-%s-%d", host, os.Getpid())
+
+	if err := repo.Lock(ctx, owner, stateLockTTL); err != nil {
+		slog.Error("cannot lock the state, a sync could be running", "error", err.Error())
+		return nil, err
+	}
+
+	return func() {
+		if err := repo.Unlock(context.WithoutCancel(ctx), owner); err != nil {
+			slog.Warn("cannot release the lock of the state", "error", err.Error())
+		}
+	}, nil
+}
+
+// newStateS3Repository returns the repository of the state in the AWS S3 bucket
+func newStateS3Repository(ctx context.Context) (*repository.S3Repository, error) {
+	awsConf, err := aws.NewDefaultConf(ctx)
+	if err != nil {
+		slog.Error("cannot load aws config", "error", err.Error())
+		return nil, err
+	}
+
+	envelope, err := repository.NewStateEnvelope(kms.NewFromConfig(awsConf), &cfg)
+	if err != nil {
+		slog.Error("cannot create the state encryption", "error", err.Error())
+		return nil, err
+	}
+
+	repo, err := repository.NewS3Repository(s3.NewFromConfig(awsConf),
+		repository.WithBucket(cfg.AWSS3BucketName),
+		repository.WithKey(cfg.AWSS3BucketKey),
+		repository.WithEncryption(envelope),
+	)
+	if err != nil {
+		slog.Error("cannot create s3 repository", "error", err.Error())
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// newStateRepository returns the repository of the state in the state backend
+func newStateRepository(ctx context.Context) (lockableStateRepository, error) {
+	switch cfg.StateBackend {
+	case config.StateBackendS3:
+		return newStateS3Repository(ctx)
+	case config.StateBackendDynamoDB:
+		return newStateDynamoDBRepository(ctx)
+	default:
+		slog.Error("only 'state-backend=s3' and 'state-backend=dynamodb' are implemented")
+		return nil, fmt.Errorf("unknown state backend: %s", cfg.StateBackend)
+	}
+}
+
+// newStateDynamoDBRepository returns the repository of the state in the AWS DynamoDB table, the
+// AWS S3 bucket key is the id of the state in the table like in idpscim
+func newStateDynamoDBRepository(ctx context.Context) (*repository.DynamoDBRepository, error) {
+	awsConf, err := aws.NewDefaultConf(ctx)
+	if err != nil {
+		slog.Error("cannot load aws config", "error", err.Error())
+		return nil, err
+	}
+
+	envelope, err := repository.NewStateEnvelope(kms.NewFromConfig(awsConf), &cfg)
+	if err != nil {
+		slog.Error("cannot create the state encryption", "error", err.Error())
+		return nil, err
+	}
+
+	repo, err := repository.NewDynamoDBRepository(dynamodb.NewFromConfig(awsConf),
+		repository.WithTable(cfg.AWSDynamoDBTableName),
+		repository.WithStateID(cfg.AWSS3BucketKey),
+		repository.WithDynamoDBEncryption(envelope),
+	)
+	if err != nil {
+		slog.Error("cannot create dynamodb repository", "error", err.Error())
+		return nil, err
+	}
+
+	return repo, nil
+}
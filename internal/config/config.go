@@ -1,5 +1,13 @@
 package config
 
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+)
+
 const (
 	// DefaultIsLambda is the program execute as a lambda function?
 	DefaultIsLambda = false
@@ -15,11 +23,61 @@ const (
 	// DefaultDebug is the default debug status.
 	DefaultDebug = false
 
+	// IDPTypeGoogle uses Google Workspace as identity provider.
+	IDPTypeGoogle = "google"
+
+	// IDPTypeEntra uses Microsoft Entra ID (Azure AD) as identity provider.
+	IDPTypeEntra = "entra"
+
+	// IDPTypeOkta uses Okta as identity provider.
+	IDPTypeOkta = "okta"
+
+	// IDPTypeLDAP uses an LDAP directory, like Active Directory or OpenLDAP, as identity provider.
+	IDPTypeLDAP = "ldap"
+
+	// IDPTypeFile uses YAML, JSON or CSV files as identity provider.
+	IDPTypeFile = "file"
+
+	// DefaultIDPType is the default identity provider type.
+	DefaultIDPType = IDPTypeGoogle
+
+	// IDPConflictPolicyPrecedence keeps the group or user of the identity provider source with the highest precedence.
+	IDPConflictPolicyPrecedence = "precedence"
+
+	// IDPConflictPolicyMerge keeps the group of the identity provider source with the highest precedence
+	// with the members of the group in all the sources, only valid for groups.
+	IDPConflictPolicyMerge = "merge"
+
+	// IDPConflictPolicyError stops the sync when the same group or user is in more than one identity provider source.
+	IDPConflictPolicyError = "error"
+
+	// DefaultIDPConflictPolicy is the default policy applied to the groups and users in more than one identity provider source.
+	DefaultIDPConflictPolicy = IDPConflictPolicyPrecedence
+
+	// SCIMTargetAWS provisions the AWS IAM Identity Center (AWS SSO) SCIM API.
+	SCIMTargetAWS = "aws"
+
+	// SCIMTargetGeneric provisions any SCIM 2.0 service provider, like Slack, GitHub Enterprise or Atlassian.
+	SCIMTargetGeneric = "generic"
+
+	// DefaultSCIMTarget is the default SCIM target.
+	DefaultSCIMTarget = SCIMTargetAWS
+
+	// DefaultSCIMProfile is the default profile of the generic SCIM target.
+	DefaultSCIMProfile = "generic"
+
 	// DefaultGWSServiceAccountFile is the name of the file containing the service account credentials.
 	DefaultGWSServiceAccountFile = "credentials.json"
 
+	// SyncMethodGroups syncs the groups that match the groups filter and their members.
+	SyncMethodGroups = "groups"
+
+	// SyncMethodUsers syncs the users that match the users filter, even if they are not members of any group,
+	// plus the groups that match the groups filter and their members.
+	SyncMethodUsers = "users"
+
 	// DefaultSyncMethod is the default sync method to use.
-	DefaultSyncMethod = "groups"
+	DefaultSyncMethod = SyncMethodGroups
 
 	// DefaultAWSS3BucketKey is the key of the AWS S3 bucket.
 	DefaultAWSS3BucketKey = "state.json"
@@ -33,14 +91,133 @@ const (
 	// DefaultGWSUserEmailSecretName is the name of the secret containing the user email.
 	DefaultGWSUserEmailSecretName = "IDPSCIM_GWSUserEmail"
 
+	// DefaultGWSConcurrency is the default number of groups members or users fetched at the same time from Google Workspace.
+	DefaultGWSConcurrency = 1
+
+	// DefaultGWSMaxRetries is the default number of retries of a request throttled by the Google Admin SDK quotas.
+	DefaultGWSMaxRetries = 5
+
+	// GWSUsersLookupAuto lists the Google Workspace users while it needs fewer requests than getting the members one by one.
+	GWSUsersLookupAuto = "auto"
+
+	// GWSUsersLookupGet gets the Google Workspace users of the groups members one by one.
+	GWSUsersLookupGet = "get"
+
+	// GWSUsersLookupList lists the Google Workspace users until all the groups members are found.
+	GWSUsersLookupList = "list"
+
+	// DefaultGWSUsersLookup is the default strategy used to get the Google Workspace users of the groups members.
+	DefaultGWSUsersLookup = GWSUsersLookupAuto
+
+	// DefaultEntraClientSecretSecretName is the name of the secret containing the Entra ID application client secret.
+	DefaultEntraClientSecretSecretName = "IDPSCIM_EntraClientSecret"
+
+	// DefaultOktaAPITokenSecretName is the name of the secret containing the Okta API token.
+	DefaultOktaAPITokenSecretName = "IDPSCIM_OktaAPIToken"
+
+	// DefaultLDAPBindPasswordSecretName is the name of the secret containing the LDAP bind password.
+	DefaultLDAPBindPasswordSecretName = "IDPSCIM_LDAPBindPassword"
+
+	// DefaultSCIMAccessTokenSecretName is the name of the secret containing the access token of the generic SCIM target.
+	DefaultSCIMAccessTokenSecretName = "IDPSCIM_GenericSCIMAccessToken"
+
 	// DefaultAWSSCIMEndpointSecretName is the name of the secret containing the SCIM endpoint.
 	DefaultAWSSCIMEndpointSecretName = "IDPSCIM_SCIMEndpoint"
 
 	// DefaultAWSSCIMAccessTokenSecretName is the name of the secret containing the SCIM access token.
 	DefaultAWSSCIMAccessTokenSecretName = "IDPSCIM_SCIMAccessToken"
 
+	// DefaultAWSSCIMConcurrency is the default number of users or groups members written at the same time in the AWS SSO SCIM API.
+	DefaultAWSSCIMConcurrency = 1
+
+	// DefaultAWSSCIMRateLimit is the default maximum number of write requests per second sent to the AWS SSO SCIM API.
+	// 0 means no limit.
+	DefaultAWSSCIMRateLimit = 20.0
+
 	// DefaultUseSecretsManager determines if we will use the AWS Secrets Manager secrets or program parameter values
 	DefaultUseSecretsManager = false
+
+	// DefaultDryRun determines if the sync only computes the changes without applying them.
+	DefaultDryRun = false
+
+	// DefaultDryRunOutputFormat is the default format of the dry run plan.
+	// possible values: "json", "yaml"
+	DefaultDryRunOutputFormat = "json"
+
+	// DefaultForce determines if the sync is applied even when the deletion thresholds are exceeded.
+	DefaultForce = false
+
+	// DefaultUsersSoftDelete determines if the users removed from the identity provider are deactivated instead of deleted.
+	DefaultUsersSoftDelete = false
+
+	// DefaultUsersSoftDeleteGracePeriodDays is the default number of days a deactivated user is kept before being deleted.
+	// 0 means the deactivated users are never deleted.
+	DefaultUsersSoftDeleteGracePeriodDays = 0
+
+	// DefaultPartialFailures determines if the sync continues when some resources fail in the SCIM side.
+	DefaultPartialFailures = false
+
+	// DefaultCheckpoints determines if the first sync stores checkpoints in the state to resume from them.
+	DefaultCheckpoints = false
+
+	// DefaultCheckpointEvery is the default number of users or groups memberships written between two checkpoints.
+	// 0 means the checkpoints are only stored at the end of the groups and the users phases.
+	DefaultCheckpointEvery = 0
+
+	// DefaultRunLock determines if the sync locks the state so two syncs cannot run at the same time.
+	DefaultRunLock = false
+
+	// DefaultRunLockTTLSeconds is the default number of seconds the lock of the state is held without renewing it.
+	DefaultRunLockTTLSeconds = 300
+
+	// SyncResultOutputNone doesn't write the sync result.
+	SyncResultOutputNone = "none"
+
+	// SyncResultOutputStdout writes the sync result into the standard output.
+	SyncResultOutputStdout = "stdout"
+
+	// SyncResultOutputFile writes the sync result into the SyncResultFile file.
+	SyncResultOutputFile = "file"
+
+	// SyncResultOutputS3 writes the sync result into the AWS S3 bucket of the state, next to the state file.
+	SyncResultOutputS3 = "s3"
+
+	// DefaultSyncResultOutput is the default output of the sync result.
+	DefaultSyncResultOutput = SyncResultOutputNone
+
+	// DefaultSyncResultFile is the default name of the sync result file.
+	DefaultSyncResultFile = "sync-result.json"
+
+	// DefaultMetricsPushGatewayJob is the default job of the metrics pushed to the Prometheus push gateway.
+	DefaultMetricsPushGatewayJob = "idpscim"
+
+	// DefaultTracingExporter is the default exporter of the OpenTelemetry spans, none disables the tracing.
+	DefaultTracingExporter = "none"
+
+	// StateBackendS3 stores the state in the AWS S3 bucket.
+	StateBackendS3 = "s3"
+
+	// StateBackendDynamoDB stores the state in the AWS DynamoDB table, the writes of the state
+	// fail when the state was replaced since it was read, so concurrent syncs cannot overwrite it.
+	StateBackendDynamoDB = "dynamodb"
+
+	// DefaultStateBackend is the default backend of the state.
+	DefaultStateBackend = StateBackendS3
+
+	// DefaultStateHistory is the default number of snapshots of the state kept in the history, 0 disables the history.
+	DefaultStateHistory = 0
+
+	// StateEncryptionNone stores the state in plaintext.
+	StateEncryptionNone = "none"
+
+	// StateEncryptionKMS encrypts the state with data keys of the AWSKMSKeyID AWS KMS key.
+	StateEncryptionKMS = "kms"
+
+	// StateEncryptionFile encrypts the state with data keys encrypted by the key of the StateEncryptionKeyFile file.
+	StateEncryptionFile = "file"
+
+	// DefaultStateEncryption is the default encryption of the state.
+	DefaultStateEncryption = StateEncryptionNone
 )
 
 // Config represents the configuration of the application.
@@ -52,6 +229,9 @@ type Config struct {
 	LogLevel  string `mapstructure:"log_level" json:"log_level" yaml:"log_level"`
 	LogFormat string `mapstructure:"log_format" json:"log_format" yaml:"log_format"`
 
+	// IDPType is the identity provider used to get the users and groups
+	IDPType string `mapstructure:"idp_type" json:"idp_type" yaml:"idp_type"`
+
 	GWSServiceAccountFile           string   `mapstructure:"gws_service_account_file" json:"gws_service_account_file" yaml:"gws_service_account_file"`
 	GWSUserEmail                    string   `mapstructure:"gws_user_email" json:"gws_user_email" yaml:"gws_user_email"`
 	GWSServiceAccountFileSecretName string   `mapstructure:"gws_service_account_file_secret_name" json:"gws_service_account_file_secret_name" yaml:"gws_service_account_file_secret_name"`
@@ -59,19 +239,161 @@ type Config struct {
 	GWSGroupsFilter                 []string `mapstructure:"gws_groups_filter" json:"gws_groups_filter" yaml:"gws_groups_filter"`
 	GWSUsersFilter                  []string `mapstructure:"gws_users_filter" json:"gws_users_filter" yaml:"gws_users_filter"`
 
+	// GWSConcurrency is the number of groups members or users fetched at the same time and GWSMaxRetries
+	// the number of retries of a request throttled by the Google Admin SDK quotas
+	GWSConcurrency int `mapstructure:"gws_concurrency" json:"gws_concurrency" yaml:"gws_concurrency"`
+	GWSMaxRetries  int `mapstructure:"gws_max_retries" json:"gws_max_retries" yaml:"gws_max_retries"`
+
+	// GWSUsersLookup is the strategy used to get the users of the groups members, listing the users of the directory or getting them one by one
+	GWSUsersLookup string `mapstructure:"gws_users_lookup" json:"gws_users_lookup" yaml:"gws_users_lookup"`
+
+	EntraTenantID               string   `mapstructure:"entra_tenant_id" json:"entra_tenant_id" yaml:"entra_tenant_id"`
+	EntraClientID               string   `mapstructure:"entra_client_id" json:"entra_client_id" yaml:"entra_client_id"`
+	EntraClientSecret           string   `mapstructure:"entra_client_secret" json:"entra_client_secret" yaml:"entra_client_secret"`
+	EntraClientSecretSecretName string   `mapstructure:"entra_client_secret_secret_name" json:"entra_client_secret_secret_name" yaml:"entra_client_secret_secret_name"`
+	EntraGroupsFilter           []string `mapstructure:"entra_groups_filter" json:"entra_groups_filter" yaml:"entra_groups_filter"`
+	EntraUsersFilter            []string `mapstructure:"entra_users_filter" json:"entra_users_filter" yaml:"entra_users_filter"`
+
+	OktaOrgURL             string   `mapstructure:"okta_org_url" json:"okta_org_url" yaml:"okta_org_url"`
+	OktaAPIToken           string   `mapstructure:"okta_api_token" json:"okta_api_token" yaml:"okta_api_token"`
+	OktaAPITokenSecretName string   `mapstructure:"okta_api_token_secret_name" json:"okta_api_token_secret_name" yaml:"okta_api_token_secret_name"`
+	OktaGroupsFilter       []string `mapstructure:"okta_groups_filter" json:"okta_groups_filter" yaml:"okta_groups_filter"`
+	OktaUsersFilter        []string `mapstructure:"okta_users_filter" json:"okta_users_filter" yaml:"okta_users_filter"`
+
+	LDAPURL                    string   `mapstructure:"ldap_url" json:"ldap_url" yaml:"ldap_url"`
+	LDAPBindDN                 string   `mapstructure:"ldap_bind_dn" json:"ldap_bind_dn" yaml:"ldap_bind_dn"`
+	LDAPBindPassword           string   `mapstructure:"ldap_bind_password" json:"ldap_bind_password" yaml:"ldap_bind_password"`
+	LDAPBindPasswordSecretName string   `mapstructure:"ldap_bind_password_secret_name" json:"ldap_bind_password_secret_name" yaml:"ldap_bind_password_secret_name"`
+	LDAPUsersBaseDN            string   `mapstructure:"ldap_users_base_dn" json:"ldap_users_base_dn" yaml:"ldap_users_base_dn"`
+	LDAPGroupsBaseDN           string   `mapstructure:"ldap_groups_base_dn" json:"ldap_groups_base_dn" yaml:"ldap_groups_base_dn"`
+	LDAPUserObjectFilter       string   `mapstructure:"ldap_user_object_filter" json:"ldap_user_object_filter" yaml:"ldap_user_object_filter"`
+	LDAPGroupObjectFilter      string   `mapstructure:"ldap_group_object_filter" json:"ldap_group_object_filter" yaml:"ldap_group_object_filter"`
+	LDAPGroupMemberAttribute   string   `mapstructure:"ldap_group_member_attribute" json:"ldap_group_member_attribute" yaml:"ldap_group_member_attribute"`
+	LDAPUserMemberOfAttribute  string   `mapstructure:"ldap_user_member_of_attribute" json:"ldap_user_member_of_attribute" yaml:"ldap_user_member_of_attribute"`
+	LDAPNestedGroups           bool     `mapstructure:"ldap_nested_groups" json:"ldap_nested_groups" yaml:"ldap_nested_groups"`
+	LDAPGroupsFilter           []string `mapstructure:"ldap_groups_filter" json:"ldap_groups_filter" yaml:"ldap_groups_filter"`
+	LDAPUsersFilter            []string `mapstructure:"ldap_users_filter" json:"ldap_users_filter" yaml:"ldap_users_filter"`
+
+	// LDAPAttributeMapping overrides the LDAP attributes used for the users and groups fields, example: {"email": "userPrincipalName"}
+	LDAPAttributeMapping map[string]string `mapstructure:"ldap_attribute_mapping" json:"ldap_attribute_mapping" yaml:"ldap_attribute_mapping"`
+
+	// FilePath is a file or directory with users and groups, used alone with idp_type file
+	// or merged with the users and groups of the other identity providers
+	FilePath         string   `mapstructure:"file_path" json:"file_path" yaml:"file_path"`
+	FileGroupsFilter []string `mapstructure:"file_groups_filter" json:"file_groups_filter" yaml:"file_groups_filter"`
+	FileUsersFilter  []string `mapstructure:"file_users_filter" json:"file_users_filter" yaml:"file_users_filter"`
+
+	// IDPSources are the identity providers merged in the sync, every source is a map with a name,
+	// an idp_type and the configuration keys of the identity provider type, example:
+	// {"name": "tenant-a", "idp_type": "google", "gws_user_email": "admin@a.example.com"}
+	IDPSources []map[string]any `mapstructure:"idp_sources" json:"idp_sources,omitempty" yaml:"idp_sources,omitempty"`
+
+	// IDPSourcesPrecedence are the names of the identity provider sources from the highest to the lowest precedence
+	IDPSourcesPrecedence []string `mapstructure:"idp_sources_precedence" json:"idp_sources_precedence" yaml:"idp_sources_precedence"`
+
+	// IDPGroupsConflictPolicy and IDPUsersConflictPolicy are applied when the same group name or userName is in more than one source
+	IDPGroupsConflictPolicy string `mapstructure:"idp_groups_conflict_policy" json:"idp_groups_conflict_policy" yaml:"idp_groups_conflict_policy"`
+	IDPUsersConflictPolicy  string `mapstructure:"idp_users_conflict_policy" json:"idp_users_conflict_policy" yaml:"idp_users_conflict_policy"`
+
 	AWSSCIMEndpoint              string `mapstructure:"aws_scim_endpoint" json:"aws_scim_endpoint" yaml:"aws_scim_endpoint"`
 	AWSSCIMAccessToken           string `mapstructure:"aws_scim_access_token" json:"aws_scim_access_token" yaml:"aws_scim_access_token"`
 	AWSSCIMEndpointSecretName    string `mapstructure:"aws_scim_endpoint_secret_name" json:"aws_scim_endpoint_secret_name" yaml:"aws_scim_endpoint_secret_name"`
 	AWSSCIMAccessTokenSecretName string `mapstructure:"aws_scim_access_token_secret_name" json:"aws_scim_access_token_secret_name" yaml:"aws_scim_access_token_secret_name"`
 
+	// AWSSCIMConcurrency is the number of users or groups members written at the same time and AWSSCIMRateLimit
+	// the maximum number of write requests per second, 0 means no limit
+	AWSSCIMConcurrency int     `mapstructure:"aws_scim_concurrency" json:"aws_scim_concurrency" yaml:"aws_scim_concurrency"`
+	AWSSCIMRateLimit   float64 `mapstructure:"aws_scim_rate_limit" json:"aws_scim_rate_limit" yaml:"aws_scim_rate_limit"`
+
+	// SCIMTarget is the SCIM service provider where the users and groups are provisioned,
+	// the SCIM* fields are used by the generic target and the AWSSCIM* fields by the aws target
+	SCIMTarget                string `mapstructure:"scim_target" json:"scim_target" yaml:"scim_target"`
+	SCIMProfile               string `mapstructure:"scim_profile" json:"scim_profile" yaml:"scim_profile"`
+	SCIMEndpoint              string `mapstructure:"scim_endpoint" json:"scim_endpoint" yaml:"scim_endpoint"`
+	SCIMAccessToken           string `mapstructure:"scim_access_token" json:"scim_access_token" yaml:"scim_access_token"`
+	SCIMAccessTokenSecretName string `mapstructure:"scim_access_token_secret_name" json:"scim_access_token_secret_name" yaml:"scim_access_token_secret_name"`
+
+	// SCIMTargets are the SCIM service providers where the users and groups are provisioned in the same sync,
+	// every target is a map with a name, an optional groups_filter and the configuration keys of the target, example:
+	// {"name": "org-a", "aws_scim_endpoint": "https://scim.us-east-1.amazonaws.com/xxx/scim/v2/", "groups_filter": ["AWS-OrgA-*"]}
+	SCIMTargets []map[string]any `mapstructure:"scim_targets" json:"scim_targets,omitempty" yaml:"scim_targets,omitempty"`
+
 	AWSS3BucketName string `mapstructure:"aws_s3_bucket_name" json:"aws_s3_bucket_name" yaml:"aws_s3_bucket_name"`
 	AWSS3BucketKey  string `mapstructure:"aws_s3_bucket_key" json:"aws_s3_bucket_key" yaml:"aws_s3_bucket_key"`
 
+	// StateBackend is where the state is stored [s3|dynamodb], the dynamodb backend stores the state in the
+	// AWSDynamoDBTableName table using the AWSS3BucketKey as the id of the state.
+	StateBackend         string `mapstructure:"state_backend" json:"state_backend" yaml:"state_backend"`
+	AWSDynamoDBTableName string `mapstructure:"aws_dynamodb_table_name" json:"aws_dynamodb_table_name" yaml:"aws_dynamodb_table_name"`
+
+	// StateHistory is the number of snapshots of the state kept in the history of the state in the
+	// AWS S3 bucket, a snapshot is stored by every sync that stores the state, 0 disables the history
+	StateHistory int `mapstructure:"state_history" json:"state_history" yaml:"state_history"`
+
+	// StateEncryption is how the state is encrypted before it is stored [none|kms|file], the states
+	// stored in plaintext before the encryption was enabled are still read.
+	StateEncryption        string `mapstructure:"state_encryption" json:"state_encryption" yaml:"state_encryption"`
+	AWSKMSKeyID            string `mapstructure:"aws_kms_key_id" json:"aws_kms_key_id" yaml:"aws_kms_key_id"`
+	StateEncryptionKeyFile string `mapstructure:"state_encryption_key_file" json:"state_encryption_key_file" yaml:"state_encryption_key_file"`
+
 	// SyncMethod allow to defined the sync method used to get the user and groups from Google Workspace
 	SyncMethod string `mapstructure:"sync_method" json:"sync_method" yaml:"sync_method"`
 
 	// UseSecretsManager determines if we will use the AWS Secrets Manager secrets or program parameter values
 	UseSecretsManager bool `mapstructure:"use_secrets_manager" json:"use_secrets_manager" yaml:"use_secrets_manager"`
+
+	// DryRun determines if the sync only computes the changes (plan) without applying them
+	DryRun             bool   `mapstructure:"dry_run" json:"dry_run" yaml:"dry_run"`
+	DryRunOutputFile   string `mapstructure:"dry_run_output_file" json:"dry_run_output_file" yaml:"dry_run_output_file"`
+	DryRunOutputFormat string `mapstructure:"dry_run_output_format" json:"dry_run_output_format" yaml:"dry_run_output_format"`
+
+	// Max*Deletion and Max*DeletionPercent limit the number of deletions in a single sync, 0 means no limit
+	MaxGroupsDeletion               int     `mapstructure:"max_groups_deletion" json:"max_groups_deletion" yaml:"max_groups_deletion"`
+	MaxGroupsDeletionPercent        float64 `mapstructure:"max_groups_deletion_percent" json:"max_groups_deletion_percent" yaml:"max_groups_deletion_percent"`
+	MaxUsersDeletion                int     `mapstructure:"max_users_deletion" json:"max_users_deletion" yaml:"max_users_deletion"`
+	MaxUsersDeletionPercent         float64 `mapstructure:"max_users_deletion_percent" json:"max_users_deletion_percent" yaml:"max_users_deletion_percent"`
+	MaxGroupsMembersDeletion        int     `mapstructure:"max_groups_members_deletion" json:"max_groups_members_deletion" yaml:"max_groups_members_deletion"`
+	MaxGroupsMembersDeletionPercent float64 `mapstructure:"max_groups_members_deletion_percent" json:"max_groups_members_deletion_percent" yaml:"max_groups_members_deletion_percent"`
+
+	// Force applies the sync even when the deletion thresholds are exceeded
+	Force bool `mapstructure:"force" json:"force" yaml:"force"`
+
+	// UsersSoftDelete deactivates (active=false) the users removed from the identity provider instead of deleting them,
+	// they are deleted after UsersSoftDeleteGracePeriodDays days
+	UsersSoftDelete                bool `mapstructure:"users_soft_delete" json:"users_soft_delete" yaml:"users_soft_delete"`
+	UsersSoftDeleteGracePeriodDays int  `mapstructure:"users_soft_delete_grace_period_days" json:"users_soft_delete_grace_period_days" yaml:"users_soft_delete_grace_period_days"`
+
+	// PartialFailures continues the sync when some resources fail in the SCIM side, the state is stored
+	// without them so the next sync retries them and the sync ends with an error
+	PartialFailures bool `mapstructure:"partial_failures" json:"partial_failures" yaml:"partial_failures"`
+
+	// Checkpoints stores checkpoints in the state during the first sync so a failed first sync
+	// resumes from the last one, CheckpointEvery also stores one every number of users or groups memberships written
+	Checkpoints     bool `mapstructure:"checkpoints" json:"checkpoints" yaml:"checkpoints"`
+	CheckpointEvery int  `mapstructure:"checkpoint_every" json:"checkpoint_every" yaml:"checkpoint_every"`
+
+	// RunLock locks the state during the sync, so a sync that starts while another one is running ends
+	// without syncing, the lock expires after RunLockTTLSeconds when the sync doesn't renew it
+	RunLock           bool `mapstructure:"run_lock" json:"run_lock" yaml:"run_lock"`
+	RunLockTTLSeconds int  `mapstructure:"run_lock_ttl_seconds" json:"run_lock_ttl_seconds" yaml:"run_lock_ttl_seconds"`
+
+	// SyncResultOutput is where the json sync result is written [none|stdout|file|s3], SyncResultFile is the
+	// file used by the file output and its name is the key, next to the state file, used by the s3 output
+	SyncResultOutput string `mapstructure:"sync_result_output" json:"sync_result_output" yaml:"sync_result_output"`
+	SyncResultFile   string `mapstructure:"sync_result_file" json:"sync_result_file" yaml:"sync_result_file"`
+
+	// MetricsListenAddress is the address of the /metrics endpoint served while the program runs, MetricsPushGatewayURL
+	// is the Prometheus push gateway where the metrics are pushed after the sync, and MetricsTextFile is the file
+	// where the metrics are written after the sync for the node exporter textfile collector, empty disables them
+	MetricsListenAddress  string `mapstructure:"metrics_listen_address" json:"metrics_listen_address" yaml:"metrics_listen_address"`
+	MetricsPushGatewayURL string `mapstructure:"metrics_push_gateway_url" json:"metrics_push_gateway_url" yaml:"metrics_push_gateway_url"`
+	MetricsPushGatewayJob string `mapstructure:"metrics_push_gateway_job" json:"metrics_push_gateway_job" yaml:"metrics_push_gateway_job"`
+	MetricsTextFile       string `mapstructure:"metrics_text_file" json:"metrics_text_file" yaml:"metrics_text_file"`
+
+	// TracingExporter is the exporter of the OpenTelemetry spans of the sync [none|stdout|otlp] and TracingOTLPEndpoint
+	// the url of the OTLP/HTTP collector, when it is empty the OTEL_EXPORTER_OTLP_* environment variables are used
+	TracingExporter     string `mapstructure:"tracing_exporter" json:"tracing_exporter" yaml:"tracing_exporter"`
+	TracingOTLPEndpoint string `mapstructure:"tracing_otlp_endpoint" json:"tracing_otlp_endpoint" yaml:"tracing_otlp_endpoint"`
 }
 
 // New returns a new Config
@@ -82,13 +404,157 @@ func New() Config {
 		Debug:                           DefaultDebug,
 		LogLevel:                        DefaultLogLevel,
 		LogFormat:                       DefaultLogFormat,
+		IDPType:                         DefaultIDPType,
+		IDPGroupsConflictPolicy:         DefaultIDPConflictPolicy,
+		IDPUsersConflictPolicy:          DefaultIDPConflictPolicy,
 		GWSServiceAccountFile:           DefaultGWSServiceAccountFile,
 		SyncMethod:                      DefaultSyncMethod,
 		AWSS3BucketKey:                  DefaultAWSS3BucketKey,
+		StateBackend:                    DefaultStateBackend,
+		StateHistory:                    DefaultStateHistory,
+		StateEncryption:                 DefaultStateEncryption,
 		GWSServiceAccountFileSecretName: DefaultGWSServiceAccountFileSecretName,
 		GWSUserEmailSecretName:          DefaultGWSUserEmailSecretName,
+		GWSConcurrency:                  DefaultGWSConcurrency,
+		GWSMaxRetries:                   DefaultGWSMaxRetries,
+		GWSUsersLookup:                  DefaultGWSUsersLookup,
+		EntraClientSecretSecretName:     DefaultEntraClientSecretSecretName,
+		OktaAPITokenSecretName:          DefaultOktaAPITokenSecretName,
+		LDAPBindPasswordSecretName:      DefaultLDAPBindPasswordSecretName,
+		SCIMTarget:                      DefaultSCIMTarget,
+		SCIMProfile:                     DefaultSCIMProfile,
+		SCIMAccessTokenSecretName:       DefaultSCIMAccessTokenSecretName,
 		AWSSCIMEndpointSecretName:       DefaultAWSSCIMEndpointSecretName,
 		AWSSCIMAccessTokenSecretName:    DefaultAWSSCIMAccessTokenSecretName,
+		AWSSCIMConcurrency:              DefaultAWSSCIMConcurrency,
+		AWSSCIMRateLimit:                DefaultAWSSCIMRateLimit,
 		UseSecretsManager:               DefaultUseSecretsManager,
+		DryRun:                          DefaultDryRun,
+		DryRunOutputFormat:              DefaultDryRunOutputFormat,
+		Force:                           DefaultForce,
+		UsersSoftDelete:                 DefaultUsersSoftDelete,
+		UsersSoftDeleteGracePeriodDays:  DefaultUsersSoftDeleteGracePeriodDays,
+		PartialFailures:                 DefaultPartialFailures,
+		Checkpoints:                     DefaultCheckpoints,
+		CheckpointEvery:                 DefaultCheckpointEvery,
+		RunLock:                         DefaultRunLock,
+		RunLockTTLSeconds:               DefaultRunLockTTLSeconds,
+		SyncResultOutput:                DefaultSyncResultOutput,
+		SyncResultFile:                  DefaultSyncResultFile,
+		MetricsPushGatewayJob:           DefaultMetricsPushGatewayJob,
+		TracingExporter:                 DefaultTracingExporter,
 	}
 }
+
+// ErrIDPSourceInvalid is returned when an identity provider source contains unknown configuration keys.
+var ErrIDPSourceInvalid = errors.New("config: identity provider source is invalid")
+
+// ErrSCIMTargetInvalid is returned when a SCIM target contains unknown configuration keys.
+var ErrSCIMTargetInvalid = errors.New("config: scim target is invalid")
+
+// IDPSource returns the name and the configuration of the identity provider source at the index idx of IDPSources,
+// the configuration is a copy of this one with the keys of the source applied on top of it.
+// When the source doesn't have a name, the name is the idp_type followed by the index, example: google-0
+func (c Config) IDPSource(idx int) (string, Config, error) {
+	if idx < 0 || idx >= len(c.IDPSources) {
+		return "", Config{}, fmt.Errorf("%w: index %d out of range", ErrIDPSourceInvalid, idx)
+	}
+
+	source := make(map[string]any, len(c.IDPSources[idx]))
+	for k, v := range c.IDPSources[idx] {
+		source[k] = v
+	}
+
+	name, _ := source["name"].(string)
+	delete(source, "name")
+
+	srcCfg, err := c.apply(source)
+	if err != nil {
+		return "", Config{}, fmt.Errorf("%w: %s", ErrIDPSourceInvalid, err)
+	}
+
+	if name == "" {
+		name = fmt.Sprintf("%s-%d", srcCfg.IDPType, idx)
+	}
+
+	return name, srcCfg, nil
+}
+
+// SCIMTargetConfig returns the name, the groups filter and the configuration of the SCIM target at the index idx
+// of SCIMTargets, the configuration is a copy of this one with the keys of the target applied on top of it.
+// When the target doesn't have a name, the name is the scim_target followed by the index, example: aws-0.
+// When the target doesn't have an aws_s3_bucket_key, the state is stored in a directory with the name of the target,
+// example: data/aws-0/state.json for the aws_s3_bucket_key data/state.json
+func (c Config) SCIMTargetConfig(idx int) (string, []string, Config, error) {
+	if idx < 0 || idx >= len(c.SCIMTargets) {
+		return "", nil, Config{}, fmt.Errorf("%w: index %d out of range", ErrSCIMTargetInvalid, idx)
+	}
+
+	target := make(map[string]any, len(c.SCIMTargets[idx]))
+	for k, v := range c.SCIMTargets[idx] {
+		target[k] = v
+	}
+
+	name, _ := target["name"].(string)
+	delete(target, "name")
+
+	var groupsFilter []string
+	if filter, ok := target["groups_filter"]; ok {
+		filterJSON, err := json.Marshal(filter)
+		if err != nil {
+			return "", nil, Config{}, fmt.Errorf("%w: %s", ErrSCIMTargetInvalid, err)
+		}
+		if err := json.Unmarshal(filterJSON, &groupsFilter); err != nil {
+			return "", nil, Config{}, fmt.Errorf("%w: groups_filter must be a list of strings", ErrSCIMTargetInvalid)
+		}
+		delete(target, "groups_filter")
+	}
+
+	tgtCfg, err := c.apply(target)
+	if err != nil {
+		return "", nil, Config{}, fmt.Errorf("%w: %s", ErrSCIMTargetInvalid, err)
+	}
+
+	if name == "" {
+		name = fmt.Sprintf("%s-%d", tgtCfg.SCIMTarget, idx)
+	}
+
+	if _, ok := target["aws_s3_bucket_key"]; !ok {
+		tgtCfg.AWSS3BucketKey = path.Join(path.Dir(c.AWSS3BucketKey), name, path.Base(c.AWSS3BucketKey))
+	}
+
+	return name, groupsFilter, tgtCfg, nil
+}
+
+// apply returns a copy of this configuration, without identity provider sources and SCIM targets,
+// with the given configuration keys applied on top of it, unknown keys return an error.
+func (c Config) apply(keys map[string]any) (Config, error) {
+	base := c
+	base.IDPSources = nil
+	base.SCIMTargets = nil
+
+	baseJSON, err := json.Marshal(base)
+	if err != nil {
+		return Config{}, fmt.Errorf("config: error marshalling the configuration: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(baseJSON, &cfg); err != nil {
+		return Config{}, fmt.Errorf("config: error unmarshalling the configuration: %w", err)
+	}
+
+	keysJSON, err := json.Marshal(keys)
+	if err != nil {
+		return Config{}, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(keysJSON))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return Config{}, err
+	}
+	cfg.IDPSources = nil
+	cfg.SCIMTargets = nil
+
+	return cfg, nil
+}
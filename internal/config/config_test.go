@@ -17,11 +17,147 @@ func TestNew(t *testing.T) {
 	assert.Equal(cfg.Debug, DefaultDebug)
 	assert.Equal(cfg.LogLevel, DefaultLogLevel)
 	assert.Equal(cfg.LogFormat, DefaultLogFormat)
+	assert.Equal(cfg.IDPType, DefaultIDPType)
+	assert.Equal(cfg.IDPGroupsConflictPolicy, DefaultIDPConflictPolicy)
+	assert.Equal(cfg.IDPUsersConflictPolicy, DefaultIDPConflictPolicy)
 	assert.Equal(cfg.GWSServiceAccountFile, DefaultGWSServiceAccountFile)
 	assert.Equal(cfg.SyncMethod, DefaultSyncMethod)
 	assert.Equal(cfg.GWSServiceAccountFileSecretName, DefaultGWSServiceAccountFileSecretName)
 	assert.Equal(cfg.GWSUserEmailSecretName, DefaultGWSUserEmailSecretName)
+	assert.Equal(cfg.EntraClientSecretSecretName, DefaultEntraClientSecretSecretName)
+	assert.Equal(cfg.OktaAPITokenSecretName, DefaultOktaAPITokenSecretName)
+	assert.Equal(cfg.LDAPBindPasswordSecretName, DefaultLDAPBindPasswordSecretName)
+	assert.Equal(cfg.SCIMTarget, DefaultSCIMTarget)
+	assert.Equal(cfg.SCIMProfile, DefaultSCIMProfile)
+	assert.Equal(cfg.SCIMAccessTokenSecretName, DefaultSCIMAccessTokenSecretName)
 	assert.Equal(cfg.AWSSCIMEndpointSecretName, DefaultAWSSCIMEndpointSecretName)
 	assert.Equal(cfg.AWSSCIMAccessTokenSecretName, DefaultAWSSCIMAccessTokenSecretName)
+	assert.Equal(cfg.GWSConcurrency, DefaultGWSConcurrency)
+	assert.Equal(cfg.GWSMaxRetries, DefaultGWSMaxRetries)
+	assert.Equal(cfg.GWSUsersLookup, DefaultGWSUsersLookup)
+	assert.Equal(cfg.AWSSCIMConcurrency, DefaultAWSSCIMConcurrency)
+	assert.Equal(cfg.AWSSCIMRateLimit, DefaultAWSSCIMRateLimit)
 	assert.Equal(cfg.UseSecretsManager, DefaultUseSecretsManager)
+	assert.Equal(cfg.DryRun, DefaultDryRun)
+	assert.Equal(cfg.DryRunOutputFormat, DefaultDryRunOutputFormat)
+	assert.Equal(cfg.Force, DefaultForce)
+	assert.Equal(cfg.UsersSoftDelete, DefaultUsersSoftDelete)
+	assert.Equal(cfg.UsersSoftDeleteGracePeriodDays, DefaultUsersSoftDeleteGracePeriodDays)
+	assert.Equal(cfg.PartialFailures, DefaultPartialFailures)
+	assert.Equal(cfg.Checkpoints, DefaultCheckpoints)
+	assert.Equal(cfg.CheckpointEvery, DefaultCheckpointEvery)
+	assert.Equal(cfg.SyncResultOutput, DefaultSyncResultOutput)
+	assert.Equal(cfg.SyncResultFile, DefaultSyncResultFile)
+	assert.Equal(cfg.MetricsPushGatewayJob, DefaultMetricsPushGatewayJob)
+	assert.Empty(cfg.MetricsListenAddress)
+	assert.Empty(cfg.MetricsPushGatewayURL)
+	assert.Empty(cfg.MetricsTextFile)
+	assert.Equal(cfg.TracingExporter, DefaultTracingExporter)
+	assert.Empty(cfg.TracingOTLPEndpoint)
+	assert.Equal(cfg.StateBackend, DefaultStateBackend)
+	assert.Equal(cfg.StateHistory, DefaultStateHistory)
+	assert.Equal(cfg.StateEncryption, DefaultStateEncryption)
+	assert.Empty(cfg.AWSKMSKeyID)
+	assert.Empty(cfg.StateEncryptionKeyFile)
+	assert.Equal(cfg.RunLock, DefaultRunLock)
+	assert.Equal(cfg.RunLockTTLSeconds, DefaultRunLockTTLSeconds)
+	assert.Empty(cfg.AWSDynamoDBTableName)
+	assert.Equal(0, cfg.MaxUsersDeletion)
+	assert.Equal(0.0, cfg.MaxUsersDeletionPercent)
+}
+
+func TestConfig_IDPSource(t *testing.T) {
+	cfg := New()
+	cfg.GWSUserEmail = "admin@a.example.com"
+	cfg.GWSGroupsFilter = []string{"name:AWS*"}
+	cfg.IDPSources = []map[string]any{
+		{"name": "tenant-b", "gws_user_email": "admin@b.example.com", "gws_groups_filter": []any{"name:Admins*"}},
+		{"idp_type": "file", "file_path": "identities.yaml"},
+		{"idp_type": "file", "nick_name": "unknown"},
+	}
+
+	t.Run("source with name", func(t *testing.T) {
+		name, got, err := cfg.IDPSource(0)
+		assert.NoError(t, err)
+		assert.Equal(t, "tenant-b", name)
+		assert.Equal(t, IDPTypeGoogle, got.IDPType)
+		assert.Equal(t, "admin@b.example.com", got.GWSUserEmail)
+		assert.Equal(t, []string{"name:Admins*"}, got.GWSGroupsFilter)
+		assert.Equal(t, DefaultGWSUserEmailSecretName, got.GWSUserEmailSecretName)
+		assert.Nil(t, got.IDPSources)
+
+		// the configuration is not modified
+		assert.Equal(t, "admin@a.example.com", cfg.GWSUserEmail)
+		assert.Equal(t, []string{"name:AWS*"}, cfg.GWSGroupsFilter)
+	})
+
+	t.Run("source without name", func(t *testing.T) {
+		name, got, err := cfg.IDPSource(1)
+		assert.NoError(t, err)
+		assert.Equal(t, "file-1", name)
+		assert.Equal(t, IDPTypeFile, got.IDPType)
+		assert.Equal(t, "identities.yaml", got.FilePath)
+	})
+
+	t.Run("unknown keys", func(t *testing.T) {
+		_, _, err := cfg.IDPSource(2)
+		assert.ErrorIs(t, err, ErrIDPSourceInvalid)
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		_, _, err := cfg.IDPSource(3)
+		assert.ErrorIs(t, err, ErrIDPSourceInvalid)
+	})
+}
+
+func TestConfig_SCIMTargetConfig(t *testing.T) {
+	cfg := New()
+	cfg.AWSS3BucketKey = "data/state.json"
+	cfg.AWSSCIMEndpoint = "https://scim.us-east-1.amazonaws.com/org-a/scim/v2/"
+	cfg.SCIMTargets = []map[string]any{
+		{"name": "org-b", "aws_scim_endpoint": "https://scim.us-east-1.amazonaws.com/org-b/scim/v2/", "groups_filter": []any{"AWS-OrgB-*"}},
+		{"scim_target": "generic", "scim_profile": "slack", "aws_s3_bucket_key": "slack.json"},
+		{"name": "org-c", "groups_filter": "AWS-OrgC-*"},
+		{"name": "org-d", "unknown": "value"},
+	}
+
+	t.Run("target with name and groups filter", func(t *testing.T) {
+		name, groupsFilter, got, err := cfg.SCIMTargetConfig(0)
+		assert.NoError(t, err)
+		assert.Equal(t, "org-b", name)
+		assert.Equal(t, []string{"AWS-OrgB-*"}, groupsFilter)
+		assert.Equal(t, SCIMTargetAWS, got.SCIMTarget)
+		assert.Equal(t, "https://scim.us-east-1.amazonaws.com/org-b/scim/v2/", got.AWSSCIMEndpoint)
+		assert.Equal(t, "data/org-b/state.json", got.AWSS3BucketKey)
+		assert.Nil(t, got.SCIMTargets)
+
+		// the configuration is not modified
+		assert.Equal(t, "https://scim.us-east-1.amazonaws.com/org-a/scim/v2/", cfg.AWSSCIMEndpoint)
+		assert.Equal(t, "data/state.json", cfg.AWSS3BucketKey)
+	})
+
+	t.Run("target without name", func(t *testing.T) {
+		name, groupsFilter, got, err := cfg.SCIMTargetConfig(1)
+		assert.NoError(t, err)
+		assert.Equal(t, "generic-1", name)
+		assert.Nil(t, groupsFilter)
+		assert.Equal(t, SCIMTargetGeneric, got.SCIMTarget)
+		assert.Equal(t, "slack", got.SCIMProfile)
+		assert.Equal(t, "slack.json", got.AWSS3BucketKey)
+	})
+
+	t.Run("groups filter is not a list", func(t *testing.T) {
+		_, _, _, err := cfg.SCIMTargetConfig(2)
+		assert.ErrorIs(t, err, ErrSCIMTargetInvalid)
+	})
+
+	t.Run("unknown keys", func(t *testing.T) {
+		_, _, _, err := cfg.SCIMTargetConfig(3)
+		assert.ErrorIs(t, err, ErrSCIMTargetInvalid)
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		_, _, _, err := cfg.SCIMTargetConfig(4)
+		assert.ErrorIs(t, err, ErrSCIMTargetInvalid)
+	})
 }
@@ -7,33 +7,49 @@ import (
 	"time"
 
 	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"github.com/slashdevops/idp-scim-sync/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // scimSync executes the sync of the data on the SCIM side and
-// returns the datasets synced
+// returns the datasets synced.
+// The groups and users of the phases completed in the checkpoint of the state, if any, are
+// reconciled with the checkpoint instead of the SCIM side, and cp stores the checkpoints of the sync.
 func scimSync(
 	ctx context.Context,
 	scim SCIMService,
 	idpGroupsResult *model.GroupsResult,
 	idpUsersResult *model.UsersResult,
 	idpGroupsMembersResult *model.GroupsMembersResult,
-) (*model.GroupsResult, *model.UsersResult, *model.GroupsMembersResult, error) {
+	state *model.State,
+	cp *checkpointer,
+) (_ *model.GroupsResult, _ *model.UsersResult, _ *model.GroupsMembersResult, err error) {
+	ctx, span := tracing.Start(ctx, "core.scimSync", attribute.Bool("checkpoint.resumed", state.Checkpoint != nil))
+	defer func() { tracing.End(span, err) }()
+
 	slog.Warn("reconciling the SCIM data with the Identity Provider data")
 
 	var totalGroupsResult *model.GroupsResult
 	var totalUsersResult *model.UsersResult
 	var totalGroupsMembersResult *model.GroupsMembersResult
 
-	slog.Info("getting SCIM Groups")
-	scimGroupsResult, err := scim.GetGroups(ctx)
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("error getting groups from the SCIM service: %w", err)
+	var scimGroupsResult *model.GroupsResult
+	if state.Checkpoint.PhaseCompleted(model.CheckpointPhaseGroups) {
+		slog.Info("getting groups from the checkpoint")
+		scimGroupsResult = state.Resources.Groups
+	} else {
+		slog.Info("getting SCIM Groups")
+		scimGroupsResult, err = scim.GetGroups(ctx)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error getting groups from the SCIM service: %w", err)
+		}
 	}
 
 	slog.Info("reconciling groups",
 		"idp", idpGroupsResult.Items,
 		"scim", scimGroupsResult.Items,
 	)
+	span.SetAttributes(attribute.Int("scim.groups", scimGroupsResult.Items))
 
 	groupsCreate, groupsUpdate, groupsEqual, groupsDelete, err := model.GroupsOperations(idpGroupsResult, scimGroupsResult)
 	if err != nil {
@@ -47,17 +63,34 @@ func scimSync(
 
 	// groupsCreated + groupsUpdated + groupsEqual = groups total
 	totalGroupsResult = model.MergeGroupsResult(groupsCreated, groupsUpdated, groupsEqual)
+	totalGroupsResult = keepFailedGroups(scim, scimGroupsResult, totalGroupsResult)
 
-	slog.Info("getting SCIM Users")
-	scimUsersResult, err := scim.GetUsers(ctx)
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("error getting users from the SCIM service: %w", err)
+	if err := cp.groupsCompleted(ctx, totalGroupsResult); err != nil {
+		return nil, nil, nil, err
+	}
+
+	var scimUsersResult *model.UsersResult
+	if state.Checkpoint.PhaseCompleted(model.CheckpointPhaseUsers) {
+		slog.Info("getting users from the checkpoint")
+		scimUsersResult = state.Resources.Users
+	} else {
+		slog.Info("getting SCIM Users")
+		scimUsersResult, err = scim.GetUsers(ctx)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error getting users from the SCIM service: %w", err)
+		}
+
+		if state.Checkpoint.PhaseInProgress(model.CheckpointPhaseUsers) {
+			slog.Info("resuming the users written before the checkpoint", "users", state.Resources.Users.Items)
+			scimUsersResult = resumeUsers(scimUsersResult, state.Resources.Users)
+		}
 	}
 
 	slog.Info("reconciling users",
 		"idp", idpUsersResult.Items,
 		"scim", scimUsersResult.Items,
 	)
+	span.SetAttributes(attribute.Int("scim.users", scimUsersResult.Items))
 	usersCreate, usersUpdate, usersEqual, usersDelete, err := model.UsersOperations(idpUsersResult, scimUsersResult)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("error operating with users: %w", err)
@@ -70,12 +103,23 @@ func scimSync(
 
 	// usersCreated + usersUpdated + usersEqual = users total
 	totalUsersResult = model.MergeUsersResult(usersCreated, usersUpdated, usersEqual)
+	totalUsersResult = keepFailedUsers(scim, scimUsersResult, totalUsersResult)
+
+	if err := cp.usersCompleted(ctx, totalUsersResult); err != nil {
+		return nil, nil, nil, err
+	}
 
 	slog.Info("getting SCIM Groups Members")
 	// unfortunately, the SCIM service does not support the getGroupsMembers method in and efficient way
 	// see: "Nor Supported" section in: https://docs.aws.amazon.com/singlesignon/latest/developerguide/listgroups.html
 	// scimGroupsMembersResult, err := scim.GetGroupsMembers(ctx, &totalGroupsResult) // not supported yet
-	scimGroupsMembersResult, err := scim.GetGroupsMembersBruteForce(ctx, totalGroupsResult, totalUsersResult)
+	var scimGroupsMembersResult *model.GroupsMembersResult
+	if state.Checkpoint.PhaseInProgress(model.CheckpointPhaseGroupsMembers) {
+		slog.Info("resuming the groups members written before the checkpoint", "groups", state.Resources.GroupsMembers.Items)
+		scimGroupsMembersResult, err = resumeGroupsMembers(ctx, scim, totalGroupsResult, totalUsersResult, state.Resources.GroupsMembers)
+	} else {
+		scimGroupsMembersResult, err = scim.GetGroupsMembersBruteForce(ctx, totalGroupsResult, totalUsersResult)
+	}
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("error getting groups members from the SCIM service: %w", err)
 	}
@@ -84,6 +128,7 @@ func scimSync(
 		"idp", idpGroupsMembersResult.Items,
 		"scim", scimGroupsMembersResult.Items,
 	)
+	span.SetAttributes(attribute.Int("scim.groups_members", scimGroupsMembersResult.Items))
 	membersCreate, membersEqual, membersDelete, err := model.MembersOperations(idpGroupsMembersResult, scimGroupsMembersResult)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("error reconciling groups members: %w", err)
@@ -96,6 +141,7 @@ func scimSync(
 
 	// membersCreate + membersEqual = members total
 	totalGroupsMembersResult = model.MergeGroupsMembersResult(membersCreated, membersEqual)
+	totalGroupsMembersResult = keepFailedGroupsMembers(scim, totalGroupsMembersResult)
 
 	return totalGroupsResult, totalUsersResult, totalGroupsMembersResult, nil
 }
@@ -109,7 +155,10 @@ func stateSync(
 	idpGroupsResult *model.GroupsResult,
 	idpUsersResult *model.UsersResult,
 	idpGroupsMembersResult *model.GroupsMembersResult,
-) (*model.GroupsResult, *model.UsersResult, *model.GroupsMembersResult, error) {
+) (_ *model.GroupsResult, _ *model.UsersResult, _ *model.GroupsMembersResult, err error) {
+	ctx, span := tracing.Start(ctx, "core.stateSync", attribute.String("state.last_sync", state.LastSync))
+	defer func() { tracing.End(span, err) }()
+
 	var totalGroupsResult *model.GroupsResult
 	var totalUsersResult *model.UsersResult
 	var totalGroupsMembersResult *model.GroupsMembersResult
@@ -125,6 +174,12 @@ func stateSync(
 		"since", time.Since(lastSyncTime).String(),
 	)
 
+	span.SetAttributes(
+		attribute.Bool("groups.changed", idpGroupsResult.HashCode != state.Resources.Groups.HashCode),
+		attribute.Bool("users.changed", idpUsersResult.HashCode != state.Resources.Users.HashCode),
+		attribute.Bool("groups_members.changed", idpGroupsMembersResult.HashCode != state.Resources.GroupsMembers.HashCode),
+	)
+
 	if idpGroupsResult.HashCode == state.Resources.Groups.HashCode {
 		slog.Info("provider groups and state groups are the same, nothing to do with groups")
 
@@ -150,6 +205,7 @@ func stateSync(
 
 		// merge in only one data structure the groups created, updated amd equals who has the SCIMID
 		totalGroupsResult = model.MergeGroupsResult(groupsCreated, groupsUpdated, groupsEqual)
+		totalGroupsResult = keepFailedGroups(scim, state.Resources.Groups, totalGroupsResult)
 	}
 
 	if idpUsersResult.HashCode == state.Resources.Users.HashCode {
@@ -175,6 +231,7 @@ func stateSync(
 
 		// usersCreated + usersUpdated + usersEqual = users total
 		totalUsersResult = model.MergeUsersResult(usersCreated, usersUpdated, usersEqual)
+		totalUsersResult = keepFailedUsers(scim, state.Resources.Users, totalUsersResult)
 	}
 
 	if idpGroupsMembersResult.HashCode == state.Resources.GroupsMembers.HashCode {
@@ -204,7 +261,7 @@ func stateSync(
 			return nil, nil, nil, fmt.Errorf("error reconciling groups members: %w", err)
 		}
 
-		totalGroupsMembersResult = model.MergeGroupsMembersResult(groupsMembers)
+		totalGroupsMembersResult = keepFailedGroupsMembers(scim, model.MergeGroupsMembersResult(groupsMembers))
 	}
 	return totalGroupsResult, totalUsersResult, totalGroupsMembersResult, nil
 }
@@ -0,0 +1,351 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"github.com/slashdevops/idp-scim-sync/internal/version"
+)
+
+// checkpointer stores the checkpoints of a first sync in the state repository of a target.
+// A checkpoint is stored when the groups and the users phases are completed and, when every is
+// greater than 0, every time every users or groups memberships of the phase in progress were written.
+// The methods of a nil checkpointer do nothing.
+type checkpointer struct {
+	repo  StateRepository
+	every int
+
+	mu             sync.Mutex
+	groups         *model.GroupsResult
+	users          *model.UsersResult
+	usersWritten   []*model.User
+	membersWritten []*model.GroupMembers
+	pending        int
+}
+
+// newCheckpointer returns a new checkpointer that stores the checkpoints in the given repository.
+func newCheckpointer(repo StateRepository, every int) *checkpointer {
+	return &checkpointer{
+		repo:   repo,
+		every:  every,
+		groups: model.GroupsResultBuilder().Build(),
+		users:  model.UsersResultBuilder().Build(),
+	}
+}
+
+// groupsCompleted stores a checkpoint with all the groups of the first sync.
+func (c *checkpointer) groupsCompleted(ctx context.Context, groups *model.GroupsResult) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.groups = groups
+	c.pending = 0
+
+	return c.save(ctx, model.CheckpointPhaseGroups, true, groups, model.UsersResultBuilder().Build(), nil)
+}
+
+// usersCompleted stores a checkpoint with all the groups and users of the first sync.
+func (c *checkpointer) usersCompleted(ctx context.Context, users *model.UsersResult) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.users = users
+	c.pending = 0
+
+	return c.save(ctx, model.CheckpointPhaseUsers, true, c.groups, users, nil)
+}
+
+// usersWrittenTo records the users written in the SCIM side and stores a checkpoint with
+// the groups and the users written so far every c.every users.
+func (c *checkpointer) usersWrittenTo(ctx context.Context, users []*model.User) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.usersWritten = append(c.usersWritten, users...)
+	if !c.due(len(users)) {
+		return nil
+	}
+
+	return c.save(ctx, model.CheckpointPhaseUsers, false, c.groups, model.UsersResultBuilder().WithResources(c.usersWritten).Build(), nil)
+}
+
+// groupsMembersWrittenTo records the groups memberships written in the SCIM side and stores a
+// checkpoint with the groups, the users and the groups memberships written so far every c.every groups.
+func (c *checkpointer) groupsMembersWrittenTo(ctx context.Context, groupsMembers []*model.GroupMembers) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.membersWritten = append(c.membersWritten, groupsMembers...)
+	if !c.due(len(groupsMembers)) {
+		return nil
+	}
+
+	return c.save(ctx, model.CheckpointPhaseGroupsMembers, false, c.groups, c.users, model.GroupsMembersResultBuilder().WithResources(c.membersWritten).Build())
+}
+
+// due counts the written resources and returns true when a checkpoint is due.
+func (c *checkpointer) due(written int) bool {
+	c.pending += written
+	if c.pending < c.every {
+		return false
+	}
+
+	c.pending = 0
+	return true
+}
+
+// save stores a checkpoint state with the given resources, it doesn't have the last sync date
+// so the next sync is a first sync too.
+func (c *checkpointer) save(
+	ctx context.Context,
+	phase string,
+	completed bool,
+	groups *model.GroupsResult,
+	users *model.UsersResult,
+	groupsMembers *model.GroupsMembersResult,
+) error {
+	checkpoint := &model.Checkpoint{
+		Phase:     phase,
+		Completed: completed,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+
+	if groupsMembers == nil {
+		groupsMembers = model.GroupsMembersResultBuilder().Build()
+	}
+
+	slog.Info("storing checkpoint",
+		"phase", checkpoint.Phase,
+		"completed", checkpoint.Completed,
+		"groups", groups.Items,
+		"users", users.Items,
+		"groups_members", groupsMembers.Items,
+	)
+
+	state := model.StateBuilder().
+		WithCodeVersion(version.Version).
+		WithCheckpoint(checkpoint).
+		WithGroups(groups).
+		WithUsers(users).
+		WithGroupsMembers(groupsMembers).
+		Build()
+
+	if err := c.repo.SetState(ctx, state); err != nil {
+		return fmt.Errorf("error storing the checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// checkpointSCIMService wraps a SCIMService and writes the users and the groups members in chunks
+// of checkpointer.every resources, the checkpointer is told about every chunk written.
+type checkpointSCIMService struct {
+	SCIMService
+	cp *checkpointer
+}
+
+// newCheckpointSCIMService returns a new checkpointSCIMService wrapping the given SCIMService
+func newCheckpointSCIMService(scim SCIMService, cp *checkpointer) *checkpointSCIMService {
+	return &checkpointSCIMService{
+		SCIMService: scim,
+		cp:          cp,
+	}
+}
+
+// writeInChunks calls write with chunks of size resources and written with the resources
+// returned by every chunk. The first error stops the writes, the resources written until
+// then are returned with it.
+func writeInChunks[T any](
+	ctx context.Context,
+	resources []T,
+	size int,
+	write func(ctx context.Context, chunk []T) ([]T, error),
+	written func(ctx context.Context, chunk []T) error,
+) ([]T, error) {
+	total := make([]T, 0, len(resources))
+
+	for i := 0; i < len(resources); i += size {
+		chunk, err := write(ctx, resources[i:min(i+size, len(resources))])
+		total = append(total, chunk...)
+		if err != nil {
+			return total, err
+		}
+
+		if err := written(ctx, chunk); err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// CreateUsers creates the users in chunks and stores a checkpoint after every chunk.
+func (s *checkpointSCIMService) CreateUsers(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+	return s.writeUsers(ctx, ur, s.SCIMService.CreateUsers)
+}
+
+// UpdateUsers updates the users in chunks and stores a checkpoint after every chunk.
+func (s *checkpointSCIMService) UpdateUsers(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+	return s.writeUsers(ctx, ur, s.SCIMService.UpdateUsers)
+}
+
+// CreateGroupsMembers adds the members to the groups in chunks of groups and stores a checkpoint after every chunk.
+func (s *checkpointSCIMService) CreateGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+	groupsMembers, err := writeInChunks(ctx, gmr.Resources, s.cp.every,
+		func(ctx context.Context, chunk []*model.GroupMembers) ([]*model.GroupMembers, error) {
+			r, err := s.SCIMService.CreateGroupsMembers(ctx, model.GroupsMembersResultBuilder().WithResources(chunk).Build())
+			if r == nil {
+				return nil, err
+			}
+			return r.Resources, err
+		},
+		s.cp.groupsMembersWrittenTo,
+	)
+
+	return model.GroupsMembersResultBuilder().WithResources(groupsMembers).Build(), err
+}
+
+func (s *checkpointSCIMService) writeUsers(
+	ctx context.Context,
+	ur *model.UsersResult,
+	write func(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error),
+) (*model.UsersResult, error) {
+	users, err := writeInChunks(ctx, ur.Resources, s.cp.every,
+		func(ctx context.Context, chunk []*model.User) ([]*model.User, error) {
+			r, err := write(ctx, model.UsersResultBuilder().WithResources(chunk).Build())
+			if r == nil {
+				return nil, err
+			}
+			return r.Resources, err
+		},
+		s.cp.usersWrittenTo,
+	)
+
+	return model.UsersResultBuilder().WithResources(users).Build(), err
+}
+
+// resumeUsers returns the users of the SCIM side with the users written before the checkpoint
+// of a users phase in progress replaced by their version in the checkpoint, so they are equal
+// to the identity provider users and they are not written again.
+func resumeUsers(scimUsers, checkpointUsers *model.UsersResult) *model.UsersResult {
+	written := make(map[string]*model.User, len(checkpointUsers.Resources))
+	for _, user := range checkpointUsers.Resources {
+		written[user.GetPrimaryEmailAddress()] = user
+	}
+
+	users := make([]*model.User, 0, len(scimUsers.Resources))
+	for _, user := range scimUsers.Resources {
+		if w, ok := written[user.GetPrimaryEmailAddress()]; ok && w.SCIMID == user.SCIMID {
+			user = w
+		}
+		users = append(users, user)
+	}
+
+	return model.UsersResultBuilder().WithResources(users).Build()
+}
+
+// resumeGroupsMembers returns the groups members of the SCIM side when the checkpoint was stored in
+// the middle of the groups members phase. The members written before the checkpoint are known, so
+// only the other users of every group are checked in the SCIM side.
+func resumeGroupsMembers(
+	ctx context.Context,
+	scim SCIMService,
+	gr *model.GroupsResult,
+	ur *model.UsersResult,
+	checkpointMembers *model.GroupsMembersResult,
+) (*model.GroupsMembersResult, error) {
+	written := make(map[string]map[string]struct{}, len(checkpointMembers.Resources))
+	for _, gm := range checkpointMembers.Resources {
+		emails, ok := written[gm.Group.SCIMID]
+		if !ok {
+			emails = make(map[string]struct{}, len(gm.Resources))
+			written[gm.Group.SCIMID] = emails
+		}
+		for _, member := range gm.Resources {
+			emails[member.Email] = struct{}{}
+		}
+	}
+
+	// the groups without members written are checked at once
+	unwritten := make([]*model.Group, 0, len(gr.Resources))
+	for _, group := range gr.Resources {
+		if _, ok := written[group.SCIMID]; !ok {
+			unwritten = append(unwritten, group)
+		}
+	}
+
+	byGroup := make(map[string]*model.GroupMembers, len(gr.Resources))
+	if len(unwritten) > 0 {
+		read, err := scim.GetGroupsMembersBruteForce(ctx, model.GroupsResultBuilder().WithResources(unwritten).Build(), ur)
+		if err != nil {
+			return nil, err
+		}
+		for _, gm := range read.Resources {
+			byGroup[gm.Group.SCIMID] = gm
+		}
+	}
+
+	for _, group := range gr.Resources {
+		emails, ok := written[group.SCIMID]
+		if !ok {
+			continue
+		}
+
+		known := make([]*model.Member, 0, len(emails))
+		unknown := make([]*model.User, 0, len(ur.Resources))
+		for _, user := range ur.Resources {
+			if _, ok := emails[user.GetPrimaryEmailAddress()]; !ok {
+				unknown = append(unknown, user)
+				continue
+			}
+
+			// the same member the brute force returns for a user in the group
+			m := model.MemberBuilder().
+				WithIPID(user.IPID).
+				WithSCIMID(user.SCIMID).
+				WithEmail(user.GetPrimaryEmailAddress()).
+				Build()
+			if user.Active {
+				m.Status = "ACTIVE"
+			}
+			known = append(known, m)
+		}
+
+		members := known
+		if len(unknown) > 0 {
+			read, err := scim.GetGroupsMembersBruteForce(ctx,
+				model.GroupsResultBuilder().WithResources([]*model.Group{group}).Build(),
+				model.UsersResultBuilder().WithResources(unknown).Build(),
+			)
+			if err != nil {
+				return nil, err
+			}
+			for _, gm := range read.Resources {
+				members = append(members, gm.Resources...)
+			}
+		}
+
+		byGroup[group.SCIMID] = model.GroupMembersBuilder().WithGroup(group).WithResources(members).Build()
+	}
+
+	groupsMembers := make([]*model.GroupMembers, 0, len(gr.Resources))
+	for _, group := range gr.Resources {
+		if gm, ok := byGroup[group.SCIMID]; ok {
+			groupsMembers = append(groupsMembers, gm)
+		}
+	}
+
+	return model.GroupsMembersResultBuilder().WithResources(groupsMembers).Build(), nil
+}
@@ -0,0 +1,422 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/core"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSyncService_Checkpoints(t *testing.T) {
+	ctx := context.TODO()
+
+	group1 := model.GroupBuilder().WithIPID("group-1").WithName("group 1").WithEmail("group.1@mail.com").Build()
+	newUser := func(id string) *model.User {
+		return model.UserBuilder().
+			WithIPID(id).
+			WithUserName(id + "@mail.com").
+			WithDisplayName(id).
+			WithName(model.NameBuilder().WithGivenName("user").WithFamilyName(id).Build()).
+			WithEmail(model.EmailBuilder().WithValue(id + "@mail.com").WithType("work").WithPrimary(true).Build()).
+			WithActive(true).
+			Build()
+	}
+	member1 := model.MemberBuilder().WithIPID("user-1").WithEmail("user-1@mail.com").WithStatus("ACTIVE").Build()
+
+	idpGroups := model.GroupsResultBuilder().WithResources([]*model.Group{group1}).Build()
+	idpGroupsMembers := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+		model.GroupMembersBuilder().WithGroup(group1).WithResources([]*model.Member{member1}).Build(),
+	}).Build()
+
+	setSCIMIDs := func(_ context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+		for _, g := range gr.Resources {
+			g.SCIMID = "scim-" + g.IPID
+		}
+		return gr, nil
+	}
+	setUsersSCIMIDs := func(_ context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+		for _, u := range ur.Resources {
+			u.SCIMID = "scim-" + u.IPID
+		}
+		return ur, nil
+	}
+
+	expectIdentityProvider := func(prov *mocks.MockIdentityProviderService, users *model.UsersResult) {
+		prov.EXPECT().GetGroups(ctx, gomock.Any()).Return(idpGroups, nil).Times(1)
+		prov.EXPECT().GetGroupsMembers(ctx, idpGroups).Return(idpGroupsMembers, nil).Times(1)
+		prov.EXPECT().GetUsersByGroupsMembers(ctx, idpGroupsMembers).Return(users, nil).Times(1)
+	}
+
+	t.Run("first sync stores a checkpoint after the groups and after the users", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		expectIdentityProvider(mockProviderService, model.UsersResultBuilder().WithResources([]*model.User{newUser("user-1")}).Build())
+		mockStateRepository.EXPECT().GetState(ctx).Return(model.StateBuilder().Build(), nil).Times(1)
+
+		mockSCIMService.EXPECT().GetGroups(ctx).Return(model.GroupsResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().GetUsers(ctx).Return(model.UsersResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().GetGroupsMembersBruteForce(ctx, gomock.Any(), gomock.Any()).Return(model.GroupsMembersResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().CreateGroups(ctx, gomock.Any()).DoAndReturn(setSCIMIDs).Times(1)
+		mockSCIMService.EXPECT().CreateUsers(ctx, gomock.Any()).DoAndReturn(setUsersSCIMIDs).Times(1)
+		mockSCIMService.EXPECT().CreateGroupsMembers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+				return gmr, nil
+			}).Times(1)
+
+		states := make([]*model.State, 0)
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				states = append(states, state)
+				return nil
+			}).Times(3)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository, WithCheckpoints(0))
+		assert.NoError(t, err)
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+
+		assert.Equal(t, &model.Checkpoint{Phase: model.CheckpointPhaseGroups, Completed: true, CreatedAt: states[0].Checkpoint.CreatedAt}, states[0].Checkpoint)
+		assert.Empty(t, states[0].LastSync)
+		assert.Equal(t, 1, states[0].Resources.Groups.Items)
+		assert.Equal(t, "scim-group-1", states[0].Resources.Groups.Resources[0].SCIMID)
+		assert.Equal(t, 0, states[0].Resources.Users.Items)
+
+		assert.Equal(t, model.CheckpointPhaseUsers, states[1].Checkpoint.Phase)
+		assert.True(t, states[1].Checkpoint.Completed)
+		assert.Equal(t, 1, states[1].Resources.Groups.Items)
+		assert.Equal(t, 1, states[1].Resources.Users.Items)
+
+		assert.Nil(t, states[2].Checkpoint)
+		assert.NotEmpty(t, states[2].LastSync)
+	})
+
+	t.Run("first sync stores a checkpoint every n users and groups memberships written", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		users := model.UsersResultBuilder().WithResources([]*model.User{newUser("user-1"), newUser("user-2"), newUser("user-3")}).Build()
+		expectIdentityProvider(mockProviderService, users)
+		mockStateRepository.EXPECT().GetState(ctx).Return(model.StateBuilder().Build(), nil).Times(1)
+
+		mockSCIMService.EXPECT().GetGroups(ctx).Return(model.GroupsResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().GetUsers(ctx).Return(model.UsersResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().GetGroupsMembersBruteForce(ctx, gomock.Any(), gomock.Any()).Return(model.GroupsMembersResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().CreateGroups(ctx, gomock.Any()).DoAndReturn(setSCIMIDs).Times(1)
+
+		chunks := make([]int, 0)
+		mockSCIMService.EXPECT().CreateUsers(ctx, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+				chunks = append(chunks, ur.Items)
+				return setUsersSCIMIDs(ctx, ur)
+			}).Times(2)
+		mockSCIMService.EXPECT().CreateGroupsMembers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+				return gmr, nil
+			}).Times(1)
+
+		states := make([]*model.State, 0)
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				states = append(states, state)
+				return nil
+			}).Times(4)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository, WithCheckpoints(2))
+		assert.NoError(t, err)
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+
+		assert.Equal(t, []int{2, 1}, chunks)
+
+		// groups completed, 2 users written, users completed and the final state,
+		// the only group membership written is less than 2
+		assert.True(t, states[0].Checkpoint.PhaseCompleted(model.CheckpointPhaseGroups))
+		assert.True(t, states[1].Checkpoint.PhaseInProgress(model.CheckpointPhaseUsers))
+		assert.Equal(t, 2, states[1].Resources.Users.Items)
+		assert.True(t, states[2].Checkpoint.PhaseCompleted(model.CheckpointPhaseUsers))
+		assert.Equal(t, 3, states[2].Resources.Users.Items)
+		assert.Nil(t, states[3].Checkpoint)
+	})
+
+	t.Run("first sync stores a checkpoint every n groups memberships written", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		users := model.UsersResultBuilder().WithResources([]*model.User{newUser("user-1")}).Build()
+		expectIdentityProvider(mockProviderService, users)
+		mockStateRepository.EXPECT().GetState(ctx).Return(model.StateBuilder().Build(), nil).Times(1)
+
+		mockSCIMService.EXPECT().GetGroups(ctx).Return(model.GroupsResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().GetUsers(ctx).Return(model.UsersResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().GetGroupsMembersBruteForce(ctx, gomock.Any(), gomock.Any()).Return(model.GroupsMembersResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().CreateGroups(ctx, gomock.Any()).DoAndReturn(setSCIMIDs).Times(1)
+		mockSCIMService.EXPECT().CreateUsers(ctx, gomock.Any()).DoAndReturn(setUsersSCIMIDs).Times(1)
+		mockSCIMService.EXPECT().CreateGroupsMembers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+				return gmr, nil
+			}).Times(1)
+
+		states := make([]*model.State, 0)
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				states = append(states, state)
+				return nil
+			}).Times(5)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository, WithCheckpoints(1))
+		assert.NoError(t, err)
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+
+		// groups completed, 1 user written, users completed, 1 group membership written and the final state
+		assert.True(t, states[3].Checkpoint.PhaseInProgress(model.CheckpointPhaseGroupsMembers))
+		assert.Equal(t, 1, states[3].Resources.Users.Items)
+		assert.Equal(t, 1, states[3].Resources.GroupsMembers.Items)
+		assert.Equal(t, "user-1@mail.com", states[3].Resources.GroupsMembers.Resources[0].Resources[0].Email)
+		assert.Nil(t, states[4].Checkpoint)
+	})
+
+	t.Run("the checkpoint is stored before a failure in the next phase", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+		errSCIM := errors.New("scim error")
+
+		expectIdentityProvider(mockProviderService, model.UsersResultBuilder().WithResources([]*model.User{newUser("user-1")}).Build())
+		mockStateRepository.EXPECT().GetState(ctx).Return(model.StateBuilder().Build(), nil).Times(1)
+
+		mockSCIMService.EXPECT().GetGroups(ctx).Return(model.GroupsResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().GetUsers(ctx).Return(model.UsersResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().CreateGroups(ctx, gomock.Any()).DoAndReturn(setSCIMIDs).Times(1)
+		mockSCIMService.EXPECT().CreateUsers(ctx, gomock.Any()).Return(nil, errSCIM).Times(1)
+
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				assert.True(t, state.Checkpoint.PhaseCompleted(model.CheckpointPhaseGroups))
+				assert.False(t, state.Checkpoint.PhaseCompleted(model.CheckpointPhaseUsers))
+				return nil
+			}).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository, WithCheckpoints(0))
+		assert.NoError(t, err)
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.ErrorIs(t, err, errSCIM)
+	})
+
+	t.Run("first sync resumes from the checkpoint", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		checkpointGroup := model.GroupBuilder().WithIPID("group-1").WithSCIMID("scim-group-1").WithName("group 1").WithEmail("group.1@mail.com").Build()
+		checkpointUser := newUser("user-1")
+		checkpointUser.SCIMID = "scim-user-1"
+
+		checkpoint := model.StateBuilder().
+			WithCheckpoint(&model.Checkpoint{Phase: model.CheckpointPhaseUsers, Completed: true}).
+			WithGroups(model.GroupsResultBuilder().WithResources([]*model.Group{checkpointGroup}).Build()).
+			WithUsers(model.UsersResultBuilder().WithResources([]*model.User{checkpointUser}).Build()).
+			Build()
+
+		expectIdentityProvider(mockProviderService, model.UsersResultBuilder().WithResources([]*model.User{newUser("user-1")}).Build())
+		mockStateRepository.EXPECT().GetState(ctx).Return(checkpoint, nil).Times(1)
+
+		// the groups and the users are not read from the SCIM side, and nothing is created again
+		mockSCIMService.EXPECT().GetGroups(gomock.Any()).Times(0)
+		mockSCIMService.EXPECT().GetUsers(gomock.Any()).Times(0)
+		mockSCIMService.EXPECT().GetGroupsMembersBruteForce(ctx, gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, gr *model.GroupsResult, ur *model.UsersResult) (*model.GroupsMembersResult, error) {
+				assert.Equal(t, "scim-group-1", gr.Resources[0].SCIMID)
+				assert.Equal(t, "scim-user-1", ur.Resources[0].SCIMID)
+				return model.GroupsMembersResultBuilder().Build(), nil
+			}).Times(1)
+		mockSCIMService.EXPECT().CreateGroupsMembers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+				return gmr, nil
+			}).Times(1)
+
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				assert.Nil(t, state.Checkpoint)
+				assert.Equal(t, 1, state.Resources.Groups.Items)
+				assert.Equal(t, 1, state.Resources.Users.Items)
+				return nil
+			}).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository)
+		assert.NoError(t, err)
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("first sync resumes from a checkpoint in the middle of the users", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		checkpointGroup := model.GroupBuilder().WithIPID("group-1").WithSCIMID("scim-group-1").WithName("group 1").WithEmail("group.1@mail.com").Build()
+		checkpointUser := newUser("user-1")
+		checkpointUser.SCIMID = "scim-user-1"
+
+		checkpoint := model.StateBuilder().
+			WithCheckpoint(&model.Checkpoint{Phase: model.CheckpointPhaseUsers}).
+			WithGroups(model.GroupsResultBuilder().WithResources([]*model.Group{checkpointGroup}).Build()).
+			WithUsers(model.UsersResultBuilder().WithResources([]*model.User{checkpointUser}).Build()).
+			Build()
+
+		// the SCIM side doesn't return the same attributes written, so its hash code is different
+		scimUser := model.UserBuilder().
+			WithSCIMID("scim-user-1").
+			WithUserName("user-1@mail.com").
+			WithEmail(model.EmailBuilder().WithValue("user-1@mail.com").WithType("work").WithPrimary(true).Build()).
+			Build()
+
+		expectIdentityProvider(mockProviderService, model.UsersResultBuilder().WithResources([]*model.User{newUser("user-1"), newUser("user-2")}).Build())
+		mockStateRepository.EXPECT().GetState(ctx).Return(checkpoint, nil).Times(1)
+
+		// the users written before the checkpoint are not updated again
+		mockSCIMService.EXPECT().GetGroups(gomock.Any()).Times(0)
+		mockSCIMService.EXPECT().GetUsers(ctx).Return(model.UsersResultBuilder().WithResources([]*model.User{scimUser}).Build(), nil).Times(1)
+		mockSCIMService.EXPECT().UpdateUsers(gomock.Any(), gomock.Any()).Times(0)
+		mockSCIMService.EXPECT().CreateUsers(ctx, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+				assert.Equal(t, 1, ur.Items)
+				assert.Equal(t, "user-2", ur.Resources[0].IPID)
+				return setUsersSCIMIDs(ctx, ur)
+			}).Times(1)
+		mockSCIMService.EXPECT().GetGroupsMembersBruteForce(ctx, gomock.Any(), gomock.Any()).Return(model.GroupsMembersResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().CreateGroupsMembers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+				return gmr, nil
+			}).Times(1)
+
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				assert.Nil(t, state.Checkpoint)
+				assert.Equal(t, 2, state.Resources.Users.Items)
+				return nil
+			}).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository)
+		assert.NoError(t, err)
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("first sync resumes from a checkpoint in the middle of the groups members", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		group2 := model.GroupBuilder().WithIPID("group-2").WithName("group 2").WithEmail("group.2@mail.com").Build()
+		member2 := model.MemberBuilder().WithIPID("user-2").WithEmail("user-2@mail.com").WithStatus("ACTIVE").Build()
+		groups := model.GroupsResultBuilder().WithResources([]*model.Group{group1, group2}).Build()
+		groupsMembers := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+			model.GroupMembersBuilder().WithGroup(group1).WithResources([]*model.Member{member1, member2}).Build(),
+			model.GroupMembersBuilder().WithGroup(group2).WithResources([]*model.Member{member1}).Build(),
+		}).Build()
+		users := model.UsersResultBuilder().WithResources([]*model.User{newUser("user-1"), newUser("user-2")}).Build()
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(groups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, groups).Return(groupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, groupsMembers).Return(users, nil).Times(1)
+
+		checkpointGroups := make([]*model.Group, 0, 2)
+		for _, g := range groups.Resources {
+			cg := *g
+			cg.SCIMID = "scim-" + g.IPID
+			checkpointGroups = append(checkpointGroups, &cg)
+		}
+		checkpointUsers := make([]*model.User, 0, 2)
+		for _, id := range []string{"user-1", "user-2"} {
+			u := newUser(id)
+			u.SCIMID = "scim-" + id
+			checkpointUsers = append(checkpointUsers, u)
+		}
+
+		// user-1 was added to group-1 before the checkpoint
+		checkpoint := model.StateBuilder().
+			WithCheckpoint(&model.Checkpoint{Phase: model.CheckpointPhaseGroupsMembers}).
+			WithGroups(model.GroupsResultBuilder().WithResources(checkpointGroups).Build()).
+			WithUsers(model.UsersResultBuilder().WithResources(checkpointUsers).Build()).
+			WithGroupsMembers(model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+				model.GroupMembersBuilder().WithGroup(checkpointGroups[0]).WithResources([]*model.Member{
+					model.MemberBuilder().WithIPID("user-1").WithSCIMID("scim-user-1").WithEmail("user-1@mail.com").Build(),
+				}).Build(),
+			}).Build()).
+			Build()
+
+		mockStateRepository.EXPECT().GetState(ctx).Return(checkpoint, nil).Times(1)
+
+		mockSCIMService.EXPECT().GetGroups(gomock.Any()).Times(0)
+		mockSCIMService.EXPECT().GetUsers(gomock.Any()).Times(0)
+
+		// group-2 is checked with all the users and group-1 only with user-2
+		mockSCIMService.EXPECT().GetGroupsMembersBruteForce(ctx, gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, gr *model.GroupsResult, ur *model.UsersResult) (*model.GroupsMembersResult, error) {
+				assert.Equal(t, 1, gr.Items)
+				switch gr.Resources[0].SCIMID {
+				case "scim-group-2":
+					assert.Equal(t, 2, ur.Items)
+				case "scim-group-1":
+					assert.Equal(t, 1, ur.Items)
+					assert.Equal(t, "scim-user-2", ur.Resources[0].SCIMID)
+				}
+				return model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+					model.GroupMembersBuilder().WithGroup(gr.Resources[0]).Build(),
+				}).Build(), nil
+			}).Times(2)
+		mockSCIMService.EXPECT().CreateGroupsMembers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+				assert.Equal(t, 2, gmr.Items)
+				for _, gm := range gmr.Resources {
+					assert.Equal(t, 1, gm.Items)
+					if gm.Group.IPID == "group-1" {
+						assert.Equal(t, "user-2@mail.com", gm.Resources[0].Email)
+					}
+				}
+				return gmr, nil
+			}).Times(1)
+
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				assert.Nil(t, state.Checkpoint)
+				assert.Equal(t, 3, countMembers(state.Resources.GroupsMembers.Resources))
+				return nil
+			}).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository)
+		assert.NoError(t, err)
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/slashdevops/idp-scim-sync/internal/repository"
+)
+
+// DefaultRunLockTTL is the default time a sync holds the lock of the state of the targets without renewing it.
+const DefaultRunLockTTL = 5 * time.Minute
+
+var (
+	// ErrSyncInProgress is returned when another sync holds the lock of the state of a target.
+	ErrSyncInProgress = errors.New("sync already in progress")
+
+	// ErrRunLockLost is returned when the lock of the state of a target cannot be renewed during the sync,
+	// the sync is canceled because another sync could take over the lock.
+	ErrRunLockLost = errors.New("the lock of the state was lost during the sync")
+)
+
+// lockedTarget is the lock of the state of a target held by a sync.
+type lockedTarget struct {
+	name   string
+	locker StateLocker
+}
+
+// runLock holds the locks of the state of the targets during a sync and renews them every third of the ttl.
+type runLock struct {
+	owner   string
+	ttl     time.Duration
+	targets []lockedTarget
+	cancel  context.CancelCauseFunc
+	stop    chan struct{}
+	done    sync.WaitGroup
+}
+
+// lockTargets acquires the locks of the state of the targets whose state repository implements StateLocker,
+// when the run lock is enabled. It returns the context of the sync, canceled when a lock is lost, and the function
+// that releases the locks, which returns ErrRunLockLost when a lock was lost. An error wrapping ErrSyncInProgress
+// is returned when another sync holds a lock, the locks already acquired are released.
+func (ss *SyncService) lockTargets(ctx context.Context) (context.Context, func() error, error) {
+	noop := func() error { return nil }
+	if !ss.runLock {
+		return ctx, noop, nil
+	}
+
+	rl := &runLock{owner: newRunLockOwner(), ttl: ss.runLockTTL, stop: make(chan struct{})}
+
+	for _, target := range ss.targets {
+		locker, ok := target.Repo.(StateLocker)
+		if !ok {
+			slog.Warn("the state repository of the target cannot be locked", "target", target.Name)
+			continue
+		}
+
+		if err := locker.Lock(ctx, rl.owner, rl.ttl); err != nil {
+			rl.unlock(ctx)
+
+			var held *repository.ErrLockHeld
+			if errors.As(err, &held) {
+				return ctx, noop, fmt.Errorf("%w, target: %s: %s", ErrSyncInProgress, target.Name, err)
+			}
+			return ctx, noop, fmt.Errorf("error locking the state, target: %s: %w", target.Name, err)
+		}
+
+		slog.Debug("state locked", "target", target.Name, "owner", rl.owner, "ttl", rl.ttl)
+		rl.targets = append(rl.targets, lockedTarget{name: target.Name, locker: locker})
+	}
+
+	if len(rl.targets) == 0 {
+		return ctx, noop, nil
+	}
+
+	lockCtx, cancel := context.WithCancelCause(ctx)
+	rl.cancel = cancel
+
+	rl.done.Add(1)
+	go rl.heartbeat(lockCtx)
+
+	return lockCtx, func() error {
+		close(rl.stop)
+		rl.done.Wait()
+
+		// the locks are released even when the sync was canceled
+		rl.unlock(context.WithoutCancel(ctx))
+
+		lost := context.Cause(lockCtx)
+		cancel(nil)
+		if errors.Is(lost, ErrRunLockLost) {
+			return lost
+		}
+		return nil
+	}, nil
+}
+
+// heartbeat renews the locks until the sync ends, the sync is canceled when a lock cannot be renewed.
+func (rl *runLock) heartbeat(ctx context.Context) {
+	defer rl.done.Done()
+
+	ticker := time.NewTicker(max(rl.ttl/3, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rl.stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, target := range rl.targets {
+				if err := target.locker.Renew(ctx, rl.owner, rl.ttl); err != nil {
+					slog.Error("cannot renew the lock of the state, canceling the sync", "target", target.name, "error", err)
+					rl.cancel(fmt.Errorf("%w, target: %s: %s", ErrRunLockLost, target.name, err))
+					return
+				}
+			}
+		}
+	}
+}
+
+// unlock releases the locks acquired, the errors are logged because the locks expire anyway.
+func (rl *runLock) unlock(ctx context.Context) {
+	for _, target := range rl.targets {
+		if err := target.locker.Unlock(ctx, rl.owner); err != nil {
+			slog.Warn("cannot release the lock of the state", "target", target.name, "error", err)
+		}
+	}
+}
+
+// newRunLockOwner returns a unique owner for the locks of a sync, with the host name to know who holds a lock.
+func newRunLockOwner() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+	}
+
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
@@ -0,0 +1,239 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/slashdevops/idp-scim-sync/internal/repository"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/core"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+// lockingStateRepository is a state repository that can lock its state
+type lockingStateRepository struct {
+	*mocks.MockStateRepository
+	*mocks.MockStateLocker
+}
+
+func newLockingStateRepository(mockCtrl *gomock.Controller) *lockingStateRepository {
+	return &lockingStateRepository{
+		MockStateRepository: mocks.NewMockStateRepository(mockCtrl),
+		MockStateLocker:     mocks.NewMockStateLocker(mockCtrl),
+	}
+}
+
+func TestWithRunLock(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	prov := mocks.NewMockIdentityProviderService(mockCtrl)
+	scim := mocks.NewMockSCIMService(mockCtrl)
+	repo := mocks.NewMockStateRepository(mockCtrl)
+
+	t.Run("Should set the ttl", func(t *testing.T) {
+		ss, err := NewSyncService(prov, scim, repo, WithRunLock(time.Minute))
+		assert.NoError(t, err)
+		assert.True(t, ss.runLock)
+		assert.Equal(t, time.Minute, ss.runLockTTL)
+	})
+
+	t.Run("Should use the default ttl when it is zero", func(t *testing.T) {
+		ss, err := NewSyncService(prov, scim, repo, WithRunLock(0))
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultRunLockTTL, ss.runLockTTL)
+	})
+}
+
+func TestSyncService_RunLock(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("Should return ErrSyncInProgress without syncing when the lock is held", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		prov := mocks.NewMockIdentityProviderService(mockCtrl)
+		scim := mocks.NewMockSCIMService(mockCtrl)
+		repo := newLockingStateRepository(mockCtrl)
+
+		repo.MockStateLocker.EXPECT().Lock(ctx, gomock.Any(), time.Minute).Return(&repository.ErrLockHeld{Key: "state.json.lock", Owner: "other"}).Times(1)
+
+		ss, err := NewSyncService(prov, scim, repo, WithRunLock(time.Minute))
+		assert.NoError(t, err)
+
+		result, err := ss.SyncGroupsAndTheirMembers(ctx)
+		assert.ErrorIs(t, err, ErrSyncInProgress)
+		assert.NotNil(t, result)
+		assert.Empty(t, result.Targets)
+	})
+
+	t.Run("Should return the error of the lock when it is not held", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		prov := mocks.NewMockIdentityProviderService(mockCtrl)
+		scim := mocks.NewMockSCIMService(mockCtrl)
+		repo := newLockingStateRepository(mockCtrl)
+
+		repo.MockStateLocker.EXPECT().Lock(ctx, gomock.Any(), time.Minute).Return(errors.New("test error")).Times(1)
+
+		ss, err := NewSyncService(prov, scim, repo, WithRunLock(time.Minute))
+		assert.NoError(t, err)
+
+		_, err = ss.SyncGroupsAndTheirMembers(ctx)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrSyncInProgress)
+	})
+}
+
+func TestSyncService_RunLockDuration(t *testing.T) {
+	ctx := context.TODO()
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	prov := mocks.NewMockIdentityProviderService(mockCtrl)
+	scim := mocks.NewMockSCIMService(mockCtrl)
+	repo := newLockingStateRepository(mockCtrl)
+
+	lockWait := 50 * time.Millisecond
+	repo.MockStateLocker.EXPECT().Lock(gomock.Any(), gomock.Any(), time.Minute).DoAndReturn(
+		func(_ context.Context, _ string, _ time.Duration) error {
+			time.Sleep(lockWait)
+			return nil
+		}).Times(1)
+	repo.MockStateLocker.EXPECT().Renew(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	repo.MockStateLocker.EXPECT().Unlock(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	prov.EXPECT().GetGroups(gomock.Any(), gomock.Any()).Return(nil, errors.New("test error")).Times(1)
+
+	ss, err := NewSyncService(prov, scim, repo, WithRunLock(time.Minute))
+	assert.NoError(t, err)
+
+	result, err := ss.SyncGroupsAndTheirMembers(ctx)
+	assert.Error(t, err)
+
+	// the identity provider phase doesn't include the time waiting for the lock
+	assert.GreaterOrEqual(t, result.DurationMs, lockWait.Milliseconds())
+	assert.Less(t, result.IdentityProvider.DurationMs, lockWait.Milliseconds())
+}
+
+func TestSyncService_lockTargets(t *testing.T) {
+	ctx := context.TODO()
+
+	newTargets := func(repos ...StateRepository) []SyncTarget {
+		targets := make([]SyncTarget, 0, len(repos))
+		for i, repo := range repos {
+			targets = append(targets, SyncTarget{Name: []string{"org-a", "org-b"}[i], SCIM: &mocks.MockSCIMService{}, Repo: repo})
+		}
+		return targets
+	}
+
+	t.Run("Should not lock when the run lock is disabled", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		repo := newLockingStateRepository(mockCtrl)
+		ss, err := NewMultiTargetSyncService(mocks.NewMockIdentityProviderService(mockCtrl), newTargets(repo))
+		assert.NoError(t, err)
+
+		lockCtx, unlock, err := ss.lockTargets(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx, lockCtx)
+		assert.NoError(t, unlock())
+	})
+
+	t.Run("Should skip the repositories that cannot be locked", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		repo := mocks.NewMockStateRepository(mockCtrl)
+		ss, err := NewMultiTargetSyncService(mocks.NewMockIdentityProviderService(mockCtrl), newTargets(repo), WithRunLock(time.Minute))
+		assert.NoError(t, err)
+
+		lockCtx, unlock, err := ss.lockTargets(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, ctx, lockCtx)
+		assert.NoError(t, unlock())
+	})
+
+	t.Run("Should lock every target with the same owner and unlock them", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		repoA := newLockingStateRepository(mockCtrl)
+		repoB := newLockingStateRepository(mockCtrl)
+
+		var owner string
+		repoA.MockStateLocker.EXPECT().Lock(ctx, gomock.Any(), time.Hour).DoAndReturn(
+			func(_ context.Context, o string, _ time.Duration) error {
+				owner = o
+				return nil
+			},
+		).Times(1)
+		repoB.MockStateLocker.EXPECT().Lock(ctx, gomock.Any(), time.Hour).DoAndReturn(
+			func(_ context.Context, o string, _ time.Duration) error {
+				assert.Equal(t, owner, o)
+				return nil
+			},
+		).Times(1)
+		repoA.MockStateLocker.EXPECT().Unlock(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		repoB.MockStateLocker.EXPECT().Unlock(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		ss, err := NewMultiTargetSyncService(mocks.NewMockIdentityProviderService(mockCtrl), newTargets(repoA, repoB), WithRunLock(time.Hour))
+		assert.NoError(t, err)
+
+		_, unlock, err := ss.lockTargets(ctx)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, owner)
+		assert.NoError(t, unlock())
+	})
+
+	t.Run("Should unlock the targets locked when a lock is held", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		repoA := newLockingStateRepository(mockCtrl)
+		repoB := newLockingStateRepository(mockCtrl)
+
+		repoA.MockStateLocker.EXPECT().Lock(ctx, gomock.Any(), time.Hour).Return(nil).Times(1)
+		repoB.MockStateLocker.EXPECT().Lock(ctx, gomock.Any(), time.Hour).Return(&repository.ErrLockHeld{Key: "org-b/state.json.lock"}).Times(1)
+		repoA.MockStateLocker.EXPECT().Unlock(ctx, gomock.Any()).Return(nil).Times(1)
+
+		ss, err := NewMultiTargetSyncService(mocks.NewMockIdentityProviderService(mockCtrl), newTargets(repoA, repoB), WithRunLock(time.Hour))
+		assert.NoError(t, err)
+
+		_, _, err = ss.lockTargets(ctx)
+		assert.ErrorIs(t, err, ErrSyncInProgress)
+	})
+
+	t.Run("Should renew the locks and cancel the sync when a lock is lost", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		repo := newLockingStateRepository(mockCtrl)
+
+		ttl := 30 * time.Millisecond
+		repo.MockStateLocker.EXPECT().Lock(ctx, gomock.Any(), ttl).Return(nil).Times(1)
+		gomock.InOrder(
+			repo.MockStateLocker.EXPECT().Renew(gomock.Any(), gomock.Any(), ttl).Return(nil).Times(1),
+			repo.MockStateLocker.EXPECT().Renew(gomock.Any(), gomock.Any(), ttl).Return(&repository.ErrLockLost{Key: "state.json.lock"}).Times(1),
+		)
+		repo.MockStateLocker.EXPECT().Unlock(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		ss, err := NewMultiTargetSyncService(mocks.NewMockIdentityProviderService(mockCtrl), newTargets(repo), WithRunLock(ttl))
+		assert.NoError(t, err)
+
+		lockCtx, unlock, err := ss.lockTargets(ctx)
+		assert.NoError(t, err)
+
+		select {
+		case <-lockCtx.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("the sync was not canceled")
+		}
+
+		assert.ErrorIs(t, unlock(), ErrRunLockLost)
+	})
+}
@@ -1,5 +1,11 @@
 package core
 
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
 // SyncServiceOption is a function that can be used to configure the SyncService
 // following the Option pattern.
 type SyncServiceOption func(*SyncService)
@@ -19,3 +25,94 @@ func WithIdentityProviderUsersFilter(filter []string) SyncServiceOption {
 		ss.provUsersFilter = filter
 	}
 }
+
+// WithGroupsDeletionThreshold is a SyncServiceOption that can be used to
+// limit the number of groups deleted in a single sync.
+func WithGroupsDeletionThreshold(threshold DeletionThreshold) SyncServiceOption {
+	return func(ss *SyncService) {
+		ss.deletionThresholds.Groups = threshold
+	}
+}
+
+// WithUsersDeletionThreshold is a SyncServiceOption that can be used to
+// limit the number of users deleted in a single sync.
+func WithUsersDeletionThreshold(threshold DeletionThreshold) SyncServiceOption {
+	return func(ss *SyncService) {
+		ss.deletionThresholds.Users = threshold
+	}
+}
+
+// WithGroupsMembersDeletionThreshold is a SyncServiceOption that can be used to
+// limit the number of groups memberships deleted in a single sync.
+func WithGroupsMembersDeletionThreshold(threshold DeletionThreshold) SyncServiceOption {
+	return func(ss *SyncService) {
+		ss.deletionThresholds.GroupsMembers = threshold
+	}
+}
+
+// WithForce is a SyncServiceOption that can be used to
+// apply the sync even when the deletion thresholds are exceeded.
+func WithForce(force bool) SyncServiceOption {
+	return func(ss *SyncService) {
+		ss.force = force
+	}
+}
+
+// WithUsersSoftDelete is a SyncServiceOption that can be used to deactivate (active=false)
+// the users removed from the identity provider instead of deleting them. The deactivated
+// users are deleted when the grace period expires, zero or less keeps them deactivated forever.
+func WithUsersSoftDelete(gracePeriod time.Duration) SyncServiceOption {
+	return func(ss *SyncService) {
+		ss.usersSoftDelete = true
+		ss.usersSoftDeleteGracePeriod = gracePeriod
+	}
+}
+
+// WithRunLock is a SyncServiceOption that can be used to lock the state of the targets during the sync, so two
+// syncs cannot run at the same time. The state repositories that implement StateLocker are locked before reading
+// the identity provider data, and the locks are renewed every third of the ttl, zero or less uses DefaultRunLockTTL.
+// The sync returns an error wrapping ErrSyncInProgress when another sync holds a lock.
+func WithRunLock(ttl time.Duration) SyncServiceOption {
+	return func(ss *SyncService) {
+		ss.runLock = true
+		ss.runLockTTL = ttl
+		if ttl <= 0 {
+			ss.runLockTTL = DefaultRunLockTTL
+		}
+	}
+}
+
+// WithCheckpoints is a SyncServiceOption that can be used to store checkpoints in the state repository
+// during the first sync, when the groups and the users are written and, when every is greater than 0,
+// every time every users or groups memberships are written. A first sync that finds a checkpoint in the
+// state repository doesn't read again from the SCIM side the groups or users of the phases completed,
+// and doesn't write again the users or groups memberships written before the checkpoint.
+func WithCheckpoints(every int) SyncServiceOption {
+	return func(ss *SyncService) {
+		ss.checkpoints = true
+		ss.checkpointsEvery = max(every, 0)
+	}
+}
+
+// WithPartialFailures is a SyncServiceOption that can be used to continue the sync when some resources fail
+// in the SCIM side. Every resource is sent on its own to the SCIM service, up to concurrency at the same time
+// (less than 1 is 1), the failed resources are collected in the SyncReport of the target result and
+// the state is stored without them, so the next sync retries them. The sync returns an
+// *ErrSyncPartiallyFailed error when some resources failed.
+func WithPartialFailures(concurrency int) SyncServiceOption {
+	return func(ss *SyncService) {
+		ss.partialFailures = true
+		ss.partialFailuresConcurrency = max(concurrency, 1)
+	}
+}
+
+// WithTracerProvider is a SyncServiceOption that can be used to trace the syncs with the given
+// tracer provider, the identity provider and SCIM services called during the sync create their
+// spans with it too. The global tracer provider is used by default.
+func WithTracerProvider(tp trace.TracerProvider) SyncServiceOption {
+	return func(ss *SyncService) {
+		if tp != nil {
+			ss.tracerProvider = tp
+		}
+	}
+}
@@ -35,8 +35,7 @@ func TestWithIdentityProviderGroupsFilter(t *testing.T) {
 			prov:             prov,
 			provGroupsFilter: filter,
 			provUsersFilter:  []string{},
-			scim:             scim,
-			repo:             repo,
+			targets:          []*SyncTarget{{Name: DefaultSyncTargetName, SCIM: scim, Repo: repo}},
 		}
 
 		// test length
@@ -52,7 +51,7 @@ func TestWithIdentityProviderGroupsFilter(t *testing.T) {
 		}
 
 		if !reflect.DeepEqual(got, want) {
-			t.Errorf("NewSyncService() got = %s, want %s", got, want)
+			t.Errorf("NewSyncService() got = %v, want %v", got, want)
 		}
 	})
 }
@@ -84,8 +83,7 @@ func TestWithIdentityProviderUsersFilter(t *testing.T) {
 			prov:             prov,
 			provGroupsFilter: []string{},
 			provUsersFilter:  filter,
-			scim:             scim,
-			repo:             repo,
+			targets:          []*SyncTarget{{Name: DefaultSyncTargetName, SCIM: scim, Repo: repo}},
 		}
 
 		// test length
@@ -101,7 +99,42 @@ func TestWithIdentityProviderUsersFilter(t *testing.T) {
 		}
 
 		if !reflect.DeepEqual(got, want) {
-			t.Errorf("NewSyncService() got = %s, want %s", got, want)
+			t.Errorf("NewSyncService() got = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestWithDeletionThresholdsAndForce(t *testing.T) {
+	t.Run("validate the return values", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		prov := mocks.NewMockIdentityProviderService(mockCtrl)
+		scim := mocks.NewMockSCIMService(mockCtrl)
+		repo := mocks.NewMockStateRepository(mockCtrl)
+
+		got, _ := NewSyncService(prov, scim, repo,
+			WithGroupsDeletionThreshold(DeletionThreshold{Max: 1}),
+			WithUsersDeletionThreshold(DeletionThreshold{MaxPercent: 10}),
+			WithGroupsMembersDeletionThreshold(DeletionThreshold{Max: 5, MaxPercent: 20}),
+			WithForce(true),
+		)
+
+		want := &SyncService{
+			prov:             prov,
+			provGroupsFilter: []string{},
+			provUsersFilter:  []string{},
+			targets:          []*SyncTarget{{Name: DefaultSyncTargetName, SCIM: scim, Repo: repo}},
+			deletionThresholds: DeletionThresholds{
+				Groups:        DeletionThreshold{Max: 1},
+				Users:         DeletionThreshold{MaxPercent: 10},
+				GroupsMembers: DeletionThreshold{Max: 5, MaxPercent: 20},
+			},
+			force: true,
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("NewSyncService() got = %v, want %v", got, want)
 		}
 	})
 }
@@ -0,0 +1,431 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"github.com/slashdevops/idp-scim-sync/internal/workerpool"
+)
+
+const (
+	// OperationCreate identifies the creation of groups and users in the sync reports.
+	OperationCreate = "create"
+
+	// OperationUpdate identifies the update of groups and users in the sync reports.
+	OperationUpdate = "update"
+
+	// OperationDelete identifies the deletion of groups and users in the sync reports.
+	OperationDelete = "delete"
+
+	// OperationDeactivate identifies the deactivation of users, instead of their deletion, in the sync results.
+	OperationDeactivate = "deactivate"
+
+	// OperationAdd identifies the addition of members to a group in the sync reports.
+	OperationAdd = "add"
+
+	// OperationRemove identifies the removal of members from a group in the sync reports.
+	OperationRemove = "remove"
+)
+
+// ResourceFailure is a resource that couldn't be changed in the SCIM side during a sync with partial failures.
+// Name is the name of the group, the email of the user or the name of the group whose members were changed,
+// and Error is the message of Err, so the reports keep the reason of the failure.
+type ResourceFailure struct {
+	Resource  string `json:"resource" yaml:"resource"`
+	Operation string `json:"operation" yaml:"operation"`
+	Name      string `json:"name" yaml:"name"`
+	Err       error  `json:"-" yaml:"-"`
+	Error     string `json:"error" yaml:"error"`
+}
+
+// SyncReport is the report of a sync with partial failures, the failed resources are not stored
+// in the state as changed so the next sync retries them.
+type SyncReport struct {
+	Failures []*ResourceFailure `json:"failures" yaml:"failures"`
+}
+
+// HasFailures returns true when at least one resource failed.
+func (r *SyncReport) HasFailures() bool {
+	return r != nil && len(r.Failures) > 0
+}
+
+// ErrSyncPartiallyFailed is returned when some resources failed during a sync with partial failures,
+// the other resources are synced and the state is stored.
+type ErrSyncPartiallyFailed struct {
+	Failures []*ResourceFailure
+}
+
+func (e *ErrSyncPartiallyFailed) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorCode(), e.ErrorMessage())
+}
+
+func (e *ErrSyncPartiallyFailed) ErrorMessage() string {
+	errs := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		errs = append(errs, fmt.Sprintf("%s %s %s: %s", f.Operation, f.Resource, f.Name, f.Err))
+	}
+
+	return fmt.Sprintf("%d resources failed and will be retried in the next sync, %s", len(e.Failures), strings.Join(errs, ", "))
+}
+
+func (e *ErrSyncPartiallyFailed) ErrorCode() string { return "ErrSyncPartiallyFailed" }
+
+// Unwrap returns the errors of the failed resources, so errors.Is and errors.As can be used with them.
+func (e *ErrSyncPartiallyFailed) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		errs = append(errs, f.Err)
+	}
+	return errs
+}
+
+// partialFailuresSCIMService wraps a SCIMService and sends every resource on its own to the wrapped
+// service, up to concurrency resources at the same time. The resources that fail are recorded in the
+// report and left out of the results instead of stopping the sync, the ones that were updated or
+// deleted are remembered so the sync keeps their previous version in the state.
+type partialFailuresSCIMService struct {
+	SCIMService
+	concurrency int
+	report      *SyncReport
+
+	groupsUpdated  []*model.Group
+	groupsDeleted  []*model.Group
+	usersUpdated   []*model.User
+	usersDeleted   []*model.User
+	membersAdded   []*model.GroupMembers
+	membersRemoved []*model.GroupMembers
+}
+
+// newPartialFailuresSCIMService returns a new partialFailuresSCIMService wrapping the given SCIMService
+// that records the failed resources in the given report.
+func newPartialFailuresSCIMService(scim SCIMService, concurrency int, report *SyncReport) *partialFailuresSCIMService {
+	return &partialFailuresSCIMService{
+		SCIMService: scim,
+		concurrency: concurrency,
+		report:      report,
+	}
+}
+
+// fail records the failed resource in the report, it is called once all the resources were sent.
+func (s *partialFailuresSCIMService) fail(resource, operation, name string, err error) {
+	slog.Error("resource failed, it will be retried in the next sync",
+		"resource", resource,
+		"operation", operation,
+		"name", name,
+		"error", err,
+	)
+
+	s.report.Failures = append(s.report.Failures, &ResourceFailure{
+		Resource:  resource,
+		Operation: operation,
+		Name:      name,
+		Err:       err,
+		Error:     err.Error(),
+	})
+}
+
+// forEachResource calls fn with every resource, up to concurrency at the same time, and returns
+// the error of every resource in the order of the resources.
+func forEachResource[T any](ctx context.Context, concurrency int, resources []T, fn func(ctx context.Context, i int, resource T) error) []error {
+	errs := make([]error, len(resources))
+
+	// the errors are collected by resource, so ForEach never returns an error
+	_ = workerpool.ForEach(ctx, len(resources), concurrency, func(ctx context.Context, i int) error {
+		errs[i] = fn(ctx, i, resources[i])
+		return nil
+	})
+
+	return errs
+}
+
+// CreateGroups creates the groups one by one and returns the groups created.
+func (s *partialFailuresSCIMService) CreateGroups(ctx context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+	created := make([]*model.Group, len(gr.Resources))
+
+	errs := forEachResource(ctx, s.concurrency, gr.Resources, func(ctx context.Context, i int, group *model.Group) error {
+		r, err := s.SCIMService.CreateGroups(ctx, model.GroupsResultBuilder().WithResources([]*model.Group{group}).Build())
+		if err != nil {
+			return err
+		}
+		created[i] = r.Resources[0]
+		return nil
+	})
+
+	groups := make([]*model.Group, 0, len(created))
+	for i, err := range errs {
+		if err != nil {
+			s.fail(ResourceGroups, OperationCreate, gr.Resources[i].Name, err)
+			continue
+		}
+		groups = append(groups, created[i])
+	}
+
+	return model.GroupsResultBuilder().WithResources(groups).Build(), nil
+}
+
+// UpdateGroups updates the groups one by one and returns the groups updated.
+func (s *partialFailuresSCIMService) UpdateGroups(ctx context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+	updated := make([]*model.Group, len(gr.Resources))
+
+	errs := forEachResource(ctx, s.concurrency, gr.Resources, func(ctx context.Context, i int, group *model.Group) error {
+		r, err := s.SCIMService.UpdateGroups(ctx, model.GroupsResultBuilder().WithResources([]*model.Group{group}).Build())
+		if err != nil {
+			return err
+		}
+		updated[i] = r.Resources[0]
+		return nil
+	})
+
+	groups := make([]*model.Group, 0, len(updated))
+	for i, err := range errs {
+		if err != nil {
+			s.fail(ResourceGroups, OperationUpdate, gr.Resources[i].Name, err)
+			s.groupsUpdated = append(s.groupsUpdated, gr.Resources[i])
+			continue
+		}
+		groups = append(groups, updated[i])
+	}
+
+	return model.GroupsResultBuilder().WithResources(groups).Build(), nil
+}
+
+// DeleteGroups deletes the groups one by one.
+func (s *partialFailuresSCIMService) DeleteGroups(ctx context.Context, gr *model.GroupsResult) error {
+	errs := forEachResource(ctx, s.concurrency, gr.Resources, func(ctx context.Context, i int, group *model.Group) error {
+		return s.SCIMService.DeleteGroups(ctx, model.GroupsResultBuilder().WithResources([]*model.Group{group}).Build())
+	})
+
+	for i, err := range errs {
+		if err != nil {
+			s.fail(ResourceGroups, OperationDelete, gr.Resources[i].Name, err)
+			s.groupsDeleted = append(s.groupsDeleted, gr.Resources[i])
+		}
+	}
+
+	return nil
+}
+
+// CreateUsers creates the users one by one and returns the users created.
+func (s *partialFailuresSCIMService) CreateUsers(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+	created := make([]*model.User, len(ur.Resources))
+
+	errs := forEachResource(ctx, s.concurrency, ur.Resources, func(ctx context.Context, i int, user *model.User) error {
+		r, err := s.SCIMService.CreateUsers(ctx, model.UsersResultBuilder().WithResources([]*model.User{user}).Build())
+		if err != nil {
+			return err
+		}
+		created[i] = r.Resources[0]
+		return nil
+	})
+
+	users := make([]*model.User, 0, len(created))
+	for i, err := range errs {
+		if err != nil {
+			s.fail(ResourceUsers, OperationCreate, ur.Resources[i].GetPrimaryEmailAddress(), err)
+			continue
+		}
+		users = append(users, created[i])
+	}
+
+	return model.UsersResultBuilder().WithResources(users).Build(), nil
+}
+
+// UpdateUsers updates the users one by one and returns the users updated.
+func (s *partialFailuresSCIMService) UpdateUsers(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+	updated := make([]*model.User, len(ur.Resources))
+
+	errs := forEachResource(ctx, s.concurrency, ur.Resources, func(ctx context.Context, i int, user *model.User) error {
+		r, err := s.SCIMService.UpdateUsers(ctx, model.UsersResultBuilder().WithResources([]*model.User{user}).Build())
+		if err != nil {
+			return err
+		}
+		updated[i] = r.Resources[0]
+		return nil
+	})
+
+	users := make([]*model.User, 0, len(updated))
+	for i, err := range errs {
+		if err != nil {
+			s.fail(ResourceUsers, OperationUpdate, ur.Resources[i].GetPrimaryEmailAddress(), err)
+			s.usersUpdated = append(s.usersUpdated, ur.Resources[i])
+			continue
+		}
+		users = append(users, updated[i])
+	}
+
+	return model.UsersResultBuilder().WithResources(users).Build(), nil
+}
+
+// DeleteUsers deletes the users one by one.
+func (s *partialFailuresSCIMService) DeleteUsers(ctx context.Context, ur *model.UsersResult) error {
+	errs := forEachResource(ctx, s.concurrency, ur.Resources, func(ctx context.Context, i int, user *model.User) error {
+		return s.SCIMService.DeleteUsers(ctx, model.UsersResultBuilder().WithResources([]*model.User{user}).Build())
+	})
+
+	for i, err := range errs {
+		if err != nil {
+			s.fail(ResourceUsers, OperationDelete, ur.Resources[i].GetPrimaryEmailAddress(), err)
+			s.usersDeleted = append(s.usersDeleted, ur.Resources[i])
+		}
+	}
+
+	return nil
+}
+
+// CreateGroupsMembers adds the members of the groups group by group and returns the groups members added.
+func (s *partialFailuresSCIMService) CreateGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+	created := make([]*model.GroupMembers, len(gmr.Resources))
+
+	errs := forEachResource(ctx, s.concurrency, gmr.Resources, func(ctx context.Context, i int, gm *model.GroupMembers) error {
+		r, err := s.SCIMService.CreateGroupsMembers(ctx, model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{gm}).Build())
+		if err != nil {
+			return err
+		}
+		created[i] = r.Resources[0]
+		return nil
+	})
+
+	groupsMembers := make([]*model.GroupMembers, 0, len(created))
+	for i, err := range errs {
+		if err != nil {
+			s.fail(ResourceGroupsMembers, OperationAdd, gmr.Resources[i].Group.Name, err)
+			s.membersAdded = append(s.membersAdded, gmr.Resources[i])
+			continue
+		}
+		groupsMembers = append(groupsMembers, created[i])
+	}
+
+	return model.GroupsMembersResultBuilder().WithResources(groupsMembers).Build(), nil
+}
+
+// DeleteGroupsMembers removes the members of the groups group by group.
+func (s *partialFailuresSCIMService) DeleteGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) error {
+	errs := forEachResource(ctx, s.concurrency, gmr.Resources, func(ctx context.Context, i int, gm *model.GroupMembers) error {
+		return s.SCIMService.DeleteGroupsMembers(ctx, model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{gm}).Build())
+	})
+
+	for i, err := range errs {
+		if err != nil {
+			s.fail(ResourceGroupsMembers, OperationRemove, gmr.Resources[i].Group.Name, err)
+			s.membersRemoved = append(s.membersRemoved, gmr.Resources[i])
+		}
+	}
+
+	return nil
+}
+
+// keepFailedGroups returns the total groups with the previous version of the groups that failed to be
+// updated or deleted, so the next sync sees them as changed again. When scim isn't a
+// partialFailuresSCIMService total is returned as it is.
+func keepFailedGroups(scim SCIMService, previous, total *model.GroupsResult) *model.GroupsResult {
+	p, ok := scim.(*partialFailuresSCIMService)
+	if !ok || len(p.groupsUpdated)+len(p.groupsDeleted) == 0 {
+		return total
+	}
+
+	previousGroups := make(map[string]*model.Group, len(previous.Resources))
+	for _, group := range previous.Resources {
+		previousGroups[group.Name] = group
+	}
+
+	groups := make([]*model.Group, 0, len(p.groupsUpdated)+len(p.groupsDeleted))
+	for _, group := range p.groupsUpdated {
+		if g, ok := previousGroups[group.Name]; ok {
+			groups = append(groups, g)
+		}
+	}
+	groups = append(groups, p.groupsDeleted...)
+
+	return model.MergeGroupsResult(total, model.GroupsResultBuilder().WithResources(groups).Build())
+}
+
+// keepFailedUsers returns the total users with the previous version of the users that failed to be
+// updated or deleted, so the next sync sees them as changed again. When scim isn't a
+// partialFailuresSCIMService total is returned as it is.
+func keepFailedUsers(scim SCIMService, previous, total *model.UsersResult) *model.UsersResult {
+	p, ok := scim.(*partialFailuresSCIMService)
+	if !ok || len(p.usersUpdated)+len(p.usersDeleted) == 0 {
+		return total
+	}
+
+	previousUsers := make(map[string]*model.User, len(previous.Resources))
+	for _, user := range previous.Resources {
+		previousUsers[user.GetPrimaryEmailAddress()] = user
+	}
+
+	users := make([]*model.User, 0, len(p.usersUpdated)+len(p.usersDeleted))
+	for _, user := range p.usersUpdated {
+		if u, ok := previousUsers[user.GetPrimaryEmailAddress()]; ok {
+			users = append(users, u)
+		}
+	}
+	users = append(users, p.usersDeleted...)
+
+	return model.MergeUsersResult(total, model.UsersResultBuilder().WithResources(users).Build())
+}
+
+// keepFailedGroupsMembers returns the total groups members without the members that failed to be added
+// and with the members that failed to be removed, so the next sync sees them as changed again.
+// When scim isn't a partialFailuresSCIMService total is returned as it is.
+func keepFailedGroupsMembers(scim SCIMService, total *model.GroupsMembersResult) *model.GroupsMembersResult {
+	p, ok := scim.(*partialFailuresSCIMService)
+	if !ok || len(p.membersAdded)+len(p.membersRemoved) == 0 {
+		return total
+	}
+
+	notAdded := make(map[string]map[string]struct{})
+	for _, gm := range p.membersAdded {
+		if _, ok := notAdded[gm.Group.Name]; !ok {
+			notAdded[gm.Group.Name] = make(map[string]struct{})
+		}
+		for _, member := range gm.Resources {
+			notAdded[gm.Group.Name][member.Email] = struct{}{}
+		}
+	}
+
+	notRemoved := make(map[string][]*model.Member)
+	for _, gm := range p.membersRemoved {
+		notRemoved[gm.Group.Name] = append(notRemoved[gm.Group.Name], gm.Resources...)
+	}
+
+	groupsMembers := make([]*model.GroupMembers, 0, len(total.Resources)+len(p.membersRemoved))
+	for _, gm := range total.Resources {
+		members := make([]*model.Member, 0, len(gm.Resources))
+		for _, member := range gm.Resources {
+			if _, ok := notAdded[gm.Group.Name][member.Email]; ok {
+				continue
+			}
+			members = append(members, member)
+		}
+
+		// the members not removed are kept in the first entry of their group
+		if removed, ok := notRemoved[gm.Group.Name]; ok {
+			members = append(members, removed...)
+			delete(notRemoved, gm.Group.Name)
+		}
+
+		groupsMembers = append(groupsMembers, model.GroupMembersBuilder().WithGroup(gm.Group).WithResources(members).Build())
+	}
+
+	// groups that are not in the total anymore, like the groups deleted in the identity provider
+	for _, gm := range p.membersRemoved {
+		if removed, ok := notRemoved[gm.Group.Name]; ok {
+			groupsMembers = append(groupsMembers, model.GroupMembersBuilder().WithGroup(gm.Group).WithResources(removed).Build())
+			delete(notRemoved, gm.Group.Name)
+		}
+	}
+
+	return model.GroupsMembersResultBuilder().WithResources(groupsMembers).Build()
+}
+
+// partialFailuresError returns an *ErrSyncPartiallyFailed error when the report has failures.
+func partialFailuresError(report *SyncReport) error {
+	if !report.HasFailures() {
+		return nil
+	}
+
+	return &ErrSyncPartiallyFailed{Failures: report.Failures}
+}
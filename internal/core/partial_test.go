@@ -0,0 +1,267 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/core"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSyncService_PartialFailures(t *testing.T) {
+	ctx := context.TODO()
+	errSCIM := errors.New("scim error")
+
+	groupA := model.GroupBuilder().WithIPID("group-a").WithName("group a").WithEmail("group.a@mail.com").Build()
+	groupB := model.GroupBuilder().WithIPID("group-b").WithName("group b").WithEmail("group.b@mail.com").Build()
+	newUser := func(id, familyName string) *model.User {
+		return model.UserBuilder().
+			WithIPID(id).
+			WithUserName(id + "@mail.com").
+			WithDisplayName(id).
+			WithName(model.NameBuilder().WithGivenName("user").WithFamilyName(familyName).Build()).
+			WithEmail(model.EmailBuilder().WithValue(id + "@mail.com").WithType("work").WithPrimary(true).Build()).
+			WithActive(true).
+			Build()
+	}
+	newMember := func(id string) *model.Member {
+		return model.MemberBuilder().WithIPID(id).WithEmail(id + "@mail.com").WithStatus("ACTIVE").Build()
+	}
+
+	t.Run("first sync stores the resources that didn't fail", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		idpGroups := model.GroupsResultBuilder().WithResources([]*model.Group{groupA, groupB}).Build()
+		idpUsers := model.UsersResultBuilder().WithResources([]*model.User{newUser("user-1", "1"), newUser("user-2", "2")}).Build()
+		idpGroupsMembers := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+			model.GroupMembersBuilder().WithGroup(groupA).WithResources([]*model.Member{newMember("user-1")}).Build(),
+			model.GroupMembersBuilder().WithGroup(groupB).WithResources([]*model.Member{newMember("user-1")}).Build(),
+		}).Build()
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(idpGroups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, idpGroups).Return(idpGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, idpGroupsMembers).Return(idpUsers, nil).Times(1)
+		mockStateRepository.EXPECT().GetState(ctx).Return(model.StateBuilder().Build(), nil).Times(1)
+
+		mockSCIMService.EXPECT().GetGroups(ctx).Return(model.GroupsResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().GetUsers(ctx).Return(model.UsersResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().GetGroupsMembersBruteForce(ctx, gomock.Any(), gomock.Any()).Return(model.GroupsMembersResultBuilder().Build(), nil).Times(1)
+
+		// every resource is sent on its own
+		mockSCIMService.EXPECT().CreateGroups(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+				assert.Equal(t, 1, gr.Items)
+				if gr.Resources[0].Name == "group b" {
+					return nil, errSCIM
+				}
+				gr.Resources[0].SCIMID = "scim-" + gr.Resources[0].IPID
+				return gr, nil
+			}).Times(2)
+		mockSCIMService.EXPECT().CreateUsers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+				assert.Equal(t, 1, ur.Items)
+				if ur.Resources[0].IPID == "user-2" {
+					return nil, errSCIM
+				}
+				ur.Resources[0].SCIMID = "scim-" + ur.Resources[0].IPID
+				return ur, nil
+			}).Times(2)
+		mockSCIMService.EXPECT().CreateGroupsMembers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+				assert.Equal(t, 1, gmr.Items)
+				if gmr.Resources[0].Group.Name == "group b" {
+					return nil, errSCIM
+				}
+				return gmr, nil
+			}).Times(2)
+
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				assert.Equal(t, 1, state.Resources.Groups.Items)
+				assert.Equal(t, "group a", state.Resources.Groups.Resources[0].Name)
+				assert.Equal(t, 1, state.Resources.Users.Items)
+				assert.Equal(t, "user-1", state.Resources.Users.Resources[0].IPID)
+				assert.Equal(t, 1, countMembers(state.Resources.GroupsMembers.Resources))
+				return nil
+			}).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository, WithPartialFailures(2))
+		assert.NoError(t, err)
+
+		result, err := svc.SyncGroupsAndTheirMembers(ctx)
+		assert.Error(t, err)
+		assert.ErrorIs(t, err, errSCIM)
+
+		var partialErr *ErrSyncPartiallyFailed
+		assert.ErrorAs(t, err, &partialErr)
+		assert.Equal(t, 3, len(partialErr.Failures))
+
+		results := result.Targets
+		assert.Equal(t, 1, len(results))
+		assert.Equal(t, 1, results[0].Groups)
+		assert.Equal(t, 1, results[0].Users)
+		assert.True(t, results[0].Report.HasFailures())
+		assert.Equal(t, []*ResourceFailure{
+			{Resource: ResourceGroups, Operation: OperationCreate, Name: "group b", Err: errSCIM, Error: errSCIM.Error()},
+			{Resource: ResourceUsers, Operation: OperationCreate, Name: "user-2@mail.com", Err: errSCIM, Error: errSCIM.Error()},
+			{Resource: ResourceGroupsMembers, Operation: OperationAdd, Name: "group b", Err: errSCIM, Error: errSCIM.Error()},
+		}, results[0].Report.Failures)
+
+		// the reason of the failures is part of the report
+		report, err := json.Marshal(results[0].Report)
+		assert.NoError(t, err)
+		assert.Contains(t, string(report), `"error":"scim error"`)
+	})
+
+	t.Run("failed updates and deletions keep the previous version in the state", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		groups := model.GroupsResultBuilder().WithResources([]*model.Group{groupA}).Build()
+		emptyGroupsMembers := model.GroupsMembersResultBuilder().Build()
+
+		stateUser1, stateUser2, stateUser3 := newUser("user-1", "old"), newUser("user-2", "old"), newUser("user-3", "3")
+		stateUser1.SCIMID, stateUser2.SCIMID, stateUser3.SCIMID = "scim-user-1", "scim-user-2", "scim-user-3"
+		state := model.StateBuilder().
+			WithLastSync(time.Now().Add(-time.Hour).Format(time.RFC3339)).
+			WithGroups(groups).
+			WithUsers(model.UsersResultBuilder().WithResources([]*model.User{stateUser1, stateUser2, stateUser3}).Build()).
+			WithGroupsMembers(emptyGroupsMembers).
+			Build()
+
+		idpUsers := model.UsersResultBuilder().WithResources([]*model.User{newUser("user-1", "1"), newUser("user-2", "2")}).Build()
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(groups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, groups).Return(emptyGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, emptyGroupsMembers).Return(idpUsers, nil).Times(1)
+		mockStateRepository.EXPECT().GetState(ctx).Return(state, nil).Times(1)
+
+		mockSCIMService.EXPECT().UpdateUsers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+				if ur.Resources[0].IPID == "user-1" {
+					return nil, errSCIM
+				}
+				return ur, nil
+			}).Times(2)
+		mockSCIMService.EXPECT().DeleteUsers(ctx, gomock.Any()).Return(errSCIM).Times(1)
+
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				users := make(map[string]*model.User)
+				for _, user := range state.Resources.Users.Resources {
+					users[user.IPID] = user
+				}
+
+				assert.Equal(t, 3, len(users))
+				assert.Equal(t, "old", users["user-1"].Name.FamilyName, "the failed update must keep the previous version")
+				assert.Equal(t, "2", users["user-2"].Name.FamilyName)
+				assert.Equal(t, "scim-user-3", users["user-3"].SCIMID, "the failed deletion must be kept")
+				return nil
+			}).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository, WithPartialFailures(1))
+		assert.NoError(t, err)
+
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+
+		var partialErr *ErrSyncPartiallyFailed
+		assert.ErrorAs(t, err, &partialErr)
+		assert.Equal(t, []*ResourceFailure{
+			{Resource: ResourceUsers, Operation: OperationUpdate, Name: "user-1@mail.com", Err: errSCIM, Error: errSCIM.Error()},
+			{Resource: ResourceUsers, Operation: OperationDelete, Name: "user-3@mail.com", Err: errSCIM, Error: errSCIM.Error()},
+		}, partialErr.Failures)
+	})
+
+	t.Run("without failures the sync doesn't return an error", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		groups := model.GroupsResultBuilder().WithResources([]*model.Group{groupA}).Build()
+		emptyGroupsMembers := model.GroupsMembersResultBuilder().Build()
+		users := model.UsersResultBuilder().WithResources([]*model.User{newUser("user-1", "1")}).Build()
+		state := model.StateBuilder().
+			WithLastSync(time.Now().Add(-time.Hour).Format(time.RFC3339)).
+			WithGroups(groups).
+			WithUsers(users).
+			WithGroupsMembers(emptyGroupsMembers).
+			Build()
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(groups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, groups).Return(emptyGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, emptyGroupsMembers).Return(users, nil).Times(1)
+		mockStateRepository.EXPECT().GetState(ctx).Return(state, nil).Times(1)
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).Return(nil).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository, WithPartialFailures(4))
+		assert.NoError(t, err)
+
+		result, err := svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+		assert.False(t, result.Targets[0].Report.HasFailures())
+	})
+}
+
+func TestKeepFailedGroupsMembers(t *testing.T) {
+	groupA := model.GroupBuilder().WithIPID("group-a").WithName("group a").Build()
+	groupB := model.GroupBuilder().WithIPID("group-b").WithName("group b").Build()
+	groupC := model.GroupBuilder().WithIPID("group-c").WithName("group c").Build()
+	newMember := func(id string) *model.Member {
+		return model.MemberBuilder().WithIPID(id).WithEmail(id + "@mail.com").Build()
+	}
+
+	total := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+		model.GroupMembersBuilder().WithGroup(groupA).WithResources([]*model.Member{newMember("user-1"), newMember("user-2")}).Build(),
+		model.GroupMembersBuilder().WithGroup(groupB).WithResources([]*model.Member{newMember("user-1")}).Build(),
+	}).Build()
+
+	t.Run("without partial failures total is returned as it is", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		assert.Same(t, total, keepFailedGroupsMembers(mocks.NewMockSCIMService(mockCtrl), total))
+	})
+
+	t.Run("members not added are removed and members not removed are kept", func(t *testing.T) {
+		p := newPartialFailuresSCIMService(nil, 1, &SyncReport{})
+		p.membersAdded = []*model.GroupMembers{
+			model.GroupMembersBuilder().WithGroup(groupA).WithResources([]*model.Member{newMember("user-2")}).Build(),
+		}
+		p.membersRemoved = []*model.GroupMembers{
+			model.GroupMembersBuilder().WithGroup(groupB).WithResources([]*model.Member{newMember("user-3")}).Build(),
+			model.GroupMembersBuilder().WithGroup(groupC).WithResources([]*model.Member{newMember("user-4")}).Build(),
+		}
+
+		got := keepFailedGroupsMembers(p, total)
+
+		assert.Equal(t, 3, got.Items)
+		members := make(map[string][]string)
+		for _, gm := range got.Resources {
+			for _, member := range gm.Resources {
+				members[gm.Group.Name] = append(members[gm.Group.Name], member.IPID)
+			}
+		}
+		assert.Equal(t, map[string][]string{
+			"group a": {"user-1"},
+			"group b": {"user-1", "user-3"},
+			"group c": {"user-4"},
+		}, members)
+	})
+}
@@ -0,0 +1,309 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+)
+
+// GroupsPlan represents the groups changes that a sync would apply in the SCIM side.
+type GroupsPlan struct {
+	Create []*model.Group `json:"create" yaml:"create"`
+	Update []*model.Group `json:"update" yaml:"update"`
+	Delete []*model.Group `json:"delete" yaml:"delete"`
+}
+
+// UsersPlan represents the users changes that a sync would apply in the SCIM side.
+// Deactivate contains the users that would be deactivated instead of deleted (soft-delete).
+type UsersPlan struct {
+	Create     []*model.User `json:"create" yaml:"create"`
+	Update     []*model.User `json:"update" yaml:"update"`
+	Delete     []*model.User `json:"delete" yaml:"delete"`
+	Deactivate []*model.User `json:"deactivate" yaml:"deactivate"`
+}
+
+// GroupsMembersPlan represents the membership changes that a sync would apply in the SCIM side.
+type GroupsMembersPlan struct {
+	Add    []*model.GroupMembers `json:"add" yaml:"add"`
+	Remove []*model.GroupMembers `json:"remove" yaml:"remove"`
+}
+
+// SyncPlan is the list of changes a sync would apply in the SCIM side
+// without applying them.
+type SyncPlan struct {
+	Target        string             `json:"target,omitempty" yaml:"target,omitempty"`
+	CreatedAt     string             `json:"createdAt" yaml:"createdAt"`
+	FirstSync     bool               `json:"firstSync" yaml:"firstSync"`
+	Groups        *GroupsPlan        `json:"groups" yaml:"groups"`
+	Users         *UsersPlan         `json:"users" yaml:"users"`
+	GroupsMembers *GroupsMembersPlan `json:"groupsMembers" yaml:"groupsMembers"`
+}
+
+// HasChanges returns true when the plan contains at least one change.
+func (p *SyncPlan) HasChanges() bool {
+	return len(p.Groups.Create)+len(p.Groups.Update)+len(p.Groups.Delete)+
+		len(p.Users.Create)+len(p.Users.Update)+len(p.Users.Delete)+len(p.Users.Deactivate)+
+		len(p.GroupsMembers.Add)+len(p.GroupsMembers.Remove) > 0
+}
+
+// newSyncPlan returns an empty SyncPlan
+func newSyncPlan() *SyncPlan {
+	return &SyncPlan{
+		Groups: &GroupsPlan{
+			Create: make([]*model.Group, 0),
+			Update: make([]*model.Group, 0),
+			Delete: make([]*model.Group, 0),
+		},
+		Users: &UsersPlan{
+			Create:     make([]*model.User, 0),
+			Update:     make([]*model.User, 0),
+			Delete:     make([]*model.User, 0),
+			Deactivate: make([]*model.User, 0),
+		},
+		GroupsMembers: &GroupsMembersPlan{
+			Add:    make([]*model.GroupMembers, 0),
+			Remove: make([]*model.GroupMembers, 0),
+		},
+	}
+}
+
+// planSCIMService implements the SCIMService interface but never writes into the SCIM side.
+// Read methods are delegated to the wrapped SCIMService and write methods
+// are recorded into the plan and return the same data they received.
+type planSCIMService struct {
+	scim    SCIMService
+	plan    *SyncPlan
+	current resourcesCount
+}
+
+// newPlanSCIMService returns a new planSCIMService wrapping the given SCIMService
+func newPlanSCIMService(scim SCIMService) *planSCIMService {
+	return &planSCIMService{
+		scim: scim,
+		plan: newSyncPlan(),
+	}
+}
+
+// GetGroups delegates to the wrapped SCIMService.
+func (p *planSCIMService) GetGroups(ctx context.Context) (*model.GroupsResult, error) {
+	gr, err := p.scim.GetGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.current.groups = gr.Items
+	return gr, nil
+}
+
+// CreateGroups records the groups to be created.
+func (p *planSCIMService) CreateGroups(_ context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+	p.plan.Groups.Create = append(p.plan.Groups.Create, gr.Resources...)
+	return model.GroupsResultBuilder().WithResources(gr.Resources).Build(), nil
+}
+
+// UpdateGroups records the groups to be updated.
+func (p *planSCIMService) UpdateGroups(_ context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+	p.plan.Groups.Update = append(p.plan.Groups.Update, gr.Resources...)
+	return model.GroupsResultBuilder().WithResources(gr.Resources).Build(), nil
+}
+
+// DeleteGroups records the groups to be deleted.
+func (p *planSCIMService) DeleteGroups(_ context.Context, gr *model.GroupsResult) error {
+	p.plan.Groups.Delete = append(p.plan.Groups.Delete, gr.Resources...)
+	return nil
+}
+
+// GetUsers delegates to the wrapped SCIMService.
+func (p *planSCIMService) GetUsers(ctx context.Context) (*model.UsersResult, error) {
+	ur, err := p.scim.GetUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.current.users = ur.Items
+	return ur, nil
+}
+
+// CreateUsers records the users to be created.
+func (p *planSCIMService) CreateUsers(_ context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+	p.plan.Users.Create = append(p.plan.Users.Create, ur.Resources...)
+	return model.UsersResultBuilder().WithResources(ur.Resources).Build(), nil
+}
+
+// UpdateUsers records the users to be updated.
+func (p *planSCIMService) UpdateUsers(_ context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+	p.plan.Users.Update = append(p.plan.Users.Update, ur.Resources...)
+	return model.UsersResultBuilder().WithResources(ur.Resources).Build(), nil
+}
+
+// DeleteUsers records the users to be deleted.
+func (p *planSCIMService) DeleteUsers(_ context.Context, ur *model.UsersResult) error {
+	p.plan.Users.Delete = append(p.plan.Users.Delete, ur.Resources...)
+	return nil
+}
+
+// DeactivateUsers records the users to be deactivated.
+func (p *planSCIMService) DeactivateUsers(_ context.Context, ur *model.UsersResult) error {
+	p.plan.Users.Deactivate = append(p.plan.Users.Deactivate, ur.Resources...)
+	return nil
+}
+
+// GetGroupsMembers delegates to the wrapped SCIMService.
+func (p *planSCIMService) GetGroupsMembers(ctx context.Context, gr *model.GroupsResult) (*model.GroupsMembersResult, error) {
+	return p.scim.GetGroupsMembers(ctx, gr)
+}
+
+// GetGroupsMembersBruteForce delegates to the wrapped SCIMService only the groups and users
+// that already exist in the SCIM side, the planned ones cannot have members yet.
+func (p *planSCIMService) GetGroupsMembersBruteForce(ctx context.Context, gr *model.GroupsResult, ur *model.UsersResult) (*model.GroupsMembersResult, error) {
+	groups := make([]*model.Group, 0, len(gr.Resources))
+	for _, group := range gr.Resources {
+		if group.SCIMID != "" {
+			groups = append(groups, group)
+		}
+	}
+
+	users := make([]*model.User, 0, len(ur.Resources))
+	for _, user := range ur.Resources {
+		if user.SCIMID != "" {
+			users = append(users, user)
+		}
+	}
+
+	gmr, err := p.scim.GetGroupsMembersBruteForce(
+		ctx,
+		model.GroupsResultBuilder().WithResources(groups).Build(),
+		model.UsersResultBuilder().WithResources(users).Build(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.current.groupsMembers = countMembers(gmr.Resources)
+	return gmr, nil
+}
+
+// CreateGroupsMembers records the members to be added to the groups.
+func (p *planSCIMService) CreateGroupsMembers(_ context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+	p.plan.GroupsMembers.Add = append(p.plan.GroupsMembers.Add, gmr.Resources...)
+	return model.GroupsMembersResultBuilder().WithResources(gmr.Resources).Build(), nil
+}
+
+// DeleteGroupsMembers records the members to be removed from the groups.
+func (p *planSCIMService) DeleteGroupsMembers(_ context.Context, gmr *model.GroupsMembersResult) error {
+	p.plan.GroupsMembers.Remove = append(p.plan.GroupsMembers.Remove, gmr.Resources...)
+	return nil
+}
+
+// PlanGroupsAndTheirMembers computes the changes the SyncGroupsAndTheirMembers method would
+// apply in the SCIM side of every target, without applying them and without storing the state.
+func (ss *SyncService) PlanGroupsAndTheirMembers(ctx context.Context) ([]*SyncPlan, error) {
+	return ss.plan(ctx, ss.getIdentityProviderData)
+}
+
+// PlanUsersAndGroups computes the changes the SyncUsersAndGroups method would
+// apply in the SCIM side of every target, without applying them and without storing the state.
+func (ss *SyncService) PlanUsersAndGroups(ctx context.Context) ([]*SyncPlan, error) {
+	return ss.plan(ctx, ss.getIdentityProviderUsersData)
+}
+
+// plan computes the changes needed to reconcile the SCIM side of every target with the identity provider
+// data returned by idpData. The plans of the targets that could be computed are returned even
+// when other targets fail, using the same errors as the sync.
+func (ss *SyncService) plan(ctx context.Context, idpData idpDataFunc) ([]*SyncPlan, error) {
+	idpGroupsResult, idpUsersResult, idpGroupsMembersResult, err := idpData(ctx, ss.prov)
+	if err != nil {
+		return nil, err
+	}
+
+	var plans []*SyncPlan
+	results := make([]*SyncTargetResult, 0, len(ss.targets))
+	for _, target := range ss.targets {
+		plan, err := ss.planTarget(ctx, target, idpGroupsResult, idpUsersResult, idpGroupsMembersResult)
+		if err != nil {
+			slog.Error("plan failed", "target", target.Name, "error", err)
+		} else {
+			plans = append(plans, plan)
+		}
+
+		results = append(results, &SyncTargetResult{Target: target.Name, Err: err})
+	}
+
+	return plans, ss.targetsError(results)
+}
+
+// planTarget computes the changes needed to reconcile the SCIM side of the target with the identity provider data.
+func (ss *SyncService) planTarget(
+	ctx context.Context,
+	target *SyncTarget,
+	idpGroupsResult *model.GroupsResult,
+	idpUsersResult *model.UsersResult,
+	idpGroupsMembersResult *model.GroupsMembersResult,
+) (*SyncPlan, error) {
+	idpGroupsResult, idpUsersResult, idpGroupsMembersResult = ss.targetData(target, idpGroupsResult, idpUsersResult, idpGroupsMembersResult)
+
+	state, err := ss.getState(ctx, target.Repo)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, current, err := ss.computePlan(ctx, target.SCIM, state, idpGroupsResult, idpUsersResult, idpGroupsMembersResult)
+	if err != nil {
+		return nil, err
+	}
+	plan.Target = target.Name
+
+	if err := checkDeletionThresholds(ss.deletionThresholds, plan, current); err != nil {
+		slog.Warn("the planned changes exceed the deletion thresholds", "target", target.Name, "error", err)
+	}
+
+	slog.Info("sync plan computed",
+		"target", target.Name,
+		"groups_create", len(plan.Groups.Create),
+		"groups_update", len(plan.Groups.Update),
+		"groups_delete", len(plan.Groups.Delete),
+		"users_create", len(plan.Users.Create),
+		"users_update", len(plan.Users.Update),
+		"users_delete", len(plan.Users.Delete),
+		"users_deactivate", len(plan.Users.Deactivate),
+		"groups_members_add", len(plan.GroupsMembers.Add),
+		"groups_members_remove", len(plan.GroupsMembers.Remove),
+	)
+
+	return plan, nil
+}
+
+// computePlan computes the changes needed to reconcile the SCIM side with the given identity provider data
+// without applying them, and returns the number of resources that exist before applying these changes.
+func (ss *SyncService) computePlan(
+	ctx context.Context,
+	scim SCIMService,
+	state *model.State,
+	idpGroupsResult *model.GroupsResult,
+	idpUsersResult *model.UsersResult,
+	idpGroupsMembersResult *model.GroupsMembersResult,
+) (*SyncPlan, resourcesCount, error) {
+	planSCIM := newPlanSCIMService(scim)
+
+	if state.LastSync == "" {
+		slog.Info("planning from scim service, first time syncing")
+	} else {
+		slog.Info("planning from state, it's not the first time syncing")
+
+		planSCIM.current = resourcesCount{
+			groups:        state.Resources.Groups.Items,
+			users:         state.Resources.Users.Items,
+			groupsMembers: countMembers(state.Resources.GroupsMembers.Resources),
+		}
+	}
+
+	if _, err := ss.reconcile(ctx, planSCIM, nil, state, idpGroupsResult, idpUsersResult, idpGroupsMembersResult, nil, nil); err != nil {
+		return nil, resourcesCount{}, fmt.Errorf("error planning the sync: %w", err)
+	}
+
+	plan := planSCIM.plan
+	plan.FirstSync = state.LastSync == ""
+	plan.CreatedAt = time.Now().Format(time.RFC3339)
+
+	return plan, planSCIM.current, nil
+}
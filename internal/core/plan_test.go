@@ -0,0 +1,129 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/core"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSyncService_PlanGroupsAndTheirMembers(t *testing.T) {
+	ctx := context.TODO()
+
+	group1 := model.GroupBuilder().WithIPID("group-1").WithName("group 1").WithEmail("group.1@mail.com").Build()
+	user1 := model.UserBuilder().
+		WithIPID("user-1").
+		WithUserName("user.1@mail.com").
+		WithDisplayName("user 1").
+		WithName(model.NameBuilder().WithGivenName("user").WithFamilyName("1").Build()).
+		WithEmail(model.EmailBuilder().WithValue("user.1@mail.com").WithType("work").WithPrimary(true).Build()).
+		WithActive(true).
+		Build()
+	member1 := model.MemberBuilder().WithIPID("user-1").WithEmail("user.1@mail.com").WithStatus("ACTIVE").Build()
+
+	idpGroups := model.GroupsResultBuilder().WithResources([]*model.Group{group1}).Build()
+	idpUsers := model.UsersResultBuilder().WithResources([]*model.User{user1}).Build()
+	idpGroupsMembers := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+		model.GroupMembersBuilder().WithGroup(group1).WithResources([]*model.Member{member1}).Build(),
+	}).Build()
+
+	t.Run("first sync plans creations without writing into SCIM or state", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(idpGroups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, idpGroups).Return(idpGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, idpGroupsMembers).Return(idpUsers, nil).Times(1)
+
+		mockStateRepository.EXPECT().GetState(ctx).Return(model.StateBuilder().Build(), nil).Times(1)
+		mockStateRepository.EXPECT().SetState(gomock.Any(), gomock.Any()).Times(0)
+
+		mockSCIMService.EXPECT().GetGroups(ctx).Return(model.GroupsResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().GetUsers(ctx).Return(model.UsersResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().GetGroupsMembersBruteForce(ctx, gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, gr *model.GroupsResult, ur *model.UsersResult) (*model.GroupsMembersResult, error) {
+				// the planned groups and users don't exist in SCIM yet
+				assert.Equal(t, 0, gr.Items)
+				assert.Equal(t, 0, ur.Items)
+				return model.GroupsMembersResultBuilder().Build(), nil
+			}).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository)
+		assert.NoError(t, err)
+
+		plans, err := svc.PlanGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(plans))
+
+		plan := plans[0]
+		assert.Equal(t, DefaultSyncTargetName, plan.Target)
+
+		assert.True(t, plan.FirstSync)
+		assert.True(t, plan.HasChanges())
+		assert.Equal(t, 1, len(plan.Groups.Create))
+		assert.Equal(t, "group 1", plan.Groups.Create[0].Name)
+		assert.Equal(t, 0, len(plan.Groups.Update))
+		assert.Equal(t, 0, len(plan.Groups.Delete))
+		assert.Equal(t, 1, len(plan.Users.Create))
+		assert.Equal(t, "user.1@mail.com", plan.Users.Create[0].UserName)
+		assert.Equal(t, 0, len(plan.Users.Update))
+		assert.Equal(t, 0, len(plan.Users.Delete))
+		assert.Equal(t, 1, len(plan.GroupsMembers.Add))
+		assert.Equal(t, "group 1", plan.GroupsMembers.Add[0].Group.Name)
+		assert.Equal(t, 0, len(plan.GroupsMembers.Remove))
+	})
+
+	t.Run("state sync plans deletions without writing into SCIM or state", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		emptyGroups := model.GroupsResultBuilder().Build()
+		emptyGroupsMembers := model.GroupsMembersResultBuilder().Build()
+		emptyUsers := model.UsersResultBuilder().Build()
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(emptyGroups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, emptyGroups).Return(emptyGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, emptyGroupsMembers).Return(emptyUsers, nil).Times(1)
+
+		state := model.StateBuilder().
+			WithLastSync(time.Now().Format(time.RFC3339)).
+			WithGroups(idpGroups).
+			WithUsers(idpUsers).
+			WithGroupsMembers(idpGroupsMembers).
+			Build()
+
+		mockStateRepository.EXPECT().GetState(ctx).Return(state, nil).Times(1)
+		mockStateRepository.EXPECT().SetState(gomock.Any(), gomock.Any()).Times(0)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository)
+		assert.NoError(t, err)
+
+		plans, err := svc.PlanGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(plans))
+
+		plan := plans[0]
+		assert.Equal(t, DefaultSyncTargetName, plan.Target)
+
+		assert.False(t, plan.FirstSync)
+		assert.True(t, plan.HasChanges())
+		assert.Equal(t, 0, len(plan.Groups.Create))
+		assert.Equal(t, 1, len(plan.Groups.Delete))
+		assert.Equal(t, 0, len(plan.Users.Create))
+		assert.Equal(t, 1, len(plan.Users.Delete))
+		assert.Equal(t, 0, len(plan.GroupsMembers.Add))
+		assert.Equal(t, 1, len(plan.GroupsMembers.Remove))
+	})
+}
@@ -6,6 +6,8 @@ import (
 	"log/slog"
 
 	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"github.com/slashdevops/idp-scim-sync/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
@@ -55,6 +57,21 @@ func reconcilingGroups(
 		return nil, nil, ErrDeleteGroupsResultNil
 	}
 
+	ctx, span := tracing.Start(ctx, "core.reconcilingGroups",
+		attribute.Int("groups.create", create.Items),
+		attribute.Int("groups.update", update.Items),
+		attribute.Int("groups.delete", remove.Items),
+	)
+	defer func() { tracing.End(span, e) }()
+
+	if span.IsRecording() {
+		span.SetAttributes(
+			tracing.Names("groups.create.names", groupsNames(create)),
+			tracing.Names("groups.update.names", groupsNames(update)),
+			tracing.Names("groups.delete.names", groupsNames(remove)),
+		)
+	}
+
 	var err error
 
 	if create.Items == 0 {
@@ -113,6 +130,13 @@ func reconcilingUsers(
 		return nil, nil, ErrDeleteUsersResultNil
 	}
 
+	ctx, span := tracing.Start(ctx, "core.reconcilingUsers",
+		attribute.Int("users.create", create.Items),
+		attribute.Int("users.update", update.Items),
+		attribute.Int("users.delete", remove.Items),
+	)
+	defer func() { tracing.End(span, e) }()
+
 	var err error
 
 	if create.Items == 0 {
@@ -167,6 +191,19 @@ func reconcilingGroupsMembers(
 		return nil, ErrDeleteGroupsMembersResultNil
 	}
 
+	ctx, span := tracing.Start(ctx, "core.reconcilingGroupsMembers",
+		attribute.Int("groups_members.create", countMembers(create.Resources)),
+		attribute.Int("groups_members.delete", countMembers(remove.Resources)),
+	)
+	defer func() { tracing.End(span, e) }()
+
+	if span.IsRecording() {
+		span.SetAttributes(
+			tracing.Names("groups_members.create.groups", groupsMembersNames(create)),
+			tracing.Names("groups_members.delete.groups", groupsMembersNames(remove)),
+		)
+	}
+
 	var err error
 
 	if create.Items == 0 {
@@ -191,3 +228,25 @@ func reconcilingGroupsMembers(
 
 	return
 }
+
+// groupsNames returns the names of the groups, used as attributes of the spans.
+func groupsNames(gr *model.GroupsResult) []string {
+	names := make([]string, 0, len(gr.Resources))
+	for _, group := range gr.Resources {
+		names = append(names, group.Name)
+	}
+
+	return names
+}
+
+// groupsMembersNames returns the names of the groups with members, used as attributes of the spans.
+func groupsMembersNames(gmr *model.GroupsMembersResult) []string {
+	names := make([]string, 0, len(gmr.Resources))
+	for _, groupMembers := range gmr.Resources {
+		if groupMembers.Group != nil {
+			names = append(names, groupMembers.Group.Name)
+		}
+	}
+
+	return names
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"time"
 
 	"github.com/slashdevops/idp-scim-sync/internal/model"
 )
@@ -18,3 +19,25 @@ type StateRepository interface {
 	// SetState sets the state of the synchronization process.
 	SetState(ctx context.Context, state *model.State) error
 }
+
+// StateMigrator is implemented by the state repositories that can upgrade their stored state to the
+// current schema version of the state.
+type StateMigrator interface {
+	// MigrateState upgrades the stored state to the current schema version of the state and
+	// returns the schema version it had.
+	MigrateState(ctx context.Context) (string, error)
+}
+
+// StateLocker is implemented by the state repositories that can lock their state, so only one sync
+// uses the state at the same time. The lock is a lease that expires after the ttl when it is not renewed.
+type StateLocker interface {
+	// Lock acquires the lock of the state for the owner during the ttl, it returns an
+	// *repository.ErrLockHeld error when another owner holds the lock.
+	Lock(ctx context.Context, owner string, ttl time.Duration) error
+
+	// Renew extends the lock of the state of the owner for the ttl.
+	Renew(ctx context.Context, owner string, ttl time.Duration) error
+
+	// Unlock releases the lock of the state of the owner.
+	Unlock(ctx context.Context, owner string) error
+}
@@ -0,0 +1,411 @@
+package core
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+)
+
+// ResourceChange is a resource changed in the SCIM side by a sync.
+// Name is the name of the group, the email of the user or the email of the member,
+// and Group is the name of the group of the member.
+type ResourceChange struct {
+	Operation string `json:"operation" yaml:"operation"`
+	Name      string `json:"name" yaml:"name"`
+	Group     string `json:"group,omitempty" yaml:"group,omitempty"`
+}
+
+// ResourceChanges counts the changes of one type of resource applied in the SCIM side by a sync.
+// Equal is the number of resources that didn't need any change, and the members added to
+// and removed from the groups are counted as created and deleted.
+type ResourceChanges struct {
+	Created     int               `json:"created" yaml:"created"`
+	Updated     int               `json:"updated" yaml:"updated"`
+	Equal       int               `json:"equal" yaml:"equal"`
+	Deleted     int               `json:"deleted" yaml:"deleted"`
+	Deactivated int               `json:"deactivated" yaml:"deactivated"`
+	Changes     []*ResourceChange `json:"changes" yaml:"changes"`
+}
+
+// newResourceChanges returns an empty ResourceChanges
+func newResourceChanges() *ResourceChanges {
+	return &ResourceChanges{Changes: make([]*ResourceChange, 0)}
+}
+
+// setEqual sets the resources that didn't change from the total of resources after the sync.
+func (c *ResourceChanges) setEqual(total int) {
+	c.Equal = max(total-c.Created-c.Updated, 0)
+}
+
+// SyncChanges are the changes applied in the SCIM side of a target by a sync.
+type SyncChanges struct {
+	Groups        *ResourceChanges `json:"groups" yaml:"groups"`
+	Users         *ResourceChanges `json:"users" yaml:"users"`
+	GroupsMembers *ResourceChanges `json:"groupsMembers" yaml:"groupsMembers"`
+
+	mu sync.Mutex
+}
+
+// newSyncChanges returns an empty SyncChanges
+func newSyncChanges() *SyncChanges {
+	return &SyncChanges{
+		Groups:        newResourceChanges(),
+		Users:         newResourceChanges(),
+		GroupsMembers: newResourceChanges(),
+	}
+}
+
+// IdentityProviderResult is the result of the retrieval of the identity provider data in a sync.
+type IdentityProviderResult struct {
+	Groups        int            `json:"groups" yaml:"groups"`
+	Users         int            `json:"users" yaml:"users"`
+	GroupsMembers int            `json:"groupsMembers" yaml:"groupsMembers"`
+	DurationMs    int64          `json:"durationMs" yaml:"durationMs"`
+	MethodCalls   map[string]int `json:"methodCalls" yaml:"methodCalls"`
+}
+
+// SyncResult is the result of a sync, it is returned even when the sync fails with the
+// targets that were synced or failed before.
+type SyncResult struct {
+	StartedAt        string                  `json:"startedAt" yaml:"startedAt"`
+	FinishedAt       string                  `json:"finishedAt" yaml:"finishedAt"`
+	DurationMs       int64                   `json:"durationMs" yaml:"durationMs"`
+	IdentityProvider *IdentityProviderResult `json:"identityProvider" yaml:"identityProvider"`
+	Targets          []*SyncTargetResult     `json:"targets" yaml:"targets"`
+}
+
+// newSyncResult returns an empty SyncResult started at the given time
+func newSyncResult(start time.Time) *SyncResult {
+	return &SyncResult{
+		StartedAt: start.Format(time.RFC3339),
+		IdentityProvider: &IdentityProviderResult{
+			MethodCalls: make(map[string]int),
+		},
+		Targets: make([]*SyncTargetResult, 0),
+	}
+}
+
+// finish sets the end of the sync that started at the given time.
+func (r *SyncResult) finish(start time.Time) {
+	r.FinishedAt = time.Now().Format(time.RFC3339)
+	r.DurationMs = time.Since(start).Milliseconds()
+}
+
+// methodCalls counts the calls to the methods of a service, it is safe for concurrent use.
+type methodCalls struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// newMethodCalls returns a new methodCalls without calls
+func newMethodCalls() *methodCalls {
+	return &methodCalls{calls: make(map[string]int)}
+}
+
+// add counts a call to the given method.
+func (c *methodCalls) add(method string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls[method]++
+}
+
+// counts returns a copy of the calls by method.
+func (c *methodCalls) counts() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return maps.Clone(c.calls)
+}
+
+// methodCallsIdentityProviderService wraps an IdentityProviderService and counts the calls to its methods.
+type methodCallsIdentityProviderService struct {
+	IdentityProviderService
+	calls *methodCalls
+}
+
+// newMethodCallsIdentityProviderService returns a new methodCallsIdentityProviderService wrapping the given IdentityProviderService
+func newMethodCallsIdentityProviderService(prov IdentityProviderService, calls *methodCalls) *methodCallsIdentityProviderService {
+	return &methodCallsIdentityProviderService{
+		IdentityProviderService: prov,
+		calls:                   calls,
+	}
+}
+
+// GetGroups counts the call and delegates to the wrapped IdentityProviderService.
+func (p *methodCallsIdentityProviderService) GetGroups(ctx context.Context, filter []string) (*model.GroupsResult, error) {
+	p.calls.add("GetGroups")
+	return p.IdentityProviderService.GetGroups(ctx, filter)
+}
+
+// GetUsers counts the call and delegates to the wrapped IdentityProviderService.
+func (p *methodCallsIdentityProviderService) GetUsers(ctx context.Context, filter []string) (*model.UsersResult, error) {
+	p.calls.add("GetUsers")
+	return p.IdentityProviderService.GetUsers(ctx, filter)
+}
+
+// GetGroupMembers counts the call and delegates to the wrapped IdentityProviderService.
+func (p *methodCallsIdentityProviderService) GetGroupMembers(ctx context.Context, id string) (*model.MembersResult, error) {
+	p.calls.add("GetGroupMembers")
+	return p.IdentityProviderService.GetGroupMembers(ctx, id)
+}
+
+// GetUsersByGroupsMembers counts the call and delegates to the wrapped IdentityProviderService.
+func (p *methodCallsIdentityProviderService) GetUsersByGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.UsersResult, error) {
+	p.calls.add("GetUsersByGroupsMembers")
+	return p.IdentityProviderService.GetUsersByGroupsMembers(ctx, gmr)
+}
+
+// GetGroupsMembers counts the call and delegates to the wrapped IdentityProviderService.
+func (p *methodCallsIdentityProviderService) GetGroupsMembers(ctx context.Context, gr *model.GroupsResult) (*model.GroupsMembersResult, error) {
+	p.calls.add("GetGroupsMembers")
+	return p.IdentityProviderService.GetGroupsMembers(ctx, gr)
+}
+
+// methodCallsSCIMService wraps a SCIMService and counts the calls to its methods.
+type methodCallsSCIMService struct {
+	SCIMService
+	calls *methodCalls
+}
+
+// newMethodCallsSCIMService returns a new methodCallsSCIMService wrapping the given SCIMService
+func newMethodCallsSCIMService(scim SCIMService, calls *methodCalls) *methodCallsSCIMService {
+	return &methodCallsSCIMService{
+		SCIMService: scim,
+		calls:       calls,
+	}
+}
+
+// GetGroups counts the call and delegates to the wrapped SCIMService.
+func (s *methodCallsSCIMService) GetGroups(ctx context.Context) (*model.GroupsResult, error) {
+	s.calls.add("GetGroups")
+	return s.SCIMService.GetGroups(ctx)
+}
+
+// CreateGroups counts the call and delegates to the wrapped SCIMService.
+func (s *methodCallsSCIMService) CreateGroups(ctx context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+	s.calls.add("CreateGroups")
+	return s.SCIMService.CreateGroups(ctx, gr)
+}
+
+// UpdateGroups counts the call and delegates to the wrapped SCIMService.
+func (s *methodCallsSCIMService) UpdateGroups(ctx context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+	s.calls.add("UpdateGroups")
+	return s.SCIMService.UpdateGroups(ctx, gr)
+}
+
+// DeleteGroups counts the call and delegates to the wrapped SCIMService.
+func (s *methodCallsSCIMService) DeleteGroups(ctx context.Context, gr *model.GroupsResult) error {
+	s.calls.add("DeleteGroups")
+	return s.SCIMService.DeleteGroups(ctx, gr)
+}
+
+// GetUsers counts the call and delegates to the wrapped SCIMService.
+func (s *methodCallsSCIMService) GetUsers(ctx context.Context) (*model.UsersResult, error) {
+	s.calls.add("GetUsers")
+	return s.SCIMService.GetUsers(ctx)
+}
+
+// CreateUsers counts the call and delegates to the wrapped SCIMService.
+func (s *methodCallsSCIMService) CreateUsers(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+	s.calls.add("CreateUsers")
+	return s.SCIMService.CreateUsers(ctx, ur)
+}
+
+// UpdateUsers counts the call and delegates to the wrapped SCIMService.
+func (s *methodCallsSCIMService) UpdateUsers(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+	s.calls.add("UpdateUsers")
+	return s.SCIMService.UpdateUsers(ctx, ur)
+}
+
+// DeleteUsers counts the call and delegates to the wrapped SCIMService.
+func (s *methodCallsSCIMService) DeleteUsers(ctx context.Context, ur *model.UsersResult) error {
+	s.calls.add("DeleteUsers")
+	return s.SCIMService.DeleteUsers(ctx, ur)
+}
+
+// GetGroupsMembers counts the call and delegates to the wrapped SCIMService.
+func (s *methodCallsSCIMService) GetGroupsMembers(ctx context.Context, gr *model.GroupsResult) (*model.GroupsMembersResult, error) {
+	s.calls.add("GetGroupsMembers")
+	return s.SCIMService.GetGroupsMembers(ctx, gr)
+}
+
+// GetGroupsMembersBruteForce counts the call and delegates to the wrapped SCIMService.
+func (s *methodCallsSCIMService) GetGroupsMembersBruteForce(ctx context.Context, gr *model.GroupsResult, ur *model.UsersResult) (*model.GroupsMembersResult, error) {
+	s.calls.add("GetGroupsMembersBruteForce")
+	return s.SCIMService.GetGroupsMembersBruteForce(ctx, gr, ur)
+}
+
+// CreateGroupsMembers counts the call and delegates to the wrapped SCIMService.
+func (s *methodCallsSCIMService) CreateGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+	s.calls.add("CreateGroupsMembers")
+	return s.SCIMService.CreateGroupsMembers(ctx, gmr)
+}
+
+// DeleteGroupsMembers counts the call and delegates to the wrapped SCIMService.
+func (s *methodCallsSCIMService) DeleteGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) error {
+	s.calls.add("DeleteGroupsMembers")
+	return s.SCIMService.DeleteGroupsMembers(ctx, gmr)
+}
+
+// changesSCIMService wraps a SCIMService and records in the sync changes the resources
+// written successfully by the wrapped service. When deactivate is true the deleted users
+// are recorded as deactivated, because the wrapped service deactivates them.
+type changesSCIMService struct {
+	SCIMService
+	changes    *SyncChanges
+	deactivate bool
+}
+
+// newChangesSCIMService returns a new changesSCIMService wrapping the given SCIMService
+func newChangesSCIMService(scim SCIMService, changes *SyncChanges, deactivate bool) *changesSCIMService {
+	return &changesSCIMService{
+		SCIMService: scim,
+		changes:     changes,
+		deactivate:  deactivate,
+	}
+}
+
+// recordGroups records the groups changed by the given operation.
+func (s *changesSCIMService) recordGroups(operation string, groups []*model.Group) {
+	s.changes.mu.Lock()
+	defer s.changes.mu.Unlock()
+
+	c := s.changes.Groups
+	for _, group := range groups {
+		c.Changes = append(c.Changes, &ResourceChange{Operation: operation, Name: group.Name})
+	}
+
+	switch operation {
+	case OperationCreate:
+		c.Created += len(groups)
+	case OperationUpdate:
+		c.Updated += len(groups)
+	case OperationDelete:
+		c.Deleted += len(groups)
+	}
+}
+
+// recordUsers records the users changed by the given operation.
+func (s *changesSCIMService) recordUsers(operation string, users []*model.User) {
+	s.changes.mu.Lock()
+	defer s.changes.mu.Unlock()
+
+	c := s.changes.Users
+	for _, user := range users {
+		c.Changes = append(c.Changes, &ResourceChange{Operation: operation, Name: user.GetPrimaryEmailAddress()})
+	}
+
+	switch operation {
+	case OperationCreate:
+		c.Created += len(users)
+	case OperationUpdate:
+		c.Updated += len(users)
+	case OperationDelete:
+		c.Deleted += len(users)
+	case OperationDeactivate:
+		c.Deactivated += len(users)
+	}
+}
+
+// recordGroupsMembers records the members added to or removed from the groups.
+func (s *changesSCIMService) recordGroupsMembers(operation string, groupsMembers []*model.GroupMembers) {
+	s.changes.mu.Lock()
+	defer s.changes.mu.Unlock()
+
+	c := s.changes.GroupsMembers
+	for _, gm := range groupsMembers {
+		for _, member := range gm.Resources {
+			c.Changes = append(c.Changes, &ResourceChange{Operation: operation, Name: member.Email, Group: gm.Group.Name})
+
+			switch operation {
+			case OperationAdd:
+				c.Created++
+			case OperationRemove:
+				c.Deleted++
+			}
+		}
+	}
+}
+
+// CreateGroups creates the groups and records the ones created.
+func (s *changesSCIMService) CreateGroups(ctx context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+	created, err := s.SCIMService.CreateGroups(ctx, gr)
+	if err != nil {
+		return nil, err
+	}
+	s.recordGroups(OperationCreate, created.Resources)
+	return created, nil
+}
+
+// UpdateGroups updates the groups and records the ones updated.
+func (s *changesSCIMService) UpdateGroups(ctx context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+	updated, err := s.SCIMService.UpdateGroups(ctx, gr)
+	if err != nil {
+		return nil, err
+	}
+	s.recordGroups(OperationUpdate, updated.Resources)
+	return updated, nil
+}
+
+// DeleteGroups deletes the groups and records them.
+func (s *changesSCIMService) DeleteGroups(ctx context.Context, gr *model.GroupsResult) error {
+	if err := s.SCIMService.DeleteGroups(ctx, gr); err != nil {
+		return err
+	}
+	s.recordGroups(OperationDelete, gr.Resources)
+	return nil
+}
+
+// CreateUsers creates the users and records the ones created.
+func (s *changesSCIMService) CreateUsers(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+	created, err := s.SCIMService.CreateUsers(ctx, ur)
+	if created != nil {
+		s.recordUsers(OperationCreate, created.Resources)
+	}
+	return created, err
+}
+
+// UpdateUsers updates the users and records the ones updated.
+func (s *changesSCIMService) UpdateUsers(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+	updated, err := s.SCIMService.UpdateUsers(ctx, ur)
+	if updated != nil {
+		s.recordUsers(OperationUpdate, updated.Resources)
+	}
+	return updated, err
+}
+
+// DeleteUsers deletes, or deactivates, the users and records them.
+func (s *changesSCIMService) DeleteUsers(ctx context.Context, ur *model.UsersResult) error {
+	if err := s.SCIMService.DeleteUsers(ctx, ur); err != nil {
+		return err
+	}
+
+	operation := OperationDelete
+	if s.deactivate {
+		operation = OperationDeactivate
+	}
+	s.recordUsers(operation, ur.Resources)
+	return nil
+}
+
+// CreateGroupsMembers adds the members to the groups and records the ones added.
+func (s *changesSCIMService) CreateGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+	added, err := s.SCIMService.CreateGroupsMembers(ctx, gmr)
+	if added != nil {
+		s.recordGroupsMembers(OperationAdd, added.Resources)
+	}
+	return added, err
+}
+
+// DeleteGroupsMembers removes the members from the groups and records them.
+func (s *changesSCIMService) DeleteGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) error {
+	if err := s.SCIMService.DeleteGroupsMembers(ctx, gmr); err != nil {
+		return err
+	}
+	s.recordGroupsMembers(OperationRemove, gmr.Resources)
+	return nil
+}
@@ -0,0 +1,257 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/core"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSyncService_SyncResult(t *testing.T) {
+	ctx := context.TODO()
+
+	newUser := func(displayName string) *model.User {
+		return model.UserBuilder().
+			WithIPID("user-1").
+			WithUserName("user.1@mail.com").
+			WithDisplayName(displayName).
+			WithName(model.NameBuilder().WithGivenName("user").WithFamilyName("1").Build()).
+			WithEmail(model.EmailBuilder().WithValue("user.1@mail.com").WithType("work").WithPrimary(true).Build()).
+			WithActive(true).
+			Build()
+	}
+
+	t.Run("first sync returns the changes, the api calls and the state hash codes", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		group1 := model.GroupBuilder().WithIPID("group-1").WithName("group 1").WithEmail("group.1@mail.com").Build()
+		member1 := model.MemberBuilder().WithIPID("user-1").WithEmail("user.1@mail.com").WithStatus("ACTIVE").Build()
+
+		idpGroups := model.GroupsResultBuilder().WithResources([]*model.Group{group1}).Build()
+		idpUsers := model.UsersResultBuilder().WithResources([]*model.User{newUser("user 1")}).Build()
+		idpGroupsMembers := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+			model.GroupMembersBuilder().WithGroup(group1).WithResources([]*model.Member{member1}).Build(),
+		}).Build()
+
+		scimGroup2 := model.GroupBuilder().WithIPID("group-2").WithSCIMID("scim-group-2").WithName("group 2").WithEmail("group.2@mail.com").Build()
+		scimUser1 := newUser("old user 1")
+		scimUser1.SCIMID = "scim-user-1"
+
+		emptyState := model.StateBuilder().Build()
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(idpGroups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, idpGroups).Return(idpGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, idpGroupsMembers).Return(idpUsers, nil).Times(1)
+		mockStateRepository.EXPECT().GetState(ctx).Return(emptyState, nil).Times(1)
+
+		mockSCIMService.EXPECT().GetGroups(ctx).Return(model.GroupsResultBuilder().WithResources([]*model.Group{scimGroup2}).Build(), nil).Times(1)
+		mockSCIMService.EXPECT().CreateGroups(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+				for _, g := range gr.Resources {
+					g.SCIMID = "scim-" + g.IPID
+				}
+				return gr, nil
+			}).Times(1)
+		mockSCIMService.EXPECT().DeleteGroups(ctx, gomock.Any()).Return(nil).Times(1)
+		mockSCIMService.EXPECT().GetUsers(ctx).Return(model.UsersResultBuilder().WithResources([]*model.User{scimUser1}).Build(), nil).Times(1)
+		mockSCIMService.EXPECT().UpdateUsers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+				return ur, nil
+			}).Times(1)
+		mockSCIMService.EXPECT().GetGroupsMembersBruteForce(ctx, gomock.Any(), gomock.Any()).Return(model.GroupsMembersResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().CreateGroupsMembers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+				return gmr, nil
+			}).Times(1)
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).Return(nil).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository)
+		assert.NoError(t, err)
+
+		result, err := svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+		assert.NotNil(t, result)
+
+		assert.NotEmpty(t, result.StartedAt)
+		assert.NotEmpty(t, result.FinishedAt)
+		assert.Equal(t, 1, result.IdentityProvider.Groups)
+		assert.Equal(t, 1, result.IdentityProvider.Users)
+		assert.Equal(t, 1, result.IdentityProvider.GroupsMembers)
+		assert.Equal(t, map[string]int{"GetGroups": 1, "GetGroupsMembers": 1, "GetUsersByGroupsMembers": 1}, result.IdentityProvider.MethodCalls)
+
+		assert.Equal(t, 1, len(result.Targets))
+		target := result.Targets[0]
+		assert.Equal(t, DefaultSyncTargetName, target.Target)
+		assert.Empty(t, target.Error)
+		assert.Equal(t, emptyState.HashCode, target.StateHashBefore)
+		assert.NotEmpty(t, target.StateHashAfter)
+		assert.NotEqual(t, target.StateHashBefore, target.StateHashAfter)
+
+		assert.Equal(t, &ResourceChanges{
+			Created: 1,
+			Deleted: 1,
+			Changes: []*ResourceChange{
+				{Operation: OperationCreate, Name: "group 1"},
+				{Operation: OperationDelete, Name: "group 2"},
+			},
+		}, target.Changes.Groups)
+		assert.Equal(t, &ResourceChanges{
+			Updated: 1,
+			Changes: []*ResourceChange{{Operation: OperationUpdate, Name: "user.1@mail.com"}},
+		}, target.Changes.Users)
+		assert.Equal(t, &ResourceChanges{
+			Created: 1,
+			Changes: []*ResourceChange{{Operation: OperationAdd, Name: "user.1@mail.com", Group: "group 1"}},
+		}, target.Changes.GroupsMembers)
+
+		assert.Equal(t, map[string]int{
+			"GetGroups":                  1,
+			"CreateGroups":               1,
+			"DeleteGroups":               1,
+			"GetUsers":                   1,
+			"UpdateUsers":                1,
+			"GetGroupsMembersBruteForce": 1,
+			"CreateGroupsMembers":        1,
+		}, target.MethodCalls)
+	})
+
+	t.Run("the result contains the error of the failed target", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+		stateErr := errors.New("state error")
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(model.GroupsResultBuilder().Build(), nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, gomock.Any()).Return(model.GroupsMembersResultBuilder().Build(), nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, gomock.Any()).Return(model.UsersResultBuilder().Build(), nil).Times(1)
+		mockStateRepository.EXPECT().GetState(ctx).Return(nil, stateErr).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository)
+		assert.NoError(t, err)
+
+		result, err := svc.SyncGroupsAndTheirMembers(ctx)
+		assert.ErrorIs(t, err, stateErr)
+		assert.Equal(t, 1, len(result.Targets))
+		assert.Contains(t, result.Targets[0].Error, "state error")
+		assert.Empty(t, result.Targets[0].StateHashAfter)
+		assert.Empty(t, result.Targets[0].MethodCalls)
+	})
+
+	t.Run("the result is returned when the identity provider fails", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+		idpErr := errors.New("idp error")
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(nil, idpErr).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository)
+		assert.NoError(t, err)
+
+		result, err := svc.SyncGroupsAndTheirMembers(ctx)
+		assert.ErrorIs(t, err, idpErr)
+		assert.NotNil(t, result)
+		assert.Empty(t, result.Targets)
+		assert.Equal(t, map[string]int{"GetGroups": 1}, result.IdentityProvider.MethodCalls)
+	})
+}
+
+func TestChangesSCIMService_DeleteUsers(t *testing.T) {
+	ctx := context.TODO()
+
+	user := model.UserBuilder().
+		WithIPID("user-1").
+		WithSCIMID("scim-user-1").
+		WithUserName("user.1@mail.com").
+		WithEmail(model.EmailBuilder().WithValue("user.1@mail.com").WithType("work").WithPrimary(true).Build()).
+		Build()
+	ur := model.UsersResultBuilder().WithResources([]*model.User{user}).Build()
+
+	t.Run("deleted users", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockSCIMService.EXPECT().DeleteUsers(ctx, ur).Return(nil).Times(1)
+
+		changes := newSyncChanges()
+		assert.NoError(t, newChangesSCIMService(mockSCIMService, changes, false).DeleteUsers(ctx, ur))
+		assert.Equal(t, 1, changes.Users.Deleted)
+		assert.Equal(t, 0, changes.Users.Deactivated)
+		assert.Equal(t, []*ResourceChange{{Operation: OperationDelete, Name: "user.1@mail.com"}}, changes.Users.Changes)
+	})
+
+	t.Run("deactivated users", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockSCIMService.EXPECT().DeleteUsers(ctx, ur).Return(nil).Times(1)
+
+		changes := newSyncChanges()
+		assert.NoError(t, newChangesSCIMService(mockSCIMService, changes, true).DeleteUsers(ctx, ur))
+		assert.Equal(t, 0, changes.Users.Deleted)
+		assert.Equal(t, 1, changes.Users.Deactivated)
+		assert.Equal(t, []*ResourceChange{{Operation: OperationDeactivate, Name: "user.1@mail.com"}}, changes.Users.Changes)
+	})
+
+	t.Run("failed users are not recorded", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockSCIMService.EXPECT().DeleteUsers(ctx, ur).Return(errors.New("scim error")).Times(1)
+
+		changes := newSyncChanges()
+		assert.Error(t, newChangesSCIMService(mockSCIMService, changes, false).DeleteUsers(ctx, ur))
+		assert.Equal(t, 0, changes.Users.Deleted)
+		assert.Empty(t, changes.Users.Changes)
+	})
+}
+
+func TestChangesSCIMService_CreateUsers(t *testing.T) {
+	ctx := context.TODO()
+
+	user := model.UserBuilder().
+		WithIPID("user-1").
+		WithUserName("user.1@mail.com").
+		WithEmail(model.EmailBuilder().WithValue("user.1@mail.com").WithType("work").WithPrimary(true).Build()).
+		Build()
+	failed := model.UserBuilder().
+		WithIPID("user-2").
+		WithUserName("user.2@mail.com").
+		WithEmail(model.EmailBuilder().WithValue("user.2@mail.com").WithType("work").WithPrimary(true).Build()).
+		Build()
+	ur := model.UsersResultBuilder().WithResources([]*model.User{user, failed}).Build()
+
+	t.Run("the users created are recorded with the errors of the others", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		created := model.UsersResultBuilder().WithResources([]*model.User{user}).Build()
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockSCIMService.EXPECT().CreateUsers(ctx, ur).Return(created, errors.New("scim error")).Times(1)
+
+		changes := newSyncChanges()
+		got, err := newChangesSCIMService(mockSCIMService, changes, false).CreateUsers(ctx, ur)
+		assert.Error(t, err)
+		assert.Equal(t, created, got)
+		assert.Equal(t, 1, changes.Users.Created)
+		assert.Equal(t, []*ResourceChange{{Operation: OperationCreate, Name: "user.1@mail.com"}}, changes.Users.Changes)
+	})
+}
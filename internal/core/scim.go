@@ -26,10 +26,12 @@ type SCIMService interface {
 	// GetUsers returns a list of all users from the SCIM service.
 	GetUsers(ctx context.Context) (*model.UsersResult, error)
 
-	// CreateUsers create users in the SCIM Service given a list of users.
+	// CreateUsers create users in the SCIM Service given a list of users, the users created
+	// are returned with the error when some users cannot be created.
 	CreateUsers(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error)
 
-	// UpdateUsers updates users in the SCIM Service given a list of users.
+	// UpdateUsers updates users in the SCIM Service given a list of users, the users updated
+	// are returned with the error when some users cannot be updated.
 	UpdateUsers(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error)
 
 	// DeleteUsers deletes users in the SCIM Service given a list of users.
@@ -41,7 +43,8 @@ type SCIMService interface {
 	// GetGroupsMembersBruteForce get the Groups and their Members from the SCIM service using brute force.
 	GetGroupsMembersBruteForce(ctx context.Context, gr *model.GroupsResult, ur *model.UsersResult) (*model.GroupsMembersResult, error)
 
-	// CreateGroupsMembers create groups members in the SCIM Service given a list of groups members.
+	// CreateGroupsMembers create groups members in the SCIM Service given a list of groups members, the groups
+	// members added are returned with the error when the members of some groups cannot be added.
 	CreateGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error)
 
 	// DeleteGroupsMembers deletes groups members in the SCIM Service given a list of groups members.
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+)
+
+// usersDeactivator is implemented by the SCIM services that handle the deactivation of users
+// in a different way than a regular update, like the plan SCIM service.
+type usersDeactivator interface {
+	DeactivateUsers(ctx context.Context, ur *model.UsersResult) error
+}
+
+// softDeleteSCIMService wraps a SCIMService and deactivates (active=false) the users
+// instead of deleting them, every deactivated user is recorded as a tombstone.
+type softDeleteSCIMService struct {
+	SCIMService
+	now        time.Time
+	tombstones []*model.Tombstone
+}
+
+// newSoftDeleteSCIMService returns a new softDeleteSCIMService wrapping the given SCIMService
+func newSoftDeleteSCIMService(scim SCIMService, now time.Time) *softDeleteSCIMService {
+	return &softDeleteSCIMService{
+		SCIMService: scim,
+		now:         now,
+		tombstones:  make([]*model.Tombstone, 0),
+	}
+}
+
+// DeleteUsers deactivates the users in the SCIM side and records their tombstones.
+func (s *softDeleteSCIMService) DeleteUsers(ctx context.Context, ur *model.UsersResult) error {
+	users := make([]*model.User, 0, len(ur.Resources))
+	for _, user := range ur.Resources {
+		u := *user
+		u.Active = false
+		u.SetHashCode()
+
+		users = append(users, &u)
+	}
+
+	deactivate := model.UsersResultBuilder().WithResources(users).Build()
+
+	slog.Warn("deactivating users instead of deleting them", "users", deactivate.Items)
+
+	if d, ok := s.SCIMService.(usersDeactivator); ok {
+		if err := d.DeactivateUsers(ctx, deactivate); err != nil {
+			return err
+		}
+	} else {
+		if _, err := s.SCIMService.UpdateUsers(ctx, deactivate); err != nil {
+			return fmt.Errorf("error deactivating users: %w", err)
+		}
+	}
+
+	for _, user := range users {
+		s.tombstones = append(s.tombstones, &model.Tombstone{
+			User:          user,
+			DeactivatedAt: s.now.Format(time.RFC3339),
+		})
+	}
+
+	return nil
+}
+
+// restoreTombstones returns a copy of the state where the tombstoned users that came back to
+// the identity provider are part of the state users again, as deactivated users, so the sync updates
+// (reactivates) them instead of creating them. It also returns the tombstones still alive.
+func restoreTombstones(state *model.State, idpUsersResult *model.UsersResult) (*model.State, []*model.Tombstone) {
+	if len(state.Resources.Tombstones) == 0 {
+		return state, make([]*model.Tombstone, 0)
+	}
+
+	idpUsers := make(map[string]struct{}, len(idpUsersResult.Resources))
+	for _, user := range idpUsersResult.Resources {
+		idpUsers[user.GetPrimaryEmailAddress()] = struct{}{}
+	}
+
+	tombstones := make([]*model.Tombstone, 0, len(state.Resources.Tombstones))
+	restored := make([]*model.User, 0)
+
+	for _, tombstone := range state.Resources.Tombstones {
+		if _, ok := idpUsers[tombstone.User.GetPrimaryEmailAddress()]; ok {
+			slog.Warn("user came back to the identity provider, reactivating it",
+				"user", tombstone.User.DisplayName,
+				"email", tombstone.User.GetPrimaryEmailAddress(),
+				"deactivated_at", tombstone.DeactivatedAt,
+			)
+			restored = append(restored, tombstone.User)
+			continue
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+
+	if len(restored) == 0 {
+		return state, tombstones
+	}
+
+	// avoid modifying the given state
+	resources := *state.Resources
+	resources.Users = model.MergeUsersResult(state.Resources.Users, model.UsersResultBuilder().WithResources(restored).Build())
+
+	restoredState := *state
+	restoredState.Resources = &resources
+
+	return &restoredState, tombstones
+}
+
+// purgeTombstones deletes from the SCIM side the users whose tombstone grace period expired
+// and returns the tombstones still alive. When the soft delete is disabled, after being enabled
+// in previous syncs, all the deactivated users are deleted, as any other user removed from the
+// identity provider is.
+func purgeTombstones(
+	ctx context.Context,
+	scim SCIMService,
+	tombstones []*model.Tombstone,
+	softDelete bool,
+	now time.Time,
+	gracePeriod time.Duration,
+) ([]*model.Tombstone, error) {
+	alive := make([]*model.Tombstone, 0, len(tombstones))
+	expired := make([]*model.User, 0)
+
+	for _, tombstone := range tombstones {
+		if !softDelete || tombstone.Expired(now, gracePeriod) {
+			expired = append(expired, tombstone.User)
+			continue
+		}
+		alive = append(alive, tombstone)
+	}
+
+	if len(expired) == 0 {
+		slog.Info("no deactivated users to be deleted")
+		return alive, nil
+	}
+
+	if softDelete {
+		slog.Warn("deleting deactivated users, grace period expired",
+			"users", len(expired),
+			"grace_period", gracePeriod.String(),
+		)
+	} else {
+		slog.Warn("deleting deactivated users, users soft delete is disabled", "users", len(expired))
+	}
+
+	if err := scim.DeleteUsers(ctx, model.UsersResultBuilder().WithResources(expired).Build()); err != nil {
+		return nil, fmt.Errorf("error deleting deactivated users: %w", err)
+	}
+
+	return alive, nil
+}
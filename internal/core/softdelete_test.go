@@ -0,0 +1,268 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/core"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSyncService_UsersSoftDelete(t *testing.T) {
+	ctx := context.TODO()
+
+	group1 := model.GroupBuilder().WithIPID("group-1").WithName("group 1").WithSCIMID("scim-group-1").Build()
+	groups := model.GroupsResultBuilder().WithResources([]*model.Group{group1}).Build()
+	newUser := func(id string, active bool) *model.User {
+		return model.UserBuilder().
+			WithIPID(id).
+			WithSCIMID("scim-" + id).
+			WithUserName(id + "@mail.com").
+			WithDisplayName(id).
+			WithName(model.NameBuilder().WithGivenName("user").WithFamilyName(id).Build()).
+			WithEmail(model.EmailBuilder().WithValue(id + "@mail.com").WithType("work").WithPrimary(true).Build()).
+			WithActive(active).
+			Build()
+	}
+	emptyGroupsMembers := model.GroupsMembersResultBuilder().Build()
+	lastSync := time.Now().Add(-time.Hour).Format(time.RFC3339)
+
+	t.Run("users removed from the identity provider are deactivated", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		user1, user2 := newUser("user-1", true), newUser("user-2", true)
+		idpUsers := model.UsersResultBuilder().WithResources([]*model.User{newUser("user-1", true)}).Build()
+
+		state := model.StateBuilder().
+			WithLastSync(lastSync).
+			WithGroups(groups).
+			WithUsers(model.UsersResultBuilder().WithResources([]*model.User{user1, user2}).Build()).
+			WithGroupsMembers(emptyGroupsMembers).
+			Build()
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(groups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, groups).Return(emptyGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, emptyGroupsMembers).Return(idpUsers, nil).Times(1)
+		mockStateRepository.EXPECT().GetState(ctx).Return(state, nil).Times(1)
+
+		mockSCIMService.EXPECT().DeleteUsers(gomock.Any(), gomock.Any()).Times(0)
+		mockSCIMService.EXPECT().UpdateUsers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+				assert.Equal(t, 1, ur.Items)
+				assert.Equal(t, "scim-user-2", ur.Resources[0].SCIMID)
+				assert.False(t, ur.Resources[0].Active)
+				return ur, nil
+			}).Times(1)
+
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				assert.Equal(t, 1, state.Resources.Users.Items)
+				assert.Equal(t, 1, len(state.Resources.Tombstones))
+				assert.Equal(t, "scim-user-2", state.Resources.Tombstones[0].User.SCIMID)
+				assert.NotEmpty(t, state.Resources.Tombstones[0].DeactivatedAt)
+				return nil
+			}).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository, WithUsersSoftDelete(0))
+		assert.NoError(t, err)
+
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("deactivated users are deleted when the grace period expires", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		user1 := newUser("user-1", true)
+		idpUsers := model.UsersResultBuilder().WithResources([]*model.User{newUser("user-1", true)}).Build()
+
+		state := model.StateBuilder().
+			WithLastSync(lastSync).
+			WithGroups(groups).
+			WithUsers(model.UsersResultBuilder().WithResources([]*model.User{user1}).Build()).
+			WithGroupsMembers(emptyGroupsMembers).
+			WithTombstones([]*model.Tombstone{
+				{User: newUser("user-2", false), DeactivatedAt: time.Now().Add(-48 * time.Hour).Format(time.RFC3339)},
+				{User: newUser("user-3", false), DeactivatedAt: time.Now().Add(-1 * time.Hour).Format(time.RFC3339)},
+			}).
+			Build()
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(groups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, groups).Return(emptyGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, emptyGroupsMembers).Return(idpUsers, nil).Times(1)
+		mockStateRepository.EXPECT().GetState(ctx).Return(state, nil).Times(1)
+
+		mockSCIMService.EXPECT().DeleteUsers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, ur *model.UsersResult) error {
+				assert.Equal(t, 1, ur.Items)
+				assert.Equal(t, "scim-user-2", ur.Resources[0].SCIMID)
+				return nil
+			}).Times(1)
+
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				assert.Equal(t, 1, len(state.Resources.Tombstones))
+				assert.Equal(t, "scim-user-3", state.Resources.Tombstones[0].User.SCIMID)
+				return nil
+			}).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository, WithUsersSoftDelete(24*time.Hour))
+		assert.NoError(t, err)
+
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("deactivated users are deleted when the soft delete is disabled", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		user1 := newUser("user-1", true)
+		idpUsers := model.UsersResultBuilder().WithResources([]*model.User{newUser("user-1", true)}).Build()
+
+		state := model.StateBuilder().
+			WithLastSync(lastSync).
+			WithGroups(groups).
+			WithUsers(model.UsersResultBuilder().WithResources([]*model.User{user1}).Build()).
+			WithGroupsMembers(emptyGroupsMembers).
+			WithTombstones([]*model.Tombstone{
+				{User: newUser("user-2", false), DeactivatedAt: time.Now().Add(-48 * time.Hour).Format(time.RFC3339)},
+				{User: newUser("user-3", false), DeactivatedAt: time.Now().Add(-1 * time.Hour).Format(time.RFC3339)},
+			}).
+			Build()
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(groups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, groups).Return(emptyGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, emptyGroupsMembers).Return(idpUsers, nil).Times(1)
+		mockStateRepository.EXPECT().GetState(ctx).Return(state, nil).Times(1)
+
+		mockSCIMService.EXPECT().UpdateUsers(gomock.Any(), gomock.Any()).Times(0)
+		mockSCIMService.EXPECT().DeleteUsers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, ur *model.UsersResult) error {
+				assert.Equal(t, 2, ur.Items)
+				assert.Equal(t, "scim-user-2", ur.Resources[0].SCIMID)
+				assert.Equal(t, "scim-user-3", ur.Resources[1].SCIMID)
+				return nil
+			}).Times(1)
+
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				assert.Equal(t, 1, state.Resources.Users.Items)
+				assert.Equal(t, 0, len(state.Resources.Tombstones))
+				return nil
+			}).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository)
+		assert.NoError(t, err)
+
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("deactivated users that come back are reactivated", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		user1 := newUser("user-1", true)
+		idpUser2 := newUser("user-2", true)
+		idpUser2.SCIMID = ""
+		idpUser2.SetHashCode()
+		idpUsers := model.UsersResultBuilder().WithResources([]*model.User{newUser("user-1", true), idpUser2}).Build()
+
+		state := model.StateBuilder().
+			WithLastSync(lastSync).
+			WithGroups(groups).
+			WithUsers(model.UsersResultBuilder().WithResources([]*model.User{user1}).Build()).
+			WithGroupsMembers(emptyGroupsMembers).
+			WithTombstones([]*model.Tombstone{
+				{User: newUser("user-2", false), DeactivatedAt: time.Now().Add(-1 * time.Hour).Format(time.RFC3339)},
+			}).
+			Build()
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(groups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, groups).Return(emptyGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, emptyGroupsMembers).Return(idpUsers, nil).Times(1)
+		mockStateRepository.EXPECT().GetState(ctx).Return(state, nil).Times(1)
+
+		mockSCIMService.EXPECT().CreateUsers(gomock.Any(), gomock.Any()).Times(0)
+		mockSCIMService.EXPECT().DeleteUsers(gomock.Any(), gomock.Any()).Times(0)
+		mockSCIMService.EXPECT().UpdateUsers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+				assert.Equal(t, 1, ur.Items)
+				assert.Equal(t, "scim-user-2", ur.Resources[0].SCIMID)
+				assert.True(t, ur.Resources[0].Active)
+				return ur, nil
+			}).Times(1)
+
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				assert.Equal(t, 2, state.Resources.Users.Items)
+				assert.Equal(t, 0, len(state.Resources.Tombstones))
+				return nil
+			}).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository, WithUsersSoftDelete(24*time.Hour))
+		assert.NoError(t, err)
+
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("plan records the deactivations", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		state := model.StateBuilder().
+			WithLastSync(lastSync).
+			WithGroups(groups).
+			WithUsers(model.UsersResultBuilder().WithResources([]*model.User{newUser("user-1", true)}).Build()).
+			WithGroupsMembers(emptyGroupsMembers).
+			Build()
+
+		emptyUsers := model.UsersResultBuilder().Build()
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(groups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, groups).Return(emptyGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, emptyGroupsMembers).Return(emptyUsers, nil).Times(1)
+		mockStateRepository.EXPECT().GetState(ctx).Return(state, nil).Times(1)
+		mockStateRepository.EXPECT().SetState(gomock.Any(), gomock.Any()).Times(0)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository, WithUsersSoftDelete(0))
+		assert.NoError(t, err)
+
+		plans, err := svc.PlanGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(plans))
+
+		plan := plans[0]
+		assert.Equal(t, 0, len(plan.Users.Delete))
+		assert.Equal(t, 0, len(plan.Users.Update))
+		assert.Equal(t, 1, len(plan.Users.Deactivate))
+		assert.False(t, plan.Users.Deactivate[0].Active)
+	})
+}
@@ -10,7 +10,11 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/slashdevops/idp-scim-sync/internal/model"
 	"github.com/slashdevops/idp-scim-sync/internal/repository"
+	"github.com/slashdevops/idp-scim-sync/internal/tracing"
 	"github.com/slashdevops/idp-scim-sync/internal/version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -26,11 +30,26 @@ var (
 
 // SyncService represent the sync service and the core of the sync process
 type SyncService struct {
-	provGroupsFilter []string
-	provUsersFilter  []string
-	prov             IdentityProviderService
-	scim             SCIMService
-	repo             StateRepository
+	provGroupsFilter   []string
+	provUsersFilter    []string
+	prov               IdentityProviderService
+	targets            []*SyncTarget
+	deletionThresholds DeletionThresholds
+	force              bool
+
+	usersSoftDelete            bool
+	usersSoftDeleteGracePeriod time.Duration
+
+	partialFailures            bool
+	partialFailuresConcurrency int
+
+	checkpoints      bool
+	checkpointsEvery int
+
+	runLock    bool
+	runLockTTL time.Duration
+
+	tracerProvider trace.TracerProvider
 }
 
 // NewSyncService creates a new sync service.
@@ -45,79 +64,337 @@ func NewSyncService(prov IdentityProviderService, scim SCIMService, repo StateRe
 		return nil, ErrStateRepositoryNil
 	}
 
+	return newSyncService(prov, []*SyncTarget{{Name: DefaultSyncTargetName, SCIM: scim, Repo: repo}}, opts...), nil
+}
+
+// NewMultiTargetSyncService creates a new sync service that syncs the identity provider data into several targets.
+// The identity provider data is retrieved once and reconciled into every target, one target failing
+// doesn't stop the sync of the others.
+func NewMultiTargetSyncService(prov IdentityProviderService, targets []SyncTarget, opts ...SyncServiceOption) (*SyncService, error) {
+	if prov == nil {
+		return nil, ErrIdentityProviderServiceNil
+	}
+	if err := validateSyncTargets(targets); err != nil {
+		return nil, err
+	}
+
+	ssTargets := make([]*SyncTarget, 0, len(targets))
+	for _, target := range targets {
+		ssTargets = append(ssTargets, &target)
+	}
+
+	return newSyncService(prov, ssTargets, opts...), nil
+}
+
+// newSyncService creates a new sync service with the given targets and applies the options.
+func newSyncService(prov IdentityProviderService, targets []*SyncTarget, opts ...SyncServiceOption) *SyncService {
 	ss := &SyncService{
 		prov:             prov,
 		provGroupsFilter: []string{}, // fill in with the opts
 		provUsersFilter:  []string{}, // fill in with the opts
-		scim:             scim,
-		repo:             repo,
+		targets:          targets,
 	}
 
 	for _, opt := range opts {
 		opt(ss)
 	}
 
-	return ss, nil
+	return ss
 }
 
+// idpDataFunc is the function used by the sync methods to retrieve the groups,
+// users and groups members from the given identity provider.
+type idpDataFunc func(ctx context.Context, prov IdentityProviderService) (*model.GroupsResult, *model.UsersResult, *model.GroupsMembersResult, error)
+
 // SyncGroupsAndTheirMembers the default sync method tha syncs groups and their members
-func (ss *SyncService) SyncGroupsAndTheirMembers(ctx context.Context) error {
-	slog.Info("getting identity provider data", "group_filter", ss.provGroupsFilter)
+func (ss *SyncService) SyncGroupsAndTheirMembers(ctx context.Context) (*SyncResult, error) {
+	return ss.sync(ctx, "SyncGroupsAndTheirMembers", ss.getIdentityProviderData)
+}
 
-	idpGroupsResult, err := ss.prov.GetGroups(ctx, ss.provGroupsFilter)
-	if err != nil {
-		return fmt.Errorf("error getting groups from the identity provider: %w", err)
+// SyncUsersAndGroups syncs all the users that match the users filter, even if they are not members
+// of any group, and the groups and their members that match the groups filter.
+func (ss *SyncService) SyncUsersAndGroups(ctx context.Context) (*SyncResult, error) {
+	return ss.sync(ctx, "SyncUsersAndGroups", ss.getIdentityProviderUsersData)
+}
+
+// sync reconciles the SCIM side of every target with the identity provider data returned by idpData
+// and stores the new state of every target. The result of the sync is returned even when it fails.
+// When the sync service has only one target its error is returned as it is, otherwise an
+// *ErrSyncTargetsFailed error with the failed targets is returned.
+// The sync is traced in a span named after the sync method, the parent of the spans of every phase.
+func (ss *SyncService) sync(ctx context.Context, method string, idpData idpDataFunc) (_ *SyncResult, err error) {
+	tp := ss.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
 	}
 
-	slog.Info("groups retrieved from the identity provider for syncing that match the filter",
-		"group_filter", ss.provGroupsFilter,
-		"groups", idpGroupsResult.Items,
+	ctx, span := tracing.StartWithProvider(ctx, tp, "core."+method,
+		attribute.String("sync.method", method),
+		attribute.Int("sync.targets", len(ss.targets)),
 	)
+	defer func() { tracing.End(span, err) }()
+
+	start := time.Now()
+	result := newSyncResult(start)
 
-	idpGroupsMembersResult, err := ss.prov.GetGroupsMembers(ctx, idpGroupsResult)
+	ctx, unlock, err := ss.lockTargets(ctx)
 	if err != nil {
-		return fmt.Errorf("error getting groups members: %w", err)
+		result.finish(start)
+		return result, err
 	}
+	defer func() {
+		if lockErr := unlock(); lockErr != nil {
+			err = errors.Join(err, lockErr)
+		}
+	}()
 
-	slog.Info("groups members retrieved from the identity provider for syncing that match the filter",
-		"group_filter", ss.provGroupsFilter,
-		"groups", idpGroupsResult.Items,
-	)
+	// the time waiting for the lock is not part of the identity provider phase
+	idpStart := time.Now()
+	calls := newMethodCalls()
+	idpCtx, idpSpan := tracing.Start(ctx, "core.getIdentityProviderData")
+	idpGroupsResult, idpUsersResult, idpGroupsMembersResult, err := idpData(idpCtx, newMethodCallsIdentityProviderService(ss.prov, calls))
+	result.IdentityProvider.DurationMs = time.Since(idpStart).Milliseconds()
+	result.IdentityProvider.MethodCalls = calls.counts()
+	if err != nil {
+		tracing.End(idpSpan, err)
+		result.finish(start)
+		return result, err
+	}
 
-	slog.Info("getting users (using groups members) from the identity provider",
-		"group_filter", ss.provGroupsFilter,
+	result.IdentityProvider.Groups = idpGroupsResult.Items
+	result.IdentityProvider.Users = idpUsersResult.Items
+	result.IdentityProvider.GroupsMembers = countMembers(idpGroupsMembersResult.Resources)
+
+	idpSpan.SetAttributes(
+		attribute.Int("idp.groups", result.IdentityProvider.Groups),
+		attribute.Int("idp.users", result.IdentityProvider.Users),
+		attribute.Int("idp.groups_members", result.IdentityProvider.GroupsMembers),
 	)
+	tracing.End(idpSpan, nil)
 
-	idpUsersResult, err := ss.prov.GetUsersByGroupsMembers(ctx, idpGroupsMembersResult)
+	for _, target := range ss.targets {
+		targetResult := ss.syncTarget(ctx, target, idpGroupsResult, idpUsersResult, idpGroupsMembersResult)
+		if targetResult.Err != nil {
+			slog.Error("sync failed", "target", target.Name, "error", targetResult.Err)
+			targetResult.Error = targetResult.Err.Error()
+		}
+
+		result.Targets = append(result.Targets, targetResult)
+	}
+	result.finish(start)
+
+	return result, ss.targetsError(result.Targets)
+}
+
+// syncTarget reconciles the SCIM side of the target with the identity provider data
+// and stores the new state of the target.
+func (ss *SyncService) syncTarget(
+	ctx context.Context,
+	target *SyncTarget,
+	idpGroupsResult *model.GroupsResult,
+	idpUsersResult *model.UsersResult,
+	idpGroupsMembersResult *model.GroupsMembersResult,
+) *SyncTargetResult {
+	start := time.Now()
+	calls := newMethodCalls()
+	changes := newSyncChanges()
+	result := &SyncTargetResult{Target: target.Name, Changes: changes}
+
+	ctx, span := tracing.Start(ctx, "core.syncTarget", attribute.String("sync.target", target.Name))
+
+	defer func() {
+		result.MethodCalls = calls.counts()
+		result.DurationMs = time.Since(start).Milliseconds()
+
+		span.SetAttributes(
+			attribute.String("state.hash_before", result.StateHashBefore),
+			attribute.String("state.hash_after", result.StateHashAfter),
+			attribute.Int("groups", result.Groups),
+			attribute.Int("users", result.Users),
+			attribute.Int("groups_members", result.GroupsMembers),
+		)
+		tracing.End(span, result.Err)
+	}()
+
+	// all the calls to the SCIM side of the target are counted, and the SCIM side is only read
+	// once when the deletion thresholds are checked before the reconciliation
+	scim := newCachedReadsSCIMService(newMethodCallsSCIMService(target.SCIM, calls))
+
+	slog.Info("syncing target", "target", target.Name, "groups_filter", target.GroupsFilter)
+
+	idpGroupsResult, idpUsersResult, idpGroupsMembersResult = ss.targetData(target, idpGroupsResult, idpUsersResult, idpGroupsMembersResult)
+
+	state, err := ss.getState(ctx, target.Repo)
 	if err != nil {
-		return fmt.Errorf("error getting users from the identity provider: %w", err)
+		result.Err = err
+		return result
 	}
+	result.StateHashBefore = state.HashCode
 
-	slog.Info("users retrieved from the identity provider for syncing that match the filter",
-		"group_filter", ss.provGroupsFilter,
-		"users", idpUsersResult.Items,
-	)
+	if err := ss.checkDeletionThresholds(ctx, scim, state, idpGroupsResult, idpUsersResult, idpGroupsMembersResult); err != nil {
+		result.Err = err
+		return result
+	}
 
-	slog.Info("getting state data")
-	state, err := ss.repo.GetState(ctx)
+	var report *SyncReport
+	if ss.partialFailures {
+		report = &SyncReport{Failures: make([]*ResourceFailure, 0)}
+		result.Report = report
+	}
+
+	newState, err := ss.reconcile(ctx, scim, target.Repo, state, idpGroupsResult, idpUsersResult, idpGroupsMembersResult, report, changes)
 	if err != nil {
-		var nsk *types.NoSuchKey
-		var StateFileEmpty *repository.ErrStateFileEmpty
+		result.Err = err
+		return result
+	}
 
-		if errors.As(err, &nsk) || errors.As(err, &StateFileEmpty) {
-			slog.Warn("no state file found in the state repository, creating a new one")
-			state = model.StateBuilder().Build()
-		} else {
-			return fmt.Errorf("error getting state data from the repository: %w", err)
+	slog.Info("storing the new state",
+		"target", target.Name,
+		"lastSync", newState.LastSync,
+		"groups", newState.Resources.Groups.Items,
+		"users", newState.Resources.Users.Items,
+		"tombstones", len(newState.Resources.Tombstones),
+	)
+
+	if err := ss.setState(ctx, target.Repo, newState); err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.StateHashAfter = newState.HashCode
+	result.Groups = newState.Resources.Groups.Items
+	result.Users = newState.Resources.Users.Items
+	result.GroupsMembers = countMembers(newState.Resources.GroupsMembers.Resources)
+
+	changes.Groups.setEqual(result.Groups)
+	changes.Users.setEqual(result.Users)
+	changes.GroupsMembers.setEqual(result.GroupsMembers)
+
+	if err := partialFailuresError(report); err != nil {
+		slog.Warn("sync completed with failed resources, the state was stored without them",
+			"target", target.Name,
+			"failures", len(report.Failures),
+		)
+		result.Err = err
+		return result
+	}
+
+	slog.Info("sync completed",
+		"target", target.Name,
+		"date", time.Now().Format(time.RFC3339),
+	)
+	return result
+}
+
+// targetData returns the identity provider data to reconcile into the target, only with the groups
+// that match the groups filter of the target. When the sync service has more than one target
+// the data is copied, so the SCIM ids of a target are not visible to the others.
+func (ss *SyncService) targetData(
+	target *SyncTarget,
+	idpGroupsResult *model.GroupsResult,
+	idpUsersResult *model.UsersResult,
+	idpGroupsMembersResult *model.GroupsMembersResult,
+) (*model.GroupsResult, *model.UsersResult, *model.GroupsMembersResult) {
+	idpGroupsResult, idpUsersResult, idpGroupsMembersResult = filterTargetData(target.GroupsFilter, idpGroupsResult, idpUsersResult, idpGroupsMembersResult)
+
+	if len(ss.targets) == 1 {
+		return idpGroupsResult, idpUsersResult, idpGroupsMembersResult
+	}
+
+	return copyIdentityProviderData(idpGroupsResult, idpUsersResult, idpGroupsMembersResult)
+}
+
+// targetsError returns the error of the failed targets, when the sync service has only one
+// target its error is returned as it is.
+func (ss *SyncService) targetsError(results []*SyncTargetResult) error {
+	if len(ss.targets) == 1 {
+		return results[0].Err
+	}
+
+	failed := make([]*SyncTargetResult, 0)
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result)
 		}
 	}
 
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return &ErrSyncTargetsFailed{Failed: failed, Total: len(results)}
+}
+
+// reconcile aligns the SCIM side, using the given SCIM service, with the identity provider data
+// and returns the new state, it doesn't store the new state.
+// When report is not nil the resources that fail in the SCIM side are collected in it
+// instead of stopping the reconciliation, when changes is not nil the changes applied in
+// the SCIM side are recorded in it, and when repo is not nil the checkpoints of
+// the first sync are stored in it.
+func (ss *SyncService) reconcile(
+	ctx context.Context,
+	scim SCIMService,
+	repo StateRepository,
+	state *model.State,
+	idpGroupsResult *model.GroupsResult,
+	idpUsersResult *model.UsersResult,
+	idpGroupsMembersResult *model.GroupsMembersResult,
+	report *SyncReport,
+	changes *SyncChanges,
+) (_ *model.State, err error) {
+	ctx, span := tracing.Start(ctx, "core.reconcile", attribute.Bool("sync.first", state.LastSync == ""))
+	defer func() { tracing.End(span, err) }()
+
 	var (
 		totalGroupsResult        *model.GroupsResult
 		totalUsersResult         *model.UsersResult
 		totalGroupsMembersResult *model.GroupsMembersResult
+		softDeleteSCIM           *softDeleteSCIMService
 	)
 
+	// users deactivated in previous syncs that came back to the identity provider
+	// are reactivated instead of created
+	state, tombstones := restoreTombstones(state, idpUsersResult)
+
+	// the tombstones left by a soft delete disabled since then are purged too
+	now := time.Now()
+	if ss.usersSoftDelete || len(tombstones) > 0 {
+		purgeSCIM := scim
+		if changes != nil {
+			purgeSCIM = newChangesSCIMService(scim, changes, false)
+		}
+
+		tombstones, err = purgeTombstones(ctx, purgeSCIM, tombstones, ss.usersSoftDelete, now, ss.usersSoftDeleteGracePeriod)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if ss.usersSoftDelete {
+		softDeleteSCIM = newSoftDeleteSCIMService(scim, now)
+		scim = softDeleteSCIM
+	}
+
+	// it must wrap the soft delete SCIM service, so the deleted users are recorded as deactivated
+	if changes != nil {
+		scim = newChangesSCIMService(scim, changes, ss.usersSoftDelete)
+	}
+
+	// the checkpoints are only stored in the first sync, a checkpoint found in the state resumes it
+	var cp *checkpointer
+	if repo != nil && ss.checkpoints && state.LastSync == "" {
+		cp = newCheckpointer(repo, ss.checkpointsEvery)
+
+		if ss.checkpointsEvery > 0 {
+			scim = newCheckpointSCIMService(scim, cp)
+		}
+	}
+
+	// it must wrap the soft delete SCIM service, so only the users deactivated are tombstoned
+	if report != nil {
+		scim = newPartialFailuresSCIMService(scim, ss.partialFailuresConcurrency, report)
+	}
+
 	// first time syncing
 	if state.LastSync == "" {
 		// Check SCIM side to see if there are elements to be reconciled.
@@ -128,32 +405,46 @@ func (ss *SyncService) SyncGroupsAndTheirMembers(ctx context.Context) error {
 		// - Groups names are equals on both sides, update only the external id (coming from the identity provider)
 		// - Users emails are equals on both sides, update only the external id (coming from the identity provider)
 		slog.Info("syncing from scim service, first time syncing")
+		if state.Checkpoint != nil {
+			slog.Warn("resuming the first sync from a checkpoint",
+				"phase", state.Checkpoint.Phase,
+				"completed", state.Checkpoint.Completed,
+				"created_at", state.Checkpoint.CreatedAt,
+			)
+		}
+
 		totalGroupsResult, totalUsersResult, totalGroupsMembersResult, err = scimSync(
 			ctx,
-			ss.scim,
+			scim,
 			idpGroupsResult,
 			idpUsersResult,
 			idpGroupsMembersResult,
+			state,
+			cp,
 		)
 		if err != nil {
-			return fmt.Errorf("error doing the first sync: %w", err)
+			return nil, fmt.Errorf("error doing the first sync: %w", err)
 		}
 	} else {
 		slog.Info("syncing from state, it's not the first time syncing")
 		totalGroupsResult, totalUsersResult, totalGroupsMembersResult, err = stateSync(
 			ctx,
 			state,
-			ss.scim,
+			scim,
 			idpGroupsResult,
 			idpUsersResult,
 			idpGroupsMembersResult,
 		)
 
 		if err != nil {
-			return fmt.Errorf("error syncing state: %w", err)
+			return nil, fmt.Errorf("error syncing state: %w", err)
 		}
 	}
 
+	if softDeleteSCIM != nil {
+		tombstones = append(tombstones, softDeleteSCIM.tombstones...)
+	}
+
 	// after be sure all the SCIM side is aligned with the identity provider side
 	// we can update the state with the last data coming from the reconciliation
 	newState := model.StateBuilder().
@@ -162,20 +453,175 @@ func (ss *SyncService) SyncGroupsAndTheirMembers(ctx context.Context) error {
 		WithGroups(totalGroupsResult).
 		WithUsers(totalUsersResult).
 		WithGroupsMembers(totalGroupsMembersResult).
+		WithTombstones(tombstones).
 		Build()
 
-	slog.Info("storing the new state",
-		"lastSync", newState.LastSync,
-		"groups", totalGroupsResult.Items,
-		"users", totalUsersResult.Items,
+	return newState, nil
+}
+
+// getIdentityProviderData returns the groups, users and groups members from the identity provider
+// that match the configured filters.
+func (ss *SyncService) getIdentityProviderData(ctx context.Context, prov IdentityProviderService) (*model.GroupsResult, *model.UsersResult, *model.GroupsMembersResult, error) {
+	slog.Info("getting identity provider data", "group_filter", ss.provGroupsFilter)
+
+	idpGroupsResult, err := prov.GetGroups(ctx, ss.provGroupsFilter)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error getting groups from the identity provider: %w", err)
+	}
+
+	slog.Info("groups retrieved from the identity provider for syncing that match the filter",
+		"group_filter", ss.provGroupsFilter,
+		"groups", idpGroupsResult.Items,
 	)
 
-	if err := ss.repo.SetState(ctx, newState); err != nil {
+	idpGroupsMembersResult, err := prov.GetGroupsMembers(ctx, idpGroupsResult)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error getting groups members: %w", err)
+	}
+
+	slog.Info("groups members retrieved from the identity provider for syncing that match the filter",
+		"group_filter", ss.provGroupsFilter,
+		"groups", idpGroupsResult.Items,
+	)
+
+	slog.Info("getting users (using groups members) from the identity provider",
+		"group_filter", ss.provGroupsFilter,
+	)
+
+	idpUsersResult, err := prov.GetUsersByGroupsMembers(ctx, idpGroupsMembersResult)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error getting users from the identity provider: %w", err)
+	}
+
+	slog.Info("users retrieved from the identity provider for syncing that match the filter",
+		"group_filter", ss.provGroupsFilter,
+		"users", idpUsersResult.Items,
+	)
+
+	return idpGroupsResult, idpUsersResult, idpGroupsMembersResult, nil
+}
+
+// getState returns the state stored in the state repository,
+// or a new empty state when the repository doesn't have one yet.
+func (ss *SyncService) getState(ctx context.Context, repo StateRepository) (_ *model.State, err error) {
+	ctx, span := tracing.Start(ctx, "core.getState")
+	defer func() { tracing.End(span, err) }()
+
+	slog.Info("getting state data")
+	state, err := repo.GetState(ctx)
+	if err != nil {
+		var nsk *types.NoSuchKey
+		var StateFileEmpty *repository.ErrStateFileEmpty
+		var stateNotFound *repository.ErrStateNotFound
+
+		if errors.As(err, &nsk) || errors.As(err, &StateFileEmpty) || errors.As(err, &stateNotFound) {
+			slog.Warn("no state file found in the state repository, creating a new one")
+			state = model.StateBuilder().Build()
+		} else {
+			return nil, fmt.Errorf("error getting state data from the repository: %w", err)
+		}
+	}
+
+	span.SetAttributes(attribute.String("state.hash", state.HashCode), attribute.String("state.last_sync", state.LastSync))
+
+	return state, nil
+}
+
+// setState stores the new state in the state repository.
+func (ss *SyncService) setState(ctx context.Context, repo StateRepository, state *model.State) (err error) {
+	ctx, span := tracing.Start(ctx, "core.setState", attribute.String("state.hash", state.HashCode))
+	defer func() { tracing.End(span, err) }()
+
+	if err := repo.SetState(ctx, state); err != nil {
 		return fmt.Errorf("error storing the state: %w", err)
 	}
 
-	slog.Info("sync completed",
-		"date", time.Now().Format(time.RFC3339),
+	return nil
+}
+
+// getIdentityProviderUsersData returns the same data as getIdentityProviderData plus the users
+// that match the users filter, so users without groups membership are synced too.
+func (ss *SyncService) getIdentityProviderUsersData(ctx context.Context, prov IdentityProviderService) (*model.GroupsResult, *model.UsersResult, *model.GroupsMembersResult, error) {
+	idpGroupsResult, idpGroupsUsersResult, idpGroupsMembersResult, err := ss.getIdentityProviderData(ctx, prov)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	slog.Info("getting users (using users filter) from the identity provider",
+		"user_filter", ss.provUsersFilter,
+	)
+
+	idpFilteredUsersResult, err := prov.GetUsers(ctx, ss.provUsersFilter)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error getting users from the identity provider: %w", err)
+	}
+
+	slog.Info("users retrieved from the identity provider for syncing that match the filter",
+		"user_filter", ss.provUsersFilter,
+		"users", idpFilteredUsersResult.Items,
 	)
+
+	idpUsersResult := mergeUniqueUsersResult(idpGroupsUsersResult, idpFilteredUsersResult)
+
+	slog.Info("users retrieved from the identity provider for syncing (groups members and users filter)",
+		"users", idpUsersResult.Items,
+	)
+
+	return idpGroupsResult, idpUsersResult, idpGroupsMembersResult, nil
+}
+
+// mergeUniqueUsersResult merges the given users results avoiding duplicated users,
+// the first occurrence of a user (by identity provider id) is the one kept.
+func mergeUniqueUsersResult(urs ...*model.UsersResult) *model.UsersResult {
+	uniqUsers := make(map[string]struct{})
+	users := make([]*model.User, 0)
+
+	for _, ur := range urs {
+		for _, user := range ur.Resources {
+			if _, ok := uniqUsers[user.IPID]; ok {
+				continue
+			}
+			uniqUsers[user.IPID] = struct{}{}
+
+			users = append(users, user)
+		}
+	}
+
+	return model.UsersResultBuilder().WithResources(users).Build()
+}
+
+// checkDeletionThresholds computes the changes of the sync without applying them and returns an
+// *ErrDeletionThresholdExceeded error when the deletions are over the configured thresholds.
+// Nothing is checked when there are no thresholds or the force option is enabled. The given
+// SCIMService should cache its reads, so the reconciliation doesn't read the SCIM side again.
+func (ss *SyncService) checkDeletionThresholds(
+	ctx context.Context,
+	scim SCIMService,
+	state *model.State,
+	idpGroupsResult *model.GroupsResult,
+	idpUsersResult *model.UsersResult,
+	idpGroupsMembersResult *model.GroupsMembersResult,
+) error {
+	if !ss.deletionThresholds.enabled() {
+		return nil
+	}
+
+	if ss.force {
+		slog.Warn("force enabled, the deletion thresholds are not checked")
+		return nil
+	}
+
+	slog.Info("checking deletion thresholds")
+
+	plan, current, err := ss.computePlan(ctx, scim, state, idpGroupsResult, idpUsersResult, idpGroupsMembersResult)
+	if err != nil {
+		return fmt.Errorf("error computing the changes to check the deletion thresholds: %w", err)
+	}
+
+	if err := checkDeletionThresholds(ss.deletionThresholds, plan, current); err != nil {
+		slog.Error("sync aborted, nothing was changed in the SCIM side and the state was not stored", "error", err)
+		return err
+	}
+
 	return nil
 }
@@ -3,6 +3,7 @@ package core
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -103,7 +104,7 @@ func TestSyncService_SyncGroupsAndTheirMembers(t *testing.T) {
 
 		svc := createService(t, ctx, svrIDP, svrSCIM, stateFile)
 
-		err = svc.SyncGroupsAndTheirMembers(ctx)
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
 		assert.NoError(t, err)
 
 		// check if state file is created
@@ -233,6 +234,13 @@ func TestSyncService_SyncGroupsAndTheirMembers(t *testing.T) {
 		user2JSONBytes, err := user2.MarshalJSON()
 		assert.NoError(t, err)
 
+		usersList := &admin.Users{
+			Kind:  "directory#users",
+			Users: []*admin.User{user1, user2},
+		}
+		usersListJSONBytes, err := usersList.MarshalJSON()
+		assert.NoError(t, err)
+
 		createGroup1Response := &aws.CreateGroupResponse{
 			ID: "group-1",
 			Meta: aws.Meta{
@@ -415,6 +423,8 @@ func TestSyncService_SyncGroupsAndTheirMembers(t *testing.T) {
 				_, _ = w.Write(membersListJSONBytes)
 			case "/admin/directory/v1/groups/group-2/members":
 				_, _ = w.Write(membersListJSONBytes)
+			case "/admin/directory/v1/users":
+				_, _ = w.Write(usersListJSONBytes)
 			case "/admin/directory/v1/users/user.1@mail.com":
 				_, _ = w.Write(user1JSONBytes)
 			case "/admin/directory/v1/users/user.2@mail.com":
@@ -482,7 +492,7 @@ func TestSyncService_SyncGroupsAndTheirMembers(t *testing.T) {
 
 		svc := createService(t, ctx, svrIDP, svrSCIM, stateFile)
 
-		err = svc.SyncGroupsAndTheirMembers(ctx)
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
 		assert.NoError(t, err)
 
 		// check if state file is created
@@ -560,3 +570,117 @@ func createService(
 
 	return svc
 }
+
+func TestSyncService_SyncUsersAndGroups(t *testing.T) {
+	ctx := context.TODO()
+
+	group1 := model.GroupBuilder().WithIPID("group-1").WithName("group 1").WithEmail("group.1@mail.com").Build()
+	user1 := model.UserBuilder().
+		WithIPID("user-1").
+		WithUserName("user.1@mail.com").
+		WithDisplayName("user 1").
+		WithName(model.NameBuilder().WithGivenName("user").WithFamilyName("1").Build()).
+		WithEmail(model.EmailBuilder().WithValue("user.1@mail.com").WithType("work").WithPrimary(true).Build()).
+		WithActive(true).
+		Build()
+	user2 := model.UserBuilder().
+		WithIPID("user-2").
+		WithUserName("user.2@mail.com").
+		WithDisplayName("user 2").
+		WithName(model.NameBuilder().WithGivenName("user").WithFamilyName("2").Build()).
+		WithEmail(model.EmailBuilder().WithValue("user.2@mail.com").WithType("work").WithPrimary(true).Build()).
+		WithActive(true).
+		Build()
+	member1 := model.MemberBuilder().WithIPID("user-1").WithEmail("user.1@mail.com").WithStatus("ACTIVE").Build()
+
+	idpGroups := model.GroupsResultBuilder().WithResources([]*model.Group{group1}).Build()
+	idpGroupsUsers := model.UsersResultBuilder().WithResources([]*model.User{user1}).Build()
+	idpFilteredUsers := model.UsersResultBuilder().WithResources([]*model.User{user1, user2}).Build()
+	idpGroupsMembers := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+		model.GroupMembersBuilder().WithGroup(group1).WithResources([]*model.Member{member1}).Build(),
+	}).Build()
+
+	t.Run("users without groups membership are synced", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		usersFilter := []string{"orgUnitPath='/Engineering'"}
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(idpGroups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, idpGroups).Return(idpGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, idpGroupsMembers).Return(idpGroupsUsers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsers(ctx, usersFilter).Return(idpFilteredUsers, nil).Times(1)
+
+		mockStateRepository.EXPECT().GetState(ctx).Return(model.StateBuilder().Build(), nil).Times(1)
+
+		mockSCIMService.EXPECT().GetGroups(ctx).Return(model.GroupsResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().GetUsers(ctx).Return(model.UsersResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().GetGroupsMembersBruteForce(ctx, gomock.Any(), gomock.Any()).Return(model.GroupsMembersResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().CreateGroups(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+				return gr, nil
+			}).Times(1)
+		mockSCIMService.EXPECT().CreateUsers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+				assert.Equal(t, 2, ur.Items)
+				return ur, nil
+			}).Times(1)
+		mockSCIMService.EXPECT().CreateGroupsMembers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+				return gmr, nil
+			}).Times(1)
+
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				assert.Equal(t, 1, state.Resources.Groups.Items)
+				assert.Equal(t, 2, state.Resources.Users.Items)
+				return nil
+			}).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository, WithIdentityProviderUsersFilter(usersFilter))
+		assert.NoError(t, err)
+
+		_, err = svc.SyncUsersAndGroups(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("error getting users from the identity provider", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(idpGroups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, idpGroups).Return(idpGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, idpGroupsMembers).Return(idpGroupsUsers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsers(ctx, gomock.Any()).Return(nil, errors.New("test error")).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository)
+		assert.NoError(t, err)
+
+		_, err = svc.SyncUsersAndGroups(ctx)
+		assert.Error(t, err)
+	})
+}
+
+func TestMergeUniqueUsersResult(t *testing.T) {
+	user1 := model.UserBuilder().WithIPID("user-1").WithUserName("user.1@mail.com").Build()
+	user2 := model.UserBuilder().WithIPID("user-2").WithUserName("user.2@mail.com").Build()
+	user3 := model.UserBuilder().WithIPID("user-3").WithUserName("user.3@mail.com").Build()
+
+	ur1 := model.UsersResultBuilder().WithResources([]*model.User{user1, user2}).Build()
+	ur2 := model.UsersResultBuilder().WithResources([]*model.User{user2, user3}).Build()
+
+	got := mergeUniqueUsersResult(ur1, ur2)
+	assert.Equal(t, 3, got.Items)
+	assert.Equal(t, []*model.User{user1, user2, user3}, got.Resources)
+
+	got = mergeUniqueUsersResult(model.UsersResultBuilder().Build())
+	assert.Equal(t, 0, got.Items)
+}
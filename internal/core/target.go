@@ -0,0 +1,237 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/slashdevops/idp-scim-sync/internal/deepcopy"
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+)
+
+// DefaultSyncTargetName is the name of the target of the sync services created with NewSyncService.
+const DefaultSyncTargetName = "default"
+
+var (
+	// ErrSyncTargetsEmpty is returned when the sync service doesn't have targets
+	ErrSyncTargetsEmpty = errors.New("sync targets cannot be empty")
+
+	// ErrSyncTargetNameEmpty is returned when a sync target doesn't have a name
+	ErrSyncTargetNameEmpty = errors.New("sync target name cannot be empty")
+
+	// ErrSyncTargetNameDuplicated is returned when more than one sync target has the same name
+	ErrSyncTargetNameDuplicated = errors.New("sync target name is duplicated")
+
+	// ErrSyncTargetGroupsFilterInvalid is returned when a pattern of the groups filter of a sync target is malformed
+	ErrSyncTargetGroupsFilterInvalid = errors.New("sync target groups filter is invalid")
+)
+
+// SyncTarget is a SCIM service where the identity provider data is synced into,
+// every target has its own state.
+type SyncTarget struct {
+	// Name identifies the target in the logs, the results and the errors of the sync
+	Name string
+
+	// SCIM is the SCIM service of the target
+	SCIM SCIMService
+
+	// Repo is the state repository of the target, the targets cannot share the same state
+	Repo StateRepository
+
+	// GroupsFilter are patterns, like "AWS-OrgA-*", matched with the names of the identity provider groups,
+	// only the matching groups and their members are synced into the target. Empty syncs all the groups.
+	GroupsFilter []string
+}
+
+// SyncTargetResult is the result of the sync of one target.
+type SyncTargetResult struct {
+	Target        string `json:"target" yaml:"target"`
+	Groups        int    `json:"groups" yaml:"groups"`
+	Users         int    `json:"users" yaml:"users"`
+	GroupsMembers int    `json:"groupsMembers" yaml:"groupsMembers"`
+	Err           error  `json:"-" yaml:"-"`
+	Error         string `json:"error,omitempty" yaml:"error,omitempty"`
+
+	// Report contains the failed resources when the partial failures are enabled
+	Report *SyncReport `json:"report,omitempty" yaml:"report,omitempty"`
+
+	// Changes are the changes applied in the SCIM side, and MethodCalls the calls
+	// to the SCIM service by method
+	Changes     *SyncChanges   `json:"changes,omitempty" yaml:"changes,omitempty"`
+	MethodCalls map[string]int `json:"methodCalls,omitempty" yaml:"methodCalls,omitempty"`
+
+	// StateHashBefore and StateHashAfter are the hash codes of the state before and after the sync,
+	// StateHashAfter is empty when the new state was not stored
+	StateHashBefore string `json:"stateHashBefore" yaml:"stateHashBefore"`
+	StateHashAfter  string `json:"stateHashAfter" yaml:"stateHashAfter"`
+	DurationMs      int64  `json:"durationMs" yaml:"durationMs"`
+}
+
+// ErrSyncTargetsFailed is returned when the sync of one or more targets of a sync service with
+// several targets fails, the other targets are synced and their state is stored.
+type ErrSyncTargetsFailed struct {
+	Failed []*SyncTargetResult
+	Total  int
+}
+
+func (e *ErrSyncTargetsFailed) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorCode(), e.ErrorMessage())
+}
+
+func (e *ErrSyncTargetsFailed) ErrorMessage() string {
+	errs := make([]string, 0, len(e.Failed))
+	for _, r := range e.Failed {
+		errs = append(errs, fmt.Sprintf("target %s: %s", r.Target, r.Err))
+	}
+
+	return fmt.Sprintf("the sync failed for %d of %d targets, %s", len(e.Failed), e.Total, strings.Join(errs, ", "))
+}
+
+func (e *ErrSyncTargetsFailed) ErrorCode() string { return "ErrSyncTargetsFailed" }
+
+// Unwrap returns the errors of the failed targets, so errors.Is and errors.As can be used with them.
+func (e *ErrSyncTargetsFailed) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, r := range e.Failed {
+		errs = append(errs, r.Err)
+	}
+	return errs
+}
+
+// validateSyncTargets returns an error when the targets are empty, a target doesn't have a name,
+// the name is duplicated, a target doesn't have a SCIM service or a state repository
+// or the groups filter of a target is malformed.
+func validateSyncTargets(targets []SyncTarget) error {
+	if len(targets) == 0 {
+		return ErrSyncTargetsEmpty
+	}
+
+	names := make(map[string]struct{}, len(targets))
+	for _, target := range targets {
+		if target.Name == "" {
+			return ErrSyncTargetNameEmpty
+		}
+		if _, ok := names[target.Name]; ok {
+			return fmt.Errorf("%w: %s", ErrSyncTargetNameDuplicated, target.Name)
+		}
+		names[target.Name] = struct{}{}
+
+		if target.SCIM == nil {
+			return fmt.Errorf("%w, target: %s", ErrSCIMServiceNil, target.Name)
+		}
+		if target.Repo == nil {
+			return fmt.Errorf("%w, target: %s", ErrStateRepositoryNil, target.Name)
+		}
+
+		for _, pattern := range target.GroupsFilter {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%w: %q, target: %s", ErrSyncTargetGroupsFilterInvalid, pattern, target.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchGroupsFilter returns true when the group name matches one of the filter patterns,
+// or when there are no patterns.
+func matchGroupsFilter(name string, filter []string) bool {
+	patterns := 0
+	for _, pattern := range filter {
+		if pattern == "" {
+			continue
+		}
+		patterns++
+
+		// the patterns are validated when the sync service is created
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return patterns == 0
+}
+
+// filterTargetData returns the identity provider groups that match the groups filter of a target with their members,
+// the users that are only members of the excluded groups are excluded too. The users that are not members
+// of any group, synced by the users sync method, are kept.
+func filterTargetData(
+	filter []string,
+	idpGroupsResult *model.GroupsResult,
+	idpUsersResult *model.UsersResult,
+	idpGroupsMembersResult *model.GroupsMembersResult,
+) (*model.GroupsResult, *model.UsersResult, *model.GroupsMembersResult) {
+	// without patterns all the groups match
+	if matchGroupsFilter("", filter) {
+		return idpGroupsResult, idpUsersResult, idpGroupsMembersResult
+	}
+
+	groups := make([]*model.Group, 0, len(idpGroupsResult.Resources))
+	for _, group := range idpGroupsResult.Resources {
+		if matchGroupsFilter(group.Name, filter) {
+			groups = append(groups, group)
+		}
+	}
+
+	includedMembers := make(map[string]struct{})
+	excludedMembers := make(map[string]struct{})
+	groupsMembers := make([]*model.GroupMembers, 0, len(idpGroupsMembersResult.Resources))
+	for _, gm := range idpGroupsMembersResult.Resources {
+		members := excludedMembers
+		if matchGroupsFilter(gm.Group.Name, filter) {
+			members = includedMembers
+			groupsMembers = append(groupsMembers, gm)
+		}
+
+		for _, member := range gm.Resources {
+			members[strings.ToLower(member.Email)] = struct{}{}
+		}
+	}
+
+	users := make([]*model.User, 0, len(idpUsersResult.Resources))
+	for _, user := range idpUsersResult.Resources {
+		email := strings.ToLower(user.GetPrimaryEmailAddress())
+
+		_, included := includedMembers[email]
+		_, excluded := excludedMembers[email]
+		if excluded && !included {
+			continue
+		}
+
+		users = append(users, user)
+	}
+
+	return model.GroupsResultBuilder().WithResources(groups).Build(),
+		model.UsersResultBuilder().WithResources(users).Build(),
+		model.GroupsMembersResultBuilder().WithResources(groupsMembers).Build()
+}
+
+// copyIdentityProviderData returns a copy of the identity provider data, the reconciliation sets
+// the SCIM ids of a target into the groups, users and members, so every target needs its own copy.
+func copyIdentityProviderData(
+	idpGroupsResult *model.GroupsResult,
+	idpUsersResult *model.UsersResult,
+	idpGroupsMembersResult *model.GroupsMembersResult,
+) (*model.GroupsResult, *model.UsersResult, *model.GroupsMembersResult) {
+	groupsResult := *idpGroupsResult
+	groupsResult.Resources = deepcopy.SliceOfPointers(idpGroupsResult.Resources)
+
+	usersResult := *idpUsersResult
+	usersResult.Resources = deepcopy.SliceOfPointers(idpUsersResult.Resources)
+
+	groupsMembersResult := *idpGroupsMembersResult
+	groupsMembersResult.Resources = deepcopy.SliceOfPointers(idpGroupsMembersResult.Resources)
+	for _, gm := range groupsMembersResult.Resources {
+		if gm == nil {
+			continue
+		}
+		if gm.Group != nil {
+			group := *gm.Group
+			gm.Group = &group
+		}
+		gm.Resources = deepcopy.SliceOfPointers(gm.Resources)
+	}
+
+	return &groupsResult, &usersResult, &groupsMembersResult
+}
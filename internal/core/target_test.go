@@ -0,0 +1,369 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/core"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestNewMultiTargetSyncService(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	prov := mocks.NewMockIdentityProviderService(mockCtrl)
+	scim := mocks.NewMockSCIMService(mockCtrl)
+	repo := mocks.NewMockStateRepository(mockCtrl)
+
+	t.Run("valid targets", func(t *testing.T) {
+		svc, err := NewMultiTargetSyncService(prov, []SyncTarget{
+			{Name: "org-a", SCIM: scim, Repo: repo},
+			{Name: "org-b", SCIM: scim, Repo: repo, GroupsFilter: []string{"AWS-OrgB-*"}},
+		})
+		assert.NoError(t, err)
+		assert.NotNil(t, svc)
+		assert.Equal(t, 2, len(svc.targets))
+		assert.Equal(t, "org-a", svc.targets[0].Name)
+		assert.Equal(t, "org-b", svc.targets[1].Name)
+	})
+
+	tests := []struct {
+		name    string
+		prov    IdentityProviderService
+		targets []SyncTarget
+		wantErr error
+	}{
+		{
+			name:    "nil identity provider",
+			prov:    nil,
+			targets: []SyncTarget{{Name: "org-a", SCIM: scim, Repo: repo}},
+			wantErr: ErrIdentityProviderServiceNil,
+		},
+		{
+			name:    "empty targets",
+			prov:    prov,
+			targets: []SyncTarget{},
+			wantErr: ErrSyncTargetsEmpty,
+		},
+		{
+			name:    "empty name",
+			prov:    prov,
+			targets: []SyncTarget{{SCIM: scim, Repo: repo}},
+			wantErr: ErrSyncTargetNameEmpty,
+		},
+		{
+			name: "duplicated name",
+			prov: prov,
+			targets: []SyncTarget{
+				{Name: "org-a", SCIM: scim, Repo: repo},
+				{Name: "org-a", SCIM: scim, Repo: repo},
+			},
+			wantErr: ErrSyncTargetNameDuplicated,
+		},
+		{
+			name:    "nil scim service",
+			prov:    prov,
+			targets: []SyncTarget{{Name: "org-a", Repo: repo}},
+			wantErr: ErrSCIMServiceNil,
+		},
+		{
+			name:    "nil state repository",
+			prov:    prov,
+			targets: []SyncTarget{{Name: "org-a", SCIM: scim}},
+			wantErr: ErrStateRepositoryNil,
+		},
+		{
+			name:    "malformed groups filter",
+			prov:    prov,
+			targets: []SyncTarget{{Name: "org-a", SCIM: scim, Repo: repo, GroupsFilter: []string{"AWS-["}}},
+			wantErr: ErrSyncTargetGroupsFilterInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := NewMultiTargetSyncService(tt.prov, tt.targets)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Nil(t, svc)
+		})
+	}
+}
+
+func TestSyncService_MultiTarget(t *testing.T) {
+	ctx := context.TODO()
+
+	groupA := model.GroupBuilder().WithIPID("group-a").WithName("AWS-OrgA-Admins").WithEmail("group.a@mail.com").Build()
+	groupB := model.GroupBuilder().WithIPID("group-b").WithName("AWS-OrgB-Admins").WithEmail("group.b@mail.com").Build()
+	user1 := model.UserBuilder().
+		WithIPID("user-1").
+		WithUserName("user.1@mail.com").
+		WithDisplayName("user 1").
+		WithName(model.NameBuilder().WithGivenName("user").WithFamilyName("1").Build()).
+		WithEmail(model.EmailBuilder().WithValue("user.1@mail.com").WithType("work").WithPrimary(true).Build()).
+		WithActive(true).
+		Build()
+	user2 := model.UserBuilder().
+		WithIPID("user-2").
+		WithUserName("user.2@mail.com").
+		WithDisplayName("user 2").
+		WithName(model.NameBuilder().WithGivenName("user").WithFamilyName("2").Build()).
+		WithEmail(model.EmailBuilder().WithValue("user.2@mail.com").WithType("work").WithPrimary(true).Build()).
+		WithActive(true).
+		Build()
+	member1 := model.MemberBuilder().WithIPID("user-1").WithEmail("user.1@mail.com").WithStatus("ACTIVE").Build()
+	member2 := model.MemberBuilder().WithIPID("user-2").WithEmail("user.2@mail.com").WithStatus("ACTIVE").Build()
+
+	idpGroups := model.GroupsResultBuilder().WithResources([]*model.Group{groupA, groupB}).Build()
+	idpUsers := model.UsersResultBuilder().WithResources([]*model.User{user1, user2}).Build()
+	idpGroupsMembers := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+		model.GroupMembersBuilder().WithGroup(groupA).WithResources([]*model.Member{member1}).Build(),
+		model.GroupMembersBuilder().WithGroup(groupB).WithResources([]*model.Member{member1, member2}).Build(),
+	}).Build()
+
+	expectFirstSync := func(t *testing.T, scim *mocks.MockSCIMService, wantGroups, wantUsers int) {
+		scim.EXPECT().GetGroups(ctx).Return(model.GroupsResultBuilder().Build(), nil).Times(1)
+		scim.EXPECT().GetUsers(ctx).Return(model.UsersResultBuilder().Build(), nil).Times(1)
+		scim.EXPECT().GetGroupsMembersBruteForce(ctx, gomock.Any(), gomock.Any()).Return(model.GroupsMembersResultBuilder().Build(), nil).Times(1)
+		scim.EXPECT().CreateGroups(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+				assert.Equal(t, wantGroups, gr.Items)
+				for _, g := range gr.Resources {
+					assert.Empty(t, g.SCIMID, "the SCIM ids of other targets must not be visible")
+					g.SCIMID = "scim-" + g.IPID
+				}
+				return gr, nil
+			}).Times(1)
+		scim.EXPECT().CreateUsers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+				assert.Equal(t, wantUsers, ur.Items)
+				for _, u := range ur.Resources {
+					assert.Empty(t, u.SCIMID, "the SCIM ids of other targets must not be visible")
+					u.SCIMID = "scim-" + u.IPID
+				}
+				return ur, nil
+			}).Times(1)
+		scim.EXPECT().CreateGroupsMembers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+				return gmr, nil
+			}).Times(1)
+	}
+
+	t.Run("identity provider data is retrieved once and synced into every target", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMServiceA := mocks.NewMockSCIMService(mockCtrl)
+		mockSCIMServiceB := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepositoryA := mocks.NewMockStateRepository(mockCtrl)
+		mockStateRepositoryB := mocks.NewMockStateRepository(mockCtrl)
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(idpGroups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, idpGroups).Return(idpGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, idpGroupsMembers).Return(idpUsers, nil).Times(1)
+
+		mockStateRepositoryA.EXPECT().GetState(ctx).Return(model.StateBuilder().Build(), nil).Times(1)
+		mockStateRepositoryB.EXPECT().GetState(ctx).Return(model.StateBuilder().Build(), nil).Times(1)
+
+		// org-a only syncs the groups of org-a, user 2 is only member of a group of org-b
+		expectFirstSync(t, mockSCIMServiceA, 1, 1)
+		expectFirstSync(t, mockSCIMServiceB, 2, 2)
+
+		mockStateRepositoryA.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				assert.Equal(t, 1, state.Resources.Groups.Items)
+				assert.Equal(t, 1, state.Resources.Users.Items)
+				return nil
+			}).Times(1)
+		mockStateRepositoryB.EXPECT().SetState(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, state *model.State) error {
+				assert.Equal(t, 2, state.Resources.Groups.Items)
+				assert.Equal(t, 2, state.Resources.Users.Items)
+				return nil
+			}).Times(1)
+
+		svc, err := NewMultiTargetSyncService(mockProviderService, []SyncTarget{
+			{Name: "org-a", SCIM: mockSCIMServiceA, Repo: mockStateRepositoryA, GroupsFilter: []string{"AWS-OrgA-*"}},
+			{Name: "org-b", SCIM: mockSCIMServiceB, Repo: mockStateRepositoryB},
+		})
+		assert.NoError(t, err)
+
+		result, err := svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+
+		results := result.Targets
+		assert.Equal(t, 2, len(results))
+		assert.Equal(t, "org-a", results[0].Target)
+		assert.Equal(t, 1, results[0].Groups)
+		assert.Equal(t, 1, results[0].Users)
+		assert.NoError(t, results[0].Err)
+		assert.Equal(t, "org-b", results[1].Target)
+		assert.Equal(t, 2, results[1].Groups)
+		assert.Equal(t, 2, results[1].Users)
+		assert.NoError(t, results[1].Err)
+
+		// the identity provider data is not modified by the targets
+		for _, g := range idpGroups.Resources {
+			assert.Empty(t, g.SCIMID)
+		}
+	})
+
+	t.Run("one target failing doesn't stop the others", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMServiceA := mocks.NewMockSCIMService(mockCtrl)
+		mockSCIMServiceB := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepositoryA := mocks.NewMockStateRepository(mockCtrl)
+		mockStateRepositoryB := mocks.NewMockStateRepository(mockCtrl)
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(idpGroups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, idpGroups).Return(idpGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, idpGroupsMembers).Return(idpUsers, nil).Times(1)
+
+		stateErr := errors.New("test error")
+		mockStateRepositoryA.EXPECT().GetState(ctx).Return(nil, stateErr).Times(1)
+		mockStateRepositoryA.EXPECT().SetState(gomock.Any(), gomock.Any()).Times(0)
+
+		mockStateRepositoryB.EXPECT().GetState(ctx).Return(model.StateBuilder().Build(), nil).Times(1)
+		expectFirstSync(t, mockSCIMServiceB, 2, 2)
+		mockStateRepositoryB.EXPECT().SetState(ctx, gomock.Any()).Return(nil).Times(1)
+
+		svc, err := NewMultiTargetSyncService(mockProviderService, []SyncTarget{
+			{Name: "org-a", SCIM: mockSCIMServiceA, Repo: mockStateRepositoryA},
+			{Name: "org-b", SCIM: mockSCIMServiceB, Repo: mockStateRepositoryB},
+		})
+		assert.NoError(t, err)
+
+		result, err := svc.SyncGroupsAndTheirMembers(ctx)
+		assert.Error(t, err)
+		assert.ErrorIs(t, err, stateErr)
+
+		var targetsErr *ErrSyncTargetsFailed
+		assert.ErrorAs(t, err, &targetsErr)
+		assert.Equal(t, 2, targetsErr.Total)
+		assert.Equal(t, 1, len(targetsErr.Failed))
+		assert.Equal(t, "org-a", targetsErr.Failed[0].Target)
+
+		results := result.Targets
+		assert.Equal(t, 2, len(results))
+		assert.Error(t, results[0].Err)
+		assert.NoError(t, results[1].Err)
+	})
+
+	t.Run("plan of every target", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMServiceA := mocks.NewMockSCIMService(mockCtrl)
+		mockSCIMServiceB := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepositoryA := mocks.NewMockStateRepository(mockCtrl)
+		mockStateRepositoryB := mocks.NewMockStateRepository(mockCtrl)
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(idpGroups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, idpGroups).Return(idpGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, idpGroupsMembers).Return(idpUsers, nil).Times(1)
+
+		for _, m := range []*mocks.MockSCIMService{mockSCIMServiceA, mockSCIMServiceB} {
+			m.EXPECT().GetGroups(ctx).Return(model.GroupsResultBuilder().Build(), nil).Times(1)
+			m.EXPECT().GetUsers(ctx).Return(model.UsersResultBuilder().Build(), nil).Times(1)
+			m.EXPECT().GetGroupsMembersBruteForce(ctx, gomock.Any(), gomock.Any()).Return(model.GroupsMembersResultBuilder().Build(), nil).Times(1)
+		}
+		for _, m := range []*mocks.MockStateRepository{mockStateRepositoryA, mockStateRepositoryB} {
+			m.EXPECT().GetState(ctx).Return(model.StateBuilder().Build(), nil).Times(1)
+			m.EXPECT().SetState(gomock.Any(), gomock.Any()).Times(0)
+		}
+
+		svc, err := NewMultiTargetSyncService(mockProviderService, []SyncTarget{
+			{Name: "org-a", SCIM: mockSCIMServiceA, Repo: mockStateRepositoryA, GroupsFilter: []string{"AWS-OrgA-*"}},
+			{Name: "org-b", SCIM: mockSCIMServiceB, Repo: mockStateRepositoryB, GroupsFilter: []string{"AWS-OrgB-*"}},
+		})
+		assert.NoError(t, err)
+
+		plans, err := svc.PlanGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(plans))
+
+		assert.Equal(t, "org-a", plans[0].Target)
+		assert.Equal(t, 1, len(plans[0].Groups.Create))
+		assert.Equal(t, "AWS-OrgA-Admins", plans[0].Groups.Create[0].Name)
+		assert.Equal(t, 1, len(plans[0].Users.Create))
+
+		assert.Equal(t, "org-b", plans[1].Target)
+		assert.Equal(t, 1, len(plans[1].Groups.Create))
+		assert.Equal(t, "AWS-OrgB-Admins", plans[1].Groups.Create[0].Name)
+		assert.Equal(t, 2, len(plans[1].Users.Create))
+	})
+}
+
+func TestFilterTargetData(t *testing.T) {
+	groupA := model.GroupBuilder().WithIPID("group-a").WithName("AWS-OrgA-Admins").Build()
+	groupB := model.GroupBuilder().WithIPID("group-b").WithName("AWS-OrgB-Admins").Build()
+	user1 := model.UserBuilder().WithIPID("user-1").WithEmail(model.EmailBuilder().WithValue("User.1@mail.com").WithPrimary(true).Build()).Build()
+	user2 := model.UserBuilder().WithIPID("user-2").WithEmail(model.EmailBuilder().WithValue("user.2@mail.com").WithPrimary(true).Build()).Build()
+	user3 := model.UserBuilder().WithIPID("user-3").WithEmail(model.EmailBuilder().WithValue("user.3@mail.com").WithPrimary(true).Build()).Build()
+	member1 := model.MemberBuilder().WithIPID("user-1").WithEmail("user.1@mail.com").Build()
+	member2 := model.MemberBuilder().WithIPID("user-2").WithEmail("user.2@mail.com").Build()
+
+	groups := model.GroupsResultBuilder().WithResources([]*model.Group{groupA, groupB}).Build()
+	users := model.UsersResultBuilder().WithResources([]*model.User{user1, user2, user3}).Build()
+	groupsMembers := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+		model.GroupMembersBuilder().WithGroup(groupA).WithResources([]*model.Member{member1}).Build(),
+		model.GroupMembersBuilder().WithGroup(groupB).WithResources([]*model.Member{member1, member2}).Build(),
+	}).Build()
+
+	t.Run("without filter returns the same data", func(t *testing.T) {
+		gr, ur, gmr := filterTargetData([]string{""}, groups, users, groupsMembers)
+		assert.Same(t, groups, gr)
+		assert.Same(t, users, ur)
+		assert.Same(t, groupsMembers, gmr)
+	})
+
+	t.Run("with filter", func(t *testing.T) {
+		gr, ur, gmr := filterTargetData([]string{"AWS-OrgA-*"}, groups, users, groupsMembers)
+
+		assert.Equal(t, 1, gr.Items)
+		assert.Equal(t, "AWS-OrgA-Admins", gr.Resources[0].Name)
+
+		assert.Equal(t, 1, gmr.Items)
+		assert.Equal(t, "AWS-OrgA-Admins", gmr.Resources[0].Group.Name)
+
+		// user 2 is only member of the excluded group, user 3 is not member of any group
+		assert.Equal(t, 2, ur.Items)
+		assert.Equal(t, "user-1", ur.Resources[0].IPID)
+		assert.Equal(t, "user-3", ur.Resources[1].IPID)
+	})
+}
+
+func TestCopyIdentityProviderData(t *testing.T) {
+	group := model.GroupBuilder().WithIPID("group-a").WithName("group a").Build()
+	user := model.UserBuilder().WithIPID("user-1").WithEmail(model.EmailBuilder().WithValue("user.1@mail.com").WithPrimary(true).Build()).Build()
+	member := model.MemberBuilder().WithIPID("user-1").WithEmail("user.1@mail.com").Build()
+
+	groups := model.GroupsResultBuilder().WithResources([]*model.Group{group}).Build()
+	users := model.UsersResultBuilder().WithResources([]*model.User{user}).Build()
+	groupsMembers := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+		model.GroupMembersBuilder().WithGroup(group).WithResources([]*model.Member{member}).Build(),
+	}).Build()
+
+	gr, ur, gmr := copyIdentityProviderData(groups, users, groupsMembers)
+	assert.Equal(t, groups, gr)
+	assert.Equal(t, users, ur)
+	assert.Equal(t, groupsMembers, gmr)
+
+	gr.Resources[0].SCIMID = "scim-group"
+	ur.Resources[0].SCIMID = "scim-user"
+	gmr.Resources[0].Group.SCIMID = "scim-group"
+	gmr.Resources[0].Resources[0].SCIMID = "scim-user"
+
+	assert.Empty(t, group.SCIMID)
+	assert.Empty(t, user.SCIMID)
+	assert.Empty(t, groupsMembers.Resources[0].Group.SCIMID)
+	assert.Empty(t, member.SCIMID)
+}
@@ -0,0 +1,272 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+)
+
+const (
+	// ResourceGroups identifies the groups in the deletion thresholds errors and the sync reports.
+	ResourceGroups = "groups"
+
+	// ResourceUsers identifies the users in the deletion thresholds errors and the sync reports.
+	ResourceUsers = "users"
+
+	// ResourceGroupsMembers identifies the groups memberships in the deletion thresholds errors and the sync reports.
+	ResourceGroupsMembers = "groups_members"
+)
+
+// DeletionThreshold represents the maximum number of deletions allowed for a resource in a single sync.
+// Max is an absolute number and MaxPercent a percentage (0-100) of the resources that exist before the sync.
+// A zero value disables the limit.
+type DeletionThreshold struct {
+	Max        int
+	MaxPercent float64
+}
+
+// enabled returns true when at least one of the limits is defined.
+func (t DeletionThreshold) enabled() bool {
+	return t.Max > 0 || t.MaxPercent > 0
+}
+
+// exceeded returns true when the deletions are over one of the limits.
+func (t DeletionThreshold) exceeded(deletions, total int) bool {
+	if t.Max > 0 && deletions > t.Max {
+		return true
+	}
+
+	if t.MaxPercent > 0 && total > 0 && float64(deletions)*100/float64(total) > t.MaxPercent {
+		return true
+	}
+
+	return false
+}
+
+// DeletionThresholds groups the deletion thresholds of all the synced resources.
+type DeletionThresholds struct {
+	Groups        DeletionThreshold
+	Users         DeletionThreshold
+	GroupsMembers DeletionThreshold
+}
+
+// enabled returns true when at least one of the thresholds is defined.
+func (t DeletionThresholds) enabled() bool {
+	return t.Groups.enabled() || t.Users.enabled() || t.GroupsMembers.enabled()
+}
+
+// ErrDeletionThresholdExceeded is returned when a sync would delete more resources than the allowed
+// by the deletion thresholds, nothing is changed in the SCIM side and the state is not stored.
+type ErrDeletionThresholdExceeded struct {
+	Resource   string
+	Deletions  int
+	Total      int
+	Max        int
+	MaxPercent float64
+}
+
+func (e *ErrDeletionThresholdExceeded) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorCode(), e.ErrorMessage())
+}
+
+func (e *ErrDeletionThresholdExceeded) ErrorMessage() string {
+	return fmt.Sprintf(
+		"the sync would delete %d of %d %s, the limits are max: %d, max percent: %.2f, use force to apply it",
+		e.Deletions, e.Total, e.Resource, e.Max, e.MaxPercent,
+	)
+}
+func (e *ErrDeletionThresholdExceeded) ErrorCode() string { return "ErrDeletionThresholdExceeded" }
+
+// resourcesCount is the number of resources that exist before a sync.
+type resourcesCount struct {
+	groups        int
+	users         int
+	groupsMembers int
+}
+
+// countMembers returns the number of members of all the groups.
+func countMembers(gms []*model.GroupMembers) int {
+	total := 0
+	for _, gm := range gms {
+		total += len(gm.Resources)
+	}
+	return total
+}
+
+// checkDeletionThresholds returns an *ErrDeletionThresholdExceeded error when the plan
+// deletes more resources than the allowed by the thresholds.
+func checkDeletionThresholds(thresholds DeletionThresholds, plan *SyncPlan, current resourcesCount) error {
+	checks := []struct {
+		resource  string
+		threshold DeletionThreshold
+		deletions int
+		total     int
+	}{
+		{ResourceGroups, thresholds.Groups, len(plan.Groups.Delete), current.groups},
+		{ResourceUsers, thresholds.Users, len(plan.Users.Delete) + len(plan.Users.Deactivate), current.users},
+		{ResourceGroupsMembers, thresholds.GroupsMembers, countMembers(plan.GroupsMembers.Remove), current.groupsMembers},
+	}
+
+	for _, c := range checks {
+		slog.Debug("checking deletion threshold",
+			"resource", c.resource,
+			"deletions", c.deletions,
+			"total", c.total,
+			"max", c.threshold.Max,
+			"max_percent", c.threshold.MaxPercent,
+		)
+
+		if c.threshold.exceeded(c.deletions, c.total) {
+			return &ErrDeletionThresholdExceeded{
+				Resource:   c.resource,
+				Deletions:  c.deletions,
+				Total:      c.total,
+				Max:        c.threshold.Max,
+				MaxPercent: c.threshold.MaxPercent,
+			}
+		}
+	}
+
+	return nil
+}
+
+// cachedReadsSCIMService wraps a SCIMService and reads the SCIM side only once during the sync of a target,
+// so the deletion thresholds check and the reconciliation share the groups, users and groups members read.
+// The groups members of the groups and users that were not read yet, like the ones created by the
+// reconciliation, are read from the wrapped SCIMService.
+type cachedReadsSCIMService struct {
+	SCIMService
+
+	groups *model.GroupsResult
+	users  *model.UsersResult
+
+	// members are the members found of the groups, and checked the users checked, by SCIM id of the group
+	members map[string]map[string]*model.Member
+	checked map[string]map[string]struct{}
+}
+
+// newCachedReadsSCIMService returns a new cachedReadsSCIMService wrapping the given SCIMService
+func newCachedReadsSCIMService(scim SCIMService) *cachedReadsSCIMService {
+	return &cachedReadsSCIMService{
+		SCIMService: scim,
+		members:     make(map[string]map[string]*model.Member),
+		checked:     make(map[string]map[string]struct{}),
+	}
+}
+
+// GetGroups returns the groups read the first time.
+func (s *cachedReadsSCIMService) GetGroups(ctx context.Context) (*model.GroupsResult, error) {
+	if s.groups != nil {
+		return s.groups, nil
+	}
+
+	gr, err := s.SCIMService.GetGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.groups = gr
+	return gr, nil
+}
+
+// GetUsers returns the users read the first time.
+func (s *cachedReadsSCIMService) GetUsers(ctx context.Context) (*model.UsersResult, error) {
+	if s.users != nil {
+		return s.users, nil
+	}
+
+	ur, err := s.SCIMService.GetUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.users = ur
+	return ur, nil
+}
+
+// GetGroupsMembersBruteForce checks in the wrapped SCIMService only the groups and users not checked yet,
+// the groups members of the groups and users already checked are taken from the previous reads.
+func (s *cachedReadsSCIMService) GetGroupsMembersBruteForce(ctx context.Context, gr *model.GroupsResult, ur *model.UsersResult) (*model.GroupsMembersResult, error) {
+	newGroups := make([]*model.Group, 0)
+	readGroups := make([]*model.Group, 0)
+	for _, group := range gr.Resources {
+		if _, ok := s.checked[group.SCIMID]; ok && group.SCIMID != "" {
+			readGroups = append(readGroups, group)
+		} else {
+			newGroups = append(newGroups, group)
+		}
+	}
+
+	// nothing read yet, the result of the wrapped SCIMService is returned as it is
+	if len(readGroups) == 0 {
+		gmr, err := s.SCIMService.GetGroupsMembersBruteForce(ctx, gr, ur)
+		if err != nil {
+			return nil, err
+		}
+		s.add(gmr, ur.Resources)
+		return gmr, nil
+	}
+
+	if len(newGroups) > 0 {
+		gmr, err := s.SCIMService.GetGroupsMembersBruteForce(ctx, model.GroupsResultBuilder().WithResources(newGroups).Build(), ur)
+		if err != nil {
+			return nil, err
+		}
+		s.add(gmr, ur.Resources)
+	}
+
+	newUsers := make([]*model.User, 0)
+	for _, user := range ur.Resources {
+		for _, group := range readGroups {
+			if _, ok := s.checked[group.SCIMID][user.SCIMID]; !ok {
+				newUsers = append(newUsers, user)
+				break
+			}
+		}
+	}
+
+	if len(newUsers) > 0 {
+		gmr, err := s.SCIMService.GetGroupsMembersBruteForce(ctx, model.GroupsResultBuilder().WithResources(readGroups).Build(), model.UsersResultBuilder().WithResources(newUsers).Build())
+		if err != nil {
+			return nil, err
+		}
+		s.add(gmr, newUsers)
+	}
+
+	// the groups members keep the order of the given groups and users, like the wrapped SCIMService
+	groupsMembers := make([]*model.GroupMembers, 0, len(gr.Resources))
+	for _, group := range gr.Resources {
+		members := make([]*model.Member, 0)
+		for _, user := range ur.Resources {
+			if m, ok := s.members[group.SCIMID][user.SCIMID]; ok {
+				members = append(members, m)
+			}
+		}
+
+		groupsMembers = append(groupsMembers, model.GroupMembersBuilder().WithGroup(group).WithResources(members).Build())
+	}
+
+	return model.GroupsMembersResultBuilder().WithResources(groupsMembers).Build(), nil
+}
+
+// add keeps the groups members read and the users checked in the groups.
+func (s *cachedReadsSCIMService) add(gmr *model.GroupsMembersResult, users []*model.User) {
+	for _, gm := range gmr.Resources {
+		id := gm.Group.SCIMID
+		if id == "" {
+			continue
+		}
+
+		if s.checked[id] == nil {
+			s.checked[id] = make(map[string]struct{})
+			s.members[id] = make(map[string]*model.Member)
+		}
+
+		for _, user := range users {
+			s.checked[id][user.SCIMID] = struct{}{}
+		}
+		for _, m := range gm.Resources {
+			s.members[id][m.SCIMID] = m
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/core"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestDeletionThreshold_exceeded(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold DeletionThreshold
+		deletions int
+		total     int
+		want      bool
+	}{
+		{name: "disabled", threshold: DeletionThreshold{}, deletions: 100, total: 100, want: false},
+		{name: "under max", threshold: DeletionThreshold{Max: 10}, deletions: 10, total: 100, want: false},
+		{name: "over max", threshold: DeletionThreshold{Max: 10}, deletions: 11, total: 100, want: true},
+		{name: "under max percent", threshold: DeletionThreshold{MaxPercent: 10}, deletions: 10, total: 100, want: false},
+		{name: "over max percent", threshold: DeletionThreshold{MaxPercent: 10}, deletions: 11, total: 100, want: true},
+		{name: "max percent without resources", threshold: DeletionThreshold{MaxPercent: 10}, deletions: 0, total: 0, want: false},
+		{name: "under max but over max percent", threshold: DeletionThreshold{Max: 50, MaxPercent: 10}, deletions: 20, total: 100, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.threshold.exceeded(tt.deletions, tt.total))
+		})
+	}
+}
+
+func TestCheckDeletionThresholds(t *testing.T) {
+	group1 := model.GroupBuilder().WithIPID("group-1").WithName("group 1").Build()
+	user1 := model.UserBuilder().WithIPID("user-1").WithUserName("user.1@mail.com").Build()
+	member1 := model.MemberBuilder().WithIPID("user-1").WithEmail("user.1@mail.com").Build()
+	member2 := model.MemberBuilder().WithIPID("user-2").WithEmail("user.2@mail.com").Build()
+
+	plan := newSyncPlan()
+	plan.Groups.Delete = []*model.Group{group1}
+	plan.Users.Delete = []*model.User{user1}
+	plan.GroupsMembers.Remove = []*model.GroupMembers{
+		model.GroupMembersBuilder().WithGroup(group1).WithResources([]*model.Member{member1, member2}).Build(),
+	}
+
+	current := resourcesCount{groups: 2, users: 10, groupsMembers: 4}
+
+	t.Run("no thresholds", func(t *testing.T) {
+		assert.NoError(t, checkDeletionThresholds(DeletionThresholds{}, plan, current))
+	})
+
+	t.Run("under the thresholds", func(t *testing.T) {
+		thresholds := DeletionThresholds{
+			Groups:        DeletionThreshold{MaxPercent: 50},
+			Users:         DeletionThreshold{Max: 1},
+			GroupsMembers: DeletionThreshold{Max: 2},
+		}
+		assert.NoError(t, checkDeletionThresholds(thresholds, plan, current))
+	})
+
+	t.Run("groups members over the threshold", func(t *testing.T) {
+		thresholds := DeletionThresholds{GroupsMembers: DeletionThreshold{MaxPercent: 25}}
+
+		err := checkDeletionThresholds(thresholds, plan, current)
+		assert.Error(t, err)
+
+		var errThreshold *ErrDeletionThresholdExceeded
+		assert.True(t, errors.As(err, &errThreshold))
+		assert.Equal(t, ResourceGroupsMembers, errThreshold.Resource)
+		assert.Equal(t, 2, errThreshold.Deletions)
+		assert.Equal(t, 4, errThreshold.Total)
+	})
+}
+
+func TestSyncService_DeletionThresholds(t *testing.T) {
+	ctx := context.TODO()
+
+	group1 := model.GroupBuilder().WithIPID("group-1").WithName("group 1").WithSCIMID("scim-group-1").Build()
+	user1 := model.UserBuilder().
+		WithIPID("user-1").
+		WithSCIMID("scim-user-1").
+		WithUserName("user.1@mail.com").
+		WithName(model.NameBuilder().WithGivenName("user").WithFamilyName("1").Build()).
+		Build()
+	member1 := model.MemberBuilder().WithIPID("user-1").WithSCIMID("scim-user-1").WithEmail("user.1@mail.com").Build()
+
+	state := model.StateBuilder().
+		WithLastSync(time.Now().Format(time.RFC3339)).
+		WithGroups(model.GroupsResultBuilder().WithResources([]*model.Group{group1}).Build()).
+		WithUsers(model.UsersResultBuilder().WithResources([]*model.User{user1}).Build()).
+		WithGroupsMembers(model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+			model.GroupMembersBuilder().WithGroup(group1).WithResources([]*model.Member{member1}).Build(),
+		}).Build()).
+		Build()
+
+	emptyGroups := model.GroupsResultBuilder().Build()
+	emptyGroupsMembers := model.GroupsMembersResultBuilder().Build()
+	emptyUsers := model.UsersResultBuilder().Build()
+
+	t.Run("sync aborted when the identity provider returns nothing", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(emptyGroups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, emptyGroups).Return(emptyGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, emptyGroupsMembers).Return(emptyUsers, nil).Times(1)
+
+		mockStateRepository.EXPECT().GetState(ctx).Return(state, nil).Times(1)
+		mockStateRepository.EXPECT().SetState(gomock.Any(), gomock.Any()).Times(0)
+
+		mockSCIMService.EXPECT().DeleteGroups(gomock.Any(), gomock.Any()).Times(0)
+		mockSCIMService.EXPECT().DeleteUsers(gomock.Any(), gomock.Any()).Times(0)
+		mockSCIMService.EXPECT().DeleteGroupsMembers(gomock.Any(), gomock.Any()).Times(0)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository,
+			WithUsersDeletionThreshold(DeletionThreshold{MaxPercent: 50}),
+		)
+		assert.NoError(t, err)
+
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.Error(t, err)
+
+		var errThreshold *ErrDeletionThresholdExceeded
+		assert.True(t, errors.As(err, &errThreshold))
+		assert.Equal(t, ResourceUsers, errThreshold.Resource)
+	})
+
+	t.Run("sync applied when forced", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(emptyGroups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, emptyGroups).Return(emptyGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, emptyGroupsMembers).Return(emptyUsers, nil).Times(1)
+
+		mockStateRepository.EXPECT().GetState(ctx).Return(state, nil).Times(1)
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).Return(nil).Times(1)
+
+		mockSCIMService.EXPECT().DeleteGroups(ctx, gomock.Any()).Return(nil).Times(1)
+		mockSCIMService.EXPECT().DeleteUsers(ctx, gomock.Any()).Return(nil).Times(1)
+		mockSCIMService.EXPECT().DeleteGroupsMembers(ctx, gomock.Any()).Return(nil).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository,
+			WithUsersDeletionThreshold(DeletionThreshold{MaxPercent: 50}),
+			WithForce(true),
+		)
+		assert.NoError(t, err)
+
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+	})
+}
+
+func TestSyncService_DeletionThresholdsFirstSync(t *testing.T) {
+	ctx := context.TODO()
+
+	newUser := func(n string, scimID string) *model.User {
+		return model.UserBuilder().
+			WithIPID("user-" + n).
+			WithSCIMID(scimID).
+			WithUserName("user." + n + "@mail.com").
+			WithEmail(model.EmailBuilder().WithValue("user." + n + "@mail.com").WithType("work").WithPrimary(true).Build()).
+			WithName(model.NameBuilder().WithGivenName("user").WithFamilyName(n).Build()).
+			WithDisplayName("user " + n).
+			WithActive(true).
+			Build()
+	}
+	newMember := func(n string, scimID string) *model.Member {
+		return model.MemberBuilder().WithIPID("user-" + n).WithSCIMID(scimID).WithEmail("user." + n + "@mail.com").WithStatus("ACTIVE").Build()
+	}
+
+	t.Run("the SCIM side is read once to check the thresholds and reconcile", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		idpGroups := model.GroupsResultBuilder().WithResources([]*model.Group{
+			model.GroupBuilder().WithIPID("group-1").WithName("group 1").Build(),
+		}).Build()
+		idpGroupsMembers := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+			model.GroupMembersBuilder().WithGroup(idpGroups.Resources[0]).WithResources([]*model.Member{newMember("1", ""), newMember("2", "")}).Build(),
+		}).Build()
+		idpUsers := model.UsersResultBuilder().WithResources([]*model.User{newUser("1", ""), newUser("2", "")}).Build()
+
+		mockProviderService.EXPECT().GetGroups(ctx, gomock.Any()).Return(idpGroups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(ctx, idpGroups).Return(idpGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(ctx, idpGroupsMembers).Return(idpUsers, nil).Times(1)
+
+		mockStateRepository.EXPECT().GetState(ctx).Return(model.StateBuilder().Build(), nil).Times(1)
+		mockStateRepository.EXPECT().SetState(ctx, gomock.Any()).Return(nil).Times(1)
+
+		scimGroups := model.GroupsResultBuilder().WithResources([]*model.Group{
+			model.GroupBuilder().WithIPID("group-1").WithSCIMID("scim-group-1").WithName("group 1").Build(),
+		}).Build()
+		scimUsers := model.UsersResultBuilder().WithResources([]*model.User{newUser("1", "scim-user-1"), newUser("3", "scim-user-3")}).Build()
+
+		mockSCIMService.EXPECT().GetGroups(ctx).Return(scimGroups, nil).Times(1)
+		mockSCIMService.EXPECT().GetUsers(ctx).Return(scimUsers, nil).Times(1)
+
+		var bruteForceUsers [][]string
+		mockSCIMService.EXPECT().GetGroupsMembersBruteForce(ctx, gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, gr *model.GroupsResult, ur *model.UsersResult) (*model.GroupsMembersResult, error) {
+				ids := make([]string, 0)
+				members := make([]*model.Member, 0)
+				for _, user := range ur.Resources {
+					ids = append(ids, user.SCIMID)
+					if user.SCIMID == "scim-user-1" {
+						members = append(members, newMember("1", "scim-user-1"))
+					}
+				}
+				bruteForceUsers = append(bruteForceUsers, ids)
+
+				return model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+					model.GroupMembersBuilder().WithGroup(gr.Resources[0]).WithResources(members).Build(),
+				}).Build(), nil
+			},
+		).Times(2)
+
+		mockSCIMService.EXPECT().CreateUsers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+				ur.Resources[0].SCIMID = "scim-user-2"
+				return ur, nil
+			},
+		).Times(1)
+		mockSCIMService.EXPECT().DeleteUsers(ctx, gomock.Any()).Return(nil).Times(1)
+		mockSCIMService.EXPECT().CreateGroupsMembers(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+				return gmr, nil
+			},
+		).Times(1)
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository,
+			WithUsersDeletionThreshold(DeletionThreshold{MaxPercent: 50}),
+		)
+		assert.NoError(t, err)
+
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+
+		// the thresholds check reads the existing user, the reconciliation only the created one
+		assert.Equal(t, [][]string{{"scim-user-1"}, {"scim-user-2"}}, bruteForceUsers)
+	})
+}
+
+func TestCachedReadsSCIMService_GetGroupsMembersBruteForce(t *testing.T) {
+	ctx := context.TODO()
+
+	group1 := model.GroupBuilder().WithSCIMID("scim-group-1").WithName("group 1").Build()
+	group2 := model.GroupBuilder().WithSCIMID("scim-group-2").WithName("group 2").Build()
+	user1 := model.UserBuilder().WithSCIMID("scim-user-1").WithUserName("user.1@mail.com").Build()
+	user2 := model.UserBuilder().WithSCIMID("scim-user-2").WithUserName("user.2@mail.com").Build()
+	member1 := model.MemberBuilder().WithSCIMID("scim-user-1").WithEmail("user.1@mail.com").Build()
+	member2 := model.MemberBuilder().WithSCIMID("scim-user-2").WithEmail("user.2@mail.com").Build()
+
+	groupsMembers := func(gms ...*model.GroupMembers) *model.GroupsMembersResult {
+		return model.GroupsMembersResultBuilder().WithResources(gms).Build()
+	}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+	gomock.InOrder(
+		mockSCIMService.EXPECT().GetGroupsMembersBruteForce(ctx,
+			model.GroupsResultBuilder().WithResources([]*model.Group{group1}).Build(),
+			model.UsersResultBuilder().WithResources([]*model.User{user1}).Build(),
+		).Return(groupsMembers(model.GroupMembersBuilder().WithGroup(group1).WithResources([]*model.Member{member1}).Build()), nil),
+		mockSCIMService.EXPECT().GetGroupsMembersBruteForce(ctx,
+			model.GroupsResultBuilder().WithResources([]*model.Group{group2}).Build(),
+			model.UsersResultBuilder().WithResources([]*model.User{user1, user2}).Build(),
+		).Return(groupsMembers(model.GroupMembersBuilder().WithGroup(group2).WithResources([]*model.Member{member2}).Build()), nil),
+		mockSCIMService.EXPECT().GetGroupsMembersBruteForce(ctx,
+			model.GroupsResultBuilder().WithResources([]*model.Group{group1}).Build(),
+			model.UsersResultBuilder().WithResources([]*model.User{user2}).Build(),
+		).Return(groupsMembers(model.GroupMembersBuilder().WithGroup(group1).WithResources([]*model.Member{member2}).Build()), nil),
+	)
+
+	scim := newCachedReadsSCIMService(mockSCIMService)
+
+	_, err := scim.GetGroupsMembersBruteForce(ctx,
+		model.GroupsResultBuilder().WithResources([]*model.Group{group1}).Build(),
+		model.UsersResultBuilder().WithResources([]*model.User{user1}).Build(),
+	)
+	assert.NoError(t, err)
+
+	got, err := scim.GetGroupsMembersBruteForce(ctx,
+		model.GroupsResultBuilder().WithResources([]*model.Group{group1, group2}).Build(),
+		model.UsersResultBuilder().WithResources([]*model.User{user1, user2}).Build(),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, groupsMembers(
+		model.GroupMembersBuilder().WithGroup(group1).WithResources([]*model.Member{member1, member2}).Build(),
+		model.GroupMembersBuilder().WithGroup(group2).WithResources([]*model.Member{member2}).Build(),
+	), got)
+
+	// everything was read, the wrapped SCIMService is not called again
+	got, err = scim.GetGroupsMembersBruteForce(ctx,
+		model.GroupsResultBuilder().WithResources([]*model.Group{group2}).Build(),
+		model.UsersResultBuilder().WithResources([]*model.User{user1}).Build(),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, groupsMembers(model.GroupMembersBuilder().WithGroup(group2).Build()), got)
+}
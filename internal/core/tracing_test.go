@@ -0,0 +1,160 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/core"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/mock/gomock"
+)
+
+// spansByName returns the ended spans of the exporter by name.
+func spansByName(exporter *tracetest.InMemoryExporter) map[string]tracetest.SpanStub {
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+
+	return spans
+}
+
+func TestSyncService_Tracing(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("traces the phases of the first sync", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+
+		group1 := model.GroupBuilder().WithIPID("group-1").WithName("group 1").WithEmail("group.1@mail.com").Build()
+		member1 := model.MemberBuilder().WithIPID("user-1").WithEmail("user.1@mail.com").WithStatus("ACTIVE").Build()
+		user1 := model.UserBuilder().
+			WithIPID("user-1").
+			WithUserName("user.1@mail.com").
+			WithDisplayName("user 1").
+			WithName(model.NameBuilder().WithGivenName("user").WithFamilyName("1").Build()).
+			WithEmail(model.EmailBuilder().WithValue("user.1@mail.com").WithType("work").WithPrimary(true).Build()).
+			WithActive(true).
+			Build()
+
+		idpGroups := model.GroupsResultBuilder().WithResources([]*model.Group{group1}).Build()
+		idpUsers := model.UsersResultBuilder().WithResources([]*model.User{user1}).Build()
+		idpGroupsMembers := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+			model.GroupMembersBuilder().WithGroup(group1).WithResources([]*model.Member{member1}).Build(),
+		}).Build()
+
+		// the spans are in the context, so it is not the same context
+		mockProviderService.EXPECT().GetGroups(gomock.Any(), gomock.Any()).Return(idpGroups, nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(gomock.Any(), idpGroups).Return(idpGroupsMembers, nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(gomock.Any(), idpGroupsMembers).Return(idpUsers, nil).Times(1)
+		mockStateRepository.EXPECT().GetState(gomock.Any()).Return(model.StateBuilder().Build(), nil).Times(1)
+
+		mockSCIMService.EXPECT().GetGroups(gomock.Any()).Return(model.GroupsResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().CreateGroups(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+				for _, g := range gr.Resources {
+					g.SCIMID = "scim-" + g.IPID
+				}
+				return gr, nil
+			}).Times(1)
+		mockSCIMService.EXPECT().GetUsers(gomock.Any()).Return(model.UsersResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().CreateUsers(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+				for _, u := range ur.Resources {
+					u.SCIMID = "scim-" + u.IPID
+				}
+				return ur, nil
+			}).Times(1)
+		mockSCIMService.EXPECT().GetGroupsMembersBruteForce(gomock.Any(), gomock.Any(), gomock.Any()).Return(model.GroupsMembersResultBuilder().Build(), nil).Times(1)
+		mockSCIMService.EXPECT().CreateGroupsMembers(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+				return gmr, nil
+			}).Times(1)
+		mockStateRepository.EXPECT().SetState(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository, WithTracerProvider(tp))
+		assert.NoError(t, err)
+
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.NoError(t, err)
+
+		spans := spansByName(exporter)
+		for _, name := range []string{
+			"core.SyncGroupsAndTheirMembers",
+			"core.getIdentityProviderData",
+			"core.syncTarget",
+			"core.getState",
+			"core.reconcile",
+			"core.scimSync",
+			"core.reconcilingGroups",
+			"core.reconcilingUsers",
+			"core.reconcilingGroupsMembers",
+			"core.setState",
+		} {
+			assert.Contains(t, spans, name)
+		}
+		assert.NotContains(t, spans, "core.stateSync")
+
+		root := spans["core.SyncGroupsAndTheirMembers"]
+		assert.False(t, root.Parent.IsValid())
+		assert.Equal(t, root.SpanContext.SpanID(), spans["core.getIdentityProviderData"].Parent.SpanID())
+		assert.Equal(t, root.SpanContext.SpanID(), spans["core.syncTarget"].Parent.SpanID())
+		assert.Equal(t, spans["core.syncTarget"].SpanContext.SpanID(), spans["core.reconcile"].Parent.SpanID())
+		assert.Equal(t, spans["core.reconcile"].SpanContext.SpanID(), spans["core.scimSync"].Parent.SpanID())
+		assert.Equal(t, spans["core.scimSync"].SpanContext.SpanID(), spans["core.reconcilingGroups"].Parent.SpanID())
+
+		assert.Contains(t, spans["core.getIdentityProviderData"].Attributes, attribute.Int("idp.groups", 1))
+		assert.Contains(t, spans["core.getIdentityProviderData"].Attributes, attribute.Int("idp.users", 1))
+		assert.Contains(t, spans["core.syncTarget"].Attributes, attribute.String("sync.target", DefaultSyncTargetName))
+		assert.Contains(t, spans["core.reconcilingGroups"].Attributes, attribute.Int("groups.create", 1))
+		assert.Contains(t, spans["core.reconcilingGroups"].Attributes, attribute.StringSlice("groups.create.names", []string{"group 1"}))
+		assert.Contains(t, spans["core.reconcilingUsers"].Attributes, attribute.Int("users.create", 1))
+		assert.Contains(t, spans["core.reconcilingGroupsMembers"].Attributes, attribute.Int("groups_members.create", 1))
+		assert.Contains(t, spans["core.reconcilingGroupsMembers"].Attributes, attribute.StringSlice("groups_members.create.groups", []string{"group 1"}))
+		assert.Equal(t, codes.Unset, root.Status.Code)
+	})
+
+	t.Run("the failed phase and the sync spans have the error status", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockProviderService := mocks.NewMockIdentityProviderService(mockCtrl)
+		mockSCIMService := mocks.NewMockSCIMService(mockCtrl)
+		mockStateRepository := mocks.NewMockStateRepository(mockCtrl)
+		stateErr := errors.New("state error")
+
+		mockProviderService.EXPECT().GetGroups(gomock.Any(), gomock.Any()).Return(model.GroupsResultBuilder().Build(), nil).Times(1)
+		mockProviderService.EXPECT().GetGroupsMembers(gomock.Any(), gomock.Any()).Return(model.GroupsMembersResultBuilder().Build(), nil).Times(1)
+		mockProviderService.EXPECT().GetUsersByGroupsMembers(gomock.Any(), gomock.Any()).Return(model.UsersResultBuilder().Build(), nil).Times(1)
+		mockStateRepository.EXPECT().GetState(gomock.Any()).Return(nil, stateErr).Times(1)
+
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+		svc, err := NewSyncService(mockProviderService, mockSCIMService, mockStateRepository, WithTracerProvider(tp))
+		assert.NoError(t, err)
+
+		_, err = svc.SyncGroupsAndTheirMembers(ctx)
+		assert.ErrorIs(t, err, stateErr)
+
+		spans := spansByName(exporter)
+		assert.Equal(t, codes.Error, spans["core.getState"].Status.Code)
+		assert.Equal(t, codes.Error, spans["core.syncTarget"].Status.Code)
+		assert.Equal(t, codes.Error, spans["core.SyncGroupsAndTheirMembers"].Status.Code)
+		assert.Equal(t, codes.Unset, spans["core.getIdentityProviderData"].Status.Code)
+		assert.NotContains(t, spans, "core.reconcile")
+	})
+}
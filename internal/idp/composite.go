@@ -0,0 +1,527 @@
+package idp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+)
+
+// This implement core.IdentityProviderService interface on top of other identity providers
+
+// CompositeConflictPolicy defines what happens when the same group name or userName is returned by more than one source.
+type CompositeConflictPolicy string
+
+const (
+	// CompositeConflictPrecedence keeps the group or user of the source with the highest precedence.
+	CompositeConflictPrecedence CompositeConflictPolicy = "precedence"
+
+	// CompositeConflictMerge keeps the group of the source with the highest precedence with the members
+	// of the group in all the sources, only valid for groups.
+	CompositeConflictMerge CompositeConflictPolicy = "merge"
+
+	// CompositeConflictError stops the sync.
+	CompositeConflictError CompositeConflictPolicy = "error"
+)
+
+var (
+	// ErrCompositeSourcesEmpty is returned when the composite identity provider doesn't have sources.
+	ErrCompositeSourcesEmpty = errors.New("provider: composite sources are empty")
+
+	// ErrCompositeSourceNil is returned when the provider of a composite source is nil.
+	ErrCompositeSourceNil = errors.New("provider: composite source provider is nil")
+
+	// ErrCompositeSourceNameDuplicated is returned when more than one source has the same name.
+	ErrCompositeSourceNameDuplicated = errors.New("provider: composite source name is duplicated")
+
+	// ErrCompositeSourceUnknown is returned when the precedence contains a name that is not a source.
+	ErrCompositeSourceUnknown = errors.New("provider: composite source is unknown")
+
+	// ErrCompositeConflictPolicyInvalid is returned when the conflict policy is not valid.
+	ErrCompositeConflictPolicyInvalid = errors.New("provider: composite conflict policy is invalid")
+
+	// ErrCompositeGroupUnknown is returned when the group was not returned by any source.
+	ErrCompositeGroupUnknown = errors.New("provider: group not found in the composite sources")
+
+	// ErrCompositeConflict is returned when the same group name or userName is returned by more than one source
+	// and the conflict policy is CompositeConflictError.
+	ErrCompositeConflict = errors.New("provider: composite sources conflict")
+)
+
+//go:generate go run go.uber.org/mock/mockgen@v0.5.0 -package=mocks -destination=../../mocks/idp/composite_mocks.go -source=composite.go CompositeProviderService
+
+// CompositeProviderService is the interface of the identity providers used as composite sources,
+// it is the same as core.IdentityProviderService.
+type CompositeProviderService interface {
+	GetGroups(ctx context.Context, filter []string) (*model.GroupsResult, error)
+	GetUsers(ctx context.Context, filter []string) (*model.UsersResult, error)
+	GetGroupMembers(ctx context.Context, id string) (*model.MembersResult, error)
+	GetUsersByGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.UsersResult, error)
+	GetGroupsMembers(ctx context.Context, gr *model.GroupsResult) (*model.GroupsMembersResult, error)
+}
+
+// CompositeSource is an identity provider used by the CompositeIdentityProvider with its own filters.
+type CompositeSource struct {
+	// Name identifies the source, it is the origin of its groups and users, example: google-tenant-a
+	Name         string
+	Provider     CompositeProviderService
+	GroupsFilter []string
+	UsersFilter  []string
+}
+
+// compositeGroup is a group of a source that is part of a composite group
+type compositeGroup struct {
+	source int
+	group  *model.Group
+}
+
+// CompositeIdentityProvider is the Identity Provider service that implements the core.IdentityProvider interface
+// merging the groups, users and groups members of its sources.
+//
+// The groups and users are tagged with the name of their source as origin. When the same group name or
+// userName (or user primary email) is returned by more than one source the conflict policies are applied,
+// by default the source with the highest precedence wins, the sources are in precedence order unless
+// WithCompositePrecedence is used.
+type CompositeIdentityProvider struct {
+	sources        []CompositeSource
+	precedence     []string
+	groupsConflict CompositeConflictPolicy
+	usersConflict  CompositeConflictPolicy
+
+	mu sync.Mutex
+	// groups are the groups of the sources that are part of every returned group, by IPID
+	groups map[string][]compositeGroup
+	// membersSource is the index of the source of every member, by IPID
+	membersSource map[string]int
+}
+
+// CompositeIdentityProviderOption is a function that configures the CompositeIdentityProvider.
+type CompositeIdentityProviderOption func(*CompositeIdentityProvider)
+
+// WithCompositePrecedence sets the precedence of the sources by name, from the highest to the lowest,
+// the sources not included have a lower precedence in their original order.
+func WithCompositePrecedence(names ...string) CompositeIdentityProviderOption {
+	return func(i *CompositeIdentityProvider) {
+		i.precedence = names
+	}
+}
+
+// WithCompositeGroupsConflictPolicy sets the policy applied to the groups with the same name.
+func WithCompositeGroupsConflictPolicy(policy CompositeConflictPolicy) CompositeIdentityProviderOption {
+	return func(i *CompositeIdentityProvider) {
+		if policy != "" {
+			i.groupsConflict = policy
+		}
+	}
+}
+
+// WithCompositeUsersConflictPolicy sets the policy applied to the users with the same userName or primary email.
+func WithCompositeUsersConflictPolicy(policy CompositeConflictPolicy) CompositeIdentityProviderOption {
+	return func(i *CompositeIdentityProvider) {
+		if policy != "" {
+			i.usersConflict = policy
+		}
+	}
+}
+
+// NewCompositeIdentityProvider returns a new instance of the Composite Identity Provider service.
+func NewCompositeIdentityProvider(sources []CompositeSource, opts ...CompositeIdentityProviderOption) (*CompositeIdentityProvider, error) {
+	if len(sources) == 0 {
+		return nil, ErrCompositeSourcesEmpty
+	}
+
+	i := &CompositeIdentityProvider{
+		groupsConflict: CompositeConflictPrecedence,
+		usersConflict:  CompositeConflictPrecedence,
+		groups:         make(map[string][]compositeGroup),
+		membersSource:  make(map[string]int),
+	}
+
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	switch i.groupsConflict {
+	case CompositeConflictPrecedence, CompositeConflictMerge, CompositeConflictError:
+	default:
+		return nil, fmt.Errorf("%w: groups %s", ErrCompositeConflictPolicyInvalid, i.groupsConflict)
+	}
+
+	switch i.usersConflict {
+	case CompositeConflictPrecedence, CompositeConflictError:
+	default:
+		return nil, fmt.Errorf("%w: users %s", ErrCompositeConflictPolicyInvalid, i.usersConflict)
+	}
+
+	rank := make(map[string]int, len(sources))
+	for idx, source := range sources {
+		if source.Provider == nil {
+			return nil, fmt.Errorf("%w: %s", ErrCompositeSourceNil, source.Name)
+		}
+		if _, ok := rank[source.Name]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrCompositeSourceNameDuplicated, source.Name)
+		}
+		rank[source.Name] = len(i.precedence) + idx
+	}
+
+	for idx, name := range i.precedence {
+		if _, ok := rank[name]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrCompositeSourceUnknown, name)
+		}
+		rank[name] = idx
+	}
+
+	i.sources = make([]CompositeSource, len(sources))
+	copy(i.sources, sources)
+	sort.SliceStable(i.sources, func(a, b int) bool {
+		return rank[i.sources[a].Name] < rank[i.sources[b].Name]
+	})
+
+	return i, nil
+}
+
+// Close closes the sources that support it.
+func (i *CompositeIdentityProvider) Close() error {
+	var errs []error
+	for _, source := range i.sources {
+		if c, ok := source.Provider.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetGroups returns the groups of all the sources, every source uses its own groups filter
+// so the filter parameter is ignored.
+func (i *CompositeIdentityProvider) GetGroups(ctx context.Context, _ []string) (*model.GroupsResult, error) {
+	byName := make(map[string]*model.Group)
+	syncGroups := make([]*model.Group, 0)
+
+	for idx, source := range i.sources {
+		gr, err := source.Provider.GetGroups(ctx, source.GroupsFilter)
+		if err != nil {
+			return nil, fmt.Errorf("idp: error getting groups from %s: %w", source.Name, err)
+		}
+
+		for _, group := range gr.Resources {
+			winner, ok := byName[group.Name]
+			if !ok {
+				group.Origin = source.Name
+				byName[group.Name] = group
+
+				i.setGroups(group.IPID, []compositeGroup{{source: idx, group: group}})
+				syncGroups = append(syncGroups, group)
+				continue
+			}
+
+			switch i.groupsConflict {
+			case CompositeConflictError:
+				return nil, fmt.Errorf("%w: group %s in %s and %s", ErrCompositeConflict, group.Name, winner.Origin, source.Name)
+			case CompositeConflictMerge:
+				slog.Info("idp: group exists in more than one source, the members will be merged",
+					"name", group.Name,
+					"origin", winner.Origin,
+					"source", source.Name,
+				)
+				i.addGroup(winner.IPID, compositeGroup{source: idx, group: group})
+			default:
+				slog.Warn("idp: group already exists in a source with higher precedence, this group will be avoided",
+					"name", group.Name,
+					"origin", winner.Origin,
+					"source", source.Name,
+				)
+			}
+		}
+	}
+
+	syncResult := model.GroupsResultBuilder().WithResources(syncGroups).Build()
+	slog.Debug("idp: composite GetGroups()", "groups", len(syncGroups))
+
+	return syncResult, nil
+}
+
+// GetUsers returns the users of all the sources, every source uses its own users filter
+// so the filter parameter is ignored.
+func (i *CompositeIdentityProvider) GetUsers(ctx context.Context, _ []string) (*model.UsersResult, error) {
+	results := make([]*model.UsersResult, len(i.sources))
+	for idx, source := range i.sources {
+		ur, err := source.Provider.GetUsers(ctx, source.UsersFilter)
+		if err != nil {
+			return nil, fmt.Errorf("idp: error getting users from %s: %w", source.Name, err)
+		}
+		results[idx] = ur
+	}
+
+	uResult, err := i.mergeUsers(results)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("idp: composite GetUsers()", "users", uResult.Items)
+
+	return uResult, nil
+}
+
+// GetGroupMembers returns the members of the group in all the sources that are part of it.
+func (i *CompositeIdentityProvider) GetGroupMembers(ctx context.Context, groupID string) (*model.MembersResult, error) {
+	if groupID == "" {
+		return nil, ErrGroupIDNil
+	}
+
+	parts, ok := i.getGroups(groupID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCompositeGroupUnknown, groupID)
+	}
+
+	members := make([][]*model.Member, 0, len(parts))
+	for _, part := range parts {
+		source := i.sources[part.source]
+
+		mr, err := source.Provider.GetGroupMembers(ctx, part.group.IPID)
+		if err != nil {
+			return nil, fmt.Errorf("idp: error getting group members from %s: %w", source.Name, err)
+		}
+
+		i.setMembersSource(mr.Resources, part.source)
+		members = append(members, mr.Resources)
+	}
+
+	syncMembersResult := model.MembersResultBuilder().WithResources(mergeMembers(members...)).Build()
+	slog.Debug("idp: composite GetGroupMembers()", "members", syncMembersResult.Items)
+
+	return syncMembersResult, nil
+}
+
+// GetUsersByGroupsMembers returns the users that are members of the groups, every source
+// returns the users of its members.
+func (i *CompositeIdentityProvider) GetUsersByGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.UsersResult, error) {
+	if gmr == nil {
+		return nil, ErrGroupResultNil
+	}
+
+	bySource := make([][]*model.GroupMembers, len(i.sources))
+	for _, gm := range gmr.Resources {
+		membersBySource := make([][]*model.Member, len(i.sources))
+		for _, member := range gm.Resources {
+			idx, ok := i.getMemberSource(member.IPID)
+			if !ok {
+				// the members were not returned by this provider, the source of the group is used
+				parts, ok := i.getGroups(gm.Group.IPID)
+				if !ok {
+					return nil, fmt.Errorf("%w: %s", ErrCompositeGroupUnknown, gm.Group.IPID)
+				}
+				idx = parts[0].source
+			}
+			membersBySource[idx] = append(membersBySource[idx], member)
+		}
+
+		for idx, members := range membersBySource {
+			if len(members) > 0 {
+				bySource[idx] = append(bySource[idx], model.GroupMembersBuilder().WithGroup(gm.Group).WithResources(members).Build())
+			}
+		}
+	}
+
+	results := make([]*model.UsersResult, len(i.sources))
+	for idx, source := range i.sources {
+		if len(bySource[idx]) == 0 {
+			continue
+		}
+
+		sgmr := model.GroupsMembersResultBuilder().WithResources(bySource[idx]).Build()
+		ur, err := source.Provider.GetUsersByGroupsMembers(ctx, sgmr)
+		if err != nil {
+			return nil, fmt.Errorf("idp: error getting users from %s: %w", source.Name, err)
+		}
+		results[idx] = ur
+	}
+
+	pUsersResult, err := i.mergeUsers(results)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("idp: composite GetUsersByGroupsMembers()", "users", pUsersResult.Items)
+
+	return pUsersResult, nil
+}
+
+// GetGroupsMembers return the members of the groups, every source returns the members of its groups.
+func (i *CompositeIdentityProvider) GetGroupsMembers(ctx context.Context, gr *model.GroupsResult) (*model.GroupsMembersResult, error) {
+	if gr == nil {
+		return nil, ErrGroupResultNil
+	}
+
+	bySource := make([][]*model.Group, len(i.sources))
+	for _, group := range gr.Resources {
+		parts, ok := i.getGroups(group.IPID)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrCompositeGroupUnknown, group.IPID)
+		}
+
+		for _, part := range parts {
+			bySource[part.source] = append(bySource[part.source], part.group)
+		}
+	}
+
+	// members of every group of every source, by source and group IPID
+	membersBySource := make([]map[string][]*model.Member, len(i.sources))
+	for idx, source := range i.sources {
+		if len(bySource[idx]) == 0 {
+			continue
+		}
+
+		sgr := model.GroupsResultBuilder().WithResources(bySource[idx]).Build()
+		gmr, err := source.Provider.GetGroupsMembers(ctx, sgr)
+		if err != nil {
+			return nil, fmt.Errorf("idp: error getting groups members from %s: %w", source.Name, err)
+		}
+
+		membersBySource[idx] = make(map[string][]*model.Member, len(gmr.Resources))
+		for _, gm := range gmr.Resources {
+			i.setMembersSource(gm.Resources, idx)
+			membersBySource[idx][gm.Group.IPID] = gm.Resources
+		}
+	}
+
+	groupMembers := make([]*model.GroupMembers, 0, len(gr.Resources))
+	for _, group := range gr.Resources {
+		parts, _ := i.getGroups(group.IPID)
+
+		members := make([][]*model.Member, 0, len(parts))
+		for _, part := range parts {
+			members = append(members, membersBySource[part.source][part.group.IPID])
+		}
+
+		groupMember := model.GroupMembersBuilder().
+			WithGroup(group).
+			WithResources(mergeMembers(members...)).
+			Build()
+
+		groupMembers = append(groupMembers, groupMember)
+	}
+
+	groupsMembersResult := model.GroupsMembersResultBuilder().WithResources(groupMembers).Build()
+	slog.Debug("idp: composite GetGroupsMembers()", "groups", len(groupMembers))
+
+	return groupsMembersResult, nil
+}
+
+// mergeUsers merges the users of the sources, in precedence order, tagging them with their origin
+// and applying the users conflict policy.
+func (i *CompositeIdentityProvider) mergeUsers(results []*model.UsersResult) (*model.UsersResult, error) {
+	origins := make(map[string]string)
+	users := make([]*model.User, 0)
+
+	for idx, ur := range results {
+		if ur == nil {
+			continue
+		}
+
+		source := i.sources[idx]
+		for _, user := range ur.Resources {
+			keys := []string{"userName:" + user.UserName, "email:" + strings.ToLower(user.GetPrimaryEmailAddress())}
+
+			origin, conflict := "", false
+			for _, key := range keys {
+				if o, ok := origins[key]; ok {
+					origin, conflict = o, true
+					break
+				}
+			}
+
+			if conflict {
+				// the same user returned by the same source, example: member of several groups
+				if origin == source.Name {
+					continue
+				}
+
+				if i.usersConflict == CompositeConflictError {
+					return nil, fmt.Errorf("%w: user %s in %s and %s", ErrCompositeConflict, user.UserName, origin, source.Name)
+				}
+
+				slog.Warn("idp: user already exists in a source with higher precedence, this user will be avoided",
+					"userName", user.UserName,
+					"origin", origin,
+					"source", source.Name,
+				)
+				continue
+			}
+
+			for _, key := range keys {
+				origins[key] = source.Name
+			}
+
+			user.Origin = source.Name
+			users = append(users, user)
+		}
+	}
+
+	return model.UsersResultBuilder().WithResources(users).Build(), nil
+}
+
+// mergeMembers merges the members avoiding the repeated emails, the first occurrence is kept.
+func mergeMembers(members ...[]*model.Member) []*model.Member {
+	uniqMembers := make(map[string]struct{})
+	merged := make([]*model.Member, 0)
+
+	for _, mbrs := range members {
+		for _, member := range mbrs {
+			key := strings.ToLower(member.Email)
+			if key == "" {
+				key = member.IPID
+			}
+
+			if _, ok := uniqMembers[key]; ok {
+				continue
+			}
+			uniqMembers[key] = struct{}{}
+
+			merged = append(merged, member)
+		}
+	}
+
+	return merged
+}
+
+func (i *CompositeIdentityProvider) setGroups(ipid string, parts []compositeGroup) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.groups[ipid] = parts
+}
+
+func (i *CompositeIdentityProvider) addGroup(ipid string, part compositeGroup) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.groups[ipid] = append(i.groups[ipid], part)
+}
+
+func (i *CompositeIdentityProvider) getGroups(ipid string) ([]compositeGroup, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	parts, ok := i.groups[ipid]
+	return parts, ok
+}
+
+func (i *CompositeIdentityProvider) setMembersSource(members []*model.Member, idx int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, member := range members {
+		if _, ok := i.membersSource[member.IPID]; !ok {
+			i.membersSource[member.IPID] = idx
+		}
+	}
+}
+
+func (i *CompositeIdentityProvider) getMemberSource(ipid string) (int, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	idx, ok := i.membersSource[ipid]
+	return idx, ok
+}
@@ -0,0 +1,387 @@
+package idp
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/idp"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestNewCompositeIdentityProvider(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockIDP := mocks.NewMockCompositeProviderService(mockCtrl)
+
+	t.Run("empty sources", func(t *testing.T) {
+		got, err := NewCompositeIdentityProvider(nil)
+		assert.ErrorIs(t, err, ErrCompositeSourcesEmpty)
+		assert.Nil(t, got)
+	})
+
+	t.Run("nil provider", func(t *testing.T) {
+		got, err := NewCompositeIdentityProvider([]CompositeSource{{Name: "google"}})
+		assert.ErrorIs(t, err, ErrCompositeSourceNil)
+		assert.Nil(t, got)
+	})
+
+	t.Run("duplicated name", func(t *testing.T) {
+		got, err := NewCompositeIdentityProvider([]CompositeSource{{Name: "google", Provider: mockIDP}, {Name: "google", Provider: mockIDP}})
+		assert.ErrorIs(t, err, ErrCompositeSourceNameDuplicated)
+		assert.Nil(t, got)
+	})
+
+	t.Run("unknown precedence source", func(t *testing.T) {
+		got, err := NewCompositeIdentityProvider([]CompositeSource{{Name: "google", Provider: mockIDP}}, WithCompositePrecedence("okta"))
+		assert.ErrorIs(t, err, ErrCompositeSourceUnknown)
+		assert.Nil(t, got)
+	})
+
+	t.Run("invalid conflict policies", func(t *testing.T) {
+		sources := []CompositeSource{{Name: "google", Provider: mockIDP}}
+
+		got, err := NewCompositeIdentityProvider(sources, WithCompositeGroupsConflictPolicy("first"))
+		assert.ErrorIs(t, err, ErrCompositeConflictPolicyInvalid)
+		assert.Nil(t, got)
+
+		// the members of the users cannot be merged
+		got, err = NewCompositeIdentityProvider(sources, WithCompositeUsersConflictPolicy(CompositeConflictMerge))
+		assert.ErrorIs(t, err, ErrCompositeConflictPolicyInvalid)
+		assert.Nil(t, got)
+	})
+
+	t.Run("precedence", func(t *testing.T) {
+		got, err := NewCompositeIdentityProvider(
+			[]CompositeSource{{Name: "a", Provider: mockIDP}, {Name: "b", Provider: mockIDP}, {Name: "c", Provider: mockIDP}},
+			WithCompositePrecedence("c"),
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, "c", got.sources[0].Name)
+		assert.Equal(t, "a", got.sources[1].Name)
+		assert.Equal(t, "b", got.sources[2].Name)
+	})
+}
+
+func TestCompositeIdentityProvider(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx := context.TODO()
+
+	// the google side
+	mockIDP := mocks.NewMockCompositeProviderService(mockCtrl)
+
+	googleUser := model.UserBuilder().
+		WithIPID("g-1").
+		WithUserName("user.1@example.com").
+		WithName(model.NameBuilder().WithGivenName("user").WithFamilyName("1").Build()).
+		WithEmail(model.EmailBuilder().WithValue("user.1@example.com").WithPrimary(true).Build()).
+		Build()
+	duplicatedUser := model.UserBuilder().
+		WithIPID("g-2").
+		WithUserName("break.glass@example.com").
+		WithName(model.NameBuilder().WithGivenName("google").WithFamilyName("user").Build()).
+		Build()
+
+	googleGroups := model.GroupsResultBuilder().WithResources([]*model.Group{
+		model.GroupBuilder().WithIPID("g-group-1").WithName("AWS-Developers").Build(),
+		model.GroupBuilder().WithIPID("g-group-2").WithName("AWS-Admins").Build(),
+	}).Build()
+
+	googleMember := model.MemberBuilder().WithIPID("g-1").WithEmail("user.1@example.com").WithStatus("ACTIVE").Build()
+
+	mockIDP.EXPECT().GetGroups(ctx, []string{"name:AWS*"}).Return(googleGroups, nil).AnyTimes()
+	mockIDP.EXPECT().GetUsers(ctx, []string{"orgUnitPath=/Engineering"}).Return(
+		model.UsersResultBuilder().WithResources([]*model.User{googleUser, duplicatedUser}).Build(), nil,
+	).AnyTimes()
+	mockIDP.EXPECT().GetGroupMembers(ctx, "g-group-1").Return(
+		model.MembersResultBuilder().WithResources([]*model.Member{googleMember}).Build(), nil,
+	).AnyTimes()
+	mockIDP.EXPECT().GetGroupsMembers(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, gr *model.GroupsResult) (*model.GroupsMembersResult, error) {
+		// only the groups of the google side are requested
+		assert.Equal(t, 1, gr.Items)
+		assert.Equal(t, "g-group-1", gr.Resources[0].IPID)
+
+		return model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+			model.GroupMembersBuilder().WithGroup(gr.Resources[0]).WithResources([]*model.Member{googleMember}).Build(),
+		}).Build(), nil
+	}).AnyTimes()
+	mockIDP.EXPECT().GetUsersByGroupsMembers(ctx, gomock.Any()).Return(
+		model.UsersResultBuilder().WithResources([]*model.User{googleUser}).Build(), nil,
+	).AnyTimes()
+
+	// the file side
+	dir := writeTestFiles(t, map[string]string{"identities.yaml": testFileYAML})
+	fileIDP, err := NewFileIdentityProvider(filepath.Join(dir, "identities.yaml"))
+	assert.NoError(t, err)
+
+	compositeIDP, err := NewCompositeIdentityProvider([]CompositeSource{
+		{Name: "google", Provider: mockIDP, GroupsFilter: []string{"name:AWS*"}, UsersFilter: []string{"orgUnitPath=/Engineering"}},
+		{Name: "file", Provider: fileIDP},
+	})
+	assert.NoError(t, err)
+
+	t.Run("GetGroups avoids the groups of the next sources with the same name", func(t *testing.T) {
+		got, err := compositeIDP.GetGroups(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, got.Items)
+		assert.Equal(t, "g-group-1", got.Resources[0].IPID)
+		assert.Equal(t, "g-group-2", got.Resources[1].IPID)
+		assert.Equal(t, "Other", got.Resources[2].IPID)
+
+		assert.Equal(t, "google", got.Resources[0].Origin)
+		assert.Equal(t, "file", got.Resources[2].Origin)
+	})
+
+	t.Run("GetUsers avoids the users of the next sources with the same userName", func(t *testing.T) {
+		got, err := compositeIDP.GetUsers(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, got.Items)
+		assert.Equal(t, "g-2", got.Resources[1].IPID)
+		assert.Equal(t, "ci@example.com", got.Resources[2].UserName)
+
+		assert.Equal(t, "google", got.Resources[1].Origin)
+		assert.Equal(t, "file", got.Resources[2].Origin)
+	})
+
+	t.Run("GetGroupsMembers and GetUsersByGroupsMembers use the source of the groups", func(t *testing.T) {
+		groups := model.GroupsResultBuilder().WithResources([]*model.Group{
+			model.GroupBuilder().WithIPID("Other").WithName("Other").Build(),
+			model.GroupBuilder().WithIPID("g-group-1").WithName("AWS-Developers").Build(),
+		}).Build()
+
+		gmr, err := compositeIDP.GetGroupsMembers(ctx, groups)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, gmr.Items)
+		assert.Equal(t, "Other", gmr.Resources[0].Group.IPID)
+		assert.Equal(t, 0, gmr.Resources[0].Items)
+		assert.Equal(t, "g-group-1", gmr.Resources[1].Group.IPID)
+		assert.Equal(t, 1, gmr.Resources[1].Items)
+
+		users, err := compositeIDP.GetUsersByGroupsMembers(ctx, gmr)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, users.Items)
+		assert.Equal(t, "g-1", users.Resources[0].IPID)
+	})
+
+	t.Run("GetGroupMembers", func(t *testing.T) {
+		got, err := compositeIDP.GetGroupMembers(ctx, "g-group-1")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, got.Items)
+
+		got, err = compositeIDP.GetGroupMembers(ctx, "unknown")
+		assert.ErrorIs(t, err, ErrCompositeGroupUnknown)
+		assert.Nil(t, got)
+
+		got, err = compositeIDP.GetGroupMembers(ctx, "")
+		assert.ErrorIs(t, err, ErrGroupIDNil)
+		assert.Nil(t, got)
+	})
+
+	t.Run("unknown groups", func(t *testing.T) {
+		groups := model.GroupsResultBuilder().WithResources([]*model.Group{
+			model.GroupBuilder().WithIPID("unknown").WithName("unknown").Build(),
+		}).Build()
+
+		gmr, err := compositeIDP.GetGroupsMembers(ctx, groups)
+		assert.ErrorIs(t, err, ErrCompositeGroupUnknown)
+		assert.Nil(t, gmr)
+	})
+}
+
+func TestCompositeIdentityProvider_Errors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx := context.TODO()
+
+	mockIDP := mocks.NewMockCompositeProviderService(mockCtrl)
+	mockIDP.EXPECT().GetGroups(ctx, nil).Return(nil, errors.New("test error")).Times(1)
+	mockIDP.EXPECT().GetUsers(ctx, nil).Return(nil, errors.New("test error")).Times(1)
+
+	compositeIDP, err := NewCompositeIdentityProvider([]CompositeSource{{Name: "google", Provider: mockIDP}})
+	assert.NoError(t, err)
+
+	gr, err := compositeIDP.GetGroups(ctx, nil)
+	assert.Error(t, err)
+	assert.Nil(t, gr)
+
+	ur, err := compositeIDP.GetUsers(ctx, nil)
+	assert.Error(t, err)
+	assert.Nil(t, ur)
+
+	gmr, err := compositeIDP.GetGroupsMembers(ctx, nil)
+	assert.ErrorIs(t, err, ErrGroupResultNil)
+	assert.Nil(t, gmr)
+
+	ur, err = compositeIDP.GetUsersByGroupsMembers(ctx, nil)
+	assert.ErrorIs(t, err, ErrGroupResultNil)
+	assert.Nil(t, ur)
+}
+
+func TestCompositeIdentityProvider_ConflictPolicies(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx := context.TODO()
+
+	newUser := func(ipid, userName, email string) *model.User {
+		return model.UserBuilder().
+			WithIPID(ipid).
+			WithUserName(userName).
+			WithName(model.NameBuilder().WithGivenName("user").WithFamilyName(ipid).Build()).
+			WithEmail(model.EmailBuilder().WithValue(email).WithPrimary(true).Build()).
+			Build()
+	}
+
+	// tenant a
+	mockA := mocks.NewMockCompositeProviderService(mockCtrl)
+	groupA := model.GroupBuilder().WithIPID("a-group-1").WithName("AWS-Admins").Build()
+	memberA := model.MemberBuilder().WithIPID("a-1").WithEmail("user.1@example.com").WithStatus("ACTIVE").Build()
+	sharedA := model.MemberBuilder().WithIPID("a-2").WithEmail("shared@example.com").WithStatus("ACTIVE").Build()
+
+	mockA.EXPECT().GetGroups(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, _ []string) (*model.GroupsResult, error) {
+		return model.GroupsResultBuilder().WithResources([]*model.Group{
+			model.GroupBuilder().WithIPID("a-group-1").WithName("AWS-Admins").Build(),
+		}).Build(), nil
+	}).AnyTimes()
+	mockA.EXPECT().GetUsers(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, _ []string) (*model.UsersResult, error) {
+		return model.UsersResultBuilder().WithResources([]*model.User{
+			newUser("a-1", "user.1@example.com", "user.1@example.com"),
+			newUser("a-2", "shared@a.example.com", "shared@example.com"),
+		}).Build(), nil
+	}).AnyTimes()
+	mockA.EXPECT().GetGroupMembers(ctx, "a-group-1").Return(
+		model.MembersResultBuilder().WithResources([]*model.Member{memberA, sharedA}).Build(), nil,
+	).AnyTimes()
+	mockA.EXPECT().GetGroupsMembers(ctx, gomock.Any()).Return(
+		model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+			model.GroupMembersBuilder().WithGroup(groupA).WithResources([]*model.Member{memberA, sharedA}).Build(),
+		}).Build(), nil,
+	).AnyTimes()
+	mockA.EXPECT().GetUsersByGroupsMembers(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, gmr *model.GroupsMembersResult) (*model.UsersResult, error) {
+		// only the members of tenant a are requested
+		assert.Equal(t, 1, gmr.Items)
+		assert.Equal(t, 2, gmr.Resources[0].Items)
+
+		return model.UsersResultBuilder().WithResources([]*model.User{
+			newUser("a-1", "user.1@example.com", "user.1@example.com"),
+			newUser("a-2", "shared@a.example.com", "shared@example.com"),
+		}).Build(), nil
+	}).AnyTimes()
+
+	// tenant b
+	mockB := mocks.NewMockCompositeProviderService(mockCtrl)
+	groupB := model.GroupBuilder().WithIPID("b-group-1").WithName("AWS-Admins").Build()
+	memberB := model.MemberBuilder().WithIPID("b-1").WithEmail("user.2@example.com").WithStatus("ACTIVE").Build()
+	sharedB := model.MemberBuilder().WithIPID("b-2").WithEmail("shared@example.com").WithStatus("ACTIVE").Build()
+
+	mockB.EXPECT().GetGroups(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, _ []string) (*model.GroupsResult, error) {
+		return model.GroupsResultBuilder().WithResources([]*model.Group{
+			model.GroupBuilder().WithIPID("b-group-1").WithName("AWS-Admins").Build(),
+		}).Build(), nil
+	}).AnyTimes()
+	mockB.EXPECT().GetUsers(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, _ []string) (*model.UsersResult, error) {
+		return model.UsersResultBuilder().WithResources([]*model.User{
+			newUser("b-1", "user.2@example.com", "user.2@example.com"),
+			// same primary email with a different userName
+			newUser("b-2", "shared@b.example.com", "SHARED@example.com"),
+		}).Build(), nil
+	}).AnyTimes()
+	mockB.EXPECT().GetGroupMembers(ctx, "b-group-1").Return(
+		model.MembersResultBuilder().WithResources([]*model.Member{memberB, sharedB}).Build(), nil,
+	).AnyTimes()
+	mockB.EXPECT().GetGroupsMembers(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, gr *model.GroupsResult) (*model.GroupsMembersResult, error) {
+		// the group of tenant b is requested with its own id
+		assert.Equal(t, "b-group-1", gr.Resources[0].IPID)
+
+		return model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+			model.GroupMembersBuilder().WithGroup(groupB).WithResources([]*model.Member{memberB, sharedB}).Build(),
+		}).Build(), nil
+	}).AnyTimes()
+	mockB.EXPECT().GetUsersByGroupsMembers(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, gmr *model.GroupsMembersResult) (*model.UsersResult, error) {
+		// the shared member is only requested to tenant a
+		assert.Equal(t, 1, gmr.Items)
+		assert.Equal(t, 1, gmr.Resources[0].Items)
+		assert.Equal(t, "b-1", gmr.Resources[0].Resources[0].IPID)
+
+		return model.UsersResultBuilder().WithResources([]*model.User{
+			newUser("b-1", "user.2@example.com", "user.2@example.com"),
+		}).Build(), nil
+	}).AnyTimes()
+
+	sources := []CompositeSource{{Name: "tenant-a", Provider: mockA}, {Name: "tenant-b", Provider: mockB}}
+
+	t.Run("precedence", func(t *testing.T) {
+		compositeIDP, err := NewCompositeIdentityProvider(sources, WithCompositePrecedence("tenant-b"))
+		assert.NoError(t, err)
+
+		gr, err := compositeIDP.GetGroups(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, gr.Items)
+		assert.Equal(t, "b-group-1", gr.Resources[0].IPID)
+		assert.Equal(t, "tenant-b", gr.Resources[0].Origin)
+
+		ur, err := compositeIDP.GetUsers(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, ur.Items)
+		assert.Equal(t, "b-2", ur.Resources[1].IPID)
+		assert.Equal(t, "a-1", ur.Resources[2].IPID)
+		assert.Equal(t, "tenant-a", ur.Resources[2].Origin)
+
+		mr, err := compositeIDP.GetGroupMembers(ctx, "b-group-1")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, mr.Items)
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		compositeIDP, err := NewCompositeIdentityProvider(sources, WithCompositeGroupsConflictPolicy(CompositeConflictMerge))
+		assert.NoError(t, err)
+
+		gr, err := compositeIDP.GetGroups(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, gr.Items)
+		assert.Equal(t, "a-group-1", gr.Resources[0].IPID)
+		assert.Equal(t, "tenant-a", gr.Resources[0].Origin)
+
+		// the members of both tenants without the repeated emails
+		mr, err := compositeIDP.GetGroupMembers(ctx, "a-group-1")
+		assert.NoError(t, err)
+		assert.Equal(t, 3, mr.Items)
+		assert.Equal(t, "b-1", mr.Resources[2].IPID)
+
+		gmr, err := compositeIDP.GetGroupsMembers(ctx, gr)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, gmr.Items)
+		assert.Equal(t, "a-group-1", gmr.Resources[0].Group.IPID)
+		assert.Equal(t, 3, gmr.Resources[0].Items)
+
+		ur, err := compositeIDP.GetUsersByGroupsMembers(ctx, gmr)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, ur.Items)
+		assert.Equal(t, "tenant-a", ur.Resources[1].Origin)
+		assert.Equal(t, "b-1", ur.Resources[2].IPID)
+		assert.Equal(t, "tenant-b", ur.Resources[2].Origin)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		compositeIDP, err := NewCompositeIdentityProvider(sources,
+			WithCompositeGroupsConflictPolicy(CompositeConflictError),
+			WithCompositeUsersConflictPolicy(CompositeConflictError),
+		)
+		assert.NoError(t, err)
+
+		gr, err := compositeIDP.GetGroups(ctx, nil)
+		assert.ErrorIs(t, err, ErrCompositeConflict)
+		assert.Nil(t, gr)
+
+		ur, err := compositeIDP.GetUsers(ctx, nil)
+		assert.ErrorIs(t, err, ErrCompositeConflict)
+		assert.Nil(t, ur)
+	})
+}
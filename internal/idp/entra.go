@@ -0,0 +1,345 @@
+package idp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"github.com/slashdevops/idp-scim-sync/pkg/msgraph"
+)
+
+// This implement core.IdentityProviderService interface for Microsoft Entra ID (Azure AD)
+
+// ErrGraphServiceNil is returned when the EntraProviderService is nil.
+var ErrGraphServiceNil = errors.New("provider: microsoft graph service is nil")
+
+//go:generate go run go.uber.org/mock/mockgen@v0.5.0 -package=mocks -destination=../../mocks/idp/entra_mocks.go -source=entra.go EntraProviderService
+
+// EntraProviderService is the interface that wraps the Microsoft Graph Service methods.
+type EntraProviderService interface {
+	ListUsers(ctx context.Context, filter []string) ([]*msgraph.User, error)
+	ListGroups(ctx context.Context, filter []string) ([]*msgraph.Group, error)
+	ListGroupTransitiveMembers(ctx context.Context, groupID string) ([]*msgraph.User, error)
+	GetUser(ctx context.Context, userID string) (*msgraph.User, error)
+}
+
+// EntraIdentityProvider is the Identity Provider service that implements the core.IdentityProvider interface and consumes the pkg.msgraph methods.
+type EntraIdentityProvider struct {
+	ps EntraProviderService
+
+	// members are the users returned with the groups members, by id, so the users
+	// of the groups members are built without requesting them again
+	mu      sync.Mutex
+	members map[string]*msgraph.User
+}
+
+// NewEntraIdentityProvider returns a new instance of the Microsoft Entra ID Identity Provider service.
+func NewEntraIdentityProvider(eps EntraProviderService) (*EntraIdentityProvider, error) {
+	if eps == nil {
+		return nil, ErrGraphServiceNil
+	}
+
+	return &EntraIdentityProvider{
+		ps:      eps,
+		members: make(map[string]*msgraph.User),
+	}, nil
+}
+
+// GetGroups returns a list of groups from Microsoft Graph.
+//
+// The filter parameter is a list of OData filters, example: "startswith(displayName,'AWS')".
+//
+// This method checks the names of the groups and avoid the second, third, etc repetition of the same group name.
+func (i *EntraIdentityProvider) GetGroups(ctx context.Context, filter []string) (*model.GroupsResult, error) {
+	pGroups, err := i.ps.ListGroups(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("idp: error getting groups: %w", err)
+	}
+
+	uniqueGroups := make(map[string]struct{}, len(pGroups))
+	syncGroups := make([]*model.Group, 0, len(pGroups))
+	for _, grp := range pGroups {
+		if _, ok := uniqueGroups[grp.DisplayName]; ok {
+			slog.Warn("idp: group already exists with the same name, this group will be avoided, please make your groups uniques by name!",
+				"id", grp.ID,
+				"name", grp.DisplayName,
+				"email", grp.Mail,
+			)
+			continue
+		}
+		uniqueGroups[grp.DisplayName] = struct{}{}
+
+		gg := model.GroupBuilder().
+			WithIPID(grp.ID).
+			WithName(strings.TrimSpace(grp.DisplayName)).
+			WithEmail(strings.TrimSpace(grp.Mail)).
+			Build()
+
+		syncGroups = append(syncGroups, gg)
+	}
+
+	syncResult := model.GroupsResultBuilder().WithResources(syncGroups).Build()
+	slog.Debug("idp: entra GetGroups()", "groups", len(syncGroups))
+
+	return syncResult, nil
+}
+
+// GetUsers returns a list of users from Microsoft Graph.
+//
+// The filter parameter is a list of OData filters, example: "department eq 'Engineering'".
+func (i *EntraIdentityProvider) GetUsers(ctx context.Context, filter []string) (*model.UsersResult, error) {
+	pUsers, err := i.ps.ListUsers(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("idp: error getting users: %w", err)
+	}
+
+	syncUsers := make([]*model.User, 0, len(pUsers))
+	for _, usr := range pUsers {
+		if u := buildEntraUser(usr); u != nil {
+			syncUsers = append(syncUsers, u)
+		}
+	}
+
+	uResult := model.UsersResultBuilder().WithResources(syncUsers).Build()
+	slog.Debug("idp: entra GetUsers()", "users", len(syncUsers))
+
+	return uResult, nil
+}
+
+// GetGroupMembers returns the members of the group, including the members of the nested groups.
+func (i *EntraIdentityProvider) GetGroupMembers(ctx context.Context, groupID string) (*model.MembersResult, error) {
+	if groupID == "" {
+		return nil, ErrGroupIDNil
+	}
+
+	pMembers, err := i.ps.ListGroupTransitiveMembers(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("idp: error getting group members: %w", err)
+	}
+
+	i.mu.Lock()
+	for _, member := range pMembers {
+		i.members[member.ID] = member
+	}
+	i.mu.Unlock()
+
+	syncMembers := make([]*model.Member, 0, len(pMembers))
+	for _, member := range pMembers {
+		status := "ACTIVE"
+		if member.AccountEnabled != nil && !*member.AccountEnabled {
+			status = "SUSPENDED"
+		}
+
+		gm := model.MemberBuilder().
+			WithIPID(member.ID).
+			WithEmail(entraUserEmail(member)).
+			WithStatus(status).
+			Build()
+
+		syncMembers = append(syncMembers, gm)
+	}
+
+	syncMembersResult := model.MembersResultBuilder().WithResources(syncMembers).Build()
+	slog.Debug("idp: entra GetGroupMembers()", "members", len(syncMembers))
+
+	return syncMembersResult, nil
+}
+
+// GetUsersByGroupsMembers returns the users that are members of the groups.
+//
+// The users are built from the members returned by GetGroupMembers, only the users
+// not returned there are requested to Microsoft Graph.
+func (i *EntraIdentityProvider) GetUsersByGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.UsersResult, error) {
+	if gmr == nil {
+		return nil, ErrGroupResultNil
+	}
+
+	uniqUsers := make(map[string]struct{}, len(gmr.Resources))
+	pUsers := make([]*model.User, 0, len(gmr.Resources))
+	for _, groupMembers := range gmr.Resources {
+		for _, member := range groupMembers.Resources {
+			if _, ok := uniqUsers[member.IPID]; ok {
+				continue
+			}
+			uniqUsers[member.IPID] = struct{}{}
+
+			i.mu.Lock()
+			u, ok := i.members[member.IPID]
+			i.mu.Unlock()
+
+			if !ok {
+				var err error
+				u, err = i.ps.GetUser(ctx, member.IPID)
+				if err != nil {
+					return nil, fmt.Errorf("idp: error getting user: %+v, email: %s, error: %w", member.IPID, member.Email, err)
+				}
+			}
+
+			if gu := buildEntraUser(u); gu != nil {
+				pUsers = append(pUsers, gu)
+			}
+		}
+	}
+
+	pUsersResult := model.UsersResultBuilder().WithResources(pUsers).Build()
+	slog.Debug("idp: entra GetUsersByGroupsMembers()", "users", len(pUsers))
+
+	return pUsersResult, nil
+}
+
+// GetGroupsMembers return the members of the groups
+func (i *EntraIdentityProvider) GetGroupsMembers(ctx context.Context, gr *model.GroupsResult) (*model.GroupsMembersResult, error) {
+	if gr == nil {
+		return nil, ErrGroupResultNil
+	}
+
+	groupMembers := make([]*model.GroupMembers, 0, len(gr.Resources))
+	for _, group := range gr.Resources {
+		members, err := i.GetGroupMembers(ctx, group.IPID)
+		if err != nil {
+			return nil, fmt.Errorf("idp: error getting group members: %w", err)
+		}
+
+		ggm := model.GroupBuilder().
+			WithIPID(group.IPID).
+			WithName(group.Name).
+			WithEmail(group.Email).
+			Build()
+
+		groupMember := model.GroupMembersBuilder().
+			WithGroup(ggm).
+			WithResources(members.Resources).
+			Build()
+
+		groupMembers = append(groupMembers, groupMember)
+	}
+
+	groupsMembersResult := model.GroupsMembersResultBuilder().WithResources(groupMembers).Build()
+	slog.Debug("idp: entra GetGroupsMembers()", "groups", len(groupMembers))
+
+	return groupsMembersResult, nil
+}
+
+// entraUserEmail returns the mail of the user, or the user principal name when the user doesn't have a mailbox.
+func entraUserEmail(usr *msgraph.User) string {
+	if usr.Mail != "" {
+		return strings.TrimSpace(usr.Mail)
+	}
+	return strings.TrimSpace(usr.UserPrincipalName)
+}
+
+// buildEntraUser builds a User model from a User coming from the Microsoft Graph API
+func buildEntraUser(usr *msgraph.User) *model.User {
+	if usr == nil {
+		return nil
+	}
+
+	// these fields are required because the Constrains defined here:
+	// https://docs.aws.amazon.com/singlesignon/latest/developerguide/createuser.html
+	if usr.GivenName == "" {
+		slog.Warn("idp: User given name is empty", "id", usr.ID, "userPrincipalName", usr.UserPrincipalName)
+		return nil
+	}
+
+	if usr.Surname == "" {
+		slog.Warn("idp: User surname is empty", "id", usr.ID, "userPrincipalName", usr.UserPrincipalName)
+		return nil
+	}
+
+	if usr.UserPrincipalName == "" {
+		slog.Warn("idp: User principal name is empty", "id", usr.ID)
+		return nil
+	}
+
+	emails := []model.Email{
+		model.EmailBuilder().
+			WithPrimary(true).
+			WithType("work").
+			WithValue(entraUserEmail(usr)).
+			Build(),
+	}
+
+	var phoneNumbers []model.PhoneNumber
+	if len(usr.BusinessPhones) > 0 && usr.BusinessPhones[0] != "" {
+		phoneNumbers = append(phoneNumbers,
+			model.PhoneNumberBuilder().
+				WithValue(strings.TrimSpace(usr.BusinessPhones[0])).
+				WithType("work").
+				Build())
+	} else if usr.MobilePhone != "" {
+		phoneNumbers = append(phoneNumbers,
+			model.PhoneNumberBuilder().
+				WithValue(strings.TrimSpace(usr.MobilePhone)).
+				WithType("mobile").
+				Build())
+	}
+
+	var addresses []model.Address
+	if usr.StreetAddress != "" || usr.City != "" || usr.State != "" || usr.PostalCode != "" || usr.Country != "" {
+		formatted := make([]string, 0, 5)
+		for _, v := range []string{usr.StreetAddress, usr.City, usr.State, usr.PostalCode, usr.Country} {
+			if v = strings.TrimSpace(v); v != "" {
+				formatted = append(formatted, v)
+			}
+		}
+
+		addresses = append(addresses,
+			model.AddressBuilder().
+				WithFormatted(strings.Join(formatted, ", ")).
+				WithStreetAddress(strings.TrimSpace(usr.StreetAddress)).
+				WithLocality(strings.TrimSpace(usr.City)).
+				WithRegion(strings.TrimSpace(usr.State)).
+				WithPostalCode(strings.TrimSpace(usr.PostalCode)).
+				WithCountry(strings.TrimSpace(usr.Country)).
+				Build())
+	}
+
+	var enterpriseData *model.EnterpriseData
+	if usr.EmployeeID != "" || usr.CompanyName != "" || usr.Department != "" {
+		enterpriseData = model.EnterpriseDataBuilder().
+			WithEmployeeNumber(strings.TrimSpace(usr.EmployeeID)).
+			WithOrganization(strings.TrimSpace(usr.CompanyName)).
+			WithDepartment(strings.TrimSpace(usr.Department)).
+			Build()
+	}
+
+	displayName := strings.TrimSpace(usr.DisplayName)
+	if displayName == "" {
+		displayName = fmt.Sprintf("%s %s", strings.TrimSpace(usr.GivenName), strings.TrimSpace(usr.Surname))
+	}
+
+	name := model.NameBuilder().
+		WithGivenName(strings.TrimSpace(usr.GivenName)).
+		WithFamilyName(strings.TrimSpace(usr.Surname)).
+		WithFormatted(displayName).
+		Build()
+
+	// accountEnabled is only returned when it is selected, a missing value means enabled
+	active := usr.AccountEnabled == nil || *usr.AccountEnabled
+
+	userModel := model.UserBuilder().
+		WithIPID(strings.TrimSpace(usr.ID)).
+		WithUserName(strings.TrimSpace(usr.UserPrincipalName)).
+		WithDisplayName(displayName).
+		WithNickName(usr.GivenName, usr.Surname).
+		WithTitle(strings.TrimSpace(usr.JobTitle)).
+		WithUserType(strings.TrimSpace(usr.UserType)).
+		WithPreferredLanguage(strings.TrimSpace(usr.PreferredLanguage)).
+		WithActive(active).
+		// Arrays
+		WithEmails(emails).
+		WithAddresses(addresses).
+		WithPhoneNumbers(phoneNumbers).
+		// Pointers
+		WithName(name).
+		WithEnterpriseData(enterpriseData).
+		Build()
+
+	slog.Debug("idp: buildEntraUser() converted user", "from", usr, "to", userModel)
+
+	return userModel
+}
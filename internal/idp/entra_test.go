@@ -0,0 +1,195 @@
+package idp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/idp"
+	"github.com/slashdevops/idp-scim-sync/pkg/msgraph"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+// newGraphServer returns an httptest stand-in for the Microsoft Graph API
+func newGraphServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	users := map[string]string{
+		"user-1": `{"id": "user-1", "userPrincipalName": "user.1@mail.com", "mail": "user.1@mail.com", "displayName": "user 1", "givenName": "user", "surname": "1", "jobTitle": "engineer", "department": "IT", "employeeId": "0001", "businessPhones": ["+34 000 000 001"], "city": "Madrid", "country": "Spain", "accountEnabled": true}`,
+		"user-2": `{"id": "user-2", "userPrincipalName": "user.2@tenant.onmicrosoft.com", "givenName": "user", "surname": "2", "accountEnabled": false}`,
+		"user-3": `{"id": "user-3", "userPrincipalName": "user.3@mail.com", "displayName": "user without surname", "givenName": "user"}`,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Logf("Calling Graph API with method: %s, path: %s, query: %s", r.Method, r.URL.Path, r.URL.RawQuery)
+
+		switch r.URL.Path {
+		case "/groups":
+			fmt.Fprint(w, `{"value": [
+				{"id": "group-1", "displayName": "group 1", "mail": "group.1@mail.com"},
+				{"id": "group-2", "displayName": "group 2"},
+				{"id": "group-3", "displayName": "group 1"}
+			]}`)
+		case "/groups/group-1/transitiveMembers/microsoft.graph.user":
+			fmt.Fprintf(w, `{"value": [%s, %s]}`, users["user-1"], users["user-2"])
+		case "/groups/group-2/transitiveMembers/microsoft.graph.user":
+			fmt.Fprintf(w, `{"value": [%s]}`, users["user-1"])
+		case "/users":
+			fmt.Fprintf(w, `{"value": [%s, %s, %s]}`, users["user-1"], users["user-2"], users["user-3"])
+		case "/users/user-1", "/users/user-2", "/users/user-3":
+			fmt.Fprint(w, users[r.URL.Path[len("/users/"):]])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error": {"code": "Request_ResourceNotFound", "message": "not found"}}`)
+		}
+	}))
+}
+
+func TestNewEntraIdentityProvider(t *testing.T) {
+	got, err := NewEntraIdentityProvider(nil)
+	assert.ErrorIs(t, err, ErrGraphServiceNil)
+	assert.Nil(t, got)
+}
+
+func TestEntraIdentityProvider(t *testing.T) {
+	ctx := context.TODO()
+
+	srv := newGraphServer(t)
+	defer srv.Close()
+
+	graph, err := msgraph.NewService(srv.Client(), srv.URL)
+	assert.NoError(t, err)
+
+	entra, err := NewEntraIdentityProvider(graph)
+	assert.NoError(t, err)
+
+	t.Run("GetGroups avoids repeated group names", func(t *testing.T) {
+		got, err := entra.GetGroups(ctx, []string{"startswith(displayName,'group')"})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, got.Items)
+		assert.Equal(t, "group-1", got.Resources[0].IPID)
+		assert.Equal(t, "group.1@mail.com", got.Resources[0].Email)
+		assert.Equal(t, "group-2", got.Resources[1].IPID)
+	})
+
+	t.Run("GetUsers skips users without the required attributes", func(t *testing.T) {
+		got, err := entra.GetUsers(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, got.Items)
+
+		user1 := got.Resources[0]
+		assert.Equal(t, "user-1", user1.IPID)
+		assert.Equal(t, "user.1@mail.com", user1.UserName)
+		assert.Equal(t, "user 1", user1.DisplayName)
+		assert.Equal(t, "engineer", user1.Title)
+		assert.True(t, user1.Active)
+		assert.Equal(t, "user.1@mail.com", user1.GetPrimaryEmailAddress())
+		assert.Equal(t, "+34 000 000 001", user1.PhoneNumbers[0].Value)
+		assert.Equal(t, "Madrid, Spain", user1.Addresses[0].Formatted)
+		assert.Equal(t, "0001", user1.EnterpriseData.EmployeeNumber)
+		assert.Equal(t, "IT", user1.EnterpriseData.Department)
+
+		user2 := got.Resources[1]
+		assert.False(t, user2.Active)
+		assert.Equal(t, "user 2", user2.DisplayName)
+		// without mailbox the user principal name is the email
+		assert.Equal(t, "user.2@tenant.onmicrosoft.com", user2.GetPrimaryEmailAddress())
+	})
+
+	t.Run("GetGroupsMembers and GetUsersByGroupsMembers", func(t *testing.T) {
+		groups, err := entra.GetGroups(ctx, nil)
+		assert.NoError(t, err)
+
+		gmr, err := entra.GetGroupsMembers(ctx, groups)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, gmr.Items)
+		assert.Equal(t, 2, gmr.Resources[0].Items)
+		assert.Equal(t, "ACTIVE", gmr.Resources[0].Resources[0].Status)
+		assert.Equal(t, "SUSPENDED", gmr.Resources[0].Resources[1].Status)
+		assert.Equal(t, 1, gmr.Resources[1].Items)
+
+		users, err := entra.GetUsersByGroupsMembers(ctx, gmr)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, users.Items)
+	})
+
+	t.Run("GetGroupMembers with empty group id", func(t *testing.T) {
+		got, err := entra.GetGroupMembers(ctx, "")
+		assert.ErrorIs(t, err, ErrGroupIDNil)
+		assert.Nil(t, got)
+	})
+
+	t.Run("GetUsersByGroupsMembers with nil groups members", func(t *testing.T) {
+		got, err := entra.GetUsersByGroupsMembers(ctx, nil)
+		assert.ErrorIs(t, err, ErrGroupResultNil)
+		assert.Nil(t, got)
+	})
+
+	t.Run("GetGroupsMembers returns the graph errors", func(t *testing.T) {
+		groups := model.GroupsResultBuilder().WithResources([]*model.Group{
+			model.GroupBuilder().WithIPID("group-unknown").WithName("unknown").Build(),
+		}).Build()
+
+		got, err := entra.GetGroupsMembers(ctx, groups)
+		assert.Error(t, err)
+		assert.Nil(t, got)
+
+		var httpErr *msgraph.HTTPResponseError
+		assert.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+	})
+}
+
+func TestEntraIdentityProvider_GetUsers_Error(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockGraph := mocks.NewMockEntraProviderService(mockCtrl)
+	mockGraph.EXPECT().ListUsers(gomock.Any(), gomock.Any()).Return(nil, errors.New("test error")).Times(1)
+
+	entra, err := NewEntraIdentityProvider(mockGraph)
+	assert.NoError(t, err)
+
+	got, err := entra.GetUsers(context.TODO(), nil)
+	assert.Error(t, err)
+	assert.Nil(t, got)
+}
+
+func TestEntraIdentityProvider_GetUsersByGroupsMembers(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx := context.TODO()
+
+	user1 := &msgraph.User{ID: "user-1", UserPrincipalName: "user.1@mail.com", GivenName: "user", Surname: "1"}
+	user2 := &msgraph.User{ID: "user-2", UserPrincipalName: "user.2@mail.com", GivenName: "user", Surname: "2"}
+
+	mockGraph := mocks.NewMockEntraProviderService(mockCtrl)
+	mockGraph.EXPECT().ListGroupTransitiveMembers(ctx, "group-1").Return([]*msgraph.User{user1}, nil).Times(1)
+	// only the member not returned with the groups members is requested
+	mockGraph.EXPECT().GetUser(ctx, "user-2").Return(user2, nil).Times(1)
+
+	entra, err := NewEntraIdentityProvider(mockGraph)
+	assert.NoError(t, err)
+
+	groups := model.GroupsResultBuilder().WithResources([]*model.Group{
+		model.GroupBuilder().WithIPID("group-1").WithName("group 1").Build(),
+	}).Build()
+
+	gmr, err := entra.GetGroupsMembers(ctx, groups)
+	assert.NoError(t, err)
+
+	gmr.Resources[0].Resources = append(gmr.Resources[0].Resources,
+		model.MemberBuilder().WithIPID("user-2").WithEmail("user.2@mail.com").Build())
+
+	got, err := entra.GetUsersByGroupsMembers(ctx, gmr)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, got.Items)
+	assert.Equal(t, "user.1@mail.com", got.Resources[0].UserName)
+	assert.Equal(t, "user.2@mail.com", got.Resources[1].UserName)
+}
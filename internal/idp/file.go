@@ -0,0 +1,594 @@
+package idp
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/slashdevops/idp-scim-sync/internal/deepcopy"
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"gopkg.in/yaml.v3"
+)
+
+// This implement core.IdentityProviderService interface for users and groups declared in local files
+
+var (
+	// ErrFilePathEmpty is returned when the file path is empty.
+	ErrFilePathEmpty = errors.New("provider: file path is empty")
+
+	// ErrFileFormatUnsupported is returned when the file extension is not .yaml, .yml, .json or .csv.
+	ErrFileFormatUnsupported = errors.New("provider: unsupported file format")
+
+	// ErrFileCSVHeaderUnknown is returned when a csv file header is not a users or a groups members header.
+	ErrFileCSVHeaderUnknown = errors.New("provider: unknown csv header")
+)
+
+// fileUser is a model.User where the active field is optional, the users are active by default.
+type fileUser struct {
+	model.User
+	Active *bool `json:"active,omitempty"`
+}
+
+// fileDocument is the content of the YAML and JSON files,
+// users has the shape of model.UsersResult and groupsMembers of model.GroupsMembersResult.
+type fileDocument struct {
+	Users struct {
+		Resources []*fileUser `json:"resources"`
+	} `json:"users"`
+	GroupsMembers struct {
+		Resources []*model.GroupMembers `json:"resources"`
+	} `json:"groupsMembers"`
+}
+
+// FileIdentityProvider is the Identity Provider service that implements the core.IdentityProvider interface
+// and reads the users, groups and groups members from YAML, JSON or CSV files.
+//
+// The users are identified by their userName and the groups by their name, unless the files set their ipid.
+type FileIdentityProvider struct {
+	users  []*model.User
+	groups []*model.GroupMembers
+}
+
+// NewFileIdentityProvider returns a new instance of the File Identity Provider service with the content
+// of the given file, or of all the .yaml, .yml, .json and .csv files of the given directory.
+func NewFileIdentityProvider(filePath string) (*FileIdentityProvider, error) {
+	if filePath == "" {
+		return nil, ErrFilePathEmpty
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("idp: error reading %s: %w", filePath, err)
+	}
+
+	files := []string{filePath}
+	if info.IsDir() {
+		entries, err := os.ReadDir(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("idp: error reading directory %s: %w", filePath, err)
+		}
+
+		files = make([]string, 0, len(entries))
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+
+			switch strings.ToLower(filepath.Ext(entry.Name())) {
+			case ".yaml", ".yml", ".json", ".csv":
+				files = append(files, filepath.Join(filePath, entry.Name()))
+			}
+		}
+	}
+
+	i := &FileIdentityProvider{}
+
+	users := make([]*fileUser, 0)
+	groups := make([]*model.GroupMembers, 0)
+	for _, file := range files {
+		doc, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, doc.Users.Resources...)
+		groups = append(groups, doc.GroupsMembers.Resources...)
+	}
+
+	i.addUsers(users)
+	i.addGroups(groups)
+
+	slog.Debug("idp: file NewFileIdentityProvider()", "path", filePath, "files", len(files), "users", len(i.users), "groups", len(i.groups))
+
+	return i, nil
+}
+
+// readFile reads a YAML, JSON or CSV file
+func readFile(file string) (*fileDocument, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("idp: error opening %s: %w", file, err)
+	}
+	defer f.Close()
+
+	doc := &fileDocument{}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		err = json.NewDecoder(f).Decode(doc)
+	case ".yaml", ".yml":
+		err = decodeYAML(f, doc)
+	case ".csv":
+		err = decodeCSV(f, doc)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrFileFormatUnsupported, file)
+	}
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("idp: error decoding %s: %w", file, err)
+	}
+
+	return doc, nil
+}
+
+// decodeYAML decodes the YAML content using the json tags of the model
+func decodeYAML(r io.Reader, doc *fileDocument) error {
+	var content any
+	if err := yaml.NewDecoder(r).Decode(&content); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, doc)
+}
+
+// decodeCSV decodes a users csv file, with a userName column, or a groups members csv file, with a groupName column,
+// in the groups members files every row is a member of a group, a row without memberEmail declares a group without members.
+func decodeCSV(r io.Reader, doc *fileDocument) error {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	header := make(map[string]int, len(records[0]))
+	for idx, column := range records[0] {
+		header[strings.TrimSpace(column)] = idx
+	}
+
+	get := func(record []string, column string) string {
+		if idx, ok := header[column]; ok && idx < len(record) {
+			return strings.TrimSpace(record[idx])
+		}
+		return ""
+	}
+
+	if _, ok := header["groupName"]; ok {
+		for column := range header {
+			switch column {
+			case "groupIpid", "groupName", "groupEmail", "memberIpid", "memberEmail":
+			default:
+				return fmt.Errorf("%w: %s", ErrFileCSVHeaderUnknown, column)
+			}
+		}
+
+		for _, record := range records[1:] {
+			gm := &model.GroupMembers{
+				Group: &model.Group{
+					IPID:  get(record, "groupIpid"),
+					Name:  get(record, "groupName"),
+					Email: get(record, "groupEmail"),
+				},
+			}
+
+			if email, ipid := get(record, "memberEmail"), get(record, "memberIpid"); email != "" || ipid != "" {
+				gm.Resources = []*model.Member{{IPID: ipid, Email: email}}
+			}
+
+			doc.GroupsMembers.Resources = append(doc.GroupsMembers.Resources, gm)
+		}
+
+		return nil
+	}
+
+	if _, ok := header["userName"]; !ok {
+		return fmt.Errorf("%w: userName or groupName column is required", ErrFileCSVHeaderUnknown)
+	}
+
+	for column := range header {
+		switch column {
+		case "ipid", "userName", "email", "givenName", "familyName", "displayName", "title", "userType",
+			"preferredLanguage", "locale", "timezone", "phoneNumber", "active",
+			"employeeNumber", "costCenter", "organization", "division", "department":
+		default:
+			return fmt.Errorf("%w: %s", ErrFileCSVHeaderUnknown, column)
+		}
+	}
+
+	for _, record := range records[1:] {
+		u := &fileUser{
+			User: model.User{
+				IPID:              get(record, "ipid"),
+				UserName:          get(record, "userName"),
+				DisplayName:       get(record, "displayName"),
+				Title:             get(record, "title"),
+				UserType:          get(record, "userType"),
+				PreferredLanguage: get(record, "preferredLanguage"),
+				Locale:            get(record, "locale"),
+				Timezone:          get(record, "timezone"),
+				Name: &model.Name{
+					GivenName:  get(record, "givenName"),
+					FamilyName: get(record, "familyName"),
+				},
+			},
+		}
+
+		if email := get(record, "email"); email != "" {
+			u.Emails = []model.Email{{Value: email, Type: "work", Primary: true}}
+		}
+
+		if phone := get(record, "phoneNumber"); phone != "" {
+			u.PhoneNumbers = []model.PhoneNumber{{Value: phone, Type: "work"}}
+		}
+
+		if active := get(record, "active"); active != "" {
+			b, err := strconv.ParseBool(active)
+			if err != nil {
+				return fmt.Errorf("invalid active value %q of user %s: %w", active, u.UserName, err)
+			}
+			u.Active = &b
+		}
+
+		ed := &model.EnterpriseData{
+			EmployeeNumber: get(record, "employeeNumber"),
+			CostCenter:     get(record, "costCenter"),
+			Organization:   get(record, "organization"),
+			Division:       get(record, "division"),
+			Department:     get(record, "department"),
+		}
+		if *ed != (model.EnterpriseData{}) {
+			u.EnterpriseData = ed
+		}
+
+		doc.Users.Resources = append(doc.Users.Resources, u)
+	}
+
+	return nil
+}
+
+// addUsers validates the users and avoids the second, third, etc repetition of the same userName.
+func (i *FileIdentityProvider) addUsers(users []*fileUser) {
+	uniqUsers := make(map[string]struct{}, len(users))
+
+	for _, fu := range users {
+		if fu == nil {
+			continue
+		}
+
+		u := fu.User
+		u.UserName = strings.TrimSpace(u.UserName)
+
+		// these fields are required because the Constrains defined here:
+		// https://docs.aws.amazon.com/singlesignon/latest/developerguide/createuser.html
+		if u.UserName == "" {
+			slog.Warn("idp: User name is empty", "ipid", u.IPID)
+			continue
+		}
+
+		if u.Name == nil || u.Name.GivenName == "" || u.Name.FamilyName == "" {
+			slog.Warn("idp: User given name or family name is empty", "userName", u.UserName)
+			continue
+		}
+
+		if len(u.Emails) == 0 && u.Email != "" {
+			u.Emails = []model.Email{{Value: u.Email, Type: "work", Primary: true}}
+		}
+		u.Email = ""
+
+		if u.GetPrimaryEmailAddress() == "" {
+			slog.Warn("idp: User primary email is empty", "userName", u.UserName)
+			continue
+		}
+
+		if _, ok := uniqUsers[u.UserName]; ok {
+			slog.Warn("idp: user already exists with the same userName, this user will be avoided", "userName", u.UserName)
+			continue
+		}
+		uniqUsers[u.UserName] = struct{}{}
+
+		if u.IPID == "" {
+			u.IPID = u.UserName
+		}
+
+		if u.DisplayName == "" {
+			u.DisplayName = fmt.Sprintf("%s %s", u.Name.GivenName, u.Name.FamilyName)
+		}
+
+		if u.Name.Formatted == "" {
+			u.Name.Formatted = u.DisplayName
+		}
+
+		u.Active = fu.Active == nil || *fu.Active
+		u.SCIMID = ""
+		u.SetHashCode()
+
+		i.users = append(i.users, &u)
+	}
+}
+
+// addGroups validates the groups and merges the members of the groups with the same name,
+// the members are resolved against the users by ipid or email.
+func (i *FileIdentityProvider) addGroups(groups []*model.GroupMembers) {
+	usersByIPID := make(map[string]*model.User, len(i.users))
+	usersByEmail := make(map[string]*model.User, len(i.users))
+	for _, u := range i.users {
+		usersByIPID[u.IPID] = u
+		usersByEmail[strings.ToLower(u.GetPrimaryEmailAddress())] = u
+	}
+
+	groupsByName := make(map[string]*model.GroupMembers, len(groups))
+	for _, gm := range groups {
+		if gm == nil || gm.Group == nil || strings.TrimSpace(gm.Group.Name) == "" {
+			slog.Warn("idp: group name is empty, this group will be avoided")
+			continue
+		}
+
+		name := strings.TrimSpace(gm.Group.Name)
+
+		group, ok := groupsByName[name]
+		if !ok {
+			ipid := gm.Group.IPID
+			if ipid == "" {
+				ipid = name
+			}
+
+			group = &model.GroupMembers{
+				Group: model.GroupBuilder().
+					WithIPID(ipid).
+					WithName(name).
+					WithEmail(strings.TrimSpace(gm.Group.Email)).
+					Build(),
+				Resources: make([]*model.Member, 0, len(gm.Resources)),
+			}
+			groupsByName[name] = group
+			i.groups = append(i.groups, group)
+		}
+
+		for _, m := range gm.Resources {
+			if m == nil {
+				continue
+			}
+
+			member := i.resolveMember(m, usersByIPID, usersByEmail)
+			if member == nil {
+				continue
+			}
+
+			repeated := false
+			for _, existing := range group.Resources {
+				if existing.IPID == member.IPID {
+					repeated = true
+					break
+				}
+			}
+
+			if !repeated {
+				group.Resources = append(group.Resources, member)
+			}
+		}
+	}
+}
+
+// resolveMember returns the member with the ipid, email and status of the user it references
+func (i *FileIdentityProvider) resolveMember(m *model.Member, usersByIPID, usersByEmail map[string]*model.User) *model.Member {
+	email := strings.TrimSpace(m.Email)
+
+	user, ok := usersByIPID[m.IPID]
+	if !ok {
+		user, ok = usersByEmail[strings.ToLower(email)]
+	}
+
+	if !ok {
+		if email == "" {
+			slog.Warn("idp: member email is empty, this member will be avoided", "ipid", m.IPID)
+			return nil
+		}
+
+		slog.Warn("idp: member is not declared as user, it will not be created", "email", email)
+
+		ipid := m.IPID
+		if ipid == "" {
+			ipid = email
+		}
+
+		status := m.Status
+		if status == "" {
+			status = "ACTIVE"
+		}
+
+		return model.MemberBuilder().WithIPID(ipid).WithEmail(email).WithStatus(status).Build()
+	}
+
+	status := "ACTIVE"
+	if !user.Active {
+		status = "SUSPENDED"
+	}
+
+	return model.MemberBuilder().
+		WithIPID(user.IPID).
+		WithEmail(user.GetPrimaryEmailAddress()).
+		WithStatus(status).
+		Build()
+}
+
+// matchFilter returns true when the value matches one of the filter patterns,
+// or when there are no patterns.
+func matchFilter(value string, filter []string) (bool, error) {
+	patterns := 0
+	for _, pattern := range filter {
+		if pattern == "" {
+			continue
+		}
+		patterns++
+
+		ok, err := path.Match(pattern, value)
+		if err != nil {
+			return false, fmt.Errorf("idp: invalid filter %q: %w", pattern, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	return patterns == 0, nil
+}
+
+// GetGroups returns the groups of the files.
+//
+// The filter parameter is a list of patterns, like "AWS-*", matched with the group names.
+func (i *FileIdentityProvider) GetGroups(ctx context.Context, filter []string) (*model.GroupsResult, error) {
+	syncGroups := make([]*model.Group, 0, len(i.groups))
+	for _, gm := range i.groups {
+		ok, err := matchFilter(gm.Group.Name, filter)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		g := *gm.Group
+		syncGroups = append(syncGroups, &g)
+	}
+
+	syncResult := model.GroupsResultBuilder().WithResources(syncGroups).Build()
+	slog.Debug("idp: file GetGroups()", "groups", len(syncGroups))
+
+	return syncResult, nil
+}
+
+// GetUsers returns the users of the files.
+//
+// The filter parameter is a list of patterns, like "*@example.com", matched with the userNames.
+func (i *FileIdentityProvider) GetUsers(ctx context.Context, filter []string) (*model.UsersResult, error) {
+	syncUsers := make([]*model.User, 0, len(i.users))
+	for _, u := range i.users {
+		ok, err := matchFilter(u.UserName, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			syncUsers = append(syncUsers, u)
+		}
+	}
+
+	uResult := model.UsersResultBuilder().WithResources(deepcopy.SliceOfPointers(syncUsers)).Build()
+	slog.Debug("idp: file GetUsers()", "users", len(syncUsers))
+
+	return uResult, nil
+}
+
+// GetGroupMembers returns the members of the group.
+func (i *FileIdentityProvider) GetGroupMembers(ctx context.Context, groupID string) (*model.MembersResult, error) {
+	if groupID == "" {
+		return nil, ErrGroupIDNil
+	}
+
+	syncMembers := make([]*model.Member, 0)
+	for _, gm := range i.groups {
+		if gm.Group.IPID == groupID {
+			syncMembers = deepcopy.SliceOfPointers(gm.Resources)
+			break
+		}
+	}
+
+	syncMembersResult := model.MembersResultBuilder().WithResources(syncMembers).Build()
+	slog.Debug("idp: file GetGroupMembers()", "members", len(syncMembers))
+
+	return syncMembersResult, nil
+}
+
+// GetUsersByGroupsMembers returns the users that are members of the groups,
+// the members that are not declared as users are avoided.
+func (i *FileIdentityProvider) GetUsersByGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.UsersResult, error) {
+	if gmr == nil {
+		return nil, ErrGroupResultNil
+	}
+
+	usersByIPID := make(map[string]*model.User, len(i.users))
+	for _, u := range i.users {
+		usersByIPID[u.IPID] = u
+	}
+
+	uniqUsers := make(map[string]struct{}, len(gmr.Resources))
+	pUsers := make([]*model.User, 0, len(gmr.Resources))
+	for _, groupMembers := range gmr.Resources {
+		for _, member := range groupMembers.Resources {
+			if _, ok := uniqUsers[member.IPID]; ok {
+				continue
+			}
+			uniqUsers[member.IPID] = struct{}{}
+
+			if u, ok := usersByIPID[member.IPID]; ok {
+				pUsers = append(pUsers, u)
+			}
+		}
+	}
+
+	pUsersResult := model.UsersResultBuilder().WithResources(deepcopy.SliceOfPointers(pUsers)).Build()
+	slog.Debug("idp: file GetUsersByGroupsMembers()", "users", len(pUsers))
+
+	return pUsersResult, nil
+}
+
+// GetGroupsMembers return the members of the groups
+func (i *FileIdentityProvider) GetGroupsMembers(ctx context.Context, gr *model.GroupsResult) (*model.GroupsMembersResult, error) {
+	if gr == nil {
+		return nil, ErrGroupResultNil
+	}
+
+	groupMembers := make([]*model.GroupMembers, 0, len(gr.Resources))
+	for _, group := range gr.Resources {
+		members, err := i.GetGroupMembers(ctx, group.IPID)
+		if err != nil {
+			return nil, fmt.Errorf("idp: error getting group members: %w", err)
+		}
+
+		ggm := model.GroupBuilder().
+			WithIPID(group.IPID).
+			WithName(group.Name).
+			WithEmail(group.Email).
+			Build()
+
+		groupMember := model.GroupMembersBuilder().
+			WithGroup(ggm).
+			WithResources(members.Resources).
+			Build()
+
+		groupMembers = append(groupMembers, groupMember)
+	}
+
+	groupsMembersResult := model.GroupsMembersResultBuilder().WithResources(groupMembers).Build()
+	slog.Debug("idp: file GetGroupsMembers()", "groups", len(groupMembers))
+
+	return groupsMembersResult, nil
+}
@@ -0,0 +1,271 @@
+package idp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const testFileYAML = `
+users:
+  resources:
+    - userName: break.glass@example.com
+      displayName: Break Glass
+      name:
+        givenName: Break
+        familyName: Glass
+      emails:
+        - value: break.glass@example.com
+          type: work
+          primary: true
+      enterpriseData:
+        department: Security
+    - userName: ci@example.com
+      name:
+        givenName: CI
+        familyName: Robot
+      email: ci@example.com
+      active: false
+    - userName: missing.name@example.com
+      email: missing.name@example.com
+groupsMembers:
+  resources:
+    - group:
+        name: AWS-Admins
+        email: aws-admins@example.com
+      resources:
+        - email: break.glass@example.com
+        - email: CI@example.com
+    - group:
+        name: Other
+`
+
+const testFileJSON = `{
+  "users": {
+    "resources": [
+      {"userName": "deploy@example.com", "ipid": "svc-0001", "name": {"givenName": "Deploy", "familyName": "Robot"}, "emails": [{"value": "deploy@example.com", "primary": true}]},
+      {"userName": "ci@example.com", "name": {"givenName": "Duplicated", "familyName": "User"}, "emails": [{"value": "ci.2@example.com", "primary": true}]}
+    ]
+  },
+  "groupsMembers": {
+    "resources": [
+      {"group": {"name": "AWS-Admins"}, "resources": [{"ipid": "svc-0001"}, {"email": "break.glass@example.com"}]}
+    ]
+  }
+}`
+
+const testFileUsersCSV = `userName,email,givenName,familyName,title,active,costCenter
+audit@example.com,audit@example.com,Audit,Robot,auditor,true,cc-1
+`
+
+const testFileGroupsCSV = `groupName,groupEmail,memberEmail
+AWS-Auditors,aws-auditors@example.com,audit@example.com
+AWS-Auditors,,unknown@example.com
+`
+
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	return dir
+}
+
+func TestNewFileIdentityProvider(t *testing.T) {
+	t.Run("empty path", func(t *testing.T) {
+		got, err := NewFileIdentityProvider("")
+		assert.ErrorIs(t, err, ErrFilePathEmpty)
+		assert.Nil(t, got)
+	})
+
+	t.Run("missing path", func(t *testing.T) {
+		got, err := NewFileIdentityProvider(filepath.Join(t.TempDir(), "missing.yaml"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		assert.Nil(t, got)
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		dir := writeTestFiles(t, map[string]string{"users.txt": ""})
+
+		got, err := NewFileIdentityProvider(filepath.Join(dir, "users.txt"))
+		assert.ErrorIs(t, err, ErrFileFormatUnsupported)
+		assert.Nil(t, got)
+	})
+
+	t.Run("invalid yaml", func(t *testing.T) {
+		dir := writeTestFiles(t, map[string]string{"users.yaml": "users: ["})
+
+		got, err := NewFileIdentityProvider(filepath.Join(dir, "users.yaml"))
+		assert.Error(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("unknown csv header", func(t *testing.T) {
+		dir := writeTestFiles(t, map[string]string{"users.csv": "userName,nickName\n"})
+
+		got, err := NewFileIdentityProvider(filepath.Join(dir, "users.csv"))
+		assert.ErrorIs(t, err, ErrFileCSVHeaderUnknown)
+		assert.Nil(t, got)
+	})
+
+	t.Run("invalid csv active value", func(t *testing.T) {
+		dir := writeTestFiles(t, map[string]string{"users.csv": "userName,active\nuser,maybe\n"})
+
+		got, err := NewFileIdentityProvider(filepath.Join(dir, "users.csv"))
+		assert.Error(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("empty file", func(t *testing.T) {
+		dir := writeTestFiles(t, map[string]string{"users.json": ""})
+
+		got, err := NewFileIdentityProvider(filepath.Join(dir, "users.json"))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(got.users))
+	})
+}
+
+func TestFileIdentityProvider_File(t *testing.T) {
+	ctx := context.TODO()
+	dir := writeTestFiles(t, map[string]string{"identities.yaml": testFileYAML})
+
+	fileIDP, err := NewFileIdentityProvider(filepath.Join(dir, "identities.yaml"))
+	assert.NoError(t, err)
+
+	t.Run("GetUsers skips users without the required attributes", func(t *testing.T) {
+		got, err := fileIDP.GetUsers(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, got.Items)
+
+		user1 := got.Resources[0]
+		assert.Equal(t, "break.glass@example.com", user1.IPID)
+		assert.Equal(t, "Break Glass", user1.DisplayName)
+		assert.Equal(t, "Security", user1.EnterpriseData.Department)
+		assert.True(t, user1.Active)
+		assert.NotEmpty(t, user1.HashCode)
+
+		// the deprecated email field is converted
+		user2 := got.Resources[1]
+		assert.False(t, user2.Active)
+		assert.Equal(t, "CI Robot", user2.DisplayName)
+		assert.Equal(t, "ci@example.com", user2.GetPrimaryEmailAddress())
+		assert.Equal(t, "", user2.Email)
+	})
+
+	t.Run("GetUsers with filters", func(t *testing.T) {
+		got, err := fileIDP.GetUsers(ctx, []string{"ci@*"})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, got.Items)
+		assert.Equal(t, "ci@example.com", got.Resources[0].UserName)
+
+		got, err = fileIDP.GetUsers(ctx, []string{"["})
+		assert.Error(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("GetGroups with filters", func(t *testing.T) {
+		got, err := fileIDP.GetGroups(ctx, []string{""})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, got.Items)
+
+		got, err = fileIDP.GetGroups(ctx, []string{"AWS-*"})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, got.Items)
+		assert.Equal(t, "AWS-Admins", got.Resources[0].IPID)
+		assert.Equal(t, "aws-admins@example.com", got.Resources[0].Email)
+	})
+
+	t.Run("GetGroupsMembers and GetUsersByGroupsMembers", func(t *testing.T) {
+		groups, err := fileIDP.GetGroups(ctx, nil)
+		assert.NoError(t, err)
+
+		gmr, err := fileIDP.GetGroupsMembers(ctx, groups)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, gmr.Items)
+		assert.Equal(t, 2, gmr.Resources[0].Items)
+		assert.Equal(t, "break.glass@example.com", gmr.Resources[0].Resources[0].IPID)
+		assert.Equal(t, "ACTIVE", gmr.Resources[0].Resources[0].Status)
+		// the members are resolved by email, case insensitive
+		assert.Equal(t, "ci@example.com", gmr.Resources[0].Resources[1].Email)
+		assert.Equal(t, "SUSPENDED", gmr.Resources[0].Resources[1].Status)
+		assert.Equal(t, 0, gmr.Resources[1].Items)
+
+		users, err := fileIDP.GetUsersByGroupsMembers(ctx, gmr)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, users.Items)
+	})
+
+	t.Run("GetGroupMembers with empty group id", func(t *testing.T) {
+		got, err := fileIDP.GetGroupMembers(ctx, "")
+		assert.ErrorIs(t, err, ErrGroupIDNil)
+		assert.Nil(t, got)
+	})
+
+	t.Run("nil results", func(t *testing.T) {
+		gmr, err := fileIDP.GetGroupsMembers(ctx, nil)
+		assert.ErrorIs(t, err, ErrGroupResultNil)
+		assert.Nil(t, gmr)
+
+		ur, err := fileIDP.GetUsersByGroupsMembers(ctx, nil)
+		assert.ErrorIs(t, err, ErrGroupResultNil)
+		assert.Nil(t, ur)
+	})
+}
+
+func TestFileIdentityProvider_Directory(t *testing.T) {
+	ctx := context.TODO()
+	dir := writeTestFiles(t, map[string]string{
+		"01-identities.yaml": testFileYAML,
+		"02-services.json":   testFileJSON,
+		"03-users.csv":       testFileUsersCSV,
+		"04-groups.csv":      testFileGroupsCSV,
+		"README.md":          "not an identities file",
+	})
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "archive"), 0o700))
+
+	fileIDP, err := NewFileIdentityProvider(dir)
+	assert.NoError(t, err)
+
+	users, err := fileIDP.GetUsers(ctx, nil)
+	assert.NoError(t, err)
+	// the second ci@example.com is avoided
+	assert.Equal(t, 4, users.Items)
+	assert.Equal(t, "svc-0001", users.Resources[2].IPID)
+
+	audit := users.Resources[3]
+	assert.Equal(t, "audit@example.com", audit.UserName)
+	assert.Equal(t, "auditor", audit.Title)
+	assert.True(t, audit.Active)
+	assert.Equal(t, "cc-1", audit.EnterpriseData.CostCenter)
+
+	groups, err := fileIDP.GetGroups(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, groups.Items)
+
+	gmr, err := fileIDP.GetGroupsMembers(ctx, groups)
+	assert.NoError(t, err)
+
+	// the members of the groups with the same name are merged
+	admins := gmr.Resources[0]
+	assert.Equal(t, "AWS-Admins", admins.Group.Name)
+	assert.Equal(t, 3, admins.Items)
+	assert.Equal(t, "svc-0001", admins.Resources[2].IPID)
+
+	// the members not declared as users are kept but their users are not returned
+	auditors := gmr.Resources[2]
+	assert.Equal(t, "aws-auditors@example.com", auditors.Group.Email)
+	assert.Equal(t, 2, auditors.Items)
+	assert.Equal(t, "unknown@example.com", auditors.Resources[1].IPID)
+
+	gmrAuditors := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{auditors}).Build()
+	auditorsUsers, err := fileIDP.GetUsersByGroupsMembers(ctx, gmrAuditors)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, auditorsUsers.Items)
+}
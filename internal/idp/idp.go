@@ -4,11 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"iter"
 	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"github.com/slashdevops/idp-scim-sync/internal/tracing"
+	"github.com/slashdevops/idp-scim-sync/internal/workerpool"
 	"github.com/slashdevops/idp-scim-sync/pkg/google"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
 )
 
 // This implement core.IdentityProviderService interface
@@ -22,6 +33,9 @@ var (
 
 	// ErrGroupResultNil is returned when the group result is nil.
 	ErrGroupResultNil = errors.New("provider: group result is nil")
+
+	// ErrGoogleUsersLookupInvalid is returned when the users lookup strategy is not valid.
+	ErrGoogleUsersLookupInvalid = errors.New("provider: google users lookup is invalid")
 )
 
 //go:generate go run go.uber.org/mock/mockgen@v0.5.0 -package=mocks -destination=../../mocks/idp/idp_mocks.go -source=idp.go GoogleProviderService
@@ -32,22 +46,127 @@ type GoogleProviderService interface {
 	ListGroups(ctx context.Context, query []string) ([]*admin.Group, error)
 	ListGroupMembers(ctx context.Context, groupID string, queries ...google.GetGroupMembersOption) ([]*admin.Member, error)
 	GetUser(ctx context.Context, userID string) (*admin.User, error)
+	ListUsersPages(ctx context.Context) iter.Seq2[[]*admin.User, error]
 }
 
+// GoogleUsersLookup is the strategy used to get the users of the groups members.
+type GoogleUsersLookup string
+
+const (
+	// GoogleUsersLookupAuto lists the users of the directory while it needs fewer requests than getting
+	// the members not found yet one by one, then gets the remaining members one by one.
+	GoogleUsersLookupAuto GoogleUsersLookup = "auto"
+
+	// GoogleUsersLookupGet gets the users of the members one by one.
+	GoogleUsersLookupGet GoogleUsersLookup = "get"
+
+	// GoogleUsersLookupList lists the users of the directory until all the members are found,
+	// the members not found in the directory are got one by one.
+	GoogleUsersLookupList GoogleUsersLookup = "list"
+)
+
+const (
+	// DefaultGoogleConcurrency is the default number of groups members or users fetched at the same time from Google Workspace.
+	DefaultGoogleConcurrency = 1
+
+	// DefaultGoogleMaxRetries is the default number of retries of a request throttled by the Google Admin SDK quotas.
+	DefaultGoogleMaxRetries = 5
+
+	// DefaultGoogleRetryBaseDelay and DefaultGoogleRetryMaxDelay are the default limits of the exponential backoff
+	// between the retries of a throttled request.
+	// reference: https://developers.google.com/admin-sdk/directory/v1/limits
+	DefaultGoogleRetryBaseDelay = time.Second
+	DefaultGoogleRetryMaxDelay  = 32 * time.Second
+)
+
 // IdentityProvider is the Identity Provider service that implements the core.IdentityProvider interface and consumes the pkg.google methods.
 type IdentityProvider struct {
 	ps GoogleProviderService
+
+	concurrency    int
+	maxRetries     int
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+	usersLookup    GoogleUsersLookup
+	observer       GoogleAPICallObserver
+
+	// sleep waits between the retries, replaced in the tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// IdentityProviderOption is a function that configures the IdentityProvider.
+type IdentityProviderOption func(*IdentityProvider)
+
+// WithGoogleConcurrency sets the number of groups members or users fetched at the same time, less than 1 is 1.
+func WithGoogleConcurrency(n int) IdentityProviderOption {
+	return func(i *IdentityProvider) {
+		i.concurrency = max(n, 1)
+	}
+}
+
+// WithGoogleMaxRetries sets the number of retries of a request throttled by the Google Admin SDK quotas,
+// 0 or less disables the retries.
+func WithGoogleMaxRetries(n int) IdentityProviderOption {
+	return func(i *IdentityProvider) {
+		i.maxRetries = max(n, 0)
+	}
+}
+
+// WithGoogleRetryDelay sets the delay before the first retry of a throttled request, the delay is doubled
+// on every retry up to maxDelay.
+func WithGoogleRetryDelay(baseDelay, maxDelay time.Duration) IdentityProviderOption {
+	return func(i *IdentityProvider) {
+		i.retryBaseDelay = baseDelay
+		i.retryMaxDelay = maxDelay
+	}
+}
+
+// WithGoogleUsersLookup sets the strategy used to get the users of the groups members.
+func WithGoogleUsersLookup(lookup GoogleUsersLookup) IdentityProviderOption {
+	return func(i *IdentityProvider) {
+		i.usersLookup = lookup
+	}
+}
+
+// WithGoogleAPICallObserver sets the observer of every call to the Google Workspace Directory API,
+// a throttled request is observed on every retry.
+func WithGoogleAPICallObserver(o GoogleAPICallObserver) IdentityProviderOption {
+	return func(i *IdentityProvider) {
+		i.observer = o
+	}
 }
 
 // NewIdentityProvider returns a new instance of the Identity Provider service.
-func NewIdentityProvider(gps GoogleProviderService) (*IdentityProvider, error) {
+func NewIdentityProvider(gps GoogleProviderService, opts ...IdentityProviderOption) (*IdentityProvider, error) {
 	if gps == nil {
 		return nil, ErrDirectoryServiceNil
 	}
 
-	return &IdentityProvider{
-		ps: gps,
-	}, nil
+	i := &IdentityProvider{
+		ps:             gps,
+		concurrency:    DefaultGoogleConcurrency,
+		maxRetries:     DefaultGoogleMaxRetries,
+		retryBaseDelay: DefaultGoogleRetryBaseDelay,
+		retryMaxDelay:  DefaultGoogleRetryMaxDelay,
+		usersLookup:    GoogleUsersLookupAuto,
+		sleep:          sleep,
+	}
+
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	switch i.usersLookup {
+	case GoogleUsersLookupAuto, GoogleUsersLookupGet, GoogleUsersLookupList:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrGoogleUsersLookupInvalid, i.usersLookup)
+	}
+
+	if i.observer != nil {
+		i.ps = newObservedGoogleProviderService(i.ps, i.observer)
+	}
+
+	return i, nil
 }
 
 // GetGroups returns a list of groups from the Identity Provider API.
@@ -56,8 +175,13 @@ func NewIdentityProvider(gps GoogleProviderService) (*IdentityProvider, error) {
 // according to the Identity Provider API.
 //
 // This method checks the names of the groups and avoid the second, third, etc repetition of the same group name.
-func (i *IdentityProvider) GetGroups(ctx context.Context, filter []string) (*model.GroupsResult, error) {
-	pGroups, err := i.ps.ListGroups(ctx, filter)
+func (i *IdentityProvider) GetGroups(ctx context.Context, filter []string) (_ *model.GroupsResult, err error) {
+	ctx, span := tracing.Start(ctx, "idp.GetGroups", attribute.StringSlice("idp.groups_filter", filter))
+	defer func() { tracing.End(span, err) }()
+
+	pGroups, err := retry(ctx, i, "ListGroups", func() ([]*admin.Group, error) {
+		return i.ps.ListGroups(ctx, filter)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("idp: error getting groups: %w", err)
 	}
@@ -93,6 +217,7 @@ func (i *IdentityProvider) GetGroups(ctx context.Context, filter []string) (*mod
 
 	syncResult := model.GroupsResultBuilder().WithResources(syncGroups).Build()
 	slog.Debug("idp: GetGroups()", "groups", len(syncGroups))
+	span.SetAttributes(attribute.Int("groups", len(syncGroups)))
 
 	return syncResult, nil
 }
@@ -101,8 +226,13 @@ func (i *IdentityProvider) GetGroups(ctx context.Context, filter []string) (*mod
 //
 // The filter parameter is a list of strings that can be used to filter the users
 // according to the Identity Provider API.
-func (i *IdentityProvider) GetUsers(ctx context.Context, filter []string) (*model.UsersResult, error) {
-	pUsers, err := i.ps.ListUsers(ctx, filter)
+func (i *IdentityProvider) GetUsers(ctx context.Context, filter []string) (_ *model.UsersResult, err error) {
+	ctx, span := tracing.Start(ctx, "idp.GetUsers", attribute.StringSlice("idp.users_filter", filter))
+	defer func() { tracing.End(span, err) }()
+
+	pUsers, err := retry(ctx, i, "ListUsers", func() ([]*admin.User, error) {
+		return i.ps.ListUsers(ctx, filter)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("idp: error getting users: %w", err)
 	}
@@ -120,17 +250,23 @@ func (i *IdentityProvider) GetUsers(ctx context.Context, filter []string) (*mode
 	}
 	uResult := model.UsersResultBuilder().WithResources(syncUsers).Build()
 	slog.Debug("idp: GetUsers()", "users", len(syncUsers))
+	span.SetAttributes(attribute.Int("users", len(syncUsers)))
 
 	return uResult, nil
 }
 
 // GetGroupMembers returns a list of members from the Identity Provider API.
-func (i *IdentityProvider) GetGroupMembers(ctx context.Context, groupID string) (*model.MembersResult, error) {
+func (i *IdentityProvider) GetGroupMembers(ctx context.Context, groupID string) (_ *model.MembersResult, err error) {
 	if groupID == "" {
 		return nil, ErrGroupIDNil
 	}
 
-	pMembers, err := i.ps.ListGroupMembers(ctx, groupID, google.WithIncludeDerivedMembership(true))
+	ctx, span := tracing.Start(ctx, "idp.GetGroupMembers", attribute.String("group.id", groupID))
+	defer func() { tracing.End(span, err) }()
+
+	pMembers, err := retry(ctx, i, "ListGroupMembers", func() ([]*admin.Member, error) {
+		return i.ps.ListGroupMembers(ctx, groupID, google.WithIncludeDerivedMembership(true))
+	})
 	if err != nil {
 		return nil, fmt.Errorf("idp: error getting group members: %w", err)
 	}
@@ -164,16 +300,21 @@ func (i *IdentityProvider) GetGroupMembers(ctx context.Context, groupID string)
 	syncMembersResult := model.MembersResultBuilder().WithResources(syncMembers).Build()
 
 	slog.Debug("idp: GetGroupMembers()", "members", len(syncMembers))
+	span.SetAttributes(attribute.Int("members", len(syncMembers)))
 
 	return syncMembersResult, nil
 }
 
-// GetUsersByGroupsMembers returns a list of users from the Identity Provider API.
-func (i *IdentityProvider) GetUsersByGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.UsersResult, error) {
+// GetUsersByGroupsMembers returns a list of users from the Identity Provider API, the users are listed
+// or got one by one depending on the users lookup strategy, and keep the order of their first membership.
+func (i *IdentityProvider) GetUsersByGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (_ *model.UsersResult, err error) {
 	if gmr == nil {
 		return nil, ErrGroupResultNil
 	}
 
+	ctx, span := tracing.Start(ctx, "idp.GetUsersByGroupsMembers", attribute.String("idp.users_lookup", string(i.usersLookup)))
+	defer func() { tracing.End(span, err) }()
+
 	if len(gmr.Resources) == 0 {
 		syncUsers := make([]*model.User, 0)
 		uResult := model.UsersResultBuilder().WithResources(syncUsers).Build()
@@ -181,41 +322,180 @@ func (i *IdentityProvider) GetUsersByGroupsMembers(ctx context.Context, gmr *mod
 	}
 
 	uniqUsers := make(map[string]struct{}, len(gmr.Resources))
-	pUsers := make([]*model.User, 0, len(gmr.Resources))
+	uniqMembers := make([]*model.Member, 0, len(gmr.Resources))
 	for _, groupMembers := range gmr.Resources {
 		for _, member := range groupMembers.Resources {
 			if _, ok := uniqUsers[member.Email]; !ok {
 				uniqUsers[member.Email] = struct{}{}
+				uniqMembers = append(uniqMembers, member)
+			}
+		}
+	}
 
-				// TODO: instead of retrieve user by user, I can implement a users.list
-				// https://developers.google.com/admin-sdk/directory/reference/rest/v1/users/list
-				// using the query parameter to filter by emails and retrieve the maximum number of users
-				// per request
-				u, err := i.ps.GetUser(ctx, member.Email)
-				if err != nil {
-					return nil, fmt.Errorf("idp: error getting user: %+v, email: %s, error: %w", member.IPID, member.Email, err)
-				}
-				gu := buildUser(u)
+	pUsers := make([]*model.User, len(uniqMembers))
 
-				slog.Debug("idp: GetUsersByGroupsMembers()", "user", gu.Email)
-				pUsers = append(pUsers, gu)
-			}
+	pending := make([]int, len(uniqMembers))
+	for j := range pending {
+		pending[j] = j
+	}
+
+	if i.usersLookup == GoogleUsersLookupAuto || i.usersLookup == GoogleUsersLookupList {
+		pending, err = i.listUsersByMembers(ctx, uniqMembers, pUsers)
+		if err != nil {
+			return nil, err
 		}
 	}
+	span.SetAttributes(attribute.Int("users.listed", len(uniqMembers)-len(pending)), attribute.Int("users.got", len(pending)))
+
+	if err := i.getUsersByMembers(ctx, uniqMembers, pending, pUsers); err != nil {
+		return nil, err
+	}
+
+	// the users skipped are not part of the result
+	pUsers = slices.DeleteFunc(pUsers, func(u *model.User) bool { return u == nil })
 
 	pUsersResult := model.UsersResultBuilder().WithResources(pUsers).Build()
 
 	slog.Debug("idp: GetUsersByGroupsMembers()", "users", len(pUsers))
+	span.SetAttributes(attribute.Int("users", len(pUsers)))
 
 	return pUsersResult, nil
 }
 
-// GetGroupsMembers return the members of the groups
-func (i *IdentityProvider) GetGroupsMembers(ctx context.Context, gr *model.GroupsResult) (*model.GroupsMembersResult, error) {
+// listUsersByMembers lists the users of the directory page by page and sets the users of the members into users
+// joining them by id or email, it returns the indexes of the members not found.
+// Using the auto users lookup, the listing stops when the pages already requested are as many as
+// the members not found, so getting them one by one costs fewer requests than the rest of the directory.
+func (i *IdentityProvider) listUsersByMembers(ctx context.Context, members []*model.Member, users []*model.User) ([]int, error) {
+	byID := make(map[string]int, len(members))
+	byEmail := make(map[string]int, len(members))
+	for j, member := range members {
+		if member.IPID != "" {
+			byID[member.IPID] = j
+		}
+		byEmail[strings.ToLower(member.Email)] = j
+	}
+
+	found, pages := 0, 0
+	for page, err := range i.listUsersPages(ctx) {
+		if err != nil {
+			return nil, fmt.Errorf("idp: error listing users: %w", err)
+		}
+		pages++
+
+		for _, u := range page {
+			j, ok := byID[u.Id]
+			if !ok {
+				j, ok = byEmail[strings.ToLower(u.PrimaryEmail)]
+			}
+			if !ok || users[j] != nil {
+				continue
+			}
+
+			// the users without the required attributes are not found, they stay pending and are skipped later
+			if users[j] = buildUser(u); users[j] != nil {
+				found++
+			}
+		}
+
+		if found == len(members) {
+			break
+		}
+
+		if i.usersLookup == GoogleUsersLookupAuto && pages >= len(members)-found {
+			slog.Debug("idp: listUsersByMembers() getting the remaining members one by one", "pages", pages, "pending", len(members)-found)
+			break
+		}
+	}
+
+	pending := make([]int, 0, len(members)-found)
+	for j := range members {
+		if users[j] == nil {
+			pending = append(pending, j)
+		}
+	}
+
+	slog.Debug("idp: listUsersByMembers()", "pages", pages, "found", found, "pending", len(pending))
+
+	return pending, nil
+}
+
+// listUsersPages returns an iterator over the pages of the users of the directory, retrying the throttled pages
+// from the beginning of the list.
+func (i *IdentityProvider) listUsersPages(ctx context.Context) iter.Seq2[[]*admin.User, error] {
+	return func(yield func([]*admin.User, error) bool) {
+		skip := 0
+		for attempt := 0; ; attempt++ {
+			read := 0
+			var pageErr error
+			for page, err := range i.ps.ListUsersPages(ctx) {
+				if err != nil {
+					pageErr = err
+					break
+				}
+
+				read++
+				if read <= skip {
+					continue
+				}
+
+				skip = read
+				if !yield(page, nil) {
+					return
+				}
+			}
+
+			if pageErr == nil {
+				return
+			}
+
+			if attempt >= i.maxRetries || !isRateLimitError(pageErr) {
+				yield(nil, pageErr)
+				return
+			}
+
+			if err := i.sleep(ctx, i.backoff(attempt)); err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+	}
+}
+
+// getUsersByMembers gets one by one the users of the members at the indexes and sets them into users,
+// up to the concurrency users are fetched at the same time.
+func (i *IdentityProvider) getUsersByMembers(ctx context.Context, members []*model.Member, indexes []int, users []*model.User) error {
+	return workerpool.ForEachUntilError(ctx, len(indexes), i.concurrency, func(ctx context.Context, k int) error {
+		member := members[indexes[k]]
+
+		u, err := retry(ctx, i, "GetUser", func() (*admin.User, error) {
+			return i.ps.GetUser(ctx, member.Email)
+		})
+		if err != nil {
+			return fmt.Errorf("idp: error getting user: %+v, email: %s, error: %w", member.IPID, member.Email, err)
+		}
+		gu := buildUser(u)
+		if gu == nil {
+			slog.Warn("idp: skipping user without the required attributes", "id", member.IPID, "email", member.Email)
+			return nil
+		}
+
+		slog.Debug("idp: GetUsersByGroupsMembers()", "user", gu.Email)
+		users[indexes[k]] = gu
+		return nil
+	})
+}
+
+// GetGroupsMembers return the members of the groups, up to the concurrency groups members
+// are fetched at the same time and the groups members keep the order of the groups.
+func (i *IdentityProvider) GetGroupsMembers(ctx context.Context, gr *model.GroupsResult) (_ *model.GroupsMembersResult, err error) {
 	if gr == nil {
 		return nil, ErrGroupResultNil
 	}
 
+	ctx, span := tracing.Start(ctx, "idp.GetGroupsMembers", attribute.Int("groups", len(gr.Resources)))
+	defer func() { tracing.End(span, err) }()
+
 	l := len(gr.Resources)
 	if l == 0 {
 		groupsMembersResult := &model.GroupsMembersResult{
@@ -228,10 +508,12 @@ func (i *IdentityProvider) GetGroupsMembers(ctx context.Context, gr *model.Group
 	}
 
 	groupMembers := make([]*model.GroupMembers, l)
-	for j, group := range gr.Resources {
+	err = workerpool.ForEachUntilError(ctx, l, i.concurrency, func(ctx context.Context, j int) error {
+		group := gr.Resources[j]
+
 		members, err := i.GetGroupMembers(ctx, group.IPID)
 		if err != nil {
-			return nil, fmt.Errorf("idp: error getting group members: %w", err)
+			return fmt.Errorf("idp: error getting group members: %w", err)
 		}
 
 		ggm := model.GroupBuilder().
@@ -246,6 +528,10 @@ func (i *IdentityProvider) GetGroupsMembers(ctx context.Context, gr *model.Group
 			Build()
 
 		groupMembers[j] = groupMember
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	groupsMembersResult := &model.GroupsMembersResult{
@@ -258,3 +544,76 @@ func (i *IdentityProvider) GetGroupsMembers(ctx context.Context, gr *model.Group
 
 	return groupsMembersResult, nil
 }
+
+// retry calls fn until it doesn't return a rate limit error of the Google Admin SDK, or the retries
+// of the identity provider are exhausted, waiting an exponential backoff with jitter between the calls.
+func retry[T any](ctx context.Context, i *IdentityProvider, op string, fn func() (T, error)) (T, error) {
+	for attempt := 0; ; attempt++ {
+		v, err := fn()
+		if err == nil || attempt >= i.maxRetries || !isRateLimitError(err) {
+			return v, err
+		}
+
+		wait := i.backoff(attempt)
+		slog.Warn("idp: google rate limit exceeded, retrying", "operation", op, "attempt", attempt+1, "wait", wait, "error", err)
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.String("operation", op),
+			attribute.Int("attempt", attempt+1),
+			attribute.String("wait", wait.String()),
+		))
+
+		if err := i.sleep(ctx, wait); err != nil {
+			var zero T
+			return zero, err
+		}
+	}
+}
+
+// backoff returns the wait before the retry of the attempt, the delay is doubled on every attempt up to
+// the max delay with equal jitter, so the concurrent requests don't retry at the same time.
+func (i *IdentityProvider) backoff(attempt int) time.Duration {
+	delay := i.retryBaseDelay
+	for range attempt {
+		delay = min(delay*2, i.retryMaxDelay)
+	}
+
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// isRateLimitError returns true when the error is a Google API error caused by the quotas,
+// the Admin SDK returns 403 with the rateLimitExceeded or userRateLimitExceeded reasons, or 429.
+// reference: https://developers.google.com/admin-sdk/directory/v1/limits
+func isRateLimitError(err error) bool {
+	var gErr *googleapi.Error
+	if !errors.As(err, &gErr) {
+		return false
+	}
+
+	if gErr.Code == http.StatusTooManyRequests {
+		return true
+	}
+
+	if gErr.Code == http.StatusForbidden {
+		for _, e := range gErr.Errors {
+			switch e.Reason {
+			case "rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded":
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// sleep waits for the duration or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
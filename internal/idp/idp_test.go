@@ -3,12 +3,17 @@ package idp
 import (
 	"context"
 	"errors"
+	"fmt"
+	"iter"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"github.com/slashdevops/idp-scim-sync/pkg/google"
 	"go.uber.org/mock/gomock"
+	"google.golang.org/api/googleapi"
 
 	mocks "github.com/slashdevops/idp-scim-sync/mocks/idp"
 	"github.com/stretchr/testify/assert"
@@ -896,3 +901,357 @@ func TestGetGroupsMembers(t *testing.T) {
 		})
 	}
 }
+
+func TestGoogleIdentityProviderConcurrency(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	t.Run("GetGroupsMembers should keep the order of the groups", func(t *testing.T) {
+		mockDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		ctx := context.TODO()
+
+		groups := make([]*model.Group, 20)
+		for j := range groups {
+			groups[j] = &model.Group{IPID: fmt.Sprintf("%d", j), Name: fmt.Sprintf("group %d", j)}
+		}
+
+		mockDS.EXPECT().ListGroupMembers(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, groupID string, queries ...google.GetGroupMembersOption) ([]*admin.Member, error) {
+				return []*admin.Member{{Id: groupID, Email: "user." + groupID + "@mail.com", Type: "USER", Status: "ACTIVE"}}, nil
+			},
+		).Times(20)
+
+		svc, err := NewIdentityProvider(mockDS, WithGoogleConcurrency(4))
+		assert.NoError(t, err)
+
+		got, err := svc.GetGroupsMembers(ctx, model.GroupsResultBuilder().WithResources(groups).Build())
+		assert.NoError(t, err)
+		assert.Equal(t, 20, got.Items)
+		for j, gm := range got.Resources {
+			assert.Equal(t, fmt.Sprintf("%d", j), gm.Group.IPID)
+			assert.Equal(t, fmt.Sprintf("user.%d@mail.com", j), gm.Resources[0].Email)
+		}
+	})
+
+	t.Run("GetUsersByGroupsMembers should fetch every user once and keep the order", func(t *testing.T) {
+		mockDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		ctx := context.TODO()
+
+		members := func(ids ...int) []*model.Member {
+			m := make([]*model.Member, len(ids))
+			for j, id := range ids {
+				m[j] = &model.Member{IPID: fmt.Sprintf("%d", id), Email: fmt.Sprintf("user.%d@mail.com", id)}
+			}
+			return m
+		}
+		gmr := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+			{Group: &model.Group{IPID: "1"}, Resources: members(3, 1, 2)},
+			{Group: &model.Group{IPID: "2"}, Resources: members(2, 4, 3, 5)},
+		}).Build()
+
+		mockDS.EXPECT().GetUser(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, email string) (*admin.User, error) {
+				return &admin.User{
+					Id:           email,
+					PrimaryEmail: email,
+					Name:         &admin.UserName{GivenName: "user", FamilyName: email},
+				}, nil
+			},
+		).Times(5)
+
+		svc, err := NewIdentityProvider(mockDS, WithGoogleConcurrency(3), WithGoogleUsersLookup(GoogleUsersLookupGet))
+		assert.NoError(t, err)
+
+		got, err := svc.GetUsersByGroupsMembers(ctx, gmr)
+		assert.NoError(t, err)
+
+		emails := make([]string, 0, len(got.Resources))
+		for _, u := range got.Resources {
+			emails = append(emails, u.GetPrimaryEmailAddress())
+		}
+		assert.Equal(t, []string{"user.3@mail.com", "user.1@mail.com", "user.2@mail.com", "user.4@mail.com", "user.5@mail.com"}, emails)
+	})
+}
+
+func TestGoogleIdentityProviderRetry(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	rateLimitErr := &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}
+	user := &admin.User{Id: "1", PrimaryEmail: "user.1@mail.com", Name: &admin.UserName{GivenName: "user", FamilyName: "1"}}
+	gmr := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+		{Group: &model.Group{IPID: "1"}, Resources: []*model.Member{{IPID: "1", Email: "user.1@mail.com"}}},
+	}).Build()
+
+	newProvider := func(ds GoogleProviderService, waits *[]time.Duration, opts ...IdentityProviderOption) *IdentityProvider {
+		svc, err := NewIdentityProvider(ds, opts...)
+		assert.NoError(t, err)
+
+		svc.sleep = func(ctx context.Context, d time.Duration) error {
+			*waits = append(*waits, d)
+			return nil
+		}
+		return svc
+	}
+
+	t.Run("should retry the throttled requests with backoff", func(t *testing.T) {
+		mockDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		ctx := context.TODO()
+
+		gomock.InOrder(
+			mockDS.EXPECT().GetUser(ctx, "user.1@mail.com").Return(nil, fmt.Errorf("google: error getting user: %w", rateLimitErr)),
+			mockDS.EXPECT().GetUser(ctx, "user.1@mail.com").Return(nil, &googleapi.Error{Code: 429}),
+			mockDS.EXPECT().GetUser(ctx, "user.1@mail.com").Return(user, nil),
+		)
+
+		var waits []time.Duration
+		svc := newProvider(mockDS, &waits, WithGoogleRetryDelay(time.Second, 10*time.Second), WithGoogleUsersLookup(GoogleUsersLookupGet))
+
+		got, err := svc.GetUsersByGroupsMembers(ctx, gmr)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, got.Items)
+
+		assert.Len(t, waits, 2)
+		assert.GreaterOrEqual(t, waits[0], 500*time.Millisecond)
+		assert.LessOrEqual(t, waits[0], time.Second)
+		assert.GreaterOrEqual(t, waits[1], time.Second)
+		assert.LessOrEqual(t, waits[1], 2*time.Second)
+	})
+
+	t.Run("should return the error when the retries are exhausted", func(t *testing.T) {
+		mockDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		ctx := context.TODO()
+
+		mockDS.EXPECT().GetUser(ctx, "user.1@mail.com").Return(nil, rateLimitErr).Times(3)
+
+		var waits []time.Duration
+		svc := newProvider(mockDS, &waits, WithGoogleMaxRetries(2), WithGoogleUsersLookup(GoogleUsersLookupGet))
+
+		got, err := svc.GetUsersByGroupsMembers(ctx, gmr)
+		assert.ErrorIs(t, err, rateLimitErr)
+		assert.Nil(t, got)
+		assert.Len(t, waits, 2)
+	})
+
+	t.Run("should not retry the other errors", func(t *testing.T) {
+		mockDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		ctx := context.TODO()
+
+		forbidden := &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}
+		mockDS.EXPECT().ListGroups(ctx, gomock.Any()).Return(nil, forbidden).Times(1)
+
+		var waits []time.Duration
+		svc := newProvider(mockDS, &waits)
+
+		got, err := svc.GetGroups(ctx, []string{""})
+		assert.ErrorIs(t, err, forbidden)
+		assert.Nil(t, got)
+		assert.Empty(t, waits)
+	})
+}
+
+func TestIsRateLimitError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "not a google error", err: errors.New("test error"), want: false},
+		{name: "429", err: &googleapi.Error{Code: 429}, want: true},
+		{name: "403 rateLimitExceeded", err: &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, want: true},
+		{name: "403 userRateLimitExceeded wrapped", err: fmt.Errorf("wrapped: %w", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}), want: true},
+		{name: "403 forbidden", err: &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}, want: false},
+		{name: "500", err: &googleapi.Error{Code: 500}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isRateLimitError(tt.err))
+		})
+	}
+}
+
+func TestGoogleIdentityProviderUsersLookup(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	newUser := func(id int) *admin.User {
+		return &admin.User{
+			Id:           fmt.Sprintf("%d", id),
+			PrimaryEmail: fmt.Sprintf("user.%d@mail.com", id),
+			Name:         &admin.UserName{GivenName: "user", FamilyName: fmt.Sprintf("%d", id)},
+		}
+	}
+
+	// usersPages returns the pages, the pages read are counted in read
+	usersPages := func(read *int, pages ...[]*admin.User) iter.Seq2[[]*admin.User, error] {
+		return func(yield func([]*admin.User, error) bool) {
+			for _, page := range pages {
+				*read++
+				if !yield(page, nil) {
+					return
+				}
+			}
+		}
+	}
+
+	newGroupsMembers := func(ids ...int) *model.GroupsMembersResult {
+		members := make([]*model.Member, len(ids))
+		for j, id := range ids {
+			members[j] = &model.Member{IPID: fmt.Sprintf("%d", id), Email: fmt.Sprintf("user.%d@mail.com", id)}
+		}
+		return model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+			{Group: &model.Group{IPID: "1", Name: "group 1"}, Resources: members},
+		}).Build()
+	}
+
+	emails := func(ur *model.UsersResult) []string {
+		e := make([]string, 0, len(ur.Resources))
+		for _, u := range ur.Resources {
+			e = append(e, u.GetPrimaryEmailAddress())
+		}
+		return e
+	}
+
+	t.Run("list should join the users by id or email and get the members not found", func(t *testing.T) {
+		mockDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		ctx := context.TODO()
+
+		// user 2 is found by its email because the member doesn't have the id
+		gmr := newGroupsMembers(4, 1, 2)
+		gmr.Resources[0].Resources[2].IPID = ""
+
+		read := 0
+		mockDS.EXPECT().ListUsersPages(ctx).Return(usersPages(&read, []*admin.User{newUser(1), newUser(2)}, []*admin.User{newUser(3)})).Times(1)
+		mockDS.EXPECT().GetUser(ctx, "user.4@mail.com").Return(newUser(4), nil).Times(1)
+
+		svc, err := NewIdentityProvider(mockDS, WithGoogleUsersLookup(GoogleUsersLookupList))
+		assert.NoError(t, err)
+
+		got, err := svc.GetUsersByGroupsMembers(ctx, gmr)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, read)
+		assert.Equal(t, []string{"user.4@mail.com", "user.1@mail.com", "user.2@mail.com"}, emails(got))
+	})
+
+	t.Run("list should skip the users without the required attributes", func(t *testing.T) {
+		mockDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		ctx := context.TODO()
+
+		// user 2 doesn't have a name, so it is not found listing and getting it doesn't build a user either
+		gmr := newGroupsMembers(1, 2)
+		noName := newUser(2)
+		noName.Name = nil
+
+		read := 0
+		mockDS.EXPECT().ListUsersPages(ctx).Return(usersPages(&read, []*admin.User{newUser(1), noName})).Times(1)
+		mockDS.EXPECT().GetUser(ctx, "user.2@mail.com").Return(noName, nil).Times(1)
+
+		svc, err := NewIdentityProvider(mockDS, WithGoogleUsersLookup(GoogleUsersLookupList))
+		assert.NoError(t, err)
+
+		got, err := svc.GetUsersByGroupsMembers(ctx, gmr)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, got.Items)
+		assert.Equal(t, []string{"user.1@mail.com"}, emails(got))
+	})
+
+	t.Run("list and get should return the same users", func(t *testing.T) {
+		ctx := context.TODO()
+		gmr := newGroupsMembers(2, 1)
+
+		listDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		read := 0
+		listDS.EXPECT().ListUsersPages(ctx).Return(usersPages(&read, []*admin.User{newUser(1), newUser(2)})).Times(1)
+
+		getDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		getDS.EXPECT().GetUser(ctx, "user.2@mail.com").Return(newUser(2), nil).Times(1)
+		getDS.EXPECT().GetUser(ctx, "user.1@mail.com").Return(newUser(1), nil).Times(1)
+
+		listSvc, err := NewIdentityProvider(listDS, WithGoogleUsersLookup(GoogleUsersLookupList))
+		assert.NoError(t, err)
+		getSvc, err := NewIdentityProvider(getDS, WithGoogleUsersLookup(GoogleUsersLookupGet))
+		assert.NoError(t, err)
+
+		listed, err := listSvc.GetUsersByGroupsMembers(ctx, gmr)
+		assert.NoError(t, err)
+		got, err := getSvc.GetUsersByGroupsMembers(ctx, gmr)
+		assert.NoError(t, err)
+
+		assert.Equal(t, got, listed)
+	})
+
+	t.Run("auto should stop listing when getting the pending members costs less", func(t *testing.T) {
+		mockDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		ctx := context.TODO()
+
+		read := 0
+		mockDS.EXPECT().ListUsersPages(ctx).Return(usersPages(&read,
+			[]*admin.User{newUser(1), newUser(10)},
+			[]*admin.User{newUser(2), newUser(20)},
+			[]*admin.User{newUser(3), newUser(30)},
+		)).Times(1)
+		mockDS.EXPECT().GetUser(ctx, "user.3@mail.com").Return(newUser(3), nil).Times(1)
+
+		svc, err := NewIdentityProvider(mockDS)
+		assert.NoError(t, err)
+
+		got, err := svc.GetUsersByGroupsMembers(ctx, newGroupsMembers(1, 2, 3))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, read)
+		assert.Equal(t, []string{"user.1@mail.com", "user.2@mail.com", "user.3@mail.com"}, emails(got))
+	})
+
+	t.Run("list should retry the throttled pages without repeating the pages already read", func(t *testing.T) {
+		mockDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		ctx := context.TODO()
+
+		throttled := func(yield func([]*admin.User, error) bool) {
+			if !yield([]*admin.User{newUser(1)}, nil) {
+				return
+			}
+			yield(nil, &googleapi.Error{Code: 429})
+		}
+
+		read := 0
+		gomock.InOrder(
+			mockDS.EXPECT().ListUsersPages(ctx).Return(iter.Seq2[[]*admin.User, error](throttled)),
+			mockDS.EXPECT().ListUsersPages(ctx).Return(usersPages(&read, []*admin.User{newUser(1)}, []*admin.User{newUser(2)})),
+		)
+
+		svc, err := NewIdentityProvider(mockDS, WithGoogleUsersLookup(GoogleUsersLookupList))
+		assert.NoError(t, err)
+		svc.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+
+		got, err := svc.GetUsersByGroupsMembers(ctx, newGroupsMembers(1, 2))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, read)
+		assert.Equal(t, []string{"user.1@mail.com", "user.2@mail.com"}, emails(got))
+	})
+
+	t.Run("list should return the error of the pages", func(t *testing.T) {
+		mockDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		ctx := context.TODO()
+
+		failed := func(yield func([]*admin.User, error) bool) {
+			yield(nil, errors.New("test error"))
+		}
+		mockDS.EXPECT().ListUsersPages(ctx).Return(iter.Seq2[[]*admin.User, error](failed)).Times(1)
+
+		svc, err := NewIdentityProvider(mockDS, WithGoogleUsersLookup(GoogleUsersLookupList))
+		assert.NoError(t, err)
+
+		got, err := svc.GetUsersByGroupsMembers(ctx, newGroupsMembers(1))
+		assert.Error(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("invalid users lookup", func(t *testing.T) {
+		mockDS := mocks.NewMockGoogleProviderService(mockCtrl)
+
+		svc, err := NewIdentityProvider(mockDS, WithGoogleUsersLookup("invalid"))
+		assert.ErrorIs(t, err, ErrGoogleUsersLookupInvalid)
+		assert.Nil(t, svc)
+	})
+}
@@ -0,0 +1,703 @@
+package idp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"github.com/slashdevops/idp-scim-sync/pkg/ldap"
+)
+
+// This implement core.IdentityProviderService interface for LDAP directories, like Active Directory or OpenLDAP
+
+const (
+	// DefaultLDAPUserObjectFilter is the default filter to identify the users entries.
+	DefaultLDAPUserObjectFilter = "(&(objectClass=person)(!(objectClass=computer)))"
+
+	// DefaultLDAPGroupObjectFilter is the default filter to identify the groups entries.
+	DefaultLDAPGroupObjectFilter = "(|(objectClass=group)(objectClass=groupOfNames)(objectClass=groupOfUniqueNames))"
+
+	// DefaultLDAPGroupMemberAttribute is the default group attribute containing the DN of its members.
+	DefaultLDAPGroupMemberAttribute = "member"
+
+	// adUserAccountControl is the Active Directory attribute with the account flags.
+	adUserAccountControl = "userAccountControl"
+
+	// adAccountDisable is the flag of the userAccountControl attribute for disabled accounts.
+	// reference: https://learn.microsoft.com/en-us/troubleshoot/windows-server/active-directory/useraccountcontrol-manipulate-account-properties
+	adAccountDisable = 0x2
+)
+
+var (
+	// ErrLDAPServiceNil is returned when the LDAPProviderService is nil.
+	ErrLDAPServiceNil = errors.New("provider: ldap service is nil")
+
+	// ErrLDAPUsersBaseDNEmpty is returned when the users base DN is empty.
+	ErrLDAPUsersBaseDNEmpty = errors.New("provider: ldap users base dn is empty")
+
+	// ErrLDAPGroupsBaseDNEmpty is returned when the groups base DN is empty.
+	ErrLDAPGroupsBaseDNEmpty = errors.New("provider: ldap groups base dn is empty")
+
+	// ErrLDAPAttributeMappingUnknown is returned when an attribute mapping key is not a known model field.
+	ErrLDAPAttributeMappingUnknown = errors.New("provider: unknown ldap attribute mapping")
+)
+
+//go:generate go run go.uber.org/mock/mockgen@v0.5.0 -package=mocks -destination=../../mocks/idp/ldap_mocks.go -source=ldap.go LDAPProviderService
+
+// LDAPProviderService is the interface that wraps the LDAP Service methods.
+type LDAPProviderService interface {
+	Search(ctx context.Context, baseDN, filter string, attributes []string) ([]*ldap.Entry, error)
+	GetEntry(ctx context.Context, dn, filter string, attributes []string) (*ldap.Entry, error)
+}
+
+// LDAPAttributeMapping defines the LDAP attributes used to fill the model.User and model.Group fields,
+// an empty attribute leaves the field empty.
+type LDAPAttributeMapping struct {
+	UserName          string
+	Email             string
+	GivenName         string
+	FamilyName        string
+	DisplayName       string
+	Title             string
+	UserType          string
+	PreferredLanguage string
+	PhoneNumber       string
+	MobilePhone       string
+	StreetAddress     string
+	Locality          string
+	Region            string
+	PostalCode        string
+	Country           string
+	EmployeeNumber    string
+	CostCenter        string
+	Organization      string
+	Division          string
+	Department        string
+	GroupName         string
+	GroupEmail        string
+}
+
+// DefaultLDAPAttributeMapping returns the attribute mapping for Active Directory.
+func DefaultLDAPAttributeMapping() LDAPAttributeMapping {
+	return LDAPAttributeMapping{
+		UserName:          "userPrincipalName",
+		Email:             "mail",
+		GivenName:         "givenName",
+		FamilyName:        "sn",
+		DisplayName:       "displayName",
+		Title:             "title",
+		UserType:          "employeeType",
+		PreferredLanguage: "preferredLanguage",
+		PhoneNumber:       "telephoneNumber",
+		MobilePhone:       "mobile",
+		StreetAddress:     "streetAddress",
+		Locality:          "l",
+		Region:            "st",
+		PostalCode:        "postalCode",
+		Country:           "co",
+		EmployeeNumber:    "employeeID",
+		CostCenter:        "",
+		Organization:      "company",
+		Division:          "division",
+		Department:        "department",
+		GroupName:         "cn",
+		GroupEmail:        "mail",
+	}
+}
+
+// fields returns the mapping keys and the fields they set.
+func (m *LDAPAttributeMapping) fields() map[string]*string {
+	return map[string]*string{
+		"user_name":          &m.UserName,
+		"email":              &m.Email,
+		"given_name":         &m.GivenName,
+		"family_name":        &m.FamilyName,
+		"display_name":       &m.DisplayName,
+		"title":              &m.Title,
+		"user_type":          &m.UserType,
+		"preferred_language": &m.PreferredLanguage,
+		"phone_number":       &m.PhoneNumber,
+		"mobile_phone":       &m.MobilePhone,
+		"street_address":     &m.StreetAddress,
+		"locality":           &m.Locality,
+		"region":             &m.Region,
+		"postal_code":        &m.PostalCode,
+		"country":            &m.Country,
+		"employee_number":    &m.EmployeeNumber,
+		"cost_center":        &m.CostCenter,
+		"organization":       &m.Organization,
+		"division":           &m.Division,
+		"department":         &m.Department,
+		"group_name":         &m.GroupName,
+		"group_email":        &m.GroupEmail,
+	}
+}
+
+// Override returns a copy of the mapping with the given attributes, the keys are the snake case
+// name of the fields, example: {"email": "userPrincipalName", "cost_center": "extensionAttribute1"}.
+func (m LDAPAttributeMapping) Override(attributes map[string]string) (LDAPAttributeMapping, error) {
+	fields := m.fields()
+
+	for key, attr := range attributes {
+		field, ok := fields[strings.ToLower(key)]
+		if !ok {
+			return m, fmt.Errorf("%w: %s", ErrLDAPAttributeMappingUnknown, key)
+		}
+		*field = attr
+	}
+
+	return m, nil
+}
+
+// userAttributes returns the LDAP attributes needed to build the users.
+func (m *LDAPAttributeMapping) userAttributes() []string {
+	attrs := []string{adUserAccountControl}
+	for key, attr := range m.fields() {
+		if attr != nil && *attr != "" && !strings.HasPrefix(key, "group_") {
+			attrs = append(attrs, *attr)
+		}
+	}
+	sort.Strings(attrs)
+
+	return attrs
+}
+
+// LDAPIdentityProvider is the Identity Provider service that implements the core.IdentityProvider interface and consumes the pkg.ldap methods.
+//
+// The users and groups are identified by their DN.
+type LDAPIdentityProvider struct {
+	ps                LDAPProviderService
+	usersBaseDN       string
+	groupsBaseDN      string
+	userObjectFilter  string
+	groupObjectFilter string
+	memberAttribute   string
+	memberOfAttribute string
+	nestedGroups      bool
+	mapping           LDAPAttributeMapping
+}
+
+// LDAPIdentityProviderOption is a function that configures the LDAPIdentityProvider.
+type LDAPIdentityProviderOption func(*LDAPIdentityProvider)
+
+// WithLDAPUsersBaseDN sets the base DN where the users are searched.
+func WithLDAPUsersBaseDN(baseDN string) LDAPIdentityProviderOption {
+	return func(i *LDAPIdentityProvider) {
+		i.usersBaseDN = baseDN
+	}
+}
+
+// WithLDAPGroupsBaseDN sets the base DN where the groups are searched.
+func WithLDAPGroupsBaseDN(baseDN string) LDAPIdentityProviderOption {
+	return func(i *LDAPIdentityProvider) {
+		i.groupsBaseDN = baseDN
+	}
+}
+
+// WithLDAPUserObjectFilter sets the filter that identifies the users entries, example: (objectClass=inetOrgPerson).
+func WithLDAPUserObjectFilter(filter string) LDAPIdentityProviderOption {
+	return func(i *LDAPIdentityProvider) {
+		if filter != "" {
+			i.userObjectFilter = filter
+		}
+	}
+}
+
+// WithLDAPGroupObjectFilter sets the filter that identifies the groups entries, example: (objectClass=groupOfNames).
+func WithLDAPGroupObjectFilter(filter string) LDAPIdentityProviderOption {
+	return func(i *LDAPIdentityProvider) {
+		if filter != "" {
+			i.groupObjectFilter = filter
+		}
+	}
+}
+
+// WithLDAPGroupMemberAttribute sets the group attribute containing the DN of its members, example: member or uniqueMember.
+func WithLDAPGroupMemberAttribute(attribute string) LDAPIdentityProviderOption {
+	return func(i *LDAPIdentityProvider) {
+		if attribute != "" {
+			i.memberAttribute = attribute
+		}
+	}
+}
+
+// WithLDAPUserMemberOfAttribute resolves the members of the groups searching the entries whose given attribute,
+// example: memberOf, contains the DN of the group, instead of reading the member attribute of the group.
+func WithLDAPUserMemberOfAttribute(attribute string) LDAPIdentityProviderOption {
+	return func(i *LDAPIdentityProvider) {
+		i.memberOfAttribute = attribute
+	}
+}
+
+// WithLDAPNestedGroups expands the members of the nested groups as members of the parent groups.
+func WithLDAPNestedGroups(nested bool) LDAPIdentityProviderOption {
+	return func(i *LDAPIdentityProvider) {
+		i.nestedGroups = nested
+	}
+}
+
+// WithLDAPAttributeMapping sets the attribute mapping.
+func WithLDAPAttributeMapping(mapping LDAPAttributeMapping) LDAPIdentityProviderOption {
+	return func(i *LDAPIdentityProvider) {
+		i.mapping = mapping
+	}
+}
+
+// NewLDAPIdentityProvider returns a new instance of the LDAP Identity Provider service.
+func NewLDAPIdentityProvider(lps LDAPProviderService, opts ...LDAPIdentityProviderOption) (*LDAPIdentityProvider, error) {
+	if lps == nil {
+		return nil, ErrLDAPServiceNil
+	}
+
+	i := &LDAPIdentityProvider{
+		ps:                lps,
+		userObjectFilter:  DefaultLDAPUserObjectFilter,
+		groupObjectFilter: DefaultLDAPGroupObjectFilter,
+		memberAttribute:   DefaultLDAPGroupMemberAttribute,
+		mapping:           DefaultLDAPAttributeMapping(),
+	}
+
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	if i.usersBaseDN == "" {
+		return nil, ErrLDAPUsersBaseDNEmpty
+	}
+
+	if i.groupsBaseDN == "" {
+		return nil, ErrLDAPGroupsBaseDNEmpty
+	}
+
+	return i, nil
+}
+
+// Close closes the LDAP service connection when the service supports it.
+func (i *LDAPIdentityProvider) Close() error {
+	if c, ok := i.ps.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// searchFiltered returns the entries that match the object filter, once per filter,
+// when there are no filters all the entries that match the object filter are returned.
+func (i *LDAPIdentityProvider) searchFiltered(ctx context.Context, baseDN, objectFilter string, filter []string, attributes []string) ([]*ldap.Entry, error) {
+	filters := make([]string, 0, len(filter))
+	for _, f := range filter {
+		if f != "" {
+			filters = append(filters, fmt.Sprintf("(&%s%s)", objectFilter, f))
+		}
+	}
+
+	if len(filters) == 0 {
+		filters = append(filters, objectFilter)
+	}
+
+	entries := make([]*ldap.Entry, 0)
+	for _, f := range filters {
+		e, err := i.ps.Search(ctx, baseDN, f, attributes)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e...)
+	}
+
+	return entries, nil
+}
+
+// GetGroups returns a list of groups from the LDAP directory.
+//
+// The filter parameter is a list of LDAP filters combined with the group object filter, example: "(cn=AWS*)".
+//
+// This method checks the names of the groups and avoid the second, third, etc repetition of the same group name.
+func (i *LDAPIdentityProvider) GetGroups(ctx context.Context, filter []string) (*model.GroupsResult, error) {
+	entries, err := i.searchFiltered(ctx, i.groupsBaseDN, i.groupObjectFilter, filter, []string{i.mapping.GroupName, i.mapping.GroupEmail})
+	if err != nil {
+		return nil, fmt.Errorf("idp: error getting groups: %w", err)
+	}
+
+	uniqueGroups := make(map[string]struct{}, len(entries))
+	syncGroups := make([]*model.Group, 0, len(entries))
+	for _, entry := range entries {
+		name := strings.TrimSpace(entry.GetAttributeValue(i.mapping.GroupName))
+		if name == "" {
+			slog.Warn("idp: group name is empty, this group will be avoided", "dn", entry.DN)
+			continue
+		}
+
+		if _, ok := uniqueGroups[name]; ok {
+			slog.Warn("idp: group already exists with the same name, this group will be avoided, please make your groups uniques by name!",
+				"dn", entry.DN,
+				"name", name,
+			)
+			continue
+		}
+		uniqueGroups[name] = struct{}{}
+
+		gg := model.GroupBuilder().
+			WithIPID(entry.DN).
+			WithName(name).
+			WithEmail(strings.TrimSpace(entry.GetAttributeValue(i.mapping.GroupEmail))).
+			Build()
+
+		syncGroups = append(syncGroups, gg)
+	}
+
+	syncResult := model.GroupsResultBuilder().WithResources(syncGroups).Build()
+	slog.Debug("idp: ldap GetGroups()", "groups", len(syncGroups))
+
+	return syncResult, nil
+}
+
+// GetUsers returns a list of users from the LDAP directory.
+//
+// The filter parameter is a list of LDAP filters combined with the user object filter, example: "(department=Engineering)".
+func (i *LDAPIdentityProvider) GetUsers(ctx context.Context, filter []string) (*model.UsersResult, error) {
+	entries, err := i.searchFiltered(ctx, i.usersBaseDN, i.userObjectFilter, filter, i.mapping.userAttributes())
+	if err != nil {
+		return nil, fmt.Errorf("idp: error getting users: %w", err)
+	}
+
+	syncUsers := make([]*model.User, 0, len(entries))
+	for _, entry := range entries {
+		if u := i.buildUser(entry); u != nil {
+			syncUsers = append(syncUsers, u)
+		}
+	}
+
+	uResult := model.UsersResultBuilder().WithResources(syncUsers).Build()
+	slog.Debug("idp: ldap GetUsers()", "users", len(syncUsers))
+
+	return uResult, nil
+}
+
+// GetGroupMembers returns the members of the group, when the nested groups are enabled the members
+// of the nested groups are members of the group too.
+func (i *LDAPIdentityProvider) GetGroupMembers(ctx context.Context, groupID string) (*model.MembersResult, error) {
+	if groupID == "" {
+		return nil, ErrGroupIDNil
+	}
+
+	users := make([]*ldap.Entry, 0)
+	if err := i.collectMembers(ctx, groupID, map[string]struct{}{strings.ToLower(groupID): {}}, make(map[string]struct{}), &users); err != nil {
+		return nil, fmt.Errorf("idp: error getting group members: %w", err)
+	}
+
+	syncMembers := make([]*model.Member, 0, len(users))
+	for _, user := range users {
+		status := "ACTIVE"
+		if !ldapUserActive(user) {
+			status = "SUSPENDED"
+		}
+
+		gm := model.MemberBuilder().
+			WithIPID(user.DN).
+			WithEmail(strings.TrimSpace(user.GetAttributeValue(i.mapping.Email))).
+			WithStatus(status).
+			Build()
+
+		syncMembers = append(syncMembers, gm)
+	}
+
+	syncMembersResult := model.MembersResultBuilder().WithResources(syncMembers).Build()
+	slog.Debug("idp: ldap GetGroupMembers()", "members", len(syncMembers))
+
+	return syncMembersResult, nil
+}
+
+// collectMembers appends to users the users that are members of the group, visitedGroups avoids
+// the cycles between nested groups and visitedUsers the repeated users.
+func (i *LDAPIdentityProvider) collectMembers(
+	ctx context.Context,
+	groupDN string,
+	visitedGroups map[string]struct{},
+	visitedUsers map[string]struct{},
+	users *[]*ldap.Entry,
+) error {
+	userAttrs := i.mapping.userAttributes()
+
+	// memberOf: the entries point to their groups
+	if i.memberOfAttribute != "" {
+		filter := fmt.Sprintf("(%s=%s)", i.memberOfAttribute, ldap.EscapeFilter(groupDN))
+
+		members, err := i.ps.Search(ctx, i.usersBaseDN, fmt.Sprintf("(&%s%s)", i.userObjectFilter, filter), userAttrs)
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			if _, ok := visitedUsers[strings.ToLower(member.DN)]; !ok {
+				visitedUsers[strings.ToLower(member.DN)] = struct{}{}
+				*users = append(*users, member)
+			}
+		}
+
+		if !i.nestedGroups {
+			return nil
+		}
+
+		nested, err := i.ps.Search(ctx, i.groupsBaseDN, fmt.Sprintf("(&%s%s)", i.groupObjectFilter, filter), []string{i.mapping.GroupName})
+		if err != nil {
+			return err
+		}
+		for _, group := range nested {
+			if err := i.collectNested(ctx, group.DN, visitedGroups, visitedUsers, users); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// member: the groups point to their members
+	group, err := i.ps.GetEntry(ctx, groupDN, i.groupObjectFilter, []string{i.memberAttribute})
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		slog.Warn("idp: ldap group not found", "dn", groupDN)
+		return nil
+	}
+
+	for _, memberDN := range group.GetAttributeValues(i.memberAttribute) {
+		if _, ok := visitedUsers[strings.ToLower(memberDN)]; ok {
+			continue
+		}
+
+		user, err := i.ps.GetEntry(ctx, memberDN, i.userObjectFilter, userAttrs)
+		if err != nil {
+			return err
+		}
+
+		if user != nil {
+			visitedUsers[strings.ToLower(user.DN)] = struct{}{}
+			*users = append(*users, user)
+			continue
+		}
+
+		if i.nestedGroups {
+			if err := i.collectNested(ctx, memberDN, visitedGroups, visitedUsers, users); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// collectNested collects the members of a nested group once.
+func (i *LDAPIdentityProvider) collectNested(
+	ctx context.Context,
+	groupDN string,
+	visitedGroups map[string]struct{},
+	visitedUsers map[string]struct{},
+	users *[]*ldap.Entry,
+) error {
+	if _, ok := visitedGroups[strings.ToLower(groupDN)]; ok {
+		return nil
+	}
+	visitedGroups[strings.ToLower(groupDN)] = struct{}{}
+
+	slog.Debug("idp: ldap expanding nested group", "dn", groupDN)
+
+	return i.collectMembers(ctx, groupDN, visitedGroups, visitedUsers, users)
+}
+
+// GetUsersByGroupsMembers returns the users that are members of the groups.
+func (i *LDAPIdentityProvider) GetUsersByGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.UsersResult, error) {
+	if gmr == nil {
+		return nil, ErrGroupResultNil
+	}
+
+	userAttrs := i.mapping.userAttributes()
+
+	uniqUsers := make(map[string]struct{}, len(gmr.Resources))
+	pUsers := make([]*model.User, 0, len(gmr.Resources))
+	for _, groupMembers := range gmr.Resources {
+		for _, member := range groupMembers.Resources {
+			if _, ok := uniqUsers[member.IPID]; ok {
+				continue
+			}
+			uniqUsers[member.IPID] = struct{}{}
+
+			entry, err := i.ps.GetEntry(ctx, member.IPID, i.userObjectFilter, userAttrs)
+			if err != nil {
+				return nil, fmt.Errorf("idp: error getting user: %+v, email: %s, error: %w", member.IPID, member.Email, err)
+			}
+			if entry == nil {
+				slog.Warn("idp: ldap user not found", "dn", member.IPID)
+				continue
+			}
+
+			if gu := i.buildUser(entry); gu != nil {
+				pUsers = append(pUsers, gu)
+			}
+		}
+	}
+
+	pUsersResult := model.UsersResultBuilder().WithResources(pUsers).Build()
+	slog.Debug("idp: ldap GetUsersByGroupsMembers()", "users", len(pUsers))
+
+	return pUsersResult, nil
+}
+
+// GetGroupsMembers return the members of the groups
+func (i *LDAPIdentityProvider) GetGroupsMembers(ctx context.Context, gr *model.GroupsResult) (*model.GroupsMembersResult, error) {
+	if gr == nil {
+		return nil, ErrGroupResultNil
+	}
+
+	groupMembers := make([]*model.GroupMembers, 0, len(gr.Resources))
+	for _, group := range gr.Resources {
+		members, err := i.GetGroupMembers(ctx, group.IPID)
+		if err != nil {
+			return nil, fmt.Errorf("idp: error getting group members: %w", err)
+		}
+
+		ggm := model.GroupBuilder().
+			WithIPID(group.IPID).
+			WithName(group.Name).
+			WithEmail(group.Email).
+			Build()
+
+		groupMember := model.GroupMembersBuilder().
+			WithGroup(ggm).
+			WithResources(members.Resources).
+			Build()
+
+		groupMembers = append(groupMembers, groupMember)
+	}
+
+	groupsMembersResult := model.GroupsMembersResultBuilder().WithResources(groupMembers).Build()
+	slog.Debug("idp: ldap GetGroupsMembers()", "groups", len(groupMembers))
+
+	return groupsMembersResult, nil
+}
+
+// ldapUserActive returns false when the Active Directory account is disabled.
+func ldapUserActive(entry *ldap.Entry) bool {
+	uac, err := strconv.ParseInt(entry.GetAttributeValue(adUserAccountControl), 10, 64)
+	if err != nil {
+		return true
+	}
+	return uac&adAccountDisable == 0
+}
+
+// buildUser builds a User model from an LDAP entry using the attribute mapping
+func (i *LDAPIdentityProvider) buildUser(entry *ldap.Entry) *model.User {
+	get := func(attr string) string {
+		return strings.TrimSpace(entry.GetAttributeValue(attr))
+	}
+
+	m := i.mapping
+	givenName, familyName, userName, email := get(m.GivenName), get(m.FamilyName), get(m.UserName), get(m.Email)
+
+	// these fields are required because the Constrains defined here:
+	// https://docs.aws.amazon.com/singlesignon/latest/developerguide/createuser.html
+	if givenName == "" {
+		slog.Warn("idp: User given name is empty", "dn", entry.DN, "attribute", m.GivenName)
+		return nil
+	}
+
+	if familyName == "" {
+		slog.Warn("idp: User family name is empty", "dn", entry.DN, "attribute", m.FamilyName)
+		return nil
+	}
+
+	if userName == "" {
+		slog.Warn("idp: User name is empty", "dn", entry.DN, "attribute", m.UserName)
+		return nil
+	}
+
+	if email == "" {
+		slog.Warn("idp: User email is empty", "dn", entry.DN, "attribute", m.Email)
+		return nil
+	}
+
+	emails := []model.Email{
+		model.EmailBuilder().
+			WithPrimary(true).
+			WithType("work").
+			WithValue(email).
+			Build(),
+	}
+
+	var phoneNumbers []model.PhoneNumber
+	if phone := get(m.PhoneNumber); phone != "" {
+		phoneNumbers = append(phoneNumbers, model.PhoneNumberBuilder().WithValue(phone).WithType("work").Build())
+	} else if mobile := get(m.MobilePhone); mobile != "" {
+		phoneNumbers = append(phoneNumbers, model.PhoneNumberBuilder().WithValue(mobile).WithType("mobile").Build())
+	}
+
+	var addresses []model.Address
+	street, locality, region, postalCode, country := get(m.StreetAddress), get(m.Locality), get(m.Region), get(m.PostalCode), get(m.Country)
+	if street != "" || locality != "" || region != "" || postalCode != "" || country != "" {
+		formatted := make([]string, 0, 5)
+		for _, v := range []string{street, locality, region, postalCode, country} {
+			if v != "" {
+				formatted = append(formatted, v)
+			}
+		}
+
+		addresses = append(addresses,
+			model.AddressBuilder().
+				WithFormatted(strings.Join(formatted, ", ")).
+				WithStreetAddress(street).
+				WithLocality(locality).
+				WithRegion(region).
+				WithPostalCode(postalCode).
+				WithCountry(country).
+				Build())
+	}
+
+	var enterpriseData *model.EnterpriseData
+	employeeNumber, costCenter, organization, division, department := get(m.EmployeeNumber), get(m.CostCenter), get(m.Organization), get(m.Division), get(m.Department)
+	if employeeNumber != "" || costCenter != "" || organization != "" || division != "" || department != "" {
+		enterpriseData = model.EnterpriseDataBuilder().
+			WithEmployeeNumber(employeeNumber).
+			WithCostCenter(costCenter).
+			WithOrganization(organization).
+			WithDivision(division).
+			WithDepartment(department).
+			Build()
+	}
+
+	displayName := get(m.DisplayName)
+	if displayName == "" {
+		displayName = fmt.Sprintf("%s %s", givenName, familyName)
+	}
+
+	name := model.NameBuilder().
+		WithGivenName(givenName).
+		WithFamilyName(familyName).
+		WithFormatted(displayName).
+		Build()
+
+	userModel := model.UserBuilder().
+		WithIPID(entry.DN).
+		WithUserName(userName).
+		WithDisplayName(displayName).
+		WithNickName(givenName, familyName).
+		WithTitle(get(m.Title)).
+		WithUserType(get(m.UserType)).
+		WithPreferredLanguage(get(m.PreferredLanguage)).
+		WithActive(ldapUserActive(entry)).
+		// Arrays
+		WithEmails(emails).
+		WithAddresses(addresses).
+		WithPhoneNumbers(phoneNumbers).
+		// Pointers
+		WithName(name).
+		WithEnterpriseData(enterpriseData).
+		Build()
+
+	slog.Debug("idp: ldap buildUser() converted user", "from", entry.DN, "to", userModel)
+
+	return userModel
+}
@@ -0,0 +1,346 @@
+package idp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/idp"
+	"github.com/slashdevops/idp-scim-sync/pkg/ldap"
+	"github.com/slashdevops/idp-scim-sync/pkg/ldap/ldaptest"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+const (
+	testLDAPBindDN   = "cn=admin,dc=example,dc=com"
+	testLDAPPassword = "secret"
+	testLDAPUsersDN  = "ou=people,dc=example,dc=com"
+	testLDAPGroupsDN = "ou=groups,dc=example,dc=com"
+)
+
+// newLDAPServer returns an in-process Active Directory like LDAP server
+//
+//	group 1 -> user 1, group 2 -> user 2 (disabled), group 3 -> user 3 (missing sn)
+//	group 2 is member of group 1 and group 1 of group 2 (cycle)
+func newLDAPServer() *ldaptest.Server {
+	user := func(cn string, attrs map[string][]string) *ldaptest.Entry {
+		attrs["objectClass"] = []string{"top", "person", "organizationalPerson", "user"}
+		attrs["cn"] = []string{cn}
+		return &ldaptest.Entry{DN: "cn=" + cn + "," + testLDAPUsersDN, Attributes: attrs}
+	}
+	group := func(cn string, attrs map[string][]string) *ldaptest.Entry {
+		attrs["objectClass"] = []string{"top", "group"}
+		attrs["cn"] = []string{cn}
+		return &ldaptest.Entry{DN: "cn=" + cn + "," + testLDAPGroupsDN, Attributes: attrs}
+	}
+
+	return ldaptest.NewServer(testLDAPBindDN, testLDAPPassword,
+		&ldaptest.Entry{DN: "dc=example,dc=com", Attributes: map[string][]string{"objectClass": {"domain"}}},
+		&ldaptest.Entry{DN: testLDAPUsersDN, Attributes: map[string][]string{"objectClass": {"organizationalUnit"}}},
+		&ldaptest.Entry{DN: testLDAPGroupsDN, Attributes: map[string][]string{"objectClass": {"organizationalUnit"}}},
+		user("user 1", map[string][]string{
+			"userPrincipalName":  {"user.1@example.com"},
+			"mail":               {"user.1@example.com"},
+			"givenName":          {"user"},
+			"sn":                 {"1"},
+			"displayName":        {"User One"},
+			"title":              {"engineer"},
+			"telephoneNumber":    {"+34 000 000 001"},
+			"l":                  {"Madrid"},
+			"co":                 {"Spain"},
+			"employeeID":         {"0001"},
+			"department":         {"IT"},
+			"extensionAttribute": {"cc-1"},
+			"userAccountControl": {"512"},
+			"memberOf":           {"cn=group 1," + testLDAPGroupsDN},
+		}),
+		user("user 2", map[string][]string{
+			"userPrincipalName":  {"user.2@example.com"},
+			"mail":               {"user.2@example.com"},
+			"givenName":          {"user"},
+			"sn":                 {"2"},
+			"userAccountControl": {"514"},
+			"memberOf":           {"cn=group 2," + testLDAPGroupsDN},
+		}),
+		user("user 3", map[string][]string{
+			"userPrincipalName": {"user.3@example.com"},
+			"mail":              {"user.3@example.com"},
+			"givenName":         {"user"},
+			"memberOf":          {"cn=group 3," + testLDAPGroupsDN},
+		}),
+		group("group 1", map[string][]string{
+			"mail":   {"group.1@example.com"},
+			"member": {"cn=user 1," + testLDAPUsersDN, "cn=group 2," + testLDAPGroupsDN},
+		}),
+		group("group 2", map[string][]string{
+			"member":   {"cn=user 2," + testLDAPUsersDN, "cn=group 1," + testLDAPGroupsDN},
+			"memberOf": {"cn=group 1," + testLDAPGroupsDN},
+		}),
+		group("group 3", map[string][]string{
+			"member":   {"cn=user 3," + testLDAPUsersDN, "cn=missing," + testLDAPUsersDN},
+			"memberOf": {"cn=group 2," + testLDAPGroupsDN},
+		}),
+	)
+}
+
+func newTestLDAPIdentityProvider(t *testing.T, srv *ldaptest.Server, opts ...LDAPIdentityProviderOption) *LDAPIdentityProvider {
+	t.Helper()
+
+	svc, err := ldap.NewService(srv.URL, testLDAPBindDN, testLDAPPassword, ldap.WithPageSize(2))
+	assert.NoError(t, err)
+	t.Cleanup(func() { svc.Close() })
+
+	opts = append([]LDAPIdentityProviderOption{
+		WithLDAPUsersBaseDN(testLDAPUsersDN),
+		WithLDAPGroupsBaseDN(testLDAPGroupsDN),
+	}, opts...)
+
+	ldapIDP, err := NewLDAPIdentityProvider(svc, opts...)
+	assert.NoError(t, err)
+
+	return ldapIDP
+}
+
+func TestNewLDAPIdentityProvider(t *testing.T) {
+	t.Run("nil service", func(t *testing.T) {
+		got, err := NewLDAPIdentityProvider(nil)
+		assert.ErrorIs(t, err, ErrLDAPServiceNil)
+		assert.Nil(t, got)
+	})
+
+	t.Run("empty users base dn", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		got, err := NewLDAPIdentityProvider(mocks.NewMockLDAPProviderService(mockCtrl), WithLDAPGroupsBaseDN(testLDAPGroupsDN))
+		assert.ErrorIs(t, err, ErrLDAPUsersBaseDNEmpty)
+		assert.Nil(t, got)
+	})
+
+	t.Run("empty groups base dn", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		got, err := NewLDAPIdentityProvider(mocks.NewMockLDAPProviderService(mockCtrl), WithLDAPUsersBaseDN(testLDAPUsersDN))
+		assert.ErrorIs(t, err, ErrLDAPGroupsBaseDNEmpty)
+		assert.Nil(t, got)
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		got, err := NewLDAPIdentityProvider(mocks.NewMockLDAPProviderService(mockCtrl),
+			WithLDAPUsersBaseDN(testLDAPUsersDN),
+			WithLDAPGroupsBaseDN(testLDAPGroupsDN),
+			WithLDAPUserObjectFilter(""),
+			WithLDAPGroupMemberAttribute(""),
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultLDAPUserObjectFilter, got.userObjectFilter)
+		assert.Equal(t, DefaultLDAPGroupObjectFilter, got.groupObjectFilter)
+		assert.Equal(t, DefaultLDAPGroupMemberAttribute, got.memberAttribute)
+		assert.Equal(t, DefaultLDAPAttributeMapping(), got.mapping)
+	})
+}
+
+func TestLDAPAttributeMapping_Override(t *testing.T) {
+	t.Run("known attributes", func(t *testing.T) {
+		got, err := DefaultLDAPAttributeMapping().Override(map[string]string{"email": "userPrincipalName", "COST_CENTER": "extensionAttribute1"})
+		assert.NoError(t, err)
+		assert.Equal(t, "userPrincipalName", got.Email)
+		assert.Equal(t, "extensionAttribute1", got.CostCenter)
+		assert.Equal(t, "givenName", got.GivenName)
+	})
+
+	t.Run("unknown attribute", func(t *testing.T) {
+		_, err := DefaultLDAPAttributeMapping().Override(map[string]string{"nick_name": "cn"})
+		assert.ErrorIs(t, err, ErrLDAPAttributeMappingUnknown)
+	})
+}
+
+func TestLDAPIdentityProvider(t *testing.T) {
+	ctx := context.TODO()
+
+	srv := newLDAPServer()
+	defer srv.Close()
+
+	t.Run("GetGroups", func(t *testing.T) {
+		ldapIDP := newTestLDAPIdentityProvider(t, srv)
+
+		got, err := ldapIDP.GetGroups(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, got.Items)
+		assert.Equal(t, "cn=group 1,"+testLDAPGroupsDN, got.Resources[0].IPID)
+		assert.Equal(t, "group 1", got.Resources[0].Name)
+		assert.Equal(t, "group.1@example.com", got.Resources[0].Email)
+	})
+
+	t.Run("GetGroups with filters", func(t *testing.T) {
+		ldapIDP := newTestLDAPIdentityProvider(t, srv)
+
+		got, err := ldapIDP.GetGroups(ctx, []string{"(cn=group 1)", "(cn=group 3)"})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, got.Items)
+		assert.Equal(t, "group 1", got.Resources[0].Name)
+		assert.Equal(t, "group 3", got.Resources[1].Name)
+	})
+
+	t.Run("GetUsers maps the attributes and skips users without the required attributes", func(t *testing.T) {
+		mapping, err := DefaultLDAPAttributeMapping().Override(map[string]string{"cost_center": "extensionAttribute"})
+		assert.NoError(t, err)
+
+		ldapIDP := newTestLDAPIdentityProvider(t, srv, WithLDAPAttributeMapping(mapping))
+
+		got, err := ldapIDP.GetUsers(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, got.Items)
+
+		user1 := got.Resources[0]
+		assert.Equal(t, "cn=user 1,"+testLDAPUsersDN, user1.IPID)
+		assert.Equal(t, "user.1@example.com", user1.UserName)
+		assert.Equal(t, "User One", user1.DisplayName)
+		assert.Equal(t, "engineer", user1.Title)
+		assert.True(t, user1.Active)
+		assert.Equal(t, "user.1@example.com", user1.GetPrimaryEmailAddress())
+		assert.Equal(t, "+34 000 000 001", user1.PhoneNumbers[0].Value)
+		assert.Equal(t, "Madrid, Spain", user1.Addresses[0].Formatted)
+		assert.Equal(t, "0001", user1.EnterpriseData.EmployeeNumber)
+		assert.Equal(t, "cc-1", user1.EnterpriseData.CostCenter)
+		assert.Equal(t, "IT", user1.EnterpriseData.Department)
+
+		// disabled Active Directory account
+		user2 := got.Resources[1]
+		assert.False(t, user2.Active)
+		assert.Equal(t, "user 2", user2.DisplayName)
+		assert.Nil(t, user2.EnterpriseData)
+	})
+
+	t.Run("GetUsers with filters", func(t *testing.T) {
+		ldapIDP := newTestLDAPIdentityProvider(t, srv)
+
+		got, err := ldapIDP.GetUsers(ctx, []string{"(department=IT)"})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, got.Items)
+		assert.Equal(t, "user.1@example.com", got.Resources[0].UserName)
+	})
+
+	t.Run("GetGroupMembers without nested groups", func(t *testing.T) {
+		ldapIDP := newTestLDAPIdentityProvider(t, srv)
+
+		got, err := ldapIDP.GetGroupMembers(ctx, "cn=group 1,"+testLDAPGroupsDN)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, got.Items)
+		assert.Equal(t, "user.1@example.com", got.Resources[0].Email)
+		assert.Equal(t, "ACTIVE", got.Resources[0].Status)
+	})
+
+	t.Run("GetGroupMembers with nested groups", func(t *testing.T) {
+		ldapIDP := newTestLDAPIdentityProvider(t, srv, WithLDAPNestedGroups(true))
+
+		// group 1 -> group 2 -> group 1 is a cycle
+		got, err := ldapIDP.GetGroupMembers(ctx, "cn=group 1,"+testLDAPGroupsDN)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, got.Items)
+		assert.Equal(t, "user.1@example.com", got.Resources[0].Email)
+		assert.Equal(t, "user.2@example.com", got.Resources[1].Email)
+		assert.Equal(t, "SUSPENDED", got.Resources[1].Status)
+	})
+
+	t.Run("GetGroupMembers using memberOf", func(t *testing.T) {
+		ldapIDP := newTestLDAPIdentityProvider(t, srv, WithLDAPUserMemberOfAttribute("memberOf"))
+
+		got, err := ldapIDP.GetGroupMembers(ctx, "cn=group 1,"+testLDAPGroupsDN)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, got.Items)
+		assert.Equal(t, "user.1@example.com", got.Resources[0].Email)
+	})
+
+	t.Run("GetGroupMembers using memberOf with nested groups", func(t *testing.T) {
+		ldapIDP := newTestLDAPIdentityProvider(t, srv, WithLDAPUserMemberOfAttribute("memberOf"), WithLDAPNestedGroups(true))
+
+		// group 2 and group 3 are nested in group 1
+		got, err := ldapIDP.GetGroupMembers(ctx, "cn=group 1,"+testLDAPGroupsDN)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, got.Items)
+		assert.Equal(t, "user.3@example.com", got.Resources[2].Email)
+	})
+
+	t.Run("GetGroupMembers of a missing group", func(t *testing.T) {
+		ldapIDP := newTestLDAPIdentityProvider(t, srv)
+
+		got, err := ldapIDP.GetGroupMembers(ctx, "cn=missing,"+testLDAPGroupsDN)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, got.Items)
+	})
+
+	t.Run("GetGroupMembers with empty group id", func(t *testing.T) {
+		ldapIDP := newTestLDAPIdentityProvider(t, srv)
+
+		got, err := ldapIDP.GetGroupMembers(ctx, "")
+		assert.ErrorIs(t, err, ErrGroupIDNil)
+		assert.Nil(t, got)
+	})
+
+	t.Run("GetGroupsMembers and GetUsersByGroupsMembers", func(t *testing.T) {
+		ldapIDP := newTestLDAPIdentityProvider(t, srv, WithLDAPNestedGroups(true))
+
+		groups, err := ldapIDP.GetGroups(ctx, nil)
+		assert.NoError(t, err)
+
+		gmr, err := ldapIDP.GetGroupsMembers(ctx, groups)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, gmr.Items)
+		assert.Equal(t, 2, gmr.Resources[0].Items)
+		assert.Equal(t, 2, gmr.Resources[1].Items)
+		assert.Equal(t, 1, gmr.Resources[2].Items)
+
+		// user 3 doesn't have the required attributes
+		users, err := ldapIDP.GetUsersByGroupsMembers(ctx, gmr)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, users.Items)
+	})
+
+	t.Run("nil results", func(t *testing.T) {
+		ldapIDP := newTestLDAPIdentityProvider(t, srv)
+
+		gmr, err := ldapIDP.GetGroupsMembers(ctx, nil)
+		assert.ErrorIs(t, err, ErrGroupResultNil)
+		assert.Nil(t, gmr)
+
+		ur, err := ldapIDP.GetUsersByGroupsMembers(ctx, nil)
+		assert.ErrorIs(t, err, ErrGroupResultNil)
+		assert.Nil(t, ur)
+	})
+}
+
+func TestLDAPIdentityProvider_GetGroupsMembers_Error(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx := context.TODO()
+	groupDN := "cn=group 1," + testLDAPGroupsDN
+
+	mockLDAP := mocks.NewMockLDAPProviderService(mockCtrl)
+	mockLDAP.EXPECT().GetEntry(ctx, groupDN, DefaultLDAPGroupObjectFilter, []string{DefaultLDAPGroupMemberAttribute}).Return(nil, errors.New("test error")).Times(1)
+
+	ldapIDP, err := NewLDAPIdentityProvider(mockLDAP, WithLDAPUsersBaseDN(testLDAPUsersDN), WithLDAPGroupsBaseDN(testLDAPGroupsDN))
+	assert.NoError(t, err)
+
+	groups := model.GroupsResultBuilder().WithResources([]*model.Group{
+		model.GroupBuilder().WithIPID(groupDN).WithName("group 1").Build(),
+	}).Build()
+
+	got, err := ldapIDP.GetGroupsMembers(ctx, groups)
+	assert.Error(t, err)
+	assert.Nil(t, got)
+}
+
+func TestLDAPUserActive(t *testing.T) {
+	for uac, want := range map[string]bool{
+		"":       true,
+		"512":    true,
+		"514":    false,
+		"66048":  true,
+		"66050":  false,
+		"normal": true,
+	} {
+		assert.Equal(t, want, ldapUserActive(&ldap.Entry{Attributes: map[string][]string{"userAccountControl": {uac}}}), uac)
+	}
+}
@@ -0,0 +1,81 @@
+package idp
+
+import (
+	"context"
+	"iter"
+	"time"
+
+	"github.com/slashdevops/idp-scim-sync/pkg/google"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// GoogleAPICallObserver observes the calls to the Google Workspace Directory API, like the metrics do.
+type GoogleAPICallObserver interface {
+	ObserveGoogleAPICall(method string, duration time.Duration, err error)
+}
+
+// observedGoogleProviderService wraps a GoogleProviderService and observes every call to its methods.
+type observedGoogleProviderService struct {
+	ps       GoogleProviderService
+	observer GoogleAPICallObserver
+}
+
+// newObservedGoogleProviderService returns a new observedGoogleProviderService wrapping the given GoogleProviderService
+func newObservedGoogleProviderService(ps GoogleProviderService, observer GoogleAPICallObserver) *observedGoogleProviderService {
+	return &observedGoogleProviderService{
+		ps:       ps,
+		observer: observer,
+	}
+}
+
+// observe calls fn and observes its duration and error as a call to the given method.
+func observe[T any](o GoogleAPICallObserver, method string, fn func() (T, error)) (T, error) {
+	start := time.Now()
+	r, err := fn()
+	o.ObserveGoogleAPICall(method, time.Since(start), err)
+	return r, err
+}
+
+// ListUsers observes the call to the wrapped GoogleProviderService.
+func (s *observedGoogleProviderService) ListUsers(ctx context.Context, query []string) ([]*admin.User, error) {
+	return observe(s.observer, "ListUsers", func() ([]*admin.User, error) {
+		return s.ps.ListUsers(ctx, query)
+	})
+}
+
+// ListGroups observes the call to the wrapped GoogleProviderService.
+func (s *observedGoogleProviderService) ListGroups(ctx context.Context, query []string) ([]*admin.Group, error) {
+	return observe(s.observer, "ListGroups", func() ([]*admin.Group, error) {
+		return s.ps.ListGroups(ctx, query)
+	})
+}
+
+// ListGroupMembers observes the call to the wrapped GoogleProviderService.
+func (s *observedGoogleProviderService) ListGroupMembers(ctx context.Context, groupID string, queries ...google.GetGroupMembersOption) ([]*admin.Member, error) {
+	return observe(s.observer, "ListGroupMembers", func() ([]*admin.Member, error) {
+		return s.ps.ListGroupMembers(ctx, groupID, queries...)
+	})
+}
+
+// GetUser observes the call to the wrapped GoogleProviderService.
+func (s *observedGoogleProviderService) GetUser(ctx context.Context, userID string) (*admin.User, error) {
+	return observe(s.observer, "GetUser", func() (*admin.User, error) {
+		return s.ps.GetUser(ctx, userID)
+	})
+}
+
+// ListUsersPages observes every page returned by the wrapped GoogleProviderService as a call,
+// the time spent by the caller between the pages is not observed.
+func (s *observedGoogleProviderService) ListUsersPages(ctx context.Context) iter.Seq2[[]*admin.User, error] {
+	return func(yield func([]*admin.User, error) bool) {
+		start := time.Now()
+		for page, err := range s.ps.ListUsersPages(ctx) {
+			s.observer.ObserveGoogleAPICall("ListUsersPages", time.Since(start), err)
+
+			if !yield(page, err) {
+				return
+			}
+			start = time.Now()
+		}
+	}
+}
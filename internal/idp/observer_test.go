@@ -0,0 +1,82 @@
+package idp
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"testing"
+	"time"
+
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/idp"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+type observedCall struct {
+	method string
+	err    error
+}
+
+type fakeGoogleAPICallObserver struct {
+	calls []observedCall
+}
+
+func (o *fakeGoogleAPICallObserver) ObserveGoogleAPICall(method string, _ time.Duration, err error) {
+	o.calls = append(o.calls, observedCall{method: method, err: err})
+}
+
+func TestObservedGoogleProviderService(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("observes the calls and their errors", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		apiErr := errors.New("api error")
+		mockDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		mockDS.EXPECT().ListGroups(ctx, []string{""}).Return([]*admin.Group{{Id: "1"}}, nil).Times(1)
+		mockDS.EXPECT().GetUser(ctx, "user-1").Return(nil, apiErr).Times(1)
+
+		observer := &fakeGoogleAPICallObserver{}
+		svc, err := NewIdentityProvider(mockDS, WithGoogleAPICallObserver(observer))
+		assert.NoError(t, err)
+
+		groups, err := svc.ps.ListGroups(ctx, []string{""})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(groups))
+
+		_, err = svc.ps.GetUser(ctx, "user-1")
+		assert.ErrorIs(t, err, apiErr)
+
+		assert.Equal(t, []observedCall{{method: "ListGroups"}, {method: "GetUser", err: apiErr}}, observer.calls)
+	})
+
+	t.Run("observes every page of the users", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		pageErr := errors.New("page error")
+		mockDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		mockDS.EXPECT().ListUsersPages(ctx).Return(iter.Seq2[[]*admin.User, error](func(yield func([]*admin.User, error) bool) {
+			if !yield([]*admin.User{{Id: "1"}}, nil) {
+				return
+			}
+			yield(nil, pageErr)
+		})).Times(1)
+
+		observer := &fakeGoogleAPICallObserver{}
+		ps := newObservedGoogleProviderService(mockDS, observer)
+
+		pages := 0
+		for _, err := range ps.ListUsersPages(ctx) {
+			if err != nil {
+				break
+			}
+			pages++
+		}
+
+		assert.Equal(t, 1, pages)
+		assert.Equal(t, []observedCall{{method: "ListUsersPages"}, {method: "ListUsersPages", err: pageErr}}, observer.calls)
+	})
+}
@@ -0,0 +1,377 @@
+package idp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"github.com/slashdevops/idp-scim-sync/pkg/okta"
+)
+
+// This implement core.IdentityProviderService interface for Okta
+
+// ErrOktaServiceNil is returned when the OktaProviderService is nil.
+var ErrOktaServiceNil = errors.New("provider: okta service is nil")
+
+//go:generate go run go.uber.org/mock/mockgen@v0.5.0 -package=mocks -destination=../../mocks/idp/okta_mocks.go -source=okta.go OktaProviderService
+
+// OktaProviderService is the interface that wraps the Okta Management API Service methods.
+type OktaProviderService interface {
+	ListUsers(ctx context.Context, search []string) ([]*okta.User, error)
+	ListGroups(ctx context.Context, search []string) ([]*okta.Group, error)
+	ListGroupMembers(ctx context.Context, groupID string) ([]*okta.User, error)
+	ListGroupRules(ctx context.Context) ([]*okta.GroupRule, error)
+	GetUser(ctx context.Context, userID string) (*okta.User, error)
+}
+
+// OktaIdentityProvider is the Identity Provider service that implements the core.IdentityProvider interface and consumes the pkg.okta methods.
+type OktaIdentityProvider struct {
+	ps OktaProviderService
+}
+
+// NewOktaIdentityProvider returns a new instance of the Okta Identity Provider service.
+func NewOktaIdentityProvider(ops OktaProviderService) (*OktaIdentityProvider, error) {
+	if ops == nil {
+		return nil, ErrOktaServiceNil
+	}
+
+	return &OktaIdentityProvider{
+		ps: ops,
+	}, nil
+}
+
+// GetGroups returns a list of groups from Okta.
+//
+// The filter parameter is a list of Okta search expressions, example: 'profile.name sw "AWS"'.
+//
+// This method checks the names of the groups and avoid the second, third, etc repetition of the same group name.
+func (i *OktaIdentityProvider) GetGroups(ctx context.Context, filter []string) (*model.GroupsResult, error) {
+	pGroups, err := i.ps.ListGroups(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("idp: error getting groups: %w", err)
+	}
+
+	uniqueGroups := make(map[string]struct{}, len(pGroups))
+	syncGroups := make([]*model.Group, 0, len(pGroups))
+	for _, grp := range pGroups {
+		if _, ok := uniqueGroups[grp.Profile.Name]; ok {
+			slog.Warn("idp: group already exists with the same name, this group will be avoided, please make your groups uniques by name!",
+				"id", grp.ID,
+				"name", grp.Profile.Name,
+			)
+			continue
+		}
+		uniqueGroups[grp.Profile.Name] = struct{}{}
+
+		gg := model.GroupBuilder().
+			WithIPID(grp.ID).
+			WithName(strings.TrimSpace(grp.Profile.Name)).
+			Build()
+
+		syncGroups = append(syncGroups, gg)
+	}
+
+	syncResult := model.GroupsResultBuilder().WithResources(syncGroups).Build()
+	slog.Debug("idp: okta GetGroups()", "groups", len(syncGroups))
+
+	return syncResult, nil
+}
+
+// GetUsers returns a list of users from Okta.
+//
+// The filter parameter is a list of Okta search expressions, example: 'profile.department eq "Engineering"'.
+func (i *OktaIdentityProvider) GetUsers(ctx context.Context, filter []string) (*model.UsersResult, error) {
+	pUsers, err := i.ps.ListUsers(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("idp: error getting users: %w", err)
+	}
+
+	syncUsers := make([]*model.User, 0, len(pUsers))
+	for _, usr := range pUsers {
+		if u := buildOktaUser(usr); u != nil {
+			syncUsers = append(syncUsers, u)
+		}
+	}
+
+	uResult := model.UsersResultBuilder().WithResources(syncUsers).Build()
+	slog.Debug("idp: okta GetUsers()", "users", len(syncUsers))
+
+	return uResult, nil
+}
+
+// GetGroupMembers returns the members of the group, including the members assigned by the group rules.
+func (i *OktaIdentityProvider) GetGroupMembers(ctx context.Context, groupID string) (*model.MembersResult, error) {
+	if groupID == "" {
+		return nil, ErrGroupIDNil
+	}
+
+	pMembers, err := i.ps.ListGroupMembers(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("idp: error getting group members: %w", err)
+	}
+
+	syncMembers := make([]*model.Member, 0, len(pMembers))
+	for _, member := range pMembers {
+		status := "ACTIVE"
+		if !oktaUserActive(member.Status) {
+			status = "SUSPENDED"
+		}
+
+		gm := model.MemberBuilder().
+			WithIPID(member.ID).
+			WithEmail(oktaUserEmail(member)).
+			WithStatus(status).
+			Build()
+
+		syncMembers = append(syncMembers, gm)
+	}
+
+	syncMembersResult := model.MembersResultBuilder().WithResources(syncMembers).Build()
+	slog.Debug("idp: okta GetGroupMembers()", "members", len(syncMembers))
+
+	return syncMembersResult, nil
+}
+
+// GetUsersByGroupsMembers returns the users that are members of the groups.
+func (i *OktaIdentityProvider) GetUsersByGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.UsersResult, error) {
+	if gmr == nil {
+		return nil, ErrGroupResultNil
+	}
+
+	uniqUsers := make(map[string]struct{}, len(gmr.Resources))
+	pUsers := make([]*model.User, 0, len(gmr.Resources))
+	for _, groupMembers := range gmr.Resources {
+		for _, member := range groupMembers.Resources {
+			if _, ok := uniqUsers[member.IPID]; ok {
+				continue
+			}
+			uniqUsers[member.IPID] = struct{}{}
+
+			u, err := i.ps.GetUser(ctx, member.IPID)
+			if err != nil {
+				return nil, fmt.Errorf("idp: error getting user: %+v, email: %s, error: %w", member.IPID, member.Email, err)
+			}
+
+			if gu := buildOktaUser(u); gu != nil {
+				pUsers = append(pUsers, gu)
+			}
+		}
+	}
+
+	pUsersResult := model.UsersResultBuilder().WithResources(pUsers).Build()
+	slog.Debug("idp: okta GetUsersByGroupsMembers()", "users", len(pUsers))
+
+	return pUsersResult, nil
+}
+
+// GetGroupsMembers return the members of the groups.
+//
+// The members assigned by the group rules are part of the group members, so the group
+// rules are only checked to warn about the rules that are not assigning members to the synced groups.
+func (i *OktaIdentityProvider) GetGroupsMembers(ctx context.Context, gr *model.GroupsResult) (*model.GroupsMembersResult, error) {
+	if gr == nil {
+		return nil, ErrGroupResultNil
+	}
+
+	i.checkGroupRules(ctx, gr)
+
+	groupMembers := make([]*model.GroupMembers, 0, len(gr.Resources))
+	for _, group := range gr.Resources {
+		members, err := i.GetGroupMembers(ctx, group.IPID)
+		if err != nil {
+			return nil, fmt.Errorf("idp: error getting group members: %w", err)
+		}
+
+		ggm := model.GroupBuilder().
+			WithIPID(group.IPID).
+			WithName(group.Name).
+			WithEmail(group.Email).
+			Build()
+
+		groupMember := model.GroupMembersBuilder().
+			WithGroup(ggm).
+			WithResources(members.Resources).
+			Build()
+
+		groupMembers = append(groupMembers, groupMember)
+	}
+
+	groupsMembersResult := model.GroupsMembersResultBuilder().WithResources(groupMembers).Build()
+	slog.Debug("idp: okta GetGroupsMembers()", "groups", len(groupMembers))
+
+	return groupsMembersResult, nil
+}
+
+// checkGroupRules warns about the group rules targeting the given groups that are not active,
+// the members of these rules are not assigned to the groups, so they are not synced.
+func (i *OktaIdentityProvider) checkGroupRules(ctx context.Context, gr *model.GroupsResult) {
+	rules, err := i.ps.ListGroupRules(ctx)
+	if err != nil {
+		slog.Warn("idp: cannot list okta group rules, skipping the group rules check", "error", err)
+		return
+	}
+
+	groups := make(map[string]string, len(gr.Resources))
+	for _, group := range gr.Resources {
+		groups[group.IPID] = group.Name
+	}
+
+	for _, rule := range rules {
+		for _, groupID := range rule.Actions.AssignUserToGroups.GroupIDs {
+			name, ok := groups[groupID]
+			if !ok {
+				continue
+			}
+
+			if rule.Status != "ACTIVE" {
+				slog.Warn("idp: okta group rule is not active, its members are not assigned to the group",
+					"rule", rule.Name,
+					"status", rule.Status,
+					"group", name,
+				)
+				continue
+			}
+
+			slog.Debug("idp: okta group rule assigns members to the group", "rule", rule.Name, "group", name)
+		}
+	}
+}
+
+// oktaUserActive returns true when the user status allows the user to sign in.
+// references:
+// - https://developer.okta.com/docs/api/openapi/okta-management/management/tag/User/#tag/User/operation/getUser!c=200&path=status
+func oktaUserActive(status string) bool {
+	switch status {
+	case "STAGED", "SUSPENDED", "DEPROVISIONED":
+		return false
+	default:
+		return true
+	}
+}
+
+// oktaUserEmail returns the email of the user, or the login when the user doesn't have an email.
+func oktaUserEmail(usr *okta.User) string {
+	if usr.Profile.Email != "" {
+		return strings.TrimSpace(usr.Profile.Email)
+	}
+	return strings.TrimSpace(usr.Profile.Login)
+}
+
+// buildOktaUser builds a User model from a User coming from the Okta Management API
+func buildOktaUser(usr *okta.User) *model.User {
+	if usr == nil {
+		return nil
+	}
+
+	profile := usr.Profile
+
+	// these fields are required because the Constrains defined here:
+	// https://docs.aws.amazon.com/singlesignon/latest/developerguide/createuser.html
+	if profile.FirstName == "" {
+		slog.Warn("idp: User first name is empty", "id", usr.ID, "login", profile.Login)
+		return nil
+	}
+
+	if profile.LastName == "" {
+		slog.Warn("idp: User last name is empty", "id", usr.ID, "login", profile.Login)
+		return nil
+	}
+
+	if profile.Login == "" {
+		slog.Warn("idp: User login is empty", "id", usr.ID)
+		return nil
+	}
+
+	emails := []model.Email{
+		model.EmailBuilder().
+			WithPrimary(true).
+			WithType("work").
+			WithValue(oktaUserEmail(usr)).
+			Build(),
+	}
+
+	var phoneNumbers []model.PhoneNumber
+	if profile.PrimaryPhone != "" {
+		phoneNumbers = append(phoneNumbers,
+			model.PhoneNumberBuilder().
+				WithValue(strings.TrimSpace(profile.PrimaryPhone)).
+				WithType("work").
+				Build())
+	} else if profile.MobilePhone != "" {
+		phoneNumbers = append(phoneNumbers,
+			model.PhoneNumberBuilder().
+				WithValue(strings.TrimSpace(profile.MobilePhone)).
+				WithType("mobile").
+				Build())
+	}
+
+	var addresses []model.Address
+	if profile.StreetAddress != "" || profile.City != "" || profile.State != "" || profile.ZipCode != "" || profile.CountryCode != "" {
+		formatted := make([]string, 0, 5)
+		for _, v := range []string{profile.StreetAddress, profile.City, profile.State, profile.ZipCode, profile.CountryCode} {
+			if v = strings.TrimSpace(v); v != "" {
+				formatted = append(formatted, v)
+			}
+		}
+
+		addresses = append(addresses,
+			model.AddressBuilder().
+				WithFormatted(strings.Join(formatted, ", ")).
+				WithStreetAddress(strings.TrimSpace(profile.StreetAddress)).
+				WithLocality(strings.TrimSpace(profile.City)).
+				WithRegion(strings.TrimSpace(profile.State)).
+				WithPostalCode(strings.TrimSpace(profile.ZipCode)).
+				WithCountry(strings.TrimSpace(profile.CountryCode)).
+				Build())
+	}
+
+	var enterpriseData *model.EnterpriseData
+	if profile.EmployeeNumber != "" || profile.CostCenter != "" || profile.Organization != "" || profile.Division != "" || profile.Department != "" {
+		enterpriseData = model.EnterpriseDataBuilder().
+			WithEmployeeNumber(strings.TrimSpace(profile.EmployeeNumber)).
+			WithCostCenter(strings.TrimSpace(profile.CostCenter)).
+			WithOrganization(strings.TrimSpace(profile.Organization)).
+			WithDivision(strings.TrimSpace(profile.Division)).
+			WithDepartment(strings.TrimSpace(profile.Department)).
+			Build()
+	}
+
+	displayName := strings.TrimSpace(profile.DisplayName)
+	if displayName == "" {
+		displayName = fmt.Sprintf("%s %s", strings.TrimSpace(profile.FirstName), strings.TrimSpace(profile.LastName))
+	}
+
+	name := model.NameBuilder().
+		WithGivenName(strings.TrimSpace(profile.FirstName)).
+		WithFamilyName(strings.TrimSpace(profile.LastName)).
+		WithFormatted(displayName).
+		Build()
+
+	userModel := model.UserBuilder().
+		WithIPID(strings.TrimSpace(usr.ID)).
+		WithUserName(strings.TrimSpace(profile.Login)).
+		WithDisplayName(displayName).
+		WithNickName(profile.FirstName, profile.LastName).
+		WithProfileURL(strings.TrimSpace(profile.ProfileURL)).
+		WithTitle(strings.TrimSpace(profile.Title)).
+		WithUserType(strings.TrimSpace(profile.UserType)).
+		WithPreferredLanguage(strings.TrimSpace(profile.PreferredLanguage)).
+		WithLocale(strings.TrimSpace(profile.Locale)).
+		WithTimezone(strings.TrimSpace(profile.Timezone)).
+		WithActive(oktaUserActive(usr.Status)).
+		// Arrays
+		WithEmails(emails).
+		WithAddresses(addresses).
+		WithPhoneNumbers(phoneNumbers).
+		// Pointers
+		WithName(name).
+		WithEnterpriseData(enterpriseData).
+		Build()
+
+	slog.Debug("idp: buildOktaUser() converted user", "from", usr, "to", userModel)
+
+	return userModel
+}
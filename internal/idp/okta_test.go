@@ -0,0 +1,199 @@
+package idp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/idp"
+	"github.com/slashdevops/idp-scim-sync/pkg/okta"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+// newOktaServer returns a local fake Okta Management API server
+func newOktaServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	users := map[string]string{
+		"00u1": `{"id": "00u1", "status": "ACTIVE", "profile": {"login": "user.1@mail.com", "email": "user.1@mail.com", "firstName": "user", "lastName": "1", "displayName": "user 1", "title": "engineer", "employeeNumber": "0001", "costCenter": "cc-1", "department": "IT", "primaryPhone": "+34 000 000 001", "city": "Madrid", "countryCode": "ES", "locale": "es_ES", "timezone": "Europe/Madrid"}}`,
+		"00u2": `{"id": "00u2", "status": "SUSPENDED", "profile": {"login": "user.2", "firstName": "user", "lastName": "2"}}`,
+		"00u3": `{"id": "00u3", "status": "ACTIVE", "profile": {"login": "user.3@mail.com", "email": "user.3@mail.com", "firstName": "user"}}`,
+	}
+
+	var srvURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Logf("Calling Okta API with method: %s, path: %s, query: %s", r.Method, r.URL.Path, r.URL.RawQuery)
+
+		switch r.URL.Path {
+		case "/api/v1/groups":
+			fmt.Fprint(w, `[
+				{"id": "00g1", "type": "OKTA_GROUP", "profile": {"name": "group 1"}},
+				{"id": "00g2", "type": "OKTA_GROUP", "profile": {"name": "group 2"}},
+				{"id": "00g3", "type": "OKTA_GROUP", "profile": {"name": "group 1"}}
+			]`)
+		case "/api/v1/groups/rules":
+			fmt.Fprint(w, `[
+				{"id": "0pr1", "name": "engineering", "status": "ACTIVE", "actions": {"assignUserToGroups": {"groupIds": ["00g1"]}}},
+				{"id": "0pr2", "name": "sales", "status": "INACTIVE", "actions": {"assignUserToGroups": {"groupIds": ["00g2"]}}}
+			]`)
+		case "/api/v1/groups/00g1/users":
+			// the second member is on the next page
+			if r.URL.Query().Get("after") == "" {
+				w.Header().Set("Link", fmt.Sprintf(`<%s/api/v1/groups/00g1/users?after=00u1&limit=200>; rel="next"`, srvURL))
+				fmt.Fprintf(w, `[%s]`, users["00u1"])
+				return
+			}
+			fmt.Fprintf(w, `[%s]`, users["00u2"])
+		case "/api/v1/groups/00g2/users":
+			fmt.Fprintf(w, `[%s]`, users["00u1"])
+		case "/api/v1/users":
+			fmt.Fprintf(w, `[%s, %s, %s]`, users["00u1"], users["00u2"], users["00u3"])
+		case "/api/v1/users/00u1", "/api/v1/users/00u2", "/api/v1/users/00u3":
+			fmt.Fprint(w, users[r.URL.Path[len("/api/v1/users/"):]])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errorCode": "E0000007", "errorSummary": "Not found: Resource not found"}`)
+		}
+	}))
+	srvURL = srv.URL
+
+	return srv
+}
+
+func TestNewOktaIdentityProvider(t *testing.T) {
+	got, err := NewOktaIdentityProvider(nil)
+	assert.ErrorIs(t, err, ErrOktaServiceNil)
+	assert.Nil(t, got)
+}
+
+func TestOktaIdentityProvider(t *testing.T) {
+	ctx := context.TODO()
+
+	srv := newOktaServer(t)
+	defer srv.Close()
+
+	oktaSvc, err := okta.NewService(srv.Client(), srv.URL, "test-token")
+	assert.NoError(t, err)
+
+	oktaIDP, err := NewOktaIdentityProvider(oktaSvc)
+	assert.NoError(t, err)
+
+	t.Run("GetGroups avoids repeated group names", func(t *testing.T) {
+		got, err := oktaIDP.GetGroups(ctx, []string{`profile.name sw "group"`})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, got.Items)
+		assert.Equal(t, "00g1", got.Resources[0].IPID)
+		assert.Equal(t, "group 1", got.Resources[0].Name)
+		assert.Equal(t, "00g2", got.Resources[1].IPID)
+	})
+
+	t.Run("GetUsers skips users without the required attributes", func(t *testing.T) {
+		got, err := oktaIDP.GetUsers(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, got.Items)
+
+		user1 := got.Resources[0]
+		assert.Equal(t, "00u1", user1.IPID)
+		assert.Equal(t, "user.1@mail.com", user1.UserName)
+		assert.Equal(t, "user 1", user1.DisplayName)
+		assert.Equal(t, "engineer", user1.Title)
+		assert.Equal(t, "es_ES", user1.Locale)
+		assert.Equal(t, "Europe/Madrid", user1.Timezone)
+		assert.True(t, user1.Active)
+		assert.Equal(t, "user.1@mail.com", user1.GetPrimaryEmailAddress())
+		assert.Equal(t, "+34 000 000 001", user1.PhoneNumbers[0].Value)
+		assert.Equal(t, "Madrid, ES", user1.Addresses[0].Formatted)
+		assert.Equal(t, "0001", user1.EnterpriseData.EmployeeNumber)
+		assert.Equal(t, "cc-1", user1.EnterpriseData.CostCenter)
+		assert.Equal(t, "IT", user1.EnterpriseData.Department)
+
+		user2 := got.Resources[1]
+		assert.False(t, user2.Active)
+		assert.Equal(t, "user 2", user2.DisplayName)
+		// without email the login is the email
+		assert.Equal(t, "user.2", user2.GetPrimaryEmailAddress())
+	})
+
+	t.Run("GetGroupsMembers and GetUsersByGroupsMembers", func(t *testing.T) {
+		groups, err := oktaIDP.GetGroups(ctx, nil)
+		assert.NoError(t, err)
+
+		gmr, err := oktaIDP.GetGroupsMembers(ctx, groups)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, gmr.Items)
+		assert.Equal(t, 2, gmr.Resources[0].Items)
+		assert.Equal(t, "ACTIVE", gmr.Resources[0].Resources[0].Status)
+		assert.Equal(t, "SUSPENDED", gmr.Resources[0].Resources[1].Status)
+		assert.Equal(t, 1, gmr.Resources[1].Items)
+
+		users, err := oktaIDP.GetUsersByGroupsMembers(ctx, gmr)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, users.Items)
+	})
+
+	t.Run("GetGroupMembers with empty group id", func(t *testing.T) {
+		got, err := oktaIDP.GetGroupMembers(ctx, "")
+		assert.ErrorIs(t, err, ErrGroupIDNil)
+		assert.Nil(t, got)
+	})
+
+	t.Run("GetGroupsMembers returns the okta errors", func(t *testing.T) {
+		groups := model.GroupsResultBuilder().WithResources([]*model.Group{
+			model.GroupBuilder().WithIPID("00g-unknown").WithName("unknown").Build(),
+		}).Build()
+
+		got, err := oktaIDP.GetGroupsMembers(ctx, groups)
+		assert.Error(t, err)
+		assert.Nil(t, got)
+
+		var httpErr *okta.HTTPResponseError
+		assert.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+	})
+}
+
+func TestOktaIdentityProvider_GetGroupsMembers_GroupRulesError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx := context.TODO()
+
+	mockOkta := mocks.NewMockOktaProviderService(mockCtrl)
+	mockOkta.EXPECT().ListGroupRules(ctx).Return(nil, errors.New("test error")).Times(1)
+	mockOkta.EXPECT().ListGroupMembers(ctx, "00g1").Return([]*okta.User{
+		{ID: "00u1", Status: "ACTIVE", Profile: okta.UserProfile{Login: "user.1@mail.com", Email: "user.1@mail.com"}},
+	}, nil).Times(1)
+
+	oktaIDP, err := NewOktaIdentityProvider(mockOkta)
+	assert.NoError(t, err)
+
+	groups := model.GroupsResultBuilder().WithResources([]*model.Group{
+		model.GroupBuilder().WithIPID("00g1").WithName("group 1").Build(),
+	}).Build()
+
+	// the group rules are only informative, an error listing them doesn't stop the sync
+	got, err := oktaIDP.GetGroupsMembers(ctx, groups)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, got.Items)
+	assert.Equal(t, "user.1@mail.com", got.Resources[0].Resources[0].Email)
+}
+
+func TestOktaUserActive(t *testing.T) {
+	for status, want := range map[string]bool{
+		"ACTIVE":           true,
+		"PROVISIONED":      true,
+		"RECOVERY":         true,
+		"PASSWORD_EXPIRED": true,
+		"LOCKED_OUT":       true,
+		"STAGED":           false,
+		"SUSPENDED":        false,
+		"DEPROVISIONED":    false,
+	} {
+		assert.Equal(t, want, oktaUserActive(status), status)
+	}
+}
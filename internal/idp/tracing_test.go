@@ -0,0 +1,106 @@
+package idp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/idp"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/mock/gomock"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
+)
+
+func TestGoogleIdentityProviderTracing(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	t.Run("traces the groups with the filter, the count and the retries", func(t *testing.T) {
+		exporter.Reset()
+		ctx, parent := tp.Tracer("test").Start(context.TODO(), "parent")
+
+		rateLimitErr := &googleapi.Error{Code: 429}
+		mockDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		gomock.InOrder(
+			mockDS.EXPECT().ListGroups(gomock.Any(), []string{"name:AWS*"}).Return(nil, rateLimitErr),
+			mockDS.EXPECT().ListGroups(gomock.Any(), []string{"name:AWS*"}).Return([]*admin.Group{
+				{Id: "1", Name: "AWS-Admins", Email: "aws-admins@mail.com"},
+				{Id: "2", Name: "AWS-Devs", Email: "aws-devs@mail.com"},
+			}, nil),
+		)
+
+		svc, err := NewIdentityProvider(mockDS)
+		assert.NoError(t, err)
+		svc.sleep = func(context.Context, time.Duration) error { return nil }
+
+		_, err = svc.GetGroups(ctx, []string{"name:AWS*"})
+		assert.NoError(t, err)
+		parent.End()
+
+		spans := exporter.GetSpans()
+		assert.Equal(t, 2, len(spans))
+		assert.Equal(t, "idp.GetGroups", spans[0].Name)
+		assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent.SpanID())
+		assert.Contains(t, spans[0].Attributes, attribute.StringSlice("idp.groups_filter", []string{"name:AWS*"}))
+		assert.Contains(t, spans[0].Attributes, attribute.Int("groups", 2))
+		assert.Equal(t, 1, len(spans[0].Events))
+		assert.Equal(t, "retry", spans[0].Events[0].Name)
+	})
+
+	t.Run("traces the members of every group as children of the groups members", func(t *testing.T) {
+		exporter.Reset()
+		ctx, parent := tp.Tracer("test").Start(context.TODO(), "parent")
+
+		mockDS := mocks.NewMockGoogleProviderService(mockCtrl)
+		mockDS.EXPECT().ListGroupMembers(gomock.Any(), "1", gomock.Any()).Return([]*admin.Member{{Id: "1", Email: "user.1@mail.com"}}, nil)
+		mockDS.EXPECT().ListGroupMembers(gomock.Any(), "2", gomock.Any()).Return(nil, &googleapi.Error{Code: 404})
+
+		svc, err := NewIdentityProvider(mockDS, WithGoogleConcurrency(1))
+		assert.NoError(t, err)
+
+		gr := model.GroupsResultBuilder().WithResources([]*model.Group{
+			{IPID: "1", Name: "group 1"},
+			{IPID: "2", Name: "group 2"},
+		}).Build()
+
+		_, err = svc.GetGroupsMembers(ctx, gr)
+		assert.Error(t, err)
+		parent.End()
+
+		spans := exporter.GetSpans()
+		assert.Equal(t, 4, len(spans))
+
+		byGroup := make(map[string]tracetest.SpanStub)
+		var groupsMembers tracetest.SpanStub
+		for _, span := range spans {
+			switch span.Name {
+			case "idp.GetGroupMembers":
+				for _, attr := range span.Attributes {
+					if attr.Key == "group.id" {
+						byGroup[attr.Value.AsString()] = span
+					}
+				}
+			case "idp.GetGroupsMembers":
+				groupsMembers = span
+			}
+		}
+
+		assert.Equal(t, parent.SpanContext().SpanID(), groupsMembers.Parent.SpanID())
+		assert.Contains(t, groupsMembers.Attributes, attribute.Int("groups", 2))
+		assert.Equal(t, codes.Error, groupsMembers.Status.Code)
+
+		assert.Equal(t, groupsMembers.SpanContext.SpanID(), byGroup["1"].Parent.SpanID())
+		assert.Contains(t, byGroup["1"].Attributes, attribute.Int("members", 1))
+		assert.Equal(t, codes.Unset, byGroup["1"].Status.Code)
+		assert.Equal(t, codes.Error, byGroup["2"].Status.Code)
+	})
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+var (
+	// ErrPushGatewayURLEmpty is returned when the push gateway url is empty
+	ErrPushGatewayURLEmpty = errors.New("metrics: push gateway url cannot be empty")
+
+	// ErrPushGatewayJobEmpty is returned when the push gateway job is empty
+	ErrPushGatewayJobEmpty = errors.New("metrics: push gateway job cannot be empty")
+
+	// ErrTextFileEmpty is returned when the text file path is empty
+	ErrTextFileEmpty = errors.New("metrics: text file cannot be empty")
+)
+
+// HTTPClient is an interface for sending HTTP requests.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Handler returns an http.Handler that serves the metrics of the gatherer, to be used as the /metrics endpoint.
+func Handler(g prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+}
+
+// Push replaces the metrics of the given job in the Prometheus push gateway with the metrics of the gatherer.
+// reference: https://github.com/prometheus/pushgateway#put-method
+func Push(ctx context.Context, client HTTPClient, gatewayURL, job string, g prometheus.Gatherer) error {
+	if gatewayURL == "" {
+		return ErrPushGatewayURLEmpty
+	}
+	if job == "" {
+		return ErrPushGatewayJobEmpty
+	}
+
+	if err := push.New(gatewayURL, job).Client(client).Gatherer(g).PushContext(ctx); err != nil {
+		return fmt.Errorf("metrics: error pushing the metrics: %w", err)
+	}
+
+	return nil
+}
+
+// WriteTextFile writes the metrics of the gatherer into the given file, to be read by the
+// textfile collector of the Prometheus node exporter. The metrics are written into a temporary
+// file that is renamed, so the collector never reads a partial file.
+func WriteTextFile(path string, g prometheus.Gatherer) error {
+	if path == "" {
+		return ErrTextFileEmpty
+	}
+
+	if err := prometheus.WriteToTextfile(path, g); err != nil {
+		return fmt.Errorf("metrics: error writing the text file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRegistry() *prometheus.Registry {
+	r := prometheus.NewRegistry()
+
+	syncs := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "syncs_total", Help: "Syncs."}, []string{"status"})
+	syncs.WithLabelValues("success").Inc()
+	r.MustRegister(syncs)
+
+	return r
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler(newTestRegistry()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, rec.Body.String(), `syncs_total{status="success"} 1`)
+}
+
+func TestPush(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("puts the metrics of the job", func(t *testing.T) {
+		r := newTestRegistry()
+
+		var method, path string
+		var body []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ = io.ReadAll(req.Body)
+			method, path = req.Method, req.URL.Path
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		err := Push(ctx, server.Client(), server.URL+"/", "idpscim", r)
+		assert.NoError(t, err)
+		assert.Equal(t, http.MethodPut, method)
+		assert.Equal(t, "/metrics/job/idpscim", path)
+		assert.Contains(t, string(body), "syncs_total")
+	})
+
+	t.Run("returns an error when the push gateway doesn't accept the metrics", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "invalid metrics", http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		err := Push(ctx, server.Client(), server.URL, "idpscim", newTestRegistry())
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "400")
+		assert.Contains(t, err.Error(), "invalid metrics")
+	})
+
+	t.Run("returns an error when the url or the job are empty", func(t *testing.T) {
+		assert.ErrorIs(t, Push(ctx, http.DefaultClient, "", "idpscim", newTestRegistry()), ErrPushGatewayURLEmpty)
+		assert.ErrorIs(t, Push(ctx, http.DefaultClient, "http://localhost:9091", "", newTestRegistry()), ErrPushGatewayJobEmpty)
+	})
+}
+
+func TestWriteTextFile(t *testing.T) {
+	t.Run("writes the metrics into the file", func(t *testing.T) {
+		r := newTestRegistry()
+		dir := t.TempDir()
+		path := filepath.Join(dir, "idpscim.prom")
+
+		assert.NoError(t, WriteTextFile(path, r))
+
+		content, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, gatherText(t, r), string(content))
+
+		// the temporary file is renamed
+		entries, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(entries))
+	})
+
+	t.Run("returns an error when the path is empty", func(t *testing.T) {
+		assert.ErrorIs(t, WriteTextFile("", newTestRegistry()), ErrTextFileEmpty)
+	})
+
+	t.Run("returns an error when the directory doesn't exist", func(t *testing.T) {
+		assert.Error(t, WriteTextFile(filepath.Join(t.TempDir(), "missing", "idpscim.prom"), newTestRegistry()))
+	})
+}
@@ -0,0 +1,189 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slashdevops/idp-scim-sync/internal/core"
+)
+
+const (
+	// StatusSuccess and StatusFailure are the values of the status label of the syncs and the Google API calls.
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+
+	// statusError is the value of the status label of the HTTP requests without response.
+	statusError = "error"
+)
+
+// DefaultBuckets are the default upper bounds, in seconds, of the buckets of the duration histograms.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900}
+
+// Metrics are the metrics of the syncs, the SCIM HTTP requests and the Google API calls.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	scimRequests        *prometheus.CounterVec
+	scimRequestDuration *prometheus.HistogramVec
+
+	googleCalls        *prometheus.CounterVec
+	googleCallDuration *prometheus.HistogramVec
+
+	// the metrics without labels are vectors too, so they are not exported until they are observed
+	syncs           *prometheus.CounterVec
+	syncDuration    *prometheus.HistogramVec
+	syncLastSuccess *prometheus.GaugeVec
+	syncTargets     *prometheus.CounterVec
+	syncResources   *prometheus.CounterVec
+}
+
+// New returns the metrics registered in a new registry.
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+
+		scimRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "idpscim_scim_requests_total",
+			Help: "HTTP requests sent to the SCIM service by method and status code.",
+		}, []string{"method", "status"}),
+		scimRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "idpscim_scim_request_duration_seconds",
+			Help:    "Latency of the HTTP requests sent to the SCIM service by method.",
+			Buckets: DefaultBuckets,
+		}, []string{"method"}),
+
+		googleCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "idpscim_google_api_calls_total",
+			Help: "Calls to the Google Workspace Directory API by method and status.",
+		}, []string{"method", "status"}),
+		googleCallDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "idpscim_google_api_call_duration_seconds",
+			Help:    "Latency of the calls to the Google Workspace Directory API by method.",
+			Buckets: DefaultBuckets,
+		}, []string{"method"}),
+
+		syncs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "idpscim_syncs_total",
+			Help: "Syncs by status.",
+		}, []string{"status"}),
+		syncDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "idpscim_sync_duration_seconds",
+			Help:    "Duration of the syncs.",
+			Buckets: DefaultBuckets,
+		}, nil),
+		syncLastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "idpscim_sync_last_success_timestamp_seconds",
+			Help: "Unix timestamp of the last successful sync.",
+		}, nil),
+		syncTargets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "idpscim_sync_targets_total",
+			Help: "Syncs of every target by status.",
+		}, []string{"target", "status"}),
+		syncResources: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "idpscim_sync_resources_total",
+			Help: "Resources reconciled in the SCIM side of every target by resource type and outcome.",
+		}, []string{"target", "resource", "outcome"}),
+	}
+
+	m.Registry.MustRegister(
+		m.scimRequests, m.scimRequestDuration,
+		m.googleCalls, m.googleCallDuration,
+		m.syncs, m.syncDuration, m.syncLastSuccess, m.syncTargets, m.syncResources,
+	)
+
+	return m
+}
+
+// instrumentedHTTPClient wraps an HTTPClient and observes the requests sent with it.
+type instrumentedHTTPClient struct {
+	client HTTPClient
+	m      *Metrics
+}
+
+// InstrumentSCIMHTTPClient returns an HTTPClient that observes the requests sent to the SCIM service
+// with the given client, it can be used as the HTTPClient of the aws and scim packages.
+func (m *Metrics) InstrumentSCIMHTTPClient(client HTTPClient) HTTPClient {
+	return &instrumentedHTTPClient{client: client, m: m}
+}
+
+// Do sends the request with the wrapped client and observes its status code and latency.
+func (c *instrumentedHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := c.client.Do(req)
+
+	c.m.scimRequestDuration.WithLabelValues(req.Method).Observe(time.Since(start).Seconds())
+
+	status := statusError
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	c.m.scimRequests.WithLabelValues(req.Method, status).Inc()
+
+	return resp, err
+}
+
+// ObserveGoogleAPICall observes a call to the given method of the Google Workspace Directory API.
+func (m *Metrics) ObserveGoogleAPICall(method string, duration time.Duration, err error) {
+	status := StatusSuccess
+	if err != nil {
+		status = StatusFailure
+	}
+
+	m.googleCalls.WithLabelValues(method, status).Inc()
+	m.googleCallDuration.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+// ObserveSync observes the result of a sync and the error returned by it, the last success
+// timestamp is only set when the sync doesn't return an error.
+func (m *Metrics) ObserveSync(result *core.SyncResult, err error) {
+	status := StatusSuccess
+	if err != nil {
+		status = StatusFailure
+	}
+
+	m.syncs.WithLabelValues(status).Inc()
+	if err == nil {
+		m.syncLastSuccess.WithLabelValues().SetToCurrentTime()
+	}
+
+	if result == nil {
+		return
+	}
+
+	m.syncDuration.WithLabelValues().Observe(float64(result.DurationMs) / 1000)
+
+	for _, target := range result.Targets {
+		targetStatus := StatusSuccess
+		if target.Err != nil {
+			targetStatus = StatusFailure
+		}
+		m.syncTargets.WithLabelValues(target.Target, targetStatus).Inc()
+
+		if target.Changes != nil {
+			m.observeResourceChanges(target.Target, core.ResourceGroups, target.Changes.Groups)
+			m.observeResourceChanges(target.Target, core.ResourceUsers, target.Changes.Users)
+			m.observeResourceChanges(target.Target, core.ResourceGroupsMembers, target.Changes.GroupsMembers)
+		}
+
+		if target.Report.HasFailures() {
+			for _, failure := range target.Report.Failures {
+				m.syncResources.WithLabelValues(target.Target, failure.Resource, "failed").Inc()
+			}
+		}
+	}
+}
+
+// observeResourceChanges observes the outcomes of the reconciliation of one type of resource.
+func (m *Metrics) observeResourceChanges(target, resource string, c *core.ResourceChanges) {
+	if c == nil {
+		return
+	}
+
+	m.syncResources.WithLabelValues(target, resource, "created").Add(float64(c.Created))
+	m.syncResources.WithLabelValues(target, resource, "updated").Add(float64(c.Updated))
+	m.syncResources.WithLabelValues(target, resource, "equal").Add(float64(c.Equal))
+	m.syncResources.WithLabelValues(target, resource, "deleted").Add(float64(c.Deleted))
+	m.syncResources.WithLabelValues(target, resource, "deactivated").Add(float64(c.Deactivated))
+}
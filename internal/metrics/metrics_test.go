@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/slashdevops/idp-scim-sync/internal/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// gatherText returns the metrics of the gatherer in the Prometheus text exposition format
+func gatherText(t *testing.T, g prometheus.Gatherer) string {
+	t.Helper()
+
+	mfs, err := g.Gather()
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	for _, mf := range mfs {
+		_, err := expfmt.MetricFamilyToText(&buf, mf)
+		assert.NoError(t, err)
+	}
+
+	return buf.String()
+}
+
+type fakeHTTPClient struct {
+	resp *http.Response
+	err  error
+}
+
+func (c *fakeHTTPClient) Do(_ *http.Request) (*http.Response, error) {
+	return c.resp, c.err
+}
+
+func TestMetrics_InstrumentSCIMHTTPClient(t *testing.T) {
+	m := New()
+
+	req, err := http.NewRequest(http.MethodPost, "https://scim.example.com/Users", nil)
+	assert.NoError(t, err)
+
+	_, err = m.InstrumentSCIMHTTPClient(&fakeHTTPClient{resp: &http.Response{StatusCode: http.StatusCreated}}).Do(req)
+	assert.NoError(t, err)
+
+	_, err = m.InstrumentSCIMHTTPClient(&fakeHTTPClient{err: errors.New("connection refused")}).Do(req)
+	assert.Error(t, err)
+
+	out := gatherText(t, m.Registry)
+	assert.Contains(t, out, `idpscim_scim_requests_total{method="POST",status="201"} 1`)
+	assert.Contains(t, out, `idpscim_scim_requests_total{method="POST",status="error"} 1`)
+	assert.Contains(t, out, `idpscim_scim_request_duration_seconds_count{method="POST"} 2`)
+}
+
+func TestMetrics_ObserveGoogleAPICall(t *testing.T) {
+	m := New()
+
+	m.ObserveGoogleAPICall("ListGroups", 200*time.Millisecond, nil)
+	m.ObserveGoogleAPICall("ListGroups", time.Second, errors.New("api error"))
+
+	out := gatherText(t, m.Registry)
+	assert.Contains(t, out, `idpscim_google_api_calls_total{method="ListGroups",status="success"} 1`)
+	assert.Contains(t, out, `idpscim_google_api_calls_total{method="ListGroups",status="failure"} 1`)
+	assert.Contains(t, out, `idpscim_google_api_call_duration_seconds_bucket{method="ListGroups",le="0.25"} 1`)
+	assert.Contains(t, out, `idpscim_google_api_call_duration_seconds_sum{method="ListGroups"} 1.2`)
+}
+
+func TestMetrics_ObserveSync(t *testing.T) {
+	t.Run("observes the targets and the reconciliation outcomes", func(t *testing.T) {
+		m := New()
+
+		result := &core.SyncResult{
+			DurationMs: 1500,
+			Targets: []*core.SyncTargetResult{
+				{
+					Target: "aws",
+					Changes: &core.SyncChanges{
+						Groups:        &core.ResourceChanges{Created: 2, Equal: 3},
+						Users:         &core.ResourceChanges{Updated: 1, Deactivated: 1},
+						GroupsMembers: &core.ResourceChanges{Deleted: 4},
+					},
+					Report: &core.SyncReport{Failures: []*core.ResourceFailure{{Resource: core.ResourceUsers}}},
+				},
+				{Target: "backup", Err: errors.New("state error")},
+			},
+		}
+
+		m.ObserveSync(result, nil)
+
+		out := gatherText(t, m.Registry)
+		assert.Contains(t, out, `idpscim_syncs_total{status="success"} 1`)
+		assert.Contains(t, out, "idpscim_sync_last_success_timestamp_seconds ")
+		assert.Contains(t, out, "idpscim_sync_duration_seconds_sum 1.5")
+		assert.Contains(t, out, `idpscim_sync_targets_total{status="success",target="aws"} 1`)
+		assert.Contains(t, out, `idpscim_sync_targets_total{status="failure",target="backup"} 1`)
+		assert.Contains(t, out, `idpscim_sync_resources_total{outcome="created",resource="groups",target="aws"} 2`)
+		assert.Contains(t, out, `idpscim_sync_resources_total{outcome="equal",resource="groups",target="aws"} 3`)
+		assert.Contains(t, out, `idpscim_sync_resources_total{outcome="deactivated",resource="users",target="aws"} 1`)
+		assert.Contains(t, out, `idpscim_sync_resources_total{outcome="failed",resource="users",target="aws"} 1`)
+		assert.Contains(t, out, `idpscim_sync_resources_total{outcome="deleted",resource="groups_members",target="aws"} 4`)
+	})
+
+	t.Run("doesn't set the last success timestamp of the failed syncs", func(t *testing.T) {
+		m := New()
+
+		m.ObserveSync(nil, errors.New("sync error"))
+
+		out := gatherText(t, m.Registry)
+		assert.Contains(t, out, `idpscim_syncs_total{status="failure"} 1`)
+		assert.False(t, strings.Contains(out, "idpscim_sync_last_success_timestamp_seconds"))
+		assert.False(t, strings.Contains(out, "idpscim_sync_duration_seconds"))
+	})
+}
@@ -16,6 +16,10 @@ type Group struct {
 	Name     string `json:"name,omitempty"`
 	Email    string `json:"email,omitempty"`
 	HashCode string `json:"hashCode,omitempty"`
+
+	// Origin is the identity provider source of the group when several sources are merged,
+	// it is not part of the hash code because MarshalBinary leaves it out.
+	Origin string `json:"origin,omitempty"`
 }
 
 // MarshalBinary implements the encoding.BinaryMarshaler interface for Group entity.
@@ -36,6 +36,12 @@ func (b *GroupBuilderChoice) WithEmail(email string) *GroupBuilderChoice {
 	return b
 }
 
+// WithOrigin sets the Origin field of the Group entity.
+func (b *GroupBuilderChoice) WithOrigin(origin string) *GroupBuilderChoice {
+	b.g.Origin = origin
+	return b
+}
+
 // Build returns the Group entity.
 func (b *GroupBuilderChoice) Build() *Group {
 	g := b.g
@@ -55,6 +55,14 @@ func TestGroupBuilder(t *testing.T) {
 		assert.Equal(t, "email", gb.g.Email)
 		assert.Equal(t, g.HashCode, gb.g.HashCode)
 	})
+
+	t.Run("origin is not part of the hash code", func(t *testing.T) {
+		g := GroupBuilder().WithName("name").WithOrigin("google").Build()
+		withoutOrigin := GroupBuilder().WithName("name").Build()
+
+		assert.Equal(t, "google", g.Origin)
+		assert.Equal(t, withoutOrigin.HashCode, g.HashCode)
+	})
 }
 
 func TestGroupsResultBuilder(t *testing.T) {
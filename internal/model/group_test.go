@@ -31,6 +31,20 @@ func TestGroup_SetHashCode(t *testing.T) {
 				Email: "user.1@mail.com",
 			},
 		},
+		{
+			name: "success with origin",
+			group: &Group{
+				IPID:   "1",
+				Name:   "group 1",
+				Email:  "user.1@mail.com",
+				Origin: "google",
+			},
+			want: &Group{
+				IPID:  "1",
+				Name:  "group 1",
+				Email: "user.1@mail.com",
+			},
+		},
 	}
 
 	for _, tt := range tests {
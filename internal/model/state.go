@@ -4,18 +4,67 @@ import (
 	"bytes"
 	"encoding/gob"
 	"encoding/json"
+	"errors"
+	"io"
+	"slices"
 )
 
 const (
 	// StateSchemaVersion is the current schema version for the state file.
-	StateSchemaVersion = "1.0.0"
+	StateSchemaVersion = "1.1.0"
+
+	// CheckpointPhaseGroups is the phase of the first sync that writes the groups.
+	CheckpointPhaseGroups = "groups"
+
+	// CheckpointPhaseUsers is the phase of the first sync that writes the users, after the groups.
+	CheckpointPhaseUsers = "users"
+
+	// CheckpointPhaseGroupsMembers is the phase of the first sync that writes the groups members, after the users.
+	CheckpointPhaseGroupsMembers = "groupsMembers"
 )
 
+// checkpointPhases are the phases of the first sync in the order they are written.
+var checkpointPhases = []string{CheckpointPhaseGroups, CheckpointPhaseUsers, CheckpointPhaseGroupsMembers}
+
+// Checkpoint marks a state stored in the middle of a first sync, the next sync resumes the
+// first sync from it. Phase is the last phase written and Completed is true when all the
+// resources of the phase were written, otherwise the state has the resources of the phase
+// written so far.
+type Checkpoint struct {
+	Phase     string `json:"phase"`
+	Completed bool   `json:"completed"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// PhaseCompleted returns true when the given phase of the first sync was completed
+// before the checkpoint was stored. A nil checkpoint has no phases completed.
+func (c *Checkpoint) PhaseCompleted(phase string) bool {
+	if c == nil {
+		return false
+	}
+
+	if c.Phase == phase {
+		return c.Completed
+	}
+
+	// the phases written before the phase of the checkpoint are completed
+	return slices.Index(checkpointPhases, phase) < slices.Index(checkpointPhases, c.Phase) && slices.Contains(checkpointPhases, phase)
+}
+
+// PhaseInProgress returns true when the checkpoint was stored in the middle of the given phase
+// of the first sync. A nil checkpoint has no phases in progress.
+func (c *Checkpoint) PhaseInProgress(phase string) bool {
+	return c != nil && c.Phase == phase && !c.Completed
+}
+
 // StateResources is a list of resources in the state, groups, users and groups and their users.
+// Tombstones are the users deactivated in the SCIM side (soft-delete), they are stored with the other
+// resources but State.SetHashCode leaves them out, so they are not part of the hash code of the state.
 type StateResources struct {
 	Groups        *GroupsResult        `json:"groups"`
 	Users         *UsersResult         `json:"users"`
 	GroupsMembers *GroupsMembersResult `json:"groupsMembers"`
+	Tombstones    []*Tombstone         `json:"tombstones,omitempty"`
 }
 
 // MarshalBinary marshals the StateResources to binary.
@@ -41,6 +90,12 @@ func (s *StateResources) MarshalBinary() ([]byte, error) {
 		}
 	}
 
+	if len(s.Tombstones) > 0 {
+		if err := enc.Encode(s.Tombstones); err != nil {
+			return nil, err
+		}
+	}
+
 	return buf.Bytes(), nil
 }
 
@@ -49,19 +104,25 @@ func (s *StateResources) UnmarshalBinary(data []byte) error {
 	dec := gob.NewDecoder(bytes.NewReader(data))
 
 	if err := dec.Decode(&s.Groups); err != nil {
-		if err.Error() != "EOF" {
+		if !errors.Is(err, io.EOF) {
 			return err
 		}
 	}
 
 	if err := dec.Decode(&s.Users); err != nil {
-		if err.Error() != "EOF" {
+		if !errors.Is(err, io.EOF) {
 			return err
 		}
 	}
 
 	if err := dec.Decode(&s.GroupsMembers); err != nil {
-		if err.Error() != "EOF" {
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+	}
+
+	if err := dec.Decode(&s.Tombstones); err != nil {
+		if !errors.Is(err, io.EOF) {
 			return err
 		}
 	}
@@ -75,6 +136,7 @@ type State struct {
 	CodeVersion   string          `json:"codeVersion"`
 	LastSync      string          `json:"lastSync"`
 	HashCode      string          `json:"hashCode,omitempty"`
+	Checkpoint    *Checkpoint     `json:"checkpoint,omitempty"`
 	Resources     *StateResources `json:"resources"`
 }
 
@@ -106,7 +168,7 @@ func (s *State) UnmarshalBinary(data []byte) error {
 	}
 
 	if err := dec.Decode(&s.Resources); err != nil {
-		if err.Error() != "EOF" {
+		if !errors.Is(err, io.EOF) {
 			return err
 		}
 	}
@@ -203,12 +265,17 @@ func (s *State) SetHashCode() {
 
 	users := make([]*User, 0)
 	for _, user := range s.Resources.Users.Resources {
+		var givenName, familyName string
+		if user.Name != nil {
+			givenName, familyName = user.Name.GivenName, user.Name.FamilyName
+		}
+
 		e := UserBuilder().
 			WithIPID(user.IPID).
 			WithSCIMID(user.SCIMID).
 			WithUserName(user.UserName).
 			WithDisplayName(user.DisplayName).
-			WithNickName(user.Name.GivenName, user.Name.FamilyName).
+			WithNickName(givenName, familyName).
 			// WithProfileURL("Not Provided").
 			WithTitle(user.Title).
 			WithUserType(user.UserType).
@@ -257,7 +324,8 @@ func (s *State) SetHashCode() {
 
 	groupsMembersResult := GroupsMembersResultBuilder().WithResources(groupsMembers).Build()
 
-	// The hash code of the state only depends on Resources changes not in metadata changes.
+	// The hash code of the state only depends on Resources changes not in metadata changes,
+	// the tombstones are left out because they are SCIM side data, not identity provider data.
 	copyState := State{
 		Resources: &StateResources{
 			Groups:        groupsResult,
@@ -61,6 +61,18 @@ func (b *StateBuilderChoice) WithGroupsMembers(groupsMembers *GroupsMembersResul
 	return b
 }
 
+// WithTombstones sets the Tombstones field of the StateResources entity inside the State entity.
+func (b *StateBuilderChoice) WithTombstones(tombstones []*Tombstone) *StateBuilderChoice {
+	b.s.Resources.Tombstones = tombstones
+	return b
+}
+
+// WithCheckpoint sets the Checkpoint field of the State entity.
+func (b *StateBuilderChoice) WithCheckpoint(checkpoint *Checkpoint) *StateBuilderChoice {
+	b.s.Checkpoint = checkpoint
+	return b
+}
+
 // Build returns the State entity.
 func (b *StateBuilderChoice) Build() *State {
 	b.s.SetHashCode()
@@ -0,0 +1,242 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// stateSchemaVersionInitial is the schema version of the states stored without schema version.
+const stateSchemaVersionInitial = "1.0.0"
+
+// ErrStateSchemaVersionInvalid is returned when the schema version of the state is not like 1.0.0
+var ErrStateSchemaVersionInvalid = errors.New("invalid state schema version")
+
+// StateMigration upgrades the state documents of the From schema version to the To schema version.
+// Migrate changes the decoded JSON document of the state in place, its numbers are json.Number,
+// so a new attribute of the users can be added with a default value instead of dropping the users.
+type StateMigration struct {
+	From    string
+	To      string
+	Migrate func(doc map[string]any) error
+}
+
+// stateMigrations is the registry of the migrations of the state documents, every change of the schema
+// of the state bumps StateSchemaVersion and adds a migration from the previous version to the new one.
+var stateMigrations = []StateMigration{
+	{From: "1.0.0", To: "1.1.0", Migrate: migrateState1_0_0},
+}
+
+// migrateState1_0_0 upgrades the states of 1.0.0 to 1.1.0, it added the tombstones of the users deactivated
+// by the soft delete, the checkpoint of the states stored in the middle of a first sync and the origin of
+// the users and groups merged from several identity providers. All of them are optional: the states stored
+// before they existed don't have them, which is a completed sync without deactivated users from one identity
+// provider, and the states stored with 1.0.0 by the versions that added them already have them, so they are kept.
+func migrateState1_0_0(_ map[string]any) error {
+	return nil
+}
+
+// MigrateState upgrades the state document to the StateSchemaVersion with the registered migrations and
+// returns it with the schema version it had. The document is returned as it is when it already has the
+// StateSchemaVersion, and an *ErrStateSchemaVersionNewer error is returned when it has a newer one.
+// The hash code of the migrated document is computed again when the migrations changed its resources.
+func MigrateState(data []byte) ([]byte, string, error) {
+	return migrateState(data, StateSchemaVersion, stateMigrations)
+}
+
+func migrateState(data []byte, current string, migrations []StateMigration) ([]byte, string, error) {
+	var head struct {
+		SchemaVersion string `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, "", fmt.Errorf("error decoding the state: %w", err)
+	}
+
+	from := head.SchemaVersion
+	if from == "" {
+		from = stateSchemaVersionInitial
+	}
+
+	c, err := compareSchemaVersions(from, current)
+	if err != nil {
+		return nil, from, err
+	}
+
+	switch {
+	case c == 0:
+		return data, from, nil
+	case c > 0:
+		return nil, from, &ErrStateSchemaVersionNewer{Version: from, Supported: current}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, from, fmt.Errorf("error decoding the state: %w", err)
+	}
+
+	resources, err := json.Marshal(doc["resources"])
+	if err != nil {
+		return nil, from, fmt.Errorf("error encoding the state: %w", err)
+	}
+
+	for version := from; version != current; {
+		m, err := findStateMigration(migrations, version, current)
+		if err != nil {
+			return nil, from, err
+		}
+
+		if err := m.Migrate(doc); err != nil {
+			return nil, from, fmt.Errorf("error migrating the state from %s to %s: %w", m.From, m.To, err)
+		}
+
+		version = m.To
+		doc["schemaVersion"] = version
+	}
+
+	// the hash code was computed from the resources before the migrations, so it is computed
+	// again when the migrations changed them
+	migratedResources, err := json.Marshal(doc["resources"])
+	if err != nil {
+		return nil, from, fmt.Errorf("error encoding the migrated state: %w", err)
+	}
+
+	if !bytes.Equal(resources, migratedResources) {
+		hashCode, err := migratedStateHashCode(doc)
+		if err != nil {
+			return nil, from, err
+		}
+		doc["hashCode"] = hashCode
+	}
+
+	migrated, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, from, fmt.Errorf("error encoding the migrated state: %w", err)
+	}
+
+	return migrated, from, nil
+}
+
+// migratedStateHashCode returns the hash code of the state of the migrated document.
+func migratedStateHashCode(doc map[string]any) (string, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("error encoding the migrated state: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return "", fmt.Errorf("error decoding the migrated state: %w", err)
+	}
+	state.SetHashCode()
+
+	return state.HashCode, nil
+}
+
+// findStateMigration returns the migration from the given version, it must upgrade
+// the state to a newer version not newer than the current one.
+func findStateMigration(migrations []StateMigration, version, current string) (*StateMigration, error) {
+	for i := range migrations {
+		m := &migrations[i]
+		if m.From != version {
+			continue
+		}
+
+		toNewer, err := compareSchemaVersions(m.To, version)
+		if err != nil {
+			return nil, err
+		}
+
+		toCurrent, err := compareSchemaVersions(m.To, current)
+		if err != nil {
+			return nil, err
+		}
+
+		if toNewer <= 0 || toCurrent > 0 {
+			return nil, fmt.Errorf("%w: migration from %s to %s", ErrStateSchemaVersionInvalid, m.From, m.To)
+		}
+
+		return m, nil
+	}
+
+	return nil, &ErrStateMigrationNotFound{Version: version}
+}
+
+// compareSchemaVersions returns -1, 0 or 1 when the version a is older, the same or newer than b
+func compareSchemaVersions(a, b string) (int, error) {
+	pa, err := parseSchemaVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	pb, err := parseSchemaVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range pa {
+		switch {
+		case pa[i] < pb[i]:
+			return -1, nil
+		case pa[i] > pb[i]:
+			return 1, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// parseSchemaVersion returns the major, minor and patch numbers of the version
+func parseSchemaVersion(version string) ([3]int, error) {
+	var parsed [3]int
+
+	parts := strings.Split(version, ".")
+	if len(parts) != len(parsed) {
+		return parsed, fmt.Errorf("%w: %s", ErrStateSchemaVersionInvalid, version)
+	}
+
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return parsed, fmt.Errorf("%w: %s", ErrStateSchemaVersionInvalid, version)
+		}
+		parsed[i] = n
+	}
+
+	return parsed, nil
+}
+
+// ErrStateSchemaVersionNewer is returned when the state was stored by a newer version of the program,
+// it is not read so its changes are not lost.
+type ErrStateSchemaVersionNewer struct {
+	Version   string
+	Supported string
+}
+
+func (e *ErrStateSchemaVersionNewer) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorCode(), e.ErrorMessage())
+}
+
+func (e *ErrStateSchemaVersionNewer) ErrorMessage() string {
+	return fmt.Sprintf("the state schema version %s is newer than the supported schema version %s", e.Version, e.Supported)
+}
+func (e *ErrStateSchemaVersionNewer) ErrorCode() string { return "ErrStateSchemaVersionNewer" }
+
+// ErrStateMigrationNotFound is returned when no migration upgrades the state from its schema version.
+type ErrStateMigrationNotFound struct {
+	Version string
+}
+
+func (e *ErrStateMigrationNotFound) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorCode(), e.ErrorMessage())
+}
+
+func (e *ErrStateMigrationNotFound) ErrorMessage() string {
+	return fmt.Sprintf("no migration of the state from the schema version %s", e.Version)
+}
+func (e *ErrStateMigrationNotFound) ErrorCode() string { return "ErrStateMigrationNotFound" }
@@ -0,0 +1,208 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testStateMigrations adds the attribute title to the users in 1.1.0 and renames it to jobTitle in 2.0.0
+var testStateMigrations = []StateMigration{
+	{
+		From: "1.0.0",
+		To:   "1.1.0",
+		Migrate: func(doc map[string]any) error {
+			resources, _ := doc["resources"].(map[string]any)
+			users, _ := resources["users"].(map[string]any)
+			items, _ := users["resources"].([]any)
+			for _, item := range items {
+				item.(map[string]any)["title"] = ""
+			}
+			return nil
+		},
+	},
+	{
+		From: "1.1.0",
+		To:   "2.0.0",
+		Migrate: func(doc map[string]any) error {
+			resources, _ := doc["resources"].(map[string]any)
+			users, _ := resources["users"].(map[string]any)
+			items, _ := users["resources"].([]any)
+			for _, item := range items {
+				user := item.(map[string]any)
+				user["jobTitle"] = user["title"]
+				delete(user, "title")
+			}
+			return nil
+		},
+	},
+}
+
+const testStateDocument = `{
+  "schemaVersion": "1.0.0",
+  "lastSync": "2024-11-18T23:36:22Z",
+  "resources": {
+    "users": {
+      "items": 1,
+      "resources": [{"ipid": "1", "userName": "user.1@example.com"}]
+    }
+  }
+}`
+
+func TestMigrateState(t *testing.T) {
+	t.Run("Should return the document as it is when it has the current schema version", func(t *testing.T) {
+		data := []byte(`{"schemaVersion":"` + StateSchemaVersion + `","lastSync":""}`)
+
+		got, from, err := MigrateState(data)
+		assert.NoError(t, err)
+		assert.Equal(t, StateSchemaVersion, from)
+		assert.Equal(t, data, got)
+	})
+
+	t.Run("Should apply the migrations up to the current schema version", func(t *testing.T) {
+		got, from, err := migrateState([]byte(testStateDocument), "2.0.0", testStateMigrations)
+		assert.NoError(t, err)
+		assert.Equal(t, "1.0.0", from)
+
+		var state State
+		assert.NoError(t, json.Unmarshal(got, &state))
+		assert.Equal(t, "2.0.0", state.SchemaVersion)
+		assert.Equal(t, "2024-11-18T23:36:22Z", state.LastSync)
+		assert.Equal(t, 1, state.Resources.Users.Items)
+
+		var doc map[string]any
+		assert.NoError(t, json.Unmarshal(got, &doc))
+		user := doc["resources"].(map[string]any)["users"].(map[string]any)["resources"].([]any)[0].(map[string]any)
+		assert.Equal(t, "", user["jobTitle"])
+		assert.NotContains(t, user, "title")
+	})
+
+	t.Run("Should compute again the hash code when the migrations change the resources", func(t *testing.T) {
+		data := []byte(strings.Replace(testStateDocument, `"lastSync"`, `"hashCode": "old-hash", "lastSync"`, 1))
+
+		got, _, err := migrateState(data, "2.0.0", testStateMigrations)
+		assert.NoError(t, err)
+
+		var state State
+		assert.NoError(t, json.Unmarshal(got, &state))
+		assert.NotEqual(t, "old-hash", state.HashCode)
+
+		want := state
+		want.SetHashCode()
+		assert.Equal(t, want.HashCode, state.HashCode)
+
+		noop := []StateMigration{{From: "1.0.0", To: "1.1.0", Migrate: func(map[string]any) error { return nil }}}
+		got, _, err = migrateState(data, "1.1.0", noop)
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(got, &state))
+		assert.Equal(t, "old-hash", state.HashCode)
+	})
+
+	t.Run("Should migrate the states without schema version from the initial schema version", func(t *testing.T) {
+		got, from, err := migrateState([]byte(`{"lastSync":""}`), "1.1.0", testStateMigrations)
+		assert.NoError(t, err)
+		assert.Equal(t, stateSchemaVersionInitial, from)
+		assert.JSONEq(t, `{"schemaVersion":"1.1.0","lastSync":""}`, string(got))
+	})
+
+	t.Run("Should return ErrStateSchemaVersionNewer when the state is newer", func(t *testing.T) {
+		_, _, err := migrateState([]byte(`{"schemaVersion":"1.10.0"}`), "1.2.0", testStateMigrations)
+
+		var newer *ErrStateSchemaVersionNewer
+		assert.ErrorAs(t, err, &newer)
+		assert.Equal(t, "1.10.0", newer.Version)
+		assert.Equal(t, "1.2.0", newer.Supported)
+	})
+
+	t.Run("Should return ErrStateMigrationNotFound when a migration is missing", func(t *testing.T) {
+		_, _, err := migrateState([]byte(testStateDocument), "3.0.0", testStateMigrations)
+
+		var notFound *ErrStateMigrationNotFound
+		assert.ErrorAs(t, err, &notFound)
+		assert.Equal(t, "2.0.0", notFound.Version)
+	})
+
+	t.Run("Should return the error of the migration", func(t *testing.T) {
+		migrations := []StateMigration{{From: "1.0.0", To: "1.1.0", Migrate: func(map[string]any) error { return errors.New("test error") }}}
+
+		_, _, err := migrateState([]byte(testStateDocument), "1.1.0", migrations)
+		assert.Error(t, err)
+	})
+
+	t.Run("Should return ErrStateSchemaVersionInvalid", func(t *testing.T) {
+		_, _, err := migrateState([]byte(`{"schemaVersion":"v1"}`), "1.0.0", testStateMigrations)
+		assert.ErrorIs(t, err, ErrStateSchemaVersionInvalid)
+
+		migrations := []StateMigration{{From: "1.0.0", To: "1.0.0", Migrate: func(map[string]any) error { return nil }}}
+		_, _, err = migrateState([]byte(testStateDocument), "1.1.0", migrations)
+		assert.ErrorIs(t, err, ErrStateSchemaVersionInvalid)
+	})
+
+	t.Run("Should migrate a state stored with the 1.0.0 schema version", func(t *testing.T) {
+		data, err := os.ReadFile("testdata/state_1.0.0.json")
+		assert.NoError(t, err)
+
+		got, from, err := MigrateState(data)
+		assert.NoError(t, err)
+		assert.Equal(t, "1.0.0", from)
+
+		var state State
+		assert.NoError(t, json.Unmarshal(got, &state))
+		assert.Equal(t, StateSchemaVersion, state.SchemaVersion)
+		assert.Equal(t, "e72d58ac523af315fa6f3ed3329b8a174f2938c9e67a573ed45217f4a1a7b4e2", state.HashCode)
+		assert.Nil(t, state.Checkpoint)
+		assert.Empty(t, state.Resources.Tombstones)
+
+		assert.Equal(t, 1, state.Resources.Groups.Items)
+		assert.Equal(t, "AWS-SSO-Administrators", state.Resources.Groups.Resources[0].Name)
+		assert.Empty(t, state.Resources.Groups.Resources[0].Origin)
+
+		assert.Equal(t, 1, state.Resources.Users.Items)
+		user := state.Resources.Users.Resources[0]
+		assert.Equal(t, "christian.gonzalez@slashdevops.com", user.UserName)
+		assert.Equal(t, "2275b4a4-d031-70b1-1bb0-e5049d0a0689", user.SCIMID)
+		assert.Equal(t, "IT", user.EnterpriseData.Department)
+		assert.True(t, user.Active)
+		assert.Empty(t, user.Origin)
+
+		assert.Equal(t, 1, state.Resources.GroupsMembers.Items)
+		assert.Equal(t, "AWS-SSO-Administrators", state.Resources.GroupsMembers.Resources[0].Group.Name)
+		assert.Equal(t, 1, state.Resources.GroupsMembers.Resources[0].Items)
+	})
+
+	t.Run("Should keep the tombstones, checkpoint and origins of the states stored with 1.0.0", func(t *testing.T) {
+		data := []byte(`{
+  "schemaVersion": "1.0.0",
+  "lastSync": "2024-11-18T23:36:22Z",
+  "checkpoint": {"phase": "groups", "completed": true, "createdAt": "2024-11-18T23:36:22Z"},
+  "resources": {
+    "users": {"items": 1, "resources": [{"ipid": "1", "userName": "user.1@example.com", "origin": "file"}]},
+    "tombstones": [{"user": {"ipid": "2", "scimid": "scim-2", "userName": "user.2@example.com"}, "deactivatedAt": "2024-11-18T23:36:22Z"}]
+  }
+}`)
+
+		got, from, err := MigrateState(data)
+		assert.NoError(t, err)
+		assert.Equal(t, "1.0.0", from)
+
+		var state State
+		assert.NoError(t, json.Unmarshal(got, &state))
+		assert.Equal(t, StateSchemaVersion, state.SchemaVersion)
+		assert.True(t, state.Checkpoint.PhaseCompleted(CheckpointPhaseGroups))
+		assert.Equal(t, "file", state.Resources.Users.Resources[0].Origin)
+		assert.Len(t, state.Resources.Tombstones, 1)
+		assert.Equal(t, "scim-2", state.Resources.Tombstones[0].User.SCIMID)
+	})
+
+	t.Run("Should have migrations up to the current schema version", func(t *testing.T) {
+		for _, m := range stateMigrations {
+			c, err := compareSchemaVersions(m.To, StateSchemaVersion)
+			assert.NoError(t, err)
+			assert.LessOrEqual(t, c, 0)
+		}
+	})
+}
@@ -684,3 +684,64 @@ func TestState_SetHashCode(t *testing.T) {
 		}
 	})
 }
+
+func TestState_SetHashCode_tombstones(t *testing.T) {
+	u1 := &User{IPID: "1", SCIMID: "1", Name: &Name{FamilyName: "user", GivenName: "1"}, DisplayName: "user.1", Active: true, Emails: []Email{{Value: "user.1@mail.com", Type: "work", Primary: true}}}
+	u1.SetHashCode()
+
+	newState := func(tombstones ...*Tombstone) *State {
+		return &State{
+			Resources: &StateResources{
+				Groups:        &GroupsResult{Resources: []*Group{}},
+				Users:         &UsersResult{Items: 1, Resources: []*User{u1}},
+				GroupsMembers: &GroupsMembersResult{Resources: []*GroupMembers{}},
+				Tombstones:    tombstones,
+			},
+		}
+	}
+
+	st := newState()
+	st.SetHashCode()
+
+	u2 := &User{IPID: "2", SCIMID: "2", Name: &Name{FamilyName: "user", GivenName: "2"}, DisplayName: "user.2", Emails: []Email{{Value: "user.2@mail.com", Type: "work", Primary: true}}}
+	withTombstones := newState(&Tombstone{User: u2, DeactivatedAt: "2024-01-01T00:00:00Z"})
+	withTombstones.SetHashCode()
+
+	if withTombstones.HashCode != st.HashCode {
+		t.Errorf("State.SetHashCode() = %s, want %s", withTombstones.HashCode, st.HashCode)
+	}
+}
+
+func TestCheckpoint_PhaseCompleted(t *testing.T) {
+	tests := []struct {
+		name       string
+		checkpoint *Checkpoint
+		groups     bool
+		users      bool
+		inProgress string
+	}{
+		{name: "nil checkpoint", checkpoint: nil, groups: false, users: false},
+		{name: "groups in progress", checkpoint: &Checkpoint{Phase: CheckpointPhaseGroups}, groups: false, users: false, inProgress: CheckpointPhaseGroups},
+		{name: "groups completed", checkpoint: &Checkpoint{Phase: CheckpointPhaseGroups, Completed: true}, groups: true, users: false},
+		{name: "users in progress", checkpoint: &Checkpoint{Phase: CheckpointPhaseUsers}, groups: true, users: false, inProgress: CheckpointPhaseUsers},
+		{name: "users completed", checkpoint: &Checkpoint{Phase: CheckpointPhaseUsers, Completed: true}, groups: true, users: true},
+		{name: "groups members in progress", checkpoint: &Checkpoint{Phase: CheckpointPhaseGroupsMembers}, groups: true, users: true, inProgress: CheckpointPhaseGroupsMembers},
+		{name: "unknown phase", checkpoint: &Checkpoint{Phase: "unknown", Completed: true}, groups: false, users: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.checkpoint.PhaseCompleted(CheckpointPhaseGroups); got != tt.groups {
+				t.Errorf("Checkpoint.PhaseCompleted(groups) = %v, want %v", got, tt.groups)
+			}
+			if got := tt.checkpoint.PhaseCompleted(CheckpointPhaseUsers); got != tt.users {
+				t.Errorf("Checkpoint.PhaseCompleted(users) = %v, want %v", got, tt.users)
+			}
+			for _, phase := range checkpointPhases {
+				if got := tt.checkpoint.PhaseInProgress(phase); got != (phase == tt.inProgress) {
+					t.Errorf("Checkpoint.PhaseInProgress(%s) = %v, want %v", phase, got, phase == tt.inProgress)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// Tombstone represents a user deactivated in the SCIM side because it was removed from the identity provider.
+// The user is kept deactivated until it comes back to the identity provider or the grace period expires.
+type Tombstone struct {
+	User          *User  `json:"user"`
+	DeactivatedAt string `json:"deactivatedAt"`
+}
+
+// Expired returns true when the grace period since the user was deactivated is over.
+// A grace period of zero or less never expires.
+func (t *Tombstone) Expired(now time.Time, gracePeriod time.Duration) bool {
+	if gracePeriod <= 0 {
+		return false
+	}
+
+	deactivatedAt, err := time.Parse(time.RFC3339, t.DeactivatedAt)
+	if err != nil {
+		// a tombstone without a valid date cannot be trusted to be deleted
+		return false
+	}
+
+	return now.Sub(deactivatedAt) >= gracePeriod
+}
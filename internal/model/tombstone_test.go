@@ -0,0 +1,51 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTombstone_Expired(t *testing.T) {
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	gracePeriod := 7 * 24 * time.Hour
+
+	tests := []struct {
+		name        string
+		tombstone   *Tombstone
+		gracePeriod time.Duration
+		want        bool
+	}{
+		{
+			name:        "inside the grace period",
+			tombstone:   &Tombstone{DeactivatedAt: now.Add(-24 * time.Hour).Format(time.RFC3339)},
+			gracePeriod: gracePeriod,
+			want:        false,
+		},
+		{
+			name:        "grace period expired",
+			tombstone:   &Tombstone{DeactivatedAt: now.Add(-gracePeriod).Format(time.RFC3339)},
+			gracePeriod: gracePeriod,
+			want:        true,
+		},
+		{
+			name:        "without grace period never expires",
+			tombstone:   &Tombstone{DeactivatedAt: now.Add(-365 * 24 * time.Hour).Format(time.RFC3339)},
+			gracePeriod: 0,
+			want:        false,
+		},
+		{
+			name:        "invalid date never expires",
+			tombstone:   &Tombstone{DeactivatedAt: "invalid"},
+			gracePeriod: gracePeriod,
+			want:        false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.tombstone.Expired(now, tt.gracePeriod))
+		})
+	}
+}
@@ -341,6 +341,10 @@ type User struct {
 	Name           *Name           `json:"name,omitempty"`
 	EnterpriseData *EnterpriseData `json:"enterpriseData,omitempty"`
 	Active         bool            `json:"active,omitempty"`
+
+	// Origin is the identity provider source of the user when several sources are merged,
+	// it is not part of the hash code because MarshalBinary leaves it out.
+	Origin string `json:"origin,omitempty"`
 }
 
 // MarshalBinary implements the gob.GobEncoder interface for User entity.
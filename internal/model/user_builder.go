@@ -158,6 +158,12 @@ func (b *UserBuilderChoice) WithActive(active bool) *UserBuilderChoice {
 	return b
 }
 
+// WithOrigin sets the Origin field of the User entity.
+func (b *UserBuilderChoice) WithOrigin(origin string) *UserBuilderChoice {
+	b.u.Origin = origin
+	return b
+}
+
 // Build returns the User entity.
 func (b *UserBuilderChoice) Build() *User {
 	b.u.SetHashCode()
@@ -100,6 +100,14 @@ func TestUserBuilder(t *testing.T) {
 		assert.Equal(t, u.Emails, ub.u.Emails)
 		assert.Equal(t, u.HashCode, ub.u.HashCode)
 	})
+
+	t.Run("origin is not part of the hash code", func(t *testing.T) {
+		u := UserBuilder().WithUserName("user").WithOrigin("google").Build()
+		withoutOrigin := UserBuilder().WithUserName("user").Build()
+
+		assert.Equal(t, "google", u.Origin)
+		assert.Equal(t, withoutOrigin.HashCode, u.HashCode)
+	})
 }
 
 func TestUsersResultBuilder(t *testing.T) {
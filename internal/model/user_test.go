@@ -467,6 +467,20 @@ func TestUser_SetHashCode(t *testing.T) {
 				Emails:      []Email{{Value: "user.1@mail.com", Type: "work", Primary: true}},
 			},
 		},
+		{
+			name: "success with origin",
+			user: User{
+				IPID:        "1",
+				DisplayName: "user 1",
+				Emails:      []Email{{Value: "user.1@mail.com", Type: "work", Primary: true}},
+				Origin:      "google",
+			},
+			want: User{
+				IPID:        "1",
+				DisplayName: "user 1",
+				Emails:      []Email{{Value: "user.1@mail.com", Type: "work", Primary: true}},
+			},
+		},
 		{
 			name: "success empty",
 			user: User{},
@@ -5,32 +5,102 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/slashdevops/idp-scim-sync/internal/model"
 )
 
 // consume io.ReadWriter
 
+const (
+	// diskLockGuardSuffix is the suffix of the guard file held while the lock file is replaced
+	diskLockGuardSuffix = ".guard"
+
+	// diskLockGuardWait is how long the guard file is waited for
+	diskLockGuardWait = 5 * time.Second
+
+	// diskLockGuardStale is the age of the guard files left by the processes that crashed holding them
+	diskLockGuardStale = 30 * time.Second
+)
+
+// ErrOptionWithLockFileNil is returned when the state is locked without the WithLockFile option
+var ErrOptionWithLockFileNil = errors.New("disk: option WithLockFile is nil")
+
 // DiskRepository represents a disk based state repository and implement core.StateRepository interface
 type DiskRepository struct {
 	stateFile io.ReadWriter
+	lockFile  string
+	envelope  *Envelope
 }
 
 // NewDiskRepository creates a new disk based state repository
-func NewDiskRepository(stateFile io.ReadWriter) (*DiskRepository, error) {
+func NewDiskRepository(stateFile io.ReadWriter, opts ...DiskRepositoryOption) (*DiskRepository, error) {
 	if stateFile == nil {
 		return nil, &ErrStateFileNil{Message: "state file cannot be nil"}
 	}
 
-	return &DiskRepository{
+	dr := &DiskRepository{
 		stateFile: stateFile,
-	}, nil
+	}
+
+	for _, opt := range opts {
+		opt(dr)
+	}
+
+	return dr, nil
 }
 
 // GetState returns the state from the state file
-func (dr *DiskRepository) GetState(_ context.Context) (*model.State, error) {
-	var err error
+func (dr *DiskRepository) GetState(ctx context.Context) (*model.State, error) {
+	data, err := dr.readState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = migrateState(data)
+	if err != nil {
+		return nil, fmt.Errorf("disk: error migrating state: %w", err)
+	}
+
+	var state model.State
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, fmt.Errorf("disk: error unmarshalling state: %w", err)
+	}
+	return &state, nil
+}
+
+// MigrateState upgrades the state of the state file to the current schema version of the state and returns
+// the schema version it had, the state is only written again when it had an older schema version.
+func (dr *DiskRepository) MigrateState(ctx context.Context) (string, error) {
+	data, err := dr.readState(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	data, from, err := model.MigrateState(data)
+	if err != nil {
+		return from, fmt.Errorf("disk: error migrating state: %w", err)
+	}
+
+	if from == model.StateSchemaVersion {
+		return from, nil
+	}
+
+	var state model.State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return from, fmt.Errorf("disk: error unmarshalling state: %w", err)
+	}
+
+	return from, dr.SetState(ctx, &state)
+}
 
+// readState returns the decrypted state of the state file
+func (dr *DiskRepository) readState(ctx context.Context) ([]byte, error) {
 	data, err := io.ReadAll(dr.stateFile)
 	if err != nil {
 		return nil, &ErrReadingStateFile{Message: fmt.Sprintf("error reading state file: %s", err)}
@@ -42,23 +112,184 @@ func (dr *DiskRepository) GetState(_ context.Context) (*model.State, error) {
 		return nil, &ErrStateFileEmpty{Message: "state file is empty"}
 	}
 
-	var state model.State
-	err = json.Unmarshal(data, &state)
+	data, err = openState(ctx, dr.envelope, data)
 	if err != nil {
-		return nil, fmt.Errorf("disk: error unmarshalling state: %w", err)
+		return nil, fmt.Errorf("disk: error decrypting state: %w", err)
 	}
-	return &state, nil
+
+	return data, nil
 }
 
 // SetState sets the state in the state file
-func (dr *DiskRepository) SetState(_ context.Context, state *model.State) error {
-	enc := json.NewEncoder(dr.stateFile)
-	enc.SetIndent("", "  ")
-	err := enc.Encode(state)
+func (dr *DiskRepository) SetState(ctx context.Context, state *model.State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
 		return fmt.Errorf("disk: error encoding state: %w", err)
 	}
 
+	data, err = sealState(ctx, dr.envelope, data)
+	if err != nil {
+		return fmt.Errorf("disk: error encrypting state: %w", err)
+	}
+
+	if _, err := dr.stateFile.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("disk: error writing state: %w", err)
+	}
+
+	return nil
+}
+
+// Lock acquires the lock of the state for the owner during the ttl, the lock is the WithLockFile file,
+// created only when it doesn't exist. An *ErrLockHeld error is returned when another owner holds the lock.
+func (dr *DiskRepository) Lock(ctx context.Context, owner string, ttl time.Duration) error {
+	if dr.lockFile == "" {
+		return ErrOptionWithLockFileNil
+	}
+
+	return acquireLock(ctx, diskLockStore{}, dr.lockFile, owner, ttl)
+}
+
+// Renew extends the lock of the state of the owner for the ttl, an *ErrLockLost error
+// is returned when the owner doesn't hold the lock anymore.
+func (dr *DiskRepository) Renew(ctx context.Context, owner string, ttl time.Duration) error {
+	if dr.lockFile == "" {
+		return ErrOptionWithLockFileNil
+	}
+
+	return renewLock(ctx, diskLockStore{}, dr.lockFile, owner, ttl)
+}
+
+// Unlock releases the lock of the state of the owner.
+func (dr *DiskRepository) Unlock(ctx context.Context, owner string) error {
+	if dr.lockFile == "" {
+		return ErrOptionWithLockFileNil
+	}
+
+	return releaseLock(ctx, diskLockStore{}, dr.lockFile, owner)
+}
+
+// diskLockStore stores the locks in files, the keys are the paths of the files
+type diskLockStore struct{}
+
+func (diskLockStore) create(_ context.Context, key string, data []byte) (bool, error) {
+	f, err := os.OpenFile(key, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("disk: error creating the file: %w", err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return false, fmt.Errorf("disk: error writing the file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return false, fmt.Errorf("disk: error closing the file: %w", err)
+	}
+
+	return true, nil
+}
+
+// read returns the file, its version is the content itself
+func (diskLockStore) read(_ context.Context, key string) ([]byte, string, error) {
+	data, err := os.ReadFile(key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", errLockNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, string(data), nil
+}
+
+// replace replaces the file only when it has the content that was read, the file is checked and
+// replaced holding the guard file, so the other processes cannot replace it at the same time
+func (s diskLockStore) replace(_ context.Context, key string, data []byte, version string) (bool, error) {
+	release, err := s.guard(key)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	current, err := os.ReadFile(key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("disk: error reading the file: %w", err)
+	}
+
+	if string(current) != version {
+		return false, nil
+	}
+
+	if err := writeFileAtomic(key, data); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// guard creates the guard file of the given file and returns the function that removes it, it waits up
+// to diskLockGuardWait while another process holds it. The guard files older than diskLockGuardStale
+// were left by processes that crashed holding them and are removed.
+func (diskLockStore) guard(key string) (func(), error) {
+	path := key + diskLockGuardSuffix
+	deadline := time.Now().Add(diskLockGuardWait)
+
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("disk: error creating the guard file: %w", err)
+		}
+
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > diskLockGuardStale {
+			os.Remove(path)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("disk: the guard file %s is held by another process", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// writeFileAtomic replaces the file with a temporary file, so the file is never read partially written
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("disk: error creating the temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("disk: error writing the temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("disk: error closing the temporary file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("disk: error renaming the temporary file: %w", err)
+	}
+
+	return nil
+}
+
+func (diskLockStore) remove(_ context.Context, key string) error {
+	if err := os.Remove(key); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("disk: error removing the file: %w", err)
+	}
+
 	return nil
 }
 
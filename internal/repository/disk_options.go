@@ -0,0 +1,20 @@
+package repository
+
+// DiskRepositoryOption is a function that can be used to configure a DiskRepository
+// using the functional options pattern.
+type DiskRepositoryOption func(*DiskRepository)
+
+// WithLockFile sets the path of the lock file of the state, it is needed to lock the state.
+func WithLockFile(path string) DiskRepositoryOption {
+	return func(dr *DiskRepository) {
+		dr.lockFile = path
+	}
+}
+
+// WithDiskEncryption encrypts the state with the envelope, the states stored in plaintext
+// before are still read. Without it the encrypted states cannot be read.
+func WithDiskEncryption(envelope *Envelope) DiskRepositoryOption {
+	return func(dr *DiskRepository) {
+		dr.envelope = envelope
+	}
+}
@@ -0,0 +1,483 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pkg/errors"
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+)
+
+// Consume dynamodb.Client
+
+// The state is stored in a head item, with the id of the state, that has the version of the state and
+// points to the chunks of the state. The json of the state is split in chunks, every chunk in its own item,
+// because a big state exceeds the 400KB limit of the DynamoDB items. The head item is written with a
+// conditional write on its version, so a state can only be replaced by who read its last version.
+
+const (
+	// DefaultDynamoDBChunkSize is the default maximum size in bytes of the chunks of the state.
+	DefaultDynamoDBChunkSize = 350 * 1024
+
+	// attributes of the items
+	dynamoDBAttrID        = "id"
+	dynamoDBAttrVersion   = "version"
+	dynamoDBAttrChunks    = "chunks"
+	dynamoDBAttrWriteID   = "write_id"
+	dynamoDBAttrHash      = "hash"
+	dynamoDBAttrUpdatedAt = "updated_at"
+	dynamoDBAttrData      = "data"
+
+	// dynamoDBLockSuffix is the suffix of the id of the lock of the state
+	dynamoDBLockSuffix = "#lock"
+)
+
+var (
+	// ErrDynamoDBClientNil is returned when DynamoDB client is nil
+	ErrDynamoDBClientNil = errors.New("dynamodb: AWS DynamoDB Client is nil")
+
+	// ErrOptionWithTableNil is returned when WithTable option is nil
+	ErrOptionWithTableNil = errors.New("dynamodb: option WithTable is nil")
+
+	// ErrOptionWithStateIDNil is returned when WithStateID option is nil
+	ErrOptionWithStateIDNil = errors.New("dynamodb: option WithStateID is nil")
+)
+
+// DynamoDBRepository represent a repository that stores state in DynamoDB and implements core.StateRepository interface
+type DynamoDBRepository struct {
+	table     string
+	stateID   string
+	chunkSize int
+	envelope  *Envelope
+	client    DynamoDBClientAPI
+
+	// mu protects the version, write id and chunks of the last state read or written
+	mu      sync.Mutex
+	version int64
+	writeID string
+	chunks  int
+}
+
+// NewDynamoDBRepository returns a new DynamoDBRepository
+func NewDynamoDBRepository(client DynamoDBClientAPI, opts ...DynamoDBRepositoryOption) (*DynamoDBRepository, error) {
+	if client == nil {
+		return nil, ErrDynamoDBClientNil
+	}
+
+	r := &DynamoDBRepository{
+		client:    client,
+		chunkSize: DefaultDynamoDBChunkSize,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.table == "" {
+		return nil, ErrOptionWithTableNil
+	}
+
+	if r.stateID == "" {
+		return nil, ErrOptionWithStateIDNil
+	}
+
+	return r, nil
+}
+
+// GetState returns the state from the repository, an *ErrStateNotFound error is returned when
+// the table doesn't have the state yet. The version of the state is kept to store the next one.
+func (r *DynamoDBRepository) GetState(ctx context.Context) (*model.State, error) {
+	data, err := r.readState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = migrateState(data)
+	if err != nil {
+		return nil, fmt.Errorf("dynamodb: error migrating the state: %w", err)
+	}
+
+	var state model.State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("dynamodb: error decoding the state: %w", err)
+	}
+
+	return &state, nil
+}
+
+// MigrateState upgrades the stored state to the current schema version of the state and returns the
+// schema version it had, the state is only stored again when it had an older schema version, as the
+// next version of the state read, so it is not stored when a sync replaced it in the meantime.
+func (r *DynamoDBRepository) MigrateState(ctx context.Context) (string, error) {
+	data, err := r.readState(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	data, from, err := model.MigrateState(data)
+	if err != nil {
+		return from, fmt.Errorf("dynamodb: error migrating the state: %w", err)
+	}
+
+	if from == model.StateSchemaVersion {
+		return from, nil
+	}
+
+	var state model.State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return from, fmt.Errorf("dynamodb: error decoding the state: %w", err)
+	}
+
+	return from, r.SetState(ctx, &state)
+}
+
+// readState returns the decrypted state document from its chunks and keeps its version to store the next one
+func (r *DynamoDBRepository) readState(ctx context.Context) ([]byte, error) {
+	head, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.table),
+		Key:            r.key(r.stateID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dynamodb: error getting the state: table: %s, id: %s, error: %w", r.table, r.stateID, err)
+	}
+
+	if head.Item == nil {
+		return nil, &ErrStateNotFound{Message: fmt.Sprintf("state %s not found in the table %s", r.stateID, r.table)}
+	}
+
+	version, err := numberAttr(head.Item, dynamoDBAttrVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, err := numberAttr(head.Item, dynamoDBAttrChunks)
+	if err != nil {
+		return nil, err
+	}
+
+	writeID, err := stringAttr(head.Item, dynamoDBAttrWriteID)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	for n := range int(chunks) {
+		chunk, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(r.table),
+			Key:            r.key(r.chunkID(writeID, n)),
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("dynamodb: error getting the chunk %d of the state: table: %s, id: %s, error: %w", n, r.table, r.stateID, err)
+		}
+
+		// the chunks of a state are deleted when it is replaced
+		if chunk.Item == nil {
+			return nil, fmt.Errorf("dynamodb: chunk %d of the state version %d not found, the state was replaced while reading it: table: %s, id: %s", n, version, r.table, r.stateID)
+		}
+
+		b, ok := chunk.Item[dynamoDBAttrData].(*types.AttributeValueMemberB)
+		if !ok {
+			return nil, fmt.Errorf("dynamodb: chunk %d of the state doesn't have data: table: %s, id: %s", n, r.table, r.stateID)
+		}
+		data = append(data, b.Value...)
+	}
+
+	data, err = openState(ctx, r.envelope, data)
+	if err != nil {
+		return nil, fmt.Errorf("dynamodb: error decrypting the state: %w", err)
+	}
+
+	r.mu.Lock()
+	r.version, r.writeID, r.chunks = version, writeID, int(chunks)
+	r.mu.Unlock()
+
+	return data, nil
+}
+
+// SetState stores the state in the repository as the next version of the state read or written before,
+// an *ErrStateVersionConflict error is returned when the state was replaced by someone else since then.
+// The chunks of the replaced version are deleted.
+func (r *DynamoDBRepository) SetState(ctx context.Context, state *model.State) error {
+	if state == nil {
+		return ErrStateNil
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("dynamodb: error marshaling state: %w", err)
+	}
+
+	data, err = sealState(ctx, r.envelope, data)
+	if err != nil {
+		return fmt.Errorf("dynamodb: error encrypting state: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	writeID, err := newWriteID()
+	if err != nil {
+		return err
+	}
+
+	// the chunks are written before the head, so the head never points to missing chunks
+	chunks := 0
+	for start := 0; start < len(data) || chunks == 0; start += r.chunkSize {
+		end := min(start+r.chunkSize, len(data))
+
+		_, err := r.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(r.table),
+			Item: map[string]types.AttributeValue{
+				dynamoDBAttrID:   &types.AttributeValueMemberS{Value: r.chunkID(writeID, chunks)},
+				dynamoDBAttrData: &types.AttributeValueMemberB{Value: data[start:end]},
+			},
+		})
+		if err != nil {
+			r.deleteChunks(ctx, writeID, chunks)
+			return fmt.Errorf("dynamodb: error putting the chunk %d of the state: table: %s, id: %s, error: %w", chunks, r.table, r.stateID, err)
+		}
+		chunks++
+	}
+
+	version := r.version + 1
+	put := &dynamodb.PutItemInput{
+		TableName: aws.String(r.table),
+		Item: map[string]types.AttributeValue{
+			dynamoDBAttrID:        &types.AttributeValueMemberS{Value: r.stateID},
+			dynamoDBAttrVersion:   &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)},
+			dynamoDBAttrChunks:    &types.AttributeValueMemberN{Value: strconv.Itoa(chunks)},
+			dynamoDBAttrWriteID:   &types.AttributeValueMemberS{Value: writeID},
+			dynamoDBAttrHash:      &types.AttributeValueMemberS{Value: state.HashCode},
+			dynamoDBAttrUpdatedAt: &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+		ExpressionAttributeNames: map[string]string{"#id": dynamoDBAttrID},
+		ConditionExpression:      aws.String("attribute_not_exists(#id)"),
+	}
+
+	// the state is only replaced when its version is still the one read or written before
+	if r.version > 0 {
+		put.ExpressionAttributeNames = map[string]string{"#version": dynamoDBAttrVersion}
+		put.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(r.version, 10)},
+		}
+		put.ConditionExpression = aws.String("#version = :version")
+	}
+
+	if _, err := r.client.PutItem(ctx, put); err != nil {
+		r.deleteChunks(ctx, writeID, chunks)
+
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return &ErrStateVersionConflict{StateID: r.stateID, Version: r.version}
+		}
+
+		return fmt.Errorf("dynamodb: error putting the state: table: %s, id: %s, error: %w", r.table, r.stateID, err)
+	}
+
+	r.deleteChunks(ctx, r.writeID, r.chunks)
+	r.version, r.writeID, r.chunks = version, writeID, chunks
+
+	return nil
+}
+
+// deleteChunks deletes the chunks of a write, the errors are logged because the chunks
+// not deleted are not used anymore and they don't affect the state.
+func (r *DynamoDBRepository) deleteChunks(ctx context.Context, writeID string, chunks int) {
+	for n := range chunks {
+		_, err := r.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(r.table),
+			Key:       r.key(r.chunkID(writeID, n)),
+		})
+		if err != nil {
+			slog.Warn("dynamodb: error deleting a chunk of the state", "table", r.table, "id", r.chunkID(writeID, n), "error", err)
+		}
+	}
+}
+
+func (r *DynamoDBRepository) key(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{dynamoDBAttrID: &types.AttributeValueMemberS{Value: id}}
+}
+
+// chunkID returns the id of the chunk n of a write of the state, the chunks of every write have their own
+// ids, so a write that fails the version condition cannot overwrite the chunks of another one.
+func (r *DynamoDBRepository) chunkID(writeID string, n int) string {
+	return fmt.Sprintf("%s#%s#%d", r.stateID, writeID, n)
+}
+
+// newWriteID returns a random id for the chunks of a write of the state
+func newWriteID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("dynamodb: error generating the write id: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func numberAttr(item map[string]types.AttributeValue, name string) (int64, error) {
+	attr, ok := item[name].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, fmt.Errorf("dynamodb: the state doesn't have the number attribute %s", name)
+	}
+
+	n, err := strconv.ParseInt(attr.Value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("dynamodb: error parsing the attribute %s of the state: %w", name, err)
+	}
+
+	return n, nil
+}
+
+func stringAttr(item map[string]types.AttributeValue, name string) (string, error) {
+	attr, ok := item[name].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", fmt.Errorf("dynamodb: the state doesn't have the string attribute %s", name)
+	}
+
+	return attr.Value, nil
+}
+
+// Lock acquires the lock of the state for the owner during the ttl, the lock is the item with the id of
+// the state and the #lock suffix, created with a conditional write so only one owner creates it.
+// An *ErrLockHeld error is returned when another owner holds the lock.
+func (r *DynamoDBRepository) Lock(ctx context.Context, owner string, ttl time.Duration) error {
+	return acquireLock(ctx, &dynamoDBLockStore{r: r}, r.stateID+dynamoDBLockSuffix, owner, ttl)
+}
+
+// Renew extends the lock of the state of the owner for the ttl, an *ErrLockLost error
+// is returned when the owner doesn't hold the lock anymore.
+func (r *DynamoDBRepository) Renew(ctx context.Context, owner string, ttl time.Duration) error {
+	return renewLock(ctx, &dynamoDBLockStore{r: r}, r.stateID+dynamoDBLockSuffix, owner, ttl)
+}
+
+// Unlock releases the lock of the state of the owner.
+func (r *DynamoDBRepository) Unlock(ctx context.Context, owner string) error {
+	return releaseLock(ctx, &dynamoDBLockStore{r: r}, r.stateID+dynamoDBLockSuffix, owner)
+}
+
+// dynamoDBLockStore stores the locks in the table of the repository, the keys are the ids of the items
+type dynamoDBLockStore struct {
+	r *DynamoDBRepository
+}
+
+func (s *dynamoDBLockStore) create(ctx context.Context, key string, data []byte) (bool, error) {
+	_, err := s.r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(s.r.table),
+		Item:                     s.item(key, data),
+		ExpressionAttributeNames: map[string]string{"#id": dynamoDBAttrID},
+		ConditionExpression:      aws.String("attribute_not_exists(#id)"),
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return false, nil
+		}
+		return false, fmt.Errorf("dynamodb: error putting item: %w", err)
+	}
+
+	return true, nil
+}
+
+// read returns the data of the item, its version is the data itself
+func (s *dynamoDBLockStore) read(ctx context.Context, key string) ([]byte, string, error) {
+	resp, err := s.r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.r.table),
+		Key:            s.r.key(key),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("dynamodb: error getting item: %w", err)
+	}
+
+	if resp.Item == nil {
+		return nil, "", errLockNotFound
+	}
+
+	b, ok := resp.Item[dynamoDBAttrData].(*types.AttributeValueMemberB)
+	if !ok {
+		return nil, "", fmt.Errorf("dynamodb: the item %s doesn't have data", key)
+	}
+
+	return b.Value, string(b.Value), nil
+}
+
+// replace puts the item only when its data is the one that was read, the data of the
+// lock has its owner and expiration, so the lock is not replaced when they changed
+func (s *dynamoDBLockStore) replace(ctx context.Context, key string, data []byte, version string) (bool, error) {
+	_, err := s.r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(s.r.table),
+		Item:                      s.item(key, data),
+		ExpressionAttributeNames:  map[string]string{"#data": dynamoDBAttrData},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":data": &types.AttributeValueMemberB{Value: []byte(version)}},
+		ConditionExpression:       aws.String("#data = :data"),
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return false, nil
+		}
+		return false, fmt.Errorf("dynamodb: error putting item: %w", err)
+	}
+
+	return true, nil
+}
+
+func (s *dynamoDBLockStore) remove(ctx context.Context, key string) error {
+	_, err := s.r.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.r.table),
+		Key:       s.r.key(key),
+	})
+	if err != nil {
+		return fmt.Errorf("dynamodb: error deleting item: %w", err)
+	}
+
+	return nil
+}
+
+func (s *dynamoDBLockStore) item(key string, data []byte) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		dynamoDBAttrID:   &types.AttributeValueMemberS{Value: key},
+		dynamoDBAttrData: &types.AttributeValueMemberB{Value: data},
+	}
+}
+
+// ErrStateNotFound, the repository doesn't have the state yet.
+type ErrStateNotFound struct {
+	Message string
+}
+
+func (e *ErrStateNotFound) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorCode(), e.ErrorMessage())
+}
+
+func (e *ErrStateNotFound) ErrorMessage() string {
+	return e.Message
+}
+func (e *ErrStateNotFound) ErrorCode() string { return "ErrStateNotFound" }
+
+// ErrStateVersionConflict, the state was replaced by someone else since it was read.
+type ErrStateVersionConflict struct {
+	StateID string
+	Version int64
+}
+
+func (e *ErrStateVersionConflict) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorCode(), e.ErrorMessage())
+}
+
+func (e *ErrStateVersionConflict) ErrorMessage() string {
+	return fmt.Sprintf("the state %s was replaced since its version %d was read, another sync is running or ran at the same time", e.StateID, e.Version)
+}
+func (e *ErrStateVersionConflict) ErrorCode() string { return "ErrStateVersionConflict" }
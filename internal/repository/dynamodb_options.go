@@ -0,0 +1,37 @@
+package repository
+
+// DynamoDBRepositoryOption is a function that can be used to configure a DynamoDBRepository
+// using the functional options pattern.
+type DynamoDBRepositoryOption func(*DynamoDBRepository)
+
+// WithTable sets the name of the DynamoDB table, its partition key must be the string attribute id.
+func WithTable(table string) DynamoDBRepositoryOption {
+	return func(r *DynamoDBRepository) {
+		r.table = table
+	}
+}
+
+// WithStateID sets the id of the state in the DynamoDB table, so several states can share the table.
+func WithStateID(id string) DynamoDBRepositoryOption {
+	return func(r *DynamoDBRepository) {
+		r.stateID = id
+	}
+}
+
+// WithChunkSize sets the maximum size in bytes of the chunks of the state, DefaultDynamoDBChunkSize
+// is used when it is zero or less. It must leave room in the 400KB item limit for the other attributes.
+func WithChunkSize(size int) DynamoDBRepositoryOption {
+	return func(r *DynamoDBRepository) {
+		if size > 0 {
+			r.chunkSize = size
+		}
+	}
+}
+
+// WithDynamoDBEncryption encrypts the state with the envelope, the states stored in plaintext
+// before are still read. Without it the encrypted states cannot be read.
+func WithDynamoDBEncryption(envelope *Envelope) DynamoDBRepositoryOption {
+	return func(r *DynamoDBRepository) {
+		r.envelope = envelope
+	}
+}
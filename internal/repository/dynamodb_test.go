@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"go.uber.org/mock/gomock"
+
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDynamoDB is an in-memory DynamoDB table with the conditions used by DynamoDBRepository
+type fakeDynamoDB struct {
+	mu    sync.Mutex
+	items map[string]map[string]types.AttributeValue
+}
+
+func newFakeDynamoDB() *fakeDynamoDB {
+	return &fakeDynamoDB{items: make(map[string]map[string]types.AttributeValue)}
+}
+
+func (f *fakeDynamoDB) id(key map[string]types.AttributeValue) string {
+	return key[dynamoDBAttrID].(*types.AttributeValueMemberS).Value
+}
+
+func (f *fakeDynamoDB) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return &dynamodb.GetItemOutput{Item: f.items[f.id(params.Key)]}, nil
+}
+
+func (f *fakeDynamoDB) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := f.id(params.Item)
+	current, exists := f.items[id]
+
+	switch aws.ToString(params.ConditionExpression) {
+	case "":
+	case "attribute_not_exists(#id)":
+		if exists {
+			return nil, &types.ConditionalCheckFailedException{Message: aws.String("item exists")}
+		}
+	case "#version = :version":
+		want := params.ExpressionAttributeValues[":version"].(*types.AttributeValueMemberN).Value
+		if !exists || current[dynamoDBAttrVersion].(*types.AttributeValueMemberN).Value != want {
+			return nil, &types.ConditionalCheckFailedException{Message: aws.String("version mismatch")}
+		}
+	case "#data = :data":
+		want := params.ExpressionAttributeValues[":data"].(*types.AttributeValueMemberB).Value
+		if !exists || !bytes.Equal(current[dynamoDBAttrData].(*types.AttributeValueMemberB).Value, want) {
+			return nil, &types.ConditionalCheckFailedException{Message: aws.String("data mismatch")}
+		}
+	default:
+		return nil, errors.New("unsupported condition expression")
+	}
+
+	f.items[id] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.items, f.id(params.Key))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+// chunkIDs returns the ids of the chunks of the given state stored in the table
+func (f *fakeDynamoDB) chunkIDs(stateID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ids := []string{}
+	for id := range f.items {
+		if strings.HasPrefix(id, stateID+"#") {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func newTestState(hash string) *model.State {
+	return &model.State{
+		SchemaVersion: model.StateSchemaVersion,
+		CodeVersion:   "0.0.1",
+		LastSync:      "2020-01-01T00:00:00Z",
+		HashCode:      hash,
+		Resources: &model.StateResources{
+			Groups: &model.GroupsResult{
+				Items:     1,
+				HashCode:  "group-hash",
+				Resources: []*model.Group{{IPID: "1", SCIMID: "1", Name: "group 1", Email: "group.1@mail.com"}},
+			},
+			Users:         &model.UsersResult{},
+			GroupsMembers: &model.GroupsMembersResult{},
+		},
+	}
+}
+
+func TestNewDynamoDBRepository(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	t.Run("Should return DynamoDBRepository and no error", func(t *testing.T) {
+		mockDynamoDB := mocks.NewMockDynamoDBClientAPI(mockCtrl)
+
+		svc, err := NewDynamoDBRepository(mockDynamoDB, WithTable("MyTable"), WithStateID("MyState"))
+		assert.NoError(t, err)
+		assert.NotNil(t, svc)
+		assert.Equal(t, DefaultDynamoDBChunkSize, svc.chunkSize)
+	})
+
+	t.Run("Should return an error if no client is provided", func(t *testing.T) {
+		svc, err := NewDynamoDBRepository(nil)
+		assert.ErrorIs(t, err, ErrDynamoDBClientNil)
+		assert.Nil(t, svc)
+	})
+
+	t.Run("Should return an error if no opts WithTable is provided", func(t *testing.T) {
+		mockDynamoDB := mocks.NewMockDynamoDBClientAPI(mockCtrl)
+
+		svc, err := NewDynamoDBRepository(mockDynamoDB, WithStateID("MyState"))
+		assert.ErrorIs(t, err, ErrOptionWithTableNil)
+		assert.Nil(t, svc)
+	})
+
+	t.Run("Should return an error if no opts WithStateID is provided", func(t *testing.T) {
+		mockDynamoDB := mocks.NewMockDynamoDBClientAPI(mockCtrl)
+
+		svc, err := NewDynamoDBRepository(mockDynamoDB, WithTable("MyTable"))
+		assert.ErrorIs(t, err, ErrOptionWithStateIDNil)
+		assert.Nil(t, svc)
+	})
+}
+
+func TestDynamoDBRepository_GetState(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	t.Run("Should return ErrStateNotFound when the table doesn't have the state", func(t *testing.T) {
+		repo, err := NewDynamoDBRepository(newFakeDynamoDB(), WithTable("MyTable"), WithStateID("MyState"))
+		assert.NoError(t, err)
+
+		state, err := repo.GetState(context.Background())
+		assert.Nil(t, state)
+
+		var notFound *ErrStateNotFound
+		assert.ErrorAs(t, err, &notFound)
+	})
+
+	t.Run("Should return an error when the client fails", func(t *testing.T) {
+		mockDynamoDB := mocks.NewMockDynamoDBClientAPI(mockCtrl)
+		mockDynamoDB.EXPECT().GetItem(gomock.Any(), gomock.Any()).Return(nil, errors.New("test error")).Times(1)
+
+		repo, err := NewDynamoDBRepository(mockDynamoDB, WithTable("MyTable"), WithStateID("MyState"))
+		assert.NoError(t, err)
+
+		state, err := repo.GetState(context.Background())
+		assert.Error(t, err)
+		assert.Nil(t, state)
+	})
+}
+
+func TestDynamoDBRepository_SetState(t *testing.T) {
+	t.Run("Should store the state in several chunks and read it back", func(t *testing.T) {
+		table := newFakeDynamoDB()
+
+		writer, err := NewDynamoDBRepository(table, WithTable("MyTable"), WithStateID("MyState"), WithChunkSize(64))
+		assert.NoError(t, err)
+
+		state := newTestState("hash-1")
+		assert.NoError(t, writer.SetState(context.Background(), state))
+		assert.Greater(t, len(table.chunkIDs("MyState")), 1)
+
+		reader, err := NewDynamoDBRepository(table, WithTable("MyTable"), WithStateID("MyState"))
+		assert.NoError(t, err)
+
+		got, err := reader.GetState(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, state, got)
+	})
+
+	t.Run("Should delete the chunks of the replaced state", func(t *testing.T) {
+		table := newFakeDynamoDB()
+
+		repo, err := NewDynamoDBRepository(table, WithTable("MyTable"), WithStateID("MyState"), WithChunkSize(64))
+		assert.NoError(t, err)
+
+		assert.NoError(t, repo.SetState(context.Background(), newTestState("hash-1")))
+		first := table.chunkIDs("MyState")
+
+		assert.NoError(t, repo.SetState(context.Background(), newTestState("hash-2")))
+		second := table.chunkIDs("MyState")
+
+		assert.Len(t, second, len(first))
+		for _, id := range first {
+			assert.NotContains(t, second, id)
+		}
+
+		got, err := repo.GetState(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "hash-2", got.HashCode)
+	})
+
+	t.Run("Should return ErrStateVersionConflict when the state was replaced since it was read", func(t *testing.T) {
+		table := newFakeDynamoDB()
+		ctx := context.Background()
+
+		first, err := NewDynamoDBRepository(table, WithTable("MyTable"), WithStateID("MyState"), WithChunkSize(64))
+		assert.NoError(t, err)
+		assert.NoError(t, first.SetState(ctx, newTestState("hash-1")))
+
+		// two syncs read the same version of the state
+		a, err := NewDynamoDBRepository(table, WithTable("MyTable"), WithStateID("MyState"), WithChunkSize(64))
+		assert.NoError(t, err)
+		_, err = a.GetState(ctx)
+		assert.NoError(t, err)
+
+		b, err := NewDynamoDBRepository(table, WithTable("MyTable"), WithStateID("MyState"), WithChunkSize(64))
+		assert.NoError(t, err)
+		_, err = b.GetState(ctx)
+		assert.NoError(t, err)
+
+		assert.NoError(t, a.SetState(ctx, newTestState("hash-a")))
+		chunks := table.chunkIDs("MyState")
+
+		err = b.SetState(ctx, newTestState("hash-b"))
+		var conflict *ErrStateVersionConflict
+		assert.ErrorAs(t, err, &conflict)
+		assert.Equal(t, int64(1), conflict.Version)
+
+		// the state and the chunks of the winner are kept
+		assert.ElementsMatch(t, chunks, table.chunkIDs("MyState"))
+
+		got, err := first.GetState(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "hash-a", got.HashCode)
+	})
+
+	t.Run("Should return ErrStateVersionConflict when the state was created since the repository was created", func(t *testing.T) {
+		table := newFakeDynamoDB()
+		ctx := context.Background()
+
+		a, err := NewDynamoDBRepository(table, WithTable("MyTable"), WithStateID("MyState"))
+		assert.NoError(t, err)
+		b, err := NewDynamoDBRepository(table, WithTable("MyTable"), WithStateID("MyState"))
+		assert.NoError(t, err)
+
+		assert.NoError(t, a.SetState(ctx, newTestState("hash-a")))
+
+		var conflict *ErrStateVersionConflict
+		assert.ErrorAs(t, b.SetState(ctx, newTestState("hash-b")), &conflict)
+	})
+
+	t.Run("Should return an error when the state is nil", func(t *testing.T) {
+		repo, err := NewDynamoDBRepository(newFakeDynamoDB(), WithTable("MyTable"), WithStateID("MyState"))
+		assert.NoError(t, err)
+
+		assert.ErrorIs(t, repo.SetState(context.Background(), nil), ErrStateNil)
+	})
+}
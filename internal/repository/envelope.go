@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/slashdevops/idp-scim-sync/internal/config"
+)
+
+// EnvelopeAlgorithm is the algorithm that encrypts the state with the data key
+const EnvelopeAlgorithm = "AES-256-GCM"
+
+// dataKeySize is the size in bytes of the data keys, AES-256
+const dataKeySize = 32
+
+var (
+	// ErrKeyProviderNil is returned when the key provider of the envelope is nil
+	ErrKeyProviderNil = errors.New("envelope: key provider is nil")
+
+	// ErrStateEncrypted is returned when the state is encrypted and the repository doesn't have an envelope to decrypt it
+	ErrStateEncrypted = errors.New("envelope: the state is encrypted and the encryption of the state is not configured")
+
+	// ErrStateKeyProviderMismatch is returned when the state was encrypted by another key provider
+	ErrStateKeyProviderMismatch = errors.New("envelope: the state was encrypted by another key provider")
+
+	// ErrStateEncryptionUnknown is returned when the state encryption of the configuration is not none, kms or file
+	ErrStateEncryptionUnknown = errors.New("envelope: unknown state encryption")
+
+	// ErrEnvelopeAlgorithmNotSupported is returned when the state was encrypted with an unknown algorithm
+	ErrEnvelopeAlgorithmNotSupported = errors.New("envelope: algorithm not supported")
+)
+
+// KeyProvider generates the data keys that encrypt the states and decrypts them, the data keys
+// are stored encrypted with the state, so only the key provider can decrypt the state.
+type KeyProvider interface {
+	// Name returns the name of the key provider, stored with the state.
+	Name() string
+
+	// GenerateDataKey returns a new data key, in plaintext and encrypted, and the id of the key that encrypted it.
+	GenerateDataKey(ctx context.Context) (plaintext []byte, encrypted []byte, keyID string, err error)
+
+	// DecryptDataKey returns the plaintext of the data key encrypted by the key with the given id.
+	DecryptDataKey(ctx context.Context, keyID string, encrypted []byte) ([]byte, error)
+}
+
+// Envelope encrypts the states with envelope encryption, every state is encrypted with
+// a new data key and the data key is stored encrypted by the KeyProvider with the state.
+type Envelope struct {
+	provider KeyProvider
+}
+
+// NewEnvelope returns a new Envelope that uses the given key provider
+func NewEnvelope(provider KeyProvider) (*Envelope, error) {
+	if provider == nil {
+		return nil, ErrKeyProviderNil
+	}
+
+	return &Envelope{provider: provider}, nil
+}
+
+// NewStateEnvelope returns the envelope that encrypts the state with the state encryption of the given
+// configuration, nil when the state is stored in plaintext. The kms client is only used by the kms encryption.
+func NewStateEnvelope(kmsClient KMSClientAPI, c *config.Config) (*Envelope, error) {
+	var provider KeyProvider
+	var err error
+
+	switch c.StateEncryption {
+	case config.StateEncryptionKMS:
+		provider, err = NewKMSKeyProvider(kmsClient, c.AWSKMSKeyID)
+	case config.StateEncryptionFile:
+		provider, err = NewFileKeyProvider(c.StateEncryptionKeyFile)
+	case config.StateEncryptionNone, "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrStateEncryptionUnknown, c.StateEncryption)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEnvelope(provider)
+}
+
+// sealedState is the document stored instead of the state when the state is encrypted
+type sealedState struct {
+	Encryption *sealedStateEncryption `json:"encryption"`
+	Ciphertext []byte                 `json:"ciphertext"`
+}
+
+// sealedStateEncryption is how the state was encrypted
+type sealedStateEncryption struct {
+	Algorithm    string `json:"algorithm"`
+	Provider     string `json:"provider"`
+	KeyID        string `json:"keyId"`
+	EncryptedKey []byte `json:"encryptedKey"`
+	Nonce        []byte `json:"nonce"`
+}
+
+// additionalData binds the ciphertext to how it was encrypted, so the header cannot be changed
+func (e *sealedStateEncryption) additionalData() []byte {
+	return []byte(e.Algorithm + "|" + e.Provider + "|" + e.KeyID)
+}
+
+// Seal returns the encrypted document of the given state in plaintext
+func (e *Envelope) Seal(ctx context.Context, plaintext []byte) ([]byte, error) {
+	dataKey, encryptedKey, keyID, err := e.provider.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: error generating the data key: %w", err)
+	}
+	defer clear(dataKey)
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("envelope: error generating the nonce: %w", err)
+	}
+
+	sealed := &sealedState{
+		Encryption: &sealedStateEncryption{
+			Algorithm:    EnvelopeAlgorithm,
+			Provider:     e.provider.Name(),
+			KeyID:        keyID,
+			EncryptedKey: encryptedKey,
+			Nonce:        nonce,
+		},
+	}
+	sealed.Ciphertext = gcm.Seal(nil, nonce, plaintext, sealed.Encryption.additionalData())
+
+	data, err := json.MarshalIndent(sealed, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("envelope: error marshaling the encrypted state: %w", err)
+	}
+
+	return data, nil
+}
+
+// Open returns the plaintext of the given encrypted document, the plaintext states are returned as they are,
+// so the states stored before the encryption was enabled are read and encrypted when they are stored again.
+func (e *Envelope) Open(ctx context.Context, data []byte) ([]byte, error) {
+	sealed := parseSealedState(data)
+	if sealed == nil {
+		return data, nil
+	}
+
+	if sealed.Encryption.Algorithm != EnvelopeAlgorithm {
+		return nil, fmt.Errorf("%w: %s", ErrEnvelopeAlgorithmNotSupported, sealed.Encryption.Algorithm)
+	}
+
+	if sealed.Encryption.Provider != e.provider.Name() {
+		return nil, fmt.Errorf("%w: state: %s, configured: %s", ErrStateKeyProviderMismatch, sealed.Encryption.Provider, e.provider.Name())
+	}
+
+	dataKey, err := e.provider.DecryptDataKey(ctx, sealed.Encryption.KeyID, sealed.Encryption.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: error decrypting the data key: key id: %s, error: %w", sealed.Encryption.KeyID, err)
+	}
+	defer clear(dataKey)
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed.Encryption.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("envelope: invalid nonce of the encrypted state")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed.Encryption.Nonce, sealed.Ciphertext, sealed.Encryption.additionalData())
+	if err != nil {
+		return nil, fmt.Errorf("envelope: error decrypting the state: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// parseSealedState returns the encrypted document in data, nil when data is not an encrypted document
+func parseSealedState(data []byte) *sealedState {
+	var sealed sealedState
+	if err := json.Unmarshal(data, &sealed); err != nil || sealed.Encryption == nil {
+		return nil
+	}
+
+	return &sealed
+}
+
+// sealState encrypts the state when the repository has an envelope
+func sealState(ctx context.Context, e *Envelope, data []byte) ([]byte, error) {
+	if e == nil {
+		return data, nil
+	}
+
+	return e.Seal(ctx, data)
+}
+
+// openState decrypts the state when it is encrypted, ErrStateEncrypted is returned
+// when the state is encrypted and the repository doesn't have an envelope.
+func openState(ctx context.Context, e *Envelope, data []byte) ([]byte, error) {
+	if e == nil {
+		if parseSealedState(data) != nil {
+			return nil, ErrStateEncrypted
+		}
+		return data, nil
+	}
+
+	return e.Open(ctx, data)
+}
+
+// newGCM returns the AES-GCM cipher of the key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: error creating the cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: error creating the cipher: %w", err)
+	}
+
+	return gcm, nil
+}
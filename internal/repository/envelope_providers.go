@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	// KeyProviderKMS is the name of the AWS KMS key provider
+	KeyProviderKMS = "aws-kms"
+
+	// KeyProviderFile is the name of the key file provider
+	KeyProviderFile = "file"
+)
+
+var (
+	// ErrKMSClientNil is returned when the AWS KMS client is nil
+	ErrKMSClientNil = errors.New("envelope: AWS KMS client is nil")
+
+	// ErrKMSKeyIDEmpty is returned when the id of the AWS KMS key is empty
+	ErrKMSKeyIDEmpty = errors.New("envelope: AWS KMS key id is empty")
+
+	// ErrKMSKeyIDMissing is returned when AWS KMS doesn't return the arn of the key that generated the data key
+	ErrKMSKeyIDMissing = errors.New("envelope: AWS KMS didn't return the key arn")
+
+	// ErrKeyFileInvalid is returned when the key file doesn't have a base64 encoded 32 bytes key
+	ErrKeyFileInvalid = errors.New("envelope: the key file must have a base64 encoded 32 bytes key")
+
+	// ErrStateKeyMismatch is returned when the data key of the state was encrypted by another key
+	ErrStateKeyMismatch = errors.New("envelope: the state was encrypted by another key")
+)
+
+// KMSKeyProvider generates the data keys with an AWS KMS key
+type KMSKeyProvider struct {
+	client KMSClientAPI
+	keyID  string
+}
+
+// NewKMSKeyProvider returns a new KMSKeyProvider that uses the AWS KMS key with the given id, arn or alias
+func NewKMSKeyProvider(client KMSClientAPI, keyID string) (*KMSKeyProvider, error) {
+	if client == nil {
+		return nil, ErrKMSClientNil
+	}
+
+	if keyID == "" {
+		return nil, ErrKMSKeyIDEmpty
+	}
+
+	return &KMSKeyProvider{client: client, keyID: keyID}, nil
+}
+
+// Name returns the name of the key provider
+func (p *KMSKeyProvider) Name() string { return KeyProviderKMS }
+
+// GenerateDataKey returns a new data key generated by AWS KMS and the arn of the key that generated it,
+// the configured key id could be an alias, so the arn is stored with the state instead of the alias
+// and the state can be decrypted after the alias is changed to another key.
+func (p *KMSKeyProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, string, error) {
+	out, err := p.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(p.keyID),
+		KeySpec: types.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("envelope: error generating the data key: %w", err)
+	}
+
+	keyARN := aws.ToString(out.KeyId)
+	if keyARN == "" {
+		return nil, nil, "", ErrKMSKeyIDMissing
+	}
+
+	return out.Plaintext, out.CiphertextBlob, keyARN, nil
+}
+
+// DecryptDataKey decrypts the data key with AWS KMS, the key that encrypted it is used,
+// so the states encrypted before the key was changed can still be decrypted.
+// The states stored with an alias are decrypted with the key in the metadata of the
+// encrypted data key, because the alias could point to another key now.
+func (p *KMSKeyProvider) DecryptDataKey(ctx context.Context, keyID string, encrypted []byte) ([]byte, error) {
+	in := &kms.DecryptInput{CiphertextBlob: encrypted}
+	if !strings.HasPrefix(keyID, "alias/") {
+		in.KeyId = aws.String(keyID)
+	}
+
+	out, err := p.client.Decrypt(ctx, in)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: error decrypting the data key: %w", err)
+	}
+
+	return out.Plaintext, nil
+}
+
+// FileKeyProvider encrypts the data keys with a key stored in a local file, it is meant for tests
+// and local runs, the key file must have a base64 encoded 32 bytes key, like `openssl rand -base64 32`.
+type FileKeyProvider struct {
+	key   []byte
+	keyID string
+}
+
+// NewFileKeyProvider returns a new FileKeyProvider that uses the key in the given file
+func NewFileKeyProvider(path string) (*FileKeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: error reading the key file: %w", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != dataKeySize {
+		return nil, ErrKeyFileInvalid
+	}
+
+	// the id is the fingerprint of the key, so the key is never stored with the state
+	sum := sha256.Sum256(key)
+
+	return &FileKeyProvider{key: key, keyID: hex.EncodeToString(sum[:8])}, nil
+}
+
+// Name returns the name of the key provider
+func (p *FileKeyProvider) Name() string { return KeyProviderFile }
+
+// GenerateDataKey returns a new random data key encrypted with the key of the file
+func (p *FileKeyProvider) GenerateDataKey(_ context.Context) ([]byte, []byte, string, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, "", fmt.Errorf("envelope: error generating the data key: %w", err)
+	}
+
+	gcm, err := newGCM(p.key)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, "", fmt.Errorf("envelope: error generating the nonce: %w", err)
+	}
+
+	// the nonce is stored before the encrypted data key
+	return dataKey, gcm.Seal(nonce, nonce, dataKey, []byte(p.keyID)), p.keyID, nil
+}
+
+// DecryptDataKey decrypts the data key with the key of the file
+func (p *FileKeyProvider) DecryptDataKey(_ context.Context, keyID string, encrypted []byte) ([]byte, error) {
+	if keyID != p.keyID {
+		return nil, fmt.Errorf("%w: state: %s, configured: %s", ErrStateKeyMismatch, keyID, p.keyID)
+	}
+
+	gcm, err := newGCM(p.key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(encrypted) < gcm.NonceSize() {
+		return nil, errors.New("envelope: invalid encrypted data key")
+	}
+
+	dataKey, err := gcm.Open(nil, encrypted[:gcm.NonceSize()], encrypted[gcm.NonceSize():], []byte(p.keyID))
+	if err != nil {
+		return nil, fmt.Errorf("envelope: error decrypting the data key: %w", err)
+	}
+
+	return dataKey, nil
+}
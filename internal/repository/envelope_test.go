@@ -0,0 +1,362 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/slashdevops/idp-scim-sync/internal/config"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/repository"
+)
+
+func newTestKeyFile(t *testing.T) string {
+	t.Helper()
+
+	key := make([]byte, dataKeySize)
+	_, err := rand.Read(key)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "state.key")
+	assert.NoError(t, os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0o600))
+
+	return path
+}
+
+func newTestEnvelope(t *testing.T) *Envelope {
+	t.Helper()
+
+	provider, err := NewFileKeyProvider(newTestKeyFile(t))
+	assert.NoError(t, err)
+
+	envelope, err := NewEnvelope(provider)
+	assert.NoError(t, err)
+
+	return envelope
+}
+
+func TestEnvelope(t *testing.T) {
+	ctx := context.Background()
+	plaintext := []byte(`{"hashCode":"hash-1","resources":{"users":{"items":1}}}`)
+
+	t.Run("Should encrypt and decrypt the state", func(t *testing.T) {
+		envelope := newTestEnvelope(t)
+
+		sealed, err := envelope.Seal(ctx, plaintext)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(sealed), "hash-1")
+
+		var doc sealedState
+		assert.NoError(t, json.Unmarshal(sealed, &doc))
+		assert.Equal(t, EnvelopeAlgorithm, doc.Encryption.Algorithm)
+		assert.Equal(t, KeyProviderFile, doc.Encryption.Provider)
+
+		opened, err := envelope.Open(ctx, sealed)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, opened)
+	})
+
+	t.Run("Should return the plaintext states as they are", func(t *testing.T) {
+		opened, err := newTestEnvelope(t).Open(ctx, plaintext)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, opened)
+	})
+
+	t.Run("Should not decrypt the state with another key", func(t *testing.T) {
+		sealed, err := newTestEnvelope(t).Seal(ctx, plaintext)
+		assert.NoError(t, err)
+
+		_, err = newTestEnvelope(t).Open(ctx, sealed)
+		assert.ErrorIs(t, err, ErrStateKeyMismatch)
+	})
+
+	t.Run("Should not decrypt the state when it was changed", func(t *testing.T) {
+		envelope := newTestEnvelope(t)
+
+		sealed, err := envelope.Seal(ctx, plaintext)
+		assert.NoError(t, err)
+
+		var doc sealedState
+		assert.NoError(t, json.Unmarshal(sealed, &doc))
+		doc.Ciphertext[0] ^= 0xff
+		tampered, err := json.Marshal(&doc)
+		assert.NoError(t, err)
+
+		_, err = envelope.Open(ctx, tampered)
+		assert.Error(t, err)
+	})
+
+	t.Run("Should return ErrStateEncrypted without envelope", func(t *testing.T) {
+		sealed, err := newTestEnvelope(t).Seal(ctx, plaintext)
+		assert.NoError(t, err)
+
+		_, err = openState(ctx, nil, sealed)
+		assert.ErrorIs(t, err, ErrStateEncrypted)
+
+		opened, err := openState(ctx, nil, plaintext)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, opened)
+	})
+
+	t.Run("Should return ErrKeyProviderNil", func(t *testing.T) {
+		_, err := NewEnvelope(nil)
+		assert.ErrorIs(t, err, ErrKeyProviderNil)
+	})
+}
+
+// fakeKMS is an AWS KMS with aliases, the encrypted data keys have the arn of the key that
+// encrypted them and Decrypt fails when it is called with another key, like AWS KMS does.
+type fakeKMS struct {
+	aliases map[string]string
+}
+
+func (f *fakeKMS) GenerateDataKey(_ context.Context, params *kms.GenerateDataKeyInput, _ ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	keyARN := aws.ToString(params.KeyId)
+	if arn, ok := f.aliases[keyARN]; ok {
+		keyARN = arn
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	return &kms.GenerateDataKeyOutput{
+		KeyId:          aws.String(keyARN),
+		Plaintext:      bytes.Clone(dataKey),
+		CiphertextBlob: append([]byte(keyARN+"|"), dataKey...),
+	}, nil
+}
+
+func (f *fakeKMS) Decrypt(_ context.Context, params *kms.DecryptInput, _ ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	keyARN, dataKey, _ := bytes.Cut(params.CiphertextBlob, []byte("|"))
+	if params.KeyId != nil && aws.ToString(params.KeyId) != string(keyARN) {
+		return nil, errors.New("IncorrectKeyException")
+	}
+
+	return &kms.DecryptOutput{KeyId: aws.String(string(keyARN)), Plaintext: dataKey}, nil
+}
+
+func TestKMSKeyProvider(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx := context.Background()
+	keyARN := "arn:aws:kms:us-east-1:123456789012:key/key-1"
+
+	t.Run("Should encrypt and decrypt the state with the data keys of AWS KMS", func(t *testing.T) {
+		client := &fakeKMS{aliases: map[string]string{"alias/idpscim": keyARN}}
+
+		provider, err := NewKMSKeyProvider(client, "alias/idpscim")
+		assert.NoError(t, err)
+		envelope, err := NewEnvelope(provider)
+		assert.NoError(t, err)
+
+		sealed, err := envelope.Seal(ctx, []byte(`{"hashCode":"hash-1"}`))
+		assert.NoError(t, err)
+
+		var doc sealedState
+		assert.NoError(t, json.Unmarshal(sealed, &doc))
+		assert.Equal(t, keyARN, doc.Encryption.KeyID)
+
+		opened, err := envelope.Open(ctx, sealed)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"hashCode":"hash-1"}`, string(opened))
+	})
+
+	t.Run("Should decrypt the states after the alias is changed to another key", func(t *testing.T) {
+		client := &fakeKMS{aliases: map[string]string{"alias/idpscim": keyARN}}
+
+		provider, err := NewKMSKeyProvider(client, "alias/idpscim")
+		assert.NoError(t, err)
+		envelope, err := NewEnvelope(provider)
+		assert.NoError(t, err)
+
+		sealed, err := envelope.Seal(ctx, []byte(`{"hashCode":"hash-1"}`))
+		assert.NoError(t, err)
+
+		client.aliases["alias/idpscim"] = "arn:aws:kms:us-east-1:123456789012:key/key-2"
+
+		opened, err := envelope.Open(ctx, sealed)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"hashCode":"hash-1"}`, string(opened))
+
+		resealed, err := envelope.Seal(ctx, []byte(`{"hashCode":"hash-2"}`))
+		assert.NoError(t, err)
+
+		var doc sealedState
+		assert.NoError(t, json.Unmarshal(resealed, &doc))
+		assert.Equal(t, "arn:aws:kms:us-east-1:123456789012:key/key-2", doc.Encryption.KeyID)
+	})
+
+	t.Run("Should decrypt the states stored with an alias with the key of the data key", func(t *testing.T) {
+		mockKMS := mocks.NewMockKMSClientAPI(mockCtrl)
+		mockKMS.EXPECT().Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: []byte("encrypted")}).Return(&kms.DecryptOutput{Plaintext: []byte("data key")}, nil).Times(1)
+
+		provider, err := NewKMSKeyProvider(mockKMS, "alias/idpscim")
+		assert.NoError(t, err)
+
+		dataKey, err := provider.DecryptDataKey(ctx, "alias/idpscim", []byte("encrypted"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("data key"), dataKey)
+	})
+
+	t.Run("Should return the error of AWS KMS", func(t *testing.T) {
+		mockKMS := mocks.NewMockKMSClientAPI(mockCtrl)
+		mockKMS.EXPECT().GenerateDataKey(ctx, gomock.Any()).Return(nil, errors.New("test error")).Times(1)
+
+		provider, err := NewKMSKeyProvider(mockKMS, "alias/idpscim")
+		assert.NoError(t, err)
+		envelope, err := NewEnvelope(provider)
+		assert.NoError(t, err)
+
+		_, err = envelope.Seal(ctx, []byte(`{}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("Should return ErrKMSKeyIDMissing when AWS KMS doesn't return the key arn", func(t *testing.T) {
+		mockKMS := mocks.NewMockKMSClientAPI(mockCtrl)
+		mockKMS.EXPECT().GenerateDataKey(ctx, gomock.Any()).Return(&kms.GenerateDataKeyOutput{Plaintext: []byte("data key")}, nil).Times(1)
+
+		provider, err := NewKMSKeyProvider(mockKMS, "alias/idpscim")
+		assert.NoError(t, err)
+
+		_, _, _, err = provider.GenerateDataKey(ctx)
+		assert.ErrorIs(t, err, ErrKMSKeyIDMissing)
+	})
+
+	t.Run("Should not decrypt the states of another key provider", func(t *testing.T) {
+		sealed, err := newTestEnvelope(t).Seal(ctx, []byte(`{}`))
+		assert.NoError(t, err)
+
+		provider, err := NewKMSKeyProvider(mocks.NewMockKMSClientAPI(mockCtrl), "alias/idpscim")
+		assert.NoError(t, err)
+		envelope, err := NewEnvelope(provider)
+		assert.NoError(t, err)
+
+		_, err = envelope.Open(ctx, sealed)
+		assert.ErrorIs(t, err, ErrStateKeyProviderMismatch)
+	})
+
+	t.Run("Should return an error without client or key id", func(t *testing.T) {
+		_, err := NewKMSKeyProvider(nil, "alias/idpscim")
+		assert.ErrorIs(t, err, ErrKMSClientNil)
+
+		_, err = NewKMSKeyProvider(mocks.NewMockKMSClientAPI(mockCtrl), "")
+		assert.ErrorIs(t, err, ErrKMSKeyIDEmpty)
+	})
+}
+
+func TestNewStateEnvelope(t *testing.T) {
+	t.Run("Should return nil when the state is stored in plaintext", func(t *testing.T) {
+		envelope, err := NewStateEnvelope(nil, &config.Config{StateEncryption: config.StateEncryptionNone})
+		assert.NoError(t, err)
+		assert.Nil(t, envelope)
+	})
+
+	t.Run("Should return the envelope of the configured encryption", func(t *testing.T) {
+		envelope, err := NewStateEnvelope(nil, &config.Config{StateEncryption: config.StateEncryptionFile, StateEncryptionKeyFile: newTestKeyFile(t)})
+		assert.NoError(t, err)
+		assert.Equal(t, KeyProviderFile, envelope.provider.Name())
+
+		envelope, err = NewStateEnvelope(&fakeKMS{}, &config.Config{StateEncryption: config.StateEncryptionKMS, AWSKMSKeyID: "alias/idpscim"})
+		assert.NoError(t, err)
+		assert.Equal(t, KeyProviderKMS, envelope.provider.Name())
+	})
+
+	t.Run("Should return an error when the encryption is not valid", func(t *testing.T) {
+		_, err := NewStateEnvelope(nil, &config.Config{StateEncryption: config.StateEncryptionKMS, AWSKMSKeyID: "alias/idpscim"})
+		assert.ErrorIs(t, err, ErrKMSClientNil)
+
+		_, err = NewStateEnvelope(nil, &config.Config{StateEncryption: "rot13"})
+		assert.ErrorIs(t, err, ErrStateEncryptionUnknown)
+	})
+}
+
+func TestNewFileKeyProvider(t *testing.T) {
+	t.Run("Should return ErrKeyFileInvalid when the key is not valid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "state.key")
+		assert.NoError(t, os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString([]byte("short"))), 0o600))
+
+		_, err := NewFileKeyProvider(path)
+		assert.ErrorIs(t, err, ErrKeyFileInvalid)
+	})
+
+	t.Run("Should return an error when the file doesn't exist", func(t *testing.T) {
+		_, err := NewFileKeyProvider(filepath.Join(t.TempDir(), "missing.key"))
+		assert.Error(t, err)
+	})
+}
+
+func TestRepositories_Encryption(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should encrypt the state and its history in S3 and read the plaintext states", func(t *testing.T) {
+		bucket := newFakeS3()
+		envelope := newTestEnvelope(t)
+
+		plain, err := NewS3Repository(bucket, WithBucket("MyBucket"), WithKey("data/state.json"))
+		assert.NoError(t, err)
+		assert.NoError(t, plain.SetState(ctx, newTestState("hash-1")))
+
+		repo, err := NewS3Repository(bucket, WithBucket("MyBucket"), WithKey("data/state.json"), WithHistory(5), WithEncryption(envelope))
+		assert.NoError(t, err)
+
+		state, err := repo.GetState(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "hash-1", state.HashCode)
+
+		assert.NoError(t, repo.SetState(ctx, newTestState("hash-2")))
+		for key, data := range bucket.objects {
+			assert.NotNil(t, parseSealedState(data), key)
+		}
+
+		state, err = repo.GetState(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "hash-2", state.HashCode)
+
+		versions, err := repo.ListStateVersions(ctx)
+		assert.NoError(t, err)
+		state, err = repo.GetStateVersion(ctx, versions[0].Version)
+		assert.NoError(t, err)
+		assert.Equal(t, "hash-2", state.HashCode)
+
+		_, err = plain.GetState(ctx)
+		assert.ErrorIs(t, err, ErrStateEncrypted)
+	})
+
+	t.Run("Should encrypt the state in the disk", func(t *testing.T) {
+		file := &bytes.Buffer{}
+
+		repo, err := NewDiskRepository(file, WithDiskEncryption(newTestEnvelope(t)))
+		assert.NoError(t, err)
+
+		assert.NoError(t, repo.SetState(ctx, newTestState("hash-1")))
+		assert.NotNil(t, parseSealedState(file.Bytes()))
+
+		state, err := repo.GetState(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "hash-1", state.HashCode)
+	})
+
+	t.Run("Should encrypt the state in DynamoDB", func(t *testing.T) {
+		repo, err := NewDynamoDBRepository(newFakeDynamoDB(), WithTable("MyTable"), WithStateID("MyState"), WithDynamoDBEncryption(newTestEnvelope(t)))
+		assert.NoError(t, err)
+
+		assert.NoError(t, repo.SetState(ctx, newTestState("hash-1")))
+
+		state, err := repo.GetState(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "hash-1", state.HashCode)
+	})
+}
@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The lock of a state is a lease: an object next to the state, created only when it doesn't exist, with
+// the owner of the lock and when it expires. The owner renews the lock before it expires and removes it
+// when the sync ends. The renewals and the takeovers of the expired locks, like the one of a sync that
+// crashed, replace the lock only when it wasn't changed since it was read, so only one sync can take over
+// an expired lock and a sync cannot renew a lock that was taken over.
+
+var (
+	// ErrLockOwnerEmpty is returned when the owner of the lock is empty
+	ErrLockOwnerEmpty = errors.New("lock: owner cannot be empty")
+
+	// ErrLockTTLInvalid is returned when the ttl of the lock is not greater than 0
+	ErrLockTTLInvalid = errors.New("lock: ttl must be greater than 0")
+
+	// errLockNotFound is returned by the lock stores when the lock doesn't exist
+	errLockNotFound = errors.New("lock: not found")
+)
+
+// lockStore stores the objects of the locks of a repository.
+type lockStore interface {
+	// create stores the object only when it doesn't exist, it returns false when it exists.
+	create(ctx context.Context, key string, data []byte) (bool, error)
+
+	// read returns the object and its version, errLockNotFound is returned when it doesn't exist.
+	read(ctx context.Context, key string) ([]byte, string, error)
+
+	// replace stores the object only when it has the version returned by read, it returns false
+	// when the object was changed or removed after it was read.
+	replace(ctx context.Context, key string, data []byte, version string) (bool, error)
+
+	// remove deletes the object.
+	remove(ctx context.Context, key string) error
+}
+
+// lockInfo is the content of the lock of a state.
+type lockInfo struct {
+	Owner      string    `json:"owner"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// expired returns true when the lock expired at the given time.
+func (l *lockInfo) expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// acquireLock creates the lock with the given key for the owner, when the lock exists and it is not
+// expired an *ErrLockHeld error is returned. The owner of an existing lock acquires it again.
+func acquireLock(ctx context.Context, store lockStore, key, owner string, ttl time.Duration) error {
+	if owner == "" {
+		return ErrLockOwnerEmpty
+	}
+	if ttl <= 0 {
+		return ErrLockTTLInvalid
+	}
+
+	now := time.Now().UTC()
+	data, err := json.Marshal(&lockInfo{Owner: owner, AcquiredAt: now, ExpiresAt: now.Add(ttl)})
+	if err != nil {
+		return fmt.Errorf("lock: error marshaling the lock: %w", err)
+	}
+
+	// the second attempt is done when the lock was removed, renewed or taken over after the first one
+	var current *lockInfo
+	for range 2 {
+		created, err := store.create(ctx, key, data)
+		if err != nil {
+			return fmt.Errorf("lock: error creating the lock %s: %w", key, err)
+		}
+		if created {
+			return nil
+		}
+
+		info, version, err := readLock(ctx, store, key)
+		if errors.Is(err, errLockNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		current = info
+
+		if info.Owner == owner {
+			return renewLock(ctx, store, key, owner, ttl)
+		}
+
+		if !info.expired(time.Now()) {
+			return &ErrLockHeld{Key: key, Owner: info.Owner, ExpiresAt: info.ExpiresAt}
+		}
+
+		// only one of the syncs that read the expired lock replaces it
+		won, err := store.replace(ctx, key, data, version)
+		if err != nil {
+			return fmt.Errorf("lock: error taking over the lock %s: %w", key, err)
+		}
+		if won {
+			slog.Warn("expired lock taken over", "key", key, "owner", info.Owner, "expiresAt", info.ExpiresAt)
+			return nil
+		}
+	}
+
+	held := &ErrLockHeld{Key: key}
+	if current != nil {
+		held.Owner, held.ExpiresAt = current.Owner, current.ExpiresAt
+	}
+
+	return held
+}
+
+// renewLock extends the expiration of the lock of the owner, an *ErrLockLost error is returned
+// when the owner doesn't hold the lock anymore or it was taken over while it was renewed.
+func renewLock(ctx context.Context, store lockStore, key, owner string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrLockTTLInvalid
+	}
+
+	info, version, err := readLock(ctx, store, key)
+	if errors.Is(err, errLockNotFound) {
+		return &ErrLockLost{Key: key, Owner: owner}
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Owner != owner {
+		return &ErrLockLost{Key: key, Owner: owner}
+	}
+
+	info.ExpiresAt = time.Now().UTC().Add(ttl)
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("lock: error marshaling the lock: %w", err)
+	}
+
+	renewed, err := store.replace(ctx, key, data, version)
+	if err != nil {
+		return fmt.Errorf("lock: error renewing the lock %s: %w", key, err)
+	}
+	if !renewed {
+		return &ErrLockLost{Key: key, Owner: owner}
+	}
+
+	return nil
+}
+
+// releaseLock removes the lock of the owner, an *ErrLockLost error is returned
+// when the lock is held by another owner.
+func releaseLock(ctx context.Context, store lockStore, key, owner string) error {
+	info, _, err := readLock(ctx, store, key)
+	if errors.Is(err, errLockNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Owner != owner {
+		return &ErrLockLost{Key: key, Owner: owner}
+	}
+
+	if err := store.remove(ctx, key); err != nil {
+		return fmt.Errorf("lock: error removing the lock %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// readLock returns the lock decoded and the version of its object.
+func readLock(ctx context.Context, store lockStore, key string) (*lockInfo, string, error) {
+	content, version, err := store.read(ctx, key)
+	if err != nil {
+		if errors.Is(err, errLockNotFound) {
+			return nil, "", err
+		}
+		return nil, "", fmt.Errorf("lock: error reading the lock %s: %w", key, err)
+	}
+
+	var info lockInfo
+	if err := json.Unmarshal(content, &info); err != nil {
+		return nil, "", fmt.Errorf("lock: error decoding the lock %s: %w", key, err)
+	}
+
+	return &info, version, nil
+}
+
+// ErrLockHeld, the lock of the state is held by another owner.
+type ErrLockHeld struct {
+	Key       string
+	Owner     string
+	ExpiresAt time.Time
+}
+
+func (e *ErrLockHeld) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorCode(), e.ErrorMessage())
+}
+
+func (e *ErrLockHeld) ErrorMessage() string {
+	return fmt.Sprintf("the lock %s is held by %s until %s", e.Key, e.Owner, e.ExpiresAt.Format(time.RFC3339))
+}
+func (e *ErrLockHeld) ErrorCode() string { return "ErrLockHeld" }
+
+// ErrLockLost, the owner doesn't hold the lock of the state anymore, it expired and was taken over.
+type ErrLockLost struct {
+	Key   string
+	Owner string
+}
+
+func (e *ErrLockLost) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorCode(), e.ErrorMessage())
+}
+
+func (e *ErrLockLost) ErrorMessage() string {
+	return fmt.Sprintf("the lock %s is not held by %s anymore", e.Key, e.Owner)
+}
+func (e *ErrLockLost) ErrorCode() string { return "ErrLockLost" }
@@ -0,0 +1,400 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/repository"
+)
+
+func newTestDiskRepository(t *testing.T) (*DiskRepository, string) {
+	t.Helper()
+
+	lockFile := filepath.Join(t.TempDir(), "state.json.lock")
+	repo, err := NewDiskRepository(&bytes.Buffer{}, WithLockFile(lockFile))
+	assert.NoError(t, err)
+
+	return repo, lockFile
+}
+
+func writeExpiredLock(t *testing.T, path, owner string) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(&lockInfo{
+		Owner:      owner,
+		AcquiredAt: time.Now().Add(-2 * time.Hour),
+		ExpiresAt:  time.Now().Add(-time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+
+	return data
+}
+
+func TestDiskRepository_Lock(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should acquire the lock and return ErrLockHeld to another owner", func(t *testing.T) {
+		repo, lockFile := newTestDiskRepository(t)
+
+		assert.NoError(t, repo.Lock(ctx, "owner-a", time.Minute))
+		assert.FileExists(t, lockFile)
+
+		var held *ErrLockHeld
+		assert.ErrorAs(t, repo.Lock(ctx, "owner-b", time.Minute), &held)
+		assert.Equal(t, "owner-a", held.Owner)
+	})
+
+	t.Run("Should acquire again the lock of the same owner", func(t *testing.T) {
+		repo, _ := newTestDiskRepository(t)
+
+		assert.NoError(t, repo.Lock(ctx, "owner-a", time.Minute))
+		assert.NoError(t, repo.Lock(ctx, "owner-a", time.Minute))
+	})
+
+	t.Run("Should take over an expired lock only once", func(t *testing.T) {
+		repo, lockFile := newTestDiskRepository(t)
+		expired := writeExpiredLock(t, lockFile, "crashed")
+
+		assert.NoError(t, repo.Lock(ctx, "owner-a", time.Minute))
+
+		info, _, err := readLock(ctx, diskLockStore{}, lockFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "owner-a", info.Owner)
+
+		// another sync that read the same expired lock cannot take it over again
+		won, err := diskLockStore{}.replace(ctx, lockFile, []byte(`{"owner":"owner-b"}`), string(expired))
+		assert.NoError(t, err)
+		assert.False(t, won)
+
+		// the takeover doesn't leave other files next to the lock
+		entries, err := os.ReadDir(filepath.Dir(lockFile))
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("Should return ErrLockHeld when the expired lock was taken over by another owner", func(t *testing.T) {
+		repo, lockFile := newTestDiskRepository(t)
+		expired := writeExpiredLock(t, lockFile, "crashed")
+
+		data, err := json.Marshal(&lockInfo{Owner: "owner-b", AcquiredAt: time.Now(), ExpiresAt: time.Now().Add(time.Minute)})
+		assert.NoError(t, err)
+
+		won, err := diskLockStore{}.replace(ctx, lockFile, data, string(expired))
+		assert.NoError(t, err)
+		assert.True(t, won)
+
+		var held *ErrLockHeld
+		assert.ErrorAs(t, repo.Lock(ctx, "owner-a", time.Minute), &held)
+		assert.Equal(t, "owner-b", held.Owner)
+	})
+
+	t.Run("Should return an error with an invalid owner or ttl", func(t *testing.T) {
+		repo, _ := newTestDiskRepository(t)
+
+		assert.ErrorIs(t, repo.Lock(ctx, "", time.Minute), ErrLockOwnerEmpty)
+		assert.ErrorIs(t, repo.Lock(ctx, "owner-a", 0), ErrLockTTLInvalid)
+	})
+
+	t.Run("Should return an error without lock file", func(t *testing.T) {
+		repo, err := NewDiskRepository(&bytes.Buffer{})
+		assert.NoError(t, err)
+
+		assert.ErrorIs(t, repo.Lock(ctx, "owner-a", time.Minute), ErrOptionWithLockFileNil)
+		assert.ErrorIs(t, repo.Renew(ctx, "owner-a", time.Minute), ErrOptionWithLockFileNil)
+		assert.ErrorIs(t, repo.Unlock(ctx, "owner-a"), ErrOptionWithLockFileNil)
+	})
+}
+
+func TestDiskRepository_Renew(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should extend the lock of the owner", func(t *testing.T) {
+		repo, lockFile := newTestDiskRepository(t)
+
+		assert.NoError(t, repo.Lock(ctx, "owner-a", time.Second))
+		before, _, err := readLock(ctx, diskLockStore{}, lockFile)
+		assert.NoError(t, err)
+
+		assert.NoError(t, repo.Renew(ctx, "owner-a", time.Hour))
+		after, _, err := readLock(ctx, diskLockStore{}, lockFile)
+		assert.NoError(t, err)
+
+		assert.Equal(t, before.AcquiredAt, after.AcquiredAt)
+		assert.True(t, after.ExpiresAt.After(before.ExpiresAt))
+	})
+
+	t.Run("Should return ErrLockLost when the lock is held by another owner", func(t *testing.T) {
+		repo, _ := newTestDiskRepository(t)
+
+		assert.NoError(t, repo.Lock(ctx, "owner-b", time.Minute))
+
+		var lost *ErrLockLost
+		assert.ErrorAs(t, repo.Renew(ctx, "owner-a", time.Minute), &lost)
+	})
+
+	t.Run("Should return ErrLockLost when the lock doesn't exist", func(t *testing.T) {
+		repo, _ := newTestDiskRepository(t)
+
+		var lost *ErrLockLost
+		assert.ErrorAs(t, repo.Renew(ctx, "owner-a", time.Minute), &lost)
+	})
+
+	t.Run("Should return ErrLockLost when the lock is taken over while it is renewed", func(t *testing.T) {
+		_, lockFile := newTestDiskRepository(t)
+		writeExpiredLock(t, lockFile, "owner-a")
+
+		store := &takeoverOnReadLockStore{lockStore: diskLockStore{}, owner: "owner-b"}
+
+		var lost *ErrLockLost
+		assert.ErrorAs(t, renewLock(ctx, store, lockFile, "owner-a", time.Minute), &lost)
+
+		info, _, err := readLock(ctx, diskLockStore{}, lockFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "owner-b", info.Owner)
+	})
+
+	t.Run("Should remove the guard files left by the processes that crashed", func(t *testing.T) {
+		_, lockFile := newTestDiskRepository(t)
+		assert.NoError(t, os.WriteFile(lockFile+diskLockGuardSuffix, nil, 0o600))
+
+		stale := time.Now().Add(-2 * diskLockGuardStale)
+		assert.NoError(t, os.Chtimes(lockFile+diskLockGuardSuffix, stale, stale))
+
+		release, err := diskLockStore{}.guard(lockFile)
+		assert.NoError(t, err)
+		release()
+		assert.NoFileExists(t, lockFile+diskLockGuardSuffix)
+	})
+}
+
+// takeoverOnReadLockStore is a lockStore where the lock is taken over by another owner
+// just after it is read, like a sync that takes it over while it is renewed.
+type takeoverOnReadLockStore struct {
+	lockStore
+	owner string
+}
+
+func (s *takeoverOnReadLockStore) read(ctx context.Context, key string) ([]byte, string, error) {
+	data, version, err := s.lockStore.read(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	takeover, err := json.Marshal(&lockInfo{Owner: s.owner, AcquiredAt: time.Now(), ExpiresAt: time.Now().Add(time.Minute)})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if _, err := s.lockStore.replace(ctx, key, takeover, version); err != nil {
+		return nil, "", err
+	}
+
+	return data, version, nil
+}
+
+func TestDiskRepository_Unlock(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should remove the lock of the owner", func(t *testing.T) {
+		repo, lockFile := newTestDiskRepository(t)
+
+		assert.NoError(t, repo.Lock(ctx, "owner-a", time.Minute))
+		assert.NoError(t, repo.Unlock(ctx, "owner-a"))
+		assert.NoFileExists(t, lockFile)
+
+		assert.NoError(t, repo.Lock(ctx, "owner-b", time.Minute))
+	})
+
+	t.Run("Should not remove the lock of another owner", func(t *testing.T) {
+		repo, lockFile := newTestDiskRepository(t)
+
+		assert.NoError(t, repo.Lock(ctx, "owner-b", time.Minute))
+
+		var lost *ErrLockLost
+		assert.ErrorAs(t, repo.Unlock(ctx, "owner-a"), &lost)
+		assert.FileExists(t, lockFile)
+	})
+
+	t.Run("Should not return an error when the lock doesn't exist", func(t *testing.T) {
+		repo, _ := newTestDiskRepository(t)
+
+		assert.NoError(t, repo.Unlock(ctx, "owner-a"))
+	})
+}
+
+func TestS3Repository_Lock(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx := context.Background()
+
+	t.Run("Should create the lock with a conditional write", func(t *testing.T) {
+		mockS3 := mocks.NewMockS3ClientAPI(mockCtrl)
+		mockS3.EXPECT().PutObject(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+				assert.Equal(t, "data/state.json.lock", *params.Key)
+				assert.Equal(t, "*", *params.IfNoneMatch)
+				return &s3.PutObjectOutput{}, nil
+			},
+		).Times(1)
+
+		repo, err := NewS3Repository(mockS3, WithBucket("MyBucket"), WithKey("data/state.json"))
+		assert.NoError(t, err)
+
+		assert.NoError(t, repo.Lock(ctx, "owner-a", time.Minute))
+	})
+
+	t.Run("Should return ErrLockHeld when the lock exists", func(t *testing.T) {
+		held, err := json.Marshal(&lockInfo{Owner: "owner-b", AcquiredAt: time.Now(), ExpiresAt: time.Now().Add(time.Minute)})
+		assert.NoError(t, err)
+
+		mockS3 := mocks.NewMockS3ClientAPI(mockCtrl)
+		mockS3.EXPECT().PutObject(ctx, gomock.Any()).Return(nil, &smithy.GenericAPIError{Code: "PreconditionFailed"}).Times(1)
+		mockS3.EXPECT().GetObject(ctx, gomock.Any()).Return(&s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(held)), ETag: aws.String(`"etag-1"`)}, nil).Times(1)
+
+		repo, err := NewS3Repository(mockS3, WithBucket("MyBucket"), WithKey("data/state.json"))
+		assert.NoError(t, err)
+
+		var heldErr *ErrLockHeld
+		assert.ErrorAs(t, repo.Lock(ctx, "owner-a", time.Minute), &heldErr)
+		assert.Equal(t, "owner-b", heldErr.Owner)
+	})
+
+	t.Run("Should take over an expired lock replacing it only when it wasn't changed", func(t *testing.T) {
+		expired, err := json.Marshal(&lockInfo{Owner: "crashed", AcquiredAt: time.Now().Add(-2 * time.Hour), ExpiresAt: time.Now().Add(-time.Hour)})
+		assert.NoError(t, err)
+
+		mockS3 := mocks.NewMockS3ClientAPI(mockCtrl)
+		gomock.InOrder(
+			mockS3.EXPECT().PutObject(ctx, gomock.Any()).Return(nil, &smithy.GenericAPIError{Code: "PreconditionFailed"}).Times(1),
+			mockS3.EXPECT().GetObject(ctx, gomock.Any()).Return(&s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(expired)), ETag: aws.String(`"etag-1"`)}, nil).Times(1),
+			mockS3.EXPECT().PutObject(ctx, gomock.Any()).DoAndReturn(
+				func(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+					assert.Equal(t, "data/state.json.lock", *params.Key)
+					assert.Equal(t, `"etag-1"`, *params.IfMatch)
+					assert.Nil(t, params.IfNoneMatch)
+					return &s3.PutObjectOutput{}, nil
+				},
+			).Times(1),
+		)
+
+		repo, err := NewS3Repository(mockS3, WithBucket("MyBucket"), WithKey("data/state.json"))
+		assert.NoError(t, err)
+
+		// no other object is created or deleted to take over the lock
+		assert.NoError(t, repo.Lock(ctx, "owner-a", time.Minute))
+	})
+
+	t.Run("Should return an error when the client fails", func(t *testing.T) {
+		mockS3 := mocks.NewMockS3ClientAPI(mockCtrl)
+		mockS3.EXPECT().PutObject(ctx, gomock.Any()).Return(nil, &smithy.GenericAPIError{Code: "AccessDenied"}).Times(1)
+
+		repo, err := NewS3Repository(mockS3, WithBucket("MyBucket"), WithKey("data/state.json"))
+		assert.NoError(t, err)
+
+		err = repo.Lock(ctx, "owner-a", time.Minute)
+		assert.Error(t, err)
+
+		var heldErr *ErrLockHeld
+		assert.NotErrorAs(t, err, &heldErr)
+	})
+}
+
+func TestS3Repository_Renew(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx := context.Background()
+	held, err := json.Marshal(&lockInfo{Owner: "owner-a", AcquiredAt: time.Now(), ExpiresAt: time.Now().Add(time.Minute)})
+	assert.NoError(t, err)
+
+	t.Run("Should renew the lock only when it has the ETag that was read", func(t *testing.T) {
+		mockS3 := mocks.NewMockS3ClientAPI(mockCtrl)
+		mockS3.EXPECT().GetObject(ctx, gomock.Any()).Return(&s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(held)), ETag: aws.String(`"etag-1"`)}, nil).Times(1)
+		mockS3.EXPECT().PutObject(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+				assert.Equal(t, `"etag-1"`, *params.IfMatch)
+				return &s3.PutObjectOutput{}, nil
+			},
+		).Times(1)
+
+		repo, err := NewS3Repository(mockS3, WithBucket("MyBucket"), WithKey("data/state.json"))
+		assert.NoError(t, err)
+
+		assert.NoError(t, repo.Renew(ctx, "owner-a", time.Minute))
+	})
+
+	t.Run("Should return ErrLockLost when the lock changed after it was read", func(t *testing.T) {
+		mockS3 := mocks.NewMockS3ClientAPI(mockCtrl)
+		mockS3.EXPECT().GetObject(ctx, gomock.Any()).Return(&s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(held)), ETag: aws.String(`"etag-1"`)}, nil).Times(1)
+		mockS3.EXPECT().PutObject(ctx, gomock.Any()).Return(nil, &smithy.GenericAPIError{Code: "PreconditionFailed"}).Times(1)
+
+		repo, err := NewS3Repository(mockS3, WithBucket("MyBucket"), WithKey("data/state.json"))
+		assert.NoError(t, err)
+
+		var lost *ErrLockLost
+		assert.ErrorAs(t, repo.Renew(ctx, "owner-a", time.Minute), &lost)
+	})
+}
+
+func TestDynamoDBRepository_Lock(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should lock, renew and unlock the state", func(t *testing.T) {
+		table := newFakeDynamoDB()
+
+		a, err := NewDynamoDBRepository(table, WithTable("MyTable"), WithStateID("MyState"))
+		assert.NoError(t, err)
+		b, err := NewDynamoDBRepository(table, WithTable("MyTable"), WithStateID("MyState"))
+		assert.NoError(t, err)
+
+		assert.NoError(t, a.Lock(ctx, "owner-a", time.Minute))
+
+		var held *ErrLockHeld
+		assert.ErrorAs(t, b.Lock(ctx, "owner-b", time.Minute), &held)
+
+		assert.NoError(t, a.Renew(ctx, "owner-a", time.Minute))
+		assert.NoError(t, a.Unlock(ctx, "owner-a"))
+
+		assert.NoError(t, b.Lock(ctx, "owner-b", time.Minute))
+	})
+
+	t.Run("Should take over an expired lock and not renew the lock taken over", func(t *testing.T) {
+		table := newFakeDynamoDB()
+
+		a, err := NewDynamoDBRepository(table, WithTable("MyTable"), WithStateID("MyState"))
+		assert.NoError(t, err)
+		b, err := NewDynamoDBRepository(table, WithTable("MyTable"), WithStateID("MyState"))
+		assert.NoError(t, err)
+
+		assert.NoError(t, a.Lock(ctx, "owner-a", time.Nanosecond))
+		time.Sleep(time.Millisecond)
+
+		store := &takeoverOnReadLockStore{lockStore: &dynamoDBLockStore{r: a}, owner: "owner-b"}
+
+		var lost *ErrLockLost
+		assert.ErrorAs(t, renewLock(ctx, store, "MyState"+dynamoDBLockSuffix, "owner-a", time.Minute), &lost)
+
+		var held *ErrLockHeld
+		assert.ErrorAs(t, a.Lock(ctx, "owner-a", time.Minute), &held)
+		assert.Equal(t, "owner-b", held.Owner)
+
+		// the takeover doesn't leave other items in the table
+		assert.Len(t, table.items, 1)
+		assert.NoError(t, b.Unlock(ctx, "owner-b"))
+		assert.Empty(t, table.items)
+	})
+}
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"log/slog"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+)
+
+// migrateState upgrades the state document to the current schema version of the state, so the
+// states stored by older versions are read without starting again from an empty state.
+func migrateState(data []byte) ([]byte, error) {
+	migrated, from, err := model.MigrateState(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if from != model.StateSchemaVersion {
+		slog.Info("state schema migrated", "from", from, "to", model.StateSchemaVersion)
+	}
+
+	return migrated, nil
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepositories_Migration(t *testing.T) {
+	ctx := context.Background()
+	newer := []byte(`{"schemaVersion":"999.0.0","lastSync":"2024-11-18T23:36:22Z"}`)
+
+	t.Run("Should not read the states of a newer schema version", func(t *testing.T) {
+		bucket := newFakeS3()
+		bucket.objects["data/state.json"] = newer
+
+		repo, err := NewS3Repository(bucket, WithBucket("MyBucket"), WithKey("data/state.json"))
+		assert.NoError(t, err)
+
+		var newerErr *model.ErrStateSchemaVersionNewer
+		_, err = repo.GetState(ctx)
+		assert.ErrorAs(t, err, &newerErr)
+
+		_, err = repo.MigrateState(ctx)
+		assert.ErrorAs(t, err, &newerErr)
+		assert.Equal(t, newer, bucket.objects["data/state.json"])
+
+		disk, err := NewDiskRepository(bytes.NewBuffer(newer))
+		assert.NoError(t, err)
+		_, err = disk.GetState(ctx)
+		assert.ErrorAs(t, err, &newerErr)
+	})
+
+	t.Run("Should not store again the states of the current schema version", func(t *testing.T) {
+		bucket := newFakeS3()
+		envelope := newTestEnvelope(t)
+
+		repo, err := NewS3Repository(bucket, WithBucket("MyBucket"), WithKey("data/state.json"), WithEncryption(envelope))
+		assert.NoError(t, err)
+		assert.NoError(t, repo.SetState(ctx, newTestState("hash-1")))
+		stored := bytes.Clone(bucket.objects["data/state.json"])
+
+		from, err := repo.MigrateState(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, model.StateSchemaVersion, from)
+		assert.Equal(t, stored, bucket.objects["data/state.json"])
+	})
+
+	t.Run("Should store the DynamoDB state of an older schema version with the current one", func(t *testing.T) {
+		table := newFakeDynamoDB()
+
+		writer, err := NewDynamoDBRepository(table, WithTable("MyTable"), WithStateID("MyState"))
+		assert.NoError(t, err)
+		older := newTestState("hash-1")
+		older.SchemaVersion = "1.0.0"
+		assert.NoError(t, writer.SetState(ctx, older))
+
+		repo, err := NewDynamoDBRepository(table, WithTable("MyTable"), WithStateID("MyState"))
+		assert.NoError(t, err)
+
+		from, err := repo.MigrateState(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "1.0.0", from)
+		assert.Equal(t, "2", table.items["MyState"][dynamoDBAttrVersion].(*types.AttributeValueMemberN).Value)
+
+		from, err = repo.MigrateState(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, model.StateSchemaVersion, from)
+		assert.Equal(t, "2", table.items["MyState"][dynamoDBAttrVersion].(*types.AttributeValueMemberN).Value)
+
+		state, err := repo.GetState(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, model.StateSchemaVersion, state.SchemaVersion)
+		assert.Equal(t, "hash-1", state.HashCode)
+		assert.Equal(t, "group 1", state.Resources.Groups.Resources[0].Name)
+	})
+
+	t.Run("Should write the disk state of an older schema version with the current one", func(t *testing.T) {
+		data, err := os.ReadFile("testdata/state_1.0.0.json")
+		assert.NoError(t, err)
+
+		var file bytes.Buffer
+		file.Write(data)
+
+		repo, err := NewDiskRepository(&file)
+		assert.NoError(t, err)
+
+		from, err := repo.MigrateState(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "1.0.0", from)
+
+		state, err := repo.GetState(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, model.StateSchemaVersion, state.SchemaVersion)
+		assert.Equal(t, "christian.gonzalez@slashdevops.com", state.Resources.Users.Resources[0].UserName)
+	})
+}
@@ -5,15 +5,23 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 	"github.com/pkg/errors"
 	"github.com/slashdevops/idp-scim-sync/internal/model"
 )
 
 // Consume s3.Client
 
+// s3LockSuffix is the suffix of the key of the lock of the state
+const s3LockSuffix = ".lock"
+
 var (
 	// ErrS3ClientNil is returned when s3 client is nil
 	ErrS3ClientNil = errors.New("s3: AWS S3 Client is nil")
@@ -30,9 +38,11 @@ var (
 
 // S3Repository represent a repository that stores state in S3 and implements model.Repository interface
 type S3Repository struct {
-	bucket string
-	key    string
-	client S3ClientAPI
+	bucket           string
+	key              string
+	historyRetention int
+	envelope         *Envelope
+	client           S3ClientAPI
 }
 
 // NewS3Repository returns a new S3Repository
@@ -71,14 +81,7 @@ func (r *S3Repository) GetState(ctx context.Context) (*model.State, error) {
 	}
 	defer resp.Body.Close()
 
-	var state model.State
-	dec := json.NewDecoder(resp.Body)
-
-	if err = dec.Decode(&state); err != nil {
-		return nil, fmt.Errorf("s3: error decoding S3 object: %w", err)
-	}
-
-	return &state, nil
+	return r.decodeState(ctx, resp.Body)
 }
 
 // SetState sets the state in the given repository
@@ -87,9 +90,9 @@ func (r *S3Repository) SetState(ctx context.Context, state *model.State) error {
 		return ErrStateNil
 	}
 
-	jsonPayload, err := json.MarshalIndent(state, "", "  ")
+	jsonPayload, err := r.encodeState(ctx, state)
 	if err != nil {
-		return fmt.Errorf("s3: error marshaling state: %w", err)
+		return err
 	}
 
 	_, err = r.client.PutObject(ctx, &s3.PutObjectInput{
@@ -101,5 +104,202 @@ func (r *S3Repository) SetState(ctx context.Context, state *model.State) error {
 		return fmt.Errorf("s3: error putting S3 object: %w", err)
 	}
 
+	// the state is already stored, so the errors of the history don't fail the sync
+	if r.historyRetention > 0 && state.Checkpoint == nil {
+		if err := r.storeSnapshot(ctx, jsonPayload, time.Now()); err != nil {
+			slog.Warn("cannot store the state in the history", "bucket", r.bucket, "key", r.key, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// encodeState returns the document of the state stored in the bucket, encrypted when the repository has an envelope
+func (r *S3Repository) encodeState(ctx context.Context, state *model.State) ([]byte, error) {
+	jsonPayload, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("s3: error marshaling state: %w", err)
+	}
+
+	jsonPayload, err = sealState(ctx, r.envelope, jsonPayload)
+	if err != nil {
+		return nil, fmt.Errorf("s3: error encrypting state: %w", err)
+	}
+
+	return jsonPayload, nil
+}
+
+// decodeState returns the state of the document stored in the bucket
+func (r *S3Repository) decodeState(ctx context.Context, body io.Reader) (*model.State, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("s3: error reading S3 object: %w", err)
+	}
+
+	data, err = openState(ctx, r.envelope, data)
+	if err != nil {
+		return nil, fmt.Errorf("s3: error decrypting S3 object: %w", err)
+	}
+
+	data, err = migrateState(data)
+	if err != nil {
+		return nil, fmt.Errorf("s3: error migrating S3 object: %w", err)
+	}
+
+	var state model.State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("s3: error decoding S3 object: %w", err)
+	}
+
+	return &state, nil
+}
+
+// MigrateState upgrades the stored state to the current schema version of the state and returns the
+// schema version it had, the state is only stored again when it had an older schema version.
+func (r *S3Repository) MigrateState(ctx context.Context) (string, error) {
+	resp, err := r.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("s3: error getting S3 object: bucket: %s, error: %w", r.bucket, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("s3: error reading S3 object: %w", err)
+	}
+
+	data, err = openState(ctx, r.envelope, data)
+	if err != nil {
+		return "", fmt.Errorf("s3: error decrypting S3 object: %w", err)
+	}
+
+	data, from, err := model.MigrateState(data)
+	if err != nil {
+		return from, fmt.Errorf("s3: error migrating S3 object: %w", err)
+	}
+
+	if from == model.StateSchemaVersion {
+		return from, nil
+	}
+
+	var state model.State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return from, fmt.Errorf("s3: error decoding S3 object: %w", err)
+	}
+
+	jsonPayload, err := r.encodeState(ctx, &state)
+	if err != nil {
+		return from, err
+	}
+
+	_, err = r.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.key),
+		Body:   bytes.NewReader(jsonPayload),
+	})
+	if err != nil {
+		return from, fmt.Errorf("s3: error putting S3 object: %w", err)
+	}
+
+	return from, nil
+}
+
+// Lock acquires the lock of the state for the owner during the ttl, the lock is the object with the key of
+// the state and the .lock suffix, created with a conditional write (If-None-Match) so only one owner creates it.
+// An *ErrLockHeld error is returned when another owner holds the lock.
+func (r *S3Repository) Lock(ctx context.Context, owner string, ttl time.Duration) error {
+	return acquireLock(ctx, &s3LockStore{r: r}, r.key+s3LockSuffix, owner, ttl)
+}
+
+// Renew extends the lock of the state of the owner for the ttl, an *ErrLockLost error
+// is returned when the owner doesn't hold the lock anymore.
+func (r *S3Repository) Renew(ctx context.Context, owner string, ttl time.Duration) error {
+	return renewLock(ctx, &s3LockStore{r: r}, r.key+s3LockSuffix, owner, ttl)
+}
+
+// Unlock releases the lock of the state of the owner.
+func (r *S3Repository) Unlock(ctx context.Context, owner string) error {
+	return releaseLock(ctx, &s3LockStore{r: r}, r.key+s3LockSuffix, owner)
+}
+
+// s3LockStore stores the locks in the bucket of the repository
+type s3LockStore struct {
+	r *S3Repository
+}
+
+func (s *s3LockStore) create(ctx context.Context, key string, data []byte) (bool, error) {
+	_, err := s.r.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.r.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		IfNoneMatch: aws.String("*"),
+	})
+	if err != nil {
+		// 412 when the object exists and 409 when it is being created at the same time
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "PreconditionFailed" || apiErr.ErrorCode() == "ConditionalRequestConflict") {
+			return false, nil
+		}
+		return false, fmt.Errorf("s3: error putting S3 object: %w", err)
+	}
+
+	return true, nil
+}
+
+// read returns the object and its ETag as version
+func (s *s3LockStore) read(ctx context.Context, key string) ([]byte, string, error) {
+	resp, err := s.r.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.r.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var nsk *types.NoSuchKey
+		if errors.As(err, &nsk) {
+			return nil, "", errLockNotFound
+		}
+		return nil, "", fmt.Errorf("s3: error getting S3 object: bucket: %s, error: %w", s.r.bucket, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("s3: error reading S3 object: %w", err)
+	}
+
+	return data, aws.ToString(resp.ETag), nil
+}
+
+// replace puts the object only when it still has the ETag that was read
+func (s *s3LockStore) replace(ctx context.Context, key string, data []byte, version string) (bool, error) {
+	_, err := s.r.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:  aws.String(s.r.bucket),
+		Key:     aws.String(key),
+		Body:    bytes.NewReader(data),
+		IfMatch: aws.String(version),
+	})
+	if err != nil {
+		// 412 when the object changed, 404 when it was removed and 409 when it is being changed at the same time
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "PreconditionFailed" || apiErr.ErrorCode() == "NoSuchKey" || apiErr.ErrorCode() == "ConditionalRequestConflict") {
+			return false, nil
+		}
+		return false, fmt.Errorf("s3: error putting S3 object: %w", err)
+	}
+
+	return true, nil
+}
+
+func (s *s3LockStore) remove(ctx context.Context, key string) error {
+	_, err := s.r.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.r.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("s3: error deleting S3 object: %w", err)
+	}
+
 	return nil
 }
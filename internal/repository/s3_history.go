@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pkg/errors"
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+)
+
+// The history of the state is a folder next to the state, with the key of the state and the .history suffix,
+// with a snapshot of every state stored. The version of a snapshot is the UTC time it was stored, so the
+// versions are sorted by name, example: data/state.json.history/20241118T233622.123Z.json
+
+const (
+	// s3HistorySuffix is the suffix of the folder of the history of the state
+	s3HistorySuffix = ".history/"
+
+	// StateVersionFormat is the time format of the versions of the state in the history
+	StateVersionFormat = "20060102T150405.000Z"
+)
+
+// ErrStateVersionInvalid is returned when the version of the state is not a time with the StateVersionFormat format
+var ErrStateVersionInvalid = errors.New("s3: invalid version of the state, the format is " + StateVersionFormat)
+
+// StateVersion is a snapshot of the state in the history of the state.
+type StateVersion struct {
+	Version      string    `json:"version" yaml:"version"`
+	Key          string    `json:"key" yaml:"key"`
+	LastModified time.Time `json:"lastModified" yaml:"lastModified"`
+	Size         int64     `json:"size" yaml:"size"`
+}
+
+// ListStateVersions returns the versions of the state in the history, the newest first.
+func (r *S3Repository) ListStateVersions(ctx context.Context) ([]*StateVersion, error) {
+	prefix := r.key + s3HistorySuffix
+	versions := make([]*StateVersion, 0)
+
+	paginator := s3.NewListObjectsV2Paginator(r.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(r.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("s3: error listing the history of the state: bucket: %s, error: %w", r.bucket, err)
+		}
+
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			version, ok := strings.CutSuffix(strings.TrimPrefix(key, prefix), ".json")
+			if !ok || strings.Contains(version, "/") {
+				continue
+			}
+
+			versions = append(versions, &StateVersion{
+				Version:      version,
+				Key:          key,
+				LastModified: aws.ToTime(obj.LastModified),
+				Size:         aws.ToInt64(obj.Size),
+			})
+		}
+	}
+
+	slices.SortFunc(versions, func(a, b *StateVersion) int { return strings.Compare(b.Version, a.Version) })
+
+	return versions, nil
+}
+
+// GetStateVersion returns the given version of the state from the history, an *ErrStateVersionNotFound
+// error is returned when the history doesn't have it.
+func (r *S3Repository) GetStateVersion(ctx context.Context, version string) (*model.State, error) {
+	if _, err := time.Parse(StateVersionFormat, version); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrStateVersionInvalid, version)
+	}
+
+	resp, err := r.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.versionKey(version)),
+	})
+	if err != nil {
+		var nsk *types.NoSuchKey
+		if errors.As(err, &nsk) {
+			return nil, &ErrStateVersionNotFound{Version: version}
+		}
+		return nil, fmt.Errorf("s3: error getting S3 object: bucket: %s, error: %w", r.bucket, err)
+	}
+	defer resp.Body.Close()
+
+	return r.decodeState(ctx, resp.Body)
+}
+
+// RollbackState replaces the state with the given version of the state from the history,
+// the history is not changed so the rollback can be undone rolling back to a newer version.
+func (r *S3Repository) RollbackState(ctx context.Context, version string) (*model.State, error) {
+	state, err := r.GetStateVersion(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonPayload, err := r.encodeState(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.key),
+		Body:   bytes.NewReader(jsonPayload),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3: error putting S3 object: %w", err)
+	}
+
+	return state, nil
+}
+
+// storeSnapshot stores the state in the history and deletes the snapshots older than the retention.
+func (r *S3Repository) storeSnapshot(ctx context.Context, jsonPayload []byte, now time.Time) error {
+	_, err := r.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.versionKey(now.UTC().Format(StateVersionFormat))),
+		Body:   bytes.NewReader(jsonPayload),
+	})
+	if err != nil {
+		return fmt.Errorf("s3: error putting S3 object: %w", err)
+	}
+
+	versions, err := r.ListStateVersions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range versions[min(r.historyRetention, len(versions)):] {
+		_, err := r.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(r.bucket),
+			Key:    aws.String(v.Key),
+		})
+		if err != nil {
+			return fmt.Errorf("s3: error deleting S3 object: %w", err)
+		}
+		slog.Debug("state version deleted from the history", "version", v.Version)
+	}
+
+	return nil
+}
+
+// versionKey returns the key of the given version of the state in the history
+func (r *S3Repository) versionKey(version string) string {
+	return r.key + s3HistorySuffix + version + ".json"
+}
+
+// ErrStateVersionNotFound, the history of the state doesn't have the version.
+type ErrStateVersionNotFound struct {
+	Version string
+}
+
+func (e *ErrStateVersionNotFound) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorCode(), e.ErrorMessage())
+}
+
+func (e *ErrStateVersionNotFound) ErrorMessage() string {
+	return fmt.Sprintf("the version %s of the state is not in the history", e.Version)
+}
+func (e *ErrStateVersionNotFound) ErrorCode() string { return "ErrStateVersionNotFound" }
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 is an in-memory S3 bucket
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte)}
+}
+
+func (f *fakeS3) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, ok := f.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeS3) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[aws.ToString(params.Key)] = data
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObject(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.objects, aws.ToString(params.Key))
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *fakeS3) ListObjectsV2(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := &s3.ListObjectsV2Output{}
+	for key, data := range f.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			out.Contents = append(out.Contents, types.Object{Key: aws.String(key), Size: aws.Int64(int64(len(data)))})
+		}
+	}
+
+	return out, nil
+}
+
+// historyKeys returns the sorted keys of the history of the state
+func (f *fakeS3) historyKeys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := []string{}
+	for key := range f.objects {
+		if strings.Contains(key, s3HistorySuffix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	return keys
+}
+
+func TestS3Repository_History(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should store a snapshot of the states but not of the checkpoints", func(t *testing.T) {
+		bucket := newFakeS3()
+		repo, err := NewS3Repository(bucket, WithBucket("MyBucket"), WithKey("data/state.json"), WithHistory(5))
+		assert.NoError(t, err)
+
+		assert.NoError(t, repo.SetState(ctx, newTestState("hash-1")))
+		assert.Len(t, bucket.historyKeys(), 1)
+		assert.True(t, strings.HasPrefix(bucket.historyKeys()[0], "data/state.json.history/"))
+
+		checkpoint := newTestState("hash-2")
+		checkpoint.Checkpoint = &model.Checkpoint{Phase: model.CheckpointPhaseGroups}
+		assert.NoError(t, repo.SetState(ctx, checkpoint))
+		assert.Len(t, bucket.historyKeys(), 1)
+	})
+
+	t.Run("Should not store snapshots without history", func(t *testing.T) {
+		bucket := newFakeS3()
+		repo, err := NewS3Repository(bucket, WithBucket("MyBucket"), WithKey("data/state.json"))
+		assert.NoError(t, err)
+
+		assert.NoError(t, repo.SetState(ctx, newTestState("hash-1")))
+		assert.Empty(t, bucket.historyKeys())
+	})
+
+	t.Run("Should keep only the last snapshots", func(t *testing.T) {
+		bucket := newFakeS3()
+		repo, err := NewS3Repository(bucket, WithBucket("MyBucket"), WithKey("data/state.json"), WithHistory(2))
+		assert.NoError(t, err)
+
+		start := time.Date(2024, 11, 18, 23, 36, 22, 0, time.UTC)
+		for i := range 4 {
+			assert.NoError(t, repo.storeSnapshot(ctx, []byte("{}"), start.Add(time.Duration(i)*time.Hour)))
+		}
+
+		versions, err := repo.ListStateVersions(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, versions, 2)
+		assert.Equal(t, "20241119T023622.000Z", versions[0].Version)
+		assert.Equal(t, "20241119T013622.000Z", versions[1].Version)
+	})
+
+	t.Run("Should return a version of the state and roll back to it", func(t *testing.T) {
+		bucket := newFakeS3()
+		repo, err := NewS3Repository(bucket, WithBucket("MyBucket"), WithKey("data/state.json"), WithHistory(5))
+		assert.NoError(t, err)
+
+		assert.NoError(t, repo.SetState(ctx, newTestState("hash-1")))
+		versions, err := repo.ListStateVersions(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, versions, 1)
+
+		// the state stored later is not in the history
+		repoWithoutHistory, err := NewS3Repository(bucket, WithBucket("MyBucket"), WithKey("data/state.json"))
+		assert.NoError(t, err)
+		assert.NoError(t, repoWithoutHistory.SetState(ctx, newTestState("hash-2")))
+
+		state, err := repo.GetStateVersion(ctx, versions[0].Version)
+		assert.NoError(t, err)
+		assert.Equal(t, "hash-1", state.HashCode)
+
+		_, err = repo.RollbackState(ctx, versions[0].Version)
+		assert.NoError(t, err)
+
+		current, err := repo.GetState(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "hash-1", current.HashCode)
+	})
+
+	t.Run("Should return ErrStateVersionNotFound when the version is not in the history", func(t *testing.T) {
+		repo, err := NewS3Repository(newFakeS3(), WithBucket("MyBucket"), WithKey("data/state.json"))
+		assert.NoError(t, err)
+
+		var notFound *ErrStateVersionNotFound
+		_, err = repo.GetStateVersion(ctx, "20241118T233622.000Z")
+		assert.ErrorAs(t, err, &notFound)
+
+		_, err = repo.RollbackState(ctx, "20241118T233622.000Z")
+		assert.ErrorAs(t, err, &notFound)
+	})
+
+	t.Run("Should return ErrStateVersionInvalid when the version is not valid", func(t *testing.T) {
+		repo, err := NewS3Repository(newFakeS3(), WithBucket("MyBucket"), WithKey("data/state.json"))
+		assert.NoError(t, err)
+
+		_, err = repo.GetStateVersion(ctx, "../state")
+		assert.ErrorIs(t, err, ErrStateVersionInvalid)
+	})
+}
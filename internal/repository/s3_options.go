@@ -17,3 +17,19 @@ func WithKey(key string) S3RepositoryOption {
 		r.key = key
 	}
 }
+
+// WithHistory keeps a snapshot of every state stored, except the checkpoints, in the history of the state,
+// only the last retention snapshots are kept. Zero or less doesn't store snapshots.
+func WithHistory(retention int) S3RepositoryOption {
+	return func(r *S3Repository) {
+		r.historyRetention = max(retention, 0)
+	}
+}
+
+// WithEncryption encrypts the state and its history with the envelope, the states stored in plaintext
+// before are still read. Without it the encrypted states cannot be read.
+func WithEncryption(envelope *Envelope) S3RepositoryOption {
+	return func(r *S3Repository) {
+		r.envelope = envelope
+	}
+}
@@ -61,7 +61,7 @@ func TestGetState(t *testing.T) {
 		mockS3Repository := mocks.NewMockS3ClientAPI(mockCtrl)
 
 		sObj := model.State{
-			SchemaVersion: "1.0.0",
+			SchemaVersion: model.StateSchemaVersion,
 			CodeVersion:   "0.0.1",
 			LastSync:      "2020-01-01T00:00:00Z",
 			HashCode:      "123456789",
@@ -90,7 +90,7 @@ func TestGetState(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NotNil(t, state)
 
-		assert.Equal(t, "1.0.0", state.SchemaVersion)
+		assert.Equal(t, model.StateSchemaVersion, state.SchemaVersion)
 		assert.Equal(t, "0.0.1", state.CodeVersion)
 		assert.Equal(t, "2020-01-01T00:00:00Z", state.LastSync)
 		assert.Equal(t, "123456789", state.HashCode)
@@ -151,7 +151,7 @@ func TestS3SetState(t *testing.T) {
 		mockS3Repository := mocks.NewMockS3ClientAPI(mockCtrl)
 
 		sObj := &model.State{
-			SchemaVersion: "1.0.0",
+			SchemaVersion: model.StateSchemaVersion,
 			CodeVersion:   "0.0.1",
 			LastSync:      "2020-01-01T00:00:00Z",
 			HashCode:      "123456789",
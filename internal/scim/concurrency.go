@@ -0,0 +1,49 @@
+package scim
+
+import "golang.org/x/time/rate"
+
+// DefaultConcurrency is the default number of resources written at the same time in the SCIM Provider.
+const DefaultConcurrency = 1
+
+// ProviderOption is a function that can be used to configure the Provider
+// following the Option pattern.
+type ProviderOption func(*Provider)
+
+// WithConcurrency is a ProviderOption that can be used to write up to n resources
+// (users or groups members) at the same time in the SCIM Provider, less than 1 is 1.
+func WithConcurrency(n int) ProviderOption {
+	return func(p *Provider) {
+		p.concurrency = max(n, 1)
+	}
+}
+
+// WithRateLimit is a ProviderOption that can be used to limit the requests per second sent
+// to the SCIM Provider by the write methods, the burst is the concurrency. 0 or less means no limit.
+func WithRateLimit(requestsPerSecond float64) ProviderOption {
+	return func(p *Provider) {
+		p.rateLimit = requestsPerSecond
+	}
+}
+
+// newLimiter returns the rate limiter of the writes with the concurrency as burst,
+// a rate of 0 or less is no limit.
+func newLimiter(requestsPerSecond float64, burst int) *rate.Limiter {
+	if requestsPerSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, max(burst, 1))
+	}
+
+	return rate.NewLimiter(rate.Limit(requestsPerSecond), max(burst, 1))
+}
+
+// succeeded returns the resources written by the workers, the resources that failed are nil
+// and they are left out keeping the order of the others.
+func succeeded[T any](resources []*T) []*T {
+	written := make([]*T, 0, len(resources))
+	for _, r := range resources {
+		if r != nil {
+			written = append(written, r)
+		}
+	}
+
+	return written
+}
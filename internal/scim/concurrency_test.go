@@ -0,0 +1,215 @@
+package scim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/scim"
+	"github.com/slashdevops/idp-scim-sync/pkg/aws"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/time/rate"
+)
+
+func TestNewLimiter(t *testing.T) {
+	t.Run("0 or less is no limit", func(t *testing.T) {
+		l := newLimiter(0, 10)
+		assert.Equal(t, rate.Inf, l.Limit())
+		assert.Equal(t, 10, l.Burst())
+	})
+
+	t.Run("should use the rate and the concurrency as burst", func(t *testing.T) {
+		l := newLimiter(10, 0)
+		assert.Equal(t, rate.Limit(10), l.Limit())
+		assert.Equal(t, 1, l.Burst())
+	})
+
+	t.Run("should return the context error when the context is done", func(t *testing.T) {
+		l := newLimiter(0.001, 1)
+		assert.NoError(t, l.Wait(context.TODO()))
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+		defer cancel()
+
+		assert.Error(t, l.Wait(ctx))
+	})
+}
+
+func TestProviderConcurrency(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	newUsers := func(n int) *model.UsersResult {
+		users := make([]*model.User, n)
+		for i := range n {
+			users[i] = &model.User{
+				IPID:        fmt.Sprintf("%d", i),
+				SCIMID:      fmt.Sprintf("%d", i),
+				Name:        &model.Name{FamilyName: fmt.Sprintf("%d", i), GivenName: "user"},
+				DisplayName: fmt.Sprintf("user %d", i),
+				Emails:      []model.Email{{Value: fmt.Sprintf("user.%d@mail.com", i), Type: "work", Primary: true}},
+				Active:      true,
+			}
+		}
+		return model.UsersResultBuilder().WithResources(users).Build()
+	}
+
+	t.Run("CreateUsers should keep the order of the users", func(t *testing.T) {
+		mockSCIM := mocks.NewMockAWSSCIMProvider(mockCtrl)
+		ctx := context.TODO()
+
+		mockSCIM.EXPECT().CreateOrGetUser(ctx, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, cur *aws.CreateUserRequest) (*aws.CreateUserResponse, error) {
+				return &aws.CreateUserResponse{ID: "scim-" + cur.ExternalID}, nil
+			},
+		).Times(10)
+
+		svc, err := NewProvider(mockSCIM, WithConcurrency(4), WithRateLimit(1000))
+		assert.NoError(t, err)
+
+		got, err := svc.CreateUsers(ctx, newUsers(10))
+		assert.NoError(t, err)
+		assert.Equal(t, 10, got.Items)
+		for i, user := range got.Resources {
+			assert.Equal(t, fmt.Sprintf("scim-%d", i), user.SCIMID)
+		}
+	})
+
+	t.Run("CreateUsers should return the users created with the errors of the others", func(t *testing.T) {
+		mockSCIM := mocks.NewMockAWSSCIMProvider(mockCtrl)
+		ctx := context.TODO()
+		errCreate := errors.New("create error")
+
+		mockSCIM.EXPECT().CreateOrGetUser(ctx, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, cur *aws.CreateUserRequest) (*aws.CreateUserResponse, error) {
+				if cur.ExternalID == "1" || cur.ExternalID == "3" {
+					return nil, errCreate
+				}
+				return &aws.CreateUserResponse{ID: "scim-" + cur.ExternalID}, nil
+			},
+		).Times(5)
+
+		svc, err := NewProvider(mockSCIM, WithConcurrency(2))
+		assert.NoError(t, err)
+
+		got, err := svc.CreateUsers(ctx, newUsers(5))
+		assert.ErrorIs(t, err, errCreate)
+		assert.Equal(t, "scim: error creating user: user.1@mail.com, create error\nscim: error creating user: user.3@mail.com, create error", err.Error())
+		assert.Equal(t, 3, got.Items)
+		assert.Equal(t, "scim-0", got.Resources[0].SCIMID)
+		assert.Equal(t, "scim-2", got.Resources[1].SCIMID)
+		assert.Equal(t, "scim-4", got.Resources[2].SCIMID)
+	})
+
+	t.Run("UpdateUsers should return the users updated with the errors of the others", func(t *testing.T) {
+		mockSCIM := mocks.NewMockAWSSCIMProvider(mockCtrl)
+		ctx := context.TODO()
+		errPut := errors.New("put error")
+
+		mockSCIM.EXPECT().PutUser(ctx, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, pur *aws.PutUserRequest) (*aws.PutUserResponse, error) {
+				if pur.ID == "2" {
+					return nil, errPut
+				}
+				return &aws.PutUserResponse{ID: pur.ID}, nil
+			},
+		).Times(4)
+
+		svc, err := NewProvider(mockSCIM, WithConcurrency(3))
+		assert.NoError(t, err)
+
+		got, err := svc.UpdateUsers(ctx, newUsers(4))
+		assert.ErrorIs(t, err, errPut)
+		assert.Equal(t, 3, got.Items)
+		assert.Equal(t, []string{"0", "1", "3"}, []string{got.Resources[0].SCIMID, got.Resources[1].SCIMID, got.Resources[2].SCIMID})
+	})
+
+	t.Run("CreateGroupsMembers should return the groups members added with the errors of the others", func(t *testing.T) {
+		mockSCIM := mocks.NewMockAWSSCIMProvider(mockCtrl)
+		ctx := context.TODO()
+		errPatch := errors.New("patch error")
+
+		gmr := make([]*model.GroupMembers, 3)
+		for i := range gmr {
+			gmr[i] = &model.GroupMembers{
+				Group:     &model.Group{SCIMID: fmt.Sprintf("%d", i), Name: fmt.Sprintf("group %d", i)},
+				Resources: groupMembersGenerator(2, true, true),
+			}
+		}
+
+		mockSCIM.EXPECT().PatchGroup(ctx, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, pgr *aws.PatchGroupRequest) error {
+				if pgr.Group.ID == "1" {
+					return errPatch
+				}
+				return nil
+			},
+		).Times(3)
+
+		svc, err := NewProvider(mockSCIM, WithConcurrency(2))
+		assert.NoError(t, err)
+
+		got, err := svc.CreateGroupsMembers(ctx, model.GroupsMembersResultBuilder().WithResources(gmr).Build())
+		assert.ErrorIs(t, err, errPatch)
+		assert.Equal(t, 2, got.Items)
+		assert.Equal(t, "group 0", got.Resources[0].Group.Name)
+		assert.Equal(t, "group 2", got.Resources[1].Group.Name)
+	})
+
+	t.Run("DeleteUsers should delete all the users and aggregate the errors", func(t *testing.T) {
+		mockSCIM := mocks.NewMockAWSSCIMProvider(mockCtrl)
+		ctx := context.TODO()
+		errDelete := errors.New("delete error")
+
+		mockSCIM.EXPECT().DeleteUser(ctx, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, id string) error {
+				if id == "2" || id == "5" {
+					return errDelete
+				}
+				return nil
+			},
+		).Times(8)
+
+		svc, err := NewProvider(mockSCIM, WithConcurrency(3))
+		assert.NoError(t, err)
+
+		err = svc.DeleteUsers(ctx, newUsers(8))
+		assert.Error(t, err)
+		assert.ErrorIs(t, err, errDelete)
+		assert.Equal(t, "scim: error deleting user: 2, delete error\nscim: error deleting user: 5, delete error", err.Error())
+	})
+
+	t.Run("DeleteGroupsMembers should patch all the groups", func(t *testing.T) {
+		mockSCIM := mocks.NewMockAWSSCIMProvider(mockCtrl)
+		ctx := context.TODO()
+
+		gmr := make([]*model.GroupMembers, 5)
+		for i := range gmr {
+			gmr[i] = &model.GroupMembers{
+				Group:     &model.Group{SCIMID: fmt.Sprintf("%d", i), Name: fmt.Sprintf("group %d", i)},
+				Resources: groupMembersGenerator(3, true, true),
+			}
+		}
+
+		mockSCIM.EXPECT().PatchGroup(ctx, gomock.Any()).Return(nil).Times(5)
+
+		svc, err := NewProvider(mockSCIM, WithConcurrency(2))
+		assert.NoError(t, err)
+
+		err = svc.DeleteGroupsMembers(ctx, model.GroupsMembersResultBuilder().WithResources(gmr).Build())
+		assert.NoError(t, err)
+	})
+
+	t.Run("WithConcurrency less than 1 is 1", func(t *testing.T) {
+		mockSCIM := mocks.NewMockAWSSCIMProvider(mockCtrl)
+
+		svc, err := NewProvider(mockSCIM, WithConcurrency(0))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, svc.concurrency)
+		assert.Equal(t, rate.Inf, svc.limiter.Limit())
+	})
+}
@@ -0,0 +1,537 @@
+package scim
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	scimv2 "github.com/slashdevops/idp-scim-sync/pkg/scim"
+)
+
+// This implement core.SCIMService interface for any SCIM 2.0 service provider
+
+//go:generate go run go.uber.org/mock/mockgen@v0.5.0 -package=mocks -destination=../../mocks/scim/generic_mocks.go -source=generic.go GenericSCIMService
+
+// GenericSCIMService interface to consume pkg/scim package methods
+type GenericSCIMService interface {
+	// Profile returns the quirks of the SCIM service provider
+	Profile() scimv2.Profile
+
+	// ListUsers lists users in SCIM Provider
+	ListUsers(ctx context.Context, filter string) ([]*scimv2.User, error)
+
+	// GetUser gets a user in SCIM Provider
+	GetUser(ctx context.Context, id string) (*scimv2.User, error)
+
+	// GetUserByUserName gets a user in SCIM Provider
+	GetUserByUserName(ctx context.Context, userName string) (*scimv2.User, error)
+
+	// CreateOrGetUser creates a user in SCIM Provider
+	CreateOrGetUser(ctx context.Context, user *scimv2.User) (*scimv2.User, error)
+
+	// ReplaceUser updates a user in SCIM Provider
+	ReplaceUser(ctx context.Context, user *scimv2.User) (*scimv2.User, error)
+
+	// DeleteUser deletes a user in SCIM Provider
+	DeleteUser(ctx context.Context, id string) error
+
+	// ListGroups lists groups in SCIM Provider
+	ListGroups(ctx context.Context, filter string) ([]*scimv2.Group, error)
+
+	// GetGroup gets a group and its members in SCIM Provider
+	GetGroup(ctx context.Context, id string) (*scimv2.Group, error)
+
+	// CreateOrGetGroup creates a group in SCIM Provider
+	CreateOrGetGroup(ctx context.Context, group *scimv2.Group) (*scimv2.Group, error)
+
+	// ReplaceGroup replaces a group and its members in SCIM Provider
+	ReplaceGroup(ctx context.Context, group *scimv2.Group) (*scimv2.Group, error)
+
+	// PatchGroup patches a group in SCIM Provider
+	PatchGroup(ctx context.Context, id string, operations ...*scimv2.Operation) error
+
+	// DeleteGroup deletes a group in SCIM Provider
+	DeleteGroup(ctx context.Context, id string) error
+}
+
+// ErrGenericSCIMServiceNil is returned when the GenericSCIMService is nil
+var ErrGenericSCIMServiceNil = fmt.Errorf("scim: generic SCIM service is nil")
+
+// GenericProvider represents a SCIM 2.0 provider, unlike the AWS SSO provider it sends all the
+// attributes the service provider supports and reads the groups members from the groups resources.
+type GenericProvider struct {
+	scim GenericSCIMService
+}
+
+// NewGenericProvider creates a new SCIM 2.0 provider
+func NewGenericProvider(scim GenericSCIMService) (*GenericProvider, error) {
+	if scim == nil {
+		return nil, ErrGenericSCIMServiceNil
+	}
+
+	return &GenericProvider{scim: scim}, nil
+}
+
+// GetGroups returns groups from SCIM Provider
+func (s *GenericProvider) GetGroups(ctx context.Context) (*model.GroupsResult, error) {
+	groupsResponse, err := s.scim.ListGroups(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("scim: error listing groups: %w", err)
+	}
+
+	groups := make([]*model.Group, len(groupsResponse))
+	for i, group := range groupsResponse {
+		groups[i] = model.GroupBuilder().
+			WithSCIMID(group.ID).
+			WithName(group.DisplayName).
+			WithIPID(group.ExternalID).
+			Build()
+	}
+
+	groupsResult := model.GroupsResultBuilder().WithResources(groups).Build()
+	slog.Debug("scim: generic GetGroups()", "groups", len(groups))
+
+	return groupsResult, nil
+}
+
+// CreateGroups creates groups in SCIM Provider
+func (s *GenericProvider) CreateGroups(ctx context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+	if gr == nil {
+		return nil, fmt.Errorf("scim: error creating groups, groups result is nil")
+	}
+
+	groups := make([]*model.Group, len(gr.Resources))
+
+	for i, group := range gr.Resources {
+		slog.Warn("creating group", "group", group.Name)
+
+		r, err := s.scim.CreateOrGetGroup(ctx, &scimv2.Group{DisplayName: group.Name, ExternalID: group.IPID})
+		if err != nil {
+			return nil, fmt.Errorf("scim: error creating group: %w", err)
+		}
+
+		groups[i] = model.GroupBuilder().
+			WithSCIMID(r.ID).
+			WithName(group.Name).
+			WithIPID(group.IPID).
+			WithEmail(group.Email).
+			WithOrigin(group.Origin).
+			Build()
+	}
+
+	groupsResult := model.GroupsResultBuilder().WithResources(groups).Build()
+	slog.Debug("scim: generic CreateGroups()", "groups", len(groups))
+
+	return groupsResult, nil
+}
+
+// UpdateGroups updates groups in SCIM Provider, when the service provider doesn't support
+// PATCH the group is replaced keeping its members
+func (s *GenericProvider) UpdateGroups(ctx context.Context, gr *model.GroupsResult) (*model.GroupsResult, error) {
+	groups := make([]*model.Group, len(gr.Resources))
+
+	for i, group := range gr.Resources {
+		slog.Warn("updating group", "group", group.Name, "email", group.Email)
+
+		if s.scim.Profile().PatchSupported {
+			op := &scimv2.Operation{
+				OP: "replace",
+				Value: map[string]string{
+					"displayName": group.Name,
+					"externalId":  group.IPID,
+				},
+			}
+
+			if err := s.scim.PatchGroup(ctx, group.SCIMID, op); err != nil {
+				return nil, fmt.Errorf("scim: error updating groups: %w", err)
+			}
+		} else {
+			current, err := s.scim.GetGroup(ctx, group.SCIMID)
+			if err != nil {
+				return nil, fmt.Errorf("scim: error getting group: %w", err)
+			}
+
+			current.DisplayName = group.Name
+			current.ExternalID = group.IPID
+
+			if _, err := s.scim.ReplaceGroup(ctx, current); err != nil {
+				return nil, fmt.Errorf("scim: error updating groups: %w", err)
+			}
+		}
+
+		// return the same group
+		groups[i] = model.GroupBuilder().
+			WithSCIMID(group.SCIMID).
+			WithName(group.Name).
+			WithIPID(group.IPID).
+			WithEmail(group.Email).
+			WithOrigin(group.Origin).
+			Build()
+	}
+
+	groupsResult := model.GroupsResultBuilder().WithResources(groups).Build()
+	slog.Debug("scim: generic UpdateGroups()", "groups", len(groups))
+
+	return groupsResult, nil
+}
+
+// DeleteGroups deletes groups in SCIM Provider
+func (s *GenericProvider) DeleteGroups(ctx context.Context, gr *model.GroupsResult) error {
+	for _, group := range gr.Resources {
+		slog.Warn("deleting group", "group", group.Name, "email", group.Email)
+
+		if err := s.scim.DeleteGroup(ctx, group.SCIMID); err != nil {
+			return fmt.Errorf("scim: error deleting group: %s, %w", group.SCIMID, err)
+		}
+	}
+
+	return nil
+}
+
+// GetUsers returns users from SCIM Provider
+func (s *GenericProvider) GetUsers(ctx context.Context) (*model.UsersResult, error) {
+	usersResponse, err := s.scim.ListUsers(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("scim: error listing users: %w", err)
+	}
+
+	users := make([]*model.User, 0, len(usersResponse))
+	for _, user := range usersResponse {
+		if u := buildGenericUser(user); u != nil {
+			users = append(users, u)
+		}
+	}
+
+	usersResult := model.UsersResultBuilder().WithResources(users).Build()
+	slog.Debug("scim: generic GetUsers()", "users", len(users))
+
+	return usersResult, nil
+}
+
+// CreateUsers creates users in SCIM Provider
+func (s *GenericProvider) CreateUsers(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+	users := make([]*model.User, len(ur.Resources))
+
+	for i, user := range ur.Resources {
+		slog.Warn("creating user", "user", user.DisplayName, "email", user.GetPrimaryEmailAddress())
+
+		r, err := s.scim.CreateOrGetUser(ctx, buildGenericUserRequest(user))
+		if err != nil {
+			return nil, fmt.Errorf("scim: error creating user: %w", err)
+		}
+
+		user.SCIMID = r.ID
+		user.SetHashCode()
+
+		users[i] = user
+	}
+
+	usersResult := model.UsersResultBuilder().WithResources(users).Build()
+	slog.Debug("scim: generic CreateUsers()", "users", len(users))
+
+	return usersResult, nil
+}
+
+// UpdateUsers updates users in SCIM Provider given a list of users
+func (s *GenericProvider) UpdateUsers(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
+	users := make([]*model.User, len(ur.Resources))
+
+	for i, user := range ur.Resources {
+		if user.SCIMID == "" {
+			return nil, fmt.Errorf("scim: error updating user, user ID is empty: %s", user.UserName)
+		}
+
+		slog.Warn("updating user", "user", user.DisplayName, "email", user.GetPrimaryEmailAddress())
+
+		r, err := s.scim.ReplaceUser(ctx, buildGenericUserRequest(user))
+		if err != nil {
+			return nil, fmt.Errorf("scim: error updating user: %w", err)
+		}
+
+		// some service providers return an empty body
+		if r.ID != "" {
+			user.SCIMID = r.ID
+		}
+		user.SetHashCode()
+
+		users[i] = user
+	}
+
+	usersResult := model.UsersResultBuilder().WithResources(users).Build()
+	slog.Debug("scim: generic UpdateUsers()", "users", len(users))
+
+	return usersResult, nil
+}
+
+// DeleteUsers deletes users in SCIM Provider given a list of users
+func (s *GenericProvider) DeleteUsers(ctx context.Context, ur *model.UsersResult) error {
+	for _, user := range ur.Resources {
+		slog.Warn("deleting user", "user", user.DisplayName, "email", user.GetPrimaryEmailAddress())
+
+		if err := s.scim.DeleteUser(ctx, user.SCIMID); err != nil {
+			return fmt.Errorf("scim: error deleting user: %s, %w", user.SCIMID, err)
+		}
+	}
+
+	return nil
+}
+
+// CreateGroupsMembers creates groups members in SCIM Provider given a list of groups members
+func (s *GenericProvider) CreateGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
+	groupsMembers := make([]*model.GroupMembers, len(gmr.Resources))
+
+	for i, groupMembers := range gmr.Resources {
+		members := make([]*model.Member, len(groupMembers.Resources))
+		ids := make([]string, len(groupMembers.Resources))
+
+		for j, member := range groupMembers.Resources {
+			if member.SCIMID == "" {
+				u, err := s.scim.GetUserByUserName(ctx, member.Email)
+				if err != nil {
+					return nil, fmt.Errorf("scim: error getting user by email: %w", err)
+				}
+				member.SCIMID = u.ID
+			}
+			ids[j] = member.SCIMID
+
+			slog.Warn("adding member to group", "group", groupMembers.Group.Name, "email", member.Email)
+
+			members[j] = model.MemberBuilder().
+				WithIPID(member.IPID).
+				WithSCIMID(member.SCIMID).
+				WithEmail(member.Email).
+				WithStatus(member.Status).
+				Build()
+		}
+
+		if err := s.changeGroupMembers(ctx, groupMembers.Group, "add", ids); err != nil {
+			return nil, err
+		}
+
+		groupsMembers[i] = model.GroupMembersBuilder().
+			WithGroup(groupMembers.Group).
+			WithResources(members).
+			Build()
+	}
+
+	groupsMembersResult := model.GroupsMembersResultBuilder().WithResources(groupsMembers).Build()
+	slog.Debug("scim: generic CreateGroupsMembers()", "groups_members", len(groupsMembers))
+
+	return groupsMembersResult, nil
+}
+
+// DeleteGroupsMembers deletes groups members in SCIM Provider given a list of groups members
+func (s *GenericProvider) DeleteGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) error {
+	for _, groupMembers := range gmr.Resources {
+		ids := make([]string, len(groupMembers.Resources))
+
+		for j, member := range groupMembers.Resources {
+			ids[j] = member.SCIMID
+			slog.Warn("removing member from group", "group", groupMembers.Group.Name, "email", member.Email)
+		}
+
+		if err := s.changeGroupMembers(ctx, groupMembers.Group, "remove", ids); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// changeGroupMembers adds or removes the members of the group, using PATCH requests with
+// a maximum of members per request, or replacing the group when PATCH is not supported
+func (s *GenericProvider) changeGroupMembers(ctx context.Context, group *model.Group, op string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	profile := s.scim.Profile()
+
+	if !profile.PatchSupported {
+		current, err := s.scim.GetGroup(ctx, group.SCIMID)
+		if err != nil {
+			return fmt.Errorf("scim: error getting group: %w", err)
+		}
+
+		current.Members = replaceMembers(current.Members, op, ids)
+
+		if _, err := s.scim.ReplaceGroup(ctx, current); err != nil {
+			return fmt.Errorf("scim: error replacing group: %w", err)
+		}
+
+		return nil
+	}
+
+	requests := 0
+	for i := 0; i < len(ids); i += profile.MaxMembersPerPatch {
+		end := min(i+profile.MaxMembersPerPatch, len(ids))
+
+		var operations []*scimv2.Operation
+		if op == "add" {
+			values := make([]*scimv2.Member, 0, end-i)
+			for _, id := range ids[i:end] {
+				values = append(values, &scimv2.Member{Value: id})
+			}
+			operations = []*scimv2.Operation{{OP: op, Path: "members", Value: values}}
+		} else {
+			// reference: https://datatracker.ietf.org/doc/html/rfc7644#section-3.5.2.2
+			for _, id := range ids[i:end] {
+				operations = append(operations, &scimv2.Operation{OP: op, Path: "members[value eq " + strconv.Quote(id) + "]"})
+			}
+		}
+
+		if err := s.scim.PatchGroup(ctx, group.SCIMID, operations...); err != nil {
+			return fmt.Errorf("scim: error patching group: %w", err)
+		}
+		requests++
+	}
+
+	if requests > 1 {
+		slog.Warn("group with more than 'max_members_per_request' members, sent multiple requests",
+			"max_members_per_request", profile.MaxMembersPerPatch,
+			"group", group.Name,
+			"members", len(ids),
+			"requests", requests,
+		)
+	}
+
+	return nil
+}
+
+// GetGroupsMembers returns a list of groups and their members from the SCIM Provider,
+// every member is requested to get its email
+func (s *GenericProvider) GetGroupsMembers(ctx context.Context, gr *model.GroupsResult) (*model.GroupsMembersResult, error) {
+	users := make(map[string]*scimv2.User)
+
+	gmr, err := s.groupsMembers(ctx, gr, func(member *scimv2.Member) (*model.Member, error) {
+		u, ok := users[member.Value]
+		if !ok {
+			var err error
+			u, err = s.scim.GetUser(ctx, member.Value)
+			if err != nil {
+				return nil, fmt.Errorf("scim: error getting user: %s, error %w", member.Value, err)
+			}
+			users[member.Value] = u
+		}
+
+		return buildGenericMember(u), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("scim: generic GetGroupsMembers()", "groups_members", gmr.Items)
+
+	return gmr, nil
+}
+
+// GetGroupsMembersBruteForce returns a list of groups and their members from the SCIM Provider,
+// the members of the groups are matched with the given users instead of probing every user
+// because the SCIM 2.0 service providers return the members of the groups
+func (s *GenericProvider) GetGroupsMembersBruteForce(ctx context.Context, gr *model.GroupsResult, ur *model.UsersResult) (*model.GroupsMembersResult, error) {
+	users := make(map[string]*model.User, len(ur.Resources))
+	for _, user := range ur.Resources {
+		users[user.SCIMID] = user
+	}
+
+	gmr, err := s.groupsMembers(ctx, gr, func(member *scimv2.Member) (*model.Member, error) {
+		user, ok := users[member.Value]
+		if !ok {
+			return nil, nil
+		}
+
+		m := model.MemberBuilder().
+			WithIPID(user.IPID).
+			WithSCIMID(user.SCIMID).
+			WithEmail(user.GetPrimaryEmailAddress()).
+			Build()
+
+		if user.Active {
+			m.Status = "ACTIVE"
+		}
+
+		return m, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("scim: generic GetGroupsMembersBruteForce()", "groups_members", gmr.Items)
+
+	return gmr, nil
+}
+
+// groupsMembers returns the groups and their members converted with the given function,
+// the members converted to nil are avoided
+func (s *GenericProvider) groupsMembers(ctx context.Context, gr *model.GroupsResult, toMember func(*scimv2.Member) (*model.Member, error)) (*model.GroupsMembersResult, error) {
+	var listed map[string]*scimv2.Group
+	if s.scim.Profile().GroupMembersInList {
+		groups, err := s.scim.ListGroups(ctx, "")
+		if err != nil {
+			return nil, fmt.Errorf("scim: error listing groups: %w", err)
+		}
+
+		listed = make(map[string]*scimv2.Group, len(groups))
+		for _, group := range groups {
+			listed[group.ID] = group
+		}
+	}
+
+	groupMembers := make([]*model.GroupMembers, len(gr.Resources))
+
+	for i, group := range gr.Resources {
+		scimGroup, ok := listed[group.SCIMID]
+		if !ok {
+			var err error
+			scimGroup, err = s.scim.GetGroup(ctx, group.SCIMID)
+			if err != nil {
+				return nil, fmt.Errorf("scim: error getting group: %w", err)
+			}
+		}
+
+		members := make([]*model.Member, 0, len(scimGroup.Members))
+		for _, member := range scimGroup.Members {
+			m, err := toMember(member)
+			if err != nil {
+				return nil, err
+			}
+			if m != nil {
+				members = append(members, m)
+			}
+		}
+
+		groupMembers[i] = model.GroupMembersBuilder().
+			WithGroup(group).
+			WithResources(members).
+			Build()
+	}
+
+	return model.GroupsMembersResultBuilder().WithResources(groupMembers).Build(), nil
+}
+
+// replaceMembers returns the members after adding or removing the members with the given ids
+func replaceMembers(members []*scimv2.Member, op string, ids []string) []*scimv2.Member {
+	changed := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		changed[id] = struct{}{}
+	}
+
+	replaced := make([]*scimv2.Member, 0, len(members)+len(ids))
+	for _, member := range members {
+		if _, ok := changed[member.Value]; ok {
+			// removed, or added below
+			continue
+		}
+		replaced = append(replaced, &scimv2.Member{Value: member.Value})
+	}
+
+	if op == "add" {
+		for _, id := range ids {
+			replaced = append(replaced, &scimv2.Member{Value: id})
+		}
+	}
+
+	return replaced
+}
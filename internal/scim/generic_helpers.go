@@ -0,0 +1,218 @@
+package scim
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	scimv2 "github.com/slashdevops/idp-scim-sync/pkg/scim"
+)
+
+// buildGenericUser creates a User model from a SCIM 2.0 user, all the emails, addresses
+// and phone numbers are kept
+func buildGenericUser(user *scimv2.User) *model.User {
+	if user == nil {
+		return nil
+	}
+
+	if user.ID == "" {
+		slog.Warn("scim: User ID is empty")
+		return nil
+	}
+
+	if user.Name == nil || user.Name.GivenName == "" || user.Name.FamilyName == "" {
+		slog.Warn("scim: User name is incomplete", "user", user.UserName)
+		return nil
+	}
+
+	if len(user.Emails) == 0 {
+		slog.Warn("scim: User emails is empty", "user", user.UserName)
+		return nil
+	}
+
+	emails := make([]model.Email, 0, len(user.Emails))
+	for _, email := range user.Emails {
+		emails = append(emails,
+			model.EmailBuilder().
+				WithPrimary(email.Primary).
+				WithType(strings.TrimSpace(email.Type)).
+				WithValue(strings.TrimSpace(email.Value)).
+				Build(),
+		)
+	}
+
+	var addresses []model.Address
+	for _, address := range user.Addresses {
+		addresses = append(addresses,
+			model.AddressBuilder().
+				WithFormatted(strings.TrimSpace(address.Formatted)).
+				WithStreetAddress(address.StreetAddress).
+				WithLocality(address.Locality).
+				WithRegion(address.Region).
+				WithPostalCode(address.PostalCode).
+				WithCountry(address.Country).
+				Build(),
+		)
+	}
+
+	var phoneNumbers []model.PhoneNumber
+	for _, phoneNumber := range user.PhoneNumbers {
+		phoneNumbers = append(phoneNumbers,
+			model.PhoneNumberBuilder().
+				WithValue(strings.TrimSpace(phoneNumber.Value)).
+				WithType(strings.TrimSpace(phoneNumber.Type)).
+				Build(),
+		)
+	}
+
+	var enterpriseData *model.EnterpriseData
+	if user.EnterpriseUser != nil {
+		var manager *model.Manager
+		if user.EnterpriseUser.Manager != nil {
+			manager = model.ManagerBuilder().
+				WithValue(strings.TrimSpace(user.EnterpriseUser.Manager.Value)).
+				WithRef(strings.TrimSpace(user.EnterpriseUser.Manager.Ref)).
+				Build()
+		}
+
+		enterpriseData = model.EnterpriseDataBuilder().
+			WithEmployeeNumber(strings.TrimSpace(user.EnterpriseUser.EmployeeNumber)).
+			WithCostCenter(strings.TrimSpace(user.EnterpriseUser.CostCenter)).
+			WithOrganization(strings.TrimSpace(user.EnterpriseUser.Organization)).
+			WithDivision(strings.TrimSpace(user.EnterpriseUser.Division)).
+			WithDepartment(strings.TrimSpace(user.EnterpriseUser.Department)).
+			WithManager(manager).
+			Build()
+	}
+
+	name := model.NameBuilder().
+		WithGivenName(strings.TrimSpace(user.Name.GivenName)).
+		WithFamilyName(strings.TrimSpace(user.Name.FamilyName)).
+		WithFormatted(strings.TrimSpace(user.Name.Formatted)).
+		WithMiddleName(user.Name.MiddleName).
+		WithHonorificPrefix(user.Name.HonorificPrefix).
+		WithHonorificSuffix(user.Name.HonorificSuffix).
+		Build()
+
+	userModel := model.UserBuilder().
+		WithIPID(strings.TrimSpace(user.ExternalID)).
+		WithSCIMID(strings.TrimSpace(user.ID)).
+		WithUserName(strings.TrimSpace(user.UserName)).
+		WithDisplayName(strings.TrimSpace(user.DisplayName)).
+		WithNickName(user.Name.GivenName, user.Name.FamilyName).
+		WithTitle(strings.TrimSpace(user.Title)).
+		WithUserType(strings.TrimSpace(user.UserType)).
+		WithPreferredLanguage(strings.TrimSpace(user.PreferredLanguage)).
+		WithLocale(strings.TrimSpace(user.Locale)).
+		WithTimezone(strings.TrimSpace(user.Timezone)).
+		WithActive(user.IsActive()).
+		// Arrays
+		WithEmails(emails).
+		WithAddresses(addresses).
+		WithPhoneNumbers(phoneNumbers).
+		// Pointers
+		WithName(name).
+		WithEnterpriseData(enterpriseData).
+		Build()
+
+	slog.Debug("scim: buildGenericUser() converted user", "from", user, "to", userModel)
+
+	return userModel
+}
+
+// buildGenericUserRequest builds a SCIM 2.0 user from a User model, the attributes not
+// supported by the service provider are removed by the pkg/scim client using its profile
+func buildGenericUserRequest(user *model.User) *scimv2.User {
+	if user == nil {
+		return nil
+	}
+
+	active := user.Active
+	userRequest := &scimv2.User{
+		ID:                user.SCIMID,
+		ExternalID:        user.IPID,
+		UserName:          user.UserName,
+		DisplayName:       user.DisplayName,
+		NickName:          user.NickName,
+		ProfileURL:        user.ProfileURL,
+		UserType:          user.UserType,
+		Title:             user.Title,
+		PreferredLanguage: user.PreferredLanguage,
+		Locale:            user.Locale,
+		Timezone:          user.Timezone,
+		Active:            &active,
+	}
+
+	if user.Name != nil {
+		userRequest.Name = &scimv2.Name{
+			FamilyName:      user.Name.FamilyName,
+			GivenName:       user.Name.GivenName,
+			Formatted:       user.Name.Formatted,
+			MiddleName:      user.Name.MiddleName,
+			HonorificPrefix: user.Name.HonorificPrefix,
+			HonorificSuffix: user.Name.HonorificSuffix,
+		}
+	}
+
+	for _, email := range user.Emails {
+		userRequest.Emails = append(userRequest.Emails, scimv2.Email{
+			Value:   email.Value,
+			Type:    email.Type,
+			Primary: email.Primary,
+		})
+	}
+
+	for _, address := range user.Addresses {
+		userRequest.Addresses = append(userRequest.Addresses, scimv2.Address{
+			Formatted:     address.Formatted,
+			StreetAddress: address.StreetAddress,
+			Locality:      address.Locality,
+			Region:        address.Region,
+			PostalCode:    address.PostalCode,
+			Country:       address.Country,
+		})
+	}
+
+	for _, phoneNumber := range user.PhoneNumbers {
+		userRequest.PhoneNumbers = append(userRequest.PhoneNumbers, scimv2.PhoneNumber{
+			Value: phoneNumber.Value,
+			Type:  phoneNumber.Type,
+		})
+	}
+
+	if user.EnterpriseData != nil {
+		userRequest.EnterpriseUser = &scimv2.EnterpriseUser{
+			EmployeeNumber: user.EnterpriseData.EmployeeNumber,
+			CostCenter:     user.EnterpriseData.CostCenter,
+			Organization:   user.EnterpriseData.Organization,
+			Division:       user.EnterpriseData.Division,
+			Department:     user.EnterpriseData.Department,
+		}
+
+		if user.EnterpriseData.Manager != nil {
+			userRequest.EnterpriseUser.Manager = &scimv2.Manager{
+				Value: user.EnterpriseData.Manager.Value,
+				Ref:   user.EnterpriseData.Manager.Ref,
+			}
+		}
+	}
+
+	slog.Debug("scim: buildGenericUserRequest()", "user", userRequest)
+
+	return userRequest
+}
+
+// buildGenericMember creates a Member model from a SCIM 2.0 user
+func buildGenericMember(user *scimv2.User) *model.Member {
+	m := model.MemberBuilder().
+		WithIPID(user.ExternalID).
+		WithSCIMID(user.ID).
+		WithEmail(user.GetPrimaryEmailAddress()).
+		Build()
+
+	if user.IsActive() {
+		m.Status = "ACTIVE"
+	}
+
+	return m
+}
@@ -0,0 +1,271 @@
+package scim
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/slashdevops/idp-scim-sync/internal/model"
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/scim"
+	scimv2 "github.com/slashdevops/idp-scim-sync/pkg/scim"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestNewGenericProvider(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	svc, err := NewGenericProvider(mocks.NewMockGenericSCIMService(mockCtrl))
+	assert.NoError(t, err)
+	assert.NotNil(t, svc)
+
+	svc, err = NewGenericProvider(nil)
+	assert.ErrorIs(t, err, ErrGenericSCIMServiceNil)
+	assert.Nil(t, svc)
+}
+
+func TestGenericProvider_Users(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx := context.TODO()
+
+	user := model.UserBuilder().
+		WithIPID("1").
+		WithUserName("user.1@example.com").
+		WithDisplayName("user 1").
+		WithName(model.NameBuilder().WithGivenName("user").WithFamilyName("1").Build()).
+		WithEmails([]model.Email{
+			model.EmailBuilder().WithValue("user.1@example.com").WithType("work").WithPrimary(true).Build(),
+			model.EmailBuilder().WithValue("user.1@personal.example.com").WithType("home").Build(),
+		}).
+		WithEnterpriseData(model.EnterpriseDataBuilder().WithDepartment("Engineering").Build()).
+		WithActive(true).
+		Build()
+
+	t.Run("GetUsers avoids the users without the required attributes", func(t *testing.T) {
+		mockSCIM := mocks.NewMockGenericSCIMService(mockCtrl)
+		mockSCIM.EXPECT().ListUsers(ctx, "").Return([]*scimv2.User{
+			{
+				ID:         "s-1",
+				ExternalID: "1",
+				UserName:   "user.1@example.com",
+				Name:       &scimv2.Name{GivenName: "user", FamilyName: "1"},
+				Emails:     []scimv2.Email{{Value: "user.1@example.com", Primary: true}, {Value: "user.1@personal.example.com"}},
+			},
+			{ID: "s-2", UserName: "user.2@example.com"},
+		}, nil)
+
+		svc, _ := NewGenericProvider(mockSCIM)
+		got, err := svc.GetUsers(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, got.Items)
+		assert.Equal(t, "s-1", got.Resources[0].SCIMID)
+		assert.Equal(t, 2, len(got.Resources[0].Emails))
+		assert.True(t, got.Resources[0].Active)
+	})
+
+	t.Run("CreateUsers and UpdateUsers send all the attributes", func(t *testing.T) {
+		mockSCIM := mocks.NewMockGenericSCIMService(mockCtrl)
+		mockSCIM.EXPECT().CreateOrGetUser(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, u *scimv2.User) (*scimv2.User, error) {
+			assert.Equal(t, "1", u.ExternalID)
+			assert.Equal(t, 2, len(u.Emails))
+			assert.Equal(t, "Engineering", u.EnterpriseUser.Department)
+			assert.True(t, *u.Active)
+
+			return &scimv2.User{ID: "s-1"}, nil
+		})
+		mockSCIM.EXPECT().ReplaceUser(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, u *scimv2.User) (*scimv2.User, error) {
+			assert.Equal(t, "s-1", u.ID)
+
+			return &scimv2.User{}, nil
+		})
+
+		svc, _ := NewGenericProvider(mockSCIM)
+
+		created, err := svc.CreateUsers(ctx, model.UsersResultBuilder().WithResources([]*model.User{user}).Build())
+		assert.NoError(t, err)
+		assert.Equal(t, "s-1", created.Resources[0].SCIMID)
+		assert.NotEmpty(t, created.Resources[0].HashCode)
+
+		// the user id is kept when the response body is empty
+		updated, err := svc.UpdateUsers(ctx, created)
+		assert.NoError(t, err)
+		assert.Equal(t, "s-1", updated.Resources[0].SCIMID)
+	})
+
+	t.Run("UpdateUsers without SCIM id", func(t *testing.T) {
+		svc, _ := NewGenericProvider(mocks.NewMockGenericSCIMService(mockCtrl))
+
+		got, err := svc.UpdateUsers(ctx, model.UsersResultBuilder().WithResources([]*model.User{
+			model.UserBuilder().WithUserName("user.2@example.com").Build(),
+		}).Build())
+		assert.Error(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("DeleteUsers", func(t *testing.T) {
+		mockSCIM := mocks.NewMockGenericSCIMService(mockCtrl)
+		mockSCIM.EXPECT().DeleteUser(ctx, "s-1").Return(errors.New("test error"))
+
+		svc, _ := NewGenericProvider(mockSCIM)
+		err := svc.DeleteUsers(ctx, model.UsersResultBuilder().WithResources([]*model.User{
+			model.UserBuilder().WithSCIMID("s-1").Build(),
+		}).Build())
+		assert.Error(t, err)
+	})
+}
+
+func TestGenericProvider_Groups(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx := context.TODO()
+
+	group := model.GroupBuilder().WithSCIMID("g-1").WithIPID("1").WithName("AWS-Admins").WithOrigin("google").Build()
+	gr := model.GroupsResultBuilder().WithResources([]*model.Group{group}).Build()
+
+	t.Run("GetGroups", func(t *testing.T) {
+		mockSCIM := mocks.NewMockGenericSCIMService(mockCtrl)
+		mockSCIM.EXPECT().ListGroups(ctx, "").Return([]*scimv2.Group{{ID: "g-1", ExternalID: "1", DisplayName: "AWS-Admins"}}, nil)
+
+		svc, _ := NewGenericProvider(mockSCIM)
+		got, err := svc.GetGroups(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, got.Items)
+		assert.Equal(t, "g-1", got.Resources[0].SCIMID)
+	})
+
+	t.Run("CreateGroups", func(t *testing.T) {
+		mockSCIM := mocks.NewMockGenericSCIMService(mockCtrl)
+		mockSCIM.EXPECT().CreateOrGetGroup(ctx, &scimv2.Group{DisplayName: "AWS-Admins", ExternalID: "1"}).Return(&scimv2.Group{ID: "g-2"}, nil)
+
+		svc, _ := NewGenericProvider(mockSCIM)
+		got, err := svc.CreateGroups(ctx, gr)
+		assert.NoError(t, err)
+		assert.Equal(t, "g-2", got.Resources[0].SCIMID)
+		assert.Equal(t, "google", got.Resources[0].Origin)
+	})
+
+	t.Run("UpdateGroups with patch", func(t *testing.T) {
+		mockSCIM := mocks.NewMockGenericSCIMService(mockCtrl)
+		mockSCIM.EXPECT().Profile().Return(scimv2.Profile{PatchSupported: true})
+		mockSCIM.EXPECT().PatchGroup(ctx, "g-1", gomock.Any()).Return(nil)
+
+		svc, _ := NewGenericProvider(mockSCIM)
+		got, err := svc.UpdateGroups(ctx, gr)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, got.Items)
+	})
+
+	t.Run("UpdateGroups without patch keeps the members", func(t *testing.T) {
+		mockSCIM := mocks.NewMockGenericSCIMService(mockCtrl)
+		mockSCIM.EXPECT().Profile().Return(scimv2.Profile{})
+		mockSCIM.EXPECT().GetGroup(ctx, "g-1").Return(&scimv2.Group{ID: "g-1", DisplayName: "Admins", Members: []*scimv2.Member{{Value: "s-1"}}}, nil)
+		mockSCIM.EXPECT().ReplaceGroup(ctx, &scimv2.Group{ID: "g-1", DisplayName: "AWS-Admins", ExternalID: "1", Members: []*scimv2.Member{{Value: "s-1"}}}).Return(&scimv2.Group{}, nil)
+
+		svc, _ := NewGenericProvider(mockSCIM)
+		_, err := svc.UpdateGroups(ctx, gr)
+		assert.NoError(t, err)
+	})
+
+	t.Run("DeleteGroups", func(t *testing.T) {
+		mockSCIM := mocks.NewMockGenericSCIMService(mockCtrl)
+		mockSCIM.EXPECT().DeleteGroup(ctx, "g-1").Return(nil)
+
+		svc, _ := NewGenericProvider(mockSCIM)
+		assert.NoError(t, svc.DeleteGroups(ctx, gr))
+	})
+}
+
+func TestGenericProvider_GroupsMembers(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx := context.TODO()
+
+	group := model.GroupBuilder().WithSCIMID("g-1").WithIPID("1").WithName("AWS-Admins").Build()
+	gr := model.GroupsResultBuilder().WithResources([]*model.Group{group}).Build()
+
+	gmr := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+		model.GroupMembersBuilder().WithGroup(group).WithResources(groupMembersGenerator(3, true, true)).Build(),
+	}).Build()
+
+	t.Run("CreateGroupsMembers with patch in chunks", func(t *testing.T) {
+		members := model.GroupsMembersResultBuilder().WithResources([]*model.GroupMembers{
+			model.GroupMembersBuilder().WithGroup(group).WithResources([]*model.Member{
+				{Email: "user.1@mail.com"},
+				{SCIMID: "2", Email: "user.2@mail.com"},
+				{SCIMID: "3", Email: "user.3@mail.com"},
+			}).Build(),
+		}).Build()
+
+		mockSCIM := mocks.NewMockGenericSCIMService(mockCtrl)
+		mockSCIM.EXPECT().Profile().Return(scimv2.Profile{PatchSupported: true, MaxMembersPerPatch: 2})
+		mockSCIM.EXPECT().GetUserByUserName(ctx, "user.1@mail.com").Return(&scimv2.User{ID: "1"}, nil)
+		mockSCIM.EXPECT().PatchGroup(ctx, "g-1", &scimv2.Operation{OP: "add", Path: "members", Value: []*scimv2.Member{{Value: "1"}, {Value: "2"}}}).Return(nil)
+		mockSCIM.EXPECT().PatchGroup(ctx, "g-1", &scimv2.Operation{OP: "add", Path: "members", Value: []*scimv2.Member{{Value: "3"}}}).Return(nil)
+
+		svc, _ := NewGenericProvider(mockSCIM)
+		got, err := svc.CreateGroupsMembers(ctx, members)
+		assert.NoError(t, err)
+		assert.Equal(t, "1", got.Resources[0].Resources[0].SCIMID)
+	})
+
+	t.Run("DeleteGroupsMembers with patch uses a filter per member", func(t *testing.T) {
+		mockSCIM := mocks.NewMockGenericSCIMService(mockCtrl)
+		mockSCIM.EXPECT().Profile().Return(scimv2.Profile{PatchSupported: true, MaxMembersPerPatch: 100})
+		mockSCIM.EXPECT().PatchGroup(ctx, "g-1",
+			&scimv2.Operation{OP: "remove", Path: `members[value eq "1"]`},
+			&scimv2.Operation{OP: "remove", Path: `members[value eq "2"]`},
+			&scimv2.Operation{OP: "remove", Path: `members[value eq "3"]`},
+		).Return(nil)
+
+		svc, _ := NewGenericProvider(mockSCIM)
+		assert.NoError(t, svc.DeleteGroupsMembers(ctx, gmr))
+	})
+
+	t.Run("DeleteGroupsMembers without patch replaces the members", func(t *testing.T) {
+		mockSCIM := mocks.NewMockGenericSCIMService(mockCtrl)
+		mockSCIM.EXPECT().Profile().Return(scimv2.Profile{})
+		mockSCIM.EXPECT().GetGroup(ctx, "g-1").Return(&scimv2.Group{ID: "g-1", DisplayName: "AWS-Admins", Members: []*scimv2.Member{{Value: "1"}, {Value: "4"}}}, nil)
+		mockSCIM.EXPECT().ReplaceGroup(ctx, &scimv2.Group{ID: "g-1", DisplayName: "AWS-Admins", Members: []*scimv2.Member{{Value: "4"}}}).Return(&scimv2.Group{}, nil)
+
+		svc, _ := NewGenericProvider(mockSCIM)
+		assert.NoError(t, svc.DeleteGroupsMembers(ctx, gmr))
+	})
+
+	t.Run("GetGroupsMembersBruteForce reads the members of the groups", func(t *testing.T) {
+		ur := model.UsersResultBuilder().WithResources([]*model.User{
+			model.UserBuilder().WithSCIMID("s-1").WithIPID("1").WithEmail(model.EmailBuilder().WithValue("user.1@example.com").WithPrimary(true).Build()).WithActive(true).Build(),
+		}).Build()
+
+		mockSCIM := mocks.NewMockGenericSCIMService(mockCtrl)
+		mockSCIM.EXPECT().Profile().Return(scimv2.Profile{GroupMembersInList: true})
+		mockSCIM.EXPECT().ListGroups(ctx, "").Return([]*scimv2.Group{
+			{ID: "g-1", DisplayName: "AWS-Admins", Members: []*scimv2.Member{{Value: "s-1"}, {Value: "unknown"}}},
+		}, nil)
+
+		svc, _ := NewGenericProvider(mockSCIM)
+		got, err := svc.GetGroupsMembersBruteForce(ctx, gr, ur)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, got.Items)
+		assert.Equal(t, 1, got.Resources[0].Items)
+		assert.Equal(t, "user.1@example.com", got.Resources[0].Resources[0].Email)
+		assert.Equal(t, "ACTIVE", got.Resources[0].Resources[0].Status)
+	})
+
+	t.Run("GetGroupsMembers gets the users of the members", func(t *testing.T) {
+		mockSCIM := mocks.NewMockGenericSCIMService(mockCtrl)
+		mockSCIM.EXPECT().Profile().Return(scimv2.Profile{})
+		mockSCIM.EXPECT().GetGroup(ctx, "g-1").Return(&scimv2.Group{ID: "g-1", Members: []*scimv2.Member{{Value: "s-1"}}}, nil)
+		mockSCIM.EXPECT().GetUser(ctx, "s-1").Return(&scimv2.User{ID: "s-1", ExternalID: "1", Emails: []scimv2.Email{{Value: "user.1@example.com"}}}, nil)
+
+		svc, _ := NewGenericProvider(mockSCIM)
+		got, err := svc.GetGroupsMembers(ctx, gr)
+		assert.NoError(t, err)
+		assert.Equal(t, "user.1@example.com", got.Resources[0].Resources[0].Email)
+		assert.Equal(t, "1", got.Resources[0].Resources[0].IPID)
+	})
+}
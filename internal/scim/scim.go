@@ -6,7 +6,9 @@ import (
 	"log/slog"
 
 	"github.com/slashdevops/idp-scim-sync/internal/model"
+	"github.com/slashdevops/idp-scim-sync/internal/workerpool"
 	"github.com/slashdevops/idp-scim-sync/pkg/aws"
+	"golang.org/x/time/rate"
 )
 
 // This implement core.SCIMService interface
@@ -55,15 +57,32 @@ var ErrSCIMProviderNil = fmt.Errorf("scim: Provider is nil")
 // Provider represents a SCIM provider
 type Provider struct {
 	scim AWSSCIMProvider
+
+	// concurrency and rateLimit are applied to the users and groups members writes
+	concurrency int
+	rateLimit   float64
+	limiter     *rate.Limiter
 }
 
-// NewProvider creates a new SCIM provider
-func NewProvider(scim AWSSCIMProvider) (*Provider, error) {
+// NewProvider creates a new SCIM provider, by default the resources are written one by one
+// without rate limit.
+func NewProvider(scim AWSSCIMProvider, opts ...ProviderOption) (*Provider, error) {
 	if scim == nil {
 		return nil, ErrSCIMProviderNil
 	}
 
-	return &Provider{scim: scim}, nil
+	p := &Provider{
+		scim:        scim,
+		concurrency: DefaultConcurrency,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	p.limiter = newLimiter(p.rateLimit, p.concurrency)
+
+	return p, nil
 }
 
 // GetGroups returns groups from SCIM Provider
@@ -117,6 +136,7 @@ func (s *Provider) CreateGroups(ctx context.Context, gr *model.GroupsResult) (*m
 			WithName(group.Name).
 			WithIPID(group.IPID).
 			WithEmail(group.Email).
+			WithOrigin(group.Origin).
 			Build()
 
 		groups[i] = g
@@ -164,6 +184,7 @@ func (s *Provider) UpdateGroups(ctx context.Context, gr *model.GroupsResult) (*m
 			WithName(group.Name).
 			WithIPID(group.IPID).
 			WithEmail(group.Email).
+			WithOrigin(group.Origin).
 			Build()
 
 		groups[i] = g
@@ -207,48 +228,65 @@ func (s *Provider) GetUsers(ctx context.Context) (*model.UsersResult, error) {
 	return usersResult, nil
 }
 
-// CreateUsers creates users in SCIM Provider
+// CreateUsers creates users in SCIM Provider, up to the concurrency users are created at the same time
+// and the returned users keep the order of the given users. When some users cannot be created, the users
+// created are returned with the errors of the others.
 func (s *Provider) CreateUsers(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
 	users := make([]*model.User, len(ur.Resources))
 
-	for i, user := range ur.Resources {
+	err := workerpool.ForEach(ctx, len(ur.Resources), s.concurrency, func(ctx context.Context, i int) error {
+		user := ur.Resources[i]
 		userRequest := buildCreateUserRequest(user)
 
 		slog.Warn("creating user", "user", user.DisplayName, "email", user.GetPrimaryEmailAddress())
 
+		if err := s.limiter.Wait(ctx); err != nil {
+			return fmt.Errorf("scim: error creating user: %s, %w", user.GetPrimaryEmailAddress(), err)
+		}
+
 		cogu, err := s.scim.CreateOrGetUser(ctx, userRequest)
 		if err != nil {
-			return nil, fmt.Errorf("scim: error creating user: %w", err)
+			return fmt.Errorf("scim: error creating user: %s, %w", user.GetPrimaryEmailAddress(), err)
 		}
 
 		user.SCIMID = cogu.ID
 		user.SetHashCode()
 
 		users[i] = user
-	}
+		return nil
+	})
 
-	usersResult := model.UsersResultBuilder().WithResources(users).Build()
-	slog.Debug("scim: CreateUsers()", "users", len(users))
+	usersResult := model.UsersResultBuilder().WithResources(succeeded(users)).Build()
+	slog.Debug("scim: CreateUsers()", "users", usersResult.Items)
 
-	return usersResult, nil
+	return usersResult, err
 }
 
-// UpdateUsers updates users in SCIM Provider given a list of users
+// UpdateUsers updates users in SCIM Provider given a list of users, up to the concurrency users are
+// updated at the same time and the returned users keep the order of the given users. When some users
+// cannot be updated, the users updated are returned with the errors of the others.
 func (s *Provider) UpdateUsers(ctx context.Context, ur *model.UsersResult) (*model.UsersResult, error) {
 	users := make([]*model.User, len(ur.Resources))
 
-	for i, user := range ur.Resources {
+	for _, user := range ur.Resources {
 		if user.SCIMID == "" {
 			return nil, fmt.Errorf("scim: error updating user, user ID is empty: %s", user.SCIMID)
 		}
+	}
 
+	err := workerpool.ForEach(ctx, len(ur.Resources), s.concurrency, func(ctx context.Context, i int) error {
+		user := ur.Resources[i]
 		userRequest := buildPutUserRequest(user)
 
 		slog.Warn("updating user", "user", user.DisplayName, "email", user.GetPrimaryEmailAddress())
 
+		if err := s.limiter.Wait(ctx); err != nil {
+			return fmt.Errorf("scim: error updating user: %s, %w", user.SCIMID, err)
+		}
+
 		pur, err := s.scim.PutUser(ctx, userRequest)
 		if err != nil {
-			return nil, fmt.Errorf("scim: error updating user: %w", err)
+			return fmt.Errorf("scim: error updating user: %s, %w", user.SCIMID, err)
 		}
 
 		// update the user SCIM ID from the put user response
@@ -256,44 +294,59 @@ func (s *Provider) UpdateUsers(ctx context.Context, ur *model.UsersResult) (*mod
 		user.SetHashCode()
 
 		users[i] = user
-	}
+		return nil
+	})
 
-	usersResult := model.UsersResultBuilder().WithResources(users).Build()
-	slog.Debug("scim: UpdateUsers()", "users", len(users))
+	usersResult := model.UsersResultBuilder().WithResources(succeeded(users)).Build()
+	slog.Debug("scim: UpdateUsers()", "users", usersResult.Items)
 
-	return usersResult, nil
+	return usersResult, err
 }
 
-// DeleteUsers deletes users in SCIM Provider given a list of users
+// DeleteUsers deletes users in SCIM Provider given a list of users, up to the concurrency users are
+// deleted at the same time
 func (s *Provider) DeleteUsers(ctx context.Context, ur *model.UsersResult) error {
-	for _, user := range ur.Resources {
+	return workerpool.ForEach(ctx, len(ur.Resources), s.concurrency, func(ctx context.Context, i int) error {
+		user := ur.Resources[i]
+
 		slog.Warn("deleting user", "user", user.DisplayName, "email", user.GetPrimaryEmailAddress())
 
+		if err := s.limiter.Wait(ctx); err != nil {
+			return fmt.Errorf("scim: error deleting user: %s, %w", user.SCIMID, err)
+		}
+
 		if err := s.scim.DeleteUser(ctx, user.SCIMID); err != nil {
 			return fmt.Errorf("scim: error deleting user: %s, %w", user.SCIMID, err)
 		}
-	}
 
-	return nil
+		return nil
+	})
 }
 
 type patchValue struct {
 	Value string `json:"value"`
 }
 
-// CreateGroupsMembers creates groups members in SCIM Provider given a list of groups members
+// CreateGroupsMembers creates groups members in SCIM Provider given a list of groups members, up to the concurrency
+// groups are patched at the same time and the returned groups members keep the order of the given groups members.
+// When the members of some groups cannot be added, the groups members added are returned with the errors of the others.
 func (s *Provider) CreateGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.GroupsMembersResult, error) {
 	groupsMembers := make([]*model.GroupMembers, len(gmr.Resources))
 
-	for i, groupMembers := range gmr.Resources {
+	err := workerpool.ForEach(ctx, len(gmr.Resources), s.concurrency, func(ctx context.Context, i int) error {
+		groupMembers := gmr.Resources[i]
 		members := make([]*model.Member, len(groupMembers.Resources))
 		membersIDValue := make([]patchValue, len(groupMembers.Resources))
 
 		for j, member := range groupMembers.Resources {
 			if member.SCIMID == "" {
+				if err := s.limiter.Wait(ctx); err != nil {
+					return fmt.Errorf("scim: error getting user by email: %s, %w", member.Email, err)
+				}
+
 				u, err := s.scim.GetUserByUserName(ctx, member.Email)
 				if err != nil {
-					return nil, fmt.Errorf("scim: error getting user by email: %w", err)
+					return fmt.Errorf("scim: error getting user by email: %s, %w", member.Email, err)
 				}
 				member.SCIMID = u.ID
 			}
@@ -313,13 +366,6 @@ func (s *Provider) CreateGroupsMembers(ctx context.Context, gmr *model.GroupsMem
 			members[j] = m
 		}
 
-		gm := model.GroupMembersBuilder().
-			WithGroup(groupMembers.Group).
-			WithResources(members).
-			Build()
-
-		groupsMembers[i] = gm
-
 		patchOperations := patchGroupOperations("add", "members", membersIDValue, groupMembers)
 
 		if len(patchOperations) > 1 {
@@ -331,22 +377,28 @@ func (s *Provider) CreateGroupsMembers(ctx context.Context, gmr *model.GroupsMem
 			)
 		}
 
-		for _, patchGroupRequest := range patchOperations {
-			if err := s.scim.PatchGroup(ctx, patchGroupRequest); err != nil {
-				return nil, fmt.Errorf("scim: error patching group: %w", err)
-			}
+		if err := s.patchGroup(ctx, groupMembers.Group, patchOperations); err != nil {
+			return err
 		}
-	}
 
-	groupsMembersResult := model.GroupsMembersResultBuilder().WithResources(groupsMembers).Build()
-	slog.Debug("scim: CreateGroupsMembers()", "groups_members", len(groupsMembers))
+		groupsMembers[i] = model.GroupMembersBuilder().
+			WithGroup(groupMembers.Group).
+			WithResources(members).
+			Build()
+		return nil
+	})
+
+	groupsMembersResult := model.GroupsMembersResultBuilder().WithResources(succeeded(groupsMembers)).Build()
+	slog.Debug("scim: CreateGroupsMembers()", "groups_members", groupsMembersResult.Items)
 
-	return groupsMembersResult, nil
+	return groupsMembersResult, err
 }
 
-// DeleteGroupsMembers deletes groups members in SCIM Provider given a list of groups members
+// DeleteGroupsMembers deletes groups members in SCIM Provider given a list of groups members, up to the concurrency
+// groups are patched at the same time
 func (s *Provider) DeleteGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) error {
-	for _, groupMembers := range gmr.Resources {
+	return workerpool.ForEach(ctx, len(gmr.Resources), s.concurrency, func(ctx context.Context, i int) error {
+		groupMembers := gmr.Resources[i]
 		membersIDValue := []patchValue{}
 
 		for _, member := range groupMembers.Resources {
@@ -367,10 +419,19 @@ func (s *Provider) DeleteGroupsMembers(ctx context.Context, gmr *model.GroupsMem
 			)
 		}
 
-		for _, patchGroupRequest := range patchOperations {
-			if err := s.scim.PatchGroup(ctx, patchGroupRequest); err != nil {
-				return fmt.Errorf("scim: error patching group: %w", err)
-			}
+		return s.patchGroup(ctx, groupMembers.Group, patchOperations)
+	})
+}
+
+// patchGroup sends the patch requests of a group one after the other, the first error stops the group.
+func (s *Provider) patchGroup(ctx context.Context, group *model.Group, patchOperations []*aws.PatchGroupRequest) error {
+	for _, patchGroupRequest := range patchOperations {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return fmt.Errorf("scim: error patching group: %s, %w", group.Name, err)
+		}
+
+		if err := s.scim.PatchGroup(ctx, patchGroupRequest); err != nil {
+			return fmt.Errorf("scim: error patching group: %s, %w", group.Name, err)
 		}
 	}
 
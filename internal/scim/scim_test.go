@@ -757,7 +757,7 @@ func TestCreateUsers(t *testing.T) {
 		ur, err := svc.CreateUsers(ctx, usr)
 
 		assert.Error(t, err)
-		assert.Nil(t, ur)
+		assert.Equal(t, 0, ur.Items)
 	})
 
 	t.Run("Should call CreateUser 2 time and no return error", func(t *testing.T) {
@@ -971,7 +971,7 @@ func TestUpdateUsers(t *testing.T) {
 		svc, _ := NewProvider(mockSCIM)
 		ur, err := svc.UpdateUsers(ctx, usr)
 		assert.Error(t, err)
-		assert.Nil(t, ur)
+		assert.Equal(t, 0, ur.Items)
 	})
 
 	t.Run("Should call CreateUser 2 time and no return error", func(t *testing.T) {
@@ -1301,7 +1301,7 @@ func TestCreateGroupsMembers(t *testing.T) {
 		svc, _ := NewProvider(mockSCIM)
 		got, err := svc.CreateGroupsMembers(ctx, gmr)
 		assert.Error(t, err)
-		assert.Nil(t, got)
+		assert.Equal(t, 0, got.Items)
 	})
 
 	t.Run("Should return error if PatchGroup return error", func(t *testing.T) {
@@ -1375,7 +1375,7 @@ func TestCreateGroupsMembers(t *testing.T) {
 		svc, _ := NewProvider(mockSCIM)
 		got, err := svc.CreateGroupsMembers(ctx, gmr)
 		assert.Error(t, err)
-		assert.Nil(t, got)
+		assert.Equal(t, 0, got.Items)
 	})
 
 	t.Run("Should call GetUserByUserName 1 time and PatchGroup 3 times and no return error", func(t *testing.T) {
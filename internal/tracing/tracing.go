@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/slashdevops/idp-scim-sync/internal/version"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	// TracerName is the name of the tracer of the spans of the sync.
+	TracerName = "github.com/slashdevops/idp-scim-sync"
+
+	// ServiceName is the name of the service in the exported spans.
+	ServiceName = "idpscim"
+
+	// ExporterNone disables the tracing.
+	ExporterNone = "none"
+
+	// ExporterStdout writes the spans as json into the writer given to NewTracerProvider.
+	ExporterStdout = "stdout"
+
+	// ExporterOTLP sends the spans to an OpenTelemetry collector using OTLP over HTTP.
+	ExporterOTLP = "otlp"
+
+	// maxAttributeNames is the maximum number of names, like group names, added to an attribute of a span.
+	maxAttributeNames = 100
+)
+
+// ErrExporterInvalid is returned when the exporter is not one of the supported exporters.
+var ErrExporterInvalid = errors.New("tracing: invalid exporter")
+
+// ShutdownFunc exports the pending spans and stops the tracer provider.
+type ShutdownFunc func(ctx context.Context) error
+
+// NewTracerProvider returns a tracer provider that exports the spans with the given exporter [none|stdout|otlp].
+// The otlp exporter sends the spans to the given endpoint url, when it is empty the standard
+// OTEL_EXPORTER_OTLP_* environment variables are used. The stdout exporter writes the spans into w.
+func NewTracerProvider(ctx context.Context, exporter, endpoint string, w io.Writer) (trace.TracerProvider, ShutdownFunc, error) {
+	var (
+		spanExporter sdktrace.SpanExporter
+		err          error
+	)
+
+	switch exporter {
+	case ExporterNone, "":
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(w))
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{}
+		if endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+		}
+		spanExporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, nil, fmt.Errorf("%w: %s", ErrExporterInvalid, exporter)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("tracing: error creating the %s exporter: %w", exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+		semconv.ServiceVersion(version.Version),
+	))
+	if err != nil {
+		return nil, nil, fmt.Errorf("tracing: error creating the resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+
+	return tp, tp.Shutdown, nil
+}
+
+// Start starts a span as a child of the span in ctx, using the tracer provider of that span,
+// so the packages don't need their own tracer provider. When ctx doesn't have a recording
+// span, like when the tracing is disabled, the span doesn't record and ctx is returned as it is.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return StartWithProvider(ctx, trace.SpanFromContext(ctx).TracerProvider(), name, attrs...)
+}
+
+// StartWithProvider starts a span with the given tracer provider, it is used to start the root span of the sync.
+// When the span doesn't record, ctx is returned as it is.
+func StartWithProvider(ctx context.Context, tp trace.TracerProvider, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	spanCtx, span := tp.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+	if !span.IsRecording() {
+		return ctx, span
+	}
+
+	return spanCtx, span
+}
+
+// End records the error, if any, as the status of the span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Names returns an attribute with the given names, only the first names are added
+// to keep the spans small, the number of names is in the count attributes.
+func Names(key string, names []string) attribute.KeyValue {
+	if len(names) > maxAttributeNames {
+		names = names[:maxAttributeNames]
+	}
+
+	return attribute.StringSlice(key, names)
+}
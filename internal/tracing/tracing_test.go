@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNewTracerProvider(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("none doesn't record the spans", func(t *testing.T) {
+		tp, shutdown, err := NewTracerProvider(ctx, ExporterNone, "", nil)
+		assert.NoError(t, err)
+
+		_, span := StartWithProvider(ctx, tp, "test")
+		assert.False(t, span.IsRecording())
+		assert.NoError(t, shutdown(ctx))
+	})
+
+	t.Run("stdout writes the spans when it is shut down", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		tp, shutdown, err := NewTracerProvider(ctx, ExporterStdout, "", &buf)
+		assert.NoError(t, err)
+
+		_, span := StartWithProvider(ctx, tp, "test", attribute.Int("groups", 2))
+		assert.True(t, span.IsRecording())
+		span.End()
+
+		assert.NoError(t, shutdown(ctx))
+		assert.Contains(t, buf.String(), `"Name":"test"`)
+		assert.Contains(t, buf.String(), `"service.name"`)
+	})
+
+	t.Run("otlp doesn't send the spans until they are exported", func(t *testing.T) {
+		tp, shutdown, err := NewTracerProvider(ctx, ExporterOTLP, "http://localhost:4318", nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, tp)
+
+		// nothing to export, so the collector is not called
+		assert.NoError(t, shutdown(ctx))
+	})
+
+	t.Run("returns an error when the exporter is invalid", func(t *testing.T) {
+		tp, shutdown, err := NewTracerProvider(ctx, "zipkin", "", nil)
+		assert.ErrorIs(t, err, ErrExporterInvalid)
+		assert.Nil(t, tp)
+		assert.Nil(t, shutdown)
+	})
+}
+
+func TestStart(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("without a recording span in ctx returns ctx as it is", func(t *testing.T) {
+		got, span := Start(ctx, "test")
+		assert.Equal(t, ctx, got)
+		assert.False(t, span.IsRecording())
+	})
+
+	t.Run("starts a child of the span in ctx with its tracer provider", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+		parentCtx, parent := StartWithProvider(ctx, tp, "parent")
+		_, child := Start(parentCtx, "child", attribute.String("group.id", "group-1"))
+		End(child, errors.New("test error"))
+		End(parent, nil)
+
+		spans := exporter.GetSpans()
+		assert.Equal(t, 2, len(spans))
+		assert.Equal(t, "child", spans[0].Name)
+		assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+		assert.Contains(t, spans[0].Attributes, attribute.String("group.id", "group-1"))
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+		assert.Equal(t, "test error", spans[0].Status.Description)
+		assert.Equal(t, 1, len(spans[0].Events))
+		assert.Equal(t, codes.Unset, spans[1].Status.Code)
+	})
+}
+
+func TestNames(t *testing.T) {
+	names := make([]string, 0, maxAttributeNames+10)
+	for i := range maxAttributeNames + 10 {
+		names = append(names, fmt.Sprintf("group %d", i))
+	}
+
+	assert.Equal(t, maxAttributeNames, len(Names("groups", names).Value.AsStringSlice()))
+	assert.Equal(t, []string{"group 0"}, Names("groups", names[:1]).Value.AsStringSlice())
+}
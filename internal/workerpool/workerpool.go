@@ -0,0 +1,85 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ForEach calls fn with the indexes from 0 to n-1 using up to workers goroutines.
+// All the indexes are processed even when fn returns an error, the errors are returned
+// joined in the order of the indexes, so the result doesn't depend on the scheduling.
+// With one worker or less the indexes are processed in order in the calling goroutine.
+func ForEach(ctx context.Context, n, workers int, fn func(ctx context.Context, i int) error) error {
+	errs := make([]error, n)
+
+	run(n, workers, func(i int) {
+		errs[i] = fn(ctx, i)
+	})
+
+	return errors.Join(errs...)
+}
+
+// ForEachUntilError calls fn with the indexes from 0 to n-1 using up to workers goroutines,
+// the first error cancels the context given to the running calls and the remaining indexes
+// are not processed. The first error is returned.
+// With one worker or less the indexes are processed in order in the calling goroutine with the given context.
+func ForEachUntilError(ctx context.Context, n, workers int, fn func(ctx context.Context, i int) error) error {
+	if workers <= 1 || n <= 1 {
+		for i := range n {
+			if err := fn(ctx, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var once sync.Once
+	var firstErr error
+
+	run(n, workers, func(i int) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err := fn(ctx, i); err != nil {
+			once.Do(func() {
+				firstErr = err
+				cancel()
+			})
+		}
+	})
+
+	return firstErr
+}
+
+// run calls fn with the indexes from 0 to n-1 using up to workers goroutines.
+func run(n, workers int, fn func(i int)) {
+	if workers <= 1 || n <= 1 {
+		for i := range n {
+			fn(i)
+		}
+		return
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := range n {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,132 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEach(t *testing.T) {
+	t.Run("should process all the indexes up to the workers at the same time", func(t *testing.T) {
+		var running, maxRunning atomic.Int32
+		processed := make([]bool, 20)
+
+		err := ForEach(context.TODO(), len(processed), 4, func(ctx context.Context, i int) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+
+			time.Sleep(time.Millisecond)
+			processed[i] = true
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, maxRunning.Load(), int32(4))
+		for i, ok := range processed {
+			assert.True(t, ok, "index %d not processed", i)
+		}
+	})
+
+	t.Run("should return the errors of all the indexes in order", func(t *testing.T) {
+		errOne := errors.New("one")
+		errThree := errors.New("three")
+
+		err := ForEach(context.TODO(), 5, 3, func(ctx context.Context, i int) error {
+			switch i {
+			case 1:
+				return errOne
+			case 3:
+				return errThree
+			}
+			return nil
+		})
+
+		assert.Error(t, err)
+		assert.ErrorIs(t, err, errOne)
+		assert.ErrorIs(t, err, errThree)
+		assert.Equal(t, "one\nthree", err.Error())
+	})
+
+	t.Run("should process in order when there is one worker", func(t *testing.T) {
+		order := make([]int, 0)
+
+		err := ForEach(context.TODO(), 3, 1, func(ctx context.Context, i int) error {
+			order = append(order, i)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []int{0, 1, 2}, order)
+	})
+
+	t.Run("should do nothing without indexes", func(t *testing.T) {
+		err := ForEach(context.TODO(), 0, 4, func(ctx context.Context, i int) error {
+			return errors.New("unexpected call")
+		})
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestForEachUntilError(t *testing.T) {
+	t.Run("should process all the indexes without errors", func(t *testing.T) {
+		var processed atomic.Int32
+
+		err := ForEachUntilError(context.TODO(), 50, 8, func(ctx context.Context, i int) error {
+			processed.Add(1)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int32(50), processed.Load())
+	})
+
+	t.Run("should stop after the first error with one worker", func(t *testing.T) {
+		errTwo := errors.New("two")
+		order := make([]int, 0)
+
+		err := ForEachUntilError(context.TODO(), 5, 1, func(ctx context.Context, i int) error {
+			order = append(order, i)
+			if i == 2 {
+				return errTwo
+			}
+			return nil
+		})
+
+		assert.ErrorIs(t, err, errTwo)
+		assert.Equal(t, []int{0, 1, 2}, order)
+	})
+
+	t.Run("should cancel the running calls and return the first error", func(t *testing.T) {
+		errFirst := errors.New("first")
+		var processed atomic.Int32
+
+		err := ForEachUntilError(context.TODO(), 100, 4, func(ctx context.Context, i int) error {
+			processed.Add(1)
+			if i == 0 {
+				return errFirst
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+				return nil
+			}
+		})
+
+		assert.ErrorIs(t, err, errFirst)
+		assert.Less(t, processed.Load(), int32(100))
+	})
+}
@@ -12,6 +12,7 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	model "github.com/slashdevops/idp-scim-sync/internal/model"
 	gomock "go.uber.org/mock/gomock"
@@ -69,3 +70,108 @@ func (mr *MockStateRepositoryMockRecorder) SetState(ctx, state any) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetState", reflect.TypeOf((*MockStateRepository)(nil).SetState), ctx, state)
 }
+
+// MockStateMigrator is a mock of StateMigrator interface.
+type MockStateMigrator struct {
+	ctrl     *gomock.Controller
+	recorder *MockStateMigratorMockRecorder
+	isgomock struct{}
+}
+
+// MockStateMigratorMockRecorder is the mock recorder for MockStateMigrator.
+type MockStateMigratorMockRecorder struct {
+	mock *MockStateMigrator
+}
+
+// NewMockStateMigrator creates a new mock instance.
+func NewMockStateMigrator(ctrl *gomock.Controller) *MockStateMigrator {
+	mock := &MockStateMigrator{ctrl: ctrl}
+	mock.recorder = &MockStateMigratorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStateMigrator) EXPECT() *MockStateMigratorMockRecorder {
+	return m.recorder
+}
+
+// MigrateState mocks base method.
+func (m *MockStateMigrator) MigrateState(ctx context.Context) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MigrateState", ctx)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MigrateState indicates an expected call of MigrateState.
+func (mr *MockStateMigratorMockRecorder) MigrateState(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MigrateState", reflect.TypeOf((*MockStateMigrator)(nil).MigrateState), ctx)
+}
+
+// MockStateLocker is a mock of StateLocker interface.
+type MockStateLocker struct {
+	ctrl     *gomock.Controller
+	recorder *MockStateLockerMockRecorder
+	isgomock struct{}
+}
+
+// MockStateLockerMockRecorder is the mock recorder for MockStateLocker.
+type MockStateLockerMockRecorder struct {
+	mock *MockStateLocker
+}
+
+// NewMockStateLocker creates a new mock instance.
+func NewMockStateLocker(ctrl *gomock.Controller) *MockStateLocker {
+	mock := &MockStateLocker{ctrl: ctrl}
+	mock.recorder = &MockStateLockerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStateLocker) EXPECT() *MockStateLockerMockRecorder {
+	return m.recorder
+}
+
+// Lock mocks base method.
+func (m *MockStateLocker) Lock(ctx context.Context, owner string, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Lock", ctx, owner, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Lock indicates an expected call of Lock.
+func (mr *MockStateLockerMockRecorder) Lock(ctx, owner, ttl any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lock", reflect.TypeOf((*MockStateLocker)(nil).Lock), ctx, owner, ttl)
+}
+
+// Renew mocks base method.
+func (m *MockStateLocker) Renew(ctx context.Context, owner string, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Renew", ctx, owner, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Renew indicates an expected call of Renew.
+func (mr *MockStateLockerMockRecorder) Renew(ctx, owner, ttl any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Renew", reflect.TypeOf((*MockStateLocker)(nil).Renew), ctx, owner, ttl)
+}
+
+// Unlock mocks base method.
+func (m *MockStateLocker) Unlock(ctx context.Context, owner string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unlock", ctx, owner)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unlock indicates an expected call of Unlock.
+func (mr *MockStateLockerMockRecorder) Unlock(ctx, owner any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unlock", reflect.TypeOf((*MockStateLocker)(nil).Unlock), ctx, owner)
+}
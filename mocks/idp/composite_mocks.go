@@ -0,0 +1,117 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: composite.go
+//
+// Generated by this command:
+//
+//	mockgen -package=mocks -destination=../../mocks/idp/composite_mocks.go -source=composite.go CompositeProviderService
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	model "github.com/slashdevops/idp-scim-sync/internal/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockCompositeProviderService is a mock of CompositeProviderService interface.
+type MockCompositeProviderService struct {
+	ctrl     *gomock.Controller
+	recorder *MockCompositeProviderServiceMockRecorder
+	isgomock struct{}
+}
+
+// MockCompositeProviderServiceMockRecorder is the mock recorder for MockCompositeProviderService.
+type MockCompositeProviderServiceMockRecorder struct {
+	mock *MockCompositeProviderService
+}
+
+// NewMockCompositeProviderService creates a new mock instance.
+func NewMockCompositeProviderService(ctrl *gomock.Controller) *MockCompositeProviderService {
+	mock := &MockCompositeProviderService{ctrl: ctrl}
+	mock.recorder = &MockCompositeProviderServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCompositeProviderService) EXPECT() *MockCompositeProviderServiceMockRecorder {
+	return m.recorder
+}
+
+// GetGroupMembers mocks base method.
+func (m *MockCompositeProviderService) GetGroupMembers(ctx context.Context, id string) (*model.MembersResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGroupMembers", ctx, id)
+	ret0, _ := ret[0].(*model.MembersResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGroupMembers indicates an expected call of GetGroupMembers.
+func (mr *MockCompositeProviderServiceMockRecorder) GetGroupMembers(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGroupMembers", reflect.TypeOf((*MockCompositeProviderService)(nil).GetGroupMembers), ctx, id)
+}
+
+// GetGroups mocks base method.
+func (m *MockCompositeProviderService) GetGroups(ctx context.Context, filter []string) (*model.GroupsResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGroups", ctx, filter)
+	ret0, _ := ret[0].(*model.GroupsResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGroups indicates an expected call of GetGroups.
+func (mr *MockCompositeProviderServiceMockRecorder) GetGroups(ctx, filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGroups", reflect.TypeOf((*MockCompositeProviderService)(nil).GetGroups), ctx, filter)
+}
+
+// GetGroupsMembers mocks base method.
+func (m *MockCompositeProviderService) GetGroupsMembers(ctx context.Context, gr *model.GroupsResult) (*model.GroupsMembersResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGroupsMembers", ctx, gr)
+	ret0, _ := ret[0].(*model.GroupsMembersResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGroupsMembers indicates an expected call of GetGroupsMembers.
+func (mr *MockCompositeProviderServiceMockRecorder) GetGroupsMembers(ctx, gr any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGroupsMembers", reflect.TypeOf((*MockCompositeProviderService)(nil).GetGroupsMembers), ctx, gr)
+}
+
+// GetUsers mocks base method.
+func (m *MockCompositeProviderService) GetUsers(ctx context.Context, filter []string) (*model.UsersResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUsers", ctx, filter)
+	ret0, _ := ret[0].(*model.UsersResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUsers indicates an expected call of GetUsers.
+func (mr *MockCompositeProviderServiceMockRecorder) GetUsers(ctx, filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsers", reflect.TypeOf((*MockCompositeProviderService)(nil).GetUsers), ctx, filter)
+}
+
+// GetUsersByGroupsMembers mocks base method.
+func (m *MockCompositeProviderService) GetUsersByGroupsMembers(ctx context.Context, gmr *model.GroupsMembersResult) (*model.UsersResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUsersByGroupsMembers", ctx, gmr)
+	ret0, _ := ret[0].(*model.UsersResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUsersByGroupsMembers indicates an expected call of GetUsersByGroupsMembers.
+func (mr *MockCompositeProviderServiceMockRecorder) GetUsersByGroupsMembers(ctx, gmr any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsersByGroupsMembers", reflect.TypeOf((*MockCompositeProviderService)(nil).GetUsersByGroupsMembers), ctx, gmr)
+}
@@ -11,6 +11,7 @@ package mocks
 
 import (
 	context "context"
+	iter "iter"
 	reflect "reflect"
 
 	google "github.com/slashdevops/idp-scim-sync/pkg/google"
@@ -106,3 +107,17 @@ func (mr *MockGoogleProviderServiceMockRecorder) ListUsers(ctx, query any) *gomo
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockGoogleProviderService)(nil).ListUsers), ctx, query)
 }
+
+// ListUsersPages mocks base method.
+func (m *MockGoogleProviderService) ListUsersPages(ctx context.Context) iter.Seq2[[]*admin.User, error] {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUsersPages", ctx)
+	ret0, _ := ret[0].(iter.Seq2[[]*admin.User, error])
+	return ret0
+}
+
+// ListUsersPages indicates an expected call of ListUsersPages.
+func (mr *MockGoogleProviderServiceMockRecorder) ListUsersPages(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsersPages", reflect.TypeOf((*MockGoogleProviderService)(nil).ListUsersPages), ctx)
+}
@@ -0,0 +1,72 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ldap.go
+//
+// Generated by this command:
+//
+//	mockgen -package=mocks -destination=../../mocks/idp/ldap_mocks.go -source=ldap.go LDAPProviderService
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	ldap "github.com/slashdevops/idp-scim-sync/pkg/ldap"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockLDAPProviderService is a mock of LDAPProviderService interface.
+type MockLDAPProviderService struct {
+	ctrl     *gomock.Controller
+	recorder *MockLDAPProviderServiceMockRecorder
+	isgomock struct{}
+}
+
+// MockLDAPProviderServiceMockRecorder is the mock recorder for MockLDAPProviderService.
+type MockLDAPProviderServiceMockRecorder struct {
+	mock *MockLDAPProviderService
+}
+
+// NewMockLDAPProviderService creates a new mock instance.
+func NewMockLDAPProviderService(ctrl *gomock.Controller) *MockLDAPProviderService {
+	mock := &MockLDAPProviderService{ctrl: ctrl}
+	mock.recorder = &MockLDAPProviderServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLDAPProviderService) EXPECT() *MockLDAPProviderServiceMockRecorder {
+	return m.recorder
+}
+
+// GetEntry mocks base method.
+func (m *MockLDAPProviderService) GetEntry(ctx context.Context, dn, filter string, attributes []string) (*ldap.Entry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEntry", ctx, dn, filter, attributes)
+	ret0, _ := ret[0].(*ldap.Entry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetEntry indicates an expected call of GetEntry.
+func (mr *MockLDAPProviderServiceMockRecorder) GetEntry(ctx, dn, filter, attributes any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEntry", reflect.TypeOf((*MockLDAPProviderService)(nil).GetEntry), ctx, dn, filter, attributes)
+}
+
+// Search mocks base method.
+func (m *MockLDAPProviderService) Search(ctx context.Context, baseDN, filter string, attributes []string) ([]*ldap.Entry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", ctx, baseDN, filter, attributes)
+	ret0, _ := ret[0].([]*ldap.Entry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockLDAPProviderServiceMockRecorder) Search(ctx, baseDN, filter, attributes any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockLDAPProviderService)(nil).Search), ctx, baseDN, filter, attributes)
+}
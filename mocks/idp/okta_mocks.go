@@ -0,0 +1,117 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: okta.go
+//
+// Generated by this command:
+//
+//	mockgen -package=mocks -destination=../../mocks/idp/okta_mocks.go -source=okta.go OktaProviderService
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	okta "github.com/slashdevops/idp-scim-sync/pkg/okta"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockOktaProviderService is a mock of OktaProviderService interface.
+type MockOktaProviderService struct {
+	ctrl     *gomock.Controller
+	recorder *MockOktaProviderServiceMockRecorder
+	isgomock struct{}
+}
+
+// MockOktaProviderServiceMockRecorder is the mock recorder for MockOktaProviderService.
+type MockOktaProviderServiceMockRecorder struct {
+	mock *MockOktaProviderService
+}
+
+// NewMockOktaProviderService creates a new mock instance.
+func NewMockOktaProviderService(ctrl *gomock.Controller) *MockOktaProviderService {
+	mock := &MockOktaProviderService{ctrl: ctrl}
+	mock.recorder = &MockOktaProviderServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOktaProviderService) EXPECT() *MockOktaProviderServiceMockRecorder {
+	return m.recorder
+}
+
+// GetUser mocks base method.
+func (m *MockOktaProviderService) GetUser(ctx context.Context, userID string) (*okta.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUser", ctx, userID)
+	ret0, _ := ret[0].(*okta.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUser indicates an expected call of GetUser.
+func (mr *MockOktaProviderServiceMockRecorder) GetUser(ctx, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockOktaProviderService)(nil).GetUser), ctx, userID)
+}
+
+// ListGroupMembers mocks base method.
+func (m *MockOktaProviderService) ListGroupMembers(ctx context.Context, groupID string) ([]*okta.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListGroupMembers", ctx, groupID)
+	ret0, _ := ret[0].([]*okta.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListGroupMembers indicates an expected call of ListGroupMembers.
+func (mr *MockOktaProviderServiceMockRecorder) ListGroupMembers(ctx, groupID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListGroupMembers", reflect.TypeOf((*MockOktaProviderService)(nil).ListGroupMembers), ctx, groupID)
+}
+
+// ListGroupRules mocks base method.
+func (m *MockOktaProviderService) ListGroupRules(ctx context.Context) ([]*okta.GroupRule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListGroupRules", ctx)
+	ret0, _ := ret[0].([]*okta.GroupRule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListGroupRules indicates an expected call of ListGroupRules.
+func (mr *MockOktaProviderServiceMockRecorder) ListGroupRules(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListGroupRules", reflect.TypeOf((*MockOktaProviderService)(nil).ListGroupRules), ctx)
+}
+
+// ListGroups mocks base method.
+func (m *MockOktaProviderService) ListGroups(ctx context.Context, search []string) ([]*okta.Group, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListGroups", ctx, search)
+	ret0, _ := ret[0].([]*okta.Group)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListGroups indicates an expected call of ListGroups.
+func (mr *MockOktaProviderServiceMockRecorder) ListGroups(ctx, search any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListGroups", reflect.TypeOf((*MockOktaProviderService)(nil).ListGroups), ctx, search)
+}
+
+// ListUsers mocks base method.
+func (m *MockOktaProviderService) ListUsers(ctx context.Context, search []string) ([]*okta.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUsers", ctx, search)
+	ret0, _ := ret[0].([]*okta.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUsers indicates an expected call of ListUsers.
+func (mr *MockOktaProviderServiceMockRecorder) ListUsers(ctx, search any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockOktaProviderService)(nil).ListUsers), ctx, search)
+}
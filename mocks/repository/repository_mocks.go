@@ -13,6 +13,8 @@ import (
 	context "context"
 	reflect "reflect"
 
+	dynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	kms "github.com/aws/aws-sdk-go-v2/service/kms"
 	s3 "github.com/aws/aws-sdk-go-v2/service/s3"
 	gomock "go.uber.org/mock/gomock"
 )
@@ -41,6 +43,26 @@ func (m *MockS3ClientAPI) EXPECT() *MockS3ClientAPIMockRecorder {
 	return m.recorder
 }
 
+// DeleteObject mocks base method.
+func (m *MockS3ClientAPI) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DeleteObject", varargs...)
+	ret0, _ := ret[0].(*s3.DeleteObjectOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteObject indicates an expected call of DeleteObject.
+func (mr *MockS3ClientAPIMockRecorder) DeleteObject(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteObject", reflect.TypeOf((*MockS3ClientAPI)(nil).DeleteObject), varargs...)
+}
+
 // GetObject mocks base method.
 func (m *MockS3ClientAPI) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
 	m.ctrl.T.Helper()
@@ -61,6 +83,26 @@ func (mr *MockS3ClientAPIMockRecorder) GetObject(ctx, params any, optFns ...any)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetObject", reflect.TypeOf((*MockS3ClientAPI)(nil).GetObject), varargs...)
 }
 
+// ListObjectsV2 mocks base method.
+func (m *MockS3ClientAPI) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ListObjectsV2", varargs...)
+	ret0, _ := ret[0].(*s3.ListObjectsV2Output)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListObjectsV2 indicates an expected call of ListObjectsV2.
+func (mr *MockS3ClientAPIMockRecorder) ListObjectsV2(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListObjectsV2", reflect.TypeOf((*MockS3ClientAPI)(nil).ListObjectsV2), varargs...)
+}
+
 // PutObject mocks base method.
 func (m *MockS3ClientAPI) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
 	m.ctrl.T.Helper()
@@ -80,3 +122,151 @@ func (mr *MockS3ClientAPIMockRecorder) PutObject(ctx, params any, optFns ...any)
 	varargs := append([]any{ctx, params}, optFns...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutObject", reflect.TypeOf((*MockS3ClientAPI)(nil).PutObject), varargs...)
 }
+
+// MockDynamoDBClientAPI is a mock of DynamoDBClientAPI interface.
+type MockDynamoDBClientAPI struct {
+	ctrl     *gomock.Controller
+	recorder *MockDynamoDBClientAPIMockRecorder
+	isgomock struct{}
+}
+
+// MockDynamoDBClientAPIMockRecorder is the mock recorder for MockDynamoDBClientAPI.
+type MockDynamoDBClientAPIMockRecorder struct {
+	mock *MockDynamoDBClientAPI
+}
+
+// NewMockDynamoDBClientAPI creates a new mock instance.
+func NewMockDynamoDBClientAPI(ctrl *gomock.Controller) *MockDynamoDBClientAPI {
+	mock := &MockDynamoDBClientAPI{ctrl: ctrl}
+	mock.recorder = &MockDynamoDBClientAPIMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDynamoDBClientAPI) EXPECT() *MockDynamoDBClientAPIMockRecorder {
+	return m.recorder
+}
+
+// DeleteItem mocks base method.
+func (m *MockDynamoDBClientAPI) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DeleteItem", varargs...)
+	ret0, _ := ret[0].(*dynamodb.DeleteItemOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteItem indicates an expected call of DeleteItem.
+func (mr *MockDynamoDBClientAPIMockRecorder) DeleteItem(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteItem", reflect.TypeOf((*MockDynamoDBClientAPI)(nil).DeleteItem), varargs...)
+}
+
+// GetItem mocks base method.
+func (m *MockDynamoDBClientAPI) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetItem", varargs...)
+	ret0, _ := ret[0].(*dynamodb.GetItemOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetItem indicates an expected call of GetItem.
+func (mr *MockDynamoDBClientAPIMockRecorder) GetItem(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItem", reflect.TypeOf((*MockDynamoDBClientAPI)(nil).GetItem), varargs...)
+}
+
+// PutItem mocks base method.
+func (m *MockDynamoDBClientAPI) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "PutItem", varargs...)
+	ret0, _ := ret[0].(*dynamodb.PutItemOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PutItem indicates an expected call of PutItem.
+func (mr *MockDynamoDBClientAPIMockRecorder) PutItem(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutItem", reflect.TypeOf((*MockDynamoDBClientAPI)(nil).PutItem), varargs...)
+}
+
+// MockKMSClientAPI is a mock of KMSClientAPI interface.
+type MockKMSClientAPI struct {
+	ctrl     *gomock.Controller
+	recorder *MockKMSClientAPIMockRecorder
+	isgomock struct{}
+}
+
+// MockKMSClientAPIMockRecorder is the mock recorder for MockKMSClientAPI.
+type MockKMSClientAPIMockRecorder struct {
+	mock *MockKMSClientAPI
+}
+
+// NewMockKMSClientAPI creates a new mock instance.
+func NewMockKMSClientAPI(ctrl *gomock.Controller) *MockKMSClientAPI {
+	mock := &MockKMSClientAPI{ctrl: ctrl}
+	mock.recorder = &MockKMSClientAPIMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockKMSClientAPI) EXPECT() *MockKMSClientAPIMockRecorder {
+	return m.recorder
+}
+
+// Decrypt mocks base method.
+func (m *MockKMSClientAPI) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Decrypt", varargs...)
+	ret0, _ := ret[0].(*kms.DecryptOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Decrypt indicates an expected call of Decrypt.
+func (mr *MockKMSClientAPIMockRecorder) Decrypt(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Decrypt", reflect.TypeOf((*MockKMSClientAPI)(nil).Decrypt), varargs...)
+}
+
+// GenerateDataKey mocks base method.
+func (m *MockKMSClientAPI) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GenerateDataKey", varargs...)
+	ret0, _ := ret[0].(*kms.GenerateDataKeyOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GenerateDataKey indicates an expected call of GenerateDataKey.
+func (mr *MockKMSClientAPIMockRecorder) GenerateDataKey(ctx, params any, optFns ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateDataKey", reflect.TypeOf((*MockKMSClientAPI)(nil).GenerateDataKey), varargs...)
+}
@@ -0,0 +1,238 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: generic.go
+//
+// Generated by this command:
+//
+//	mockgen -package=mocks -destination=../../mocks/scim/generic_mocks.go -source=generic.go GenericSCIMService
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	scim "github.com/slashdevops/idp-scim-sync/pkg/scim"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockGenericSCIMService is a mock of GenericSCIMService interface.
+type MockGenericSCIMService struct {
+	ctrl     *gomock.Controller
+	recorder *MockGenericSCIMServiceMockRecorder
+	isgomock struct{}
+}
+
+// MockGenericSCIMServiceMockRecorder is the mock recorder for MockGenericSCIMService.
+type MockGenericSCIMServiceMockRecorder struct {
+	mock *MockGenericSCIMService
+}
+
+// NewMockGenericSCIMService creates a new mock instance.
+func NewMockGenericSCIMService(ctrl *gomock.Controller) *MockGenericSCIMService {
+	mock := &MockGenericSCIMService{ctrl: ctrl}
+	mock.recorder = &MockGenericSCIMServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockGenericSCIMService) EXPECT() *MockGenericSCIMServiceMockRecorder {
+	return m.recorder
+}
+
+// CreateOrGetGroup mocks base method.
+func (m *MockGenericSCIMService) CreateOrGetGroup(ctx context.Context, group *scim.Group) (*scim.Group, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOrGetGroup", ctx, group)
+	ret0, _ := ret[0].(*scim.Group)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateOrGetGroup indicates an expected call of CreateOrGetGroup.
+func (mr *MockGenericSCIMServiceMockRecorder) CreateOrGetGroup(ctx, group any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrGetGroup", reflect.TypeOf((*MockGenericSCIMService)(nil).CreateOrGetGroup), ctx, group)
+}
+
+// CreateOrGetUser mocks base method.
+func (m *MockGenericSCIMService) CreateOrGetUser(ctx context.Context, user *scim.User) (*scim.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOrGetUser", ctx, user)
+	ret0, _ := ret[0].(*scim.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateOrGetUser indicates an expected call of CreateOrGetUser.
+func (mr *MockGenericSCIMServiceMockRecorder) CreateOrGetUser(ctx, user any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrGetUser", reflect.TypeOf((*MockGenericSCIMService)(nil).CreateOrGetUser), ctx, user)
+}
+
+// DeleteGroup mocks base method.
+func (m *MockGenericSCIMService) DeleteGroup(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteGroup", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteGroup indicates an expected call of DeleteGroup.
+func (mr *MockGenericSCIMServiceMockRecorder) DeleteGroup(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteGroup", reflect.TypeOf((*MockGenericSCIMService)(nil).DeleteGroup), ctx, id)
+}
+
+// DeleteUser mocks base method.
+func (m *MockGenericSCIMService) DeleteUser(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockGenericSCIMServiceMockRecorder) DeleteUser(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockGenericSCIMService)(nil).DeleteUser), ctx, id)
+}
+
+// GetGroup mocks base method.
+func (m *MockGenericSCIMService) GetGroup(ctx context.Context, id string) (*scim.Group, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGroup", ctx, id)
+	ret0, _ := ret[0].(*scim.Group)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGroup indicates an expected call of GetGroup.
+func (mr *MockGenericSCIMServiceMockRecorder) GetGroup(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGroup", reflect.TypeOf((*MockGenericSCIMService)(nil).GetGroup), ctx, id)
+}
+
+// GetUser mocks base method.
+func (m *MockGenericSCIMService) GetUser(ctx context.Context, id string) (*scim.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUser", ctx, id)
+	ret0, _ := ret[0].(*scim.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUser indicates an expected call of GetUser.
+func (mr *MockGenericSCIMServiceMockRecorder) GetUser(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockGenericSCIMService)(nil).GetUser), ctx, id)
+}
+
+// GetUserByUserName mocks base method.
+func (m *MockGenericSCIMService) GetUserByUserName(ctx context.Context, userName string) (*scim.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByUserName", ctx, userName)
+	ret0, _ := ret[0].(*scim.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByUserName indicates an expected call of GetUserByUserName.
+func (mr *MockGenericSCIMServiceMockRecorder) GetUserByUserName(ctx, userName any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByUserName", reflect.TypeOf((*MockGenericSCIMService)(nil).GetUserByUserName), ctx, userName)
+}
+
+// ListGroups mocks base method.
+func (m *MockGenericSCIMService) ListGroups(ctx context.Context, filter string) ([]*scim.Group, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListGroups", ctx, filter)
+	ret0, _ := ret[0].([]*scim.Group)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListGroups indicates an expected call of ListGroups.
+func (mr *MockGenericSCIMServiceMockRecorder) ListGroups(ctx, filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListGroups", reflect.TypeOf((*MockGenericSCIMService)(nil).ListGroups), ctx, filter)
+}
+
+// ListUsers mocks base method.
+func (m *MockGenericSCIMService) ListUsers(ctx context.Context, filter string) ([]*scim.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUsers", ctx, filter)
+	ret0, _ := ret[0].([]*scim.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUsers indicates an expected call of ListUsers.
+func (mr *MockGenericSCIMServiceMockRecorder) ListUsers(ctx, filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockGenericSCIMService)(nil).ListUsers), ctx, filter)
+}
+
+// PatchGroup mocks base method.
+func (m *MockGenericSCIMService) PatchGroup(ctx context.Context, id string, operations ...*scim.Operation) error {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, id}
+	for _, a := range operations {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "PatchGroup", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PatchGroup indicates an expected call of PatchGroup.
+func (mr *MockGenericSCIMServiceMockRecorder) PatchGroup(ctx, id any, operations ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, id}, operations...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchGroup", reflect.TypeOf((*MockGenericSCIMService)(nil).PatchGroup), varargs...)
+}
+
+// Profile mocks base method.
+func (m *MockGenericSCIMService) Profile() scim.Profile {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Profile")
+	ret0, _ := ret[0].(scim.Profile)
+	return ret0
+}
+
+// Profile indicates an expected call of Profile.
+func (mr *MockGenericSCIMServiceMockRecorder) Profile() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Profile", reflect.TypeOf((*MockGenericSCIMService)(nil).Profile))
+}
+
+// ReplaceGroup mocks base method.
+func (m *MockGenericSCIMService) ReplaceGroup(ctx context.Context, group *scim.Group) (*scim.Group, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceGroup", ctx, group)
+	ret0, _ := ret[0].(*scim.Group)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReplaceGroup indicates an expected call of ReplaceGroup.
+func (mr *MockGenericSCIMServiceMockRecorder) ReplaceGroup(ctx, group any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceGroup", reflect.TypeOf((*MockGenericSCIMService)(nil).ReplaceGroup), ctx, group)
+}
+
+// ReplaceUser mocks base method.
+func (m *MockGenericSCIMService) ReplaceUser(ctx context.Context, user *scim.User) (*scim.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceUser", ctx, user)
+	ret0, _ := ret[0].(*scim.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReplaceUser indicates an expected call of ReplaceUser.
+func (mr *MockGenericSCIMServiceMockRecorder) ReplaceUser(ctx, user any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceUser", reflect.TypeOf((*MockGenericSCIMService)(nil).ReplaceUser), ctx, user)
+}
@@ -6,11 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"iter"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"path"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -54,6 +56,9 @@ var (
 	ErrBearerTokenEmpty = errors.Errorf("aws: bearer token may not be empty")
 )
 
+// DefaultPageSize is the number of resources requested per page by the list methods.
+const DefaultPageSize = 50
+
 //go:generate go run go.uber.org/mock/mockgen@v0.5.0 -package=mocks -destination=../../mocks/aws/scim_mocks.go -source=scim.go HTTPClient
 
 // HTTPClient is an interface for sending HTTP requests.
@@ -67,6 +72,10 @@ type SCIMService struct {
 	url         *url.URL
 	UserAgent   string
 	bearerToken string
+
+	// PageSize is the number of resources requested per page by the list methods,
+	// DefaultPageSize is used when it is zero or less
+	PageSize int
 }
 
 // NewSCIMService creates a new AWS SCIM Service.
@@ -130,13 +139,17 @@ func (s *SCIMService) newRequest(ctx context.Context, method string, u *url.URL,
 }
 
 // do sends an HTTP request and returns an HTTP response, following policy (e.g. redirects, cookies, auth) as configured on the client.
-func (s *SCIMService) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+// The request is traced in a client span, child of the span in ctx.
+func (s *SCIMService) do(ctx context.Context, req *http.Request) (resp *http.Response, err error) {
+	ctx, span := s.startSpan(ctx, req)
+	defer func() { endSpan(span, resp, err) }()
+
 	req = req.WithContext(ctx)
 
 	// Set bearer token
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.bearerToken))
 
-	resp, err := s.httpClient.Do(req)
+	resp, err = s.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("aws do: error sending request: %w", err)
 	}
@@ -513,42 +526,22 @@ func (s *SCIMService) GetUser(ctx context.Context, userID string) (*GetUserRespo
 	return &response, nil
 }
 
-// ListUsers returns a list of users from the AWS SSO Using the API
+// ListUsers returns all the users that match the filter from the AWS SSO Using the API,
+// all the pages of the response are read. Use AllUsers to iterate over the users page by page.
 func (s *SCIMService) ListUsers(ctx context.Context, filter string) (*ListUsersResponse, error) {
-	reqURL, err := url.Parse(s.url.String())
+	lr, users, err := list[User](ctx, s, "ListUsers", "/Users", filter)
 	if err != nil {
-		return nil, fmt.Errorf("aws ListUsers: error parsing url: %w", err)
-	}
-
-	reqURL.Path = path.Join(reqURL.Path, "/Users")
-
-	if filter != "" {
-		q := reqURL.Query()
-		q.Add("filter", filter)
-		reqURL.RawQuery = q.Encode()
-	}
-
-	req, err := s.newRequest(ctx, http.MethodGet, reqURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("aws ListUsers: error creating request, http method: %s, url: %v, error: %w", http.MethodGet, reqURL.String(), err)
-	}
-
-	resp, err := s.do(ctx, req)
-	if err != nil {
-		return nil, fmt.Errorf("aws ListUsers: error sending request, http method: %s, url: %v, error: %w", http.MethodGet, reqURL.String(), err)
-	}
-	defer resp.Body.Close()
-
-	if e := s.checkHTTPResponse(resp); e != nil {
-		return nil, e
+		return nil, err
 	}
 
-	var response ListUsersResponse
-	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("aws ListUsers: error decoding response body: %w", err)
-	}
+	return &ListUsersResponse{ListResponse: lr, Resources: users}, nil
+}
 
-	return &response, nil
+// AllUsers returns an iterator over the users that match the filter from the AWS SSO Using the API,
+// the pages are requested while the iteration goes on. When a page cannot be read the iterator
+// yields the error and stops.
+func (s *SCIMService) AllUsers(ctx context.Context, filter string) iter.Seq2[*User, error] {
+	return all[User](ctx, s, "ListUsers", "/Users", filter)
 }
 
 // PatchUser updates a user in the AWS SSO Using the API
@@ -680,29 +673,128 @@ func (s *SCIMService) GetGroupByDisplayName(ctx context.Context, displayName str
 	return &response, nil
 }
 
-// ListGroups returns a list of groups from the AWS SSO Using the API
+// ListGroups returns all the groups that match the filter from the AWS SSO Using the API,
+// all the pages of the response are read. Use AllGroups to iterate over the groups page by page.
 func (s *SCIMService) ListGroups(ctx context.Context, filter string) (*ListGroupsResponse, error) {
+	lr, groups, err := list[Group](ctx, s, "ListGroups", "/Groups", filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListGroupsResponse{ListResponse: lr, Resources: groups}, nil
+}
+
+// AllGroups returns an iterator over the groups that match the filter from the AWS SSO Using the API,
+// the pages are requested while the iteration goes on. When a page cannot be read the iterator
+// yields the error and stops.
+func (s *SCIMService) AllGroups(ctx context.Context, filter string) iter.Seq2[*Group, error] {
+	return all[Group](ctx, s, "ListGroups", "/Groups", filter)
+}
+
+// listPage is a page of a list response
+type listPage[T any] struct {
+	ListResponse
+	Resources []*T `json:"Resources"`
+}
+
+// list returns all the resources that match the filter, reading all the pages.
+// The returned ListResponse keeps the totalResults of the service provider, because the
+// AWS SSO SCIM API uses it to tell if a group has a member without returning the members.
+func list[T any](ctx context.Context, s *SCIMService, op, resource, filter string) (ListResponse, []*T, error) {
+	var lr ListResponse
+	resources := make([]*T, 0)
+
+	for page, err := range pages[T](ctx, s, op, resource, filter) {
+		if err != nil {
+			return ListResponse{}, nil, err
+		}
+
+		if len(lr.Schemas) == 0 {
+			lr = page.ListResponse
+		}
+		resources = append(resources, page.Resources...)
+	}
+
+	lr.StartIndex = 1
+	lr.ItemsPerPage = len(resources)
+
+	return lr, resources, nil
+}
+
+// all returns an iterator over the resources that match the filter.
+func all[T any](ctx context.Context, s *SCIMService, op, resource, filter string) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		for page, err := range pages[T](ctx, s, op, resource, filter) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			for _, r := range page.Resources {
+				if !yield(r, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// pages returns an iterator over the pages of the resources that match the filter, following the
+// startIndex, itemsPerPage and totalResults of the list responses. When a page cannot be read
+// the iterator yields the error and stops.
+// reference: https://datatracker.ietf.org/doc/html/rfc7644#section-3.4.2.4
+func pages[T any](ctx context.Context, s *SCIMService, op, resource, filter string) iter.Seq2[*listPage[T], error] {
+	return func(yield func(*listPage[T], error) bool) {
+		read := 0
+		for startIndex := 1; ; {
+			page, err := listPageOf[T](ctx, s, op, resource, filter, startIndex)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			if !yield(page, nil) {
+				return
+			}
+
+			read += len(page.Resources)
+
+			// the service provider could return less resources than requested in every page,
+			// so the last page is the one that completes the total results
+			if len(page.Resources) == 0 || read >= page.TotalResults {
+				return
+			}
+
+			startIndex += len(page.Resources)
+		}
+	}
+}
+
+// listPageOf requests the page of the resources that match the filter starting at startIndex.
+func listPageOf[T any](ctx context.Context, s *SCIMService, op, resource, filter string, startIndex int) (*listPage[T], error) {
 	reqURL, err := url.Parse(s.url.String())
 	if err != nil {
-		return nil, fmt.Errorf("aws ListGroups: error parsing url: %w", err)
+		return nil, fmt.Errorf("aws %s: error parsing url: %w", op, err)
 	}
 
-	reqURL.Path = path.Join(reqURL.Path, "/Groups")
+	reqURL.Path = path.Join(reqURL.Path, resource)
 
+	q := reqURL.Query()
 	if filter != "" {
-		q := reqURL.Query()
 		q.Add("filter", filter)
-		reqURL.RawQuery = q.Encode()
 	}
+	q.Add("startIndex", strconv.Itoa(startIndex))
+	q.Add("count", strconv.Itoa(s.pageSize()))
+	reqURL.RawQuery = q.Encode()
 
 	req, err := s.newRequest(ctx, http.MethodGet, reqURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("aws ListGroups: error creating request, http method: %s, url: %v, error: %w", http.MethodGet, reqURL.String(), err)
+		return nil, fmt.Errorf("aws %s: error creating request, http method: %s, url: %v, error: %w", op, http.MethodGet, reqURL.String(), err)
 	}
 
 	resp, err := s.do(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("aws ListGroups: error sending request, http method: %s, url: %v, error: %w", http.MethodGet, reqURL.String(), err)
+		return nil, fmt.Errorf("aws %s: error sending request, http method: %s, url: %v, error: %w", op, http.MethodGet, reqURL.String(), err)
 	}
 	defer resp.Body.Close()
 
@@ -710,12 +802,22 @@ func (s *SCIMService) ListGroups(ctx context.Context, filter string) (*ListGroup
 		return nil, e
 	}
 
-	var response ListGroupsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("aws ListGroups: error decoding response body: %w", err)
+	var page listPage[T]
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("aws %s: error decoding response body: %w", op, err)
 	}
 
-	return &response, nil
+	slog.Debug("aws: listPageOf()", "op", op, "startIndex", startIndex, "resources", len(page.Resources), "totalResults", page.TotalResults)
+
+	return &page, nil
+}
+
+// pageSize returns the number of resources requested per page.
+func (s *SCIMService) pageSize() int {
+	if s.PageSize <= 0 {
+		return DefaultPageSize
+	}
+	return s.PageSize
 }
 
 // CreateGroup creates a new group in the AWS SSO Using the API
@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -1235,6 +1236,8 @@ func TestListUsers(t *testing.T) {
 
 		q := reqURL.Query()
 		q.Add("filter", filter)
+		q.Add("startIndex", "1")
+		q.Add("count", strconv.Itoa(DefaultPageSize))
 		reqURL.RawQuery = q.Encode()
 
 		httpReq, err := http.NewRequestWithContext(context.Background(), "GET", reqURL.String(), nil)
@@ -1944,6 +1947,8 @@ func TestListGroups(t *testing.T) {
 
 		q := reqURL.Query()
 		q.Add("filter", filter)
+		q.Add("startIndex", "1")
+		q.Add("count", strconv.Itoa(DefaultPageSize))
 		reqURL.RawQuery = q.Encode()
 
 		httpReq, err := http.NewRequestWithContext(context.Background(), "GET", reqURL.String(), nil)
@@ -1980,3 +1985,159 @@ func TestListGroups(t *testing.T) {
 		assert.Equal(t, "Group Foo", got.Resources[0].DisplayName)
 	})
 }
+
+// newPagedSCIMServer returns a server that lists the given number of resources using the startIndex
+// and count query parameters, it fails with an internal server error when startIndex is failAt
+func newPagedSCIMServer(t *testing.T, total, failAt int, requests *[]string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.URL.RawQuery)
+
+		startIndex, err := strconv.Atoi(r.URL.Query().Get("startIndex"))
+		assert.NoError(t, err)
+		count, err := strconv.Atoi(r.URL.Query().Get("count"))
+		assert.NoError(t, err)
+
+		if startIndex == failAt {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		resources := make([]string, 0)
+		for i := startIndex; i < startIndex+count && i <= total; i++ {
+			if strings.HasSuffix(r.URL.Path, "/Groups") {
+				resources = append(resources, fmt.Sprintf(`{"id": "group-%d", "displayName": "group %d"}`, i, i))
+			} else {
+				resources = append(resources, fmt.Sprintf(`{"id": "user-%d", "userName": "user.%d"}`, i, i))
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"totalResults": %d, "itemsPerPage": %d, "startIndex": %d, "schemas": ["urn:ietf:params:scim:api:messages:2.0:ListResponse"], "Resources": [%s]}`,
+			total, len(resources), startIndex, strings.Join(resources, ","))
+	}))
+}
+
+func TestListUsersPagination(t *testing.T) {
+	t.Run("all the pages are read", func(t *testing.T) {
+		var requests []string
+		server := newPagedSCIMServer(t, 5, 0, &requests)
+		defer server.Close()
+
+		service, err := NewSCIMService(server.Client(), server.URL, "MyToken")
+		assert.NoError(t, err)
+		service.PageSize = 2
+
+		got, err := service.ListUsers(context.Background(), "")
+		assert.NoError(t, err)
+		assert.Equal(t, 5, got.TotalResults)
+		assert.Equal(t, 5, len(got.Resources))
+		assert.Equal(t, "user-1", got.Resources[0].ID)
+		assert.Equal(t, "user-5", got.Resources[4].ID)
+		assert.Equal(t, []string{"count=2&startIndex=1", "count=2&startIndex=3", "count=2&startIndex=5"}, requests)
+	})
+
+	t.Run("error reading a page", func(t *testing.T) {
+		var requests []string
+		server := newPagedSCIMServer(t, 5, 3, &requests)
+		defer server.Close()
+
+		service, err := NewSCIMService(server.Client(), server.URL, "MyToken")
+		assert.NoError(t, err)
+		service.PageSize = 2
+
+		got, err := service.ListUsers(context.Background(), "")
+		assert.Error(t, err)
+		assert.Nil(t, got)
+
+		var httpErr *HTTPResponseError
+		assert.ErrorAs(t, err, &httpErr)
+		assert.Equal(t, http.StatusInternalServerError, httpErr.StatusCode)
+	})
+}
+
+func TestListGroupsPagination(t *testing.T) {
+	var requests []string
+	server := newPagedSCIMServer(t, 3, 0, &requests)
+	defer server.Close()
+
+	service, err := NewSCIMService(server.Client(), server.URL, "MyToken")
+	assert.NoError(t, err)
+	service.PageSize = 2
+
+	got, err := service.ListGroups(context.Background(), "displayName sw \"group\"")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, got.TotalResults)
+	assert.Equal(t, 3, len(got.Resources))
+	assert.Equal(t, "group-3", got.Resources[2].ID)
+	assert.Equal(t, 2, len(requests))
+	assert.Contains(t, requests[0], "filter=displayName+sw+%22group%22")
+}
+
+func TestAllUsers(t *testing.T) {
+	t.Run("pages are requested while iterating", func(t *testing.T) {
+		var requests []string
+		server := newPagedSCIMServer(t, 5, 0, &requests)
+		defer server.Close()
+
+		service, err := NewSCIMService(server.Client(), server.URL, "MyToken")
+		assert.NoError(t, err)
+		service.PageSize = 2
+
+		ids := make([]string, 0)
+		for user, err := range service.AllUsers(context.Background(), "") {
+			assert.NoError(t, err)
+			ids = append(ids, user.ID)
+
+			if len(ids) == 3 {
+				break
+			}
+		}
+
+		assert.Equal(t, []string{"user-1", "user-2", "user-3"}, ids)
+		assert.Equal(t, 2, len(requests))
+	})
+
+	t.Run("the error stops the iteration", func(t *testing.T) {
+		var requests []string
+		server := newPagedSCIMServer(t, 5, 3, &requests)
+		defer server.Close()
+
+		service, err := NewSCIMService(server.Client(), server.URL, "MyToken")
+		assert.NoError(t, err)
+		service.PageSize = 2
+
+		users, errs := 0, 0
+		for user, err := range service.AllUsers(context.Background(), "") {
+			if err != nil {
+				errs++
+				assert.Nil(t, user)
+				continue
+			}
+			users++
+		}
+
+		assert.Equal(t, 2, users)
+		assert.Equal(t, 1, errs)
+	})
+}
+
+func TestAllGroups(t *testing.T) {
+	var requests []string
+	server := newPagedSCIMServer(t, 4, 0, &requests)
+	defer server.Close()
+
+	service, err := NewSCIMService(server.Client(), server.URL, "MyToken")
+	assert.NoError(t, err)
+	service.PageSize = 2
+
+	ids := make([]string, 0)
+	for group, err := range service.AllGroups(context.Background(), "") {
+		assert.NoError(t, err)
+		ids = append(ids, group.ID)
+	}
+
+	assert.Equal(t, []string{"group-1", "group-2", "group-3", "group-4"}, ids)
+	assert.Equal(t, 2, len(requests))
+}
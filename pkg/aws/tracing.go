@@ -0,0 +1,60 @@
+package aws
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the tracer of the spans of the SCIM requests.
+const tracerName = "github.com/slashdevops/idp-scim-sync/pkg/aws"
+
+// startSpan starts a client span for the request as a child of the span in ctx, using the tracer provider
+// of that span. When ctx doesn't have a recording span the span doesn't record and ctx is returned as it is.
+func (s *SCIMService) startSpan(ctx context.Context, req *http.Request) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+
+	spanCtx, span := tracer.Start(ctx, "SCIM "+req.Method+" "+s.resourcePath(req),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.String()),
+			attribute.String("server.address", req.URL.Hostname()),
+		),
+	)
+	if !span.IsRecording() {
+		return ctx, span
+	}
+
+	return spanCtx, span
+}
+
+// endSpan records the status code of the response, or the error of the request, and ends the span.
+func endSpan(span trace.Span, resp *http.Response, err error) {
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	case resp != nil:
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		if resp.StatusCode >= http.StatusBadRequest {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+
+	span.End()
+}
+
+// resourcePath returns the SCIM resource of the request, like /Users, without the ids,
+// so the spans of the requests to the same resource have the same name.
+func (s *SCIMService) resourcePath(req *http.Request) string {
+	p := strings.TrimPrefix(req.URL.Path, s.url.Path)
+	p = strings.TrimPrefix(p, "/")
+
+	resource, _, _ := strings.Cut(p, "/")
+	return "/" + resource
+}
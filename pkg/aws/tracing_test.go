@@ -0,0 +1,91 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mocks "github.com/slashdevops/idp-scim-sync/mocks/aws"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/mock/gomock"
+)
+
+func TestDoTracing(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	endpoint := "https://testing.com/scim/v2"
+
+	// newParent returns a context with a recording span and the exporter of its spans
+	newParent := func() (context.Context, trace.Span, *tracetest.InMemoryExporter) {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+		ctx, span := tp.Tracer("test").Start(context.Background(), "parent")
+		return ctx, span, exporter
+	}
+
+	t.Run("traces the request with the status code as a child of the span in the context", func(t *testing.T) {
+		mockHTTPClient := mocks.NewMockHTTPClient(mockCtrl)
+		mockHTTPClient.EXPECT().Do(gomock.Any()).Return(&http.Response{Status: "409 Conflict", StatusCode: http.StatusConflict}, nil)
+
+		service, err := NewSCIMService(mockHTTPClient, endpoint, "MyToken")
+		assert.NoError(t, err)
+
+		ctx, parent, exporter := newParent()
+		req := httptest.NewRequest(http.MethodPatch, endpoint+"/Users/9067729b3d-94f1e0b3", nil)
+
+		_, err = service.do(ctx, req)
+		assert.NoError(t, err)
+		parent.End()
+
+		spans := exporter.GetSpans()
+		assert.Equal(t, 2, len(spans))
+		assert.Equal(t, "SCIM PATCH /Users", spans[0].Name)
+		assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind)
+		assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent.SpanID())
+		assert.Contains(t, spans[0].Attributes, attribute.String("http.request.method", http.MethodPatch))
+		assert.Contains(t, spans[0].Attributes, attribute.Int("http.response.status_code", http.StatusConflict))
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+	})
+
+	t.Run("traces the error of the request", func(t *testing.T) {
+		mockHTTPClient := mocks.NewMockHTTPClient(mockCtrl)
+		mockHTTPClient.EXPECT().Do(gomock.Any()).Return(nil, errors.New("test error"))
+
+		service, err := NewSCIMService(mockHTTPClient, endpoint, "MyToken")
+		assert.NoError(t, err)
+
+		ctx, parent, exporter := newParent()
+		req := httptest.NewRequest(http.MethodGet, endpoint+"/Groups?filter=displayName", nil)
+
+		_, err = service.do(ctx, req)
+		assert.Error(t, err)
+		parent.End()
+
+		spans := exporter.GetSpans()
+		assert.Equal(t, "SCIM GET /Groups", spans[0].Name)
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+	})
+
+	t.Run("doesn't trace the request without a span in the context", func(t *testing.T) {
+		ctx := context.Background()
+
+		mockHTTPClient := mocks.NewMockHTTPClient(mockCtrl)
+		mockHTTPClient.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, ctx, req.Context())
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		})
+
+		service, err := NewSCIMService(mockHTTPClient, endpoint, "MyToken")
+		assert.NoError(t, err)
+
+		_, err = service.do(ctx, httptest.NewRequest(http.MethodGet, endpoint+"/Users", nil))
+		assert.NoError(t, err)
+	})
+}
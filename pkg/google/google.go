@@ -2,7 +2,9 @@ package google
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"iter"
 	"log/slog"
 
 	"golang.org/x/oauth2/google"
@@ -17,6 +19,10 @@ const (
 	membersRequiredFields   googleapi.Field = "nextPageToken, members(id,email,status,type,etag)"
 	listUsersRequiredFields googleapi.Field = "nextPageToken, users(id,primaryEmail,name,suspended,kind,etag,emails,addresses,organizations,phones,languages,locations)"
 	getUsersRequiredFields  googleapi.Field = "id,primaryEmail,name,suspended,kind,etag,emails,addresses,organizations,phones,languages,locations"
+
+	// UsersPageSize is the maximum number of users per page of the users list
+	// https://developers.google.com/admin-sdk/directory/reference/rest/v1/users/list
+	UsersPageSize = 500
 )
 
 var (
@@ -110,6 +116,27 @@ func (ds *DirectoryService) ListUsers(ctx context.Context, query []string) ([]*a
 	return u, nil
 }
 
+// errStopPages stops the pages of a list when the iteration is stopped by the caller.
+var errStopPages = errors.New("google: stop pages")
+
+// ListUsersPages returns an iterator over the pages of all the users in a Google Directory,
+// the pages are requested while the iteration goes on, so stopping it saves the remaining requests.
+func (ds *DirectoryService) ListUsersPages(ctx context.Context) iter.Seq2[[]*admin.User, error] {
+	return func(yield func([]*admin.User, error) bool) {
+		err := ds.svc.Users.List().Customer("my_customer").MaxResults(UsersPageSize).Fields(listUsersRequiredFields).Pages(ctx, func(users *admin.Users) error {
+			slog.Debug("google: ListUsersPages()", "users", len(users.Users))
+
+			if !yield(users.Users, nil) {
+				return errStopPages
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopPages) {
+			yield(nil, err)
+		}
+	}
+}
+
 // ListGroups list all groups in a Google Directory filtered by query.
 // References:
 // - https://developers.google.com/admin-sdk/directory/reference/rest/v1/groups
@@ -211,7 +238,7 @@ func (ds *DirectoryService) GetUser(ctx context.Context, userID string) (*admin.
 
 	u, err := ds.svc.Users.Get(userID).Fields(getUsersRequiredFields).Context(ctx).Do()
 	if err != nil {
-		return nil, fmt.Errorf("google: error getting user %s: %v", userID, err)
+		return nil, fmt.Errorf("google: error getting user %s: %w", userID, err)
 	}
 
 	return u, nil
@@ -225,7 +252,7 @@ func (ds *DirectoryService) GetGroup(ctx context.Context, groupID string) (*admi
 
 	g, err := ds.svc.Groups.Get(groupID).Fields(groupsRequiredFields).Context(ctx).Do()
 	if err != nil {
-		return nil, fmt.Errorf("google: error getting group %s: %v", groupID, err)
+		return nil, fmt.Errorf("google: error getting group %s: %w", groupID, err)
 	}
 
 	slog.Debug("google: GetGroup()", "group", g)
@@ -391,6 +391,75 @@ func TestNewDirectoryService_ListUsers(t *testing.T) {
 	})
 }
 
+func TestNewDirectoryService_ListUsersPages(t *testing.T) {
+	ctx := context.TODO()
+
+	pages := map[string]*admin.Users{
+		"": {
+			NextPageToken: "page-2",
+			Users:         []*admin.User{{Id: "1", PrimaryEmail: "user.1@mail.com"}, {Id: "2", PrimaryEmail: "user.2@mail.com"}},
+		},
+		"page-2": {
+			Users: []*admin.User{{Id: "3", PrimaryEmail: "user.3@mail.com"}},
+		},
+	}
+
+	newClient := func(t *testing.T, requests *int) *DirectoryService {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*requests++
+			assert.Equal(t, "/admin/directory/v1/users", r.URL.Path)
+			assert.Equal(t, "500", r.URL.Query().Get("maxResults"))
+
+			page, ok := pages[r.URL.Query().Get("pageToken")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			jsonBytes, err := page.MarshalJSON()
+			assert.NoError(t, err)
+			_, _ = w.Write(jsonBytes)
+		}))
+		t.Cleanup(svr.Close)
+
+		svc, err := admin.NewService(ctx, option.WithHTTPClient(svr.Client()), option.WithEndpoint(svr.URL), option.WithUserAgent("test"))
+		assert.NoError(t, err)
+
+		client, err := NewDirectoryService(svc)
+		assert.NoError(t, err)
+		return client
+	}
+
+	t.Run("should return all the pages", func(t *testing.T) {
+		requests := 0
+		client := newClient(t, &requests)
+
+		ids := make([]string, 0)
+		for users, err := range client.ListUsersPages(ctx) {
+			assert.NoError(t, err)
+			for _, u := range users {
+				ids = append(ids, u.Id)
+			}
+		}
+
+		assert.Equal(t, []string{"1", "2", "3"}, ids)
+		assert.Equal(t, 2, requests)
+	})
+
+	t.Run("should not request the next pages when the iteration stops", func(t *testing.T) {
+		requests := 0
+		client := newClient(t, &requests)
+
+		for users, err := range client.ListUsersPages(ctx) {
+			assert.NoError(t, err)
+			assert.Len(t, users, 2)
+			break
+		}
+
+		assert.Equal(t, 1, requests)
+	})
+}
+
 func TestNewDirectoryService_ListGroups(t *testing.T) {
 	t.Run("should return a valid list of two groups with nil argument", func(t *testing.T) {
 		ctx := context.TODO()
@@ -0,0 +1,275 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// LDAP v3 directory client, compatible with Microsoft Active Directory and OpenLDAP
+// reference: https://datatracker.ietf.org/doc/html/rfc4511
+
+const (
+	// DefaultPageSize is the number of entries requested per page using the paged results control,
+	// Active Directory returns at most 1000 entries per search without it.
+	DefaultPageSize = 500
+
+	// DefaultTimeout is the timeout of the LDAP requests.
+	DefaultTimeout = 60 * time.Second
+)
+
+var (
+	// ErrURLEmpty is returned when the LDAP server url is empty.
+	ErrURLEmpty = errors.New("ldap: url may not be empty")
+
+	// ErrBaseDNEmpty is returned when the base DN of a search is empty.
+	ErrBaseDNEmpty = errors.New("ldap: base dn may not be empty")
+
+	// ErrDNEmpty is returned when the DN of an entry is empty.
+	ErrDNEmpty = errors.New("ldap: dn may not be empty")
+)
+
+// Entry represents an LDAP entry.
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// GetAttributeValues returns the values of the given attribute, the attribute name is case-insensitive.
+func (e *Entry) GetAttributeValues(attribute string) []string {
+	for name, values := range e.Attributes {
+		if strings.EqualFold(name, attribute) {
+			return values
+		}
+	}
+	return nil
+}
+
+// GetAttributeValue returns the first value of the given attribute, or an empty string if the entry doesn't have it.
+func (e *Entry) GetAttributeValue(attribute string) string {
+	if attribute == "" {
+		return ""
+	}
+
+	values := e.GetAttributeValues(attribute)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Service is an LDAP directory client, the connection is opened on the first request and reused.
+type Service struct {
+	url          string
+	bindDN       string
+	bindPassword string
+	pageSize     uint32
+	timeout      time.Duration
+	tlsConfig    *tls.Config
+
+	mu   sync.Mutex
+	conn *goldap.Conn
+}
+
+// ServiceOption is a function that configures the Service.
+type ServiceOption func(*Service)
+
+// WithPageSize sets the number of entries requested per page.
+func WithPageSize(pageSize uint32) ServiceOption {
+	return func(s *Service) {
+		s.pageSize = pageSize
+	}
+}
+
+// WithTimeout sets the timeout of the LDAP requests.
+func WithTimeout(timeout time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.timeout = timeout
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used with ldaps:// urls.
+func WithTLSConfig(tlsConfig *tls.Config) ServiceOption {
+	return func(s *Service) {
+		s.tlsConfig = tlsConfig
+	}
+}
+
+// NewService returns a new LDAP directory client for the given url, example: ldaps://dc1.example.com:636.
+// When bindDN is empty an anonymous bind is used.
+func NewService(url, bindDN, bindPassword string, opts ...ServiceOption) (*Service, error) {
+	if url == "" {
+		return nil, ErrURLEmpty
+	}
+
+	s := &Service{
+		url:          url,
+		bindDN:       bindDN,
+		bindPassword: bindPassword,
+		pageSize:     DefaultPageSize,
+		timeout:      DefaultTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
+}
+
+// connection returns the current connection or opens and binds a new one.
+func (s *Service) connection() (*goldap.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil && !s.conn.IsClosing() {
+		return s.conn, nil
+	}
+
+	dialOpts := make([]goldap.DialOpt, 0, 1)
+	if s.tlsConfig != nil {
+		dialOpts = append(dialOpts, goldap.DialWithTLSConfig(s.tlsConfig))
+	}
+
+	conn, err := goldap.DialURL(s.url, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: error connecting to %s: %w", s.url, err)
+	}
+	conn.SetTimeout(s.timeout)
+
+	if s.bindDN != "" {
+		if err := conn.Bind(s.bindDN, s.bindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap: error binding as %s: %w", s.bindDN, err)
+		}
+	}
+
+	slog.Debug("ldap: connected", "url", s.url, "bindDN", s.bindDN)
+
+	s.conn = conn
+
+	return s.conn, nil
+}
+
+// Close closes the connection with the LDAP server.
+func (s *Service) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+
+	return err
+}
+
+// search sends the search request, using the paged results control when the scope is not base.
+func (s *Service) search(ctx context.Context, req *goldap.SearchRequest) ([]*Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connection()
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("ldap: search()", "baseDN", req.BaseDN, "scope", req.Scope, "filter", req.Filter)
+
+	var result *goldap.SearchResult
+	if req.Scope == goldap.ScopeBaseObject {
+		result, err = conn.Search(req)
+	} else {
+		result, err = conn.SearchWithPaging(req, s.pageSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*Entry, 0, len(result.Entries))
+	for _, e := range result.Entries {
+		entry := &Entry{
+			DN:         e.DN,
+			Attributes: make(map[string][]string, len(e.Attributes)),
+		}
+		for _, attr := range e.Attributes {
+			entry.Attributes[attr.Name] = attr.Values
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Search returns the entries under the baseDN (whole subtree) that match the filter,
+// only the given attributes are returned, all of them when attributes is empty.
+func (s *Service) Search(ctx context.Context, baseDN, filter string, attributes []string) ([]*Entry, error) {
+	if baseDN == "" {
+		return nil, ErrBaseDNEmpty
+	}
+
+	req := goldap.NewSearchRequest(
+		baseDN,
+		goldap.ScopeWholeSubtree,
+		goldap.NeverDerefAliases,
+		0, 0, false,
+		filter,
+		attributes,
+		nil,
+	)
+
+	entries, err := s.search(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: error searching %s with filter %s: %w", baseDN, filter, err)
+	}
+
+	slog.Debug("ldap: Search()", "baseDN", baseDN, "filter", filter, "entries", len(entries))
+
+	return entries, nil
+}
+
+// GetEntry returns the entry with the given DN when it matches the filter, or nil when it doesn't exist or doesn't match.
+func (s *Service) GetEntry(ctx context.Context, dn, filter string, attributes []string) (*Entry, error) {
+	if dn == "" {
+		return nil, ErrDNEmpty
+	}
+
+	req := goldap.NewSearchRequest(
+		dn,
+		goldap.ScopeBaseObject,
+		goldap.NeverDerefAliases,
+		0, 0, false,
+		filter,
+		attributes,
+		nil,
+	)
+
+	entries, err := s.search(ctx, req)
+	if err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ldap: error getting entry %s: %w", dn, err)
+	}
+
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	return entries[0], nil
+}
+
+// EscapeFilter escapes the special characters of a value used in a filter.
+func EscapeFilter(value string) string {
+	return goldap.EscapeFilter(value)
+}
@@ -0,0 +1,157 @@
+package ldap
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/slashdevops/idp-scim-sync/pkg/ldap/ldaptest"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testBindDN       = "cn=admin,dc=example,dc=com"
+	testBindPassword = "secret"
+)
+
+func newTestServer() *ldaptest.Server {
+	entries := []*ldaptest.Entry{
+		{DN: "dc=example,dc=com", Attributes: map[string][]string{"objectClass": {"domain"}}},
+		{DN: "ou=people,dc=example,dc=com", Attributes: map[string][]string{"objectClass": {"organizationalUnit"}}},
+	}
+
+	for i := 1; i <= 5; i++ {
+		entries = append(entries, &ldaptest.Entry{
+			DN: fmt.Sprintf("cn=user %d,ou=people,dc=example,dc=com", i),
+			Attributes: map[string][]string{
+				"objectClass": {"top", "person", "user"},
+				"cn":          {fmt.Sprintf("user %d", i)},
+				"mail":        {fmt.Sprintf("user.%d@example.com", i)},
+				"department":  {map[bool]string{true: "IT", false: "HR"}[i%2 == 0]},
+			},
+		})
+	}
+
+	return ldaptest.NewServer(testBindDN, testBindPassword, entries...)
+}
+
+func TestNewService(t *testing.T) {
+	t.Run("empty url", func(t *testing.T) {
+		svc, err := NewService("", "", "")
+		assert.ErrorIs(t, err, ErrURLEmpty)
+		assert.Nil(t, svc)
+	})
+
+	t.Run("options", func(t *testing.T) {
+		svc, err := NewService("ldap://localhost:389", testBindDN, testBindPassword, WithPageSize(10), WithTimeout(0))
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(10), svc.pageSize)
+		assert.Equal(t, int64(0), int64(svc.timeout))
+	})
+}
+
+func TestEntry_GetAttributeValue(t *testing.T) {
+	e := &Entry{DN: "cn=user 1,dc=example,dc=com", Attributes: map[string][]string{"mail": {"user.1@example.com", "u1@example.com"}}}
+
+	assert.Equal(t, "user.1@example.com", e.GetAttributeValue("Mail"))
+	assert.Equal(t, []string{"user.1@example.com", "u1@example.com"}, e.GetAttributeValues("MAIL"))
+	assert.Equal(t, "", e.GetAttributeValue("sn"))
+	assert.Equal(t, "", e.GetAttributeValue(""))
+}
+
+func TestService_Search(t *testing.T) {
+	ctx := context.TODO()
+
+	srv := newTestServer()
+	defer srv.Close()
+
+	t.Run("all the pages", func(t *testing.T) {
+		svc, err := NewService(srv.URL, testBindDN, testBindPassword, WithPageSize(2))
+		assert.NoError(t, err)
+		defer svc.Close()
+
+		got, err := svc.Search(ctx, "dc=example,dc=com", "(objectClass=person)", []string{"cn", "mail"})
+		assert.NoError(t, err)
+		assert.Equal(t, 5, len(got))
+		assert.Equal(t, "cn=user 1,ou=people,dc=example,dc=com", got[0].DN)
+		assert.Equal(t, "user.1@example.com", got[0].GetAttributeValue("mail"))
+		// only the requested attributes are returned
+		assert.Equal(t, "", got[0].GetAttributeValue("department"))
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		svc, err := NewService(srv.URL, testBindDN, testBindPassword)
+		assert.NoError(t, err)
+		defer svc.Close()
+
+		got, err := svc.Search(ctx, "ou=people,dc=example,dc=com", "(&(objectClass=user)(department=IT)(cn=user*))", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(got))
+		assert.Equal(t, "IT", got[0].GetAttributeValue("department"))
+	})
+
+	t.Run("empty base dn", func(t *testing.T) {
+		svc, err := NewService(srv.URL, testBindDN, testBindPassword)
+		assert.NoError(t, err)
+
+		got, err := svc.Search(ctx, "", "(objectClass=*)", nil)
+		assert.ErrorIs(t, err, ErrBaseDNEmpty)
+		assert.Nil(t, got)
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		svc, err := NewService(srv.URL, testBindDN, "invalid")
+		assert.NoError(t, err)
+
+		got, err := svc.Search(ctx, "dc=example,dc=com", "(objectClass=*)", nil)
+		assert.Error(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		svc, err := NewService(srv.URL, testBindDN, testBindPassword)
+		assert.NoError(t, err)
+
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		got, err := svc.Search(cctx, "dc=example,dc=com", "(objectClass=*)", nil)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Nil(t, got)
+	})
+}
+
+func TestService_GetEntry(t *testing.T) {
+	ctx := context.TODO()
+
+	srv := newTestServer()
+	defer srv.Close()
+
+	svc, err := NewService(srv.URL, testBindDN, testBindPassword)
+	assert.NoError(t, err)
+	defer svc.Close()
+
+	t.Run("existing entry", func(t *testing.T) {
+		got, err := svc.GetEntry(ctx, "cn=user 2,ou=people,dc=example,dc=com", "(objectClass=person)", []string{"mail"})
+		assert.NoError(t, err)
+		assert.Equal(t, "user.2@example.com", got.GetAttributeValue("mail"))
+	})
+
+	t.Run("entry not matching the filter", func(t *testing.T) {
+		got, err := svc.GetEntry(ctx, "cn=user 2,ou=people,dc=example,dc=com", "(objectClass=group)", nil)
+		assert.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("missing entry", func(t *testing.T) {
+		got, err := svc.GetEntry(ctx, "cn=missing,ou=people,dc=example,dc=com", "(objectClass=*)", nil)
+		assert.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("empty dn", func(t *testing.T) {
+		got, err := svc.GetEntry(ctx, "", "(objectClass=*)", nil)
+		assert.ErrorIs(t, err, ErrDNEmpty)
+		assert.Nil(t, got)
+	})
+}
@@ -0,0 +1,437 @@
+// Package ldaptest provides an in-process LDAP server to test the LDAP clients.
+//
+// The server supports the simple bind, the search operation with the base, one level and subtree scopes,
+// the and, or, not, equality, substrings and present filters and the paged results control.
+// The attribute names and values are compared case-insensitively.
+package ldaptest
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// Entry is an entry of the LDAP directory served by the Server.
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Server is an in-process LDAP server listening on a system-chosen port on the local loopback interface.
+type Server struct {
+	// URL of the server, example: ldap://127.0.0.1:34567
+	URL string
+
+	bindDN       string
+	bindPassword string
+	entries      []*Entry
+	listener     net.Listener
+	wg           sync.WaitGroup
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	searches []string
+}
+
+// NewServer starts and returns a new Server with the given entries, the clients must bind with the given credentials.
+// The caller should call Close when finished, to shut it down.
+func NewServer(bindDN, bindPassword string, entries ...*Entry) *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("ldaptest: failed to listen on a port: %v", err))
+	}
+
+	s := &Server{
+		URL:          "ldap://" + l.Addr().String(),
+		bindDN:       bindDN,
+		bindPassword: bindPassword,
+		entries:      entries,
+		listener:     l,
+		conns:        make(map[net.Conn]struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s
+}
+
+// Close shuts down the server, closing the open connections.
+func (s *Server) Close() {
+	s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// Searches returns the filters of the search requests received by the server.
+func (s *Server) Searches() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.searches...)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle processes the requests of a connection until the client unbinds or closes it.
+func (s *Server) handle(conn net.Conn) {
+	bound := false
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		if len(packet.Children) < 2 {
+			return
+		}
+
+		messageID, ok := packet.Children[0].Value.(int64)
+		if !ok {
+			return
+		}
+
+		op := packet.Children[1]
+		switch op.Tag {
+		case goldap.ApplicationBindRequest:
+			bound = s.bind(conn, messageID, op)
+		case goldap.ApplicationUnbindRequest:
+			return
+		case goldap.ApplicationSearchRequest:
+			if !bound && s.bindDN != "" {
+				s.writeResult(conn, messageID, goldap.ApplicationSearchResultDone, goldap.LDAPResultInsufficientAccessRights, "bind required", nil)
+				continue
+			}
+
+			var controls *ber.Packet
+			if len(packet.Children) > 2 {
+				controls = packet.Children[2]
+			}
+			s.search(conn, messageID, op, controls)
+		default:
+			s.writeResult(conn, messageID, goldap.ApplicationExtendedResponse, goldap.LDAPResultUnwillingToPerform, "operation not supported", nil)
+		}
+	}
+}
+
+// bind checks the credentials of a simple bind request.
+func (s *Server) bind(conn net.Conn, messageID int64, op *ber.Packet) bool {
+	if len(op.Children) < 3 {
+		s.writeResult(conn, messageID, goldap.ApplicationBindResponse, goldap.LDAPResultProtocolError, "invalid bind request", nil)
+		return false
+	}
+
+	name := packetString(op.Children[1])
+	password := packetString(op.Children[2])
+
+	if name != s.bindDN || password != s.bindPassword {
+		s.writeResult(conn, messageID, goldap.ApplicationBindResponse, goldap.LDAPResultInvalidCredentials, "invalid credentials", nil)
+		return false
+	}
+
+	s.writeResult(conn, messageID, goldap.ApplicationBindResponse, goldap.LDAPResultSuccess, "", nil)
+	return true
+}
+
+// search writes the entries matching the search request.
+func (s *Server) search(conn net.Conn, messageID int64, op, controls *ber.Packet) {
+	if len(op.Children) < 8 {
+		s.writeResult(conn, messageID, goldap.ApplicationSearchResultDone, goldap.LDAPResultProtocolError, "invalid search request", nil)
+		return
+	}
+
+	baseDN := packetString(op.Children[0])
+	scope, _ := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+
+	attributes := make([]string, 0, len(op.Children[7].Children))
+	for _, attr := range op.Children[7].Children {
+		attributes = append(attributes, packetString(attr))
+	}
+
+	if f, err := goldap.DecompileFilter(filter); err == nil {
+		s.mu.Lock()
+		s.searches = append(s.searches, f)
+		s.mu.Unlock()
+	}
+
+	if scope == goldap.ScopeBaseObject && s.entry(baseDN) == nil {
+		s.writeResult(conn, messageID, goldap.ApplicationSearchResultDone, goldap.LDAPResultNoSuchObject, "no such object", nil)
+		return
+	}
+
+	matches := make([]*Entry, 0)
+	for _, e := range s.entries {
+		if inScope(e.DN, baseDN, scope) && match(e, filter) {
+			matches = append(matches, e)
+		}
+	}
+
+	// paged results control
+	var respControls []goldap.Control
+	if paging := pagingControl(controls); paging != nil && paging.PagingSize > 0 {
+		offset, _ := strconv.Atoi(string(paging.Cookie))
+		end := offset + int(paging.PagingSize)
+		if end > len(matches) {
+			end = len(matches)
+		}
+
+		respPaging := goldap.NewControlPaging(0)
+		if end < len(matches) {
+			respPaging.SetCookie([]byte(strconv.Itoa(end)))
+		}
+		respControls = append(respControls, respPaging)
+
+		if offset > len(matches) {
+			offset = len(matches)
+		}
+		matches = matches[offset:end]
+	}
+
+	for _, e := range matches {
+		s.writeEntry(conn, messageID, e, attributes)
+	}
+
+	s.writeResult(conn, messageID, goldap.ApplicationSearchResultDone, goldap.LDAPResultSuccess, "", respControls)
+}
+
+// entry returns the entry with the given DN.
+func (s *Server) entry(dn string) *Entry {
+	for _, e := range s.entries {
+		if strings.EqualFold(e.DN, dn) {
+			return e
+		}
+	}
+	return nil
+}
+
+// writeEntry writes a search result entry with the requested attributes, all of them when none is requested.
+func (s *Server) writeEntry(conn net.Conn, messageID int64, e *Entry, attributes []string) {
+	all := len(attributes) == 0
+	requested := make(map[string]struct{}, len(attributes))
+	for _, attr := range attributes {
+		if attr == "*" {
+			all = true
+		}
+		requested[strings.ToLower(attr)] = struct{}{}
+	}
+
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range e.Attributes {
+		if _, ok := requested[strings.ToLower(name)]; !all && !ok {
+			continue
+		}
+
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(vals)
+		attrs.AppendChild(attr)
+	}
+
+	resp := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	resp.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "Object Name"))
+	resp.AppendChild(attrs)
+
+	write(conn, messageID, resp, nil)
+}
+
+// writeResult writes an LDAPResult response with the given application tag.
+func (s *Server) writeResult(conn net.Conn, messageID int64, tag ber.Tag, code uint16, message string, controls []goldap.Control) {
+	resp := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	resp.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	resp.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	resp.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+
+	write(conn, messageID, resp, controls)
+}
+
+// write writes the LDAP message envelope with the given response.
+func write(conn net.Conn, messageID int64, resp *ber.Packet, controls []goldap.Control) {
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	envelope.AppendChild(resp)
+
+	if len(controls) > 0 {
+		ctrls := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+		for _, c := range controls {
+			ctrls.AppendChild(c.Encode())
+		}
+		envelope.AppendChild(ctrls)
+	}
+
+	_, _ = conn.Write(envelope.Bytes())
+}
+
+// pagingControl returns the paged results control of the request, if any.
+func pagingControl(controls *ber.Packet) *goldap.ControlPaging {
+	if controls == nil {
+		return nil
+	}
+
+	for _, child := range controls.Children {
+		c, err := goldap.DecodeControl(child)
+		if err != nil {
+			continue
+		}
+		if paging, ok := c.(*goldap.ControlPaging); ok {
+			return paging
+		}
+	}
+
+	return nil
+}
+
+// inScope returns true when the dn is in the scope of the search base dn.
+func inScope(dn, baseDN string, scope int64) bool {
+	dn, baseDN = strings.ToLower(dn), strings.ToLower(baseDN)
+
+	switch scope {
+	case goldap.ScopeBaseObject:
+		return dn == baseDN
+	case goldap.ScopeSingleLevel:
+		parent := ""
+		if i := strings.Index(dn, ","); i >= 0 {
+			parent = dn[i+1:]
+		}
+		return parent == baseDN
+	default:
+		return dn == baseDN || strings.HasSuffix(dn, ","+baseDN)
+	}
+}
+
+// match evaluates the filter against the entry.
+func match(e *Entry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case goldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !match(e, child) {
+				return false
+			}
+		}
+		return true
+	case goldap.FilterOr:
+		for _, child := range filter.Children {
+			if match(e, child) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterNot:
+		return len(filter.Children) == 1 && !match(e, filter.Children[0])
+	case goldap.FilterPresent:
+		return len(values(e, packetString(filter))) > 0
+	case goldap.FilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		want := packetString(filter.Children[1])
+		for _, v := range values(e, packetString(filter.Children[0])) {
+			if strings.EqualFold(v, want) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterSubstrings:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		for _, v := range values(e, packetString(filter.Children[0])) {
+			if matchSubstrings(strings.ToLower(v), filter.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// matchSubstrings returns true when the value matches the initial, any and final substrings.
+func matchSubstrings(value string, substrings []*ber.Packet) bool {
+	for _, sub := range substrings {
+		s := strings.ToLower(packetString(sub))
+
+		switch sub.Tag {
+		case goldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, s) {
+				return false
+			}
+			value = value[len(s):]
+		case goldap.FilterSubstringsAny:
+			i := strings.Index(value, s)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(s):]
+		case goldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(value, s) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// values returns the values of the entry attribute, the attribute name is case-insensitive.
+func values(e *Entry, attribute string) []string {
+	for name, v := range e.Attributes {
+		if strings.EqualFold(name, attribute) {
+			return v
+		}
+	}
+	return nil
+}
+
+// packetString returns the content of a primitive packet as a string.
+func packetString(p *ber.Packet) string {
+	if s, ok := p.Value.(string); ok {
+		return s
+	}
+	if p.Data != nil {
+		return p.Data.String()
+	}
+	return string(p.ByteValue)
+}
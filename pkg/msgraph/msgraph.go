@@ -0,0 +1,392 @@
+package msgraph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// Microsoft Graph API
+// reference: https://learn.microsoft.com/en-us/graph/overview
+
+const (
+	// DefaultURL is the Microsoft Graph API v1.0 endpoint.
+	DefaultURL = "https://graph.microsoft.com/v1.0"
+
+	// DefaultScope is the scope used to get an application token for the Microsoft Graph API.
+	DefaultScope = "https://graph.microsoft.com/.default"
+
+	// tokenURLFormat is the Microsoft identity platform token endpoint, the tenant id is the parameter.
+	tokenURLFormat = "https://login.microsoftonline.com/%s/oauth2/v2.0/token"
+
+	// DefaultMaxRetries is the number of times a request is retried when it is throttled.
+	DefaultMaxRetries = 5
+
+	// DefaultRetryBaseDelay and DefaultRetryMaxDelay are the bounds of the exponential backoff
+	// of the throttled requests without the Retry-After header.
+	DefaultRetryBaseDelay = 1 * time.Second
+	DefaultRetryMaxDelay  = 32 * time.Second
+
+	// MaxRetryAfter is the maximum time to wait for the Retry-After header of a throttled request.
+	MaxRetryAfter = 60 * time.Second
+
+	usersSelectFields  = "id,userPrincipalName,mail,displayName,givenName,surname,jobTitle,department,companyName,employeeId,userType,preferredLanguage,mobilePhone,businessPhones,streetAddress,city,state,postalCode,country,accountEnabled"
+	groupsSelectFields = "id,displayName,mail,mailNickname,description"
+)
+
+var (
+	// ErrUserIDEmpty is returned when the user id is empty.
+	ErrUserIDEmpty = errors.New("msgraph: user id may not be empty")
+
+	// ErrGroupIDEmpty is returned when the group id is empty.
+	ErrGroupIDEmpty = errors.New("msgraph: group id may not be empty")
+
+	// ErrTenantIDEmpty is returned when the tenant id is empty.
+	ErrTenantIDEmpty = errors.New("msgraph: tenant id may not be empty")
+
+	// ErrClientIDEmpty is returned when the client id is empty.
+	ErrClientIDEmpty = errors.New("msgraph: client id may not be empty")
+
+	// ErrClientSecretEmpty is returned when the client secret is empty.
+	ErrClientSecretEmpty = errors.New("msgraph: client secret may not be empty")
+)
+
+// HTTPClient is an interface for sending HTTP requests.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Service is a Microsoft Graph API client.
+type Service struct {
+	httpClient HTTPClient
+	url        *url.URL
+	UserAgent  string
+
+	// MaxRetries is the number of times a request is retried when it is throttled (HTTP 429 or 503).
+	MaxRetries int
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewHTTPClient returns an *http.Client authenticated with the client credentials flow
+// of an Entra ID application registration.
+// references:
+// - https://learn.microsoft.com/en-us/entra/identity-platform/v2-oauth2-client-creds-grant-flow
+func NewHTTPClient(ctx context.Context, tenantID, clientID, clientSecret string) (*http.Client, error) {
+	if tenantID == "" {
+		return nil, ErrTenantIDEmpty
+	}
+	if clientID == "" {
+		return nil, ErrClientIDEmpty
+	}
+	if clientSecret == "" {
+		return nil, ErrClientSecretEmpty
+	}
+
+	cfg := clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     fmt.Sprintf(tokenURLFormat, url.PathEscape(tenantID)),
+		Scopes:       []string{DefaultScope},
+	}
+
+	return cfg.Client(ctx), nil
+}
+
+// NewService creates a new Microsoft Graph API client, the httpClient must be authenticated (see NewHTTPClient).
+// When urlStr is empty the DefaultURL is used.
+func NewService(httpClient HTTPClient, urlStr string) (*Service, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	if urlStr == "" {
+		urlStr = DefaultURL
+	}
+
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, fmt.Errorf("msgraph: error parsing url: %w", err)
+	}
+
+	return &Service{
+		httpClient: httpClient,
+		url:        u,
+		MaxRetries: DefaultMaxRetries,
+		now:        time.Now,
+		sleep:      sleepContext,
+	}, nil
+}
+
+// sleepContext waits for the given duration or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// newURL returns the url of the given resource path with the given query.
+func (s *Service) newURL(resource string, query url.Values) *url.URL {
+	u := *s.url
+	u.Path = path.Join(u.Path, resource)
+	u.RawQuery = query.Encode()
+
+	return &u
+}
+
+// get sends a GET request and decodes the response body into v.
+// The request is retried when it is throttled.
+// references:
+// - https://learn.microsoft.com/en-us/graph/throttling
+func (s *Service) get(ctx context.Context, u string, advancedQuery bool, v interface{}) error {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return fmt.Errorf("msgraph: error creating request: %w", err)
+		}
+
+		req.Header.Set("Accept", "application/json")
+
+		// filters over some properties are only supported as advanced queries
+		// see: https://learn.microsoft.com/en-us/graph/aad-advanced-queries
+		if advancedQuery {
+			req.Header.Set("ConsistencyLevel", "eventual")
+		}
+
+		if s.UserAgent != "" {
+			req.Header.Set("User-Agent", s.UserAgent)
+		}
+
+		slog.Debug("msgraph: get()", "url", u, "attempt", attempt)
+
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("msgraph: error sending request, url: %s, error: %w", u, err)
+		}
+
+		if isThrottled(resp.StatusCode) && attempt < s.MaxRetries {
+			resp.Body.Close()
+
+			wait := s.retryAfter(resp.Header, attempt)
+			slog.Warn("msgraph: request throttled, retrying", "url", u, "statusCode", resp.StatusCode, "attempt", attempt+1, "wait", wait)
+
+			if err := s.sleep(ctx, wait); err != nil {
+				return fmt.Errorf("msgraph: error waiting to retry the request: %w", err)
+			}
+			continue
+		}
+
+		err = decodeResponse(resp, v)
+		resp.Body.Close()
+
+		return err
+	}
+}
+
+// decodeResponse checks the HTTP response and decodes its body into v.
+func decodeResponse(resp *http.Response, v interface{}) error {
+	if err := checkHTTPResponse(resp); err != nil {
+		return err
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("msgraph: error decoding response body: %w", err)
+	}
+
+	return nil
+}
+
+// isThrottled returns true when the status code means the request was throttled
+// and must be retried, 503 is also returned by the Microsoft Graph API when it is overloaded.
+func isThrottled(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// retryAfter returns the time to wait before retrying a throttled request, the Retry-After header
+// in seconds or as an HTTP date, up to MaxRetryAfter, or an exponential backoff with jitter
+// when the header is missing.
+func (s *Service) retryAfter(h http.Header, attempt int) time.Duration {
+	if v := h.Get("Retry-After"); v != "" {
+		var wait time.Duration
+		if secs, err := strconv.Atoi(v); err == nil {
+			wait = time.Duration(secs) * time.Second
+		} else if t, err := http.ParseTime(v); err == nil {
+			wait = t.Sub(s.now())
+		}
+
+		if wait > 0 {
+			return min(wait, MaxRetryAfter)
+		}
+	}
+
+	delay := DefaultRetryBaseDelay
+	for range attempt {
+		delay = min(delay*2, DefaultRetryMaxDelay)
+	}
+
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// checkHTTPResponse checks the status code of the HTTP response.
+func checkHTTPResponse(resp *http.Response) error {
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("msgraph: error reading response body: %w", err)
+		}
+
+		slog.Debug("msgraph: checkHTTPResponse()", "statusCode", resp.StatusCode, "status", resp.Status, "body", string(body))
+
+		var errResp errorResponse
+		if err := json.Unmarshal(body, &errResp); err != nil || errResp.Error.Code == "" {
+			return &HTTPResponseError{StatusCode: resp.StatusCode, Code: resp.Status, Message: string(body)}
+		}
+
+		return &HTTPResponseError{StatusCode: resp.StatusCode, Code: errResp.Error.Code, Message: errResp.Error.Message}
+	}
+
+	return nil
+}
+
+// listAll returns the resources of all the pages starting from the given url.
+func listAll[T any](ctx context.Context, s *Service, u string, advancedQuery bool) ([]T, error) {
+	resources := make([]T, 0)
+
+	for u != "" {
+		var page pageResponse[T]
+		if err := s.get(ctx, u, advancedQuery, &page); err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, page.Value...)
+		u = page.NextLink
+	}
+
+	return resources, nil
+}
+
+// listFiltered returns the resources of the given path, once per filter, when there are no filters all the resources are returned.
+// The filters use the OData $filter syntax, example: "startswith(displayName,'AWS')".
+func listFiltered[T any](ctx context.Context, s *Service, resource, selectFields string, filter []string) ([]T, error) {
+	filters := make([]string, 0, len(filter))
+	for _, f := range filter {
+		if f != "" {
+			filters = append(filters, f)
+		}
+	}
+
+	if len(filters) == 0 {
+		q := url.Values{}
+		q.Set("$select", selectFields)
+
+		return listAll[T](ctx, s, s.newURL(resource, q).String(), false)
+	}
+
+	resources := make([]T, 0)
+	for _, f := range filters {
+		q := url.Values{}
+		q.Set("$select", selectFields)
+		q.Set("$filter", f)
+		q.Set("$count", "true")
+
+		page, err := listAll[T](ctx, s, s.newURL(resource, q).String(), true)
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, page...)
+	}
+
+	return resources, nil
+}
+
+// ListUsers list all users filtered by the given OData filters.
+// references:
+// - https://learn.microsoft.com/en-us/graph/api/user-list
+func (s *Service) ListUsers(ctx context.Context, filter []string) ([]*User, error) {
+	u, err := listFiltered[*User](ctx, s, "/users", usersSelectFields, filter)
+	if err != nil {
+		return nil, fmt.Errorf("msgraph: error listing users: %w", err)
+	}
+
+	slog.Debug("msgraph: ListUsers()", "users", len(u))
+
+	return u, nil
+}
+
+// ListGroups list all groups filtered by the given OData filters.
+// references:
+// - https://learn.microsoft.com/en-us/graph/api/group-list
+func (s *Service) ListGroups(ctx context.Context, filter []string) ([]*Group, error) {
+	g, err := listFiltered[*Group](ctx, s, "/groups", groupsSelectFields, filter)
+	if err != nil {
+		return nil, fmt.Errorf("msgraph: error listing groups: %w", err)
+	}
+
+	slog.Debug("msgraph: ListGroups()", "groups", len(g))
+
+	return g, nil
+}
+
+// ListGroupTransitiveMembers returns the users that are members of the group, directly or through nested groups.
+// references:
+// - https://learn.microsoft.com/en-us/graph/api/group-list-transitivemembers
+func (s *Service) ListGroupTransitiveMembers(ctx context.Context, groupID string) ([]*User, error) {
+	if groupID == "" {
+		return nil, ErrGroupIDEmpty
+	}
+
+	q := url.Values{}
+	q.Set("$select", usersSelectFields)
+
+	// the microsoft.graph.user cast returns only the members that are users
+	u := s.newURL(path.Join("/groups", groupID, "transitiveMembers", "microsoft.graph.user"), q)
+
+	m, err := listAll[*User](ctx, s, u.String(), false)
+	if err != nil {
+		return nil, fmt.Errorf("msgraph: error listing group %s transitive members: %w", groupID, err)
+	}
+
+	slog.Debug("msgraph: ListGroupTransitiveMembers()", "groupID", groupID, "members", len(m))
+
+	return m, nil
+}
+
+// GetUser returns a user given its id or user principal name.
+// references:
+// - https://learn.microsoft.com/en-us/graph/api/user-get
+func (s *Service) GetUser(ctx context.Context, userID string) (*User, error) {
+	if userID == "" {
+		return nil, ErrUserIDEmpty
+	}
+
+	q := url.Values{}
+	q.Set("$select", usersSelectFields)
+
+	u := s.newURL(path.Join("/users", userID), q)
+
+	var user User
+	if err := s.get(ctx, u.String(), false, &user); err != nil {
+		return nil, fmt.Errorf("msgraph: error getting user %s: %w", userID, err)
+	}
+
+	return &user, nil
+}
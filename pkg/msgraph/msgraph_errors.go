@@ -0,0 +1,23 @@
+package msgraph
+
+import "fmt"
+
+// HTTPResponseError represents an error returned by the Microsoft Graph API.
+// reference: https://learn.microsoft.com/en-us/graph/errors
+type HTTPResponseError struct {
+	StatusCode int    `json:"statusCode"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *HTTPResponseError) Error() string {
+	return fmt.Sprintf("statusCode: %d, errCode: %s, errMsg: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// errorResponse is the body of the Microsoft Graph API errors.
+type errorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
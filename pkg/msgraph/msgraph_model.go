@@ -0,0 +1,46 @@
+package msgraph
+
+// Microsoft Graph API resources
+// reference: https://learn.microsoft.com/en-us/graph/api/resources/users
+
+// User represents a Microsoft Graph user.
+// reference: https://learn.microsoft.com/en-us/graph/api/resources/user
+type User struct {
+	ID                string   `json:"id"`
+	UserPrincipalName string   `json:"userPrincipalName,omitempty"`
+	Mail              string   `json:"mail,omitempty"`
+	DisplayName       string   `json:"displayName,omitempty"`
+	GivenName         string   `json:"givenName,omitempty"`
+	Surname           string   `json:"surname,omitempty"`
+	JobTitle          string   `json:"jobTitle,omitempty"`
+	Department        string   `json:"department,omitempty"`
+	CompanyName       string   `json:"companyName,omitempty"`
+	EmployeeID        string   `json:"employeeId,omitempty"`
+	UserType          string   `json:"userType,omitempty"`
+	PreferredLanguage string   `json:"preferredLanguage,omitempty"`
+	MobilePhone       string   `json:"mobilePhone,omitempty"`
+	BusinessPhones    []string `json:"businessPhones,omitempty"`
+	StreetAddress     string   `json:"streetAddress,omitempty"`
+	City              string   `json:"city,omitempty"`
+	State             string   `json:"state,omitempty"`
+	PostalCode        string   `json:"postalCode,omitempty"`
+	Country           string   `json:"country,omitempty"`
+	AccountEnabled    *bool    `json:"accountEnabled,omitempty"`
+}
+
+// Group represents a Microsoft Graph group.
+// reference: https://learn.microsoft.com/en-us/graph/api/resources/group
+type Group struct {
+	ID           string `json:"id"`
+	DisplayName  string `json:"displayName,omitempty"`
+	Mail         string `json:"mail,omitempty"`
+	MailNickname string `json:"mailNickname,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// pageResponse represents a page of resources returned by the Microsoft Graph API.
+// reference: https://learn.microsoft.com/en-us/graph/paging
+type pageResponse[T any] struct {
+	NextLink string `json:"@odata.nextLink,omitempty"`
+	Value    []T    `json:"value"`
+}
@@ -0,0 +1,333 @@
+package msgraph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestService returns a Service for the given fake Microsoft Graph server that records the
+// retry waits instead of sleeping, the clock stays at now to compare the Retry-After dates with it
+func newTestService(t *testing.T, srv *httptest.Server, now time.Time) (*Service, *[]time.Duration) {
+	t.Helper()
+
+	svc, err := NewService(srv.Client(), srv.URL)
+	assert.NoError(t, err)
+
+	waits := make([]time.Duration, 0)
+	svc.now = func() time.Time { return now }
+	svc.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	return svc, &waits
+}
+
+// throttle writes a throttled response of the Microsoft Graph API with the given status code and
+// Retry-After header, an empty retryAfter writes the response without the header.
+func throttle(w http.ResponseWriter, statusCode int, retryAfter string) {
+	if retryAfter != "" {
+		w.Header().Set("Retry-After", retryAfter)
+	}
+	w.WriteHeader(statusCode)
+	fmt.Fprint(w, `{"error": {"code": "TooManyRequests", "message": "throttled"}}`)
+}
+
+func TestNewService(t *testing.T) {
+	t.Run("default url when empty", func(t *testing.T) {
+		svc, err := NewService(nil, "")
+		assert.NoError(t, err)
+		assert.NotNil(t, svc)
+		assert.Equal(t, DefaultURL, svc.url.String())
+	})
+
+	t.Run("invalid url", func(t *testing.T) {
+		svc, err := NewService(nil, ":invalid")
+		assert.Error(t, err)
+		assert.Nil(t, svc)
+	})
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	ctx := context.TODO()
+
+	_, err := NewHTTPClient(ctx, "", "client", "secret")
+	assert.ErrorIs(t, err, ErrTenantIDEmpty)
+
+	_, err = NewHTTPClient(ctx, "tenant", "", "secret")
+	assert.ErrorIs(t, err, ErrClientIDEmpty)
+
+	_, err = NewHTTPClient(ctx, "tenant", "client", "")
+	assert.ErrorIs(t, err, ErrClientSecretEmpty)
+
+	client, err := NewHTTPClient(ctx, "tenant", "client", "secret")
+	assert.NoError(t, err)
+	assert.NotNil(t, client)
+}
+
+func TestService_ListUsers(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("all the pages without filter", func(t *testing.T) {
+		var srvURL string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/v1.0/users", r.URL.Path)
+			assert.Empty(t, r.URL.Query().Get("$filter"))
+			assert.Empty(t, r.Header.Get("ConsistencyLevel"))
+
+			if r.URL.Query().Get("$skiptoken") == "" {
+				assert.Equal(t, usersSelectFields, r.URL.Query().Get("$select"))
+				fmt.Fprintf(w, `{"@odata.nextLink": "%s/v1.0/users?$skiptoken=page2", "value": [{"id": "user-1", "userPrincipalName": "user.1@mail.com"}]}`, srvURL)
+				return
+			}
+			fmt.Fprint(w, `{"value": [{"id": "user-2", "userPrincipalName": "user.2@mail.com"}]}`)
+		}))
+		defer srv.Close()
+		srvURL = srv.URL
+
+		svc, err := NewService(srv.Client(), srv.URL+"/v1.0")
+		assert.NoError(t, err)
+
+		users, err := svc.ListUsers(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(users))
+		assert.Equal(t, "user-1", users[0].ID)
+		assert.Equal(t, "user-2", users[1].ID)
+	})
+
+	t.Run("one request per filter as advanced query", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			assert.Equal(t, "eventual", r.Header.Get("ConsistencyLevel"))
+			assert.Equal(t, "true", r.URL.Query().Get("$count"))
+			fmt.Fprintf(w, `{"value": [{"id": "user-%d", "accountEnabled": true}]}`, calls)
+		}))
+		defer srv.Close()
+
+		svc, err := NewService(srv.Client(), srv.URL)
+		assert.NoError(t, err)
+
+		users, err := svc.ListUsers(ctx, []string{"department eq 'IT'", "", "startswith(displayName,'A')"})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, 2, len(users))
+		assert.True(t, *users[0].AccountEnabled)
+	})
+
+	t.Run("graph error", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"error": {"code": "Authorization_RequestDenied", "message": "Insufficient privileges"}}`)
+		}))
+		defer srv.Close()
+
+		svc, err := NewService(srv.Client(), srv.URL)
+		assert.NoError(t, err)
+
+		users, err := svc.ListUsers(ctx, nil)
+		assert.Error(t, err)
+		assert.Nil(t, users)
+
+		var httpErr *HTTPResponseError
+		assert.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, http.StatusForbidden, httpErr.StatusCode)
+		assert.Equal(t, "Authorization_RequestDenied", httpErr.Code)
+	})
+}
+
+func TestService_ListGroups(t *testing.T) {
+	ctx := context.TODO()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/groups", r.URL.Path)
+		assert.Equal(t, "startswith(displayName,'AWS')", r.URL.Query().Get("$filter"))
+		fmt.Fprint(w, `{"value": [{"id": "group-1", "displayName": "AWS Admins", "mail": "aws.admins@mail.com"}]}`)
+	}))
+	defer srv.Close()
+
+	svc, err := NewService(srv.Client(), srv.URL)
+	assert.NoError(t, err)
+
+	groups, err := svc.ListGroups(ctx, []string{"startswith(displayName,'AWS')"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(groups))
+	assert.Equal(t, "AWS Admins", groups[0].DisplayName)
+}
+
+func TestService_ListGroupTransitiveMembers(t *testing.T) {
+	ctx := context.TODO()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/groups/group-1/transitiveMembers/microsoft.graph.user", r.URL.Path)
+		fmt.Fprint(w, `{"value": [{"id": "user-1"}, {"id": "user-2"}]}`)
+	}))
+	defer srv.Close()
+
+	svc, err := NewService(srv.Client(), srv.URL)
+	assert.NoError(t, err)
+
+	_, err = svc.ListGroupTransitiveMembers(ctx, "")
+	assert.ErrorIs(t, err, ErrGroupIDEmpty)
+
+	members, err := svc.ListGroupTransitiveMembers(ctx, "group-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(members))
+}
+
+func TestService_GetUser(t *testing.T) {
+	ctx := context.TODO()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users/user.1@mail.com" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error": {"code": "Request_ResourceNotFound", "message": "not found"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"id": "user-1", "userPrincipalName": "user.1@mail.com", "givenName": "user", "surname": "1"}`)
+	}))
+	defer srv.Close()
+
+	svc, err := NewService(srv.Client(), srv.URL)
+	assert.NoError(t, err)
+
+	_, err = svc.GetUser(ctx, "")
+	assert.ErrorIs(t, err, ErrUserIDEmpty)
+
+	user, err := svc.GetUser(ctx, "user.1@mail.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", user.ID)
+	assert.Equal(t, "1", user.Surname)
+
+	user, err = svc.GetUser(ctx, "user.2@mail.com")
+	assert.Error(t, err)
+	assert.Nil(t, user)
+}
+
+func TestService_get_Throttled(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("retry after the Retry-After header in seconds", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				throttle(w, http.StatusTooManyRequests, "7")
+				return
+			}
+			fmt.Fprint(w, `{"id": "user-1"}`)
+		}))
+		defer srv.Close()
+
+		svc, waits := newTestService(t, srv, now)
+
+		user, err := svc.GetUser(ctx, "user-1")
+		assert.NoError(t, err)
+		assert.Equal(t, "user-1", user.ID)
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, []time.Duration{7 * time.Second}, *waits)
+	})
+
+	t.Run("retry after the Retry-After header as a date, up to the max", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			switch calls {
+			case 1:
+				throttle(w, http.StatusServiceUnavailable, now.Add(3*time.Second).Format(http.TimeFormat))
+			case 2:
+				throttle(w, http.StatusTooManyRequests, "3600")
+			default:
+				fmt.Fprint(w, `{"value": [{"id": "group-1"}]}`)
+			}
+		}))
+		defer srv.Close()
+
+		svc, waits := newTestService(t, srv, now)
+
+		groups, err := svc.ListGroups(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(groups))
+		assert.Equal(t, []time.Duration{3 * time.Second, MaxRetryAfter}, *waits)
+	})
+
+	t.Run("exponential backoff without the Retry-After header", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			throttle(w, http.StatusTooManyRequests, "")
+		}))
+		defer srv.Close()
+
+		svc, waits := newTestService(t, srv, now)
+		svc.MaxRetries = 3
+
+		user, err := svc.GetUser(ctx, "user-1")
+		assert.Error(t, err)
+		assert.Nil(t, user)
+		assert.Equal(t, 4, calls)
+
+		var httpErr *HTTPResponseError
+		assert.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, http.StatusTooManyRequests, httpErr.StatusCode)
+
+		assert.Equal(t, 3, len(*waits))
+		for i, wait := range *waits {
+			delay := DefaultRetryBaseDelay << i
+			assert.GreaterOrEqual(t, wait, delay/2)
+			assert.LessOrEqual(t, wait, delay)
+		}
+	})
+
+	t.Run("exponential backoff when the Retry-After header is not a wait", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			switch calls {
+			case 1:
+				throttle(w, http.StatusTooManyRequests, now.Add(-time.Minute).Format(http.TimeFormat))
+			case 2:
+				throttle(w, http.StatusServiceUnavailable, "soon")
+			default:
+				fmt.Fprint(w, `{"id": "user-1"}`)
+			}
+		}))
+		defer srv.Close()
+
+		svc, waits := newTestService(t, srv, now)
+
+		user, err := svc.GetUser(ctx, "user-1")
+		assert.NoError(t, err)
+		assert.Equal(t, "user-1", user.ID)
+		assert.Equal(t, 2, len(*waits))
+		for i, wait := range *waits {
+			delay := DefaultRetryBaseDelay << i
+			assert.GreaterOrEqual(t, wait, delay/2)
+			assert.LessOrEqual(t, wait, delay)
+		}
+	})
+
+	t.Run("no retries of the other errors", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		svc, waits := newTestService(t, srv, now)
+
+		_, err := svc.GetUser(ctx, "user-1")
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+		assert.Empty(t, *waits)
+	})
+}
@@ -0,0 +1,416 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Okta Management API
+// reference: https://developer.okta.com/docs/api/openapi/okta-management/guides/overview/
+
+const (
+	// apiPath is the path of the Okta Management API v1 in the Okta org url.
+	apiPath = "/api/v1"
+
+	// DefaultPageLimit is the number of resources requested per page.
+	DefaultPageLimit = 200
+
+	// DefaultMaxRetries is the number of times a request is retried when the rate limit is exceeded.
+	DefaultMaxRetries = 5
+
+	// DefaultRateLimitWait is the time to wait when the rate limit is exceeded and the
+	// response doesn't have the X-Rate-Limit-Reset header.
+	DefaultRateLimitWait = 1 * time.Second
+
+	// MaxRateLimitWait is the maximum time to wait for the rate limit to be reset.
+	MaxRateLimitWait = 60 * time.Second
+)
+
+var (
+	// ErrOrgURLEmpty is returned when the Okta org url is empty.
+	ErrOrgURLEmpty = errors.New("okta: org url may not be empty")
+
+	// ErrAPITokenEmpty is returned when the api token is empty.
+	ErrAPITokenEmpty = errors.New("okta: api token may not be empty")
+
+	// ErrUserIDEmpty is returned when the user id is empty.
+	ErrUserIDEmpty = errors.New("okta: user id may not be empty")
+
+	// ErrGroupIDEmpty is returned when the group id is empty.
+	ErrGroupIDEmpty = errors.New("okta: group id may not be empty")
+)
+
+// HTTPClient is an interface for sending HTTP requests.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Service is an Okta Management API client.
+type Service struct {
+	httpClient HTTPClient
+	url        *url.URL
+	apiToken   string
+	UserAgent  string
+
+	// MaxRetries is the number of times a request is retried when the rate limit is exceeded (HTTP 429).
+	MaxRetries int
+
+	mu             sync.Mutex
+	rateLimitReset time.Time
+	now            func() time.Time
+	sleep          func(ctx context.Context, d time.Duration) error
+}
+
+// NewService creates a new Okta Management API client for the given Okta org url,
+// example: https://my-org.okta.com, authenticated with an API token.
+// references:
+// - https://developer.okta.com/docs/guides/create-an-api-token/main/
+func NewService(httpClient HTTPClient, orgURL, apiToken string) (*Service, error) {
+	if orgURL == "" {
+		return nil, ErrOrgURLEmpty
+	}
+	if apiToken == "" {
+		return nil, ErrAPITokenEmpty
+	}
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	u, err := url.Parse(orgURL)
+	if err != nil {
+		return nil, fmt.Errorf("okta: error parsing url: %w", err)
+	}
+	u.Path = path.Join(u.Path, apiPath)
+
+	return &Service{
+		httpClient: httpClient,
+		url:        u,
+		apiToken:   apiToken,
+		MaxRetries: DefaultMaxRetries,
+		now:        time.Now,
+		sleep:      sleepContext,
+	}, nil
+}
+
+// sleepContext waits for the given duration or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// newURL returns the url of the given resource path with the given query.
+func (s *Service) newURL(resource string, query url.Values) *url.URL {
+	u := *s.url
+	u.Path = path.Join(u.Path, resource)
+	u.RawQuery = query.Encode()
+
+	return &u
+}
+
+// waitRateLimit waits until the rate limit is reset when the last response
+// reported there were no remaining requests.
+func (s *Service) waitRateLimit(ctx context.Context) error {
+	s.mu.Lock()
+	wait := s.rateLimitReset.Sub(s.now())
+	s.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	if wait > MaxRateLimitWait {
+		wait = MaxRateLimitWait
+	}
+
+	slog.Warn("okta: rate limit reached, waiting for the reset", "wait", wait.String())
+
+	return s.sleep(ctx, wait)
+}
+
+// updateRateLimit stores the reset time of the rate limit when the response
+// reports there are no remaining requests.
+// references:
+// - https://developer.okta.com/docs/reference/rl-best-practices/
+func (s *Service) updateRateLimit(h http.Header) {
+	remaining, err := strconv.Atoi(h.Get("X-Rate-Limit-Remaining"))
+	if err != nil || remaining > 0 {
+		return
+	}
+
+	s.mu.Lock()
+	s.rateLimitReset = rateLimitReset(h, s.now())
+	s.mu.Unlock()
+}
+
+// rateLimitReset returns the time when the rate limit is reset using the X-Rate-Limit-Reset header,
+// the header is the UTC epoch time in seconds.
+func rateLimitReset(h http.Header, now time.Time) time.Time {
+	reset, err := strconv.ParseInt(h.Get("X-Rate-Limit-Reset"), 10, 64)
+	if err != nil || reset <= 0 {
+		return now.Add(DefaultRateLimitWait)
+	}
+
+	return time.Unix(reset, 0)
+}
+
+// get sends a GET request and decodes the response body into v, it returns the url of the next page if any.
+// The request is retried when the rate limit is exceeded.
+func (s *Service) get(ctx context.Context, u string, v interface{}) (string, error) {
+	for attempt := 0; ; attempt++ {
+		if err := s.waitRateLimit(ctx); err != nil {
+			return "", fmt.Errorf("okta: error waiting for the rate limit reset: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return "", fmt.Errorf("okta: error creating request: %w", err)
+		}
+
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "SSWS "+s.apiToken)
+
+		if s.UserAgent != "" {
+			req.Header.Set("User-Agent", s.UserAgent)
+		}
+
+		slog.Debug("okta: get()", "url", u, "attempt", attempt)
+
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("okta: error sending request, url: %s, error: %w", u, err)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < s.MaxRetries {
+			resp.Body.Close()
+
+			s.mu.Lock()
+			s.rateLimitReset = rateLimitReset(resp.Header, s.now())
+			s.mu.Unlock()
+
+			slog.Warn("okta: too many requests, retrying after the rate limit reset", "url", u, "attempt", attempt+1)
+			continue
+		}
+
+		next, err := s.decodeResponse(resp, v)
+		resp.Body.Close()
+
+		return next, err
+	}
+}
+
+// decodeResponse checks the HTTP response, decodes its body into v and returns the url of the next page if any.
+func (s *Service) decodeResponse(resp *http.Response, v interface{}) (string, error) {
+	s.updateRateLimit(resp.Header)
+
+	if err := checkHTTPResponse(resp); err != nil {
+		return "", err
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return "", fmt.Errorf("okta: error decoding response body: %w", err)
+	}
+
+	return nextLink(resp.Header), nil
+}
+
+// checkHTTPResponse checks the status code of the HTTP response.
+func checkHTTPResponse(resp *http.Response) error {
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("okta: error reading response body: %w", err)
+		}
+
+		slog.Debug("okta: checkHTTPResponse()", "statusCode", resp.StatusCode, "status", resp.Status, "body", string(body))
+
+		var errResp errorResponse
+		if err := json.Unmarshal(body, &errResp); err != nil || errResp.ErrorCode == "" {
+			return &HTTPResponseError{StatusCode: resp.StatusCode, Code: resp.Status, Message: string(body)}
+		}
+
+		return &HTTPResponseError{StatusCode: resp.StatusCode, Code: errResp.ErrorCode, Message: errResp.ErrorSummary}
+	}
+
+	return nil
+}
+
+// nextLink returns the url of the next page from the Link headers, example:
+// Link: <https://my-org.okta.com/api/v1/users?after=00u1&limit=200>; rel="next"
+// references:
+// - https://developer.okta.com/docs/api/#pagination
+func nextLink(h http.Header) string {
+	for _, header := range h.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			parts := strings.Split(link, ";")
+			if len(parts) < 2 {
+				continue
+			}
+
+			for _, param := range parts[1:] {
+				if strings.TrimSpace(param) == `rel="next"` {
+					return strings.Trim(strings.TrimSpace(parts[0]), "<>")
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// listAll returns the resources of all the pages starting from the given url.
+func listAll[T any](ctx context.Context, s *Service, u string) ([]T, error) {
+	resources := make([]T, 0)
+
+	for u != "" {
+		var page []T
+		next, err := s.get(ctx, u, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, page...)
+		u = next
+	}
+
+	return resources, nil
+}
+
+// listSearch returns the resources of the given path, once per search expression, when there are no expressions all the resources are returned.
+// The search expressions use the Okta search syntax, example: 'profile.department eq "Engineering"'.
+func listSearch[T any](ctx context.Context, s *Service, resource string, search []string) ([]T, error) {
+	expressions := make([]string, 0, len(search))
+	for _, e := range search {
+		if e != "" {
+			expressions = append(expressions, e)
+		}
+	}
+
+	if len(expressions) == 0 {
+		q := url.Values{}
+		q.Set("limit", strconv.Itoa(DefaultPageLimit))
+
+		return listAll[T](ctx, s, s.newURL(resource, q).String())
+	}
+
+	resources := make([]T, 0)
+	for _, e := range expressions {
+		q := url.Values{}
+		q.Set("limit", strconv.Itoa(DefaultPageLimit))
+		q.Set("search", e)
+
+		page, err := listAll[T](ctx, s, s.newURL(resource, q).String())
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, page...)
+	}
+
+	return resources, nil
+}
+
+// ListUsers list all users matching the given search expressions.
+// references:
+// - https://developer.okta.com/docs/api/openapi/okta-management/management/tag/User/#tag/User/operation/listUsers
+func (s *Service) ListUsers(ctx context.Context, search []string) ([]*User, error) {
+	u, err := listSearch[*User](ctx, s, "/users", search)
+	if err != nil {
+		return nil, fmt.Errorf("okta: error listing users: %w", err)
+	}
+
+	slog.Debug("okta: ListUsers()", "users", len(u))
+
+	return u, nil
+}
+
+// ListGroups list all groups matching the given search expressions.
+// references:
+// - https://developer.okta.com/docs/api/openapi/okta-management/management/tag/Group/#tag/Group/operation/listGroups
+func (s *Service) ListGroups(ctx context.Context, search []string) ([]*Group, error) {
+	g, err := listSearch[*Group](ctx, s, "/groups", search)
+	if err != nil {
+		return nil, fmt.Errorf("okta: error listing groups: %w", err)
+	}
+
+	slog.Debug("okta: ListGroups()", "groups", len(g))
+
+	return g, nil
+}
+
+// ListGroupMembers returns the users that are members of the group,
+// including the users assigned by the group rules.
+// references:
+// - https://developer.okta.com/docs/api/openapi/okta-management/management/tag/Group/#tag/Group/operation/listGroupUsers
+func (s *Service) ListGroupMembers(ctx context.Context, groupID string) ([]*User, error) {
+	if groupID == "" {
+		return nil, ErrGroupIDEmpty
+	}
+
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(DefaultPageLimit))
+
+	u := s.newURL(path.Join("/groups", groupID, "users"), q)
+
+	m, err := listAll[*User](ctx, s, u.String())
+	if err != nil {
+		return nil, fmt.Errorf("okta: error listing group %s members: %w", groupID, err)
+	}
+
+	slog.Debug("okta: ListGroupMembers()", "groupID", groupID, "members", len(m))
+
+	return m, nil
+}
+
+// ListGroupRules returns all the group rules.
+// references:
+// - https://developer.okta.com/docs/api/openapi/okta-management/management/tag/GroupRule/#tag/GroupRule/operation/listGroupRules
+func (s *Service) ListGroupRules(ctx context.Context) ([]*GroupRule, error) {
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(DefaultPageLimit))
+
+	r, err := listAll[*GroupRule](ctx, s, s.newURL("/groups/rules", q).String())
+	if err != nil {
+		return nil, fmt.Errorf("okta: error listing group rules: %w", err)
+	}
+
+	slog.Debug("okta: ListGroupRules()", "rules", len(r))
+
+	return r, nil
+}
+
+// GetUser returns a user given its id or login.
+// references:
+// - https://developer.okta.com/docs/api/openapi/okta-management/management/tag/User/#tag/User/operation/getUser
+func (s *Service) GetUser(ctx context.Context, userID string) (*User, error) {
+	if userID == "" {
+		return nil, ErrUserIDEmpty
+	}
+
+	u := s.newURL(path.Join("/users", userID), url.Values{})
+
+	var user User
+	if _, err := s.get(ctx, u.String(), &user); err != nil {
+		return nil, fmt.Errorf("okta: error getting user %s: %w", userID, err)
+	}
+
+	return &user, nil
+}
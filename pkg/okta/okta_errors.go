@@ -0,0 +1,22 @@
+package okta
+
+import "fmt"
+
+// HTTPResponseError represents an error returned by the Okta Management API.
+// reference: https://developer.okta.com/docs/reference/error-codes/
+type HTTPResponseError struct {
+	StatusCode int    `json:"statusCode"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *HTTPResponseError) Error() string {
+	return fmt.Sprintf("statusCode: %d, errCode: %s, errMsg: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// errorResponse is the body of the Okta Management API errors.
+type errorResponse struct {
+	ErrorCode    string `json:"errorCode"`
+	ErrorSummary string `json:"errorSummary"`
+	ErrorID      string `json:"errorId"`
+}
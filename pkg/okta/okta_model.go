@@ -0,0 +1,72 @@
+package okta
+
+// Okta Management API resources
+// reference: https://developer.okta.com/docs/api/openapi/okta-management/management/tag/User/
+
+// UserProfile represents the profile attributes of an Okta user.
+type UserProfile struct {
+	Login             string `json:"login"`
+	Email             string `json:"email"`
+	SecondEmail       string `json:"secondEmail,omitempty"`
+	FirstName         string `json:"firstName"`
+	LastName          string `json:"lastName"`
+	DisplayName       string `json:"displayName,omitempty"`
+	NickName          string `json:"nickName,omitempty"`
+	ProfileURL        string `json:"profileUrl,omitempty"`
+	Title             string `json:"title,omitempty"`
+	UserType          string `json:"userType,omitempty"`
+	PreferredLanguage string `json:"preferredLanguage,omitempty"`
+	Locale            string `json:"locale,omitempty"`
+	Timezone          string `json:"timezone,omitempty"`
+	MobilePhone       string `json:"mobilePhone,omitempty"`
+	PrimaryPhone      string `json:"primaryPhone,omitempty"`
+	StreetAddress     string `json:"streetAddress,omitempty"`
+	City              string `json:"city,omitempty"`
+	State             string `json:"state,omitempty"`
+	ZipCode           string `json:"zipCode,omitempty"`
+	CountryCode       string `json:"countryCode,omitempty"`
+	EmployeeNumber    string `json:"employeeNumber,omitempty"`
+	Organization      string `json:"organization,omitempty"`
+	Department        string `json:"department,omitempty"`
+	CostCenter        string `json:"costCenter,omitempty"`
+	Division          string `json:"division,omitempty"`
+}
+
+// User represents an Okta user.
+// The Status is one of STAGED, PROVISIONED, ACTIVE, RECOVERY, PASSWORD_EXPIRED, LOCKED_OUT, SUSPENDED or DEPROVISIONED.
+type User struct {
+	ID      string      `json:"id"`
+	Status  string      `json:"status"`
+	Profile UserProfile `json:"profile"`
+}
+
+// GroupProfile represents the profile attributes of an Okta group.
+type GroupProfile struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Group represents an Okta group.
+// The Type is one of OKTA_GROUP, APP_GROUP or BUILT_IN.
+type Group struct {
+	ID      string       `json:"id"`
+	Type    string       `json:"type"`
+	Profile GroupProfile `json:"profile"`
+}
+
+// GroupRule represents an Okta group rule, the rules assign users to groups based on their profile attributes.
+// The Status is one of ACTIVE, INACTIVE or INVALID.
+// reference: https://developer.okta.com/docs/api/openapi/okta-management/management/tag/GroupRule/
+type GroupRule struct {
+	ID      string           `json:"id"`
+	Name    string           `json:"name"`
+	Status  string           `json:"status"`
+	Actions GroupRuleActions `json:"actions"`
+}
+
+// GroupRuleActions represents the actions of an Okta group rule.
+type GroupRuleActions struct {
+	AssignUserToGroups struct {
+		GroupIDs []string `json:"groupIds"`
+	} `json:"assignUserToGroups"`
+}
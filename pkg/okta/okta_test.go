@@ -0,0 +1,355 @@
+package okta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestService returns a Service for the given fake Okta server that records the
+// rate limit waits instead of sleeping. The clock starts at now and moves forward with
+// every wait, so the X-Rate-Limit-Reset of the fake server is reached like in a real wait.
+func newTestService(t *testing.T, srv *httptest.Server, now time.Time) (*Service, *[]time.Duration) {
+	t.Helper()
+
+	svc, err := NewService(srv.Client(), srv.URL, "test-token")
+	assert.NoError(t, err)
+
+	waits := make([]time.Duration, 0)
+	svc.now = func() time.Time { return now }
+	svc.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return nil
+	}
+
+	return svc, &waits
+}
+
+// setRateLimit sets the Okta rate limit headers of a response with the remaining requests
+// of the window and the UTC epoch time in seconds when it is reset.
+func setRateLimit(w http.ResponseWriter, remaining int, reset time.Time) {
+	w.Header().Set("X-Rate-Limit-Limit", "600")
+	w.Header().Set("X-Rate-Limit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-Rate-Limit-Reset", strconv.FormatInt(reset.Unix(), 10))
+}
+
+func TestNewService(t *testing.T) {
+	t.Run("empty org url", func(t *testing.T) {
+		svc, err := NewService(nil, "", "token")
+		assert.ErrorIs(t, err, ErrOrgURLEmpty)
+		assert.Nil(t, svc)
+	})
+
+	t.Run("empty api token", func(t *testing.T) {
+		svc, err := NewService(nil, "https://my-org.okta.com", "")
+		assert.ErrorIs(t, err, ErrAPITokenEmpty)
+		assert.Nil(t, svc)
+	})
+
+	t.Run("invalid url", func(t *testing.T) {
+		svc, err := NewService(nil, ":invalid", "token")
+		assert.Error(t, err)
+		assert.Nil(t, svc)
+	})
+
+	t.Run("api path", func(t *testing.T) {
+		svc, err := NewService(nil, "https://my-org.okta.com", "token")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://my-org.okta.com/api/v1", svc.url.String())
+		assert.Equal(t, DefaultMaxRetries, svc.MaxRetries)
+	})
+}
+
+func TestNextLink(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   string
+	}{
+		{
+			name:   "no link header",
+			header: http.Header{},
+			want:   "",
+		},
+		{
+			name:   "only self",
+			header: http.Header{"Link": []string{`<https://my-org.okta.com/api/v1/users?limit=200>; rel="self"`}},
+			want:   "",
+		},
+		{
+			name: "self and next in different headers",
+			header: http.Header{"Link": []string{
+				`<https://my-org.okta.com/api/v1/users?limit=200>; rel="self"`,
+				`<https://my-org.okta.com/api/v1/users?after=00u2&limit=200>; rel="next"`,
+			}},
+			want: "https://my-org.okta.com/api/v1/users?after=00u2&limit=200",
+		},
+		{
+			name:   "self and next in the same header",
+			header: http.Header{"Link": []string{`<https://my-org.okta.com/api/v1/users?limit=200>; rel="self", <https://my-org.okta.com/api/v1/users?after=00u2&limit=200>; rel="next"`}},
+			want:   "https://my-org.okta.com/api/v1/users?after=00u2&limit=200",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, nextLink(tt.header))
+		})
+	}
+}
+
+func TestService_ListUsers(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Unix(1700000000, 0)
+
+	t.Run("all the pages following the link header", func(t *testing.T) {
+		var srvURL string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/v1/users", r.URL.Path)
+			assert.Equal(t, "SSWS test-token", r.Header.Get("Authorization"))
+			assert.Empty(t, r.URL.Query().Get("search"))
+			assert.Equal(t, strconv.Itoa(DefaultPageLimit), r.URL.Query().Get("limit"))
+
+			if r.URL.Query().Get("after") == "" {
+				w.Header().Add("Link", fmt.Sprintf(`<%s/api/v1/users?limit=200>; rel="self"`, srvURL))
+				w.Header().Add("Link", fmt.Sprintf(`<%s/api/v1/users?after=00u1&limit=200>; rel="next"`, srvURL))
+				fmt.Fprint(w, `[{"id": "00u1", "status": "ACTIVE", "profile": {"login": "user.1@mail.com", "email": "user.1@mail.com", "firstName": "user", "lastName": "1"}}]`)
+				return
+			}
+
+			w.Header().Add("Link", fmt.Sprintf(`<%s/api/v1/users?after=00u1&limit=200>; rel="self"`, srvURL))
+			fmt.Fprint(w, `[{"id": "00u2", "status": "SUSPENDED", "profile": {"login": "user.2@mail.com", "email": "user.2@mail.com", "firstName": "user", "lastName": "2", "department": "IT"}}]`)
+		}))
+		defer srv.Close()
+		srvURL = srv.URL
+
+		svc, _ := newTestService(t, srv, now)
+
+		got, err := svc.ListUsers(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(got))
+		assert.Equal(t, "00u1", got[0].ID)
+		assert.Equal(t, "ACTIVE", got[0].Status)
+		assert.Equal(t, "user.1@mail.com", got[0].Profile.Login)
+		assert.Equal(t, "00u2", got[1].ID)
+		assert.Equal(t, "SUSPENDED", got[1].Status)
+		assert.Equal(t, "IT", got[1].Profile.Department)
+	})
+
+	t.Run("one request per search expression", func(t *testing.T) {
+		searches := make([]string, 0)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			searches = append(searches, r.URL.Query().Get("search"))
+			fmt.Fprint(w, `[{"id": "00u1", "profile": {"login": "user.1@mail.com"}}]`)
+		}))
+		defer srv.Close()
+
+		svc, _ := newTestService(t, srv, now)
+
+		got, err := svc.ListUsers(ctx, []string{`profile.department eq "IT"`, "", `profile.department eq "HR"`})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(got))
+		assert.Equal(t, []string{`profile.department eq "IT"`, `profile.department eq "HR"`}, searches)
+	})
+
+	t.Run("okta error", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"errorCode": "E0000011", "errorSummary": "Invalid token provided", "errorId": "oae1"}`)
+		}))
+		defer srv.Close()
+
+		svc, _ := newTestService(t, srv, now)
+
+		got, err := svc.ListUsers(ctx, nil)
+		assert.Error(t, err)
+		assert.Nil(t, got)
+
+		var httpErr *HTTPResponseError
+		assert.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, http.StatusUnauthorized, httpErr.StatusCode)
+		assert.Equal(t, "E0000011", httpErr.Code)
+		assert.Equal(t, "Invalid token provided", httpErr.Message)
+	})
+}
+
+func TestService_RateLimit(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Unix(1700000000, 0)
+
+	t.Run("retries after the reset when too many requests", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				setRateLimit(w, 0, now.Add(10*time.Second))
+				w.WriteHeader(http.StatusTooManyRequests)
+				fmt.Fprint(w, `{"errorCode": "E0000047", "errorSummary": "API call exceeded rate limit due to too many requests."}`)
+				return
+			}
+			setRateLimit(w, 599, now.Add(time.Minute))
+			fmt.Fprint(w, `[{"id": "00g1", "type": "OKTA_GROUP", "profile": {"name": "group 1"}}]`)
+		}))
+		defer srv.Close()
+
+		svc, waits := newTestService(t, srv, now)
+
+		got, err := svc.ListGroups(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(got))
+		assert.Equal(t, "group 1", got[0].Profile.Name)
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, []time.Duration{10 * time.Second}, *waits)
+	})
+
+	t.Run("waits before the next request when there are no remaining requests", func(t *testing.T) {
+		var srvURL string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("after") == "" {
+				setRateLimit(w, 0, now.Add(5*time.Second))
+				w.Header().Set("Link", fmt.Sprintf(`<%s/api/v1/groups/00g1/users?after=00u1>; rel="next"`, srvURL))
+				fmt.Fprint(w, `[{"id": "00u1", "profile": {"login": "user.1@mail.com"}}]`)
+				return
+			}
+			fmt.Fprint(w, `[{"id": "00u2", "profile": {"login": "user.2@mail.com"}}]`)
+		}))
+		defer srv.Close()
+		srvURL = srv.URL
+
+		svc, waits := newTestService(t, srv, now)
+
+		got, err := svc.ListGroupMembers(ctx, "00g1")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(got))
+		assert.Equal(t, []time.Duration{5 * time.Second}, *waits)
+	})
+
+	t.Run("waits only once for the same reset of the rate limit window", func(t *testing.T) {
+		var srvURL string
+		reset := now.Add(5 * time.Second)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the two first pages use the last request of the window, the third one a new window
+			switch r.URL.Query().Get("after") {
+			case "":
+				setRateLimit(w, 0, reset)
+				w.Header().Set("Link", fmt.Sprintf(`<%s/api/v1/groups/00g1/users?after=00u1>; rel="next"`, srvURL))
+				fmt.Fprint(w, `[{"id": "00u1", "profile": {"login": "user.1@mail.com"}}]`)
+			case "00u1":
+				setRateLimit(w, 0, reset)
+				w.Header().Set("Link", fmt.Sprintf(`<%s/api/v1/groups/00g1/users?after=00u2>; rel="next"`, srvURL))
+				fmt.Fprint(w, `[{"id": "00u2", "profile": {"login": "user.2@mail.com"}}]`)
+			default:
+				setRateLimit(w, 599, reset.Add(time.Minute))
+				fmt.Fprint(w, `[{"id": "00u3", "profile": {"login": "user.3@mail.com"}}]`)
+			}
+		}))
+		defer srv.Close()
+		srvURL = srv.URL
+
+		svc, waits := newTestService(t, srv, now)
+
+		got, err := svc.ListGroupMembers(ctx, "00g1")
+		assert.NoError(t, err)
+		assert.Equal(t, 3, len(got))
+		assert.Equal(t, []time.Duration{5 * time.Second}, *waits)
+	})
+
+	t.Run("waits up to the max for a reset far away", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				setRateLimit(w, 0, now.Add(time.Hour))
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			fmt.Fprint(w, `{"id": "00u1", "profile": {"login": "user.1@mail.com"}}`)
+		}))
+		defer srv.Close()
+
+		svc, waits := newTestService(t, srv, now)
+
+		got, err := svc.GetUser(ctx, "00u1")
+		assert.NoError(t, err)
+		assert.Equal(t, "00u1", got.ID)
+		assert.Equal(t, []time.Duration{MaxRateLimitWait}, *waits)
+	})
+
+	t.Run("fails when the retries are exhausted", func(t *testing.T) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"errorCode": "E0000047", "errorSummary": "API call exceeded rate limit due to too many requests."}`)
+		}))
+		defer srv.Close()
+
+		svc, waits := newTestService(t, srv, now)
+		svc.MaxRetries = 2
+
+		got, err := svc.GetUser(ctx, "00u1")
+		assert.Error(t, err)
+		assert.Nil(t, got)
+		assert.Equal(t, 3, calls)
+		assert.Equal(t, []time.Duration{DefaultRateLimitWait, DefaultRateLimitWait}, *waits)
+
+		var httpErr *HTTPResponseError
+		assert.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, "E0000047", httpErr.Code)
+	})
+}
+
+func TestService_ListGroupMembers(t *testing.T) {
+	got, err := (&Service{}).ListGroupMembers(context.TODO(), "")
+	assert.ErrorIs(t, err, ErrGroupIDEmpty)
+	assert.Nil(t, got)
+}
+
+func TestService_ListGroupRules(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/groups/rules", r.URL.Path)
+		fmt.Fprint(w, `[{"id": "0pr1", "name": "engineering", "status": "ACTIVE", "actions": {"assignUserToGroups": {"groupIds": ["00g1", "00g2"]}}}]`)
+	}))
+	defer srv.Close()
+
+	svc, _ := newTestService(t, srv, time.Now())
+
+	got, err := svc.ListGroupRules(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(got))
+	assert.Equal(t, "ACTIVE", got[0].Status)
+	assert.Equal(t, []string{"00g1", "00g2"}, got[0].Actions.AssignUserToGroups.GroupIDs)
+}
+
+func TestService_GetUser(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("empty user id", func(t *testing.T) {
+		got, err := (&Service{}).GetUser(ctx, "")
+		assert.ErrorIs(t, err, ErrUserIDEmpty)
+		assert.Nil(t, got)
+	})
+
+	t.Run("user", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/v1/users/00u1", r.URL.Path)
+			fmt.Fprint(w, `{"id": "00u1", "status": "ACTIVE", "profile": {"login": "user.1@mail.com", "firstName": "user", "lastName": "1", "title": "engineer"}}`)
+		}))
+		defer srv.Close()
+
+		svc, _ := newTestService(t, srv, time.Now())
+
+		got, err := svc.GetUser(ctx, "00u1")
+		assert.NoError(t, err)
+		assert.Equal(t, "00u1", got.ID)
+		assert.Equal(t, "engineer", got.Profile.Title)
+	})
+}
@@ -0,0 +1,576 @@
+package scim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// SCIM 2.0 client
+// references:
+// - https://datatracker.ietf.org/doc/html/rfc7643
+// - https://datatracker.ietf.org/doc/html/rfc7644
+
+var (
+	// ErrURLEmpty is returned when the URL is empty.
+	ErrURLEmpty = errors.New("scim: url may not be empty")
+
+	// ErrBearerTokenEmpty is returned when the bearer token is empty.
+	ErrBearerTokenEmpty = errors.New("scim: bearer token may not be empty")
+
+	// ErrUserNil is returned when the user is nil.
+	ErrUserNil = errors.New("scim: user may not be nil")
+
+	// ErrUserIDEmpty is returned when the user id is empty.
+	ErrUserIDEmpty = errors.New("scim: user id may not be empty")
+
+	// ErrUserNameEmpty is returned when the userName is empty.
+	ErrUserNameEmpty = errors.New("scim: userName may not be empty")
+
+	// ErrGroupNil is returned when the group is nil.
+	ErrGroupNil = errors.New("scim: group may not be nil")
+
+	// ErrGroupIDEmpty is returned when the group id is empty.
+	ErrGroupIDEmpty = errors.New("scim: group id may not be empty")
+
+	// ErrGroupDisplayNameEmpty is returned when the group displayName is empty.
+	ErrGroupDisplayNameEmpty = errors.New("scim: displayName may not be empty")
+
+	// ErrUserNotFound is returned when the user doesn't exist.
+	ErrUserNotFound = errors.New("scim: user not found")
+
+	// ErrGroupNotFound is returned when the group doesn't exist.
+	ErrGroupNotFound = errors.New("scim: group not found")
+)
+
+// HTTPClient is an interface for sending HTTP requests.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Service is a SCIM 2.0 client, its requests are adapted to the quirks of the service provider
+// defined in its Profile.
+type Service struct {
+	httpClient  HTTPClient
+	url         *url.URL
+	bearerToken string
+	profile     Profile
+	UserAgent   string
+}
+
+// NewService creates a new SCIM 2.0 client for the given base url, example: https://api.slack.com/scim/v2,
+// authenticated with a bearer token.
+func NewService(httpClient HTTPClient, urlStr, token string, profile Profile) (*Service, error) {
+	if urlStr == "" {
+		return nil, ErrURLEmpty
+	}
+	if token == "" {
+		return nil, ErrBearerTokenEmpty
+	}
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, fmt.Errorf("scim: error parsing url: %w", err)
+	}
+
+	if profile.PageSize <= 0 {
+		profile.PageSize = DefaultPageSize
+	}
+	if profile.MaxMembersPerPatch <= 0 {
+		profile.MaxMembersPerPatch = DefaultMaxMembersPerPatch
+	}
+
+	return &Service{
+		httpClient:  httpClient,
+		url:         u,
+		bearerToken: token,
+		profile:     profile,
+	}, nil
+}
+
+// Profile returns the profile used by the client.
+func (s *Service) Profile() Profile {
+	return s.profile
+}
+
+// Discover reads the ServiceProviderConfig of the service provider and disables
+// in the profile the features it doesn't support.
+func (s *Service) Discover(ctx context.Context) error {
+	spc, err := s.ServiceProviderConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.profile = s.profile.WithServiceProviderConfig(spc)
+
+	slog.Debug("scim: Discover()",
+		"profile", s.profile.Name,
+		"patch", s.profile.PatchSupported,
+		"filter", s.profile.FilterSupported,
+		"pageSize", s.profile.PageSize,
+	)
+
+	return nil
+}
+
+// newURL returns the url of the given resource path with the given query.
+func (s *Service) newURL(resource string, query url.Values) *url.URL {
+	u := *s.url
+	u.Path = path.Join(u.Path, resource)
+	u.RawQuery = query.Encode()
+
+	return &u
+}
+
+// request sends a request with the given body and decodes the response body into v when it is not nil.
+func (s *Service) request(ctx context.Context, method string, u *url.URL, body, v interface{}) error {
+	var buf io.Reader
+	if body != nil {
+		b := &bytes.Buffer{}
+		enc := json.NewEncoder(b)
+		enc.SetEscapeHTML(false)
+
+		if err := enc.Encode(body); err != nil {
+			return fmt.Errorf("scim: error encoding request body: %w", err)
+		}
+		buf = b
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), buf)
+	if err != nil {
+		return fmt.Errorf("scim: error creating request, http method: %s, url: %s, error: %w", method, u.String(), err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/scim+json")
+	}
+	req.Header.Set("Accept", "application/scim+json, application/json")
+	req.Header.Set("Authorization", "Bearer "+s.bearerToken)
+
+	if s.UserAgent != "" {
+		req.Header.Set("User-Agent", s.UserAgent)
+	}
+
+	slog.Debug("scim: request()", "method", method, "url", u.String())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("scim: error sending request, http method: %s, url: %s, error: %w", method, u.String(), err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkHTTPResponse(resp); err != nil {
+		return err
+	}
+
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("scim: error decoding response body, http method: %s, url: %s, error: %w", method, u.String(), err)
+	}
+
+	return nil
+}
+
+// checkHTTPResponse returns a HTTPResponseError when the status code of the response is not successful.
+func checkHTTPResponse(resp *http.Response) error {
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("scim: error reading response body: %w", err)
+	}
+
+	slog.Debug("scim: checkHTTPResponse()", "statusCode", resp.StatusCode, "status", resp.Status, "body", string(body))
+
+	httpErr := &HTTPResponseError{StatusCode: resp.StatusCode, Detail: string(body)}
+
+	var er errorResponse
+	if err := json.Unmarshal(body, &er); err == nil && er.Detail != "" {
+		httpErr.SCIMType = er.SCIMType
+		httpErr.Detail = er.Detail
+	}
+
+	return httpErr
+}
+
+// isStatus returns true when the error is a HTTPResponseError with the given status code.
+func isStatus(err error, statusCode int) bool {
+	var httpErr *HTTPResponseError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == statusCode
+}
+
+// list returns all the resources of the given resource path, requesting the pages
+// of the profile page size until all the resources are returned.
+func list[T any](ctx context.Context, s *Service, resource string, query url.Values) ([]T, error) {
+	resources := make([]T, 0)
+
+	for startIndex := 1; ; {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("startIndex", strconv.Itoa(startIndex))
+		q.Set("count", strconv.Itoa(s.profile.PageSize))
+
+		var page ListResponse[T]
+		if err := s.request(ctx, http.MethodGet, s.newURL(resource, q), nil, &page); err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, page.Resources...)
+
+		if len(page.Resources) == 0 || len(resources) >= page.TotalResults {
+			break
+		}
+
+		startIndex += len(page.Resources)
+	}
+
+	return resources, nil
+}
+
+// filterQuery returns the query with the given filter.
+func filterQuery(filter string) url.Values {
+	q := url.Values{}
+	if filter != "" {
+		q.Set("filter", filter)
+	}
+
+	return q
+}
+
+// ServiceProviderConfig returns the configuration of the service provider
+// reference: https://datatracker.ietf.org/doc/html/rfc7644#section-4
+func (s *Service) ServiceProviderConfig(ctx context.Context) (*ServiceProviderConfig, error) {
+	var spc ServiceProviderConfig
+	if err := s.request(ctx, http.MethodGet, s.newURL("/ServiceProviderConfig", nil), nil, &spc); err != nil {
+		return nil, fmt.Errorf("scim: error getting service provider config: %w", err)
+	}
+
+	return &spc, nil
+}
+
+// ListUsers returns all the users that match the filter, all the users when the filter is empty.
+func (s *Service) ListUsers(ctx context.Context, filter string) ([]*User, error) {
+	users, err := list[*User](ctx, s, "/Users", filterQuery(filter))
+	if err != nil {
+		return nil, fmt.Errorf("scim: error listing users: %w", err)
+	}
+
+	slog.Debug("scim: ListUsers()", "users", len(users))
+
+	return users, nil
+}
+
+// GetUser returns the user with the given id.
+func (s *Service) GetUser(ctx context.Context, id string) (*User, error) {
+	if id == "" {
+		return nil, ErrUserIDEmpty
+	}
+
+	var user User
+	if err := s.request(ctx, http.MethodGet, s.newURL("/Users/"+id, nil), nil, &user); err != nil {
+		if isStatus(err, http.StatusNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, id)
+		}
+		return nil, fmt.Errorf("scim: error getting user: %s, %w", id, err)
+	}
+
+	return &user, nil
+}
+
+// GetUserByUserName returns the user with the given userName, when the service provider
+// doesn't support filters all the users are listed to find it.
+func (s *Service) GetUserByUserName(ctx context.Context, userName string) (*User, error) {
+	if userName == "" {
+		return nil, ErrUserNameEmpty
+	}
+
+	filter := ""
+	if s.profile.FilterSupported {
+		filter = fmt.Sprintf("userName eq %s", strconv.Quote(userName))
+	}
+
+	users, err := s.ListUsers(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		if strings.EqualFold(user.UserName, userName) {
+			return user, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUserNotFound, userName)
+}
+
+// CreateUser creates a user and returns it with its id.
+func (s *Service) CreateUser(ctx context.Context, user *User) (*User, error) {
+	if user == nil {
+		return nil, ErrUserNil
+	}
+	if user.UserName == "" {
+		return nil, ErrUserNameEmpty
+	}
+
+	body := s.userRequest(user)
+
+	var created User
+	if err := s.request(ctx, http.MethodPost, s.newURL("/Users", nil), body, &created); err != nil {
+		return nil, fmt.Errorf("scim: error creating user: %s, %w", user.UserName, err)
+	}
+
+	return &created, nil
+}
+
+// CreateOrGetUser creates a user, when the user already exists (HTTP 409) it returns the existing user.
+func (s *Service) CreateOrGetUser(ctx context.Context, user *User) (*User, error) {
+	created, err := s.CreateUser(ctx, user)
+	if err == nil {
+		return created, nil
+	}
+
+	if !isStatus(err, http.StatusConflict) {
+		return nil, err
+	}
+
+	slog.Warn("scim: user already exists, trying to get the user information", "user", user.UserName)
+
+	return s.GetUserByUserName(ctx, user.UserName)
+}
+
+// ReplaceUser replaces all the attributes of the user with the given id.
+func (s *Service) ReplaceUser(ctx context.Context, user *User) (*User, error) {
+	if user == nil {
+		return nil, ErrUserNil
+	}
+	if user.ID == "" {
+		return nil, ErrUserIDEmpty
+	}
+
+	body := s.userRequest(user)
+
+	var replaced User
+	if err := s.request(ctx, http.MethodPut, s.newURL("/Users/"+user.ID, nil), body, &replaced); err != nil {
+		return nil, fmt.Errorf("scim: error replacing user: %s, %w", user.UserName, err)
+	}
+
+	return &replaced, nil
+}
+
+// DeleteUser deletes the user with the given id.
+func (s *Service) DeleteUser(ctx context.Context, id string) error {
+	if id == "" {
+		return ErrUserIDEmpty
+	}
+
+	if err := s.request(ctx, http.MethodDelete, s.newURL("/Users/"+id, nil), nil, nil); err != nil {
+		return fmt.Errorf("scim: error deleting user: %s, %w", id, err)
+	}
+
+	return nil
+}
+
+// userRequest returns a copy of the user with the attributes supported by the profile.
+func (s *Service) userRequest(user *User) *User {
+	u := *user
+	u.Meta = nil
+	u.Schemas = []string{SchemaUser}
+
+	// only the primary email, or the first one when none of them is primary
+	if !s.profile.MultipleEmails && len(u.Emails) > 1 {
+		primary := u.Emails[0]
+		for _, email := range u.Emails {
+			if email.Primary {
+				primary = email
+				break
+			}
+		}
+		primary.Primary = true
+		u.Emails = []Email{primary}
+	}
+
+	if !s.profile.EnterpriseExtension {
+		u.EnterpriseUser = nil
+	}
+	if u.EnterpriseUser != nil {
+		u.Schemas = append(u.Schemas, SchemaEnterpriseUser)
+	}
+
+	return &u
+}
+
+// ListGroups returns all the groups that match the filter, all the groups when the filter is empty.
+// The members of the groups are only requested when the profile includes them in the list responses.
+func (s *Service) ListGroups(ctx context.Context, filter string) ([]*Group, error) {
+	q := filterQuery(filter)
+	if !s.profile.GroupMembersInList {
+		q.Set("excludedAttributes", "members")
+	}
+
+	groups, err := list[*Group](ctx, s, "/Groups", q)
+	if err != nil {
+		return nil, fmt.Errorf("scim: error listing groups: %w", err)
+	}
+
+	slog.Debug("scim: ListGroups()", "groups", len(groups))
+
+	return groups, nil
+}
+
+// GetGroup returns the group with the given id and its members.
+func (s *Service) GetGroup(ctx context.Context, id string) (*Group, error) {
+	if id == "" {
+		return nil, ErrGroupIDEmpty
+	}
+
+	var group Group
+	if err := s.request(ctx, http.MethodGet, s.newURL("/Groups/"+id, nil), nil, &group); err != nil {
+		if isStatus(err, http.StatusNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, id)
+		}
+		return nil, fmt.Errorf("scim: error getting group: %s, %w", id, err)
+	}
+
+	return &group, nil
+}
+
+// GetGroupByDisplayName returns the group with the given displayName, when the service provider
+// doesn't support filters all the groups are listed to find it.
+func (s *Service) GetGroupByDisplayName(ctx context.Context, displayName string) (*Group, error) {
+	if displayName == "" {
+		return nil, ErrGroupDisplayNameEmpty
+	}
+
+	filter := ""
+	if s.profile.FilterSupported {
+		filter = fmt.Sprintf("displayName eq %s", strconv.Quote(displayName))
+	}
+
+	groups, err := s.ListGroups(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range groups {
+		if group.DisplayName == displayName {
+			return group, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, displayName)
+}
+
+// CreateGroup creates a group and returns it with its id.
+func (s *Service) CreateGroup(ctx context.Context, group *Group) (*Group, error) {
+	if group == nil {
+		return nil, ErrGroupNil
+	}
+	if group.DisplayName == "" {
+		return nil, ErrGroupDisplayNameEmpty
+	}
+
+	g := *group
+	g.Meta = nil
+	g.Schemas = []string{SchemaGroup}
+
+	var created Group
+	if err := s.request(ctx, http.MethodPost, s.newURL("/Groups", nil), &g, &created); err != nil {
+		return nil, fmt.Errorf("scim: error creating group: %s, %w", group.DisplayName, err)
+	}
+
+	return &created, nil
+}
+
+// CreateOrGetGroup creates a group, when the group already exists (HTTP 409) it returns the existing group.
+func (s *Service) CreateOrGetGroup(ctx context.Context, group *Group) (*Group, error) {
+	created, err := s.CreateGroup(ctx, group)
+	if err == nil {
+		return created, nil
+	}
+
+	if !isStatus(err, http.StatusConflict) {
+		return nil, err
+	}
+
+	slog.Warn("scim: group already exists, trying to get the group information", "group", group.DisplayName)
+
+	return s.GetGroupByDisplayName(ctx, group.DisplayName)
+}
+
+// ReplaceGroup replaces all the attributes of the group with the given id, including its members.
+func (s *Service) ReplaceGroup(ctx context.Context, group *Group) (*Group, error) {
+	if group == nil {
+		return nil, ErrGroupNil
+	}
+	if group.ID == "" {
+		return nil, ErrGroupIDEmpty
+	}
+
+	g := *group
+	g.Meta = nil
+	g.Schemas = []string{SchemaGroup}
+
+	// the members are always sent, an empty list removes all of them
+	body := &replaceGroupRequest{Group: g, Members: g.Members}
+	if body.Members == nil {
+		body.Members = []*Member{}
+	}
+
+	var replaced Group
+	if err := s.request(ctx, http.MethodPut, s.newURL("/Groups/"+group.ID, nil), body, &replaced); err != nil {
+		return nil, fmt.Errorf("scim: error replacing group: %s, %w", group.DisplayName, err)
+	}
+
+	return &replaced, nil
+}
+
+// PatchGroup applies the operations to the group with the given id.
+func (s *Service) PatchGroup(ctx context.Context, id string, operations ...*Operation) error {
+	if id == "" {
+		return ErrGroupIDEmpty
+	}
+
+	body := &PatchRequest{
+		Schemas:    []string{SchemaPatchOp},
+		Operations: operations,
+	}
+
+	if err := s.request(ctx, http.MethodPatch, s.newURL("/Groups/"+id, nil), body, nil); err != nil {
+		return fmt.Errorf("scim: error patching group: %s, %w", id, err)
+	}
+
+	return nil
+}
+
+// DeleteGroup deletes the group with the given id.
+func (s *Service) DeleteGroup(ctx context.Context, id string) error {
+	if id == "" {
+		return ErrGroupIDEmpty
+	}
+
+	if err := s.request(ctx, http.MethodDelete, s.newURL("/Groups/"+id, nil), nil, nil); err != nil {
+		return fmt.Errorf("scim: error deleting group: %s, %w", id, err)
+	}
+
+	return nil
+}
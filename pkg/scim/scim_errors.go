@@ -0,0 +1,24 @@
+package scim
+
+import "fmt"
+
+// HTTPResponseError represents an error returned by a SCIM service provider.
+// reference: https://datatracker.ietf.org/doc/html/rfc7644#section-3.12
+type HTTPResponseError struct {
+	StatusCode int    `json:"statusCode"`
+	SCIMType   string `json:"scimType"`
+	Detail     string `json:"detail"`
+}
+
+func (e *HTTPResponseError) Error() string {
+	return fmt.Sprintf("statusCode: %d, scimType: %s, detail: %s", e.StatusCode, e.SCIMType, e.Detail)
+}
+
+// errorResponse is the body of the SCIM errors, some service providers
+// return the status as a number instead of a string.
+type errorResponse struct {
+	Schemas  []string    `json:"schemas"`
+	Status   interface{} `json:"status"`
+	SCIMType string      `json:"scimType"`
+	Detail   string      `json:"detail"`
+}
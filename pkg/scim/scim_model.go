@@ -0,0 +1,200 @@
+package scim
+
+const (
+	// SchemaUser is the schema of the user resources.
+	SchemaUser = "urn:ietf:params:scim:schemas:core:2.0:User"
+
+	// SchemaEnterpriseUser is the schema of the enterprise user extension.
+	SchemaEnterpriseUser = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+
+	// SchemaGroup is the schema of the group resources.
+	SchemaGroup = "urn:ietf:params:scim:schemas:core:2.0:Group"
+
+	// SchemaListResponse is the schema of the list responses.
+	SchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+
+	// SchemaPatchOp is the schema of the patch requests.
+	SchemaPatchOp = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+)
+
+// Name represent a name entity
+type Name struct {
+	Formatted       string `json:"formatted,omitempty"`
+	FamilyName      string `json:"familyName,omitempty"`
+	GivenName       string `json:"givenName,omitempty"`
+	MiddleName      string `json:"middleName,omitempty"`
+	HonorificPrefix string `json:"honorificPrefix,omitempty"`
+	HonorificSuffix string `json:"honorificSuffix,omitempty"`
+}
+
+// Email represent an email entity
+type Email struct {
+	Value   string `json:"value,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// Address represent an address entity
+type Address struct {
+	Formatted     string `json:"formatted,omitempty"`
+	StreetAddress string `json:"streetAddress,omitempty"`
+	Locality      string `json:"locality,omitempty"`
+	Region        string `json:"region,omitempty"`
+	PostalCode    string `json:"postalCode,omitempty"`
+	Country       string `json:"country,omitempty"`
+	Type          string `json:"type,omitempty"`
+	Primary       bool   `json:"primary,omitempty"`
+}
+
+// PhoneNumber represent a phone number entity
+type PhoneNumber struct {
+	Value string `json:"value,omitempty"`
+	Type  string `json:"type,omitempty"`
+}
+
+// Manager represent the manager of an enterprise user
+type Manager struct {
+	Value string `json:"value,omitempty"`
+	Ref   string `json:"$ref,omitempty"`
+}
+
+// EnterpriseUser represent the enterprise user extension
+type EnterpriseUser struct {
+	EmployeeNumber string   `json:"employeeNumber,omitempty"`
+	CostCenter     string   `json:"costCenter,omitempty"`
+	Organization   string   `json:"organization,omitempty"`
+	Division       string   `json:"division,omitempty"`
+	Department     string   `json:"department,omitempty"`
+	Manager        *Manager `json:"manager,omitempty"`
+}
+
+// Meta represent a meta entity
+type Meta struct {
+	ResourceType string `json:"resourceType,omitempty"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+	Version      string `json:"version,omitempty"`
+}
+
+// User represent a user resource
+// reference: https://datatracker.ietf.org/doc/html/rfc7643#section-4.1
+type User struct {
+	ID                string          `json:"id,omitempty"`
+	ExternalID        string          `json:"externalId,omitempty"`
+	UserName          string          `json:"userName,omitempty"`
+	DisplayName       string          `json:"displayName,omitempty"`
+	NickName          string          `json:"nickName,omitempty"`
+	ProfileURL        string          `json:"profileUrl,omitempty"`
+	UserType          string          `json:"userType,omitempty"`
+	Title             string          `json:"title,omitempty"`
+	PreferredLanguage string          `json:"preferredLanguage,omitempty"`
+	Locale            string          `json:"locale,omitempty"`
+	Timezone          string          `json:"timezone,omitempty"`
+	Name              *Name           `json:"name,omitempty"`
+	Meta              *Meta           `json:"meta,omitempty"`
+	EnterpriseUser    *EnterpriseUser `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
+	Schemas           []string        `json:"schemas,omitempty"`
+	Addresses         []Address       `json:"addresses,omitempty"`
+	Emails            []Email         `json:"emails,omitempty"`
+	PhoneNumbers      []PhoneNumber   `json:"phoneNumbers,omitempty"`
+	Active            *bool           `json:"active,omitempty"`
+}
+
+// GetPrimaryEmailAddress returns the primary email address of the user,
+// or the first one when none of them is primary
+func (u *User) GetPrimaryEmailAddress() string {
+	for _, email := range u.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+
+	return ""
+}
+
+// IsActive returns the active attribute of the user, the users are active when it is missing
+func (u *User) IsActive() bool {
+	return u.Active == nil || *u.Active
+}
+
+// Member represent a member of a group
+type Member struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+// Group represent a group resource
+// reference: https://datatracker.ietf.org/doc/html/rfc7643#section-4.2
+type Group struct {
+	ID          string    `json:"id,omitempty"`
+	ExternalID  string    `json:"externalId,omitempty"`
+	DisplayName string    `json:"displayName"`
+	Meta        *Meta     `json:"meta,omitempty"`
+	Schemas     []string  `json:"schemas,omitempty"`
+	Members     []*Member `json:"members,omitempty"`
+}
+
+// replaceGroupRequest is the body of the replace group requests, the members are never omitted
+type replaceGroupRequest struct {
+	Group
+	Members []*Member `json:"members"`
+}
+
+// ListResponse represent a page of a list of resources
+// reference: https://datatracker.ietf.org/doc/html/rfc7644#section-3.4.2
+type ListResponse[T any] struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	StartIndex   int      `json:"startIndex"`
+	Resources    []T      `json:"Resources"`
+}
+
+// Operation represent an operation of a patch request
+type Operation struct {
+	OP    string      `json:"op"`
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// PatchRequest represent a patch request
+// reference: https://datatracker.ietf.org/doc/html/rfc7644#section-3.5.2
+type PatchRequest struct {
+	Schemas    []string     `json:"schemas"`
+	Operations []*Operation `json:"Operations"`
+}
+
+// ServiceProviderConfig represent the configuration of a SCIM service provider
+// reference: https://datatracker.ietf.org/doc/html/rfc7643#section-5
+type ServiceProviderConfig struct {
+	Schemas          []string `json:"schemas"`
+	DocumentationURI string   `json:"documentationUri,omitempty"`
+	Patch            struct {
+		Supported bool `json:"supported"`
+	} `json:"patch"`
+	Bulk struct {
+		Supported      bool `json:"supported"`
+		MaxOperations  int  `json:"maxOperations"`
+		MaxPayloadSize int  `json:"maxPayloadSize"`
+	} `json:"bulk"`
+	Filter struct {
+		Supported  bool `json:"supported"`
+		MaxResults int  `json:"maxResults"`
+	} `json:"filter"`
+	ChangePassword struct {
+		Supported bool `json:"supported"`
+	} `json:"changePassword"`
+	Sort struct {
+		Supported bool `json:"supported"`
+	} `json:"sort"`
+	Etag struct {
+		Supported bool `json:"supported"`
+	} `json:"etag"`
+}
@@ -0,0 +1,140 @@
+package scim
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	// ProfileGeneric is the profile of the service providers that follow the RFC 7643 and RFC 7644.
+	ProfileGeneric = "generic"
+
+	// ProfileSlack is the profile of the Slack SCIM API.
+	ProfileSlack = "slack"
+
+	// ProfileGitHub is the profile of the GitHub Enterprise (Enterprise Managed Users) SCIM API.
+	ProfileGitHub = "github"
+
+	// ProfileAtlassian is the profile of the Atlassian (Atlassian Guard) user provisioning SCIM API.
+	ProfileAtlassian = "atlassian"
+
+	// DefaultPageSize is the number of resources requested per page.
+	DefaultPageSize = 100
+
+	// DefaultMaxMembersPerPatch is the maximum number of members added or removed in a single patch request.
+	DefaultMaxMembersPerPatch = 100
+)
+
+// ErrProfileUnknown is returned when the profile name is not one of the known profiles.
+var ErrProfileUnknown = errors.New("scim: profile is unknown")
+
+// Profile contains the quirks of a SCIM service provider, the ones the service provider
+// announces in its ServiceProviderConfig are applied on top of it using WithServiceProviderConfig.
+type Profile struct {
+	// Name of the profile, example: slack
+	Name string
+
+	// PatchSupported is false when the groups members must be replaced using PUT with the full list of members
+	PatchSupported bool
+
+	// FilterSupported is false when the resources are searched listing all of them
+	FilterSupported bool
+
+	// PageSize is the number of resources requested per page in the list requests
+	PageSize int
+
+	// MaxMembersPerPatch is the maximum number of members added or removed in a single patch request
+	MaxMembersPerPatch int
+
+	// MultipleEmails is false when only the primary email of the users is sent
+	MultipleEmails bool
+
+	// EnterpriseExtension is false when the enterprise user extension is not sent
+	EnterpriseExtension bool
+
+	// GroupMembersInList is true when the groups list responses include the members of the groups,
+	// otherwise every group is requested to get its members
+	GroupMembersInList bool
+}
+
+var profiles = map[string]Profile{
+	ProfileGeneric: {
+		Name:                ProfileGeneric,
+		PatchSupported:      true,
+		FilterSupported:     true,
+		PageSize:            DefaultPageSize,
+		MaxMembersPerPatch:  DefaultMaxMembersPerPatch,
+		MultipleEmails:      true,
+		EnterpriseExtension: true,
+	},
+	ProfileSlack: {
+		Name:                ProfileSlack,
+		PatchSupported:      true,
+		FilterSupported:     true,
+		PageSize:            1000,
+		MaxMembersPerPatch:  DefaultMaxMembersPerPatch,
+		MultipleEmails:      true,
+		EnterpriseExtension: true,
+		GroupMembersInList:  true,
+	},
+	ProfileGitHub: {
+		Name:               ProfileGitHub,
+		PatchSupported:     true,
+		FilterSupported:    true,
+		PageSize:           DefaultPageSize,
+		MaxMembersPerPatch: DefaultMaxMembersPerPatch,
+		MultipleEmails:     true,
+	},
+	ProfileAtlassian: {
+		Name:                ProfileAtlassian,
+		PatchSupported:      true,
+		FilterSupported:     true,
+		PageSize:            DefaultPageSize,
+		MaxMembersPerPatch:  DefaultMaxMembersPerPatch,
+		EnterpriseExtension: true,
+	},
+}
+
+// GetProfile returns the profile with the given name.
+func GetProfile(name string) (Profile, error) {
+	p, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("%w: %s", ErrProfileUnknown, name)
+	}
+
+	return p, nil
+}
+
+// ProfileNames returns the names of the known profiles sorted alphabetically.
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// WithServiceProviderConfig returns a copy of the profile with the features
+// not supported by the service provider disabled.
+func (p Profile) WithServiceProviderConfig(spc *ServiceProviderConfig) Profile {
+	if spc == nil {
+		return p
+	}
+
+	if !spc.Patch.Supported {
+		p.PatchSupported = false
+	}
+
+	if !spc.Filter.Supported {
+		p.FilterSupported = false
+	}
+
+	if spc.Filter.MaxResults > 0 && (p.PageSize <= 0 || spc.Filter.MaxResults < p.PageSize) {
+		p.PageSize = spc.Filter.MaxResults
+	}
+
+	return p
+}
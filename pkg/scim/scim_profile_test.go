@@ -0,0 +1,48 @@
+package scim
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetProfile(t *testing.T) {
+	for _, name := range ProfileNames() {
+		got, err := GetProfile(name)
+		assert.NoError(t, err)
+		assert.Equal(t, name, got.Name)
+		assert.Greater(t, got.PageSize, 0)
+	}
+
+	_, err := GetProfile("aws")
+	assert.ErrorIs(t, err, ErrProfileUnknown)
+
+	assert.Equal(t, []string{ProfileAtlassian, ProfileGeneric, ProfileGitHub, ProfileSlack}, ProfileNames())
+}
+
+func TestProfile_WithServiceProviderConfig(t *testing.T) {
+	profile, err := GetProfile(ProfileSlack)
+	assert.NoError(t, err)
+
+	got := profile.WithServiceProviderConfig(nil)
+	assert.Equal(t, profile, got)
+
+	spc := &ServiceProviderConfig{}
+	spc.Patch.Supported = true
+	spc.Filter.MaxResults = 5000
+
+	// a bigger max results doesn't change the page size
+	got = profile.WithServiceProviderConfig(spc)
+	assert.True(t, got.PatchSupported)
+	assert.False(t, got.FilterSupported)
+	assert.Equal(t, 1000, got.PageSize)
+
+	spc.Patch.Supported = false
+	spc.Filter.Supported = true
+	spc.Filter.MaxResults = 200
+
+	got = profile.WithServiceProviderConfig(spc)
+	assert.False(t, got.PatchSupported)
+	assert.True(t, got.FilterSupported)
+	assert.Equal(t, 200, got.PageSize)
+}
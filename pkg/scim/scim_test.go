@@ -0,0 +1,343 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestService(t *testing.T, handler http.HandlerFunc, profile Profile) *Service {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	svc, err := NewService(srv.Client(), srv.URL+"/scim/v2", "test-token", profile)
+	assert.NoError(t, err)
+
+	return svc
+}
+
+func TestNewService(t *testing.T) {
+	t.Run("empty url", func(t *testing.T) {
+		svc, err := NewService(nil, "", "token", Profile{})
+		assert.ErrorIs(t, err, ErrURLEmpty)
+		assert.Nil(t, svc)
+	})
+
+	t.Run("empty token", func(t *testing.T) {
+		svc, err := NewService(nil, "https://api.example.com/scim/v2", "", Profile{})
+		assert.ErrorIs(t, err, ErrBearerTokenEmpty)
+		assert.Nil(t, svc)
+	})
+
+	t.Run("invalid url", func(t *testing.T) {
+		svc, err := NewService(nil, ":invalid", "token", Profile{})
+		assert.Error(t, err)
+		assert.Nil(t, svc)
+	})
+
+	t.Run("profile defaults", func(t *testing.T) {
+		svc, err := NewService(nil, "https://api.example.com/scim/v2", "token", Profile{Name: "custom"})
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultPageSize, svc.Profile().PageSize)
+		assert.Equal(t, DefaultMaxMembersPerPatch, svc.Profile().MaxMembersPerPatch)
+	})
+}
+
+func TestService_Discover(t *testing.T) {
+	profile, err := GetProfile(ProfileGeneric)
+	assert.NoError(t, err)
+
+	svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/scim/v2/ServiceProviderConfig", r.URL.Path)
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+
+		fmt.Fprint(w, `{"patch": {"supported": false}, "filter": {"supported": true, "maxResults": 50}}`)
+	}, profile)
+
+	assert.NoError(t, svc.Discover(context.TODO()))
+	assert.False(t, svc.Profile().PatchSupported)
+	assert.True(t, svc.Profile().FilterSupported)
+	assert.Equal(t, 50, svc.Profile().PageSize)
+}
+
+func TestService_ListUsers(t *testing.T) {
+	profile, err := GetProfile(ProfileGeneric)
+	assert.NoError(t, err)
+	profile.PageSize = 2
+
+	requests := 0
+	svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/scim/v2/Users", r.URL.Path)
+		assert.Equal(t, "2", r.URL.Query().Get("count"))
+		assert.Equal(t, `userName sw "user"`, r.URL.Query().Get("filter"))
+
+		startIndex, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+
+		resources := make([]*User, 0)
+		for i := startIndex; i < startIndex+2 && i <= 3; i++ {
+			resources = append(resources, &User{ID: strconv.Itoa(i), UserName: fmt.Sprintf("user.%d@example.com", i)})
+		}
+
+		_ = json.NewEncoder(w).Encode(ListResponse[*User]{
+			Schemas:      []string{SchemaListResponse},
+			TotalResults: 3,
+			StartIndex:   startIndex,
+			ItemsPerPage: len(resources),
+			Resources:    resources,
+		})
+	}, profile)
+
+	users, err := svc.ListUsers(context.TODO(), `userName sw "user"`)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 3, len(users))
+	assert.Equal(t, "user.3@example.com", users[2].UserName)
+}
+
+func TestService_GetUserByUserName(t *testing.T) {
+	users := `{"totalResults": 2, "Resources": [{"id": "1", "userName": "user.1@example.com"}, {"id": "2", "userName": "User.2@example.com"}]}`
+
+	t.Run("with filter", func(t *testing.T) {
+		svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, `userName eq "user.2@example.com"`, r.URL.Query().Get("filter"))
+			fmt.Fprint(w, users)
+		}, Profile{FilterSupported: true})
+
+		got, err := svc.GetUserByUserName(context.TODO(), "user.2@example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, "2", got.ID)
+	})
+
+	t.Run("without filter", func(t *testing.T) {
+		svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "", r.URL.Query().Get("filter"))
+			fmt.Fprint(w, users)
+		}, Profile{})
+
+		got, err := svc.GetUserByUserName(context.TODO(), "user.1@example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, "1", got.ID)
+
+		got, err = svc.GetUserByUserName(context.TODO(), "user.3@example.com")
+		assert.ErrorIs(t, err, ErrUserNotFound)
+		assert.Nil(t, got)
+
+		got, err = svc.GetUserByUserName(context.TODO(), "")
+		assert.ErrorIs(t, err, ErrUserNameEmpty)
+		assert.Nil(t, got)
+	})
+}
+
+func TestService_CreateOrGetUser(t *testing.T) {
+	active := true
+	user := &User{
+		UserName: "user.1@example.com",
+		Name:     &Name{GivenName: "user", FamilyName: "1"},
+		Emails: []Email{
+			{Value: "user.1@personal.example.com", Type: "home"},
+			{Value: "user.1@example.com", Type: "work", Primary: true},
+		},
+		EnterpriseUser: &EnterpriseUser{Department: "Engineering"},
+		Active:         &active,
+	}
+
+	t.Run("created", func(t *testing.T) {
+		svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "application/scim+json", r.Header.Get("Content-Type"))
+
+			var got User
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+
+			// only the primary email and without the enterprise extension
+			assert.Equal(t, []string{SchemaUser}, got.Schemas)
+			assert.Equal(t, 1, len(got.Emails))
+			assert.Equal(t, "user.1@example.com", got.Emails[0].Value)
+			assert.Nil(t, got.EnterpriseUser)
+
+			got.ID = "1"
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(got)
+		}, Profile{})
+
+		got, err := svc.CreateOrGetUser(context.TODO(), user)
+		assert.NoError(t, err)
+		assert.Equal(t, "1", got.ID)
+	})
+
+	t.Run("already exists", func(t *testing.T) {
+		svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				var got User
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+				assert.Equal(t, []string{SchemaUser, SchemaEnterpriseUser}, got.Schemas)
+				assert.Equal(t, 2, len(got.Emails))
+
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:Error"], "status": "409", "scimType": "uniqueness", "detail": "userName already exists"}`)
+				return
+			}
+
+			fmt.Fprint(w, `{"totalResults": 1, "Resources": [{"id": "1", "userName": "user.1@example.com"}]}`)
+		}, Profile{FilterSupported: true, MultipleEmails: true, EnterpriseExtension: true})
+
+		got, err := svc.CreateOrGetUser(context.TODO(), user)
+		assert.NoError(t, err)
+		assert.Equal(t, "1", got.ID)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		svc := newTestService(t, func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status": 400, "scimType": "invalidValue", "detail": "invalid userName"}`)
+		}, Profile{})
+
+		got, err := svc.CreateOrGetUser(context.TODO(), user)
+		assert.Nil(t, got)
+
+		var httpErr *HTTPResponseError
+		assert.ErrorAs(t, err, &httpErr)
+		assert.Equal(t, http.StatusBadRequest, httpErr.StatusCode)
+		assert.Equal(t, "invalidValue", httpErr.SCIMType)
+		assert.Equal(t, "invalid userName", httpErr.Detail)
+	})
+}
+
+func TestService_Users(t *testing.T) {
+	svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/scim/v2/Users/1":
+			fmt.Fprint(w, `{"id": "1", "userName": "user.1@example.com", "active": false}`)
+		case r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			_, _ = w.Write(body)
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}, Profile{})
+
+	ctx := context.TODO()
+
+	got, err := svc.GetUser(ctx, "1")
+	assert.NoError(t, err)
+	assert.False(t, got.IsActive())
+
+	got, err = svc.GetUser(ctx, "2")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.Nil(t, got)
+
+	got, err = svc.ReplaceUser(ctx, &User{ID: "1", UserName: "user.1@example.com"})
+	assert.NoError(t, err)
+	assert.True(t, got.IsActive())
+
+	_, err = svc.ReplaceUser(ctx, &User{UserName: "user.1@example.com"})
+	assert.ErrorIs(t, err, ErrUserIDEmpty)
+
+	assert.NoError(t, svc.DeleteUser(ctx, "1"))
+	assert.ErrorIs(t, svc.DeleteUser(ctx, ""), ErrUserIDEmpty)
+}
+
+func TestService_Groups(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("ListGroups excludes the members", func(t *testing.T) {
+		svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "members", r.URL.Query().Get("excludedAttributes"))
+			fmt.Fprint(w, `{"totalResults": 1, "Resources": [{"id": "1", "displayName": "AWS-Admins"}]}`)
+		}, Profile{})
+
+		got, err := svc.ListGroups(ctx, "")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(got))
+	})
+
+	t.Run("ListGroups with members", func(t *testing.T) {
+		svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "", r.URL.Query().Get("excludedAttributes"))
+			fmt.Fprint(w, `{"totalResults": 1, "Resources": [{"id": "1", "displayName": "AWS-Admins", "members": [{"value": "u-1"}]}]}`)
+		}, Profile{GroupMembersInList: true})
+
+		got, err := svc.ListGroups(ctx, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "u-1", got[0].Members[0].Value)
+	})
+
+	t.Run("CreateOrGetGroup already exists", func(t *testing.T) {
+		svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+
+			assert.Equal(t, `displayName eq "AWS-Admins"`, r.URL.Query().Get("filter"))
+			fmt.Fprint(w, `{"totalResults": 1, "Resources": [{"id": "1", "displayName": "AWS-Admins"}]}`)
+		}, Profile{FilterSupported: true})
+
+		got, err := svc.CreateOrGetGroup(ctx, &Group{DisplayName: "AWS-Admins", ExternalID: "g-1"})
+		assert.NoError(t, err)
+		assert.Equal(t, "1", got.ID)
+
+		_, err = svc.CreateOrGetGroup(ctx, &Group{})
+		assert.ErrorIs(t, err, ErrGroupDisplayNameEmpty)
+	})
+
+	t.Run("PatchGroup", func(t *testing.T) {
+		svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPatch, r.Method)
+			assert.Equal(t, "/scim/v2/Groups/1", r.URL.Path)
+
+			var got PatchRequest
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+			assert.Equal(t, []string{SchemaPatchOp}, got.Schemas)
+			assert.Equal(t, "add", got.Operations[0].OP)
+
+			w.WriteHeader(http.StatusNoContent)
+		}, Profile{})
+
+		assert.NoError(t, svc.PatchGroup(ctx, "1", &Operation{OP: "add", Path: "members", Value: []*Member{{Value: "u-1"}}}))
+		assert.ErrorIs(t, svc.PatchGroup(ctx, ""), ErrGroupIDEmpty)
+	})
+
+	t.Run("ReplaceGroup", func(t *testing.T) {
+		svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPut, r.Method)
+
+			body, _ := io.ReadAll(r.Body)
+			// the empty members are sent to remove all of them
+			assert.Contains(t, string(body), `"members":[]`)
+			_, _ = w.Write(body)
+		}, Profile{})
+
+		got, err := svc.ReplaceGroup(ctx, &Group{ID: "1", DisplayName: "AWS-Admins"})
+		assert.NoError(t, err)
+		assert.Equal(t, "1", got.ID)
+	})
+
+	t.Run("GetGroup and DeleteGroup", func(t *testing.T) {
+		svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodDelete {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}, Profile{})
+
+		got, err := svc.GetGroup(ctx, "1")
+		assert.ErrorIs(t, err, ErrGroupNotFound)
+		assert.Nil(t, got)
+
+		assert.NoError(t, svc.DeleteGroup(ctx, "1"))
+	})
+}